@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/mdns"
+	"github.com/brianhealey/sensecap-server/internal/watcher"
+)
+
+// autoConfigure is the interactive menu option that points the connected device at a server
+// found on the network
+func (m *Menu) autoConfigure() error {
+	if !m.ble.IsConnected() {
+		return fmt.Errorf("not connected to device")
+	}
+
+	fmt.Println("\n=== Point Device at Local Server ===")
+	url := m.readServiceURL()
+	if url == "" {
+		return fmt.Errorf("no server URL given")
+	}
+	token := m.readInput("Enter the server's device token (empty = none): ")
+
+	return pointAtServer(m.ble, url, token)
+}
+
+// runAutoConfigCommand implements the non-interactive "autoconfig" subcommand:
+//
+//	watcher-config autoconfig [-server NAME|URL] [-token TOKEN] [-device NAME|ADDRESS]
+func runAutoConfigCommand(ble *watcher.BLEHandler, args []string) error {
+	fs := flag.NewFlagSet("autoconfig", flag.ContinueOnError)
+	server := fs.String("server", "", "Server URL, or mDNS instance name (required if more than one server is found)")
+	token := fs.String("token", "", "The server's device token (AUTH_TOKEN)")
+	device := fs.String("device", "", "Device name or BLE address (required if more than one Watcher is in range)")
+	scan := fs.Duration("scan", 5*time.Second, "BLE scan duration")
+	discover := fs.Duration("discover", 2*time.Second, "How long to wait for servers to answer the mDNS query")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	url := *server
+	if !strings.Contains(url, "://") {
+		found, err := discoverServer(*discover, *server)
+		if err != nil {
+			return err
+		}
+		if err := checkToken(found, *token); err != nil {
+			return err
+		}
+		url = found.URL()
+		fmt.Printf("Found %s at %s\n", found.Instance, url)
+	}
+
+	watchers, err := ble.ScanForWatchers(*scan)
+	if err != nil {
+		return err
+	}
+	target, err := selectWatcher(watchers, *device)
+	if err != nil {
+		return err
+	}
+
+	if err := ble.Connect(target); err != nil {
+		return err
+	}
+
+	return pointAtServer(ble, url, *token)
+}
+
+// discoverServer returns the server advertised over mDNS with the given instance name, or the
+// only server found
+func discoverServer(timeout time.Duration, name string) (*mdns.Found, error) {
+	fmt.Println("Looking for servers on the network...")
+	found, err := mdns.Browse(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		switch len(found) {
+		case 0:
+			return nil, fmt.Errorf("no server found on the network, specify its URL with -server")
+		case 1:
+			return found[0], nil
+		}
+		names := make([]string, len(found))
+		for i, f := range found {
+			names[i] = fmt.Sprintf("%q", f.Instance)
+		}
+		return nil, fmt.Errorf("found %d servers (%s), specify one with -server", len(found), strings.Join(names, ", "))
+	}
+
+	for _, f := range found {
+		if strings.EqualFold(f.Instance, name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("server %s not found on the network", name)
+}
+
+// checkToken catches a token that cannot be the server's, using what its advertisement
+// reveals: whether it needs one, and the first characters of long tokens
+func checkToken(found *mdns.Found, token string) error {
+	switch {
+	case found.Text["auth"] == "token" && token == "":
+		return fmt.Errorf("%s requires a device token, pass it with -token", found.Instance)
+	case found.Text["token_hint"] != "" && !strings.HasPrefix(token, found.Text["token_hint"]):
+		return fmt.Errorf("the token does not match %s (its token starts with %s)", found.Instance, found.Text["token_hint"])
+	}
+	return nil
+}
+
+// pointAtServer enables the notification proxy and image analyzer with the server's URL and
+// token in one command, then reads the settings back to verify the device kept them
+func pointAtServer(ble *watcher.BLEHandler, url, token string) error {
+	service := watcher.LocalServiceConfig{Switch: 1, URL: url, Token: token}
+	cmd, err := watcher.BuildLocalServiceSetCommand(watcher.LocalServiceData{
+		NotificationProxy: &service,
+		ImageAnalyzer:     &service,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pointing the device at %s...\n", url)
+	resp, err := ble.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("device rejected the local service settings (code: %d)", resp.Code)
+	}
+
+	resp, err = ble.SendCommand(watcher.BuildLocalServiceQuery())
+	if err != nil {
+		return fmt.Errorf("failed to read the settings back: %w", err)
+	}
+	var current watcher.LocalServiceData
+	if err := json.Unmarshal(resp.Data, &current); err != nil {
+		return fmt.Errorf("failed to parse local services: %w", err)
+	}
+
+	for _, s := range []struct {
+		name string
+		got  *watcher.LocalServiceConfig
+	}{
+		{"notification_proxy", current.NotificationProxy},
+		{"image_analyzer", current.ImageAnalyzer},
+	} {
+		switch {
+		case s.got == nil:
+			return fmt.Errorf("device did not report %s", s.name)
+		case s.got.Switch != 1 || s.got.URL != url:
+			return fmt.Errorf("device reports %s as switch %d, url %q", s.name, s.got.Switch, s.got.URL)
+		case s.got.Token != "" && s.got.Token != token:
+			// Devices may not report the token; when they do, it must be the one sent
+			return fmt.Errorf("device reports a different token for %s", s.name)
+		}
+		fmt.Printf("✓ %s: %s\n", s.name, s.got.URL)
+	}
+	return nil
+}
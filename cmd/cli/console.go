@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consoleLog appends sent commands and received notifications to a file
+type consoleLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (l *consoleLog) write(direction, text string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.file, "%s %s %q\n", time.Now().Format("2006-01-02T15:04:05.000"), direction, text)
+}
+
+// rawConsole is the interactive menu option for typing arbitrary AT commands.
+// Every notification from the device is printed as it arrives, unparsed.
+func (m *Menu) rawConsole() error {
+	if !m.ble.IsConnected() {
+		return fmt.Errorf("not connected to device")
+	}
+
+	var logger *consoleLog
+	if path := m.readInput("Log session to file (blank for none): "); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		defer file.Close()
+		logger = &consoleLog{file: file}
+		fmt.Printf("Logging to %s\n", path)
+	}
+
+	fmt.Println("\n=== AT Console ===")
+	fmt.Println("Type AT commands (e.g. AT+deviceinfo?); device output is shown as it arrives.")
+	fmt.Println("Commands: history, !! (repeat last), !N (repeat entry N), exit")
+
+	m.ble.SetNotificationListener(func(data []byte) {
+		text := string(data)
+		fmt.Print(strings.ReplaceAll(text, "\r\n", "\n"))
+		logger.write("<", text)
+	})
+	defer m.ble.SetNotificationListener(nil)
+
+	for {
+		line := m.readInput("AT> ")
+
+		switch {
+		case line == "":
+			continue
+		case line == "exit" || line == "quit":
+			return nil
+		case line == "history":
+			for i, cmd := range m.history {
+				fmt.Printf("%4d  %s\n", i+1, cmd)
+			}
+			continue
+		case strings.HasPrefix(line, "!"):
+			cmd, err := m.recallHistory(line)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			fmt.Printf("AT> %s\n", cmd)
+			line = cmd
+		}
+
+		m.history = append(m.history, line)
+		logger.write(">", line)
+		if err := m.ble.SendRaw(line); err != nil {
+			return err
+		}
+	}
+}
+
+// recallHistory resolves "!!" and "!N" to a previously entered command
+func (m *Menu) recallHistory(ref string) (string, error) {
+	if len(m.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if ref == "!!" {
+		return m.history[len(m.history)-1], nil
+	}
+
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(m.history) {
+		return "", fmt.Errorf("no history entry %s", ref[1:])
+	}
+	return m.history[n-1], nil
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/brianhealey/sensecap-server/internal/mdns"
 	"github.com/brianhealey/sensecap-server/internal/watcher"
 )
 
@@ -32,6 +33,29 @@ func main() {
 		}
 	}()
 
+	// Non-interactive subcommands
+	if len(os.Args) > 1 && os.Args[1] == "ota" {
+		if err := runOTACommand(ble, os.Args[2:]); err != nil {
+			ble.Disconnect()
+			log.Fatalf("Firmware update failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "autoconfig" {
+		if err := runAutoConfigCommand(ble, os.Args[2:]); err != nil {
+			ble.Disconnect()
+			log.Fatalf("Auto-configuration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := runSelfTestCommand(ble, os.Args[2:]); err != nil {
+			ble.Disconnect()
+			log.Fatalf("Self-test failed: %v", err)
+		}
+		return
+	}
+
 	// Create and run menu
 	menu := NewMenu(ble)
 	if err := menu.Run(); err != nil {
@@ -42,8 +66,9 @@ func main() {
 
 // Menu handles the interactive CLI menu
 type Menu struct {
-	ble    *watcher.BLEHandler
-	reader *bufio.Reader
+	ble     *watcher.BLEHandler
+	reader  *bufio.Reader
+	history []string // Raw AT console command history
 }
 
 // NewMenu creates a new menu
@@ -118,6 +143,18 @@ func (m *Menu) Run() error {
 				fmt.Printf("Error: %v\n", err)
 			}
 		case "15":
+			if err := m.firmwareUpdate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "16":
+			if err := m.rawConsole(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "17":
+			if err := m.serverSelfTest(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "18":
 			m.ble.Disconnect()
 			fmt.Println("Goodbye!")
 			return nil
@@ -160,8 +197,13 @@ func (m *Menu) printMainMenu() {
 	fmt.Println(" 13. Set Task Flow (JSON)")
 	fmt.Println("\nCustomization:")
 	fmt.Println(" 14. Download Emoji/Images")
+	fmt.Println("\nFirmware:")
+	fmt.Println(" 15. Firmware Update (BLE)")
+	fmt.Println("\nAdvanced:")
+	fmt.Println(" 16. Raw AT Console")
+	fmt.Println(" 17. Server Self-Test")
 	fmt.Println("\nExit:")
-	fmt.Println(" 15. Disconnect and Exit")
+	fmt.Println(" 18. Disconnect and Exit")
 	fmt.Println("----------------------------------------")
 }
 
@@ -337,7 +379,8 @@ func (m *Menu) configureLocalServices() error {
 	fmt.Println("3. Training")
 	fmt.Println("4. Notification Proxy")
 	fmt.Println("5. View Current Configuration")
-	fmt.Println("6. Back")
+	fmt.Println("6. Point Notification Proxy and Image Analyzer at a Local Server")
+	fmt.Println("7. Back")
 
 	choice := m.readInput("Select: ")
 
@@ -346,6 +389,10 @@ func (m *Menu) configureLocalServices() error {
 	}
 
 	if choice == "6" {
+		return m.autoConfigure()
+	}
+
+	if choice == "7" {
 		return nil
 	}
 
@@ -355,7 +402,7 @@ func (m *Menu) configureLocalServices() error {
 		switchVal = 1
 	}
 
-	url := m.readInput("Enter service URL: ")
+	url := m.readServiceURL()
 	token := m.readInput("Enter token (optional): ")
 
 	serviceConfig := watcher.LocalServiceConfig{
@@ -430,10 +477,13 @@ func (m *Menu) configureDeviceSettings() error {
 	fmt.Println("2. Set Sound Volume")
 	fmt.Println("3. Toggle RGB LED")
 	fmt.Println("4. Set Screen Timeout")
-	fmt.Println("5. Set Timezone")
-	fmt.Println("6. Reboot Device")
-	fmt.Println("7. Factory Reset")
-	fmt.Println("8. Back")
+	fmt.Println("5. Toggle Screen Auto-Off")
+	fmt.Println("6. Set Timezone")
+	fmt.Println("7. Toggle Daylight Saving")
+	fmt.Println("8. Reboot Device")
+	fmt.Println("9. Shut Down Device")
+	fmt.Println("10. Factory Reset")
+	fmt.Println("11. Back")
 
 	choice := m.readInput("Select: ")
 
@@ -458,9 +508,23 @@ func (m *Menu) configureDeviceSettings() error {
 		val := m.readInputInt("Enter screen timeout: ")
 		config.ScreenOffTime = &val
 	case "5":
+		enabled := m.readInput("Turn the screen off after the timeout? (y/n): ")
+		val := 0
+		if strings.ToLower(enabled) == "y" {
+			val = 1
+		}
+		config.ScreenOffSwitch = &val
+	case "6":
 		val := m.readInputInt("Enter timezone offset (hours from UTC): ")
 		config.Timezone = &val
-	case "6":
+	case "7":
+		enabled := m.readInput("Enable daylight saving time? (y/n): ")
+		val := 0
+		if strings.ToLower(enabled) == "y" {
+			val = 1
+		}
+		config.Daylight = &val
+	case "8":
 		confirm := m.readInput("Reboot device? (y/n): ")
 		if strings.ToLower(confirm) == "y" {
 			val := 1
@@ -468,15 +532,26 @@ func (m *Menu) configureDeviceSettings() error {
 		} else {
 			return nil
 		}
-	case "7":
-		confirm := m.readInput("Factory reset device? This will erase all data! (y/n): ")
+	case "9":
+		confirm := m.readInput("Shut down device? (y/n): ")
 		if strings.ToLower(confirm) == "y" {
 			val := 1
-			config.Reset = &val
+			config.Shutdown = &val
 		} else {
 			return nil
 		}
-	case "8":
+	case "10":
+		confirm := m.readInput("Factory reset device? This will erase all data! (y/n): ")
+		if strings.ToLower(confirm) != "y" {
+			return nil
+		}
+		val := 1
+		if strings.ToLower(m.readInput("Shut down after the reset? (y/n): ")) == "y" {
+			config.ResetShutdown = &val
+		} else {
+			config.Reset = &val
+		}
+	case "11":
 		return nil
 	default:
 		return fmt.Errorf("invalid selection")
@@ -799,6 +874,31 @@ func (m *Menu) downloadEmoji() error {
 	return nil
 }
 
+// readServiceURL offers the servers advertised over mDNS on this computer's network, or
+// reads a URL typed in
+func (m *Menu) readServiceURL() string {
+	fmt.Println("Looking for servers on the network...")
+	found, err := mdns.Browse(2 * time.Second)
+	if err != nil || len(found) == 0 {
+		return m.readInput("Enter service URL: ")
+	}
+
+	for i, f := range found {
+		fmt.Printf("%d. %s - %s", i+1, f.Instance, f.URL())
+		if hint := f.Text["token_hint"]; hint != "" {
+			fmt.Printf(" (token %s...)", hint)
+		} else if f.Text["auth"] == "none" {
+			fmt.Print(" (no token)")
+		}
+		fmt.Println()
+	}
+	input := m.readInput("Select a server or enter a service URL: ")
+	if i, err := strconv.Atoi(input); err == nil && i >= 1 && i <= len(found) {
+		return found[i-1].URL()
+	}
+	return input
+}
+
 func (m *Menu) readInput(prompt string, args ...interface{}) string {
 	fmt.Printf(prompt, args...)
 	text, _ := m.reader.ReadString('\n')
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/watcher"
+)
+
+// firmwareUpdate is the interactive menu option for pushing firmware over BLE
+func (m *Menu) firmwareUpdate() error {
+	if !m.ble.IsConnected() {
+		return fmt.Errorf("not connected to device")
+	}
+
+	fmt.Println("\n=== Firmware Update (BLE) ===")
+	fmt.Println("Note: requires device firmware that implements the AT+ota command (see BLUETOOTH_API.md)")
+	fmt.Println("1. ESP32 firmware")
+	fmt.Println("2. Himax firmware")
+
+	var component string
+	switch m.readInput("Select component: ") {
+	case "1":
+		component = "esp32"
+	case "2":
+		component = "himax"
+	default:
+		return fmt.Errorf("invalid selection")
+	}
+
+	path := m.readInput("Enter firmware file path: ")
+	image, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read firmware file: %w", err)
+	}
+
+	confirm := m.readInput("Push %s (%d bytes) to the device? (y/n): ", path, len(image))
+	if strings.ToLower(confirm) != "y" {
+		fmt.Println("Cancelled")
+		return nil
+	}
+
+	return pushFirmware(m.ble, component, image, watcher.DefaultOTAChunkSize)
+}
+
+// runOTACommand implements the non-interactive "ota" subcommand:
+//
+//	watcher-config ota -file firmware.bin [-component esp32|himax] [-device NAME|ADDRESS] [-chunk 4096]
+func runOTACommand(ble *watcher.BLEHandler, args []string) error {
+	fs := flag.NewFlagSet("ota", flag.ContinueOnError)
+	file := fs.String("file", "", "Firmware image to push (required)")
+	component := fs.String("component", "esp32", "Firmware component (esp32 or himax)")
+	device := fs.String("device", "", "Device name or BLE address (required if more than one Watcher is in range)")
+	chunk := fs.Int("chunk", watcher.DefaultOTAChunkSize, "Bytes per transfer chunk")
+	scan := fs.Duration("scan", 5*time.Second, "BLE scan duration")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	if *component != "esp32" && *component != "himax" {
+		return fmt.Errorf("-component must be esp32 or himax")
+	}
+
+	image, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read firmware file: %w", err)
+	}
+
+	watchers, err := ble.ScanForWatchers(*scan)
+	if err != nil {
+		return err
+	}
+	target, err := selectWatcher(watchers, *device)
+	if err != nil {
+		return err
+	}
+
+	if err := ble.Connect(target); err != nil {
+		return err
+	}
+
+	return pushFirmware(ble, *component, image, *chunk)
+}
+
+// selectWatcher picks the device matching name or address, or the only device found
+func selectWatcher(watchers []watcher.WatcherDevice, device string) (watcher.WatcherDevice, error) {
+	if device == "" {
+		if len(watchers) == 1 {
+			return watchers[0], nil
+		}
+		return watcher.WatcherDevice{}, fmt.Errorf("found %d Watcher devices, specify one with -device", len(watchers))
+	}
+
+	for _, w := range watchers {
+		if strings.EqualFold(w.Name, device) || strings.EqualFold(w.Address, device) {
+			return w, nil
+		}
+	}
+	return watcher.WatcherDevice{}, fmt.Errorf("device %s not found", device)
+}
+
+// pushFirmware transfers the image with a progress bar
+func pushFirmware(ble *watcher.BLEHandler, component string, image []byte, chunkSize int) error {
+	fmt.Printf("Pushing %s firmware (%d bytes)...\n", component, len(image))
+
+	start := time.Now()
+	err := ble.PushFirmware(component, image, chunkSize, func(sent, total int) {
+		printOTAProgress(sent, total, time.Since(start))
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Firmware verified by device in %s; the device will restart to apply it\n", time.Since(start).Round(time.Second))
+	return nil
+}
+
+func printOTAProgress(sent, total int, elapsed time.Duration) {
+	const width = 30
+	filled := width * sent / total
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(sent) / 1024 / elapsed.Seconds()
+	}
+
+	fmt.Printf("\r  [%s%s] %3d%% (%d/%d bytes, %.1f KB/s)",
+		strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+		100*sent/total, sent, total, rate)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/watcher"
+)
+
+// serverSelfTest is the interactive menu option that has the device call the server's
+// self-test endpoint
+func (m *Menu) serverSelfTest() error {
+	if !m.ble.IsConnected() {
+		return fmt.Errorf("not connected to device")
+	}
+
+	fmt.Println("\n=== Server Self-Test ===")
+	fmt.Println("Note: requires device firmware that implements the AT+selftest command (see BLUETOOTH_API.md)")
+	fmt.Println("The device calls <server>/v2/watcher/selftest with its usual headers and plays the reply tone.")
+
+	url := m.readInput("Server URL (empty = device's configured audio service): ")
+	token := ""
+	if url != "" {
+		token = m.readInput("Auth token (empty = none): ")
+	}
+
+	return runSelfTest(m.ble, url, token)
+}
+
+// runSelfTestCommand implements the non-interactive "selftest" subcommand:
+//
+//	watcher-config selftest [-url http://server:8000] [-token TOKEN] [-device NAME|ADDRESS]
+func runSelfTestCommand(ble *watcher.BLEHandler, args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	url := fs.String("url", "", "Server URL (default: the device's configured audio service)")
+	token := fs.String("token", "", "Auth token to send (default: the device's configured token)")
+	device := fs.String("device", "", "Device name or BLE address (required if more than one Watcher is in range)")
+	scan := fs.Duration("scan", 5*time.Second, "BLE scan duration")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	watchers, err := ble.ScanForWatchers(*scan)
+	if err != nil {
+		return err
+	}
+	target, err := selectWatcher(watchers, *device)
+	if err != nil {
+		return err
+	}
+
+	if err := ble.Connect(target); err != nil {
+		return err
+	}
+
+	return runSelfTest(ble, *url, *token)
+}
+
+// runSelfTest sends AT+selftest and reports what the device saw
+func runSelfTest(ble *watcher.BLEHandler, url, token string) error {
+	cmd, err := watcher.BuildSelfTestCommand(url, token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Waiting for the device to reach the server...")
+	resp, err := ble.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("device rejected self-test (code: %d)", resp.Code)
+	}
+
+	var result watcher.SelfTestResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return fmt.Errorf("failed to parse self-test result: %w", err)
+	}
+
+	switch {
+	case result.Error != "" || result.Status == 0:
+		return fmt.Errorf("device could not reach the server: %s", result.Error)
+	case result.Status == 401 || result.Status == 403:
+		return fmt.Errorf("server rejected the device (HTTP %d): check the token and device registration", result.Status)
+	case result.Status != 200:
+		return fmt.Errorf("server answered HTTP %d", result.Status)
+	case result.AudioBytes == 0:
+		return fmt.Errorf("server answered in %dms but the device found no audio in the reply", result.LatencyMs)
+	}
+
+	fmt.Printf("✓ Server reachable: HTTP %d in %dms, %d bytes of audio received\n",
+		result.Status, result.LatencyMs, result.AudioBytes)
+	return nil
+}
@@ -0,0 +1,322 @@
+// Command replay sends captured device requests (see -debug-capture) to a server again, to
+// reproduce a bug from the exact bytes a Watcher sent or to load-test the AI pipeline with
+// real traffic. Captures come from JSON files or directories (the blob store's captures/,
+// or saved GET /api/debug/captures/{id} responses) or from a server's debug API with -from.
+//
+//	replay [-url http://localhost:8000] [-token TOKEN] [-timing] [-concurrency N] [-repeat N] [file|dir ...]
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/capture"
+)
+
+// hopHeaders are captured request headers that belong to the original connection; the
+// client sets its own
+var hopHeaders = []string{
+	"Accept-Encoding", "Connection", "Content-Length", "Keep-Alive", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// replayer sends captures to the target server
+type replayer struct {
+	url          string
+	token        string
+	eui          string
+	stripPrefix  string
+	keepSessions bool
+	client       *http.Client
+}
+
+// result is the outcome of replaying one capture
+type result struct {
+	capture  *capture.Capture
+	status   int
+	duration time.Duration
+	err      error
+}
+
+func main() {
+	log.SetFlags(log.Ltime)
+
+	r := &replayer{client: &http.Client{Timeout: 5 * time.Minute}} // Voice replies wait on the LLM and TTS
+	flag.StringVar(&r.url, "url", envOr("REPLAY_URL", "http://localhost:8000"), "Server to replay against, including any base path (env REPLAY_URL)")
+	flag.StringVar(&r.token, "token", os.Getenv("REPLAY_TOKEN"), "Device token to send as the Authorization header; captures keep no credentials (env REPLAY_TOKEN)")
+	flag.StringVar(&r.eui, "eui", os.Getenv("REPLAY_EUI"), "Replace the captured device EUI header (env REPLAY_EUI)")
+	flag.StringVar(&r.stripPrefix, "strip-prefix", "", "Base path of the server the captures were recorded on, removed from captured paths")
+	flag.BoolVar(&r.keepSessions, "keep-sessions", false, "Send captured Session-Id headers unchanged (by default each replay gets its own, so voice requests are not answered from the response cache)")
+	from := flag.String("from", "", "Fetch the captures buffered by this server's debug API instead of reading files (replayed against it unless -url is given)")
+	fromToken := flag.String("from-token", os.Getenv("REPLAY_FROM_TOKEN"), "Admin token for -from (default: -token) (env REPLAY_FROM_TOKEN)")
+	pathFilter := flag.String("path", "", "Only replay captures whose path contains this")
+	device := flag.String("device", "", "Only replay captures from this device EUI")
+	timing := flag.Bool("timing", false, "Keep the original gaps between requests instead of sending them back to back")
+	speed := flag.Float64("speed", 1, "With -timing, replay this many times faster than recorded")
+	concurrency := flag.Int("concurrency", 1, "Requests in flight at once when not using -timing")
+	repeat := flag.Int("repeat", 1, "Replay the captures this many times")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: replay [flags] [file|dir ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *speed <= 0 || *concurrency < 1 || *repeat < 1 {
+		log.Fatal("-speed, -concurrency and -repeat must be positive")
+	}
+
+	var captures []*capture.Capture
+	var err error
+	switch {
+	case *from != "":
+		token := *fromToken
+		if token == "" {
+			token = r.token
+		}
+		captures, err = fetchCaptures(r.client, *from, token)
+		if !flagSet("url") && os.Getenv("REPLAY_URL") == "" {
+			r.url = *from
+		}
+	case flag.NArg() > 0:
+		captures, err = loadPaths(flag.Args())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	captures = filter(captures, *pathFilter, *device)
+	if len(captures) == 0 {
+		log.Fatal("No captures to replay")
+	}
+	sort.SliceStable(captures, func(i, j int) bool {
+		return captures[i].Timestamp.Before(captures[j].Timestamp)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Replaying %d captures against %s", len(captures), r.url)
+	var results []result
+	for pass := 1; pass <= *repeat && ctx.Err() == nil; pass++ {
+		if *repeat > 1 {
+			log.Printf("Pass %d of %d", pass, *repeat)
+		}
+		if *timing {
+			results = append(results, r.replayTimed(ctx, captures, pass, *speed)...)
+		} else {
+			results = append(results, r.replayConcurrent(ctx, captures, pass, *concurrency)...)
+		}
+	}
+
+	if !summarize(results) {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// filter keeps the captures matching a path substring and device EUI (either may be empty)
+func filter(captures []*capture.Capture, path, device string) []*capture.Capture {
+	var kept []*capture.Capture
+	for _, c := range captures {
+		if strings.Contains(c.Path, path) && (device == "" || strings.EqualFold(c.DeviceEUI, device)) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// replayTimed sends each capture at its original offset from the first, divided by speed,
+// without waiting for earlier replies, as devices would
+func (r *replayer) replayTimed(ctx context.Context, captures []*capture.Capture, pass int, speed float64) []result {
+	results := make([]result, len(captures))
+	var wg sync.WaitGroup
+	start, first := time.Now(), captures[0].Timestamp
+
+	for i, c := range captures {
+		wait := time.Until(start.Add(time.Duration(float64(c.Timestamp.Sub(first)) / speed)))
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return results[:i]
+		case <-time.After(wait):
+		}
+
+		wg.Add(1)
+		go func(i int, c *capture.Capture) {
+			defer wg.Done()
+			results[i] = r.send(ctx, c, pass, i)
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// replayConcurrent sends the captures back to back from a number of workers
+func (r *replayer) replayConcurrent(ctx context.Context, captures []*capture.Capture, pass, workers int) []result {
+	results := make([]result, len(captures))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = r.send(ctx, captures[i], pass, i)
+			}
+		}()
+	}
+
+	sent := 0
+	for i := range captures {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+		sent++
+	}
+	close(jobs)
+	wg.Wait()
+	return results[:sent]
+}
+
+// send replays one capture and logs the outcome next to the captured one
+func (r *replayer) send(ctx context.Context, c *capture.Capture, pass, index int) result {
+	res := result{capture: c}
+	req, err := r.request(ctx, c, pass, index)
+	if err != nil {
+		res.err = err
+		log.Printf("#%d %s %s: %v", c.ID, c.Method, c.Path, err)
+		return res
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		res.status = resp.StatusCode
+	}
+	res.duration = time.Since(start)
+	res.err = err
+
+	switch {
+	case err != nil:
+		log.Printf("#%d %s %s: %v", c.ID, c.Method, c.Path, err)
+	case res.status != c.StatusCode:
+		log.Printf("#%d %s %s: %d in %v, captured %d in %v (MISMATCH)", c.ID, c.Method, c.Path,
+			res.status, res.duration.Round(time.Millisecond), c.StatusCode, c.Duration.Round(time.Millisecond))
+	default:
+		log.Printf("#%d %s %s: %d in %v, captured %v", c.ID, c.Method, c.Path,
+			res.status, res.duration.Round(time.Millisecond), c.Duration.Round(time.Millisecond))
+	}
+	return res
+}
+
+// request rebuilds the captured request for the target server
+func (r *replayer) request(ctx context.Context, c *capture.Capture, pass, index int) (*http.Request, error) {
+	target := strings.TrimRight(r.url, "/") + strings.TrimPrefix(c.Path, r.stripPrefix)
+	if c.Query != "" {
+		target += "?" + c.Query
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Method, target, bytes.NewReader(c.RequestBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = c.RequestHeaders.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	// Captures do not keep credentials; without -token the request goes out without them
+	for name, values := range req.Header {
+		if len(values) > 0 && values[0] == capture.Redacted {
+			req.Header.Del(name)
+		}
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", r.token) // The firmware sends the bare token
+	}
+	if r.eui != "" {
+		req.Header.Set("API-OBITER-DEVICE-EUI", r.eui)
+	}
+	if session := req.Header.Get("Session-Id"); session != "" && !r.keepSessions {
+		req.Header.Set("Session-Id", fmt.Sprintf("%s-replay%d-%d-%d", session, time.Now().Unix(), pass, index))
+	}
+	return req, nil
+}
+
+// summarize prints per-path latencies and reports whether every request got its captured status
+func summarize(results []result) bool {
+	byPath := make(map[string][]time.Duration)
+	var paths []string
+	failed, mismatched := 0, 0
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+			continue
+		}
+		if res.status != res.capture.StatusCode {
+			mismatched++
+		}
+		key := res.capture.Method + " " + res.capture.Path
+		if byPath[key] == nil {
+			paths = append(paths, key)
+		}
+		byPath[key] = append(byPath[key], res.duration)
+	}
+	sort.Strings(paths)
+
+	fmt.Printf("\n%d requests, %d failed, %d with a different status than captured\n", len(results), failed, mismatched)
+	if len(paths) > 0 {
+		fmt.Printf("\n%-50s %6s %10s %10s %10s\n", "REQUEST", "COUNT", "P50", "P95", "MAX")
+		for _, path := range paths {
+			d := byPath[path]
+			sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+			fmt.Printf("%-50s %6d %10v %10v %10v\n", path, len(d),
+				percentile(d, 50), percentile(d, 95), d[len(d)-1].Round(time.Millisecond))
+		}
+	}
+	return failed == 0 && mismatched == 0
+}
+
+// percentile returns the pth percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Millisecond)
+}
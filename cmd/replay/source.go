@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/capture"
+)
+
+// loadPaths reads captures from files and directories. A file holds one capture, either as
+// persisted under captures/ in the blob store or as saved from GET /api/debug/captures/{id}.
+// Directories are searched for .json files, skipping any that are not captures.
+func loadPaths(paths []string) ([]*capture.Capture, error) {
+	var captures []*capture.Capture
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			c, err := loadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			captures = append(captures, c)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(file, ".json") {
+				return err
+			}
+			c, err := loadFile(file)
+			if err != nil {
+				log.Printf("Skipping %v", err)
+				return nil
+			}
+			captures = append(captures, c)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return captures, nil
+}
+
+func loadFile(path string) (*capture.Capture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeCapture(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// decodeCapture accepts a bare capture or the {"code": ..., "data": capture} envelope of the debug API
+func decodeCapture(data []byte) (*capture.Capture, error) {
+	var envelope struct {
+		Data *capture.Capture `json:"data"`
+	}
+	c := &capture.Capture{}
+	if err := json.Unmarshal(data, &envelope); err == nil && envelope.Data != nil {
+		c = envelope.Data
+	} else if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("not a capture: %w", err)
+	}
+	if c.Method == "" || c.Path == "" {
+		return nil, fmt.Errorf("not a capture: no method or path")
+	}
+	return c, nil
+}
+
+// fetchCaptures downloads the captures buffered by a server started with -debug-capture
+func fetchCaptures(client *http.Client, serverURL, token string) ([]*capture.Capture, error) {
+	base := strings.TrimRight(serverURL, "/") + "/api/debug/captures"
+
+	var list struct {
+		Data struct {
+			Enabled  bool              `json:"enabled"`
+			Captures []capture.Summary `json:"captures"`
+		} `json:"data"`
+	}
+	data, err := get(client, base, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode capture list: %w", err)
+	}
+	if !list.Data.Enabled {
+		return nil, fmt.Errorf("%s is not running with -debug-capture", serverURL)
+	}
+
+	captures := make([]*capture.Capture, 0, len(list.Data.Captures))
+	for _, summary := range list.Data.Captures {
+		data, err := get(client, fmt.Sprintf("%s/%d", base, summary.ID), token)
+		if err != nil {
+			// Evicted from the ring buffer since the listing
+			log.Printf("Skipping capture %d: %v", summary.ID, err)
+			continue
+		}
+		c, err := decodeCapture(data)
+		if err != nil {
+			return nil, fmt.Errorf("capture %d: %w", summary.ID, err)
+		}
+		captures = append(captures, c)
+	}
+	return captures, nil
+}
+
+func get(client *http.Client, url, token string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
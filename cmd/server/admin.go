@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// adminTime is how the admin commands print times (local time)
+const adminTime = "2006-01-02 15:04:05"
+
+// eventsTailPoll is how often `events tail -follow` checks for new events. The command runs
+// outside the server process, so it cannot wait on database.EventsStored.
+const eventsTailPoll = time.Second
+
+// Flags of `server events tail`
+var (
+	tailLines  int
+	tailFollow bool
+	tailDevice string
+	tailType   string
+)
+
+func eventsTailFlags() {
+	flag.IntVar(&tailLines, "n", 20, "Number of latest events to print")
+	flag.BoolVar(&tailFollow, "follow", false, "Keep printing new events until interrupted")
+	flag.StringVar(&tailDevice, "device", "", "Only events of this device EUI")
+	flag.StringVar(&tailType, "type", "", "Only events of this type ("+strings.Join(database.EventTypes, ", ")+")")
+}
+
+// newTable returns a writer aligning tab-separated columns on stdout
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// runDevicesList prints every device the server knows
+func runDevicesList(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	devices, err := database.GetDeviceSummaries()
+	if err != nil {
+		return err
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "EUI\tNAME\tREGISTERED\tTASKS\tEVENTS\tLAST EVENT")
+	for _, d := range devices {
+		lastEvent := "-"
+		if d.LastEventAt != nil {
+			lastEvent = d.LastEventAt.Local().Format(adminTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%s\n", d.EUI, d.Name, d.Registered, d.Tasks, d.Events, lastEvent)
+	}
+	return tw.Flush()
+}
+
+// runTaskFlowsList prints the task flows of all devices, or of the device in args
+func runTaskFlowsList(cfg *config.Config, args []string) error {
+	var taskFlows []*database.TaskFlow
+	var err error
+	switch len(args) {
+	case 0:
+		taskFlows, err = database.GetTaskFlows()
+	case 1:
+		taskFlows, err = database.GetTaskFlowsByDevice(strings.ToUpper(args[0]))
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "ID\tDEVICE\tSTATE\tHEADLINE\tTARGETS\tUPDATED")
+	for _, tf := range taskFlows {
+		state := "active"
+		switch {
+		case tf.Draft:
+			state = "draft"
+		case tf.Paused:
+			state = "paused"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", tf.ID, tf.DeviceEUI, state, tf.Headline,
+			strings.Join(tf.TargetObjects, ","), tf.UpdatedAt.Local().Format(adminTime))
+	}
+	return tw.Flush()
+}
+
+// runTaskFlowsDelete deletes the task flow in args. Its device stops running it at its next
+// task poll.
+func runTaskFlowsDelete(cfg *config.Config, args []string) error {
+	tf, err := taskFlowArg(args)
+	if err != nil {
+		return err
+	}
+	if err := database.DeleteTaskFlow(tf.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted task flow %d (%s) of %s\n", tf.ID, tf.Headline, tf.DeviceEUI)
+	return nil
+}
+
+// runTaskFlowsPause pauses the task flow in args, as the task watchdog does
+func runTaskFlowsPause(cfg *config.Config, args []string) error {
+	tf, err := taskFlowArg(args)
+	if err != nil {
+		return err
+	}
+	if err := database.PauseTaskFlow(tf.ID, "paused from the command line"); err != nil {
+		return err
+	}
+	fmt.Printf("Paused task flow %d (%s) of %s\n", tf.ID, tf.Headline, tf.DeviceEUI)
+	return nil
+}
+
+// runTaskFlowsResume resumes the paused task flow in args
+func runTaskFlowsResume(cfg *config.Config, args []string) error {
+	tf, err := taskFlowArg(args)
+	if err != nil {
+		return err
+	}
+	if err := database.ResumeTaskFlow(tf.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Resumed task flow %d (%s) of %s\n", tf.ID, tf.Headline, tf.DeviceEUI)
+	return nil
+}
+
+// taskFlowArg loads the task flow whose ID is the only argument
+func taskFlowArg(args []string) (*database.TaskFlow, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, errUsage
+	}
+	tf, err := database.GetTaskFlowByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, fmt.Errorf("task flow %d not found", id)
+	}
+	return tf, nil
+}
+
+// runEventsTail prints the latest events, then with -follow polls for new ones until interrupted
+func runEventsTail(cfg *config.Config, args []string) error {
+	if len(args) != 0 || tailLines < 0 {
+		return errUsage
+	}
+	if tailType != "" && !database.ValidEventType(tailType) {
+		return fmt.Errorf("-type must be one of: %s", strings.Join(database.EventTypes, ", "))
+	}
+
+	q := database.EventFeedQuery{EventType: tailType, Limit: tailLines, Latest: true}
+	if tailDevice != "" {
+		q.Devices = []string{strings.ToUpper(tailDevice)}
+	}
+	if tailLines == 0 {
+		// Only new events
+		last, err := database.LastNotificationEventID()
+		if err != nil {
+			return err
+		}
+		q.AfterID = last
+	}
+
+	for {
+		events := []*database.NotificationEvent{}
+		if q.Limit > 0 {
+			var err error
+			if events, err = database.GetEventFeed(q); err != nil {
+				return err
+			}
+		}
+		for _, e := range events {
+			fmt.Printf("%s  #%d  %s  %-11s  %s\n", e.CreatedAt.Local().Format(adminTime), e.ID, e.DeviceEUI, e.EventType, eventSummary(e))
+			q.AfterID = e.ID
+		}
+		if !tailFollow {
+			return nil
+		}
+
+		q.Latest, q.Limit = false, 100
+		if len(events) < q.Limit {
+			time.Sleep(eventsTailPoll)
+		}
+	}
+}
+
+// eventSummary is the one-line description of an event: its text, or its task's headline
+func eventSummary(e *database.NotificationEvent) string {
+	text := strings.Join(strings.Fields(e.Text), " ")
+	if text == "" {
+		text = e.TaskHeadline
+	}
+	if e.Suppressed {
+		text += " (suppressed)"
+	}
+	return text
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/backup"
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/storage"
+)
+
+// restoreForce is the -force flag of `server restore`
+var restoreForce bool
+
+// runBackup writes an archive of the database and blobs to the path in args ("-" for stdout,
+// none for a timestamped file in the working directory). The server may keep running.
+func runBackup(cfg *config.Config, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to initialize blob storage: %w", err)
+	}
+
+	path := time.Now().Format("watcher-backup-20060102-150405.tar.gz")
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	manifest, err := backup.Create(out, cfg.Database.Path, store)
+	if err != nil {
+		if path != "-" {
+			os.Remove(path)
+		}
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if manifest.BlobsSkipped != "" {
+		log.Printf("WARNING: Blobs not backed up: %s", manifest.BlobsSkipped)
+	}
+	log.Printf("Backed up %s and %d blobs to %s", cfg.Database.Path, manifest.Blobs, path)
+	return nil
+}
+
+// runRestore unpacks the archive in args ("-" for stdin) into the configured database and
+// blob store
+func runRestore(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to initialize blob storage: %w", err)
+	}
+
+	path := args[0]
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	manifest, err := backup.Restore(in, cfg.Database.Path, store, restoreForce)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	log.Printf("Restored %s and %d blobs from a backup of %s (server %s)",
+		cfg.Database.Path, manifest.Blobs, manifest.CreatedAt.Local().Format(time.RFC1123), manifest.ServerVersion)
+	return nil
+}
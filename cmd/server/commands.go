@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audit"
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// errUsage is returned by a command run with the wrong arguments
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand of the server binary, run on the database and blob store of the
+// server's usual flags, environment and config file
+type command struct {
+	usage string // The command's own flags, then its arguments
+	help  string
+	flags func() // Registers the command's own flags (nil if it has none)
+	db    int    // dbNone, dbRead or dbWrite
+	run   func(cfg *config.Config, args []string) error
+}
+
+// How a command uses the database
+const (
+	dbNone  = iota // Does not open it (or opens it itself)
+	dbRead         // Only reads; runs on read-only databases
+	dbWrite        // Changes it
+)
+
+// commands are the subcommands, by name. Admin commands are "<noun> <verb>".
+var commands = map[string]*command{
+	"backup": {
+		usage: "[archive|-]",
+		help:  "Write the database and blob storage to an archive (the server may keep running)",
+		run:   runBackup,
+	},
+	"restore": {
+		usage: "[-force] <archive|->",
+		help:  "Restore an archive written by backup (the server must not be running)",
+		flags: func() { flag.BoolVar(&restoreForce, "force", false, "Replace an existing database") },
+		run:   runRestore,
+	},
+	"discover": {
+		usage: "[-timeout 2s]",
+		help:  "List the servers advertised over mDNS on the LAN",
+		flags: func() { flag.DurationVar(&discoverTimeout, "timeout", 2*time.Second, "How long to wait for replies") },
+		run:   runDiscover,
+	},
+	"devices list": {
+		help: "List the registered devices and the devices with tasks or events",
+		db:   dbRead,
+		run:  runDevicesList,
+	},
+	"taskflows list": {
+		usage: "[eui]",
+		help:  "List the task flows of all devices or one device",
+		db:    dbRead,
+		run:   runTaskFlowsList,
+	},
+	"taskflows delete": {
+		usage: "<id>",
+		help:  "Delete a task flow",
+		db:    dbWrite,
+		run:   runTaskFlowsDelete,
+	},
+	"taskflows pause": {
+		usage: "<id>",
+		help:  "Stop serving a task flow to its device",
+		db:    dbWrite,
+		run:   runTaskFlowsPause,
+	},
+	"taskflows resume": {
+		usage: "<id>",
+		help:  "Serve a paused task flow again",
+		db:    dbWrite,
+		run:   runTaskFlowsResume,
+	},
+	"events tail": {
+		usage: "[-n 20] [-follow] [-device eui] [-type alarm]",
+		help:  "Print the latest events, and new ones as they are stored with -follow",
+		flags: eventsTailFlags,
+		db:    dbRead,
+		run:   runEventsTail,
+	},
+}
+
+// runSubcommand runs the subcommand named by the first arguments, if any, reporting whether it
+// did. Like the server, commands take all the server's flags, before their arguments, e.g.
+// `server taskflows delete -db /data/sensecap.db 12`.
+func runSubcommand() bool {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return false
+	}
+	if os.Args[1] == "help" {
+		printCommands()
+		return true
+	}
+
+	name, cmd := os.Args[1], commands[os.Args[1]]
+	if cmd == nil && len(os.Args) > 2 {
+		name = os.Args[1] + " " + os.Args[2]
+		cmd = commands[name]
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", strings.Join(os.Args[1:min(len(os.Args), 3)], " "))
+		printCommands()
+		os.Exit(2)
+	}
+	words := len(strings.Fields(name))
+	os.Args = append(os.Args[:1], os.Args[1+words:]...)
+
+	if cmd.flags != nil {
+		cmd.flags()
+	}
+	config.DisableSetup()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Flags after the arguments would be ignored
+	for _, arg := range flag.Args() {
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			commandUsage(name, cmd)
+		}
+	}
+
+	if cmd.db != dbNone {
+		if err := openDatabase(cfg, cmd.db == dbWrite); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	err = cmd.run(cfg, flag.Args())
+	if err == nil && cmd.db == dbWrite {
+		audit.Record(&database.AuditEntry{
+			Source: database.AuditSourceCLI,
+			Actor:  osUser(),
+			Action: name,
+			Target: strings.Join(flag.Args(), " "),
+		})
+	}
+	if cmd.db != dbNone {
+		database.Close()
+	}
+
+	if errors.Is(err, errUsage) {
+		commandUsage(name, cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// osUser names the user running a command, for the audit log
+func osUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// commandUsage prints how to run a command and exits
+func commandUsage(name string, cmd *command) {
+	fmt.Fprintf(os.Stderr, "Usage: server %s [server flags] %s\n", name, cmd.usage)
+	os.Exit(2)
+}
+
+// openDatabase opens the configured database for a command. Unlike the server, it never
+// creates one.
+func openDatabase(cfg *config.Config, write bool) error {
+	if _, err := os.Stat(cfg.Database.Path); err != nil {
+		return fmt.Errorf("no database at %s (use -db or DB_PATH)", cfg.Database.Path)
+	}
+	if cfg.Database.ReadOnly {
+		if write {
+			return fmt.Errorf("cannot change a read-only database")
+		}
+		return database.InitializeReadOnly(cfg.Database.Path)
+	}
+	return database.Initialize(cfg.Database.Path)
+}
+
+// printCommands lists the subcommands on stderr
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Commands (run without one to start the server; server flags go before arguments):")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(os.Stderr, "  server %s\n      %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+}
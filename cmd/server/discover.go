@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/mdns"
+)
+
+// discoverTimeout is the -timeout flag of `server discover`
+var discoverTimeout time.Duration
+
+// runDiscover prints the servers answering an mDNS query on the LAN
+func runDiscover(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	found, err := mdns.Browse(discoverTimeout)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Println("No servers found")
+		return nil
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "NAME\tURL\tHOST\tVERSION\tAUTH")
+	for _, f := range found {
+		auth := f.Text["auth"]
+		if hint := f.Text["token_hint"]; hint != "" {
+			auth += " (" + hint + "...)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Instance, f.URL(), strings.TrimSuffix(f.Host, "."), f.Text["version"], auth)
+	}
+	return tw.Flush()
+}
@@ -2,49 +2,204 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/exec"
+	"strings"
 
+	"github.com/brianhealey/sensecap-server/internal/audit"
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/capture"
 	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/connectapi"
 	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/detect"
+	"github.com/brianhealey/sensecap-server/internal/export"
+	"github.com/brianhealey/sensecap-server/internal/frigate"
 	"github.com/brianhealey/sensecap-server/internal/handlers"
+	"github.com/brianhealey/sensecap-server/internal/incidents"
+	"github.com/brianhealey/sensecap-server/internal/lan"
+	"github.com/brianhealey/sensecap-server/internal/logbuf"
+	"github.com/brianhealey/sensecap-server/internal/mdns"
 	"github.com/brianhealey/sensecap-server/internal/middleware"
+	"github.com/brianhealey/sensecap-server/internal/qr"
+	"github.com/brianhealey/sensecap-server/internal/rules"
+	"github.com/brianhealey/sensecap-server/internal/storage"
+	"github.com/brianhealey/sensecap-server/internal/tasks"
+	"github.com/brianhealey/sensecap-server/internal/tracing"
+	"github.com/brianhealey/sensecap-server/internal/version"
+	"github.com/brianhealey/sensecap-server/web"
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// server backup / server restore
+	if runSubcommand() {
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize database
-	if err := database.Initialize(cfg.Database.Path); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	// Keep recent log lines for the debug bundle
+	log.SetOutput(io.MultiWriter(os.Stderr, logbuf.Initialize(cfg.Debug.LogLines)))
+
+	// Initialize database (read-only mode serves a copy without writing to it)
+	if cfg.Database.ReadOnly {
+		if err := database.InitializeReadOnly(cfg.Database.Path); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+	} else {
+		if err := database.Initialize(cfg.Database.Path); err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		// Custom object classes extend the configured ones; load them before the backfill
+		// below picks models by target object
+		if err := handlers.LoadCustomClasses(); err != nil {
+			log.Fatalf("Failed to load custom classes: %v", err)
+		}
+		// Tasks of databases written by the old root package have no model type yet
+		if err := handlers.BackfillModelTypes(); err != nil {
+			log.Fatalf("Failed to migrate task model types: %v", err)
+		}
 	}
 	defer database.Close()
 
+	// Compressed voice uploads are decoded with ffmpeg
+	if cfg.AI.FFmpegPath != "" {
+		if _, err := exec.LookPath(cfg.AI.FFmpegPath); err != nil {
+			log.Printf("WARNING: ffmpeg not found (%s), MP3/OGG/M4A voice uploads are forwarded undecoded", cfg.AI.FFmpegPath)
+		}
+	}
+
+	// Management API accounts (creates the configured admin on first start)
+	if err := auth.Init(cfg.Auth); err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
+
+	// Initialize blob storage
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+	log.Printf("Blob storage initialized: driver=%s", cfg.Storage.Driver)
+
+	// Enable debug capture if requested
+	if cfg.Debug.Capture {
+		var captureStore storage.BlobStore
+		if cfg.Debug.CapturePersist {
+			captureStore = store
+		}
+		if err := capture.Initialize(cfg.Debug.CaptureSize, captureStore); err != nil {
+			log.Fatalf("Failed to initialize debug capture: %v", err)
+		}
+	}
+
 	// Set configuration for handlers
 	handlers.SetConfig(cfg)
+	handlers.SetBlobStore(store)
+
+	// Hot-reload AI backend settings and prompt templates from the config file (SIGHUP or file change)
+	if cfg.File != "" {
+		log.Printf("Loaded config file: %s (reload with SIGHUP or by editing the file)", cfg.File)
+	}
+	cfg.Watch(handlers.SetConfig)
+
+	// Load the object detection model that checks MONITORING frames when vision analysis is off (if configured)
+	if err := detect.Load(cfg.AI.ONNXModel, cfg.AI.ONNXRuntimeLib); err != nil {
+		log.Printf("WARNING: Object detection is unavailable: %v", err)
+	}
+
+	// Export voice pipeline traces to an OTLP collector (if configured)
+	if err := tracing.Start(cfg.Tracing); err != nil {
+		log.Fatalf("Failed to start tracing: %v", err)
+	}
+
+	// Background workers write to the database or act on new events, neither of which
+	// happens in read-only mode
+	if cfg.Database.ReadOnly {
+		log.Println("Read-only mode: device writes are rejected; task watchdog, metrics export, event rules, the Frigate integration, incident grouping and mDNS advertisement are off")
+	} else {
+		// Alert when devices do not pick up new tasks
+		tasks.StartWatchdog(cfg.Tasks.AckWindow)
+
+		// Push sensor readings and detection counts to InfluxDB or Prometheus (if configured)
+		if err := export.Start(cfg.Export); err != nil {
+			log.Fatalf("Failed to start metrics export: %v", err)
+		}
+
+		// Fire the webhook and SMS actions of event rules (saved event searches)
+		if err := rules.Start(cfg.Rules, cfg.API.BaseURL); err != nil {
+			log.Fatalf("Failed to start event rules: %v", err)
+		}
+
+		// Publish alarms as Frigate events over MQTT (if configured)
+		if err := frigate.Start(cfg.Frigate); err != nil {
+			log.Fatalf("Failed to start Frigate integration: %v", err)
+		}
+
+		// Group alarms from several devices into incidents and have the LLM write them up
+		if err := incidents.Start(cfg.Incidents, handlers.NarrateIncident); err != nil {
+			log.Fatalf("Failed to start incidents: %v", err)
+		}
+
+		// Advertise the server on the LAN so the BLE CLI can find its URL
+		if err := mdns.Start(cfg.MDNS, cfg.Server.Port, mdnsText(cfg)); err != nil {
+			log.Fatalf("Failed to start mDNS: %v", err)
+		}
+	}
 
 	// Create router
-	r := mux.NewRouter()
+	root := mux.NewRouter()
 
 	// Apply global middleware
-	r.Use(middleware.CORS)
-	r.Use(middleware.Logger)
-	r.Use(middleware.DeviceEUIValidator)
+	root.Use(middleware.CORS)
+	root.Use(middleware.Logger)
+	root.Use(middleware.BodyLimit(cfg.Limits.MaxBodyBytes))
+
+	// Mount all routes under the configured base path (for reverse proxy subpaths)
+	r := root
+	if cfg.Server.BasePath != "" {
+		log.Printf("Serving all routes under base path: %s", cfg.Server.BasePath)
+		r = root.PathPrefix(cfg.Server.BasePath).Subrouter()
+	}
 
 	// V1 API routes
 	v1 := r.PathPrefix("/v1").Subrouter()
+	v1.Use(capture.Middleware)
 
-	// Apply authentication middleware if token is configured
+	// Device authentication: the shared token or a device API key (open while neither exists)
 	if cfg.Auth.Enabled {
 		log.Printf("Authentication enabled with token: %s", cfg.Auth.Token)
-		v1.Use(middleware.AuthValidator(cfg.Auth.Token))
 	} else {
-		log.Println("WARNING: Authentication disabled (no token configured)")
+		log.Println("WARNING: No token configured, devices are only authenticated once device API keys exist")
+	}
+	v1.Use(auth.DeviceMiddleware)
+
+	// Device EUI check (strict mode only admits devices in the registry)
+	deviceEUIValidator := middleware.DeviceEUIValidator(cfg.Auth.StrictDevices, database.IsDeviceRegistered)
+	if cfg.Auth.StrictDevices {
+		if count, err := database.CountDevices(); err != nil {
+			log.Printf("WARNING: Failed to count registered devices: %v", err)
+		} else if count == 0 {
+			log.Println("WARNING: Strict device mode is on but no devices are registered; all device requests will be rejected")
+		} else {
+			log.Printf("Strict device mode: %d registered devices allowed", count)
+		}
+	}
+	v1.Use(deviceEUIValidator)
+
+	// Device rate limits, shared by the device routes and applied once the device is
+	// authenticated and its EUI checked (the management API and dashboard are not limited)
+	deviceRateLimit := middleware.RateLimit(cfg.Limits.DeviceRatePerMin, cfg.Limits.GlobalRatePerMin)
+	v1.Use(deviceRateLimit)
+	if cfg.Database.ReadOnly {
+		v1.Use(middleware.ReadOnly)
 	}
 
 	// Register V1 endpoints
@@ -53,25 +208,196 @@ func main() {
 
 	// V2 API routes
 	v2 := r.PathPrefix("/v2").Subrouter()
-
-	// Apply authentication middleware to v2 if token is configured
-	if cfg.Auth.Enabled {
-		v2.Use(middleware.AuthValidator(cfg.Auth.Token))
+	v2.Use(capture.Middleware)
+	v2.Use(auth.DeviceMiddleware)
+	v2.Use(deviceEUIValidator)
+	v2.Use(deviceRateLimit)
+	if cfg.Database.ReadOnly {
+		v2.Use(middleware.ReadOnly)
 	}
 
 	// Register V2 endpoints
 	v2.HandleFunc("/watcher/talk/audio_stream", handlers.AudioStreamHandler).Methods("POST")
 	v2.HandleFunc("/watcher/talk/view_task_detail", handlers.TaskDetailHandler).Methods("GET", "POST")
+	v2.HandleFunc("/watcher/task/status", handlers.TaskStatusHandler).Methods("POST")
+	v2.HandleFunc("/watcher/selftest", handlers.SelfTestHandler).Methods("GET", "POST")
+	v2.HandleFunc("/watcher/upload", handlers.UploadHandler).Methods("POST")
+
+	// Firmware OTA (version check and binary download): a server extension for custom firmware
+	// and gateways, never called by the stock firmware
+	v2.HandleFunc("/watcher/ota/check", handlers.OTACheckHandler).Methods("GET")
+	v2.HandleFunc("/watcher/ota/firmware/{component:esp32|himax}/{version:[0-9A-Za-z._-]+}", handlers.OTADownloadHandler).Methods("GET", "HEAD")
+
+	// Legacy/alternate endpoint paths used by some firmware builds
+	compat := r.NewRoute().Subrouter()
+	compat.Use(capture.Middleware)
+	compat.Use(auth.DeviceMiddleware)
+	compat.Use(deviceEUIValidator)
+	compat.Use(deviceRateLimit)
+	if cfg.Database.ReadOnly {
+		compat.Use(middleware.ReadOnly)
+	}
+	for _, alias := range handlers.RouteAliases() {
+		compat.HandleFunc(alias.Path, handlers.AliasHandler(alias)).Methods(alias.Methods...)
+	}
+
+	// Management API login, dashboard translations, and API docs (no session needed)
+	r.HandleFunc("/api/login", handlers.LoginHandler).Methods("POST")
+	r.HandleFunc("/api/logout", handlers.LogoutHandler).Methods("POST")
+	r.HandleFunc("/api/locale", handlers.LocaleHandler).Methods("GET")
+	r.HandleFunc("/api/openapi.json", handlers.OpenAPIHandler).Methods("GET")
+	r.HandleFunc("/api/docs", handlers.APIDocsHandler).Methods("GET")
+	r.PathPrefix("/api/docs/swagger-ui/").Handler(http.StripPrefix(cfg.Server.BasePath+"/api/docs/", http.FileServer(http.FS(web.SwaggerUI)))).Methods("GET", "HEAD")
+
+	// Management API routes (login session or AUTH_TOKEN; viewers get read-only access to their devices)
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(middleware.Gzip)
+	api.Use(auth.Middleware)
+	api.Use(audit.Middleware)
+
+	// Accounts
+	api.HandleFunc("/me", handlers.MeHandler).Methods("GET", "PUT").Name(auth.SelfServiceRoute)
+	api.HandleFunc("/users", auth.AdminOnly(handlers.UsersHandler)).Methods("GET", "POST")
+	api.HandleFunc("/users/{id:[0-9]+}", auth.AdminOnly(handlers.UserHandler)).Methods("PUT", "DELETE")
+	api.HandleFunc("/apikeys", auth.AdminOnly(handlers.APIKeysHandler)).Methods("GET", "POST")
+	api.HandleFunc("/apikeys/{id:[0-9]+}", auth.AdminOnly(handlers.APIKeyHandler)).Methods("DELETE")
+	api.HandleFunc("/apikeys/{id:[0-9]+}/rotate", auth.AdminOnly(handlers.APIKeyRotateHandler)).Methods("POST")
+
+	// Debug capture browsing
+	api.HandleFunc("/debug/captures", auth.AdminOnly(handlers.DebugCapturesHandler)).Methods("GET", "DELETE")
+	api.HandleFunc("/debug/captures/{id:[0-9]+}", auth.AdminOnly(handlers.DebugCaptureDetailHandler)).Methods("GET")
+	api.HandleFunc("/debug/captures/{id:[0-9]+}/{part:request|response}", auth.AdminOnly(handlers.DebugCaptureDetailHandler)).Methods("GET")
+
+	// Stored event images (with caching headers and optional ?w= resizing)
+	api.HandleFunc("/events/{id:[0-9]+}/image", handlers.EventImageHandler).Methods("GET", "HEAD")
+	api.HandleFunc("/events/{id:[0-9]+}/image/{frame:before|after}", handlers.EventImageHandler).Methods("GET", "HEAD")
+	api.HandleFunc("/events/{id:[0-9]+}/image/{variant:annotated}", handlers.EventImageHandler).Methods("GET", "HEAD")
+
+	// Device sensor time series (downsampled for charting)
+	api.HandleFunc("/devices", handlers.DevicesHandler).Methods("GET")
+	api.HandleFunc("/devices", auth.AdminOnly(handlers.DevicesHandler)).Methods("POST")
+	api.HandleFunc("/devices/{eui}", auth.AdminOnly(handlers.DeviceHandler)).Methods("DELETE")
+	api.HandleFunc("/devices/{eui}/sensors", handlers.DeviceSensorsHandler).Methods("GET")
+
+	// Live preview: the device's latest uploaded camera frame
+	api.HandleFunc("/devices/{eui}/snapshot", handlers.DeviceSnapshotHandler).Methods("GET")
+
+	// Alarm images as an MJPEG camera stream for NVR software (Frigate, Blue Iris)
+	api.HandleFunc("/devices/{eui}/mjpeg", handlers.DeviceAlarmStreamHandler).Methods("GET")
+
+	// Per-device vision settings (default prompt, RECOGNIZE answer length and storage)
+	api.HandleFunc("/devices/{eui}/vision", handlers.DeviceVisionSettingsHandler).Methods("GET", "PUT", "DELETE")
+
+	// Sensor thresholds: readings crossing them are stored as "threshold" events for the event rules
+	api.HandleFunc("/devices/{eui}/thresholds", handlers.DeviceThresholdsHandler).Methods("GET", "POST")
+	api.HandleFunc("/devices/{eui}/thresholds/{id:[0-9]+}", handlers.DeviceThresholdHandler).Methods("PUT", "DELETE")
 
-	// Health check endpoint (no auth required)
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","service":"sensecap-local-server"}`)
-	}).Methods("GET")
+	// Spoken announcements, played by the device with its next vision reply
+	api.HandleFunc("/devices/{eui}/speak", handlers.SpeakHandler).Methods("GET", "POST")
 
-	// Catch-all 404 handler - must be last
-	r.PathPrefix("/").HandlerFunc(handlers.NotFoundHandler)
+	// Voice task drafts waiting for confirmation: preview, verify on a frame, confirm or decline
+	api.HandleFunc("/devices/{eui}/pending-task", handlers.PendingTaskHandler).Methods("GET", "DELETE")
+	api.HandleFunc("/devices/{eui}/pending-task/confirm", handlers.PendingTaskConfirmHandler).Methods("POST")
+	api.HandleFunc("/devices/{eui}/pending-task/verify", handlers.PendingTaskVerifyHandler).Methods("POST")
+
+	// Task management
+	api.HandleFunc("/tasks/{id:[0-9]+}/resume", handlers.TaskResumeHandler).Methods("POST")
+	api.HandleFunc("/tasks/{id:[0-9]+}/context-frames", handlers.TaskContextFramesHandler).Methods("POST", "DELETE")
+	api.HandleFunc("/tasks/{id:[0-9]+}/events", handlers.TaskEventsHandler).Methods("GET")
+	api.HandleFunc("/tasks/{id:[0-9]+}/stats", handlers.TaskStatsHandler).Methods("GET")
+	api.HandleFunc("/tasks/{id:[0-9]+}/cooldown", handlers.TaskCooldownHandler).Methods("PUT")
+	api.HandleFunc("/tasks/{id:[0-9]+}/dedup", handlers.TaskDedupHandler).Methods("PUT")
+	api.HandleFunc("/tasks/{id:[0-9]+}/alarm", handlers.TaskAlarmHandler).Methods("PUT", "DELETE")
+	api.HandleFunc("/tasks/{id:[0-9]+}/vision", handlers.TaskVisionHandler).Methods("PUT", "DELETE")
+	api.HandleFunc("/tasks/{id:[0-9]+}/sensitivity", handlers.TaskSensitivityHandler).Methods("PUT", "DELETE")
+
+	// Task flow linting (the checks run before a flow is sent to a device)
+	api.HandleFunc("/taskflows/validate", handlers.TaskFlowValidateHandler).Methods("POST")
+
+	// Object classes voice tasks can target, and custom classes with their models
+	api.HandleFunc("/classes", handlers.ClassesHandler).Methods("GET")
+	api.HandleFunc("/classes/{name}", handlers.ClassHandler).Methods("PUT", "DELETE")
+
+	// Firmware management (binaries and per-device/fleet manifests)
+	api.HandleFunc("/firmware", auth.AdminOnly(handlers.FirmwareListHandler)).Methods("GET")
+	api.HandleFunc("/firmware/manifest", auth.AdminOnly(handlers.FirmwareManifestHandler)).Methods("GET", "PUT", "DELETE")
+	api.HandleFunc("/firmware/{component:esp32|himax}/{version:[0-9A-Za-z._-]+}", handlers.FirmwareUploadHandler).Methods("POST")
+	api.HandleFunc("/firmware/{component:esp32|himax}/{version:[0-9A-Za-z._-]+}", handlers.FirmwareDeleteHandler).Methods("DELETE")
+
+	// Canary release channel (per-channel AI metrics and false-positive review)
+	api.HandleFunc("/canary", auth.AdminOnly(handlers.CanaryHandler)).Methods("GET")
+	api.HandleFunc("/inferences", handlers.InferencesHandler).Methods("GET")
+	api.HandleFunc("/inferences/{id:[0-9]+}/false-positive", handlers.InferenceFalsePositiveHandler).Methods("POST", "DELETE")
+
+	// Incidents: alarms from several devices close together, with the LLM's write-up
+	api.HandleFunc("/incidents", handlers.IncidentsHandler).Methods("GET")
+	api.HandleFunc("/incidents/{id:[0-9]+}", handlers.IncidentHandler).Methods("GET")
+	api.HandleFunc("/incidents/{id:[0-9]+}/summarize", handlers.IncidentSummarizeHandler).Methods("POST")
+
+	// Node-RED: flat event feed, SSE stream and images (token also accepted as ?token=), sample flow
+	api.HandleFunc("/nodered/v1/events", handlers.NodeREDEventsHandler).Methods("GET").Name(auth.QueryTokenRoute)
+	api.HandleFunc("/nodered/v1/events/stream", handlers.NodeREDStreamHandler).Methods("GET").Name(auth.QueryTokenRoute)
+	api.HandleFunc("/nodered/v1/events/{id:[0-9]+}/image", handlers.EventImageHandler).Methods("GET", "HEAD").Name(auth.QueryTokenRoute)
+	api.HandleFunc("/nodered/v1/events/{id:[0-9]+}/image/{variant:annotated}", handlers.EventImageHandler).Methods("GET", "HEAD").Name(auth.QueryTokenRoute)
+	api.HandleFunc("/nodered/v1/flow", handlers.NodeREDFlowHandler).Methods("GET")
+
+	// Events and sensor readings as CSV or NDJSON downloads for offline analysis
+	api.HandleFunc("/export/events", handlers.ExportEventsHandler).Methods("GET")
+	api.HandleFunc("/export/sensors", handlers.ExportSensorsHandler).Methods("GET")
+
+	// Voice interaction history (transcripts, responses, and stored audio)
+	api.HandleFunc("/interactions", handlers.InteractionsHandler).Methods("GET")
+	api.HandleFunc("/interactions/{id:[0-9]+}", handlers.InteractionHandler).Methods("GET")
+	api.HandleFunc("/interactions/{id:[0-9]+}/audio/{part:input|reply}", handlers.InteractionAudioHandler).Methods("GET", "HEAD")
+
+	// Full-text search over event text and voice interactions
+	api.HandleFunc("/search", handlers.SearchHandler).Methods("GET")
+
+	// Files uploaded by devices (images, audio clips, logs)
+	api.HandleFunc("/uploads", handlers.UploadsHandler).Methods("GET")
+	api.HandleFunc("/uploads/{id:[0-9]+}", handlers.UploadFileHandler).Methods("GET", "HEAD")
+
+	// Event rules: saved event searches that fire a webhook or SMS (admin only)
+	api.HandleFunc("/rules", auth.AdminOnly(handlers.RulesHandler)).Methods("GET", "POST")
+	api.HandleFunc("/rules/{id:[0-9]+}", auth.AdminOnly(handlers.RuleHandler)).Methods("PUT", "DELETE")
+	api.HandleFunc("/rules/{id:[0-9]+}/events", auth.AdminOnly(handlers.RuleEventsHandler)).Methods("GET")
+
+	// Device-facing payload schemas (JSON Schema and samples generated from internal/models)
+	api.HandleFunc("/schemas", handlers.SchemasHandler).Methods("GET")
+	api.HandleFunc("/schemas/{name}", handlers.SchemaHandler).Methods("GET")
+	api.HandleFunc("/schemas/{name}/{part:sample}", handlers.SchemaHandler).Methods("GET")
+
+	// Admin endpoints
+	api.HandleFunc("/admin/unknown-endpoints", auth.AdminOnly(handlers.UnknownEndpointsHandler)).Methods("GET", "DELETE")
+	api.HandleFunc("/admin/info", auth.AdminOnly(handlers.AdminInfoHandler)).Methods("GET")
+	api.HandleFunc("/admin/debug-bundle", auth.AdminOnly(handlers.DebugBundleHandler)).Methods("POST")
+	api.HandleFunc("/audit", auth.AdminOnly(handlers.AuditLogHandler)).Methods("GET")
+
+	// Management API as unary Connect calls with the JSON codec, not gRPC (proto/watcher/v1/management.proto)
+	r.PathPrefix(connectapi.Path).Handler(connectapi.Handler())
+
+	// Dashboard static files (the pages call the management API with the token entered in the browser).
+	// Served from the binary unless a web directory is configured, e.g. while editing the pages.
+	if cfg.Server.Dashboard {
+		var files http.FileSystem = http.FS(web.Files)
+		if cfg.Server.WebDir != "" {
+			if _, err := os.Stat(cfg.Server.WebDir); err != nil {
+				log.Printf("WARNING: Web directory not found, serving the built-in dashboard: %s", cfg.Server.WebDir)
+			} else {
+				files = http.Dir(cfg.Server.WebDir)
+			}
+		}
+		dashboard := http.StripPrefix(cfg.Server.BasePath+"/dashboard/", http.FileServer(files))
+		r.PathPrefix("/dashboard/").Handler(dashboard).Methods("GET", "HEAD")
+		r.Handle("/dashboard", http.RedirectHandler(cfg.Server.BasePath+"/dashboard/", http.StatusMovedPermanently))
+	}
+
+	// Health and readiness endpoints (no auth required)
+	r.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
+	r.HandleFunc("/ready", handlers.ReadyHandler).Methods("GET")
+
+	// Catch-all 404 handler - must be last (registered on root so paths outside the base path are logged too)
+	root.PathPrefix("/").HandlerFunc(handlers.NotFoundHandler)
 
 	// Print startup information
 	printBanner(cfg)
@@ -79,21 +405,58 @@ func main() {
 	// Start server
 	addr := ":" + cfg.Server.Port
 	log.Printf("Server starting on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
+	handler := middleware.Proxy(cfg.Server.TrustedProxies, cfg.Server.BasePath)(root)
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
 
+// mdnsText is the TXT record of the mDNS advertisement. The token hint (its first characters)
+// lets users tell servers apart without advertising the token; short tokens get none.
+func mdnsText(cfg *config.Config) []string {
+	path := cfg.Server.BasePath
+	if path == "" {
+		path = "/"
+	}
+	text := []string{"txtvers=1", "version=" + version.Version, "path=" + path}
+	if cfg.Auth.Token == "" {
+		return append(text, "auth=none")
+	}
+	text = append(text, "auth=token")
+	if len(cfg.Auth.Token) >= 16 {
+		text = append(text, "token_hint="+cfg.Auth.Token[:4])
+	}
+	return text
+}
+
 func printBanner(cfg *config.Config) {
 	port := cfg.Server.Port
 	token := cfg.Auth.Token
+	base := cfg.Server.BasePath
+	origin := strings.TrimRight(cfg.API.BaseURL, "/") // Endpoints are listed at the public URL, e.g. behind a reverse proxy
 	fmt.Println()
 	fmt.Println("================================================================================")
 	fmt.Println("  SenseCAP Watcher Local Server")
 	fmt.Println("================================================================================")
 	fmt.Println()
 	fmt.Println("Server Configuration:")
+	fmt.Printf("  Version:        %s\n", version.String())
+	if cfg.Server.Profile != "" {
+		fmt.Printf("  Profile:        %s\n", cfg.Server.Profile)
+	}
 	fmt.Printf("  Port:           %s\n", port)
+	if base != "" {
+		fmt.Printf("  Base Path:      %s\n", base)
+	}
+	if len(cfg.Server.TrustedProxies) > 0 {
+		fmt.Printf("  Proxies:        %s\n", strings.Join(cfg.Server.TrustedProxies, ", "))
+	}
+	if cfg.Database.ReadOnly {
+		fmt.Printf("  Database:       %s (READ-ONLY)\n", cfg.Database.Path)
+	}
+	if cfg.MDNS.Enabled && !cfg.Database.ReadOnly {
+		fmt.Printf("  mDNS:           %s.local\n", mdns.ServiceType)
+	}
 	if token != "" {
 		fmt.Printf("  Auth Token:     %s\n", token)
 		fmt.Println("  Authentication: ENABLED")
@@ -102,30 +465,147 @@ func printBanner(cfg *config.Config) {
 		fmt.Println("  Authentication: DISABLED")
 	}
 	fmt.Println()
+	fmt.Println("Limits:")
+	printLimit("Max Body Size:", cfg.Limits.MaxBodyBytes>>20, "MB")
+	printLimit("Max Upload:", cfg.Limits.MaxUploadBytes>>20, "MB")
+	printLimit("Device Rate:", int64(cfg.Limits.DeviceRatePerMin), "req/min")
+	printLimit("Global Rate:", int64(cfg.Limits.GlobalRatePerMin), "req/min")
+	fmt.Println()
 	fmt.Println("Endpoints:")
 	fmt.Println("  V1 API:")
-	fmt.Printf("    POST http://localhost:%s/v1/notification/event\n", port)
-	fmt.Printf("    POST http://localhost:%s/v1/watcher/vision\n", port)
+	fmt.Printf("    POST %s/v1/notification/event\n", origin)
+	fmt.Printf("    POST %s/v1/watcher/vision\n", origin)
 	fmt.Println("  V2 API:")
-	fmt.Printf("    POST http://localhost:%s/v2/watcher/talk/audio_stream\n", port)
-	fmt.Printf("    POST http://localhost:%s/v2/watcher/talk/view_task_detail\n", port)
+	fmt.Printf("    POST %s/v2/watcher/talk/audio_stream\n", origin)
+	fmt.Printf("    POST %s/v2/watcher/talk/view_task_detail\n", origin)
+	fmt.Printf("    POST %s/v2/watcher/task/status\n", origin)
+	fmt.Printf("    POST %s/v2/watcher/selftest\n", origin)
+	fmt.Printf("    POST %s/v2/watcher/upload?kind=image&request_id=<id>\n", origin)
+	fmt.Printf("    GET  %s/v2/watcher/ota/check?esp32=<ver>&himax=<ver> (extension, not called by stock firmware)\n", origin)
+	fmt.Println("  Management API:")
+	fmt.Printf("    POST %s/api/login\n", origin)
+	fmt.Printf("    GET  %s/api/locale?lang=zh\n", origin)
+	fmt.Printf("    GET  %s/api/openapi.json (Swagger UI at /api/docs)\n", origin)
+	fmt.Printf("    GET  %s/api/users\n", origin)
+	fmt.Printf("    GET  %s/api/apikeys\n", origin)
+	fmt.Printf("    GET  %s/api/events/{id}/image?w=320\n", origin)
+	fmt.Printf("    GET  %s/api/events/{id}/image/{before|after}\n", origin)
+	fmt.Printf("    GET  %s/api/events/{id}/image/annotated\n", origin)
+	fmt.Printf("    GET  %s/api/devices\n", origin)
+	fmt.Printf("    GET  %s/api/devices/{eui}/sensors?metric=temperature\n", origin)
+	fmt.Printf("    GET  %s/api/devices/{eui}/snapshot?wait=10s\n", origin)
+	fmt.Printf("    GET  %s/api/devices/{eui}/mjpeg\n", origin)
+	fmt.Printf("    GET  %s/api/devices/{eui}/vision\n", origin)
+	fmt.Printf("    POST %s/api/devices/{eui}/thresholds\n", origin)
+	fmt.Printf("    POST %s/api/devices/{eui}/speak\n", origin)
+	fmt.Printf("    GET  %s/api/devices/{eui}/pending-task (DELETE to decline)\n", origin)
+	fmt.Printf("    POST %s/api/devices/{eui}/pending-task/verify?wait=10s\n", origin)
+	fmt.Printf("    POST %s/api/devices/{eui}/pending-task/confirm\n", origin)
+	fmt.Printf("    POST %s/api/tasks/{id}/resume\n", origin)
+	fmt.Printf("    POST %s/api/tasks/{id}/context-frames (DELETE to disable)\n", origin)
+	fmt.Printf("    GET  %s/api/tasks/{id}/events?since=24h\n", origin)
+	fmt.Printf("    GET  %s/api/tasks/{id}/stats?days=7\n", origin)
+	fmt.Printf("    PUT  %s/api/tasks/{id}/cooldown\n", origin)
+	fmt.Printf("    PUT  %s/api/tasks/{id}/dedup\n", origin)
+	fmt.Printf("    PUT  %s/api/tasks/{id}/alarm (DELETE to reset)\n", origin)
+	fmt.Printf("    PUT  %s/api/tasks/{id}/vision (DELETE to reset)\n", origin)
+	fmt.Printf("    PUT  %s/api/tasks/{id}/sensitivity (DELETE to reset)\n", origin)
+	fmt.Printf("    POST %s/api/taskflows/validate\n", origin)
+	fmt.Printf("    GET  %s/api/classes\n", origin)
+	fmt.Printf("    PUT  %s/api/classes/{name} (DELETE to remove)\n", origin)
+	fmt.Printf("    GET  %s/api/firmware\n", origin)
+	fmt.Printf("    GET  %s/api/canary?since=24h\n", origin)
+	fmt.Printf("    GET  %s/api/inferences\n", origin)
+	fmt.Printf("    GET  %s/api/incidents?since=24h\n", origin)
+	fmt.Printf("    GET  %s/api/incidents/{id}\n", origin)
+	fmt.Printf("    POST %s/api/incidents/{id}/summarize\n", origin)
+	fmt.Printf("    GET  %s/api/nodered/v1/events?after=<id>\n", origin)
+	fmt.Printf("    GET  %s/api/nodered/v1/events/stream (SSE)\n", origin)
+	fmt.Printf("    GET  %s/api/nodered/v1/flow\n", origin)
+	fmt.Printf("    GET  %s/api/export/events?from=...&to=...&format=csv\n", origin)
+	fmt.Printf("    GET  %s/api/export/sensors?from=...&to=...&format=ndjson\n", origin)
+	fmt.Printf("    GET  %s/api/interactions?session_id=<id>\n", origin)
+	fmt.Printf("    GET  %s/api/interactions/{id}\n", origin)
+	fmt.Printf("    GET  %s/api/search?q=delivery+person\n", origin)
+	fmt.Printf("    GET  %s/api/uploads?device_eui=<eui>\n", origin)
+	fmt.Printf("    GET  %s/api/rules\n", origin)
+	fmt.Printf("    GET  %s/api/rules/{id}/events?since=24h\n", origin)
+	fmt.Printf("    GET  %s/api/schemas\n", origin)
+	fmt.Printf("    GET  %s/api/admin/unknown-endpoints\n", origin)
+	fmt.Printf("    GET  %s/api/admin/info\n", origin)
+	fmt.Printf("    POST %s/api/admin/debug-bundle\n", origin)
+	fmt.Printf("    GET  %s/api/audit?since=24h&source=api\n", origin)
+	fmt.Println("  Management API (Connect unary calls, JSON codec; not gRPC):")
+	fmt.Printf("    POST %s%s<Method>\n", origin, connectapi.Path)
+	if cfg.Server.Dashboard {
+		fmt.Println("  Dashboard:")
+		fmt.Printf("    GET  %s/dashboard/\n", origin)
+	}
+	if cfg.Debug.Capture {
+		fmt.Println("  Debug:")
+		fmt.Printf("    GET  %s/api/debug/captures\n", origin)
+	}
 	fmt.Println("  Health:")
-	fmt.Printf("    GET  http://localhost:%s/health\n", port)
+	fmt.Printf("    GET  %s/health\n", origin)
+	fmt.Printf("    GET  %s/ready\n", origin)
 	fmt.Println()
 	fmt.Println("Configuration Headers Required:")
 	fmt.Println("  Authorization:            <token>              (if auth enabled)")
+	fmt.Println("  Management API:          Bearer <session token or API key>, or <token>")
 	fmt.Println("  API-OBITER-DEVICE-EUI:    <16-char hex EUI>")
 	fmt.Println()
-	fmt.Println("To configure your SenseCAP Watcher device:")
+	printDeviceSetup(cfg)
+	fmt.Println("================================================================================")
 	fmt.Println()
-	fmt.Println("  AT+localservice={\"data\":{\"notification_proxy\":{")
-	fmt.Printf("    \"switch\":1,\"url\":\"http://<your-ip>:%s\",\"token\":\"%s\"}}}\n", port, token)
+	log.Println("Server ready to receive requests...")
 	fmt.Println()
-	fmt.Println("  AT+localservice={\"data\":{\"image_analyzer\":{")
-	fmt.Printf("    \"switch\":1,\"url\":\"http://<your-ip>:%s\",\"token\":\"%s\"}}}\n", port, token)
+}
+
+// printDeviceSetup prints the AT commands that point a Watcher at this server, for the first
+// URL devices can reach it at, and a QR code of the server URL and token
+func printDeviceSetup(cfg *config.Config) {
+	addresses := lan.Addresses()
+	urls := lan.ServerURLs(cfg.API.BaseURL, cfg.API.Schema, cfg.Server.Port, cfg.Server.BasePath, addresses)
+	if len(urls) == 0 {
+		fmt.Println("To configure your SenseCAP Watcher device (no LAN address found, replace <your-ip>):")
+		urls = []string{fmt.Sprintf("%s://<your-ip>:%s%s", cfg.API.Schema, cfg.Server.Port, cfg.Server.BasePath)}
+	} else {
+		fmt.Println("To configure your SenseCAP Watcher device (send over BLE, e.g. with the cli):")
+	}
 	fmt.Println()
-	fmt.Println("================================================================================")
+
+	setup := lan.NewSetup(urls[0], cfg.Auth.Token)
+	for _, cmd := range setup.ATCommands {
+		fmt.Printf("  %s\n", cmd)
+	}
 	fmt.Println()
-	log.Println("Server ready to receive requests...")
+	if len(urls) > 1 {
+		fmt.Println("  Other server URLs:")
+		for _, url := range urls[1:] {
+			fmt.Printf("    %s\n", url)
+		}
+		fmt.Println()
+	}
+
+	if len(addresses) > 0 {
+		if code, err := qr.Encode(setup.QRText); err != nil {
+			log.Printf("WARNING: Failed to encode setup QR code: %v", err)
+		} else {
+			fmt.Printf("  Server URL and token (%s):\n", setup.QRText)
+			for _, line := range strings.Split(strings.TrimRight(code.Terminal(), "\n"), "\n") {
+				fmt.Printf("  %s\n", line)
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Println("  All addresses, commands and QR codes: GET /api/admin/info")
 	fmt.Println()
 }
+
+func printLimit(label string, value int64, unit string) {
+	if value > 0 {
+		fmt.Printf("  %-16s%d %s\n", label, value, unit)
+	} else {
+		fmt.Printf("  %-16sunlimited\n", label)
+	}
+}
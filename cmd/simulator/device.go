@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audio"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+)
+
+// device is a simulated Watcher: it calls the server with the headers the firmware sends
+type device struct {
+	url    string
+	token  string
+	eui    string
+	client *http.Client
+}
+
+// activeTask is the task flow served by view_task_detail (TLID 0 = none)
+type activeTask struct {
+	TLID int64  `json:"tlid"`
+	CTD  int64  `json:"ctd"`
+	Name string `json:"tn"`
+}
+
+// do sends a request as the device and returns the response body, failing on non-2xx statuses
+func (d *device) do(method, path, contentType string, body []byte, header map[string]string) ([]byte, error) {
+	data, _, err := d.request(method, path, contentType, body, header)
+	return data, err
+}
+
+// request is do that also returns the response headers
+func (d *device) request(method, path, contentType string, body []byte, header map[string]string) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(d.url, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("API-OBITER-DEVICE-EUI", d.eui)
+	if d.token != "" {
+		req.Header.Set("Authorization", d.token) // The firmware sends the bare token
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, resp.Header, nil
+}
+
+// postEvent sends a notification event with an image, a person detection and sensor readings
+func (d *device) postEvent(text string, img []byte) error {
+	ts := time.Now().UnixMilli()
+	encoded := base64.StdEncoding.EncodeToString(img)
+	temperature, humidity, co2 := 22.5, 45, 600
+
+	req := models.NotificationEventRequest{
+		RequestID: fmt.Sprintf("sim-%d", ts),
+		DeviceEUI: d.eui,
+		Events: models.Events{
+			Timestamp: &ts,
+			Text:      &text,
+			Img:       &encoded,
+			Data: &models.EventData{
+				Inference: &models.InferenceData{
+					Boxes:       []models.BoundingBox{{200, 140, 120, 200, 87, 0}},
+					ClassesName: []string{"person"},
+				},
+				Sensor: &models.SensorData{Temperature: &temperature, Humidity: &humidity, CO2: &co2},
+			},
+		},
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.do(http.MethodPost, "/v1/notification/event", "application/json", body, nil)
+	return err
+}
+
+// talk streams recorded audio as one voice session and returns the reply's JSON part and WAV
+func (d *device) talk(sessionID string, pcm []byte) (*models.TalkResponse, []byte, error) {
+	data, err := d.do(http.MethodPost, "/v2/watcher/talk/audio_stream", "application/octet-stream", pcm,
+		map[string]string{"Session-Id": sessionID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	framed, err := talk.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp models.TalkResponse
+	if err := json.Unmarshal(framed.Meta, &resp); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse talk response: %w", err)
+	}
+	return &resp, framed.Audio, nil
+}
+
+// viewTaskDetail polls for the device's task flow
+func (d *device) viewTaskDetail() (*activeTask, error) {
+	task, _, err := d.waitTaskDetail(0, 0)
+	return task, err
+}
+
+// waitTaskDetail long-polls for the device's task flow: the server answers once the task is no
+// longer known (a TLID, 0 = none) or after wait. longPoll is false if the server answered
+// right away because it does not support long polls; the caller then falls back to polling.
+func (d *device) waitTaskDetail(known int64, wait time.Duration) (task *activeTask, longPoll bool, err error) {
+	path := "/v2/watcher/talk/view_task_detail"
+	if wait > 0 {
+		path += fmt.Sprintf("?wait=%s&tlid=%d", wait, known)
+	}
+	data, header, err := d.request(http.MethodPost, path, "application/json", []byte("{}"), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var resp struct {
+		Data struct {
+			TL activeTask `json:"tl"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, false, fmt.Errorf("failed to parse task detail: %w", err)
+	}
+	return &resp.Data.TL, header.Get("X-Task-Long-Poll") != "", nil
+}
+
+// reportTaskStatus reports the task flow engine as running the given task
+func (d *device) reportTaskStatus(task *activeTask) error {
+	body, err := json.Marshal(models.TaskFlowStatusRequest{Status: 2, TLID: task.TLID, CTD: task.CTD, Module: "ai camera"})
+	if err != nil {
+		return err
+	}
+	_, err = d.do(http.MethodPost, "/v2/watcher/task/status", "application/json", body, nil)
+	return err
+}
+
+// syntheticFrame draws a 640x480 camera frame with a figure that moves across the scene
+// from frame to frame, so change detection and vision analysis see a new image each time
+func syntheticFrame(n int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			img.Set(x, y, color.RGBA{uint8(60 + y/8), uint8(90 + y/6), uint8(140 + x/10), 255})
+		}
+	}
+
+	left := 40 + (n*90)%480
+	for y := 140; y < 340; y++ {
+		for x := left; x < left+120; x++ {
+			img.Set(x, y, color.RGBA{200, 80, 60, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// syntheticSpeech returns two seconds of raw 16 kHz 16-bit mono PCM, as the Watcher streams it
+func syntheticSpeech() []byte {
+	return audio.Tone(440, 2*time.Second)[44:] // Drop the WAV header
+}
@@ -0,0 +1,290 @@
+// Command simulator emulates a SenseCAP Watcher against a running server, so the event,
+// voice, and task pipelines (and the integrations behind them) can be tested end to end
+// without hardware.
+//
+//	simulator [run|event|talk|tasks] [-url http://localhost:8000] [-token TOKEN] [-eui EUI] ...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audio"
+)
+
+func main() {
+	log.SetFlags(log.Ltime)
+
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "run":
+		err = runCommand(args)
+	case "event":
+		err = eventCommand(args)
+	case "talk":
+		err = talkCommand(args)
+	case "tasks":
+		err = tasksCommand(args)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: simulator [run|event|talk|tasks] [flags]")
+		fmt.Fprintln(os.Stderr, "  run    poll for tasks, post events while a task is active, and talk once (default)")
+		fmt.Fprintln(os.Stderr, "  event  post notification events")
+		fmt.Fprintln(os.Stderr, "  talk   stream audio to the voice endpoint and save the reply")
+		fmt.Fprintln(os.Stderr, "  tasks  poll view_task_detail and report task status")
+		fmt.Fprintln(os.Stderr, "Run 'simulator <command> -h' for its flags.")
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+// deviceFlags registers the flags every command shares and returns the device they describe
+func deviceFlags(fs *flag.FlagSet) *device {
+	d := &device{client: &http.Client{Timeout: 5 * time.Minute}} // Voice replies wait on the LLM and TTS
+	fs.StringVar(&d.url, "url", envOr("SIM_URL", "http://localhost:8000"), "Server URL, including any base path (env SIM_URL)")
+	fs.StringVar(&d.token, "token", os.Getenv("SIM_TOKEN"), "AUTH_TOKEN or device API key (env SIM_TOKEN)")
+	fs.StringVar(&d.eui, "eui", envOr("SIM_EUI", "2CF7F1C0443000FF"), "Device EUI to report (env SIM_EUI)")
+	return d
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// runCommand behaves like an idle Watcher: it asks for its task, reports the engine
+// running it, posts an event every interval while a task is active, and holds one voice
+// conversation at start if -audio or -talk is given
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	d := deviceFlags(fs)
+	poll := fs.Duration("poll", 30*time.Second, "How often to poll view_task_detail")
+	interval := fs.Duration("interval", time.Minute, "How often to post an event while a task is active")
+	imagePath := fs.String("image", "", "JPEG to send with events (default: synthetic frames)")
+	audioPath := fs.String("audio", "", "Recording to talk with at start (raw 16 kHz PCM or WAV)")
+	talk := fs.Bool("talk", false, "Talk at start with a synthetic recording if -audio is not given")
+	duration := fs.Duration("duration", 0, "Stop after this long (0 = until interrupted)")
+	fs.Parse(args)
+
+	if *audioPath != "" || *talk {
+		pcm, err := loadAudio(*audioPath)
+		if err != nil {
+			return err
+		}
+		if err := converse(d, fmt.Sprintf("sim-%d", time.Now().Unix()), pcm, ""); err != nil {
+			log.Printf("Talk failed: %v", err)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	var deadline <-chan time.Time
+	if *duration > 0 {
+		deadline = time.After(*duration)
+	}
+
+	pollTicker := time.NewTicker(*poll)
+	defer pollTicker.Stop()
+	eventTicker := time.NewTicker(*interval)
+	defer eventTicker.Stop()
+
+	var task *activeTask
+	frame := 0
+	checkTask := func() {
+		t, err := d.viewTaskDetail()
+		if err != nil {
+			log.Printf("Task poll failed: %v", err)
+			return
+		}
+		if t.TLID == 0 {
+			if task != nil {
+				log.Printf("Task %d removed; idle", task.TLID)
+			}
+			task = nil
+			return
+		}
+		if task == nil || task.TLID != t.TLID {
+			log.Printf("Running task %d: %s", t.TLID, t.Name)
+		}
+		task = t
+		if err := d.reportTaskStatus(task); err != nil {
+			log.Printf("Status report failed: %v", err)
+		}
+	}
+
+	log.Printf("Simulating device %s against %s", d.eui, d.url)
+	checkTask()
+	for {
+		select {
+		case <-pollTicker.C:
+			checkTask()
+		case <-eventTicker.C:
+			if task == nil {
+				continue
+			}
+			frame++
+			img, err := loadImage(*imagePath, frame)
+			if err != nil {
+				return err
+			}
+			if err := d.postEvent(task.Name, img); err != nil {
+				log.Printf("Event failed: %v", err)
+				continue
+			}
+			log.Printf("Posted event %d for task %d (%d byte image)", frame, task.TLID, len(img))
+		case <-deadline:
+			return nil
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// eventCommand posts -count notification events, -interval apart
+func eventCommand(args []string) error {
+	fs := flag.NewFlagSet("event", flag.ExitOnError)
+	d := deviceFlags(fs)
+	text := fs.String("text", "Person detected", "Event text (the task name, on a real device)")
+	imagePath := fs.String("image", "", "JPEG to send (default: synthetic frames)")
+	count := fs.Int("count", 1, "Number of events to post")
+	interval := fs.Duration("interval", 5*time.Second, "Delay between events")
+	fs.Parse(args)
+
+	for i := 1; i <= *count; i++ {
+		if i > 1 {
+			time.Sleep(*interval)
+		}
+		img, err := loadImage(*imagePath, i)
+		if err != nil {
+			return err
+		}
+		if err := d.postEvent(*text, img); err != nil {
+			return err
+		}
+		log.Printf("Posted event %d/%d (%d byte image)", i, *count, len(img))
+	}
+	return nil
+}
+
+// talkCommand holds one voice turn per recording, all in the same session
+func talkCommand(args []string) error {
+	fs := flag.NewFlagSet("talk", flag.ExitOnError)
+	d := deviceFlags(fs)
+	session := fs.String("session", fmt.Sprintf("sim-%d", time.Now().Unix()), "Session-Id to send")
+	out := fs.String("out", "", "Write the reply WAV here (turn numbers are added after the first)")
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{""} // One synthetic recording
+	}
+	for i, path := range files {
+		pcm, err := loadAudio(path)
+		if err != nil {
+			return err
+		}
+		outPath := *out
+		if outPath != "" && i > 0 {
+			outPath = fmt.Sprintf("%s.%d", *out, i+1)
+		}
+		if err := converse(d, *session, pcm, outPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tasksCommand polls view_task_detail until the device has a task, then reports it running.
+// While waiting, it long-polls servers that support it and polls every -poll otherwise.
+func tasksCommand(args []string) error {
+	fs := flag.NewFlagSet("tasks", flag.ExitOnError)
+	d := deviceFlags(fs)
+	poll := fs.Duration("poll", 5*time.Second, "Delay between polls")
+	wait := fs.Duration("wait", 0, "How long to wait for a task (0 = poll once)")
+	longPoll := fs.Bool("long-poll", true, "Hold each poll open until the task changes, if the server supports it")
+	fs.Parse(args)
+
+	deadline := time.Now().Add(*wait)
+	supported := *longPoll
+	for {
+		var task *activeTask
+		var err error
+		if hold := min(time.Until(deadline), time.Minute); supported && hold > 0 {
+			task, supported, err = d.waitTaskDetail(0, hold.Round(time.Second))
+			if err == nil && !supported {
+				log.Printf("Server does not support long polls, polling every %s", *poll)
+			}
+		} else {
+			task, err = d.viewTaskDetail()
+		}
+		if err != nil {
+			return err
+		}
+		if task.TLID != 0 {
+			log.Printf("Task %d: %s", task.TLID, task.Name)
+			return d.reportTaskStatus(task)
+		}
+		if supported && time.Now().Before(deadline) {
+			continue
+		}
+		if time.Now().Add(*poll).After(deadline) {
+			log.Printf("No active task")
+			return nil
+		}
+		time.Sleep(*poll)
+	}
+}
+
+// converse streams one recording and logs (and optionally saves) the reply
+func converse(d *device, sessionID string, pcm []byte, outPath string) error {
+	start := time.Now()
+	resp, wav, err := d.talk(sessionID, pcm)
+	if err != nil {
+		return err
+	}
+
+	replyLength, _ := audio.Duration(wav)
+	log.Printf("Talk (%s): heard %q, replied %q in %s (%s of audio, mode %d)",
+		sessionID, resp.Data.STTResult, resp.Data.ScreenText, time.Since(start).Round(time.Millisecond), replyLength, resp.Data.Mode)
+	if t := resp.Data.Task; t != nil {
+		log.Printf("Talk (%s): task %d %q is %s", sessionID, t.TLID, t.Headline, t.Status)
+	}
+
+	if outPath != "" {
+		if err := os.WriteFile(outPath, wav, 0644); err != nil {
+			return fmt.Errorf("failed to save reply: %w", err)
+		}
+		log.Printf("Saved reply to %s", outPath)
+	}
+	return nil
+}
+
+// loadImage returns the image file, or synthetic frame n if path is empty
+func loadImage(path string, n int) ([]byte, error) {
+	if path == "" {
+		return syntheticFrame(n)
+	}
+	return os.ReadFile(path)
+}
+
+// loadAudio returns the recording file, or a synthetic one if path is empty. The server
+// detects WAV and other containers itself, so files are sent as they are.
+func loadAudio(path string) ([]byte, error) {
+	if path == "" {
+		return syntheticSpeech(), nil
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,169 @@
+// Package audio normalizes uploaded audio to the 16 kHz mono 16-bit WAV that Whisper is
+// fed, and measures durations from the container instead of assuming raw PCM.
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"time"
+)
+
+// SampleRate is the sample rate audio is normalized to
+const SampleRate = 16000
+
+// ffmpegTimeout bounds decoding of one upload
+const ffmpegTimeout = 30 * time.Second
+
+// Format is a detected audio container
+type Format string
+
+const (
+	FormatPCM Format = "pcm" // Headerless 16 kHz 16-bit mono, as the Watcher streams it
+	FormatWAV Format = "wav"
+	FormatMP3 Format = "mp3"
+	FormatOGG Format = "ogg"
+	FormatM4A Format = "m4a"
+)
+
+// ErrNoDecoder is returned for compressed audio when no ffmpeg is configured
+var ErrNoDecoder = errors.New("no decoder for compressed audio (ffmpeg not configured)")
+
+// Detect identifies the container from the first bytes; anything unrecognized is raw PCM
+func Detect(data []byte) Format {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return FormatWAV
+	case len(data) >= 3 && string(data[0:3]) == "ID3":
+		return FormatMP3
+	case len(data) >= 3 && data[0] == 0xFF && data[1]&0xE0 == 0xE0 && data[1]&0x06 != 0 &&
+		data[2]&0xF0 != 0xF0 && data[2]&0x0C != 0x0C:
+		// MPEG frame header with a valid layer, bitrate, and sample rate (this also rules
+		// out the 0xFF padding the device sends before raw PCM)
+		return FormatMP3
+	case len(data) >= 4 && string(data[0:4]) == "OggS":
+		return FormatOGG
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return FormatM4A
+	}
+	return FormatPCM
+}
+
+// Normalize converts an upload to 16 kHz mono 16-bit WAV. Raw PCM and PCM WAV files are
+// converted in Go; compressed formats and other WAV encodings are decoded with the ffmpeg
+// binary at ffmpegPath ("" = not available).
+func Normalize(data []byte, ffmpegPath string) ([]byte, Format, error) {
+	format := Detect(data)
+
+	switch format {
+	case FormatPCM:
+		return encodeWAV(trimPadding(data)), format, nil
+	case FormatWAV:
+		samples, err := decodeWAV(data)
+		if err == nil {
+			return encodeWAV(samples), format, nil
+		}
+		if !errors.Is(err, errUnsupportedEncoding) || ffmpegPath == "" {
+			return nil, format, err
+		}
+	}
+
+	if ffmpegPath == "" {
+		return nil, format, ErrNoDecoder
+	}
+	pcm, err := decodeFFmpeg(data, ffmpegPath)
+	if err != nil {
+		return nil, format, err
+	}
+	return encodeWAV(pcm), format, nil
+}
+
+// Duration returns the playing time of a WAV file, from its format and data chunks
+func Duration(wav []byte) (time.Duration, error) {
+	f, payload, err := parseWAV(wav)
+	if err != nil {
+		return 0, err
+	}
+	bytesPerSecond := int(f.sampleRate) * int(f.blockAlign)
+	if bytesPerSecond == 0 {
+		return 0, fmt.Errorf("invalid WAV format")
+	}
+	return time.Duration(len(payload)) * time.Second / time.Duration(bytesPerSecond), nil
+}
+
+// Tone returns a 16 kHz mono WAV sine tone at half volume, faded in and out to avoid clicks
+func Tone(freq float64, d time.Duration) []byte {
+	samples := make([]float64, int(d.Seconds()*SampleRate))
+	fade := SampleRate / 100 // 10 ms
+	for i := range samples {
+		gain := 0.5
+		if i < fade {
+			gain *= float64(i) / float64(fade)
+		} else if n := len(samples) - 1 - i; n < fade {
+			gain *= float64(n) / float64(fade)
+		}
+		samples[i] = gain * math.Sin(2*math.Pi*freq*float64(i)/SampleRate)
+	}
+	return encodeWAV(encodePCM(samples))
+}
+
+// trimPadding drops the 0xFF bytes the device fills its buffer with before recording
+// starts, in whole 16-byte blocks like the audio service did
+func trimPadding(pcm []byte) []byte {
+	start := 0
+	for start+16 <= len(pcm) && bytes.Count(pcm[start:start+16], []byte{0xFF}) == 16 {
+		start += 16
+	}
+	pcm = pcm[start:]
+	return pcm[:len(pcm)&^1] // Whole samples only
+}
+
+// encodeWAV wraps 16 kHz mono 16-bit little-endian PCM in a WAV header
+func encodeWAV(pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // Mono
+	binary.Write(&buf, binary.LittleEndian, uint32(SampleRate))   // Sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(SampleRate*2)) // Byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // Block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // Bits per sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// decodeFFmpeg decodes any format ffmpeg understands to 16 kHz mono 16-bit PCM
+func decodeFFmpeg(data []byte, ffmpegPath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-loglevel", "error",
+		"-i", "pipe:0", "-ac", "1", "-ar", fmt.Sprint(SampleRate), "-f", "s16le", "pipe:1")
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no audio")
+	}
+	return stdout.Bytes(), nil
+}
+
+// round converts a float sample in [-1, 1] to 16 bits
+func round(v float64) int16 {
+	return int16(math.Max(-32768, math.Min(32767, math.Round(v*32768))))
+}
@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errUnsupportedEncoding marks WAV files that need ffmpeg to decode
+var errUnsupportedEncoding = errors.New("unsupported WAV encoding")
+
+// WAV format tags
+const (
+	wavPCM        = 1
+	wavFloat      = 3
+	wavExtensible = 0xFFFE
+)
+
+// wavFormat is the fmt chunk of a WAV file
+type wavFormat struct {
+	tag           uint16
+	channels      uint16
+	sampleRate    uint32
+	blockAlign    uint16
+	bitsPerSample uint16
+}
+
+// parseWAV returns a WAV file's format and sample data
+func parseWAV(data []byte) (*wavFormat, []byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, nil, fmt.Errorf("not a WAV file")
+	}
+
+	var f *wavFormat
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		// Streamed files leave the data size unset; take what was sent
+		if size > len(body) {
+			size = len(body)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, nil, fmt.Errorf("invalid WAV fmt chunk")
+			}
+			f = &wavFormat{
+				tag:           binary.LittleEndian.Uint16(body[0:2]),
+				channels:      binary.LittleEndian.Uint16(body[2:4]),
+				sampleRate:    binary.LittleEndian.Uint32(body[4:8]),
+				blockAlign:    binary.LittleEndian.Uint16(body[12:14]),
+				bitsPerSample: binary.LittleEndian.Uint16(body[14:16]),
+			}
+			// WAVE_FORMAT_EXTENSIBLE keeps the real tag in the sub-format GUID
+			if f.tag == wavExtensible && size >= 26 {
+				f.tag = binary.LittleEndian.Uint16(body[24:26])
+			}
+		case "data":
+			if f == nil {
+				return nil, nil, fmt.Errorf("WAV data before fmt chunk")
+			}
+			return f, body[:size], nil
+		}
+		pos += 8 + size + size&1 // Chunks are padded to even sizes
+	}
+	return nil, nil, fmt.Errorf("WAV file has no data chunk")
+}
+
+// decodeWAV converts 8/16-bit integer or 32-bit float WAV audio to 16 kHz mono 16-bit PCM
+func decodeWAV(data []byte) ([]byte, error) {
+	f, payload, err := parseWAV(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.channels == 0 || f.sampleRate == 0 {
+		return nil, fmt.Errorf("invalid WAV format")
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case f.tag == wavPCM && f.bitsPerSample == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case f.tag == wavPCM && f.bitsPerSample == 8:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case f.tag == wavFloat && f.bitsPerSample == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	default:
+		return nil, fmt.Errorf("%w: format %d, %d bits", errUnsupportedEncoding, f.tag, f.bitsPerSample)
+	}
+
+	// Already in the target format
+	if f.tag == wavPCM && f.bitsPerSample == 16 && f.channels == 1 && f.sampleRate == SampleRate {
+		return payload[:len(payload)&^1], nil
+	}
+
+	// Mix down to mono
+	width := int(f.bitsPerSample / 8)
+	frameSize := width * int(f.channels)
+	mono := make([]float64, len(payload)/frameSize)
+	for i := range mono {
+		frame := payload[i*frameSize:]
+		var sum float64
+		for c := 0; c < int(f.channels); c++ {
+			sum += sample(frame[c*width:])
+		}
+		mono[i] = sum / float64(f.channels)
+	}
+
+	return encodePCM(resample(mono, int(f.sampleRate))), nil
+}
+
+// resample converts mono samples to SampleRate with linear interpolation, which is
+// enough for speech recognition
+func resample(samples []float64, rate int) []float64 {
+	if rate == SampleRate || len(samples) == 0 {
+		return samples
+	}
+
+	n := int(int64(len(samples)) * SampleRate / int64(rate))
+	out := make([]float64, n)
+	step := float64(rate) / SampleRate
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		if j+1 >= len(samples) {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := pos - float64(j)
+		out[i] = samples[j]*(1-frac) + samples[j+1]*frac
+	}
+	return out
+}
+
+// encodePCM converts float samples to 16-bit little-endian PCM
+func encodePCM(samples []float64) []byte {
+	pcm := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(round(s)))
+	}
+	return pcm
+}
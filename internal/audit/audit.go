@@ -0,0 +1,161 @@
+// Package audit records who changed the server's configuration and tasks, once several admins
+// manage one server: management API requests that change something, the server's
+// subcommands that change the database, and tasks set up by voice. Entries go to the
+// append-only audit_log table and are listed by GET /api/audit.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// maxDetail bounds the bytes of a request body kept as an entry's detail
+const maxDetail = 2048
+
+// Record appends an entry to the audit log. A failure is only logged: the change it records
+// has already been made.
+func Record(e *database.AuditEntry) {
+	if err := database.RecordAudit(e); err != nil {
+		log.Printf("WARNING: Failed to record %s by %s in the audit log: %v", e.Action, e.Actor, err)
+	}
+}
+
+// FromRequest returns the entry of a management API request: the account it was
+// authenticated as, its path and address, and body (its start) as the detail
+func FromRequest(r *http.Request, action string, body []byte) *database.AuditEntry {
+	actor := ""
+	if user := auth.UserFrom(r); user != nil {
+		actor = user.Username
+	}
+	target := r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	return &database.AuditEntry{
+		Source:     database.AuditSourceAPI,
+		Actor:      actor,
+		Action:     action,
+		Target:     target,
+		Detail:     detail(r.Header.Get("Content-Type"), body),
+		RemoteAddr: r.RemoteAddr,
+	}
+}
+
+// Middleware records the management API requests that change something: those other than
+// GET and HEAD that succeed. It runs after auth.Middleware, which attaches the account.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Keep the start of the body for the entry; the handler still reads all of it
+		var head []byte
+		if r.Body != nil {
+			head, _ = io.ReadAll(io.LimitReader(r.Body, maxDetail+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		}
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		if rw.status >= http.StatusBadRequest {
+			return
+		}
+		Record(FromRequest(r, r.Method+" "+routeTemplate(r), head))
+	})
+}
+
+// routePattern matches the patterns of route variables, e.g. ":[0-9]+" in "{id:[0-9]+}"
+var routePattern = regexp.MustCompile(`\{([^:{}]+):[^{}]*\}`)
+
+// routeTemplate names the route of a request, e.g. "/api/tasks/{id}/alarm"
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return r.URL.Path
+	}
+	return routePattern.ReplaceAllString(template, "{$1}")
+}
+
+// detail describes a request body: JSON with the values of secret fields (passwords,
+// tokens, keys) replaced, or only its type and size for other bodies and bodies too long to keep
+func detail(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if len(body) > maxDetail {
+		return fmt.Sprintf("(%s body of more than %d bytes)", mediaType, maxDetail)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("(%s body of %d bytes)", mediaType, len(body))
+	}
+	redacted, err := json.Marshal(redact(v))
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+// redact replaces the values of secret fields in decoded JSON
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if secret(k) {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
+
+// secret reports whether a JSON field holds a credential
+func secret(field string) bool {
+	field = strings.ToLower(field)
+	return strings.Contains(field, "password") || strings.Contains(field, "token") ||
+		strings.Contains(field, "secret") || field == "key" || strings.HasSuffix(field, "_key")
+}
+
+// statusWriter captures the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer (e.g. to flush streams)
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// keyPrefix marks API keys so they can be told apart from session tokens and spotted in configs
+const keyPrefix = "wsk_"
+
+// NewAPIKey generates an API key, returning the key, its stored hash, and its display prefix
+func NewAPIKey() (key, hash, prefix string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = keyPrefix + hex.EncodeToString(raw)
+	return key, hashToken(key), key[:len(keyPrefix)+8], nil
+}
+
+// activeAPIKey looks up an unrevoked, unexpired key of the given scope and records its use
+func activeAPIKey(token, scope string) (*database.APIKey, error) {
+	if !strings.HasPrefix(token, keyPrefix) {
+		return nil, nil
+	}
+
+	key, err := database.GetActiveAPIKey(hashToken(token), scope)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	if err := database.TouchAPIKey(key.ID); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	return key, nil
+}
+
+// DeviceMiddleware authenticates device-facing requests with the shared AUTH_TOKEN or a
+// device API key (which must match API-OBITER-DEVICE-EUI if bound to a device). Requests
+// pass unauthenticated only while there is neither a token nor an active device key.
+func DeviceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, err := DeviceAuthenticated(r)
+		if err != nil {
+			log.Printf("ERROR: Failed to check device API key: %v", err)
+			http.Error(w, `{"code": 500}`, http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if serviceToken == "" {
+			count, err := database.CountActiveAPIKeys(database.KeyScopeDevice)
+			if err != nil {
+				log.Printf("ERROR: Failed to count device API keys: %v", err)
+				http.Error(w, `{"code": 500}`, http.StatusInternalServerError)
+				return
+			}
+			if count == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		log.Printf("ERROR: Invalid or missing Authorization header from device %s", r.Header.Get("API-OBITER-DEVICE-EUI"))
+		http.Error(w, `{"code": 401}`, http.StatusUnauthorized)
+	})
+}
+
+// DeviceAuthenticated reports whether a request carries the shared AUTH_TOKEN or an active
+// device API key valid for its API-OBITER-DEVICE-EUI. Unlike DeviceMiddleware, it is false
+// for every request while neither exists.
+func DeviceAuthenticated(r *http.Request) (bool, error) {
+	token := requestToken(r)
+	if serviceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(serviceToken)) == 1 {
+		return true, nil
+	}
+
+	key, err := activeAPIKey(token, database.KeyScopeDevice)
+	if err != nil || key == nil {
+		return false, err
+	}
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+	if key.DeviceEUI != "" && !strings.EqualFold(key.DeviceEUI, deviceEUI) {
+		log.Printf("ERROR: API key %s is bound to %s, used by %s", key.Prefix, key.DeviceEUI, deviceEUI)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+	"github.com/gorilla/mux"
+)
+
+// Management API authentication. Requests are accepted with a login session token or a
+// management API key (Authorization: Bearer <token>, or the bare token), or with the shared
+// AUTH_TOKEN, which acts as an admin so existing scripts keep working. While no users exist and no token is
+// configured, the API stays open as before. Device-facing endpoints are not affected.
+
+var (
+	serviceToken string
+	sessionTTL   time.Duration
+)
+
+type contextKey struct{}
+
+// SelfServiceRoute names routes where viewers may also write, because they only change the
+// caller's own account (e.g. PUT /api/me)
+const SelfServiceRoute = "self-service"
+
+// QueryTokenRoute names routes that also take the token from a ?token= query parameter, for
+// clients that can set neither headers nor URL credentials (SSE client nodes, EventSource)
+const QueryTokenRoute = "query-token"
+
+// Init stores the auth settings and creates the configured admin account if no users exist yet
+func Init(cfg config.AuthConfig) error {
+	serviceToken = cfg.Token
+	sessionTTL = cfg.SessionTTL
+
+	if cfg.AdminUser == "" || database.ReadOnly() {
+		return nil
+	}
+
+	count, err := database.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	hash, err := HashPassword(cfg.AdminPassword)
+	if err != nil {
+		return err
+	}
+	user := &database.User{Username: cfg.AdminUser, PasswordHash: hash, Role: database.RoleAdmin}
+	if err := database.CreateUser(user); err != nil {
+		return fmt.Errorf("failed to create admin user: %w", err)
+	}
+	log.Printf("Created admin user: %s", user.Username)
+	return nil
+}
+
+// Login checks a username and password and starts a session, returning its token
+func Login(username, password string) (string, *database.User, time.Time, error) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	if user == nil {
+		// Spend the same time as a wrong password so usernames cannot be probed
+		CheckPassword(fmt.Sprintf("pbkdf2-sha256$%d$AAAAAAAAAAAAAAAAAAAAAA$", passwordIterations), password)
+		return "", nil, time.Time{}, nil
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return "", nil, time.Time{}, nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, time.Time{}, fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	expires := time.Now().Add(sessionTTL)
+	if err := database.CreateSession(hashToken(token), user.ID, expires); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return token, user, expires, nil
+}
+
+// Logout ends the session the request was made with
+func Logout(r *http.Request) error {
+	token := requestToken(r)
+	if token == "" || database.ReadOnly() {
+		return nil
+	}
+	return database.DeleteSession(hashToken(token))
+}
+
+// Middleware authenticates management API requests and enforces roles: viewers may only
+// read, and only routes for the devices assigned to them (the {eui} route variable)
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := Authenticate(r)
+		if err != nil {
+			log.Printf("ERROR: Failed to authenticate request: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "authentication failed")
+			return
+		}
+		if user == nil {
+			log.Printf("WARNING: Unauthenticated management API request: %s %s", r.Method, r.URL.Path)
+			writeError(w, r, http.StatusUnauthorized, "login required")
+			return
+		}
+		// Attached before the role checks so their errors are in the account's language
+		r = WithUser(r, user)
+
+		if database.ReadOnly() && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, r, http.StatusServiceUnavailable, "server is in read-only mode")
+			return
+		}
+		if user.Role != database.RoleAdmin {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && !selfService(r) {
+				writeError(w, r, http.StatusForbidden, "read-only account")
+				return
+			}
+			if eui, ok := mux.Vars(r)["eui"]; ok && !slices.Contains(user.Devices, eui) {
+				writeError(w, r, http.StatusForbidden, "device not assigned to this account")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminOnly restricts a fleet-wide management route to admins
+func AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user := UserFrom(r); user == nil || user.Role != database.RoleAdmin {
+			writeError(w, r, http.StatusForbidden, "admin role required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// WithUser returns the request with the account it was authenticated as, for UserFrom
+func WithUser(r *http.Request, user *database.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, user))
+}
+
+// UserFrom returns the account a request was authenticated as (nil outside Middleware)
+func UserFrom(r *http.Request) *database.User {
+	user, _ := r.Context().Value(contextKey{}).(*database.User)
+	return user
+}
+
+// Language returns the language of the request's messages: the account's language if it has
+// one, otherwise the best match for the Accept-Language header
+func Language(r *http.Request) string {
+	if user := UserFrom(r); user != nil && user.Language != "" {
+		return user.Language
+	}
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// selfService reports whether the request matched a route named SelfServiceRoute
+func selfService(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	return route != nil && route.GetName() == SelfServiceRoute
+}
+
+// CanSeeDevice reports whether the request's account may see a device
+func CanSeeDevice(r *http.Request, deviceEUI string) bool {
+	user := UserFrom(r)
+	return user == nil || user.Role == database.RoleAdmin || slices.Contains(user.Devices, deviceEUI)
+}
+
+// VisibleTo returns the user ID whose device assignments limit what the request may list,
+// or 0 if it may see all devices
+func VisibleTo(r *http.Request) int {
+	if user := UserFrom(r); user != nil && user.Role != database.RoleAdmin {
+		return user.ID
+	}
+	return 0
+}
+
+// Authenticate resolves the request's account, or nil if it is not authenticated. Routes
+// outside Middleware that enforce roles themselves use it with WithUser.
+func Authenticate(r *http.Request) (*database.User, error) {
+	token := requestToken(r)
+
+	if serviceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(serviceToken)) == 1 {
+		return &database.User{Username: "token", Role: database.RoleAdmin}, nil
+	}
+
+	if key, err := activeAPIKey(token, database.KeyScopeManagement); err != nil || key != nil {
+		if err != nil {
+			return nil, err
+		}
+		return database.GetUserByID(key.UserID)
+	}
+
+	if token != "" {
+		user, err := database.GetSessionUser(hashToken(token))
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+
+	// Without accounts or a token, the API stays open
+	if serviceToken == "" {
+		count, err := database.CountUsers()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return &database.User{Username: "anonymous", Role: database.RoleAdmin}, nil
+		}
+	}
+	return nil, nil
+}
+
+// requestToken returns the token from the Authorization header, with or without the Bearer
+// scheme. With HTTP Basic authentication the password is the token (the username is ignored),
+// for clients that only take credentials in a URL, such as NVR software. Routes named
+// QueryTokenRoute also take it from ?token= when there is no Authorization header.
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	if header == "" {
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == QueryTokenRoute {
+			return r.URL.Query().Get("token")
+		}
+	}
+	return header
+}
+
+// hashToken returns the stored form of a session token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeError writes a JSON error response in the API's format and the request's language
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"code":%d,"error":%q}`, status, i18n.Translate(Language(r), message))
+}
@@ -0,0 +1,257 @@
+// Package backup writes and restores a single archive of an installation's data: a consistent
+// snapshot of the SQLite database (taken with the online backup API, so the server can keep
+// running) and the blobs of the blob store (uploads, firmware, voice audio, persisted captures).
+// The archive is a gzipped tar file:
+//
+//	manifest.json        format version, server version, time and contents
+//	database/sensecap.db the database snapshot
+//	blobs/<key>          one file per blob
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/storage"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// Format is the version of the archive layout, checked on restore
+const Format = 1
+
+// Entry names in the archive
+const (
+	manifestEntry = "manifest.json"
+	databaseEntry = "database/sensecap.db"
+	blobPrefix    = "blobs/"
+)
+
+// Manifest describes an archive. It is the first entry, so a restore can check it before
+// writing anything.
+type Manifest struct {
+	Format        int       `json:"format"`
+	ServerVersion string    `json:"server_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Blobs         int       `json:"blobs"`         // Blobs in the archive
+	BlobsSkipped  string    `json:"blobs_skipped"` // Why the blobs are not in the archive ("" if they are)
+}
+
+// Create writes an archive of the database at dbPath and the blobs of store to w. Blobs are
+// only included if the store can list them (the filesystem store); S3 buckets are backed up
+// with the bucket's own tools.
+func Create(w io.Writer, dbPath string, store storage.BlobStore) (*Manifest, error) {
+	snapshot, err := os.CreateTemp("", "watcher-backup-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	snapshot.Close()
+	defer os.Remove(snapshot.Name())
+	if err := database.BackupFile(dbPath, snapshot.Name()); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	manifest := &Manifest{Format: Format, ServerVersion: version.String(), CreatedAt: time.Now().UTC()}
+	var keys []string
+	if lister, ok := store.(storage.Lister); ok {
+		if keys, err = lister.List(ctx); err != nil {
+			return nil, err
+		}
+		manifest.Blobs = len(keys)
+	} else {
+		manifest.BlobsSkipped = "the blob store cannot be listed (back up the S3 bucket separately)"
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestEntry, data, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, databaseEntry, snapshot.Name()); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		data, err := store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			// Deleted since it was listed
+			manifest.Blobs--
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(tw, blobPrefix+key, data, manifest.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeEntry adds a file with the given contents to the archive
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// writeFile adds the file at p to the archive under name without loading it into memory
+func writeFile(tw *tar.Writer, name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Restore unpacks an archive from r: the database replaces the one at dbPath and the blobs are
+// written to store, which may use a different driver than the backed-up installation (e.g. to
+// move from the filesystem to S3). The server must not be running. An existing database is only
+// replaced with force.
+func Restore(r io.Reader, dbPath string, store storage.BlobStore, force bool) (*Manifest, error) {
+	if _, err := os.Stat(dbPath); err == nil && !force {
+		return nil, fmt.Errorf("database %s already exists (stop the server and use -force to replace it)", dbPath)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestEntry {
+		return nil, fmt.Errorf("not a backup archive: %s is missing", manifestEntry)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestEntry, err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("unsupported backup format %d (this server reads format %d)", manifest.Format, Format)
+	}
+
+	ctx := context.Background()
+	restoredDB, blobs := false, 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch {
+		case header.Name == databaseEntry:
+			if err := restoreDatabase(tr, dbPath); err != nil {
+				return nil, err
+			}
+			restoredDB = true
+		case strings.HasPrefix(header.Name, blobPrefix):
+			key := strings.TrimPrefix(header.Name, blobPrefix)
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read archive: %w", err)
+			}
+			contentType := mime.TypeByExtension(path.Ext(key))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			if err := store.Put(ctx, key, data, contentType); err != nil {
+				return nil, fmt.Errorf("failed to restore blob %s: %w", key, err)
+			}
+			blobs++
+		default:
+			log.Printf("WARNING: Skipping unknown archive entry %s", header.Name)
+		}
+	}
+
+	if !restoredDB {
+		return nil, fmt.Errorf("archive has no database (%s)", databaseEntry)
+	}
+	manifest.Blobs = blobs
+	return &manifest, nil
+}
+
+// restoreDatabase writes the database snapshot to a temporary file next to dbPath and moves it
+// into place, removing the old database's WAL and shared-memory files
+func restoreDatabase(r io.Reader, dbPath string) error {
+	if dir := filepath.Dir(dbPath); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	tmp := dbPath + ".restore"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to remove old database file: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/storage"
+)
+
+// Capture is a full raw record of one device request and the server's response
+type Capture struct {
+	ID              int64         `json:"id"`
+	Timestamp       time.Time     `json:"timestamp"`
+	DeviceEUI       string        `json:"device_eui"`
+	Method          string        `json:"method"`
+	Path            string        `json:"path"`
+	Query           string        `json:"query,omitempty"`
+	RemoteAddr      string        `json:"remote_addr"`
+	RequestHeaders  http.Header   `json:"request_headers"`
+	RequestBody     []byte        `json:"request_body"` // Raw bytes (base64 in JSON)
+	StatusCode      int           `json:"status_code"`
+	ResponseHeaders http.Header   `json:"response_headers"`
+	ResponseBody    []byte        `json:"response_body"` // Raw bytes (base64 in JSON), includes multipart audio
+	Duration        time.Duration `json:"duration_ns"`
+}
+
+// Summary is a capture without the request/response bodies, used for listings
+type Summary struct {
+	ID           int64     `json:"id"`
+	Timestamp    time.Time `json:"timestamp"`
+	DeviceEUI    string    `json:"device_eui"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	StatusCode   int       `json:"status_code"`
+	RequestSize  int       `json:"request_size"`
+	ResponseSize int       `json:"response_size"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	ring    []*Capture
+	maxSize int
+	nextID  int64
+	store   storage.BlobStore
+)
+
+// Initialize enables capture mode, keeping the last size captures in memory.
+// If blobStore is non-nil, every capture is also written to it as JSON under captures/.
+func Initialize(size int, blobStore storage.BlobStore) error {
+	if size <= 0 {
+		return fmt.Errorf("capture buffer size must be positive")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled = true
+	maxSize = size
+	store = blobStore
+	ring = make([]*Capture, 0, size)
+
+	if store != nil {
+		log.Printf("Debug capture enabled: keeping last %d exchanges, persisting to blob store", size)
+	} else {
+		log.Printf("Debug capture enabled: keeping last %d exchanges in memory", size)
+	}
+	return nil
+}
+
+// Enabled reports whether capture mode is on
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// Middleware records the full raw request and response of every request passing through it
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+
+		// Read and restore the request body (replaying any read error, e.g. a body size limit, to the handler)
+		var reqBody []byte
+		if r.Body != nil {
+			var readErr error
+			reqBody, readErr = io.ReadAll(r.Body)
+			r.Body.Close()
+			if readErr != nil {
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), errReader{readErr}))
+			} else {
+				r.Body = io.NopCloser(bytes.NewReader(reqBody))
+			}
+		}
+
+		cw := &captureWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		record(&Capture{
+			Timestamp:       start,
+			DeviceEUI:       r.Header.Get("API-OBITER-DEVICE-EUI"),
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Query:           r.URL.RawQuery,
+			RemoteAddr:      r.RemoteAddr,
+			RequestHeaders:  redactHeaders(r.Header),
+			RequestBody:     reqBody,
+			StatusCode:      cw.statusCode,
+			ResponseHeaders: redactHeaders(w.Header()),
+			ResponseBody:    cw.body.Bytes(),
+			Duration:        time.Since(start),
+		})
+	})
+}
+
+// Redacted replaces the values of credential headers in captures
+const Redacted = "(present, redacted)"
+
+// redactHeaders returns a copy of header with credentials (device tokens and API keys,
+// cookies) replaced by Redacted, so captures kept in memory, on disk and served by
+// /api/debug/captures do not hand them out
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name, values := range redacted {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "proxy-authorization" || lower == "cookie" || lower == "set-cookie" ||
+			strings.Contains(lower, "key") || strings.Contains(lower, "token") {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return redacted
+}
+
+// captureWriter wraps http.ResponseWriter to copy the response body and status code
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	cw.statusCode = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// errReader returns a fixed error on every read
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// record stores a capture in the ring buffer and optionally on disk
+func record(c *Capture) {
+	mu.Lock()
+	nextID++
+	c.ID = nextID
+	if len(ring) >= maxSize {
+		ring = ring[1:]
+	}
+	ring = append(ring, c)
+	blobStore := store
+	mu.Unlock()
+
+	if blobStore == nil {
+		return
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Printf("WARNING: Failed to marshal capture %d: %v", c.ID, err)
+		return
+	}
+
+	key := fmt.Sprintf("captures/%s_%06d.json", c.Timestamp.Format("20060102-150405"), c.ID)
+	if err := blobStore.Put(context.Background(), key, data, "application/json"); err != nil {
+		log.Printf("WARNING: Failed to write capture %d: %v", c.ID, err)
+	}
+}
+
+// List returns summaries of the buffered captures, newest first
+func List() []Summary {
+	mu.Lock()
+	defer mu.Unlock()
+
+	summaries := make([]Summary, 0, len(ring))
+	for i := len(ring) - 1; i >= 0; i-- {
+		c := ring[i]
+		summaries = append(summaries, Summary{
+			ID:           c.ID,
+			Timestamp:    c.Timestamp,
+			DeviceEUI:    c.DeviceEUI,
+			Method:       c.Method,
+			Path:         c.Path,
+			StatusCode:   c.StatusCode,
+			RequestSize:  len(c.RequestBody),
+			ResponseSize: len(c.ResponseBody),
+			DurationMs:   c.Duration.Milliseconds(),
+		})
+	}
+	return summaries
+}
+
+// Get returns a buffered capture by ID, or nil if it has been evicted or never existed
+func Get(id int64) *Capture {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range ring {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// Clear removes all buffered captures (persisted captures are kept)
+func Clear() {
+	mu.Lock()
+	defer mu.Unlock()
+	ring = ring[:0]
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed setup.html
+var setupPage []byte
+
+// bootstrapFailureDelay slows down guessing the setup code
+const bootstrapFailureDelay = time.Second
+
+// BootstrapSettings are the settings the setup page asks for (GET /config returns the current
+// values, POST /config writes them to the config file)
+type BootstrapSettings struct {
+	Port          int    `json:"port"`
+	Token         string `json:"token"` // Device token ("" on POST = generate one)
+	AdminUser     string `json:"admin_user"`
+	AdminPassword string `json:"admin_password"`
+	WhisperURL    string `json:"whisper_url"`
+	PiperURL      string `json:"piper_url"`
+	OllamaURL     string `json:"ollama_url"`
+	OllamaModel   string `json:"ollama_model"`
+	LLaVAModel    string `json:"llava_model"`
+	DBPath        string `json:"db_path"`
+	StorageDir    string `json:"storage_dir"`
+}
+
+// bootstrap serves the setup page until the config file is written
+type bootstrap struct {
+	path string // Config file to write
+	code string // Setup code required by the API, printed to the log
+
+	mu   sync.Mutex
+	done chan struct{} // Closed once the config file is written
+}
+
+// RunBootstrap serves a setup page and API on port until they write the config file at path.
+// It is the first start of a server without a terminal (e.g. in Docker), so the page is
+// protected by a one-time setup code printed to the log. Every other request gets a 503.
+func RunBootstrap(path, port string) error {
+	code, err := generateToken()
+	if err != nil {
+		return err
+	}
+	b := &bootstrap{path: path, code: code[:12], done: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/setup", http.StatusFound)
+	})
+	mux.HandleFunc("GET /setup", b.page)
+	mux.HandleFunc("GET /config", b.authorized(b.current))
+	mux.HandleFunc("POST /config", b.authorized(b.save))
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeBootstrapJSON(w, http.StatusOK, map[string]interface{}{"status": "setup"})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeBootstrapError(w, http.StatusServiceUnavailable, "the server is waiting for its first-run setup at /setup")
+	})
+
+	srv := &http.Server{Addr: ":" + port, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	log.Println("================================================================================")
+	log.Println("  First start without configuration: finish the setup in a browser")
+	log.Printf("  Open http://<this host>:%s/setup and enter the setup code %s", port, b.code)
+	log.Printf("  (or set AUTH_TOKEN or create %s to skip it, or BOOTSTRAP=false for defaults)", path)
+	log.Println("================================================================================")
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve the setup page: %w", err)
+	case <-b.done:
+	}
+
+	// Let the last response go out before the server takes over the port
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Printf("Configuration written to %s, starting the server", path)
+	return nil
+}
+
+// page serves the setup form
+func (b *bootstrap) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(setupPage)
+}
+
+// authorized requires the setup code as a bearer token
+func (b *bootstrap) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(code), []byte(b.code)) != 1 {
+			time.Sleep(bootstrapFailureDelay)
+			writeBootstrapError(w, http.StatusUnauthorized, "wrong setup code (it is printed in the server log)")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// current handles GET /config: the settings the server would start with, and a generated
+// token to suggest
+func (b *bootstrap) current(w http.ResponseWriter, r *http.Request) {
+	token, err := generateToken()
+	if err != nil {
+		writeBootstrapError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	port, _ := strconv.Atoi(currentValue("port", "PORT"))
+	writeBootstrapJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+		"config_path": b.path,
+		"settings": BootstrapSettings{
+			Port:        port,
+			Token:       token,
+			AdminUser:   "admin",
+			WhisperURL:  currentValue("whisper-url", "WHISPER_URL"),
+			PiperURL:    currentValue("piper-url", "PIPER_URL"),
+			OllamaURL:   currentValue("ollama-url", "OLLAMA_URL"),
+			OllamaModel: currentValue("ollama-model", "OLLAMA_MODEL"),
+			LLaVAModel:  currentValue("llava-model", "LLAVA_MODEL"),
+			DBPath:      currentValue("db", "DB_PATH"),
+			StorageDir:  currentValue("storage-dir", "STORAGE_DIR"),
+		},
+		"pinned": pinnedSettings(),
+	}})
+}
+
+// save handles POST /config: validates the settings, writes the config file and ends the
+// setup. Unreachable AI services and missing models are reported as warnings.
+func (b *bootstrap) save(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+		writeBootstrapError(w, http.StatusConflict, "the setup is already complete")
+		return
+	default:
+	}
+
+	var s BootstrapSettings
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		writeBootstrapError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if err := s.validate(); err != nil {
+		writeBootstrapError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.Token == "" {
+		token, err := generateToken()
+		if err != nil {
+			writeBootstrapError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Token = token
+	}
+	for _, dir := range []string{filepath.Dir(s.DBPath), s.StorageDir, filepath.Dir(b.path)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			writeBootstrapError(w, http.StatusBadRequest, fmt.Sprintf("cannot create %s: %v", dir, err))
+			return
+		}
+	}
+
+	values := map[string]map[string]interface{}{
+		"server":   {"port": s.Port},
+		"auth":     {"token": s.Token},
+		"database": {"path": s.DBPath},
+		"storage":  {"dir": s.StorageDir},
+		"ai": {
+			"whisper_url":  s.WhisperURL,
+			"piper_url":    s.PiperURL,
+			"ollama_url":   s.OllamaURL,
+			"ollama_model": s.OllamaModel,
+			"llava_model":  s.LLaVAModel,
+		},
+	}
+	if s.AdminUser != "" {
+		values["auth"]["admin_user"] = s.AdminUser
+		values["auth"]["admin_password"] = s.AdminPassword
+	}
+	if err := writeConfigFile(b.path, values); err != nil {
+		writeBootstrapError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeBootstrapJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+		"config_path": b.path,
+		"token":       s.Token,
+		"warnings":    s.probe(),
+	}})
+	close(b.done)
+}
+
+// validate checks the settings of a POST /config
+func (s *BootstrapSettings) validate() error {
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	s.Token = strings.TrimSpace(s.Token)
+	if s.AdminUser = strings.TrimSpace(s.AdminUser); s.AdminUser != "" && s.AdminPassword == "" {
+		return fmt.Errorf("the admin account needs a password")
+	}
+	for name, u := range map[string]string{"whisper_url": s.WhisperURL, "piper_url": s.PiperURL, "ollama_url": s.OllamaURL} {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", name)
+		}
+	}
+	s.WhisperURL = strings.TrimRight(s.WhisperURL, "/")
+	s.PiperURL = strings.TrimRight(s.PiperURL, "/")
+	s.OllamaURL = strings.TrimRight(s.OllamaURL, "/")
+	if s.OllamaModel == "" || s.LLaVAModel == "" {
+		return fmt.Errorf("the chat and vision models are required")
+	}
+	if s.DBPath == "" || s.StorageDir == "" {
+		return fmt.Errorf("the database path and storage directory are required")
+	}
+	return nil
+}
+
+// probe checks the AI services like the terminal wizard, returning what is not ready
+func (s *BootstrapSettings) probe() []string {
+	warnings := []string{}
+	if err := probe(s.WhisperURL + "/health"); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Audio service not reachable (%v); voice requests fail until it is started", err))
+	}
+	installed, err := ollamaModels(s.OllamaURL)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("Ollama not reachable (%v); pull the models once it is running", err))
+	}
+	for _, model := range []string{s.OllamaModel, s.LLaVAModel} {
+		if !installed[model] {
+			warnings = append(warnings, fmt.Sprintf("Model %s is not installed (ollama pull %s)", model, model))
+		}
+	}
+	return warnings
+}
+
+// bootstrapFlags maps the BootstrapSettings fields to their flags
+var bootstrapFlags = map[string]string{
+	"port":           "port",
+	"admin_user":     "admin-user",
+	"admin_password": "admin-password",
+	"whisper_url":    "whisper-url",
+	"piper_url":      "piper-url",
+	"ollama_url":     "ollama-url",
+	"ollama_model":   "ollama-model",
+	"llava_model":    "llava-model",
+	"db_path":        "db",
+	"storage_dir":    "storage-dir",
+}
+
+// pinnedSettings lists the BootstrapSettings fields set by a command-line flag or an
+// environment variable, which take precedence over the config file
+func pinnedSettings() []string {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	envs := make(map[string]string, len(fileSettings))
+	for _, setting := range fileSettings {
+		if setting.flag != "" {
+			envs[setting.flag] = setting.env
+		}
+	}
+
+	pinned := []string{}
+	for field, name := range bootstrapFlags {
+		if explicit[name] || os.Getenv(envs[name]) != "" {
+			pinned = append(pinned, field)
+		}
+	}
+	sort.Strings(pinned)
+	return pinned
+}
+
+// currentValue returns a setting's environment variable, or else its flag's value
+func currentValue(flagName, env string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return flagDefault(flagName)
+}
+
+func writeBootstrapJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeBootstrapError(w http.ResponseWriter, status int, message string) {
+	writeBootstrapJSON(w, status, map[string]interface{}{"code": status, "error": message})
+}
@@ -0,0 +1,67 @@
+package config
+
+import "strings"
+
+// Release channels a device can be on
+const (
+	ChannelStable = "stable"
+	ChannelCanary = "canary"
+)
+
+// CanaryConfig holds prompt and model overrides applied only to selected devices,
+// so changes can be compared against the stable group before promoting them
+type CanaryConfig struct {
+	Devices     []string      // Device EUIs on the canary channel
+	OllamaModel string        // "" = same as stable
+	LLaVAModel  string        // "" = same as stable
+	Prompts     PromptsConfig // Empty fields = same as stable
+}
+
+// Channel returns the release channel a device is on
+func (c *Config) Channel(deviceEUI string) string {
+	for _, eui := range c.Canary.Devices {
+		if strings.EqualFold(eui, deviceEUI) {
+			return ChannelCanary
+		}
+	}
+	return ChannelStable
+}
+
+// ForDevice returns the configuration to use for a device's requests:
+// c itself for stable devices, or a copy with the canary overrides applied
+func (c *Config) ForDevice(deviceEUI string) *Config {
+	if c.Channel(deviceEUI) != ChannelCanary {
+		return c
+	}
+
+	dc := *c
+	canary := c.Canary
+	overrideString(&dc.AI.OllamaModel, canary.OllamaModel)
+	overrideString(&dc.AI.LLaVAModel, canary.LLaVAModel)
+	overrideString(&dc.Prompts.ModeDetection, canary.Prompts.ModeDetection)
+	overrideString(&dc.Prompts.Chat, canary.Prompts.Chat)
+	overrideString(&dc.Prompts.Trigger, canary.Prompts.Trigger)
+	overrideString(&dc.Prompts.WordMatch, canary.Prompts.WordMatch)
+	overrideString(&dc.Prompts.ModelSelection, canary.Prompts.ModelSelection)
+	overrideString(&dc.Prompts.Headline, canary.Prompts.Headline)
+	overrideString(&dc.Prompts.PetVerification, canary.Prompts.PetVerification)
+	overrideString(&dc.Prompts.GestureVerification, canary.Prompts.GestureVerification)
+	return &dc
+}
+
+func overrideString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// parseDeviceList splits a comma-separated list of device EUIs
+func parseDeviceList(value string) []string {
+	var devices []string
+	for _, eui := range strings.Split(value, ",") {
+		if eui = strings.TrimSpace(eui); eui != "" {
+			devices = append(devices, strings.ToUpper(eui))
+		}
+	}
+	return devices
+}
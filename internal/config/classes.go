@@ -0,0 +1,37 @@
+package config
+
+import "strings"
+
+// COCOClasses are the 80 COCO dataset classes, the default list of objects voice tasks can
+// target (detected by the built-in models or a SenseCraft cloud model)
+var COCOClasses = []string{
+	"person", "bicycle", "car", "motorcycle", "airplane", "bus", "train", "truck", "boat",
+	"traffic light", "fire hydrant", "stop sign", "parking meter", "bench",
+	"bird", "cat", "dog", "horse", "sheep", "cow", "elephant", "bear", "zebra", "giraffe",
+	"backpack", "umbrella", "handbag", "tie", "suitcase", "frisbee", "skis", "snowboard",
+	"sports ball", "kite", "baseball bat", "baseball glove", "skateboard", "surfboard",
+	"tennis racket", "bottle", "wine glass", "cup", "fork", "knife", "spoon", "bowl",
+	"banana", "apple", "sandwich", "orange", "broccoli", "carrot", "hot dog", "pizza",
+	"donut", "cake", "chair", "couch", "potted plant", "bed", "dining table", "toilet",
+	"tv", "laptop", "mouse", "remote", "keyboard", "cell phone", "microwave", "oven",
+	"toaster", "sink", "refrigerator", "book", "clock", "vase", "scissors", "teddy bear",
+	"hair drier", "toothbrush",
+}
+
+// parseClassList splits a comma-separated list of class names, lowercased and without
+// duplicates; an empty list is the COCO classes
+func parseClassList(value string) []string {
+	var classes []string
+	seen := make(map[string]bool)
+	for _, class := range strings.Split(value, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if class != "" && !seen[class] {
+			seen[class] = true
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) == 0 {
+		return COCOClasses
+	}
+	return classes
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSetting maps a config file key ("section.name") to the flag it feeds and,
+// for settings that can change at runtime, how to apply it on reload
+type fileSetting struct {
+	flag   string                    // Flag the value feeds at startup ("" = file-only setting)
+	env    string                    // Environment variable that takes precedence over the file
+	def    string                    // Default for file-only settings (flag settings use the flag default)
+	reload func(c *Config, v string) // Applies the value on reload (nil = restart required)
+}
+
+// fileSettings lists every key accepted in the config file
+var fileSettings = map[string]fileSetting{
+	"server.port":            {flag: "port", env: "PORT"},
+	"server.host":            {flag: "host", env: "HOST"},
+	"server.base_path":       {flag: "base-path", env: "BASE_PATH"},
+	"server.trusted_proxies": {flag: "trusted-proxies", env: "TRUSTED_PROXIES"},
+	"server.dashboard":       {flag: "dashboard", env: "DASHBOARD"},
+	"server.web_dir":         {flag: "web-dir", env: "WEB_DIR"},
+	"server.profile":         {flag: "profile", env: "PROFILE"},
+
+	"auth.token":          {flag: "token", env: "AUTH_TOKEN"},
+	"auth.token_file":     {flag: "token-file", env: "AUTH_TOKEN_FILE"},
+	"auth.session_ttl":    {flag: "session-ttl", env: "SESSION_TTL"},
+	"auth.admin_user":     {flag: "admin-user", env: "ADMIN_USER"},
+	"auth.admin_password": {flag: "admin-password", env: "ADMIN_PASSWORD"},
+	"auth.strict_devices": {flag: "strict-devices", env: "STRICT_DEVICES"},
+
+	"database.path":      {flag: "db", env: "DB_PATH"},
+	"database.read_only": {flag: "read-only", env: "READ_ONLY"},
+
+	"ai.whisper_url":         {flag: "whisper-url", env: "WHISPER_URL", reload: func(c *Config, v string) { c.AI.WhisperURL = v }},
+	"ai.ollama_url":          {flag: "ollama-url", env: "OLLAMA_URL", reload: func(c *Config, v string) { c.AI.OllamaURL = v }},
+	"ai.ollama_model":        {flag: "ollama-model", env: "OLLAMA_MODEL", reload: func(c *Config, v string) { c.AI.OllamaModel = v }},
+	"ai.llava_model":         {flag: "llava-model", env: "LLAVA_MODEL", reload: func(c *Config, v string) { c.AI.LLaVAModel = v }},
+	"ai.piper_url":           {flag: "piper-url", env: "PIPER_URL", reload: func(c *Config, v string) { c.AI.PiperURL = v }},
+	"ai.cloud_models":        {flag: "cloud-models", env: "CLOUD_MODELS", reload: func(c *Config, v string) { c.AI.CloudModels = v == "true" || v == "1" }},
+	"ai.classes":             {flag: "classes", env: "CLASSES", reload: func(c *Config, v string) { c.AI.Classes = parseClassList(v) }},
+	"ai.ffmpeg_path":         {flag: "ffmpeg", env: "FFMPEG_PATH", reload: func(c *Config, v string) { c.AI.FFmpegPath = v }},
+	"ai.vision_analysis":     {flag: "vision-analysis", env: "VISION_ANALYSIS", reload: func(c *Config, v string) { c.AI.VisionAnalysis = v == "true" || v == "1" }},
+	"ai.resample_replies":    {flag: "resample-replies", env: "RESAMPLE_REPLIES", reload: func(c *Config, v string) { c.AI.ResampleReplies = v == "true" || v == "1" }},
+	"ai.speculative_chat":    {flag: "speculative-chat", env: "SPECULATIVE_CHAT", reload: func(c *Config, v string) { c.AI.SpeculativeChat = v == "true" || v == "1" }},
+	"ai.openai_url":          {flag: "openai-url", env: "OPENAI_BASE_URL", reload: func(c *Config, v string) { c.AI.OpenAIURL = v }},
+	"ai.openai_key":          {flag: "openai-key", env: "OPENAI_API_KEY", reload: func(c *Config, v string) { c.AI.OpenAIKey = v }},
+	"ai.openai_vision_model": {flag: "openai-vision-model", env: "OPENAI_VISION_MODEL", reload: func(c *Config, v string) { c.AI.OpenAIVisionModel = v }},
+	"ai.detector_url":        {flag: "detector-url", env: "DETECTOR_URL", reload: func(c *Config, v string) { c.AI.DetectorURL = v }},
+	"ai.onnx_model":          {flag: "onnx-model", env: "ONNX_MODEL"},
+	"ai.onnxruntime_lib":     {flag: "onnxruntime-lib", env: "ONNXRUNTIME_LIB"},
+
+	"api.schema":   {flag: "api-schema", env: "API_SCHEMA"},
+	"api.base_url": {flag: "api-base-url", env: "API_BASE_URL"},
+
+	"debug.capture":         {flag: "debug-capture", env: "DEBUG_CAPTURE"},
+	"debug.capture_persist": {flag: "capture-persist", env: "CAPTURE_PERSIST"},
+	"debug.capture_size":    {flag: "capture-size", env: "CAPTURE_SIZE"},
+	"debug.log_lines":       {flag: "log-lines", env: "LOG_LINES"},
+
+	"storage.driver":        {flag: "storage-driver", env: "STORAGE_DRIVER"},
+	"storage.dir":           {flag: "storage-dir", env: "STORAGE_DIR"},
+	"storage.s3_endpoint":   {flag: "s3-endpoint", env: "S3_ENDPOINT"},
+	"storage.s3_region":     {flag: "s3-region", env: "S3_REGION"},
+	"storage.s3_bucket":     {flag: "s3-bucket", env: "S3_BUCKET"},
+	"storage.s3_access_key": {flag: "s3-access-key", env: "S3_ACCESS_KEY"},
+	"storage.s3_secret_key": {flag: "s3-secret-key", env: "S3_SECRET_KEY"},
+
+	"limits.max_body_mb":       {flag: "max-body-mb", env: "MAX_BODY_MB"},
+	"limits.max_upload_mb":     {flag: "max-upload-mb", env: "MAX_UPLOAD_MB"},
+	"limits.device_rate_limit": {flag: "device-rate-limit", env: "DEVICE_RATE_LIMIT"},
+	"limits.global_rate_limit": {flag: "global-rate-limit", env: "GLOBAL_RATE_LIMIT"},
+
+	"tasks.error_threshold": {flag: "task-error-threshold", env: "TASK_ERROR_THRESHOLD"},
+	"tasks.ack_window":      {flag: "task-ack-window", env: "TASK_ACK_WINDOW"},
+	"tasks.context_frames":  {flag: "task-context-frames", env: "TASK_CONTEXT_FRAMES", reload: func(c *Config, v string) { c.Tasks.ContextFrames = v == "true" || v == "1" }},
+	"tasks.confirm":         {flag: "task-confirm", env: "TASK_CONFIRM", reload: func(c *Config, v string) { c.Tasks.Confirm = v == "true" || v == "1" }},
+	"tasks.confirm_window":  {flag: "task-confirm-window", env: "TASK_CONFIRM_WINDOW"},
+	"tasks.cooldown":        {flag: "task-cooldown", env: "TASK_COOLDOWN"},
+	"tasks.dedup":           {flag: "task-dedup", env: "TASK_DEDUP"},
+
+	"backends.timeout":             {flag: "backend-timeout", env: "BACKEND_TIMEOUT"},
+	"backends.retries":             {flag: "backend-retries", env: "BACKEND_RETRIES"},
+	"backends.retry_backoff":       {flag: "backend-retry-backoff", env: "BACKEND_RETRY_BACKOFF"},
+	"backends.breaker_threshold":   {flag: "breaker-threshold", env: "BREAKER_THRESHOLD"},
+	"backends.breaker_cooldown":    {flag: "breaker-cooldown", env: "BREAKER_COOLDOWN"},
+	"backends.concurrency":         {flag: "backend-concurrency", env: "BACKEND_CONCURRENCY"},
+	"backends.whisper_concurrency": {flag: "whisper-concurrency", env: "WHISPER_CONCURRENCY"},
+	"backends.ollama_concurrency":  {flag: "ollama-concurrency", env: "OLLAMA_CONCURRENCY"},
+	"backends.piper_concurrency":   {flag: "piper-concurrency", env: "PIPER_CONCURRENCY"},
+	"backends.queue_size":          {flag: "backend-queue-size", env: "BACKEND_QUEUE_SIZE"},
+	"backends.queue_timeout":       {flag: "backend-queue-timeout", env: "BACKEND_QUEUE_TIMEOUT"},
+
+	"cache.response_ttl":         {flag: "response-cache-ttl", env: "RESPONSE_CACHE_TTL"},
+	"cache.vision_ttl":           {flag: "vision-cache-ttl", env: "VISION_CACHE_TTL"},
+	"cache.vision_hash_distance": {flag: "vision-cache-distance", env: "VISION_CACHE_DISTANCE"},
+	"cache.vision_min_change":    {flag: "vision-min-change", env: "VISION_MIN_CHANGE"},
+
+	"vision.default_prompt":      {flag: "vision-default-prompt", env: "VISION_DEFAULT_PROMPT", reload: func(c *Config, v string) { c.Vision.DefaultPrompt = v }},
+	"vision.recognize_max_chars": {flag: "recognize-max-chars", env: "RECOGNIZE_MAX_CHARS", reload: func(c *Config, v string) { c.Vision.RecognizeMaxChars = reloadInt(v) }},
+	"vision.store_recognize":     {flag: "store-recognize", env: "STORE_RECOGNIZE", reload: func(c *Config, v string) { c.Vision.StoreRecognize = v == "true" || v == "1" }},
+	"vision.privacy":             {flag: "privacy", env: "PRIVACY", reload: func(c *Config, v string) { c.Vision.Privacy = v }},
+	"vision.provider":            {flag: "vision-provider", env: "VISION_PROVIDER", reload: func(c *Config, v string) { c.Vision.Provider = v }},
+
+	"export.driver":   {flag: "export", env: "EXPORT"},
+	"export.url":      {flag: "export-url", env: "EXPORT_URL"},
+	"export.token":    {flag: "export-token", env: "EXPORT_TOKEN"},
+	"export.interval": {flag: "export-interval", env: "EXPORT_INTERVAL"},
+
+	"rules.interval":           {flag: "rules-interval", env: "RULES_INTERVAL"},
+	"rules.twilio_account_sid": {flag: "twilio-account-sid", env: "TWILIO_ACCOUNT_SID"},
+	"rules.twilio_auth_token":  {flag: "twilio-auth-token", env: "TWILIO_AUTH_TOKEN"},
+	"rules.twilio_from":        {flag: "twilio-from", env: "TWILIO_FROM"},
+	"rules.mqtt_url":           {flag: "rules-mqtt-url", env: "RULES_MQTT_URL"},
+	"rules.allow_commands":     {flag: "rules-allow-commands", env: "RULES_ALLOW_COMMANDS"},
+
+	"frigate.mqtt_url":     {flag: "frigate-mqtt-url", env: "FRIGATE_MQTT_URL"},
+	"frigate.topic_prefix": {flag: "frigate-topic-prefix", env: "FRIGATE_TOPIC_PREFIX"},
+
+	"incidents.window":       {flag: "incident-window", env: "INCIDENT_WINDOW"},
+	"incidents.min_devices":  {flag: "incident-min-devices", env: "INCIDENT_MIN_DEVICES"},
+	"incidents.burst_events": {flag: "incident-burst-events", env: "INCIDENT_BURST_EVENTS"},
+
+	"mdns.enabled": {flag: "mdns", env: "MDNS"},
+	"mdns.name":    {flag: "mdns-name", env: "MDNS_NAME"},
+
+	"tracing.otlp_endpoint": {flag: "otlp-endpoint", env: "OTEL_EXPORTER_OTLP_ENDPOINT"},
+	"tracing.service_name":  {flag: "otlp-service-name", env: "OTEL_SERVICE_NAME"},
+
+	"prompts.mode_detection":       {def: DefaultPrompts().ModeDetection, reload: func(c *Config, v string) { c.Prompts.ModeDetection = v }},
+	"prompts.chat":                 {def: DefaultPrompts().Chat, reload: func(c *Config, v string) { c.Prompts.Chat = v }},
+	"prompts.trigger":              {def: DefaultPrompts().Trigger, reload: func(c *Config, v string) { c.Prompts.Trigger = v }},
+	"prompts.word_match":           {def: DefaultPrompts().WordMatch, reload: func(c *Config, v string) { c.Prompts.WordMatch = v }},
+	"prompts.model_selection":      {def: DefaultPrompts().ModelSelection, reload: func(c *Config, v string) { c.Prompts.ModelSelection = v }},
+	"prompts.headline":             {def: DefaultPrompts().Headline, reload: func(c *Config, v string) { c.Prompts.Headline = v }},
+	"prompts.incident":             {def: DefaultPrompts().Incident, reload: func(c *Config, v string) { c.Prompts.Incident = v }},
+	"prompts.pet_verification":     {def: DefaultPrompts().PetVerification, reload: func(c *Config, v string) { c.Prompts.PetVerification = v }},
+	"prompts.gesture_verification": {def: DefaultPrompts().GestureVerification, reload: func(c *Config, v string) { c.Prompts.GestureVerification = v }},
+	"prompts.verdict":              {def: DefaultPrompts().Verdict, reload: func(c *Config, v string) { c.Prompts.Verdict = v }},
+	"prompts.strict_guidance":      {def: DefaultPrompts().StrictGuidance, reload: func(c *Config, v string) { c.Prompts.StrictGuidance = v }},
+	"prompts.relaxed_guidance":     {def: DefaultPrompts().RelaxedGuidance, reload: func(c *Config, v string) { c.Prompts.RelaxedGuidance = v }},
+
+	"canary.devices":                     {reload: func(c *Config, v string) { c.Canary.Devices = parseDeviceList(v) }},
+	"canary.ollama_model":                {reload: func(c *Config, v string) { c.Canary.OllamaModel = v }},
+	"canary.llava_model":                 {reload: func(c *Config, v string) { c.Canary.LLaVAModel = v }},
+	"canary.prompt_mode_detection":       {reload: func(c *Config, v string) { c.Canary.Prompts.ModeDetection = v }},
+	"canary.prompt_chat":                 {reload: func(c *Config, v string) { c.Canary.Prompts.Chat = v }},
+	"canary.prompt_trigger":              {reload: func(c *Config, v string) { c.Canary.Prompts.Trigger = v }},
+	"canary.prompt_word_match":           {reload: func(c *Config, v string) { c.Canary.Prompts.WordMatch = v }},
+	"canary.prompt_model_selection":      {reload: func(c *Config, v string) { c.Canary.Prompts.ModelSelection = v }},
+	"canary.prompt_headline":             {reload: func(c *Config, v string) { c.Canary.Prompts.Headline = v }},
+	"canary.prompt_pet_verification":     {reload: func(c *Config, v string) { c.Canary.Prompts.PetVerification = v }},
+	"canary.prompt_gesture_verification": {reload: func(c *Config, v string) { c.Canary.Prompts.GestureVerification = v }},
+}
+
+// reloadInt parses a reloaded count setting; invalid values become -1 so Validate rejects the reload
+func reloadInt(v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// readConfigFile parses a YAML config file into flat "section.name" keys
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var sections map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	for section, settings := range sections {
+		for name, value := range settings {
+			key := section + "." + name
+			if _, ok := fileSettings[key]; !ok {
+				return nil, fmt.Errorf("unknown setting in config file %s: %s", path, key)
+			}
+			values[key] = fileValueString(value)
+		}
+	}
+	return values, nil
+}
+
+// fileValueString converts a parsed YAML value to the string form flags and reload funcs take
+// (lists become comma-separated)
+func fileValueString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// applyFileToFlags uses config file values as flag defaults, leaving explicitly set flags alone
+// (environment variables are applied afterwards and still take precedence)
+func applyFileToFlags(values map[string]string, explicit map[string]bool) error {
+	for key, value := range values {
+		setting := fileSettings[key]
+		if setting.flag == "" || explicit[setting.flag] {
+			continue
+		}
+		if err := flag.Set(setting.flag, value); err != nil {
+			return fmt.Errorf("invalid value for %s in config file: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// applyRuntimeSettings applies the reloadable settings from the file to c.
+// Settings pinned by a flag or environment variable are skipped, and reloadable
+// settings missing from the file revert to their defaults.
+func (c *Config) applyRuntimeSettings(values map[string]string) {
+	for key, setting := range fileSettings {
+		if setting.reload == nil || c.pinned(setting) {
+			continue
+		}
+
+		value, ok := values[key]
+		if !ok {
+			value = setting.def
+			if setting.flag != "" {
+				value = flag.Lookup(setting.flag).DefValue
+			}
+		}
+		setting.reload(c, value)
+	}
+}
+
+// pinned reports whether a setting was fixed by a command-line flag or environment variable
+func (c *Config) pinned(setting fileSetting) bool {
+	if setting.flag != "" && c.explicitFlags[setting.flag] {
+		return true
+	}
+	return setting.env != "" && os.Getenv(setting.env) != ""
+}
+
+// Reload re-reads the config file and returns a copy of c with the runtime-changeable
+// settings (AI backends, vision behavior, prompt templates, and canary overrides) updated. Other settings require a restart.
+func (c *Config) Reload() (*Config, error) {
+	if c.File == "" {
+		return nil, fmt.Errorf("no config file configured")
+	}
+
+	values, err := readConfigFile(c.File)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *c
+	next.applyRuntimeSettings(values)
+
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Watch reloads the config file on SIGHUP or when the file's modification time changes,
+// calling onReload with the new configuration. It returns immediately if no file is configured.
+func (c *Config) Watch(onReload func(*Config)) {
+	if c.File == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	current := c
+	supervisor.Go("config-watcher", func() error {
+		lastMod := modTime(c.File)
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hup:
+				log.Printf("Received SIGHUP, reloading %s", current.File)
+			case <-ticker.C:
+				mod := modTime(current.File)
+				if mod.Equal(lastMod) {
+					continue
+				}
+				lastMod = mod
+				log.Printf("Config file %s changed, reloading", current.File)
+			}
+
+			next, err := current.Reload()
+			if err != nil {
+				log.Printf("ERROR: Config reload failed, keeping current settings: %v", err)
+				continue
+			}
+			logReloadChanges(current, next)
+			current = next
+			onReload(next)
+		}
+	})
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// logReloadChanges logs which reloadable settings changed
+func logReloadChanges(old, next *Config) {
+	changed := []string{}
+	if !reflect.DeepEqual(old.AI, next.AI) {
+		changed = append(changed, "ai")
+	}
+	if old.Prompts != next.Prompts {
+		changed = append(changed, "prompts")
+	}
+	if !reflect.DeepEqual(old.Canary, next.Canary) {
+		changed = append(changed, "canary")
+	}
+	sort.Strings(changed)
+	if len(changed) == 0 {
+		log.Println("Config reloaded: no runtime settings changed")
+		return
+	}
+	log.Printf("Config reloaded: updated %v", changed)
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// profiles are named sets of defaults selected with -profile. They only replace the
+// built-in defaults: the config file, flags, and environment variables still override them.
+var profiles = map[string]map[string]string{
+	// lite runs the whole stack on a Raspberry Pi 5 serving a couple of Watchers: small
+	// CPU-friendly models, no LLaVA image analysis, one AI call per backend at a time,
+	// longer timeouts for CPU inference (no speculative chat answers), and long-lived caches
+	"lite": {
+		"ollama-model":          "llama3.2:1b",
+		"llava-model":           "moondream",
+		"vision-analysis":       "false",
+		"backend-concurrency":   "1",
+		"speculative-chat":      "false",
+		"backend-timeout":       "5m",
+		"response-cache-ttl":    "15m",
+		"vision-cache-ttl":      "10m",
+		"vision-cache-distance": "8",
+		"vision-min-change":     "5",
+	},
+}
+
+// applyProfile makes a profile's values the defaults of its flags. Flags set on the
+// command line keep their value.
+func applyProfile(name string, explicit map[string]bool) error {
+	values, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	for flagName, value := range values {
+		f := flag.Lookup(flagName)
+		if !explicit[flagName] {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("invalid value for %s in profile %s: %w", flagName, name, err)
+			}
+		}
+		// Settings missing from a reloaded config file revert to the profile's value
+		f.DefValue = value
+	}
+	return nil
+}
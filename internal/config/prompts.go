@@ -0,0 +1,117 @@
+package config
+
+// PromptsConfig holds the LLM prompt templates used by the voice pipeline
+// Each template is a fmt format string; the %s placeholders are documented per field.
+type PromptsConfig struct {
+	ModeDetection  string // %s = transcription
+	Chat           string // %s = transcription
+	Trigger        string // %s = transcription
+	WordMatch      string // %s = trigger condition, %s = comma-separated target keywords
+	ModelSelection string // %s = target object
+	Headline       string // %s = transcription
+	Incident       string // %s = timeline of an incident's alarms, one per line
+
+	// Image analyzer prompts of tasks on the pet and gesture models, which LLaVA verifies
+	// the device's detections against (person and cloud model tasks use the trigger as is)
+	PetVerification     string // %s = trigger condition, %s = target object
+	GestureVerification string // %s = trigger condition, %s = target object
+
+	// Verification of tasks with a sensitivity, which asks for a verdict with a confidence
+	// that the task's sensitivity sets the threshold of
+	Verdict         string // %s = the task's verification prompt, %s = the sensitivity's guidance
+	StrictGuidance  string // Guidance of strict tasks (no placeholders)
+	RelaxedGuidance string // Guidance of relaxed tasks (no placeholders)
+}
+
+// DefaultPrompts returns the built-in prompt templates (based on the official SenseCAP prompts)
+func DefaultPrompts() PromptsConfig {
+	return PromptsConfig{
+		ModeDetection: `Your name is "watcher" and you are a function selection assistant. You analyze the user's input in relation to the definition of the "Mode List" and then select the most appropriate function from the list.
+
+Mode List:
+- Mode 0 (CHAT): General conversation, questions, casual interaction
+- Mode 1 (TASK): User wants to set up a monitoring task or automation (e.g., "notify me when...", "alert me if...", "watch for...")
+- Mode 2 (TASK_AUTO): Automatic task execution (rarely used)
+
+User input: "%s"
+
+Respond with ONLY the mode number (0, 1, or 2). No explanation.`,
+
+		Chat: `Your name is watcher, and you're a chatbot that can have a nice chat with users based on their input. At the same time, you'll reject all answers to questions about terrorism, racism, yellow violence, political sensitivity, LGBT issues, etc.
+
+User said: "%s"
+
+Provide a brief, conversational response (1-2 sentences max).`,
+
+		Trigger: `Extract the trigger condition from this request. Remove time, place, intervals, and actions. Focus on what to detect.
+
+User input: "%s"
+
+CRITICAL: Respond with a simple phrase describing what to detect. No quotes. No punctuation at the end. Maximum 5 words.
+Example: "person enters room" or "cat on counter"`,
+
+		WordMatch: `You are the word matching assistant. Match the scenario to ONE keyword from the list.
+
+Scenario: "%s"
+
+Target Keywords: %s
+
+CRITICAL: Respond with ONLY ONE WORD from the list above. No explanation. No quotes. No punctuation.
+If the scenario mentions a human/man/woman/person, respond with: person
+Otherwise pick the most relevant keyword from the list.`,
+
+		ModelSelection: `Target object: "%s"
+
+The device has 3 built-in TinyML models:
+- Model 1: Person detection (person, human, people, man, woman)
+- Model 2: Pet detection (dog, cat, puppy, kitten, pet)
+- Model 3: Gesture detection (rock, paper, scissors, hand gesture)
+
+CRITICAL: Which model should be used? Respond with ONLY ONE NUMBER: 1, 2, 3, or 0
+- 1 if person/human related
+- 2 if dog/cat/pet related
+- 3 if rock/paper/scissors gesture
+- 0 if none match (will require cloud model download)
+
+Respond with ONLY the number. No explanation.`,
+
+		Headline: `Create a short headline summarizing this task.
+
+User input: "%s"
+
+CRITICAL: Respond with a short headline. Maximum 6 words. No quotes. No punctuation at the end.
+Example: "Watch for delivery person" or "Monitor front door activity"`,
+
+		Incident: `You are the assistant of a home monitoring system with several cameras. The alarms below were raised within minutes of each other, by different cameras or again and again by one, and are reviewed as one incident.
+
+Alarms, oldest first:
+%s
+
+Write what most likely happened as a short story of 2-4 sentences that names the cameras, then a timeline with one line per step: "HH:MM:SS - what happened". Only use facts from the alarms. No preamble, no markdown.`,
+
+		PetVerification: `A camera detected an animal and needs you to confirm this condition: "%s".
+
+Look for a %s. Check the kind of animal carefully: a cat, a dog, a person crouching, a stuffed toy, a bag or a cushion are easy to confuse at low resolution. If the animal is only partly visible, judge from what is visible.
+
+CRITICAL: Answer with ONLY "yes" if the condition is met or ONLY "no" if it is not. No explanation.`,
+
+		GestureVerification: `A camera detected a hand gesture and needs you to confirm this condition: "%s".
+
+The gesture is "%s". Hand gestures for this task:
+- rock: a closed fist
+- paper: an open hand with all fingers extended
+- scissors: only the index and middle fingers extended, spread apart
+
+Look only at the hands. A hand holding an object, a waving or moving hand, or a hand that is cut off or too small to see its fingers is not a gesture.
+
+CRITICAL: Answer with ONLY "yes" if a hand clearly shows the gesture or ONLY "no" if it does not. No explanation.`,
+
+		Verdict: `%s
+
+%sInstead of a plain yes or no, answer with YES or NO followed by how confident you are in that answer, from 0 to 100, for example "YES 85" or "NO 30". No explanation.`,
+
+		StrictGuidance: `Only answer YES when the condition is clearly and fully visible; when in doubt, answer NO.`,
+
+		RelaxedGuidance: `Answer YES when the condition is likely met, even if it is partly hidden, small or blurry.`,
+	}
+}
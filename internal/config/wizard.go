@@ -0,0 +1,317 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is loaded when no config file is given and written by the first-run wizard
+const DefaultConfigFile = "sensecap.yaml"
+
+// wizardProbeTimeout bounds each AI service probe during setup
+const wizardProbeTimeout = 3 * time.Second
+
+// setupDisabled keeps Load from running the setup wizard (see DisableSetup)
+var setupDisabled bool
+
+// DisableSetup keeps Load from running the first-run setup, for commands that only read the
+// configuration (backup, restore)
+func DisableSetup() {
+	setupDisabled = true
+}
+
+// defaultConfigPath is the config file used when none is given: DefaultConfigFile in the
+// working directory if it exists, or else next to the database, so a Docker volume holding the
+// database also keeps the file the setup writes
+func defaultConfigPath(dbPath string) string {
+	if _, err := os.Stat(DefaultConfigFile); err == nil {
+		return DefaultConfigFile
+	}
+	return filepath.Join(filepath.Dir(dbPath), DefaultConfigFile)
+}
+
+// firstRun reports whether neither a config file nor a database exists yet
+func firstRun(dbPath string) bool {
+	if _, err := os.Stat(defaultConfigPath(dbPath)); err == nil {
+		return false
+	}
+	_, err := os.Stat(dbPath)
+	return os.IsNotExist(err)
+}
+
+// tokenConfigured reports whether a device token is set by a flag or the environment
+func tokenConfigured(token, tokenFile string) bool {
+	return token != "" || tokenFile != "" || os.Getenv("AUTH_TOKEN") != "" || os.Getenv("AUTH_TOKEN_FILE") != ""
+}
+
+// interactive reports whether stdin is a terminal (setup is skipped under Docker, systemd, etc.)
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too (systemd's default stdin)
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
+
+// wizard asks the setup questions on a terminal
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints a question with its default and returns the answer (the default if left empty)
+func (w *wizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, _ := w.in.ReadString('\n')
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// confirm asks a yes/no question
+func (w *wizard) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(w.ask(question+" ("+hint+")", ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// RunWizard interactively picks a port and token, probes the AI services, offers to pull
+// missing Ollama models, and writes the answers to path as a config file.
+// It returns false if the user skipped setup.
+func RunWizard(path string) (bool, error) {
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	fmt.Fprintln(w.out)
+	fmt.Fprintln(w.out, "================================================================================")
+	fmt.Fprintln(w.out, "  SenseCAP Watcher Local Server - First Run Setup")
+	fmt.Fprintln(w.out, "================================================================================")
+	fmt.Fprintln(w.out)
+	if !w.confirm("Set up the server now?", true) {
+		fmt.Fprintln(w.out, "Skipping setup, starting with built-in defaults.")
+		return false, nil
+	}
+
+	values := map[string]map[string]interface{}{
+		"server": {},
+		"auth":   {},
+		"ai":     {},
+	}
+
+	// Server
+	port := w.ask("Server port", flagDefault("port"))
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return false, fmt.Errorf("invalid port: %s", port)
+	}
+	values["server"]["port"] = n
+
+	// Device token
+	token, err := generateToken()
+	if err != nil {
+		return false, err
+	}
+	values["auth"]["token"] = w.ask("Device auth token (Enter to use a generated one)", token)
+
+	// Audio service (Whisper and Piper)
+	audioURL := w.ask("Audio service URL (Whisper/Piper)", flagDefault("whisper-url"))
+	if err := probe(audioURL + "/health"); err != nil {
+		fmt.Fprintf(w.out, "  WARNING: audio service not reachable (%v); voice requests fail until it is started\n", err)
+	} else {
+		fmt.Fprintln(w.out, "  Audio service OK")
+	}
+	values["ai"]["whisper_url"] = audioURL
+	values["ai"]["piper_url"] = audioURL
+
+	// Ollama and its models
+	ollamaURL := w.ask("Ollama URL", flagDefault("ollama-url"))
+	values["ai"]["ollama_url"] = ollamaURL
+	values["ai"]["ollama_model"] = w.ask("Chat model", flagDefault("ollama-model"))
+	values["ai"]["llava_model"] = w.ask("Vision model", flagDefault("llava-model"))
+
+	installed, err := ollamaModels(ollamaURL)
+	if err != nil {
+		fmt.Fprintf(w.out, "  WARNING: Ollama not reachable (%v); pull the models once it is running\n", err)
+	} else {
+		fmt.Fprintln(w.out, "  Ollama OK")
+		for _, key := range []string{"ollama_model", "llava_model"} {
+			model := values["ai"][key].(string)
+			if installed[model] {
+				fmt.Fprintf(w.out, "  Model %s installed\n", model)
+				continue
+			}
+			if !w.confirm(fmt.Sprintf("Model %s is not installed. Pull it now?", model), true) {
+				continue
+			}
+			if err := pullOllamaModel(ollamaURL, model, w.out); err != nil {
+				fmt.Fprintf(w.out, "  WARNING: Failed to pull %s: %v\n", model, err)
+			}
+		}
+	}
+
+	if err := writeConfigFile(path, values); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintln(w.out)
+	fmt.Fprintf(w.out, "Configuration written to %s (run with -setup to start over)\n", path)
+	fmt.Fprintln(w.out)
+	return true, nil
+}
+
+// writeConfigFile writes the setup's answers as a config file
+func writeConfigFile(path string, values map[string]map[string]interface{}) error {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	header := "# Written by the first-run setup. See README.md for all settings.\n"
+	if err := os.WriteFile(path, append([]byte(header), data...), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// flagDefault returns a flag's current default (after any profile was applied)
+func flagDefault(name string) string {
+	return flag.Lookup(name).Value.String()
+}
+
+// generateToken returns a random 32-character hex token
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// probe issues a GET and treats any 2xx response as reachable
+func probe(url string) error {
+	client := &http.Client{Timeout: wizardProbeTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ollamaModels lists the models installed in Ollama, by both full name and untagged
+// name for ":latest" models
+func ollamaModels(ollamaURL string) (map[string]bool, error) {
+	client := &http.Client{Timeout: wizardProbeTimeout}
+	resp, err := client.Get(ollamaURL + "/api/tags")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("returned %d", resp.StatusCode)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+
+	installed := make(map[string]bool, len(tags.Models))
+	for _, m := range tags.Models {
+		installed[m.Name] = true
+		installed[strings.TrimSuffix(m.Name, ":latest")] = true
+	}
+	return installed, nil
+}
+
+// pullOllamaModel downloads a model, printing Ollama's progress updates
+func pullOllamaModel(ollamaURL, model string, out io.Writer) error {
+	body, err := json.Marshal(map[string]interface{}{"name": model, "stream": true})
+	if err != nil {
+		return err
+	}
+
+	// No timeout: large models take a while to download
+	resp, err := http.Post(ollamaURL+"/api/pull", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	// Progress arrives as one JSON object per line
+	scanner := bufio.NewScanner(resp.Body)
+	lastStatus := ""
+	lastPercent := -1
+	for scanner.Scan() {
+		var update struct {
+			Status    string `json:"status"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			continue
+		}
+		if update.Error != "" {
+			return fmt.Errorf("%s", update.Error)
+		}
+
+		percent := -1
+		if update.Total > 0 {
+			percent = int(update.Completed * 100 / update.Total / 10 * 10)
+		}
+		if update.Status != lastStatus || percent != lastPercent {
+			if percent >= 0 {
+				fmt.Fprintf(out, "  %s: %d%%\n", update.Status, percent)
+			} else {
+				fmt.Fprintf(out, "  %s\n", update.Status)
+			}
+			lastStatus, lastPercent = update.Status, percent
+		}
+	}
+	return scanner.Err()
+}
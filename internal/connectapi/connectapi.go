@@ -0,0 +1,174 @@
+// Package connectapi serves the management operations of proto/watcher/v1/management.proto
+// as unary Connect calls with the JSON codec, so callers can use Connect clients they generate
+// from the .proto file (with connect.WithProtoJSON()) instead of hand-rolled HTTP calls. It is
+// not a gRPC server: gRPC, gRPC-Web and the binary protobuf codec get 415, since they would
+// need the protobuf runtime, which the server does not depend on. No generated client ships
+// with the server.
+package connectapi
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/audit"
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+)
+
+// Path is the URL path prefix of the service, relative to the server's base path
+const Path = "/watcher.v1.ManagementService/"
+
+// maxRequestBytes caps a request message; management requests are small
+const maxRequestBytes = 1 << 20
+
+// Connect error codes used by the service and their HTTP status
+const (
+	CodeInvalidArgument  = "invalid_argument"
+	CodeNotFound         = "not_found"
+	CodePermissionDenied = "permission_denied"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+)
+
+var codeStatus = map[string]int{
+	CodeInvalidArgument:  http.StatusBadRequest,
+	CodeNotFound:         http.StatusNotFound,
+	CodePermissionDenied: http.StatusForbidden,
+	CodeUnauthenticated:  http.StatusUnauthorized,
+	CodeInternal:         http.StatusInternalServerError,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+}
+
+// Error is a Connect error, written as {"code": "...", "message": "..."}
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// errorf returns a Connect error with a message in the request's language
+func errorf(r *http.Request, code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: i18n.Sprintf(auth.Language(r), format, args...)}
+}
+
+// internalError logs err and returns an internal error; message is also the log message
+func internalError(r *http.Request, message string, err error) *Error {
+	log.Printf("ERROR: %s: %s: %v", r.URL.Path, message, err)
+	return errorf(r, CodeInternal, message)
+}
+
+// procedure is one unary RPC: whether it needs an admin account (the procedures that change
+// data, refused in read-only mode), and its implementation, which decodes the request message itself
+type procedure struct {
+	admin bool
+	call  func(r *http.Request, body []byte) (interface{}, *Error)
+}
+
+// unary adapts a typed RPC implementation to a procedure
+func unary[Req any](admin bool, fn func(r *http.Request, req *Req) (interface{}, *Error)) procedure {
+	return procedure{admin: admin, call: func(r *http.Request, body []byte) (interface{}, *Error) {
+		var req Req
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				return nil, errorf(r, CodeInvalidArgument, "invalid JSON")
+			}
+		}
+		return fn(r, &req)
+	}}
+}
+
+var procedures = map[string]procedure{
+	"ListDevices":          unary(false, listDevices),
+	"RegisterDevice":       unary(true, registerDevice),
+	"UnregisterDevice":     unary(true, unregisterDevice),
+	"ListTasks":            unary(false, listTasks),
+	"GetTask":              unary(false, getTask),
+	"ResumeTask":           unary(true, resumeTask),
+	"SetTaskCooldown":      unary(true, setTaskCooldown),
+	"SetTaskDedup":         unary(true, setTaskDedup),
+	"SetTaskContextFrames": unary(true, setTaskContextFrames),
+	"ListTaskEvents":       unary(false, listTaskEvents),
+	"GetTaskStats":         unary(false, getTaskStats),
+}
+
+// Handler serves the service's procedures under Path
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	proc, ok := procedures[name]
+	if !ok || !strings.HasSuffix(r.URL.Path, Path+name) {
+		writeError(w, errorf(r, CodeNotFound, "unknown procedure"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Connect answers unsupported codecs with a plain 415 so clients can report it
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		w.Header().Set("Accept-Post", "application/json")
+		http.Error(w, "only the JSON codec is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	user, err := auth.Authenticate(r)
+	if err != nil {
+		log.Printf("ERROR: Failed to authenticate request: %v", err)
+		writeError(w, errorf(r, CodeInternal, "authentication failed"))
+		return
+	}
+	if user == nil {
+		log.Printf("WARNING: Unauthenticated management API request: %s %s", r.Method, r.URL.Path)
+		writeError(w, errorf(r, CodeUnauthenticated, "login required"))
+		return
+	}
+	r = auth.WithUser(r, user)
+	if proc.admin && user.Role != database.RoleAdmin {
+		writeError(w, errorf(r, CodePermissionDenied, "admin role required"))
+		return
+	}
+	if proc.admin && database.ReadOnly() {
+		writeError(w, errorf(r, CodeUnavailable, "server is in read-only mode"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		writeError(w, errorf(r, CodeInvalidArgument, "invalid JSON"))
+		return
+	}
+
+	resp, connectErr := proc.call(r, body)
+	if connectErr != nil {
+		writeError(w, connectErr)
+		return
+	}
+	if proc.admin {
+		audit.Record(audit.FromRequest(r, "POST "+Path+name, body))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeError writes a Connect error response
+func writeError(w http.ResponseWriter, e *Error) {
+	status, ok := codeStatus[e.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,161 @@
+package connectapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+)
+
+// Messages of management.proto in their protobuf JSON form: lowerCamelCase field names,
+// RFC 3339 UTC timestamps, and durations such as "3600s". Fields are never omitted, which
+// protobuf JSON parsers accept.
+
+type device struct {
+	EUI       string    `json:"eui"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type task struct {
+	ID               int       `json:"id"`
+	DeviceEUI        string    `json:"deviceEui"`
+	Name             string    `json:"name"`
+	Headline         string    `json:"headline"`
+	TriggerCondition string    `json:"triggerCondition"`
+	TargetObjects    []string  `json:"targetObjects"`
+	Actions          []string  `json:"actions"`
+	ModelType        int       `json:"modelType"`
+	Paused           bool      `json:"paused"`
+	PauseReason      string    `json:"pauseReason"`
+	ErrorCount       int       `json:"errorCount"`
+	ContextFrames    bool      `json:"contextFrames"`
+	Draft            bool      `json:"draft"`
+	CooldownSeconds  int       `json:"cooldownSeconds"`
+	DedupSeconds     int       `json:"dedupSeconds"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+type event struct {
+	ID                int       `json:"id"`
+	RequestID         string    `json:"requestId"`
+	DeviceEUI         string    `json:"deviceEui"`
+	Timestamp         int64     `json:"timestamp"`
+	Text              string    `json:"text"`
+	InferenceData     string    `json:"inferenceData"`
+	SensorData        string    `json:"sensorData"`
+	EventType         string    `json:"eventType"`
+	TLID              int       `json:"tlid"`
+	TaskHeadline      string    `json:"taskHeadline"`
+	TaskPrompt        string    `json:"taskPrompt"`
+	Suppressed        bool      `json:"suppressed"`
+	ImageURL          string    `json:"imageUrl"`
+	AnnotatedImageURL string    `json:"annotatedImageUrl"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+type eventBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+type taskStats struct {
+	TLID          int           `json:"tlid"`
+	Since         time.Time     `json:"since"`
+	Alarms        int           `json:"alarms"`
+	Suppressed    int           `json:"suppressed"`
+	Total         int           `json:"total"`
+	PerHour       float64       `json:"perHour"`
+	PerDay        float64       `json:"perDay"`
+	LastTriggerAt *time.Time    `json:"lastTriggerAt,omitempty"`
+	Hourly        []eventBucket `json:"hourly"`
+	Daily         []eventBucket `json:"daily"`
+}
+
+func deviceMessage(d *database.Device) device {
+	return device{EUI: d.EUI, Name: d.Name, CreatedAt: d.CreatedAt.UTC()}
+}
+
+func taskMessage(tf *database.TaskFlow) task {
+	return task{
+		ID:               tf.ID,
+		DeviceEUI:        tf.DeviceEUI,
+		Name:             tf.Name,
+		Headline:         tf.Headline,
+		TriggerCondition: tf.TriggerCondition,
+		TargetObjects:    nonNil(tf.TargetObjects),
+		Actions:          nonNil(tf.Actions),
+		ModelType:        tf.ModelType,
+		Paused:           tf.Paused,
+		PauseReason:      tf.PauseReason,
+		ErrorCount:       tf.ErrorCount,
+		ContextFrames:    tf.ContextFrames,
+		Draft:            tf.Draft,
+		CooldownSeconds:  tf.CooldownSeconds,
+		DedupSeconds:     tf.DedupSeconds,
+		CreatedAt:        tf.CreatedAt.UTC(),
+		UpdatedAt:        tf.UpdatedAt.UTC(),
+	}
+}
+
+func eventMessage(e *database.NotificationEvent) event {
+	msg := event{
+		ID:            e.ID,
+		RequestID:     e.RequestID,
+		DeviceEUI:     e.DeviceEUI,
+		Timestamp:     e.Timestamp,
+		Text:          e.Text,
+		InferenceData: e.InferenceData,
+		SensorData:    e.SensorData,
+		EventType:     e.EventType,
+		TLID:          e.TLID,
+		TaskHeadline:  e.TaskHeadline,
+		TaskPrompt:    e.TaskPrompt,
+		Suppressed:    e.Suppressed,
+		CreatedAt:     e.CreatedAt.UTC(),
+	}
+	if e.Img != "" {
+		msg.ImageURL = fmt.Sprintf("events/%d/image", e.ID)
+		if len(imaging.InferenceBoxes(e.InferenceData)) > 0 {
+			msg.AnnotatedImageURL = msg.ImageURL + "/annotated"
+		}
+	}
+	return msg
+}
+
+func taskStatsMessage(s *database.TaskEventStats) taskStats {
+	msg := taskStats{
+		TLID:       s.TLID,
+		Since:      s.Since.UTC(),
+		Alarms:     s.Alarms,
+		Suppressed: s.Suppressed,
+		Total:      s.Total,
+		PerHour:    s.PerHour,
+		PerDay:     s.PerDay,
+		Hourly:     buckets(s.Hourly),
+		Daily:      buckets(s.Daily),
+	}
+	if s.LastTriggerAt != nil {
+		last := s.LastTriggerAt.UTC()
+		msg.LastTriggerAt = &last
+	}
+	return msg
+}
+
+func buckets(in []database.EventBucket) []eventBucket {
+	out := make([]eventBucket, 0, len(in))
+	for _, b := range in {
+		out = append(out, eventBucket{Start: b.Start.UTC(), Count: b.Count})
+	}
+	return out
+}
+
+// nonNil keeps empty lists as [] rather than null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
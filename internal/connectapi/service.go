@@ -0,0 +1,245 @@
+package connectapi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// maxTaskStatsDays bounds GetTaskStats like GET /api/tasks/{id}/stats
+const maxTaskStatsDays = 90
+
+// duration is a google.protobuf.Duration in JSON ("3600s"); Go durations such as "24h" are accepted too
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func listDevices(r *http.Request, _ *struct{}) (interface{}, *Error) {
+	devices, err := database.GetDevices(auth.VisibleTo(r))
+	if err != nil {
+		return nil, internalError(r, "failed to retrieve devices", err)
+	}
+
+	msgs := make([]device, 0, len(devices))
+	for _, d := range devices {
+		msgs = append(msgs, deviceMessage(d))
+	}
+	return map[string]interface{}{"devices": msgs}, nil
+}
+
+func registerDevice(r *http.Request, req *struct {
+	EUI  string `json:"eui"`
+	Name string `json:"name"`
+}) (interface{}, *Error) {
+	d := &database.Device{EUI: strings.TrimSpace(req.EUI), Name: req.Name}
+	if _, err := hex.DecodeString(d.EUI); err != nil || len(d.EUI) != 16 {
+		return nil, errorf(r, CodeInvalidArgument, "eui must be 16 hex characters")
+	}
+
+	if err := database.RegisterDevice(d); err != nil {
+		return nil, internalError(r, "failed to register device", err)
+	}
+	log.Printf("Registered device: %s", d.EUI)
+	return map[string]interface{}{"device": deviceMessage(d)}, nil
+}
+
+func unregisterDevice(r *http.Request, req *struct {
+	EUI string `json:"eui"`
+}) (interface{}, *Error) {
+	removed, err := database.UnregisterDevice(req.EUI)
+	if err != nil {
+		return nil, internalError(r, "failed to unregister device", err)
+	}
+	if !removed {
+		return nil, errorf(r, CodeNotFound, "device not registered")
+	}
+	log.Printf("Unregistered device: %s", req.EUI)
+	return struct{}{}, nil
+}
+
+func listTasks(r *http.Request, req *struct {
+	DeviceEUI string `json:"deviceEui"`
+}) (interface{}, *Error) {
+	if req.DeviceEUI == "" {
+		return nil, errorf(r, CodeInvalidArgument, "deviceEui is required")
+	}
+	if !auth.CanSeeDevice(r, req.DeviceEUI) {
+		return nil, errorf(r, CodePermissionDenied, "device not assigned to this account")
+	}
+
+	tasks, err := database.GetTaskFlowsByDevice(req.DeviceEUI)
+	if err != nil {
+		return nil, internalError(r, "failed to retrieve tasks", err)
+	}
+
+	msgs := make([]task, 0, len(tasks))
+	for _, tf := range tasks {
+		msgs = append(msgs, taskMessage(tf))
+	}
+	return map[string]interface{}{"tasks": msgs}, nil
+}
+
+// visibleTask loads a task, returning not_found if it does not exist or belongs to a
+// device the account cannot see
+func visibleTask(r *http.Request, id int) (*database.TaskFlow, *Error) {
+	tf, err := database.GetTaskFlowByID(id)
+	if err != nil {
+		return nil, internalError(r, "failed to retrieve task", err)
+	}
+	if tf == nil || !auth.CanSeeDevice(r, tf.DeviceEUI) {
+		return nil, errorf(r, CodeNotFound, "task not found")
+	}
+	return tf, nil
+}
+
+func getTask(r *http.Request, req *struct {
+	ID int `json:"id"`
+}) (interface{}, *Error) {
+	tf, connectErr := visibleTask(r, req.ID)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	return map[string]interface{}{"task": taskMessage(tf)}, nil
+}
+
+func resumeTask(r *http.Request, req *struct {
+	ID int `json:"id"`
+}) (interface{}, *Error) {
+	if _, connectErr := visibleTask(r, req.ID); connectErr != nil {
+		return nil, connectErr
+	}
+	if err := database.ResumeTaskFlow(req.ID); err != nil {
+		return nil, internalError(r, "failed to resume task", err)
+	}
+	return struct{}{}, nil
+}
+
+func setTaskCooldown(r *http.Request, req *struct {
+	ID              int `json:"id"`
+	CooldownSeconds int `json:"cooldownSeconds"`
+}) (interface{}, *Error) {
+	if req.CooldownSeconds < 0 {
+		return nil, errorf(r, CodeInvalidArgument, "cooldownSeconds must be a non-negative integer")
+	}
+
+	found, err := database.SetTaskCooldown(req.ID, req.CooldownSeconds)
+	if err != nil {
+		return nil, internalError(r, "failed to update task", err)
+	}
+	if !found {
+		return nil, errorf(r, CodeNotFound, "task not found")
+	}
+	log.Printf("Task %d cooldown set to %ds", req.ID, req.CooldownSeconds)
+	return struct{}{}, nil
+}
+
+func setTaskDedup(r *http.Request, req *struct {
+	ID           int `json:"id"`
+	DedupSeconds int `json:"dedupSeconds"`
+}) (interface{}, *Error) {
+	if req.DedupSeconds < 0 {
+		return nil, errorf(r, CodeInvalidArgument, "dedupSeconds must be a non-negative integer")
+	}
+
+	found, err := database.SetTaskDedup(req.ID, req.DedupSeconds)
+	if err != nil {
+		return nil, internalError(r, "failed to update task", err)
+	}
+	if !found {
+		return nil, errorf(r, CodeNotFound, "task not found")
+	}
+	log.Printf("Task %d dedup window set to %ds", req.ID, req.DedupSeconds)
+	return struct{}{}, nil
+}
+
+func setTaskContextFrames(r *http.Request, req *struct {
+	ID      int  `json:"id"`
+	Enabled bool `json:"enabled"`
+}) (interface{}, *Error) {
+	found, err := database.SetTaskContextFrames(req.ID, req.Enabled)
+	if err != nil {
+		return nil, internalError(r, "failed to update task", err)
+	}
+	if !found {
+		return nil, errorf(r, CodeNotFound, "task not found")
+	}
+	return struct{}{}, nil
+}
+
+func listTaskEvents(r *http.Request, req *struct {
+	TaskID int       `json:"taskId"`
+	Since  *duration `json:"since"`
+	Limit  int       `json:"limit"`
+}) (interface{}, *Error) {
+	window := 24 * time.Hour
+	if req.Since != nil {
+		window = time.Duration(*req.Since)
+	}
+	if window <= 0 {
+		return nil, errorf(r, CodeInvalidArgument, "since must be a positive duration, e.g. 24h")
+	}
+	if req.Limit < 0 {
+		return nil, errorf(r, CodeInvalidArgument, "limit must be a positive integer")
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 50
+	}
+
+	tf, connectErr := visibleTask(r, req.TaskID)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	events, err := database.GetNotificationEventsByTask(tf.ID, time.Now().Add(-window), limit)
+	if err != nil {
+		return nil, internalError(r, "failed to retrieve events", err)
+	}
+
+	msgs := make([]event, 0, len(events))
+	for _, e := range events {
+		msgs = append(msgs, eventMessage(e))
+	}
+	return map[string]interface{}{"events": msgs}, nil
+}
+
+func getTaskStats(r *http.Request, req *struct {
+	TaskID int `json:"taskId"`
+	Days   int `json:"days"`
+}) (interface{}, *Error) {
+	days := req.Days
+	if days == 0 {
+		days = 7
+	}
+	if days < 0 || days > maxTaskStatsDays {
+		return nil, errorf(r, CodeInvalidArgument, "days must be between 1 and %d", maxTaskStatsDays)
+	}
+
+	tf, connectErr := visibleTask(r, req.TaskID)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	stats, err := database.GetTaskEventStats(tf, days)
+	if err != nil {
+		return nil, internalError(r, "failed to compute task stats", err)
+	}
+	return map[string]interface{}{"stats": taskStatsMessage(stats)}, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Statuses of an announcement
+const (
+	AnnouncementQueued    = "queued"
+	AnnouncementDelivered = "delivered"
+	AnnouncementExpired   = "expired" // Not picked up by the device before expires_at
+)
+
+// Announcement is a spoken message queued for a device, synthesized when queued and played
+// by the device when it picks it up
+type Announcement struct {
+	ID          int        `json:"id"`
+	DeviceEUI   string     `json:"device_eui"`
+	Text        string     `json:"text"`
+	Audio       []byte     `json:"-"` // WAV
+	AudioBytes  int        `json:"audio_bytes"`
+	Status      string     `json:"status"` // AnnouncementQueued, AnnouncementDelivered or AnnouncementExpired
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreateAnnouncement queues an announcement
+func CreateAnnouncement(a *Announcement) error {
+	query := `
+	INSERT INTO announcements (device_eui, text, audio, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query, a.DeviceEUI, a.Text, a.Audio, a.ExpiresAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert announcement: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	a.ID = int(id)
+	a.AudioBytes = len(a.Audio)
+	a.Status = AnnouncementQueued
+	a.CreatedAt = now
+	return nil
+}
+
+// NextAnnouncement returns a device's oldest queued announcement that has not expired,
+// with its audio, or nil if there is none
+func NextAnnouncement(deviceEUI string, now time.Time) (*Announcement, error) {
+	query := `
+	SELECT id, device_eui, text, audio, expires_at, created_at
+	FROM announcements
+	WHERE device_eui = ? AND delivered_at IS NULL AND expires_at > ?
+	ORDER BY id
+	LIMIT 1
+	`
+
+	var a Announcement
+	err := db.QueryRow(query, deviceEUI, now).Scan(&a.ID, &a.DeviceEUI, &a.Text, &a.Audio, &a.ExpiresAt, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next announcement: %w", err)
+	}
+	a.AudioBytes = len(a.Audio)
+	a.Status = AnnouncementQueued
+	return &a, nil
+}
+
+// MarkAnnouncementDelivered records that an announcement was sent to its device, reporting
+// false if it already was (by a concurrent request)
+func MarkAnnouncementDelivered(id int, at time.Time) (bool, error) {
+	result, err := db.Exec(`UPDATE announcements SET delivered_at = ? WHERE id = ? AND delivered_at IS NULL`, at, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark announcement %d delivered: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark announcement %d delivered: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// GetAnnouncements retrieves up to limit of a device's announcements, newest first, without audio
+func GetAnnouncements(deviceEUI string, limit int) ([]*Announcement, error) {
+	query := `
+	SELECT id, device_eui, text, length(audio), expires_at, delivered_at, created_at
+	FROM announcements
+	WHERE device_eui = ?
+	ORDER BY id DESC
+	LIMIT ?
+	`
+
+	rows, err := db.Query(query, deviceEUI, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query announcements: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	announcements := []*Announcement{}
+	for rows.Next() {
+		var a Announcement
+		var delivered sql.NullTime
+		if err := rows.Scan(&a.ID, &a.DeviceEUI, &a.Text, &a.AudioBytes, &a.ExpiresAt, &delivered, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan announcement: %w", err)
+		}
+		switch {
+		case delivered.Valid:
+			a.DeliveredAt = &delivered.Time
+			a.Status = AnnouncementDelivered
+		case !a.ExpiresAt.After(now):
+			a.Status = AnnouncementExpired
+		default:
+			a.Status = AnnouncementQueued
+		}
+		announcements = append(announcements, &a)
+	}
+	return announcements, rows.Err()
+}
+
+// DeleteAnnouncementsBefore removes announcements that expired before the given time,
+// delivered or not
+func DeleteAnnouncementsBefore(before time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM announcements WHERE expires_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete announcements: %w", err)
+	}
+	return result.RowsAffected()
+}
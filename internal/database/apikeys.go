@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// API key scopes
+const (
+	KeyScopeManagement = "management" // Management API, acting as the key's user
+	KeyScopeDevice     = "device"     // Device-facing endpoints (/v1, /v2), optionally bound to one device
+)
+
+// APIKey is a stored API key. Only a hash of the key is kept; the key itself is shown once at creation.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the key, to recognize it
+	Scope      string     `json:"scope"`
+	UserID     int        `json:"user_id,omitempty"`    // Management keys act as this user
+	DeviceEUI  string     `json:"device_eui,omitempty"` // Device keys bound to one device (empty = any device)
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"` // nil = never expires
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Active reports whether the key is neither revoked nor expired
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
+
+// CreateAPIKey stores a new key by its hash
+func CreateAPIKey(k *APIKey, keyHash string) error {
+	query := `
+	INSERT INTO api_keys (name, key_hash, prefix, scope, user_id, device_eui, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query, k.Name, keyHash, k.Prefix, k.Scope, k.UserID, k.DeviceEUI, now, k.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	k.ID = int(id)
+	k.CreatedAt = now
+	return nil
+}
+
+// GetAPIKeys returns all keys, including revoked and expired ones, newest first
+func GetAPIKeys() ([]*APIKey, error) {
+	rows, err := db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByID returns a key, or nil if it does not exist
+func GetAPIKeyByID(id int) (*APIKey, error) {
+	k, err := scanAPIKey(db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// GetActiveAPIKey returns the unrevoked, unexpired key with the given hash and scope, or nil
+func GetActiveAPIKey(keyHash, scope string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+	WHERE key_hash = ? AND scope = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+
+	k, err := scanAPIKey(db.QueryRow(query, keyHash, scope, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// CountActiveAPIKeys returns the number of unrevoked, unexpired keys with the given scope
+func CountActiveAPIKeys(scope string) (int, error) {
+	query := `SELECT COUNT(*) FROM api_keys WHERE scope = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+
+	var n int
+	if err := db.QueryRow(query, scope, time.Now()).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count API keys: %w", err)
+	}
+	return n, nil
+}
+
+// RevokeAPIKey revokes a key. Returns false if the key does not exist or is already revoked.
+func RevokeAPIKey(id int) (bool, error) {
+	result, err := db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetAPIKeyExpiry changes when a key expires
+func SetAPIKeyExpiry(id int, expiresAt time.Time) error {
+	if _, err := db.Exec(`UPDATE api_keys SET expires_at = ? WHERE id = ?`, expiresAt, id); err != nil {
+		return fmt.Errorf("failed to update API key expiry: %w", err)
+	}
+	return nil
+}
+
+// TouchAPIKey records that a key was used, at most once a minute to spare the database
+func TouchAPIKey(id int) error {
+	if readOnly {
+		return nil
+	}
+	now := time.Now()
+	query := `UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`
+	if _, err := db.Exec(query, now, id, now.Add(-time.Minute)); err != nil {
+		return fmt.Errorf("failed to update API key usage: %w", err)
+	}
+	return nil
+}
+
+// apiKeyColumns are the columns read by scanAPIKey
+const apiKeyColumns = `id, name, prefix, scope, user_id, device_eui, created_at, expires_at, revoked_at, last_used_at`
+
+// scanAPIKey scans one api_keys row
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scope, &k.UserID, &k.DeviceEUI, &k.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan API key: %w", err)
+	}
+
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	return &k, nil
+}
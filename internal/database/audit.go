@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sources of audit log entries
+const (
+	AuditSourceAPI   = "api"   // Management API (REST or Connect), as the request's account
+	AuditSourceCLI   = "cli"   // Server subcommands, as the user running them
+	AuditSourceVoice = "voice" // Voice interactions, as the device spoken to
+)
+
+// AuditEntry records a change to the server's configuration or tasks. Entries are never
+// updated or deleted (the table's triggers refuse it).
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Source     string    `json:"source"`                // AuditSourceAPI, AuditSourceCLI or AuditSourceVoice
+	Actor      string    `json:"actor"`                 // Account name ("token" for AUTH_TOKEN), user running the command, or device EUI
+	Action     string    `json:"action"`                // e.g. "PUT /api/tasks/{id}/alarm", "taskflows delete", "task activate"
+	Target     string    `json:"target"`                // What was changed, e.g. "/api/tasks/12/alarm" or "task 12"
+	Detail     string    `json:"detail,omitempty"`      // The request with secrets redacted, the command's arguments, or the task
+	RemoteAddr string    `json:"remote_addr,omitempty"` // Client address of API requests
+}
+
+// RecordAudit appends an entry to the audit log
+func RecordAudit(e *AuditEntry) error {
+	now := time.Now()
+	result, err := db.Exec(`
+	INSERT INTO audit_log (created_at, source, actor, action, target, detail, remote_addr)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, now, e.Source, e.Actor, e.Action, e.Target, e.Detail, e.RemoteAddr)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	e.ID = int(id)
+	e.CreatedAt = now
+	return nil
+}
+
+// AuditFilter selects audit log entries; empty fields match any entry
+type AuditFilter struct {
+	Since  time.Time
+	Source string
+	Actor  string
+	Limit  int // 0 = no limit
+}
+
+// GetAuditLog retrieves the audit log entries matching a filter, newest first
+func GetAuditLog(f AuditFilter) ([]*AuditEntry, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	query := `
+	SELECT id, created_at, source, actor, action, target, detail, remote_addr
+	FROM audit_log
+	WHERE created_at >= ? AND (? = '' OR source = ?) AND (? = '' OR actor = ?)
+	ORDER BY id DESC
+	LIMIT ?
+	`
+
+	rows, err := db.Query(query, f.Since, f.Source, f.Source, f.Actor, f.Actor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Source, &e.Actor, &e.Action, &e.Target, &e.Detail, &e.RemoteAddr); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	backupPages = 256                   // Pages copied per backup step
+	backupPause = 10 * time.Millisecond // Pause between steps, so a running server can write
+)
+
+// BackupFile copies the database at srcPath into a new database file at destPath with SQLite's
+// online backup API. The source is opened read-only and copied in steps; if a running server
+// writes to it in between, the copy restarts, so the result is always a consistent snapshot.
+func BackupFile(srcPath, destPath string) error {
+	src, err := sql.Open(driverName, "file:"+url.PathEscape(srcPath)+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer src.Close()
+	if err := src.Ping(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", srcPath, err)
+	}
+
+	conn, err := src.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(srcDriver interface{}) error {
+		backup, closeDest, err := startBackup(srcDriver, destPath)
+		if err != nil {
+			return err
+		}
+		defer closeDest()
+		for {
+			done, err := backup.Step(backupPages)
+			if err != nil {
+				backup.Close()
+				return fmt.Errorf("failed to back up database: %w", err)
+			}
+			if done {
+				break
+			}
+			time.Sleep(backupPause)
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("failed to finish backup: %w", err)
+		}
+		return nil
+	})
+}
+
+// onlineBackup is SQLite's online backup API, as each driver exposes it (driver_*.go)
+type onlineBackup interface {
+	Step(pages int) (done bool, err error) // Copies up to pages pages; done once all are copied
+	Finish() error
+	Close() error
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Retries of writes that still find the database locked after busyTimeout, e.g. behind a
+// long backfill or VACUUM
+const (
+	busyRetries = 3
+	busyBackoff = 100 * time.Millisecond // Doubled after each retry
+)
+
+// retryBusy runs fn, and runs it again while it fails because the database is locked. fn must
+// be safe to repeat: a single statement, or a transaction it rolls back on error.
+func retryBusy(fn func() error) error {
+	backoff := busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return err
+		}
+		log.Printf("WARNING: Database is locked, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// execRetry is db.Exec, retried while the database is locked. Used by the writes of device
+// posts, which would otherwise lose what the device sent.
+func execRetry(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := retryBusy(func() error {
+		var err error
+		result, err = db.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CustomClass is an object class added to the configured class list, e.g. a "chicken" class
+// detected by a model trained for it. Voice tasks can target it like the built-in classes;
+// its synonyms resolve to it, and its model decides what the device runs for the task.
+type CustomClass struct {
+	Name          string    `json:"name"`           // Lowercase class name, as the model reports it
+	Synonyms      []string  `json:"synonyms"`       // Other words that mean the class
+	ModelType     int       `json:"model_type"`     // 1-3 = a built-in model, 0 = the custom model below
+	ModelID       string    `json:"model_id"`       // Identifier of the custom model
+	ModelVersion  string    `json:"model_version"`  // Version of the custom model
+	ModelURL      string    `json:"model_url"`      // Where devices download the custom model
+	ModelSize     float64   `json:"model_size"`     // Size of the model file in KB
+	ModelChecksum string    `json:"model_checksum"` // MD5 of the model file
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+const customClassColumns = `name, synonyms, model_type, model_id, model_version, model_url, model_size, model_checksum, updated_at`
+
+// SaveCustomClass creates or replaces a custom class
+func SaveCustomClass(c *CustomClass) error {
+	query := `
+	INSERT INTO custom_classes (` + customClassColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		synonyms = excluded.synonyms, model_type = excluded.model_type, model_id = excluded.model_id,
+		model_version = excluded.model_version, model_url = excluded.model_url, model_size = excluded.model_size,
+		model_checksum = excluded.model_checksum, updated_at = excluded.updated_at
+	`
+
+	if c.Synonyms == nil {
+		c.Synonyms = []string{}
+	}
+	synonymsJSON, err := json.Marshal(c.Synonyms)
+	if err != nil {
+		return fmt.Errorf("failed to marshal synonyms: %w", err)
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(query, c.Name, string(synonymsJSON), c.ModelType, c.ModelID, c.ModelVersion, c.ModelURL, c.ModelSize, c.ModelChecksum, now); err != nil {
+		return fmt.Errorf("failed to save custom class: %w", err)
+	}
+	c.UpdatedAt = now
+	return nil
+}
+
+// DeleteCustomClass removes a custom class, reporting whether it existed
+func DeleteCustomClass(name string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM custom_classes WHERE name = ?`, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete custom class: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete custom class: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetCustomClasses retrieves all custom classes, by name
+func GetCustomClasses() ([]*CustomClass, error) {
+	rows, err := db.Query(`SELECT ` + customClassColumns + ` FROM custom_classes ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query custom classes: %w", err)
+	}
+	defer rows.Close()
+
+	classes := []*CustomClass{}
+	for rows.Next() {
+		c, err := scanCustomClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// GetCustomClass retrieves a custom class (nil if it does not exist)
+func GetCustomClass(name string) (*CustomClass, error) {
+	c, err := scanCustomClass(db.QueryRow(`SELECT `+customClassColumns+` FROM custom_classes WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func scanCustomClass(row interface{ Scan(...interface{}) error }) (*CustomClass, error) {
+	c := &CustomClass{}
+	var synonymsJSON string
+	if err := row.Scan(&c.Name, &synonymsJSON, &c.ModelType, &c.ModelID, &c.ModelVersion, &c.ModelURL, &c.ModelSize, &c.ModelChecksum, &c.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan custom class: %w", err)
+	}
+	if err := json.Unmarshal([]byte(synonymsJSON), &c.Synonyms); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal synonyms of class %s: %w", c.Name, err)
+	}
+	return c, nil
+}
@@ -6,26 +6,65 @@ import (
 	"fmt"
 	"log"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var db *sql.DB
 
 // TaskFlow represents a task automation configuration
 type TaskFlow struct {
-	ID               int       `json:"id"`
-	DeviceEUI        string    `json:"device_eui"`
-	Name             string    `json:"name"`
-	Headline         string    `json:"headline"`
-	TriggerCondition string    `json:"trigger_condition"`
-	TargetObjects    []string  `json:"target_objects"`
-	Actions          []string  `json:"actions"`
-	ModelType        int       `json:"model_type"` // 0=cloud, 1=person, 2=pet, 3=gesture
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID                  int             `json:"id"`
+	DeviceEUI           string          `json:"device_eui"`
+	Name                string          `json:"name"`
+	Headline            string          `json:"headline"`
+	TriggerCondition    string          `json:"trigger_condition"`
+	TargetObjects       []string        `json:"target_objects"`
+	Actions             []string        `json:"actions"`
+	ModelType           int             `json:"model_type"` // 0=cloud, 1=person, 2=pet, 3=gesture
+	Paused              bool            `json:"paused"`     // Paused tasks are not served to the device
+	PauseReason         string          `json:"pause_reason,omitempty"`
+	ErrorCount          int             `json:"error_count"`               // Consecutive module errors reported by the device
+	ContextFrames       bool            `json:"context_frames"`            // Alarm events get the frames before and after the triggering frame
+	Draft               bool            `json:"draft"`                     // Waiting for the user to confirm; not served to the device
+	Version             int             `json:"version"`                   // Order of the device's committed tasks, set when the task replaces the others (0 = not committed, never served)
+	CooldownSeconds     int             `json:"cooldown_seconds"`          // Server-side cooldown between actioned alarms (0 = none)
+	DedupSeconds        int             `json:"dedup_seconds"`             // Alarms repeating the device's last alarm classes within this are dropped (0 = none)
+	Conditions          *TaskConditions `json:"conditions,omitempty"`      // Count, appear/disappear and schedule of the detection (nil = the object appears, any time)
+	AlarmURL            string          `json:"alarm_url,omitempty"`       // Server the device posts the task's alarms to (empty = the notification proxy it is bound to)
+	AlarmToken          string          `json:"-"`                         // Authorization token sent with those alarms
+	AlarmSilenceSeconds int             `json:"alarm_silence_seconds"`     // Seconds the device waits between alarm notifications (0 = the default)
+	VisionProvider      string          `json:"vision_provider,omitempty"` // Vision provider analyzing the task's images (empty = the device's)
+	Sensitivity         string          `json:"sensitivity,omitempty"`     // How sure the vision model must be that the trigger is met: strict, normal or relaxed (empty = a plain yes/no)
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+}
+
+// TaskConditions are the detection conditions of a task beyond its target object, parsed from
+// the voice request and sent to the device as its AI camera condition and silent period
+type TaskConditions struct {
+	Mode            string `json:"mode"`                       // TaskAppear, TaskDisappear, TaskCount or TaskCountChange
+	Compare         string `json:"compare,omitempty"`          // TaskCount: CompareGreater, CompareLess or CompareEqual
+	Num             int    `json:"num,omitempty"`              // TaskCount: the number of objects compared against
+	Days            []int  `json:"days,omitempty"`             // Weekdays the task runs, 0 = Sunday (empty = every day)
+	From            string `json:"from,omitempty"`             // Start of the daily active window, "HH:MM" (empty = all day)
+	Until           string `json:"until,omitempty"`            // End of the window; before From when it spans midnight
+	IntervalSeconds int    `json:"interval_seconds,omitempty"` // Minimum time between detections (0 = the default)
 }
 
+// Detection modes of TaskConditions
+const (
+	TaskAppear      = "appear"       // The object is seen
+	TaskDisappear   = "disappear"    // The object is no longer seen
+	TaskCount       = "count"        // The number of objects seen compares with Num
+	TaskCountChange = "count_change" // The number of objects seen changes
+)
+
+// Comparisons of TaskCount conditions
+const (
+	CompareGreater = "gt"
+	CompareLess    = "lt"
+	CompareEqual   = "eq"
+)
+
 // NotificationEvent represents an alarm/notification event
 type NotificationEvent struct {
 	ID            int       `json:"id"`
@@ -36,16 +75,45 @@ type NotificationEvent struct {
 	Img           string    `json:"img"`
 	InferenceData string    `json:"inference_data"`
 	SensorData    string    `json:"sensor_data"`
+	EventType     string    `json:"event_type"`     // EventAlarm, EventSensor, EventTelemetry, EventInteraction, or EventThreshold
+	SchemaVersion int       `json:"schema_version"` // Format of the stored JSON blobs (see EventSchemaVersion)
+	TLID          int       `json:"tlid"`           // Task flow the event belongs to (0 = none)
+	TaskHeadline  string    `json:"task_headline"`  // Headline of that task when the event arrived, kept if the task is edited or deleted
+	TaskPrompt    string    `json:"task_prompt"`    // Condition the task verified frames against (its trigger condition) when the event arrived
+	Suppressed    bool      `json:"suppressed"`     // Alarm arrived during its task's cooldown: stored but not actioned
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// UnknownEndpoint aggregates catch-all 404 hits for one path/method/device combination
+type UnknownEndpoint struct {
+	ID          int       `json:"id"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	DeviceEUI   string    `json:"device_eui"`
+	HitCount    int       `json:"hit_count"`
+	LastQuery   string    `json:"last_query"`
+	LastBody    string    `json:"last_body"` // First 1KB of the most recent request body
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Connection settings of the database. In WAL mode readers do not block the writer (device
+// posts, the API and background jobs run concurrently); writers wait up to busyTimeout for
+// each other, and transactions take the write lock when they begin so they cannot deadlock.
+const (
+	busyTimeout  = 5 * time.Second
+	maxOpenConns = 8 // SQLite has one writer; more connections only add readers
+)
+
 // Initialize opens the database connection and creates tables
 func Initialize(dbPath string) error {
 	var err error
-	db, err = sql.Open("sqlite3", dbPath)
+	db, err = sql.Open(driverName, readWriteDSN(dbPath))
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns) // Keep them: every new connection sets up its pragmas again
 
 	// Test connection
 	if err := db.Ping(); err != nil {
@@ -57,13 +125,17 @@ func Initialize(dbPath string) error {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	log.Printf("Database initialized: %s", dbPath)
+	// Move the migrations into the database file, so a copy of it alone is up to date with them
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		log.Printf("WARNING: Failed to checkpoint the database: %v", err)
+	}
+
+	log.Printf("Database initialized: %s (%s)", dbPath, Driver)
 	return nil
 }
 
-// createTables creates the database schema
-func createTables() error {
-	schema := `
+// schema is the current database schema; createTables also migrates older databases to it
+const schema = `
 	CREATE TABLE IF NOT EXISTS task_flows (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		device_eui TEXT NOT NULL,
@@ -73,6 +145,20 @@ func createTables() error {
 		target_objects TEXT NOT NULL,
 		actions TEXT NOT NULL,
 		model_type INTEGER DEFAULT 1,
+		paused INTEGER NOT NULL DEFAULT 0,
+		pause_reason TEXT NOT NULL DEFAULT '',
+		error_count INTEGER NOT NULL DEFAULT 0,
+		context_frames INTEGER NOT NULL DEFAULT 0,
+		draft INTEGER NOT NULL DEFAULT 0,
+		cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+		dedup_seconds INTEGER NOT NULL DEFAULT 0,
+		conditions TEXT NOT NULL DEFAULT '',
+		alarm_url TEXT NOT NULL DEFAULT '',
+		alarm_token TEXT NOT NULL DEFAULT '',
+		alarm_silence_seconds INTEGER NOT NULL DEFAULT 0,
+		vision_provider TEXT NOT NULL DEFAULT '',
+		sensitivity TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 0,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
@@ -86,27 +172,399 @@ func createTables() error {
 		img TEXT,
 		inference_data TEXT,
 		sensor_data TEXT,
+		event_type TEXT NOT NULL DEFAULT '',
+		schema_version INTEGER NOT NULL DEFAULT 0,
+		tlid INTEGER NOT NULL DEFAULT 0,
+		task_headline TEXT NOT NULL DEFAULT '',
+		task_prompt TEXT NOT NULL DEFAULT '',
+		suppressed INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS unknown_endpoints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		device_eui TEXT NOT NULL DEFAULT '',
+		hit_count INTEGER NOT NULL DEFAULT 0,
+		last_query TEXT,
+		last_body TEXT,
+		first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(method, path, device_eui)
+	);
+
+	CREATE TABLE IF NOT EXISTS task_deployments (
+		task_id INTEGER PRIMARY KEY,
+		device_eui TEXT NOT NULL,
+		deployed_at TIMESTAMP NOT NULL,
+		delivered_at TIMESTAMP,
+		acked_at TIMESTAMP,
+		alerted_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS device_task_status (
+		device_eui TEXT PRIMARY KEY,
+		tlid INTEGER NOT NULL,
+		status INTEGER NOT NULL,
+		module TEXT NOT NULL DEFAULT '',
+		module_err_code INTEGER NOT NULL DEFAULT 0,
+		reported_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS inference_metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		latency_ms INTEGER NOT NULL,
+		detected INTEGER NOT NULL DEFAULT 0,
+		false_positive INTEGER NOT NULL DEFAULT 0,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS firmware_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		component TEXT NOT NULL,
+		version TEXT NOT NULL,
+		blob_key TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		md5 TEXT NOT NULL,
+		notes TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(component, version)
+	);
+
+	CREATE TABLE IF NOT EXISTS firmware_manifests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL DEFAULT '',
+		component TEXT NOT NULL,
+		version TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(device_eui, component)
+	);
+
+	CREATE TABLE IF NOT EXISTS audio_responses (
+		device_eui TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		body_sha256 TEXT NOT NULL DEFAULT '',
+		response BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (device_eui, session_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS voice_interactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL,
+		session_id TEXT NOT NULL DEFAULT '',
+		transcription TEXT NOT NULL,
+		mode INTEGER NOT NULL,
+		response_text TEXT NOT NULL,
+		input_audio_key TEXT NOT NULL DEFAULT '',
+		reply_audio_key TEXT NOT NULL DEFAULT '',
+		stt_ms INTEGER NOT NULL DEFAULT 0,
+		mode_ms INTEGER NOT NULL DEFAULT 0,
+		llm_ms INTEGER NOT NULL DEFAULT 0,
+		tts_ms INTEGER NOT NULL DEFAULT 0,
+		write_ms INTEGER NOT NULL DEFAULT 0,
+		total_ms INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS device_vision_settings (
+		device_eui TEXT PRIMARY KEY,
+		default_prompt TEXT,
+		recognize_max_chars INTEGER,
+		store_recognize INTEGER,
+		privacy TEXT,
+		provider TEXT,
+		updated_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS sensor_readings (
+		device_eui TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		value REAL NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS event_frames (
+		event_id INTEGER NOT NULL,
+		position TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		img TEXT NOT NULL,
+		PRIMARY KEY (event_id, position)
+	);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL,
+		language TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS user_devices (
+		user_id INTEGER NOT NULL,
+		device_eui TEXT NOT NULL,
+		PRIMARY KEY (user_id, device_eui)
+	);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		scope TEXT NOT NULL,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		device_eui TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		last_used_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS devices (
+		device_eui TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS device_uploads (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		filename TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL,
+		blob_key TEXT NOT NULL,
+		event_id INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS event_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		device_eui TEXT NOT NULL DEFAULT '',
+		class TEXT NOT NULL DEFAULT '',
+		event_type TEXT NOT NULL DEFAULT '',
+		hours TEXT NOT NULL DEFAULT '',
+		min_confidence INTEGER NOT NULL DEFAULT 0,
+		sensor TEXT NOT NULL DEFAULT '',
+		sensor_above REAL,
+		sensor_below REAL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL,
+		image TEXT NOT NULL DEFAULT 'link',
+		cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		last_fired_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS sensor_thresholds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		above REAL,
+		below REAL,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		breached INTEGER NOT NULL DEFAULT 0,
+		changed_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS custom_classes (
+		name TEXT PRIMARY KEY,
+		synonyms TEXT NOT NULL DEFAULT '[]',
+		model_type INTEGER NOT NULL DEFAULT 0,
+		model_id TEXT NOT NULL DEFAULT '',
+		model_version TEXT NOT NULL DEFAULT '',
+		model_url TEXT NOT NULL DEFAULT '',
+		model_size REAL NOT NULL DEFAULT 0,
+		model_checksum TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS announcements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_eui TEXT NOT NULL,
+		text TEXT NOT NULL,
+		audio BLOB NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		delivered_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS incidents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		status TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		ended_at TIMESTAMP NOT NULL,
+		devices TEXT NOT NULL,
+		event_count INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		narrative TEXT NOT NULL DEFAULT '',
+		narrative_error TEXT NOT NULL DEFAULT '',
+		summarized_at TIMESTAMP,
+		kind TEXT NOT NULL DEFAULT 'devices',
+		image_event_id INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS incident_events (
+		incident_id INTEGER NOT NULL,
+		event_id INTEGER NOT NULL,
+		PRIMARY KEY (incident_id, event_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP NOT NULL,
+		source TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT '',
+		remote_addr TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;
+
 	CREATE INDEX IF NOT EXISTS idx_task_flows_device ON task_flows(device_eui);
 	CREATE INDEX IF NOT EXISTS idx_events_device ON notification_events(device_eui);
 	CREATE INDEX IF NOT EXISTS idx_events_timestamp ON notification_events(timestamp);
-	`
+	CREATE INDEX IF NOT EXISTS idx_inference_metrics_created ON inference_metrics(created_at);
+	CREATE INDEX IF NOT EXISTS idx_voice_interactions_created ON voice_interactions(created_at);
+	CREATE INDEX IF NOT EXISTS idx_sensor_readings_device_metric_ts ON sensor_readings(device_eui, metric, ts);
+	CREATE INDEX IF NOT EXISTS idx_device_uploads_created ON device_uploads(created_at);
+	CREATE INDEX IF NOT EXISTS idx_announcements_device ON announcements(device_eui, delivered_at);
+	CREATE INDEX IF NOT EXISTS idx_incidents_started ON incidents(started_at);
+	CREATE INDEX IF NOT EXISTS idx_sensor_thresholds_device ON sensor_thresholds(device_eui);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+`
 
-	_, err := db.Exec(schema)
+// createTables creates the database schema
+func createTables() error {
+	// Readings of events stored before the sensor_readings table existed are backfilled once
+	var sensorTables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sensor_readings'`).Scan(&sensorTables); err != nil {
+		return err
+	}
+
+	// Databases written by the old root package have task flows without model types
+	legacy, err := legacySchema()
 	if err != nil {
 		return err
 	}
 
-	// Migration: Add model_type column to existing task_flows table if it doesn't exist
-	migrationSQL := `
-	ALTER TABLE task_flows ADD COLUMN model_type INTEGER DEFAULT 1;
-	`
-	// This will fail if column already exists, which is fine - ignore the error
-	db.Exec(migrationSQL)
+	_, err = db.Exec(schema)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	// Migration: Add model_type column to task_flows tables of the old root package. It is left
+	// NULL rather than defaulting to person detection, for GetLegacyTaskFlows to backfill.
+	if legacy {
+		log.Printf("Migrating database of the old root package: task model types are backfilled from their target objects")
+		if _, err := db.Exec(`ALTER TABLE task_flows ADD COLUMN model_type INTEGER;`); err != nil {
+			return fmt.Errorf("failed to add model_type to task_flows: %w", err)
+		}
+	}
+
+	// Migration: Add task pause tracking columns (one statement each so every column gets a chance)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN paused INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN pause_reason TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN error_count INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN context_frames INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN draft INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN cooldown_seconds INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN dedup_seconds INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN conditions TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN alarm_url TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN alarm_token TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN alarm_silence_seconds INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN vision_provider TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN sensitivity TEXT NOT NULL DEFAULT '';`)
+
+	// Migration: Task versions (confirmed tasks from before get their ID, which keeps their order)
+	db.Exec(`ALTER TABLE task_flows ADD COLUMN version INTEGER NOT NULL DEFAULT 0;`)
+	if _, err := db.Exec(`UPDATE task_flows SET version = id WHERE version = 0 AND draft = 0`); err != nil {
+		return fmt.Errorf("failed to version task flows: %w", err)
+	}
+
+	// Migration: Event taxonomy and blob schema version (existing rows stay at version 0 and are upgraded on read)
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN event_type TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN schema_version INTEGER NOT NULL DEFAULT 0;`)
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_type ON notification_events(event_type);`); err != nil {
+		return err
+	}
+
+	// Migration: Link events to the task flow that generated them
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN tlid INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN suppressed INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN task_headline TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE notification_events ADD COLUMN task_prompt TEXT NOT NULL DEFAULT '';`)
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_tlid ON notification_events(tlid, created_at);`); err != nil {
+		return err
+	}
+
+	// Migration: Per-user language of API messages and the dashboard
+	db.Exec(`ALTER TABLE users ADD COLUMN language TEXT NOT NULL DEFAULT '';`)
+
+	// Migration: Per-device privacy mode
+	db.Exec(`ALTER TABLE device_vision_settings ADD COLUMN privacy TEXT;`)
+	db.Exec(`ALTER TABLE device_vision_settings ADD COLUMN provider TEXT;`)
+
+	// Migration: What an event rule's webhook sends of the event image
+	db.Exec(`ALTER TABLE event_rules ADD COLUMN image TEXT NOT NULL DEFAULT 'link';`)
+
+	// Migration: Latency of each stage of the voice pipeline
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN stt_ms INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN llm_ms INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN tts_ms INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN total_ms INTEGER NOT NULL DEFAULT 0;`)
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_voice_interactions_session ON voice_interactions(session_id);`); err != nil {
+		return err
+	}
+
+	// Migration: Mode detection and response write timing of voice interactions
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN mode_ms INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE voice_interactions ADD COLUMN write_ms INTEGER NOT NULL DEFAULT 0;`)
+
+	// Migration: Event rule conditions on detection confidence and sensor readings
+	db.Exec(`ALTER TABLE event_rules ADD COLUMN min_confidence INTEGER NOT NULL DEFAULT 0;`)
+	db.Exec(`ALTER TABLE event_rules ADD COLUMN sensor TEXT NOT NULL DEFAULT '';`)
+	db.Exec(`ALTER TABLE event_rules ADD COLUMN sensor_above REAL;`)
+	db.Exec(`ALTER TABLE event_rules ADD COLUMN sensor_below REAL;`)
+
+	// Migration: Incidents of one device's burst of alarms, and the image shown for an incident
+	db.Exec(`ALTER TABLE incidents ADD COLUMN kind TEXT NOT NULL DEFAULT 'devices';`)
+	db.Exec(`ALTER TABLE incidents ADD COLUMN image_event_id INTEGER NOT NULL DEFAULT 0;`)
+
+	// Migration: Stored voice responses are only replayed for the same recording
+	db.Exec(`ALTER TABLE audio_responses ADD COLUMN body_sha256 TEXT NOT NULL DEFAULT '';`)
+
+	if sensorTables == 0 {
+		if err := backfillSensorReadings(); err != nil {
+			log.Printf("WARNING: Failed to backfill sensor readings: %v", err)
+		}
+	}
+
+	return createSearchIndex()
 }
 
 // Close closes the database connection
@@ -117,7 +575,9 @@ func Close() error {
 	return nil
 }
 
-// SaveTaskFlow saves a task flow to the database
+// SaveTaskFlow saves a task flow to the database. Drafts are stored without replacing the
+// device's current task and are not deployed until ActivateTaskFlow; other tasks replace the
+// device's tasks in the same transaction they are inserted in.
 func SaveTaskFlow(taskFlow *TaskFlow) error {
 	// Convert target objects and actions to JSON
 	targetObjectsJSON, err := json.Marshal(taskFlow.TargetObjects)
@@ -130,13 +590,28 @@ func SaveTaskFlow(taskFlow *TaskFlow) error {
 		return fmt.Errorf("failed to marshal actions: %w", err)
 	}
 
+	conditionsJSON := ""
+	if taskFlow.Conditions != nil {
+		b, err := json.Marshal(taskFlow.Conditions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal conditions: %w", err)
+		}
+		conditionsJSON = string(b)
+	}
+
 	query := `
-	INSERT INTO task_flows (device_eui, name, headline, trigger_condition, target_objects, actions, model_type, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO task_flows (device_eui, name, headline, trigger_condition, target_objects, actions, model_type, context_frames, draft, cooldown_seconds, dedup_seconds, conditions, alarm_url, alarm_token, alarm_silence_seconds, vision_provider, sensitivity, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	result, err := db.Exec(query,
+	result, err := tx.Exec(query,
 		taskFlow.DeviceEUI,
 		taskFlow.Name,
 		taskFlow.Headline,
@@ -144,6 +619,16 @@ func SaveTaskFlow(taskFlow *TaskFlow) error {
 		string(targetObjectsJSON),
 		string(actionsJSON),
 		taskFlow.ModelType,
+		taskFlow.ContextFrames,
+		taskFlow.Draft,
+		taskFlow.CooldownSeconds,
+		taskFlow.DedupSeconds,
+		conditionsJSON,
+		taskFlow.AlarmURL,
+		taskFlow.AlarmToken,
+		taskFlow.AlarmSilenceSeconds,
+		taskFlow.VisionProvider,
+		taskFlow.Sensitivity,
 		now,
 		now,
 	)
@@ -157,24 +642,78 @@ func SaveTaskFlow(taskFlow *TaskFlow) error {
 		return fmt.Errorf("failed to get last insert ID: %w", err)
 	}
 
+	var replaced int64
+	if !taskFlow.Draft {
+		if replaced, taskFlow.Version, err = commitTaskFlow(tx, int(id), taskFlow.DeviceEUI); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit task flow: %w", err)
+	}
+
 	taskFlow.ID = int(id)
 	taskFlow.CreatedAt = now
 	taskFlow.UpdatedAt = now
 
-	log.Printf("Saved task flow: ID=%d, Device=%s, Headline='%s'", taskFlow.ID, taskFlow.DeviceEUI, taskFlow.Headline)
+	if taskFlow.Draft {
+		log.Printf("Saved draft task flow: ID=%d, Device=%s, Headline='%s'", taskFlow.ID, taskFlow.DeviceEUI, taskFlow.Headline)
+		return nil
+	}
+
+	if err := startTaskDeployment(taskFlow.ID); err != nil {
+		log.Printf("WARNING: Failed to track deployment of task %d: %v", taskFlow.ID, err)
+	}
+
+	notifyTaskFlowsChanged()
+	log.Printf("Saved task flow: ID=%d, Version=%d, Device=%s, Headline='%s' (replaced %d)", taskFlow.ID, taskFlow.Version, taskFlow.DeviceEUI, taskFlow.Headline, replaced)
 	return nil
 }
 
 // GetTaskFlowsByDevice retrieves all task flows for a device
 func GetTaskFlowsByDevice(deviceEUI string) ([]*TaskFlow, error) {
 	query := `
-	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, created_at, updated_at
+	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, paused, pause_reason, error_count, context_frames, draft, cooldown_seconds, dedup_seconds, conditions, alarm_url, alarm_token, alarm_silence_seconds, vision_provider, sensitivity, version, created_at, updated_at
 	FROM task_flows
 	WHERE device_eui = ?
 	ORDER BY created_at DESC
 	`
 
-	rows, err := db.Query(query, deviceEUI)
+	return queryTaskFlows(query, deviceEUI)
+}
+
+// GetActiveTaskFlow retrieves the task a device runs: its committed task with the highest
+// version that is not paused (nil if there is none). Drafts and tasks whose replacement has
+// not committed yet are never returned.
+func GetActiveTaskFlow(deviceEUI string) (*TaskFlow, error) {
+	query := `
+	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, paused, pause_reason, error_count, context_frames, draft, cooldown_seconds, dedup_seconds, conditions, alarm_url, alarm_token, alarm_silence_seconds, vision_provider, sensitivity, version, created_at, updated_at
+	FROM task_flows
+	WHERE device_eui = ? AND draft = 0 AND version > 0 AND paused = 0
+	ORDER BY version DESC
+	LIMIT 1
+	`
+
+	taskFlows, err := queryTaskFlows(query, deviceEUI)
+	if err != nil || len(taskFlows) == 0 {
+		return nil, err
+	}
+	return taskFlows[0], nil
+}
+
+// GetTaskFlows retrieves the task flows of all devices, grouped by device, newest first
+func GetTaskFlows() ([]*TaskFlow, error) {
+	query := `
+	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, paused, pause_reason, error_count, context_frames, draft, cooldown_seconds, dedup_seconds, conditions, alarm_url, alarm_token, alarm_silence_seconds, vision_provider, sensitivity, version, created_at, updated_at
+	FROM task_flows
+	ORDER BY device_eui, created_at DESC
+	`
+	return queryTaskFlows(query)
+}
+
+// queryTaskFlows runs a task_flows query selecting all columns
+func queryTaskFlows(query string, args ...interface{}) ([]*TaskFlow, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query task flows: %w", err)
 	}
@@ -183,7 +722,7 @@ func GetTaskFlowsByDevice(deviceEUI string) ([]*TaskFlow, error) {
 	var taskFlows []*TaskFlow
 	for rows.Next() {
 		var tf TaskFlow
-		var targetObjectsJSON, actionsJSON string
+		var targetObjectsJSON, actionsJSON, conditionsJSON string
 
 		err := rows.Scan(
 			&tf.ID,
@@ -194,6 +733,20 @@ func GetTaskFlowsByDevice(deviceEUI string) ([]*TaskFlow, error) {
 			&targetObjectsJSON,
 			&actionsJSON,
 			&tf.ModelType,
+			&tf.Paused,
+			&tf.PauseReason,
+			&tf.ErrorCount,
+			&tf.ContextFrames,
+			&tf.Draft,
+			&tf.CooldownSeconds,
+			&tf.DedupSeconds,
+			&conditionsJSON,
+			&tf.AlarmURL,
+			&tf.AlarmToken,
+			&tf.AlarmSilenceSeconds,
+			&tf.VisionProvider,
+			&tf.Sensitivity,
+			&tf.Version,
 			&tf.CreatedAt,
 			&tf.UpdatedAt,
 		)
@@ -212,6 +765,8 @@ func GetTaskFlowsByDevice(deviceEUI string) ([]*TaskFlow, error) {
 			tf.Actions = []string{}
 		}
 
+		tf.Conditions = parseTaskConditions(tf.ID, conditionsJSON)
+
 		taskFlows = append(taskFlows, &tf)
 	}
 
@@ -221,13 +776,13 @@ func GetTaskFlowsByDevice(deviceEUI string) ([]*TaskFlow, error) {
 // GetTaskFlowByID retrieves a task flow by ID
 func GetTaskFlowByID(id int) (*TaskFlow, error) {
 	query := `
-	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, created_at, updated_at
+	SELECT id, device_eui, name, headline, trigger_condition, target_objects, actions, model_type, paused, pause_reason, error_count, context_frames, draft, cooldown_seconds, dedup_seconds, conditions, alarm_url, alarm_token, alarm_silence_seconds, vision_provider, sensitivity, version, created_at, updated_at
 	FROM task_flows
 	WHERE id = ?
 	`
 
 	var tf TaskFlow
-	var targetObjectsJSON, actionsJSON string
+	var targetObjectsJSON, actionsJSON, conditionsJSON string
 
 	err := db.QueryRow(query, id).Scan(
 		&tf.ID,
@@ -238,6 +793,20 @@ func GetTaskFlowByID(id int) (*TaskFlow, error) {
 		&targetObjectsJSON,
 		&actionsJSON,
 		&tf.ModelType,
+		&tf.Paused,
+		&tf.PauseReason,
+		&tf.ErrorCount,
+		&tf.ContextFrames,
+		&tf.Draft,
+		&tf.CooldownSeconds,
+		&tf.DedupSeconds,
+		&conditionsJSON,
+		&tf.AlarmURL,
+		&tf.AlarmToken,
+		&tf.AlarmSilenceSeconds,
+		&tf.VisionProvider,
+		&tf.Sensitivity,
+		&tf.Version,
 		&tf.CreatedAt,
 		&tf.UpdatedAt,
 	)
@@ -260,9 +829,24 @@ func GetTaskFlowByID(id int) (*TaskFlow, error) {
 		tf.Actions = []string{}
 	}
 
+	tf.Conditions = parseTaskConditions(tf.ID, conditionsJSON)
+
 	return &tf, nil
 }
 
+// parseTaskConditions decodes the conditions column ("" = none)
+func parseTaskConditions(id int, conditionsJSON string) *TaskConditions {
+	if conditionsJSON == "" {
+		return nil
+	}
+	var c TaskConditions
+	if err := json.Unmarshal([]byte(conditionsJSON), &c); err != nil {
+		log.Printf("WARNING: Failed to unmarshal conditions for task %d: %v", id, err)
+		return nil
+	}
+	return &c
+}
+
 // DeleteTaskFlow deletes a task flow by ID
 func DeleteTaskFlow(id int) error {
 	query := `DELETE FROM task_flows WHERE id = ?`
@@ -280,19 +864,162 @@ func DeleteTaskFlow(id int) error {
 		return fmt.Errorf("task flow not found: %d", id)
 	}
 
+	if _, err := db.Exec(`DELETE FROM task_deployments WHERE task_id = ?`, id); err != nil {
+		log.Printf("WARNING: Failed to delete deployment record for task %d: %v", id, err)
+	}
+
+	notifyTaskFlowsChanged()
 	log.Printf("Deleted task flow: ID=%d", id)
 	return nil
 }
 
-// SaveNotificationEvent saves a notification event to the database
+// ActivateTaskFlow turns a confirmed draft into the device's only task, deleting the tasks
+// it replaces in the same transaction
+func ActivateTaskFlow(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deviceEUI string
+	err = tx.QueryRow(`SELECT device_eui FROM task_flows WHERE id = ? AND draft = 1`, id).Scan(&deviceEUI)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("draft task flow not found: %d", id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query draft task flow: %w", err)
+	}
+
+	replaced, version, err := commitTaskFlow(tx, id, deviceEUI)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit task activation: %w", err)
+	}
+
+	if err := startTaskDeployment(id); err != nil {
+		log.Printf("WARNING: Failed to track deployment of task %d: %v", id, err)
+	}
+
+	notifyTaskFlowsChanged()
+	log.Printf("Activated task flow: ID=%d, Version=%d, Device=%s (replaced %d)", id, version, deviceEUI, replaced)
+	return nil
+}
+
+// commitTaskFlow makes a task the device's only task within tx: it deletes the device's other
+// tasks and gives the task the device's next version, which makes it visible to
+// GetActiveTaskFlow once tx commits. Returns the number of tasks replaced and the version.
+func commitTaskFlow(tx *sql.Tx, id int, deviceEUI string) (int64, int, error) {
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM task_flows WHERE device_eui = ?`, deviceEUI).Scan(&version); err != nil {
+		return 0, 0, fmt.Errorf("failed to get next task version: %w", err)
+	}
+
+	// Device only supports one task at a time
+	if _, err := tx.Exec(`DELETE FROM task_deployments WHERE device_eui = ? AND task_id != ?`, deviceEUI, id); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete replaced task deployments: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM task_flows WHERE device_eui = ? AND id != ?`, deviceEUI, id)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete replaced task flows: %w", err)
+	}
+	replaced, _ := result.RowsAffected()
+
+	if _, err := tx.Exec(`UPDATE task_flows SET draft = 0, version = ?, updated_at = ? WHERE id = ?`, version, time.Now(), id); err != nil {
+		return 0, 0, fmt.Errorf("failed to activate task flow: %w", err)
+	}
+	return replaced, version, nil
+}
+
+// DeleteDraftTaskFlows deletes a device's unconfirmed drafts
+func DeleteDraftTaskFlows(deviceEUI string) error {
+	if _, err := db.Exec(`DELETE FROM task_flows WHERE device_eui = ? AND draft = 1`, deviceEUI); err != nil {
+		return fmt.Errorf("failed to delete draft task flows: %w", err)
+	}
+	return nil
+}
+
+// RecordTaskModuleError increments a task's consecutive module error count and returns the new count
+func RecordTaskModuleError(id int) (int, error) {
+	query := `
+	UPDATE task_flows SET error_count = error_count + 1, updated_at = ?
+	WHERE id = ?
+	RETURNING error_count
+	`
+
+	var count int
+	if err := db.QueryRow(query, time.Now(), id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to record task module error: %w", err)
+	}
+	return count, nil
+}
+
+// ResetTaskModuleErrors clears a task's consecutive module error count
+func ResetTaskModuleErrors(id int) error {
+	query := `UPDATE task_flows SET error_count = 0 WHERE id = ? AND error_count != 0`
+	if _, err := db.Exec(query, id); err != nil {
+		return fmt.Errorf("failed to reset task module errors: %w", err)
+	}
+	return nil
+}
+
+// PauseTaskFlow marks a task flow as paused so it is no longer served to the device
+func PauseTaskFlow(id int, reason string) error {
+	query := `UPDATE task_flows SET paused = 1, pause_reason = ?, updated_at = ? WHERE id = ?`
+	if _, err := db.Exec(query, reason, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to pause task flow: %w", err)
+	}
+
+	notifyTaskFlowsChanged()
+	log.Printf("Paused task flow: ID=%d, Reason='%s'", id, reason)
+	return nil
+}
+
+// ResumeTaskFlow un-pauses a task flow and clears its error count
+func ResumeTaskFlow(id int) error {
+	query := `UPDATE task_flows SET paused = 0, pause_reason = '', error_count = 0, updated_at = ? WHERE id = ?`
+	result, err := db.Exec(query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to resume task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("task flow not found: %d", id)
+	}
+
+	if err := startTaskDeployment(id); err != nil {
+		log.Printf("WARNING: Failed to track deployment of task %d: %v", id, err)
+	}
+
+	notifyTaskFlowsChanged()
+	log.Printf("Resumed task flow: ID=%d", id)
+	return nil
+}
+
+// SaveNotificationEvent saves a notification event to the database in the current schema
+// version. Events without a type are classified from their contents.
 func SaveNotificationEvent(event *NotificationEvent) error {
+	if event.EventType == "" {
+		event.EventType = ClassifyEvent(event)
+	} else if !ValidEventType(event.EventType) {
+		return fmt.Errorf("invalid event type: %s", event.EventType)
+	}
+	event.SchemaVersion = EventSchemaVersion
+
 	query := `
-	INSERT INTO notification_events (request_id, device_eui, timestamp, text, img, inference_data, sensor_data, created_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO notification_events (request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
-	result, err := db.Exec(query,
+	result, err := execRetry(query,
 		event.RequestID,
 		event.DeviceEUI,
 		event.Timestamp,
@@ -300,6 +1027,12 @@ func SaveNotificationEvent(event *NotificationEvent) error {
 		event.Img,
 		event.InferenceData,
 		event.SensorData,
+		event.EventType,
+		event.SchemaVersion,
+		event.TLID,
+		event.TaskHeadline,
+		event.TaskPrompt,
+		event.Suppressed,
 		now,
 	)
 
@@ -314,15 +1047,17 @@ func SaveNotificationEvent(event *NotificationEvent) error {
 
 	event.ID = int(id)
 	event.CreatedAt = now
+	indexEvent(event)
 
-	log.Printf("Saved notification event: ID=%d, Device=%s", event.ID, event.DeviceEUI)
+	log.Printf("Saved notification event: ID=%d, Device=%s, Type=%s", event.ID, event.DeviceEUI, event.EventType)
+	eventsStored.notify()
 	return nil
 }
 
 // GetNotificationEventsByDevice retrieves notification events for a device
 func GetNotificationEventsByDevice(deviceEUI string, limit int) ([]*NotificationEvent, error) {
 	query := `
-	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, created_at
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
 	FROM notification_events
 	WHERE device_eui = ?
 	ORDER BY timestamp DESC
@@ -347,6 +1082,12 @@ func GetNotificationEventsByDevice(deviceEUI string, limit int) ([]*Notification
 			&event.Img,
 			&event.InferenceData,
 			&event.SensorData,
+			&event.EventType,
+			&event.SchemaVersion,
+			&event.TLID,
+			&event.TaskHeadline,
+			&event.TaskPrompt,
+			&event.Suppressed,
 			&event.CreatedAt,
 		)
 		if err != nil {
@@ -354,6 +1095,145 @@ func GetNotificationEventsByDevice(deviceEUI string, limit int) ([]*Notification
 		}
 		events = append(events, &event)
 	}
+	rows.Close()
 
+	// Upgrade after the query is done (SQLite cannot write while the result set holds its read lock)
+	for _, event := range events {
+		if err := upgradeEvent(event); err != nil {
+			return nil, err
+		}
+	}
 	return events, nil
 }
+
+// maxUnknownEndpoints bounds the unknown_endpoints table; the least recently hit rows go first
+const maxUnknownEndpoints = 500
+
+// RecordUnknownEndpoint increments the 404 hit counter for a path/method/device combination
+// and drops the least recently hit combinations beyond maxUnknownEndpoints
+func RecordUnknownEndpoint(method, path, deviceEUI, rawQuery, body string) error {
+	query := `
+	INSERT INTO unknown_endpoints (method, path, device_eui, hit_count, last_query, last_body, first_seen_at, last_seen_at)
+	VALUES (?, ?, ?, 1, ?, ?, ?, ?)
+	ON CONFLICT(method, path, device_eui) DO UPDATE SET
+		hit_count = hit_count + 1,
+		last_query = excluded.last_query,
+		last_body = excluded.last_body,
+		last_seen_at = excluded.last_seen_at
+	`
+
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+
+	now := time.Now()
+	if _, err := execRetry(query, method, path, deviceEUI, rawQuery, body, now, now); err != nil {
+		return fmt.Errorf("failed to record unknown endpoint: %w", err)
+	}
+
+	trim := `
+	DELETE FROM unknown_endpoints WHERE id NOT IN (
+		SELECT id FROM unknown_endpoints ORDER BY last_seen_at DESC, id DESC LIMIT ?
+	)
+	`
+	if _, err := execRetry(trim, maxUnknownEndpoints); err != nil {
+		return fmt.Errorf("failed to trim unknown endpoints: %w", err)
+	}
+	return nil
+}
+
+// GetUnknownEndpoints retrieves all aggregated 404 entries, most frequently hit first
+func GetUnknownEndpoints() ([]*UnknownEndpoint, error) {
+	query := `
+	SELECT id, method, path, device_eui, hit_count, last_query, last_body, first_seen_at, last_seen_at
+	FROM unknown_endpoints
+	ORDER BY hit_count DESC, last_seen_at DESC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unknown endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []*UnknownEndpoint{}
+	for rows.Next() {
+		var ue UnknownEndpoint
+		var lastQuery, lastBody sql.NullString
+		err := rows.Scan(
+			&ue.ID,
+			&ue.Method,
+			&ue.Path,
+			&ue.DeviceEUI,
+			&ue.HitCount,
+			&lastQuery,
+			&lastBody,
+			&ue.FirstSeenAt,
+			&ue.LastSeenAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan unknown endpoint: %w", err)
+		}
+		ue.LastQuery = lastQuery.String
+		ue.LastBody = lastBody.String
+		endpoints = append(endpoints, &ue)
+	}
+
+	return endpoints, nil
+}
+
+// ClearUnknownEndpoints deletes all aggregated 404 entries
+func ClearUnknownEndpoints() error {
+	if _, err := db.Exec(`DELETE FROM unknown_endpoints`); err != nil {
+		return fmt.Errorf("failed to clear unknown endpoints: %w", err)
+	}
+	return nil
+}
+
+// GetNotificationEventByID retrieves a notification event by ID
+func GetNotificationEventByID(id int) (*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE id = ?
+	`
+
+	var event NotificationEvent
+	err := db.QueryRow(query, id).Scan(
+		&event.ID,
+		&event.RequestID,
+		&event.DeviceEUI,
+		&event.Timestamp,
+		&event.Text,
+		&event.Img,
+		&event.InferenceData,
+		&event.SensorData,
+		&event.EventType,
+		&event.SchemaVersion,
+		&event.TLID,
+		&event.TaskHeadline,
+		&event.TaskPrompt,
+		&event.Suppressed,
+		&event.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification event: %w", err)
+	}
+
+	if err := upgradeEvent(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Ping verifies the database connection is alive
+func Ping() error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return db.Ping()
+}
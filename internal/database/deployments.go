@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TaskDeployment tracks whether a device has picked up a new or resumed task
+type TaskDeployment struct {
+	TaskID      int        `json:"task_id"`
+	DeviceEUI   string     `json:"device_eui"`
+	Headline    string     `json:"headline"`
+	DeployedAt  time.Time  `json:"deployed_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"` // Device fetched it via view_task_detail
+	AckedAt     *time.Time `json:"acked_at,omitempty"`     // Device confirmed it is running it
+	AlertedAt   *time.Time `json:"alerted_at,omitempty"`   // User was alerted it was not picked up
+
+	// Latest task status reported by the device (nil if it never reported one)
+	Status *DeviceTaskStatus `json:"device_status,omitempty"`
+}
+
+// DeviceTaskStatus is the latest task flow engine status reported by a device
+type DeviceTaskStatus struct {
+	DeviceEUI     string    `json:"device_eui"`
+	TLID          int64     `json:"tlid"`
+	Status        int       `json:"status"`
+	Module        string    `json:"module"`
+	ModuleErrCode int       `json:"module_err_code"`
+	ReportedAt    time.Time `json:"reported_at"`
+}
+
+// startTaskDeployment (re)starts deployment tracking for a task
+func startTaskDeployment(taskID int) error {
+	query := `
+	INSERT INTO task_deployments (task_id, device_eui, deployed_at)
+	SELECT id, device_eui, ? FROM task_flows WHERE id = ?
+	ON CONFLICT(task_id) DO UPDATE SET
+		deployed_at = excluded.deployed_at,
+		delivered_at = NULL,
+		acked_at = NULL,
+		alerted_at = NULL
+	`
+
+	if _, err := db.Exec(query, time.Now(), taskID); err != nil {
+		return fmt.Errorf("failed to start task deployment: %w", err)
+	}
+	return nil
+}
+
+// MarkTaskDelivered records the first time a device fetched a task via view_task_detail
+func MarkTaskDelivered(taskID int) error {
+	query := `UPDATE task_deployments SET delivered_at = ? WHERE task_id = ? AND delivered_at IS NULL`
+	if _, err := execRetry(query, time.Now(), taskID); err != nil {
+		return fmt.Errorf("failed to mark task delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkTaskAcknowledged records that the device has confirmed it is running a task
+func MarkTaskAcknowledged(taskID int) error {
+	query := `UPDATE task_deployments SET acked_at = ? WHERE task_id = ? AND acked_at IS NULL`
+	if _, err := execRetry(query, time.Now(), taskID); err != nil {
+		return fmt.Errorf("failed to mark task acknowledged: %w", err)
+	}
+	return nil
+}
+
+// MarkTaskDeploymentAlerted records that the user was alerted about a task not being picked up
+func MarkTaskDeploymentAlerted(taskID int) error {
+	query := `UPDATE task_deployments SET alerted_at = ? WHERE task_id = ?`
+	if _, err := db.Exec(query, time.Now(), taskID); err != nil {
+		return fmt.Errorf("failed to mark task deployment alerted: %w", err)
+	}
+	return nil
+}
+
+// SaveDeviceTaskStatus stores the latest task status reported by a device
+func SaveDeviceTaskStatus(status *DeviceTaskStatus) error {
+	query := `
+	INSERT INTO device_task_status (device_eui, tlid, status, module, module_err_code, reported_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(device_eui) DO UPDATE SET
+		tlid = excluded.tlid,
+		status = excluded.status,
+		module = excluded.module,
+		module_err_code = excluded.module_err_code,
+		reported_at = excluded.reported_at
+	`
+
+	status.ReportedAt = time.Now()
+	_, err := execRetry(query,
+		status.DeviceEUI,
+		status.TLID,
+		status.Status,
+		status.Module,
+		status.ModuleErrCode,
+		status.ReportedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save device task status: %w", err)
+	}
+	return nil
+}
+
+// GetPendingTaskDeployments retrieves unacknowledged, un-alerted deployments older than
+// deployedBefore, limited to each device's current task (see GetActiveTaskFlow)
+func GetPendingTaskDeployments(deployedBefore time.Time) ([]*TaskDeployment, error) {
+	query := `
+	SELECT d.task_id, d.device_eui, t.headline, d.deployed_at, d.delivered_at,
+		s.tlid, s.status, s.module, s.module_err_code, s.reported_at
+	FROM task_deployments d
+	JOIN task_flows t ON t.id = d.task_id
+	LEFT JOIN device_task_status s ON s.device_eui = d.device_eui
+	WHERE d.acked_at IS NULL AND d.alerted_at IS NULL AND d.deployed_at < ?
+		AND t.id = (
+			SELECT id FROM task_flows
+			WHERE device_eui = d.device_eui AND paused = 0 AND draft = 0 AND version > 0
+			ORDER BY version DESC LIMIT 1
+		)
+	`
+
+	rows, err := db.Query(query, deployedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []*TaskDeployment
+	for rows.Next() {
+		var d TaskDeployment
+		var deliveredAt, reportedAt sql.NullTime
+		var tlid, status, errCode sql.NullInt64
+		var module sql.NullString
+
+		err := rows.Scan(
+			&d.TaskID,
+			&d.DeviceEUI,
+			&d.Headline,
+			&d.DeployedAt,
+			&deliveredAt,
+			&tlid,
+			&status,
+			&module,
+			&errCode,
+			&reportedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task deployment: %w", err)
+		}
+
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		if reportedAt.Valid {
+			d.Status = &DeviceTaskStatus{
+				DeviceEUI:     d.DeviceEUI,
+				TLID:          tlid.Int64,
+				Status:        int(status.Int64),
+				Module:        module.String,
+				ModuleErrCode: int(errCode.Int64),
+				ReportedAt:    reportedAt.Time,
+			}
+		}
+		deployments = append(deployments, &d)
+	}
+
+	return deployments, nil
+}
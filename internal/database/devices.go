@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Device is an entry in the device registry, which strict mode uses as an allowlist
+type Device struct {
+	EUI       string    `json:"eui"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegisterDevice adds a device to the registry, or renames it if already registered
+func RegisterDevice(d *Device) error {
+	d.EUI = strings.ToUpper(d.EUI)
+	query := `
+	INSERT INTO devices (device_eui, name, created_at) VALUES (?, ?, ?)
+	ON CONFLICT(device_eui) DO UPDATE SET name = excluded.name
+	`
+
+	if _, err := db.Exec(query, d.EUI, d.Name, time.Now()); err != nil {
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+
+	stored, err := GetDevice(d.EUI)
+	if err != nil {
+		return err
+	}
+	d.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+// GetDevice returns a registered device, or nil if it is not registered
+func GetDevice(eui string) (*Device, error) {
+	var d Device
+	err := db.QueryRow(`SELECT device_eui, name, created_at FROM devices WHERE device_eui = ?`, strings.ToUpper(eui)).
+		Scan(&d.EUI, &d.Name, &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device: %w", err)
+	}
+	return &d, nil
+}
+
+// GetDevices returns the registered devices visible to a user (0 = all)
+func GetDevices(visibleTo int) ([]*Device, error) {
+	clause, args := visibleDevicesClause(visibleTo)
+	rows, err := db.Query(`SELECT device_eui, name, created_at FROM devices WHERE 1=1`+clause+` ORDER BY device_eui`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*Device{}
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.EUI, &d.Name, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, &d)
+	}
+	return devices, nil
+}
+
+// IsDeviceRegistered reports whether a device is in the registry
+func IsDeviceRegistered(eui string) (bool, error) {
+	d, err := GetDevice(eui)
+	return d != nil, err
+}
+
+// CountDevices returns the number of registered devices
+func CountDevices() (int, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM devices`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count devices: %w", err)
+	}
+	return n, nil
+}
+
+// UnregisterDevice removes a device from the registry. Returns false if it was not registered.
+func UnregisterDevice(eui string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM devices WHERE device_eui = ?`, strings.ToUpper(eui))
+	if err != nil {
+		return false, fmt.Errorf("failed to unregister device: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// DeviceSummary is a device known to the server: registered, or with tasks or events
+type DeviceSummary struct {
+	EUI         string     `json:"eui"`
+	Name        string     `json:"name"` // Registered name ("" if unregistered)
+	Registered  bool       `json:"registered"`
+	Tasks       int        `json:"tasks"`
+	Events      int        `json:"events"`
+	LastEventAt *time.Time `json:"last_event_at"` // nil if it has no events
+}
+
+// GetDeviceSummaries returns every device in the registry, the task flows or the events,
+// ordered by EUI
+func GetDeviceSummaries() ([]*DeviceSummary, error) {
+	query := `
+	WITH euis AS (
+		SELECT device_eui FROM devices
+		UNION SELECT device_eui FROM task_flows
+		UNION SELECT device_eui FROM notification_events
+	)
+	SELECT e.device_eui, COALESCE(d.name, ''), d.device_eui IS NOT NULL,
+		(SELECT COUNT(*) FROM task_flows t WHERE t.device_eui = e.device_eui),
+		(SELECT COUNT(*) FROM notification_events n WHERE n.device_eui = e.device_eui),
+		(SELECT CAST(strftime('%s', created_at) AS INTEGER) FROM notification_events n WHERE n.device_eui = e.device_eui ORDER BY id DESC LIMIT 1)
+	FROM euis e
+	LEFT JOIN devices d ON d.device_eui = e.device_eui
+	WHERE e.device_eui != ''
+	ORDER BY e.device_eui
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*DeviceSummary{}
+	for rows.Next() {
+		var d DeviceSummary
+		var lastEvent sql.NullInt64
+		if err := rows.Scan(&d.EUI, &d.Name, &d.Registered, &d.Tasks, &d.Events, &lastEvent); err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		if lastEvent.Valid {
+			t := time.Unix(lastEvent.Int64, 0)
+			d.LastEventAt = &t
+		}
+		devices = append(devices, &d)
+	}
+	return devices, nil
+}
@@ -0,0 +1,48 @@
+//go:build cgo && !purego
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Driver names the SQLite driver compiled in: mattn/go-sqlite3 by default, the pure-Go
+// modernc.org/sqlite with the purego build tag or without cgo (CGO_ENABLED=0)
+const Driver = "mattn/go-sqlite3 (cgo)"
+
+// driverName is the database/sql name of the driver
+const driverName = "sqlite3"
+
+// readWriteDSN is the connection string of the server's database: WAL mode, busyTimeout, and
+// transactions that take the write lock when they begin
+func readWriteDSN(path string) string {
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		url.PathEscape(path), busyTimeout.Milliseconds())
+}
+
+// isBusy reports whether err is SQLite's "database is locked" (SQLITE_BUSY or SQLITE_LOCKED)
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// startBackup starts SQLite's online backup of the main database of src (a driver connection
+// from sql.Conn.Raw) into the database file at destPath. close releases the destination.
+func startBackup(src interface{}, destPath string) (b onlineBackup, close func(), err error) {
+	dest, err := sqlite3Driver.Open(destPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create backup database: %w", err)
+	}
+	backup, err := dest.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		dest.Close()
+		return nil, nil, fmt.Errorf("failed to start backup: %w", err)
+	}
+	return backup, func() { dest.Close() }, nil
+}
+
+var sqlite3Driver = &sqlite3.SQLiteDriver{}
@@ -0,0 +1,66 @@
+//go:build purego || !cgo
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Driver names the SQLite driver compiled in: mattn/go-sqlite3 by default, the pure-Go
+// modernc.org/sqlite with the purego build tag or without cgo (CGO_ENABLED=0)
+const Driver = "modernc.org/sqlite (pure Go)"
+
+// driverName is the database/sql name of the driver
+const driverName = "sqlite"
+
+// readWriteDSN is the connection string of the server's database: WAL mode, busyTimeout, and
+// transactions that take the write lock when they begin
+func readWriteDSN(path string) string {
+	return fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(%d)&_txlock=immediate",
+		url.PathEscape(path), busyTimeout.Milliseconds())
+}
+
+// isBusy reports whether err is SQLite's "database is locked" (SQLITE_BUSY or SQLITE_LOCKED)
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff // Primary result code of an extended one
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// startBackup starts SQLite's online backup of the main database of src (a driver connection
+// from sql.Conn.Raw) into the database file at destPath. close releases the destination.
+func startBackup(src interface{}, destPath string) (b onlineBackup, close func(), err error) {
+	conn, ok := src.(interface {
+		NewBackup(dstURI string) (*sqlite.Backup, error)
+	})
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to start backup: the SQLite driver has no backup API")
+	}
+	backup, err := conn.NewBackup(destPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start backup: %w", err)
+	}
+	return moderncBackup{backup}, func() {}, nil
+}
+
+// moderncBackup adapts modernc's backup, whose Step reports whether pages remain
+type moderncBackup struct {
+	*sqlite.Backup
+}
+
+func (b moderncBackup) Step(pages int) (bool, error) {
+	more, err := b.Backup.Step(int32(pages))
+	return !more, err
+}
+
+func (b moderncBackup) Close() error {
+	return b.Finish()
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Positions of an alarm event's context frames relative to the triggering frame
+const (
+	FrameBefore = "before"
+	FrameAfter  = "after"
+)
+
+// EventFrame is a context frame stored with an alarm event
+type EventFrame struct {
+	EventID   int    `json:"event_id"`
+	Position  string `json:"position"` // FrameBefore or FrameAfter
+	Timestamp int64  `json:"ts"`       // When the frame was received, Unix milliseconds
+	Img       string `json:"-"`        // Base64-encoded JPEG
+}
+
+// SaveEventFrame stores a context frame for an event, replacing any frame at the same position
+func SaveEventFrame(frame *EventFrame) error {
+	query := `INSERT OR REPLACE INTO event_frames (event_id, position, ts, img) VALUES (?, ?, ?, ?)`
+	if _, err := execRetry(query, frame.EventID, frame.Position, frame.Timestamp, frame.Img); err != nil {
+		return fmt.Errorf("failed to save event frame: %w", err)
+	}
+	return nil
+}
+
+// GetEventFrame returns an event's context frame at the given position, or nil if it has none
+func GetEventFrame(eventID int, position string) (*EventFrame, error) {
+	query := `SELECT event_id, position, ts, img FROM event_frames WHERE event_id = ? AND position = ?`
+
+	var frame EventFrame
+	err := db.QueryRow(query, eventID, position).Scan(&frame.EventID, &frame.Position, &frame.Timestamp, &frame.Img)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event frame: %w", err)
+	}
+	return &frame, nil
+}
+
+// SetTaskContextFrames turns context frames on or off for a task. Returns false if the task does not exist.
+func SetTaskContextFrames(id int, enabled bool) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET context_frames = ?, updated_at = ? WHERE id = ?`, enabled, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
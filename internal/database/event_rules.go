@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Actions an event rule can take
+const (
+	RuleActionWebhook = "webhook" // POST the event as JSON to the target URL
+	RuleActionSMS     = "sms"     // Text the target phone number
+	RuleActionNtfy    = "ntfy"    // Push notification to the target ntfy topic URL
+	RuleActionMQTT    = "mqtt"    // Publish the event as JSON to the target topic of the rules broker
+	RuleActionCommand = "command" // Run the target shell command with the event in its environment
+)
+
+// RuleActions lists the valid event rule actions
+var RuleActions = []string{RuleActionWebhook, RuleActionSMS, RuleActionNtfy, RuleActionMQTT, RuleActionCommand}
+
+// Image modes of an event rule that take no redaction; the others are registered by the rules
+// package. They only decide what a webhook sends, the stored image is never changed.
+const (
+	RuleImageLink = "link" // Link the stored image (default)
+	RuleImageNone = "none" // Send no image at all
+)
+
+// EventRule is a saved event search with an action: every new event matching the filter
+// fires the action. Rules are independent of the task that generated the event.
+type EventRule struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	DeviceEUI       string     `json:"device_eui"`       // Empty matches every device
+	Class           string     `json:"class"`            // Detected object class, e.g. "car" (empty matches any)
+	EventType       string     `json:"event_type"`       // One of EventTypes (empty matches any)
+	Hours           string     `json:"hours"`            // "HH:MM-HH:MM" in server local time, may wrap midnight (empty = all day)
+	MinConfidence   int        `json:"min_confidence"`   // Minimum detection score 0-100, of Class if set (0 = any)
+	Sensor          string     `json:"sensor"`           // Sensor metric the thresholds apply to, e.g. SensorTemperature (empty = none)
+	SensorAbove     *float64   `json:"sensor_above"`     // The reading must be above this (nil = no lower bound)
+	SensorBelow     *float64   `json:"sensor_below"`     // The reading must be below this (nil = no upper bound)
+	Action          string     `json:"action"`           // One of RuleActions
+	Target          string     `json:"target"`           // Webhook URL, phone number, ntfy topic URL, MQTT topic or shell command
+	Image           string     `json:"image"`            // What a webhook sends of the event's image, e.g. RuleImageLink
+	CooldownSeconds int        `json:"cooldown_seconds"` // Minimum time between firings (0 = fire on every match)
+	Enabled         bool       `json:"enabled"`
+	LastFiredAt     *time.Time `json:"last_fired_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+const eventRuleColumns = `id, name, device_eui, class, event_type, hours, min_confidence, sensor, sensor_above, sensor_below, action, target, image, cooldown_seconds, enabled, last_fired_at, created_at`
+
+// CreateEventRule stores a new event rule
+func CreateEventRule(rule *EventRule) error {
+	query := `
+	INSERT INTO event_rules (name, device_eui, class, event_type, hours, min_confidence, sensor, sensor_above, sensor_below, action, target, image, cooldown_seconds, enabled, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query, rule.Name, rule.DeviceEUI, rule.Class, rule.EventType, rule.Hours,
+		rule.MinConfidence, rule.Sensor, rule.SensorAbove, rule.SensorBelow, rule.Action, rule.Target, rule.Image, rule.CooldownSeconds, rule.Enabled, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert event rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	rule.ID = int(id)
+	rule.CreatedAt = now
+	return nil
+}
+
+// UpdateEventRule replaces a rule's filter and action, reporting whether it exists
+func UpdateEventRule(rule *EventRule) (bool, error) {
+	query := `
+	UPDATE event_rules
+	SET name = ?, device_eui = ?, class = ?, event_type = ?, hours = ?, min_confidence = ?, sensor = ?, sensor_above = ?, sensor_below = ?,
+		action = ?, target = ?, image = ?, cooldown_seconds = ?, enabled = ?
+	WHERE id = ?
+	`
+
+	result, err := db.Exec(query, rule.Name, rule.DeviceEUI, rule.Class, rule.EventType, rule.Hours,
+		rule.MinConfidence, rule.Sensor, rule.SensorAbove, rule.SensorBelow, rule.Action, rule.Target, rule.Image, rule.CooldownSeconds, rule.Enabled, rule.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update event rule: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update event rule: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteEventRule removes a rule, reporting whether it existed
+func DeleteEventRule(id int) (bool, error) {
+	result, err := db.Exec(`DELETE FROM event_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event rule: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event rule: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetEventRules retrieves all rules (only enabled ones if enabledOnly), oldest first
+func GetEventRules(enabledOnly bool) ([]*EventRule, error) {
+	query := `SELECT ` + eventRuleColumns + ` FROM event_rules WHERE (? = 0 OR enabled = 1) ORDER BY id`
+
+	rows, err := db.Query(query, enabledOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*EventRule{}
+	for rows.Next() {
+		rule, err := scanEventRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// GetEventRuleByID retrieves a rule (nil if it does not exist)
+func GetEventRuleByID(id int) (*EventRule, error) {
+	rule, err := scanEventRule(db.QueryRow(`SELECT `+eventRuleColumns+` FROM event_rules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rule, err
+}
+
+// MarkEventRuleFired records when a rule last fired, for its cooldown
+func MarkEventRuleFired(id int, at time.Time) error {
+	if _, err := db.Exec(`UPDATE event_rules SET last_fired_at = ? WHERE id = ?`, at, id); err != nil {
+		return fmt.Errorf("failed to mark event rule %d fired: %w", id, err)
+	}
+	return nil
+}
+
+func scanEventRule(row interface{ Scan(...interface{}) error }) (*EventRule, error) {
+	var rule EventRule
+	var lastFired sql.NullTime
+	var above, below sql.NullFloat64
+	err := row.Scan(&rule.ID, &rule.Name, &rule.DeviceEUI, &rule.Class, &rule.EventType, &rule.Hours,
+		&rule.MinConfidence, &rule.Sensor, &above, &below, &rule.Action, &rule.Target, &rule.Image, &rule.CooldownSeconds, &rule.Enabled, &lastFired, &rule.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan event rule: %w", err)
+	}
+	if lastFired.Valid {
+		rule.LastFiredAt = &lastFired.Time
+	}
+	if above.Valid {
+		rule.SensorAbove = &above.Float64
+	}
+	if below.Valid {
+		rule.SensorBelow = &below.Float64
+	}
+	return &rule, nil
+}
+
+// GetNotificationEventsAfter retrieves up to limit events stored after the given ID, oldest first
+func GetNotificationEventsAfter(afterID, limit int) ([]*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE id > ?
+	ORDER BY id
+	LIMIT ?
+	`
+	return queryNotificationEvents(query, afterID, limit)
+}
+
+// EventFeedQuery selects the events of an event feed
+type EventFeedQuery struct {
+	AfterID   int       // Only events stored after this one
+	Devices   []string  // Only these devices (nil = all devices)
+	EventType string    // Only this event type ("" = any)
+	From, To  time.Time // Only events stored in [From, To) (zero = unbounded)
+	Limit     int
+	Latest    bool // The latest Limit events instead of the first Limit after AfterID
+}
+
+// GetEventFeed retrieves the events selected by q, oldest first
+func GetEventFeed(q EventFeedQuery) ([]*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE id > ? AND (? = '' OR event_type = ?)`
+	args := []interface{}{q.AfterID, q.EventType, q.EventType}
+	if q.Devices != nil {
+		if len(q.Devices) == 0 {
+			return []*NotificationEvent{}, nil
+		}
+		query += ` AND device_eui IN (?` + strings.Repeat(", ?", len(q.Devices)-1) + `)`
+		for _, eui := range q.Devices {
+			args = append(args, eui)
+		}
+	}
+	if !q.From.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, q.To)
+	}
+	if q.Latest {
+		query += ` ORDER BY id DESC LIMIT ?`
+	} else {
+		query += ` ORDER BY id LIMIT ?`
+	}
+	args = append(args, q.Limit)
+
+	events, err := queryNotificationEvents(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if q.Latest {
+		slices.Reverse(events)
+	}
+	return events, nil
+}
+
+// SearchNotificationEvents retrieves events created since the given time, newest first,
+// optionally restricted to one device and event type (empty = any)
+func SearchNotificationEvents(since time.Time, deviceEUI, eventType string) ([]*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE created_at >= ?
+		AND (? = '' OR device_eui = ?)
+		AND (? = '' OR event_type = ?)
+	ORDER BY created_at DESC
+	`
+	return queryNotificationEvents(query, since, deviceEUI, deviceEUI, eventType, eventType)
+}
+
+// LastNotificationEventID returns the ID of the newest stored event (0 if there are none)
+func LastNotificationEventID() (int, error) {
+	var id int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM notification_events`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get last notification event: %w", err)
+	}
+	return id, nil
+}
+
+// queryNotificationEvents runs a notification_events query selecting all columns and
+// upgrades the rows to the current schema version
+func queryNotificationEvents(query string, args ...interface{}) ([]*NotificationEvent, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*NotificationEvent{}
+	for rows.Next() {
+		var event NotificationEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.RequestID,
+			&event.DeviceEUI,
+			&event.Timestamp,
+			&event.Text,
+			&event.Img,
+			&event.InferenceData,
+			&event.SensorData,
+			&event.EventType,
+			&event.SchemaVersion,
+			&event.TLID,
+			&event.TaskHeadline,
+			&event.TaskPrompt,
+			&event.Suppressed,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+
+	// Upgrade after the query is done (SQLite cannot write while the result set holds its read lock)
+	for _, event := range events {
+		if err := upgradeEvent(event); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Event types of stored notification events
+const (
+	EventAlarm       = "alarm"       // Device alarm (detection with inference results and/or an image)
+	EventSensor      = "sensor"      // Device report carrying only sensor readings
+	EventTelemetry   = "telemetry"   // Server-generated status event (task paused, task not picked up)
+	EventInteraction = "interaction" // Answer to a user request (RECOGNIZE mode results)
+	EventThreshold   = "threshold"   // Server-generated: a sensor reading crossed one of the device's sensor thresholds
+)
+
+// EventTypes lists the valid event types
+var EventTypes = []string{EventAlarm, EventSensor, EventTelemetry, EventInteraction, EventThreshold}
+
+// EventSchemaVersion is the format of newly stored events' JSON blobs (inference_data, sensor_data).
+// Rows with an older version are upgraded when read.
+//
+//	0: rows stored before versioning (no event_type; missing blobs stored as "null" or "")
+//	1: event_type set; missing blobs stored as ""
+const EventSchemaVersion = 1
+
+// eventUpgrades[v] upgrades an event from schema version v to v+1.
+// Add an entry here (and bump EventSchemaVersion) whenever the stored format changes.
+var eventUpgrades = []func(e *NotificationEvent) error{
+	upgradeEventV0,
+}
+
+// upgradeEventV0 classifies a pre-versioning event and normalizes its empty blobs
+func upgradeEventV0(e *NotificationEvent) error {
+	if e.InferenceData == "null" {
+		e.InferenceData = ""
+	}
+	if e.SensorData == "null" {
+		e.SensorData = ""
+	}
+	if e.EventType == "" {
+		e.EventType = ClassifyEvent(e)
+	}
+	return nil
+}
+
+// ClassifyEvent derives the type of an event that was stored without one
+func ClassifyEvent(e *NotificationEvent) string {
+	switch {
+	case strings.HasPrefix(e.RequestID, "task-"):
+		// Task pause and pickup watchdog notifications ("task-paused-<id>", "task-not-picked-up-<id>")
+		return EventTelemetry
+	case e.InferenceData != "" || (e.Img != "" && e.RequestID != ""):
+		return EventAlarm
+	case e.SensorData != "":
+		return EventSensor
+	case e.RequestID == "" && e.Img != "":
+		// RECOGNIZE results are stored without a request ID
+		return EventInteraction
+	}
+	return EventAlarm
+}
+
+// upgradeEvent brings an event read from the database to the current schema version and,
+// if anything changed, stores the upgraded row so later reads skip the work (not in read-only mode)
+func upgradeEvent(e *NotificationEvent) error {
+	if e.SchemaVersion >= EventSchemaVersion {
+		return nil
+	}
+
+	from := e.SchemaVersion
+	for e.SchemaVersion < EventSchemaVersion {
+		if err := eventUpgrades[e.SchemaVersion](e); err != nil {
+			return fmt.Errorf("failed to upgrade event %d from schema version %d: %w", e.ID, e.SchemaVersion, err)
+		}
+		e.SchemaVersion++
+	}
+	if readOnly {
+		return nil
+	}
+
+	query := `
+	UPDATE notification_events SET event_type = ?, schema_version = ?, inference_data = ?, sensor_data = ?
+	WHERE id = ?
+	`
+	if _, err := db.Exec(query, e.EventType, e.SchemaVersion, e.InferenceData, e.SensorData, e.ID); err != nil {
+		log.Printf("WARNING: Failed to store upgraded event %d: %v", e.ID, err)
+	} else {
+		log.Printf("Upgraded event %d from schema version %d to %d (type %s)", e.ID, from, e.SchemaVersion, e.EventType)
+	}
+	return nil
+}
+
+// ValidEventType reports whether t is one of EventTypes
+func ValidEventType(t string) bool {
+	for _, valid := range EventTypes {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// FirmwareImage is an uploaded firmware binary for one device component
+type FirmwareImage struct {
+	ID        int       `json:"id"`
+	Component string    `json:"component"` // "esp32" or "himax"
+	Version   string    `json:"version"`
+	BlobKey   string    `json:"blob_key"` // Key of the binary in the blob store
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	MD5       string    `json:"md5"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FirmwareManifest pins the firmware version a device (or the whole fleet) should run
+type FirmwareManifest struct {
+	ID        int       `json:"id"`
+	DeviceEUI string    `json:"device_eui"` // Empty for the fleet-wide default
+	Component string    `json:"component"`
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveFirmwareImage records an uploaded firmware binary
+func SaveFirmwareImage(image *FirmwareImage) error {
+	query := `
+	INSERT INTO firmware_images (component, version, blob_key, size, sha256, md5, notes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query,
+		image.Component,
+		image.Version,
+		image.BlobKey,
+		image.Size,
+		image.SHA256,
+		image.MD5,
+		image.Notes,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert firmware image: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	image.ID = int(id)
+	image.CreatedAt = now
+
+	log.Printf("Saved firmware image: ID=%d, Component=%s, Version=%s, Size=%d", image.ID, image.Component, image.Version, image.Size)
+	return nil
+}
+
+// GetFirmwareImages retrieves all firmware images, newest first
+func GetFirmwareImages() ([]*FirmwareImage, error) {
+	query := `
+	SELECT id, component, version, blob_key, size, sha256, md5, notes, created_at
+	FROM firmware_images
+	ORDER BY component, created_at DESC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query firmware images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []*FirmwareImage{}
+	for rows.Next() {
+		var image FirmwareImage
+		err := rows.Scan(
+			&image.ID,
+			&image.Component,
+			&image.Version,
+			&image.BlobKey,
+			&image.Size,
+			&image.SHA256,
+			&image.MD5,
+			&image.Notes,
+			&image.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan firmware image: %w", err)
+		}
+		images = append(images, &image)
+	}
+
+	return images, nil
+}
+
+// GetFirmwareImage retrieves a firmware image by component and version, or nil if it does not exist
+func GetFirmwareImage(component, version string) (*FirmwareImage, error) {
+	query := `
+	SELECT id, component, version, blob_key, size, sha256, md5, notes, created_at
+	FROM firmware_images
+	WHERE component = ? AND version = ?
+	`
+
+	var image FirmwareImage
+	err := db.QueryRow(query, component, version).Scan(
+		&image.ID,
+		&image.Component,
+		&image.Version,
+		&image.BlobKey,
+		&image.Size,
+		&image.SHA256,
+		&image.MD5,
+		&image.Notes,
+		&image.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query firmware image: %w", err)
+	}
+
+	return &image, nil
+}
+
+// DeleteFirmwareImage deletes a firmware image record
+func DeleteFirmwareImage(id int) error {
+	if _, err := db.Exec(`DELETE FROM firmware_images WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete firmware image: %w", err)
+	}
+
+	log.Printf("Deleted firmware image: ID=%d", id)
+	return nil
+}
+
+// SetFirmwareManifest pins a component version for a device ("" = fleet default)
+func SetFirmwareManifest(deviceEUI, component, version string) error {
+	query := `
+	INSERT INTO firmware_manifests (device_eui, component, version, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(device_eui, component) DO UPDATE SET
+		version = excluded.version,
+		updated_at = excluded.updated_at
+	`
+
+	if _, err := db.Exec(query, deviceEUI, component, version, time.Now()); err != nil {
+		return fmt.Errorf("failed to set firmware manifest: %w", err)
+	}
+
+	log.Printf("Set firmware manifest: Device=%q, Component=%s, Version=%s", deviceEUI, component, version)
+	return nil
+}
+
+// DeleteFirmwareManifest removes a device or fleet manifest entry
+func DeleteFirmwareManifest(deviceEUI, component string) error {
+	result, err := db.Exec(`DELETE FROM firmware_manifests WHERE device_eui = ? AND component = ?`, deviceEUI, component)
+	if err != nil {
+		return fmt.Errorf("failed to delete firmware manifest: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("firmware manifest not found: device=%q component=%s", deviceEUI, component)
+	}
+	return nil
+}
+
+// GetFirmwareManifests retrieves all manifest entries (fleet defaults first)
+func GetFirmwareManifests() ([]*FirmwareManifest, error) {
+	query := `
+	SELECT id, device_eui, component, version, updated_at
+	FROM firmware_manifests
+	ORDER BY device_eui, component
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query firmware manifests: %w", err)
+	}
+	defer rows.Close()
+
+	manifests := []*FirmwareManifest{}
+	for rows.Next() {
+		var m FirmwareManifest
+		if err := rows.Scan(&m.ID, &m.DeviceEUI, &m.Component, &m.Version, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan firmware manifest: %w", err)
+		}
+		manifests = append(manifests, &m)
+	}
+
+	return manifests, nil
+}
+
+// CountFirmwareManifestsForVersion returns how many manifest entries pin a component version
+func CountFirmwareManifestsForVersion(component, version string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM firmware_manifests WHERE component = ? AND version = ?`
+	if err := db.QueryRow(query, component, version).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count firmware manifests: %w", err)
+	}
+	return count, nil
+}
+
+// GetFirmwareTarget returns the version a device should run for a component: its own manifest
+// entry if present, otherwise the fleet default. Returns "" if neither is set.
+func GetFirmwareTarget(deviceEUI, component string) (string, error) {
+	query := `
+	SELECT version FROM firmware_manifests
+	WHERE component = ? AND (device_eui = ? OR device_eui = '')
+	ORDER BY device_eui = '' ASC
+	LIMIT 1
+	`
+
+	var version string
+	err := db.QueryRow(query, component, deviceEUI).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query firmware target: %w", err)
+	}
+	return version, nil
+}
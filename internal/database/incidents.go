@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Statuses of an incident
+const (
+	IncidentOpen   = "open"   // Alarms may still join it
+	IncidentClosed = "closed" // No alarm within the incident window of its last one
+)
+
+// Kinds of incident
+const (
+	IncidentDevices = "devices" // Alarms of several devices close together in time
+	IncidentBurst   = "burst"   // A burst of alarms of one device detecting the same objects
+)
+
+// Incident groups alarms raised close together in time, by several devices or in a burst from
+// one, so they are reviewed as one story rather than as separate events
+type Incident struct {
+	ID             int        `json:"id"`
+	Kind           string     `json:"kind"`       // IncidentDevices or IncidentBurst
+	Status         string     `json:"status"`     // IncidentOpen or IncidentClosed
+	StartedAt      time.Time  `json:"started_at"` // Time of the first alarm
+	EndedAt        time.Time  `json:"ended_at"`   // Time of the last alarm so far
+	Devices        []string   `json:"devices"`    // EUIs of the devices that raised its alarms, in order of their first one
+	EventCount     int        `json:"event_count"`
+	Title          string     `json:"title"`                    // Detected objects and device names, e.g. "person, car on Porch, Driveway"
+	ImageEventID   int        `json:"image_event_id,omitempty"` // The alarm whose image represents the incident (0 = none has an image)
+	Narrative      string     `json:"narrative"`                // What happened, with a timeline, as written by the LLM ("" until summarized)
+	NarrativeError string     `json:"narrative_error,omitempty"`
+	SummarizedAt   *time.Time `json:"summarized_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+const incidentColumns = `id, kind, status, started_at, ended_at, devices, event_count, title, image_event_id, narrative, narrative_error, summarized_at, created_at`
+
+// SaveIncident creates an incident (ID 0) or updates its time span, devices, count, title and
+// image, and links the given events to it
+func SaveIncident(inc *Incident, eventIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	devices := strings.Join(inc.Devices, ",")
+	if inc.ID == 0 {
+		now := time.Now()
+		result, err := tx.Exec(`
+		INSERT INTO incidents (kind, status, started_at, ended_at, devices, event_count, title, image_event_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, inc.Kind, IncidentOpen, inc.StartedAt, inc.EndedAt, devices, inc.EventCount, inc.Title, inc.ImageEventID, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert incident: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		inc.ID = int(id)
+		inc.Status = IncidentOpen
+		inc.CreatedAt = now
+	} else {
+		_, err := tx.Exec(`UPDATE incidents SET started_at = ?, ended_at = ?, devices = ?, event_count = ?, title = ?, image_event_id = ? WHERE id = ?`,
+			inc.StartedAt, inc.EndedAt, devices, inc.EventCount, inc.Title, inc.ImageEventID, inc.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update incident: %w", err)
+		}
+	}
+
+	for _, eventID := range eventIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO incident_events (incident_id, event_id) VALUES (?, ?)`, inc.ID, eventID); err != nil {
+			return fmt.Errorf("failed to link event to incident: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// CloseIncident marks an incident closed: no more alarms join it
+func CloseIncident(id int) error {
+	if _, err := db.Exec(`UPDATE incidents SET status = ? WHERE id = ?`, IncidentClosed, id); err != nil {
+		return fmt.Errorf("failed to close incident: %w", err)
+	}
+	return nil
+}
+
+// CloseOpenIncidents closes the incidents left open by a previous run and returns their IDs
+func CloseOpenIncidents() ([]int, error) {
+	rows, err := db.Query(`SELECT id FROM incidents WHERE status = ? ORDER BY id`, IncidentOpen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open incidents: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := CloseIncident(id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// SetIncidentNarrative stores an incident's narrative, or why it could not be written
+func SetIncidentNarrative(id int, narrative, narrativeError string) error {
+	_, err := db.Exec(`UPDATE incidents SET narrative = ?, narrative_error = ?, summarized_at = ? WHERE id = ?`,
+		narrative, narrativeError, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update incident narrative: %w", err)
+	}
+	return nil
+}
+
+// GetIncidents retrieves the incidents of a kind (empty = any) started since the given time,
+// newest first
+func GetIncidents(kind string, since time.Time, limit int) ([]*Incident, error) {
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	query := `SELECT ` + incidentColumns + ` FROM incidents WHERE (? = '' OR kind = ?) AND started_at >= ? ORDER BY started_at DESC LIMIT ?`
+
+	rows, err := db.Query(query, kind, kind, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := []*Incident{}
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, nil
+}
+
+// GetIncidentByID retrieves an incident (nil if it does not exist)
+func GetIncidentByID(id int) (*Incident, error) {
+	row := db.QueryRow(`SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, id)
+	inc, err := scanIncident(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return inc, err
+}
+
+// GetIncidentEvents retrieves the events of an incident, oldest first
+func GetIncidentEvents(id int) ([]*NotificationEvent, error) {
+	query := `
+	SELECT e.id, e.request_id, e.device_eui, e.timestamp, e.text, e.img, e.inference_data, e.sensor_data, e.event_type, e.schema_version, e.tlid, e.task_headline, e.task_prompt, e.suppressed, e.created_at
+	FROM notification_events e
+	JOIN incident_events ie ON ie.event_id = e.id
+	WHERE ie.incident_id = ?
+	ORDER BY e.id
+	`
+	return queryNotificationEvents(query, id)
+}
+
+func scanIncident(row interface{ Scan(...interface{}) error }) (*Incident, error) {
+	var inc Incident
+	var devices string
+	var summarizedAt sql.NullTime
+	err := row.Scan(&inc.ID, &inc.Kind, &inc.Status, &inc.StartedAt, &inc.EndedAt, &devices, &inc.EventCount,
+		&inc.Title, &inc.ImageEventID, &inc.Narrative, &inc.NarrativeError, &summarizedAt, &inc.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan incident: %w", err)
+	}
+	inc.Devices = []string{}
+	if devices != "" {
+		inc.Devices = strings.Split(devices, ",")
+	}
+	if summarizedAt.Valid {
+		inc.SummarizedAt = &summarizedAt.Time
+	}
+	return &inc, nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// VoiceInteraction records one voice exchange: what the device heard and what it answered
+type VoiceInteraction struct {
+	ID            int       `json:"id"`
+	DeviceEUI     string    `json:"device_eui"`
+	SessionID     string    `json:"session_id"`
+	Transcription string    `json:"transcription"`
+	Mode          int       `json:"mode"` // 0=chat, 1=task, 2=task_auto
+	ResponseText  string    `json:"response_text"`
+	InputAudioKey string    `json:"-"`        // Blob key of the uploaded PCM audio (empty if not captured)
+	ReplyAudioKey string    `json:"-"`        // Blob key of the synthesized WAV reply (empty if TTS was unavailable)
+	STTMs         int64     `json:"stt_ms"`   // Time Whisper took to transcribe the audio
+	ModeMs        int64     `json:"mode_ms"`  // Time the LLM took to tell chat from task requests
+	LLMMs         int64     `json:"llm_ms"`   // Time the LLM took to answer, plan the task, or handle a reply to a read-back
+	TTSMs         int64     `json:"tts_ms"`   // Time Piper took to speak the response
+	WriteMs       int64     `json:"write_ms"` // Time sending the response to the device took
+	TotalMs       int64     `json:"total_ms"` // Time from receiving the request to the end of the response (0 for interactions recorded before latencies were)
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SaveVoiceInteraction records a voice exchange
+func SaveVoiceInteraction(v *VoiceInteraction) error {
+	query := `
+	INSERT INTO voice_interactions (device_eui, session_id, transcription, mode, response_text, input_audio_key, reply_audio_key, stt_ms, mode_ms, llm_ms, tts_ms, write_ms, total_ms, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := execRetry(query, v.DeviceEUI, v.SessionID, v.Transcription, v.Mode, v.ResponseText, v.InputAudioKey, v.ReplyAudioKey,
+		v.STTMs, v.ModeMs, v.LLMMs, v.TTSMs, v.WriteMs, v.TotalMs, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert voice interaction: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	v.ID = int(id)
+	v.CreatedAt = now
+	indexInteraction(v)
+	return nil
+}
+
+// GetVoiceInteractions retrieves voice exchanges recorded since the given time, newest first.
+// deviceEUI and sessionID filter the results when non-empty; visibleTo limits them to the
+// devices assigned to that user when non-zero; limit <= 0 means no limit.
+func GetVoiceInteractions(since time.Time, deviceEUI, sessionID string, visibleTo, limit int) ([]*VoiceInteraction, error) {
+	visible, visibleArgs := visibleDevicesClause(visibleTo)
+	query := `
+	SELECT id, device_eui, session_id, transcription, mode, response_text, input_audio_key, reply_audio_key, stt_ms, mode_ms, llm_ms, tts_ms, write_ms, total_ms, created_at
+	FROM voice_interactions
+	WHERE created_at >= ?
+		AND (? = '' OR device_eui = ?)
+		AND (? = '' OR session_id = ?)` + visible + `
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	args := append([]interface{}{since, deviceEUI, deviceEUI, sessionID, sessionID}, visibleArgs...)
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query voice interactions: %w", err)
+	}
+	defer rows.Close()
+
+	interactions := []*VoiceInteraction{}
+	for rows.Next() {
+		v, err := scanVoiceInteraction(rows)
+		if err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, v)
+	}
+
+	return interactions, nil
+}
+
+// GetVoiceInteractionByID retrieves a voice exchange by ID, or nil if it does not exist
+func GetVoiceInteractionByID(id int) (*VoiceInteraction, error) {
+	query := `
+	SELECT id, device_eui, session_id, transcription, mode, response_text, input_audio_key, reply_audio_key, stt_ms, mode_ms, llm_ms, tts_ms, write_ms, total_ms, created_at
+	FROM voice_interactions
+	WHERE id = ?
+	`
+
+	v, err := scanVoiceInteraction(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// scanVoiceInteraction scans one voice_interactions row
+func scanVoiceInteraction(row interface{ Scan(...interface{}) error }) (*VoiceInteraction, error) {
+	var v VoiceInteraction
+	err := row.Scan(
+		&v.ID,
+		&v.DeviceEUI,
+		&v.SessionID,
+		&v.Transcription,
+		&v.Mode,
+		&v.ResponseText,
+		&v.InputAudioKey,
+		&v.ReplyAudioKey,
+		&v.STTMs,
+		&v.ModeMs,
+		&v.LLMMs,
+		&v.TTSMs,
+		&v.WriteMs,
+		&v.TotalMs,
+		&v.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan voice interaction: %w", err)
+	}
+	return &v, nil
+}
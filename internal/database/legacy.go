@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// LegacyTaskFlow is a task flow from a database written by the old root package, which had
+// no model types: its model type is NULL until backfilled from its target objects
+type LegacyTaskFlow struct {
+	ID            int
+	Headline      string
+	TargetObjects []string
+}
+
+// legacySchema reports whether the database has task flows without a model_type column,
+// i.e. was written by the old root package
+func legacySchema() (bool, error) {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'task_flows'`).Scan(&tables); err != nil {
+		return false, err
+	}
+	if tables == 0 {
+		return false, nil
+	}
+
+	var columns int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('task_flows') WHERE name = 'model_type'`).Scan(&columns); err != nil {
+		return false, err
+	}
+	return columns == 0, nil
+}
+
+// GetLegacyTaskFlows retrieves the task flows still without a model type
+func GetLegacyTaskFlows() ([]*LegacyTaskFlow, error) {
+	rows, err := db.Query(`SELECT id, headline, target_objects FROM task_flows WHERE model_type IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legacy task flows: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*LegacyTaskFlow
+	for rows.Next() {
+		var tf LegacyTaskFlow
+		var targets sql.NullString
+		if err := rows.Scan(&tf.ID, &tf.Headline, &targets); err != nil {
+			return nil, fmt.Errorf("failed to scan legacy task flow: %w", err)
+		}
+		// Target objects are a JSON array, but a plain name is taken as the only target
+		if targets.String != "" && json.Unmarshal([]byte(targets.String), &tf.TargetObjects) != nil {
+			tf.TargetObjects = []string{targets.String}
+		}
+		tasks = append(tasks, &tf)
+	}
+	return tasks, rows.Err()
+}
+
+// SetTaskFlowModelType sets the model type of a task flow
+func SetTaskFlowModelType(id, modelType int) error {
+	if _, err := db.Exec(`UPDATE task_flows SET model_type = ? WHERE id = ?`, modelType, id); err != nil {
+		return fmt.Errorf("failed to set model type of task flow %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// InferenceMetric records one AI pipeline call, tagged with the device's release channel
+type InferenceMetric struct {
+	ID            int       `json:"id"`
+	DeviceEUI     string    `json:"device_eui"`
+	Channel       string    `json:"channel"` // "stable" or "canary"
+	Kind          string    `json:"kind"`    // "monitoring", "recognize", "chat" or "task"
+	Model         string    `json:"model"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Detected      bool      `json:"detected"`       // Monitoring call reported an event
+	FalsePositive bool      `json:"false_positive"` // Detection marked wrong by the user
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SaveInferenceMetric records an AI pipeline call
+func SaveInferenceMetric(m *InferenceMetric) error {
+	query := `
+	INSERT INTO inference_metrics (device_eui, channel, kind, model, latency_ms, detected, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := execRetry(query, m.DeviceEUI, m.Channel, m.Kind, m.Model, m.LatencyMs, m.Detected, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert inference metric: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	m.ID = int(id)
+	m.CreatedAt = now
+	return nil
+}
+
+// GetInferenceMetrics retrieves metrics recorded since the given time, newest first.
+// deviceEUI and channel filter the results when non-empty; visibleTo limits them to the devices
+// assigned to that user when non-zero; limit <= 0 means no limit.
+func GetInferenceMetrics(since time.Time, deviceEUI, channel string, visibleTo, limit int) ([]*InferenceMetric, error) {
+	visible, visibleArgs := visibleDevicesClause(visibleTo)
+	query := `
+	SELECT id, device_eui, channel, kind, model, latency_ms, detected, false_positive, created_at
+	FROM inference_metrics
+	WHERE created_at >= ?
+		AND (? = '' OR device_eui = ?)
+		AND (? = '' OR channel = ?)` + visible + `
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	args := append([]interface{}{since, deviceEUI, deviceEUI, channel, channel}, visibleArgs...)
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inference metrics: %w", err)
+	}
+	defer rows.Close()
+
+	metrics := []*InferenceMetric{}
+	for rows.Next() {
+		var m InferenceMetric
+		err := rows.Scan(
+			&m.ID,
+			&m.DeviceEUI,
+			&m.Channel,
+			&m.Kind,
+			&m.Model,
+			&m.LatencyMs,
+			&m.Detected,
+			&m.FalsePositive,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan inference metric: %w", err)
+		}
+		metrics = append(metrics, &m)
+	}
+
+	return metrics, nil
+}
+
+// SetInferenceFalsePositive marks (or unmarks) a detection as a false positive
+func SetInferenceFalsePositive(id int, falsePositive bool) error {
+	result, err := db.Exec(`UPDATE inference_metrics SET false_positive = ? WHERE id = ? AND detected = 1`, falsePositive, id)
+	if err != nil {
+		return fmt.Errorf("failed to update inference metric: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("detection not found: %d", id)
+	}
+
+	log.Printf("Marked inference %d false_positive=%v", id, falsePositive)
+	return nil
+}
+
+// InferenceTotals are the all-time counts of AI calls for one device, channel, and kind of call
+type InferenceTotals struct {
+	DeviceEUI      string
+	Channel        string
+	Kind           string
+	Requests       int64
+	Detections     int64
+	FalsePositives int64
+}
+
+// GetInferenceTotals returns all-time AI call counts grouped by device, channel, and kind
+func GetInferenceTotals() ([]*InferenceTotals, error) {
+	query := `
+	SELECT device_eui, channel, kind, COUNT(*), SUM(detected), SUM(false_positive)
+	FROM inference_metrics
+	GROUP BY device_eui, channel, kind
+	ORDER BY device_eui, channel, kind
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inference totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []*InferenceTotals{}
+	for rows.Next() {
+		var t InferenceTotals
+		if err := rows.Scan(&t.DeviceEUI, &t.Channel, &t.Kind, &t.Requests, &t.Detections, &t.FalsePositives); err != nil {
+			return nil, fmt.Errorf("failed to scan inference totals: %w", err)
+		}
+		totals = append(totals, &t)
+	}
+
+	return totals, nil
+}
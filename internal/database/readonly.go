@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// readOnly is set when the database was opened with InitializeReadOnly
+var readOnly bool
+
+// InitializeReadOnly opens an existing database without writing to it, e.g. a copy of a
+// production database for analysis. Tables are not created or migrated: the database must
+// already have the schema of this version (start a normal server on a copy once to migrate it).
+func InitializeReadOnly(dbPath string) error {
+	var err error
+	db, err = sql.Open(driverName, "file:"+url.PathEscape(dbPath)+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("failed to open %s read-only: %w", dbPath, err)
+	}
+	if err := checkSchema(); err != nil {
+		return err
+	}
+	checkSearchIndex()
+
+	readOnly = true
+	log.Printf("Database opened read-only: %s", dbPath)
+	return nil
+}
+
+// ReadOnly reports whether the database was opened read-only
+func ReadOnly() bool {
+	return readOnly
+}
+
+// checkSchema fails if the database lacks tables or columns of the current schema
+func checkSchema() error {
+	current, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+	current.SetMaxOpenConns(1) // Every connection would get its own empty in-memory database
+	if _, err := current.Exec(schema); err != nil {
+		return fmt.Errorf("failed to build the current schema: %w", err)
+	}
+
+	want, err := schemaColumns(current)
+	if err != nil {
+		return err
+	}
+	have, err := schemaColumns(db)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for table, columns := range want {
+		if have[table] == nil {
+			missing = append(missing, table)
+			continue
+		}
+		for column := range columns {
+			if !have[table][column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("database is older than this server (missing %s); start a server without read-only mode on a copy once to migrate it",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// schemaColumns returns the columns of every table of a database
+func schemaColumns(conn *sql.DB) (map[string]map[string]bool, error) {
+	// Virtual tables (the search index) are left out: without their module they cannot be read
+	rows, err := conn.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND sql NOT LIKE 'CREATE VIRTUAL TABLE%'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	columns := make(map[string]map[string]bool, len(tables))
+	for _, table := range tables {
+		rows, err := conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list columns of %s: %w", table, err)
+		}
+		columns[table] = make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to list columns of %s: %w", table, err)
+			}
+			columns[table][name] = true
+		}
+		rows.Close()
+	}
+	return columns, nil
+}
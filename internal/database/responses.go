@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SaveAudioResponse stores the multipart voice response sent for a device session and the
+// SHA-256 of the recording it answered, replacing any earlier one, so a retried request can be
+// answered without re-running the pipeline
+func SaveAudioResponse(deviceEUI, sessionID, bodySHA256 string, response []byte) error {
+	query := `
+	INSERT INTO audio_responses (device_eui, session_id, body_sha256, response, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(device_eui, session_id) DO UPDATE SET
+		body_sha256 = excluded.body_sha256,
+		response = excluded.response,
+		created_at = excluded.created_at
+	`
+
+	if _, err := execRetry(query, deviceEUI, sessionID, bodySHA256, response, time.Now()); err != nil {
+		return fmt.Errorf("failed to save audio response: %w", err)
+	}
+	return nil
+}
+
+// GetAudioResponse returns the response stored for a device session if it answered the
+// recording with the given SHA-256 and is newer than since, or nil if there is none
+func GetAudioResponse(deviceEUI, sessionID, bodySHA256 string, since time.Time) ([]byte, error) {
+	query := `SELECT response FROM audio_responses WHERE device_eui = ? AND session_id = ? AND body_sha256 = ? AND created_at >= ?`
+
+	var response []byte
+	err := db.QueryRow(query, deviceEUI, sessionID, bodySHA256, since).Scan(&response)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audio response: %w", err)
+	}
+	return response, nil
+}
+
+// DeleteAudioResponsesBefore removes stored responses older than the given time
+func DeleteAudioResponsesBefore(before time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM audio_responses WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audio responses: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kinds of search results
+const (
+	SearchEvent       = "event"       // A notification event: alarm text, RECOGNIZE answers of the vision model, task headline
+	SearchInteraction = "interaction" // A voice interaction: transcription and response
+)
+
+// searchSchema holds the full-text indexes. They are FTS5 tables, so they are created apart
+// from schema: SQLite only has FTS5 when the server is built with -tags sqlite_fts5. The rowid
+// of each is the ID of the row it indexes.
+const searchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS event_search USING fts5(text, headline, tokenize = 'porter unicode61');
+	CREATE VIRTUAL TABLE IF NOT EXISTS interaction_search USING fts5(transcription, response, tokenize = 'porter unicode61');
+`
+
+// searchAvailable is set when the full-text indexes can be used
+var searchAvailable bool
+
+// SearchAvailable reports whether full-text search works with this build and database
+func SearchAvailable() bool {
+	return searchAvailable
+}
+
+// createSearchIndex creates the full-text indexes and indexes the rows stored while they did
+// not exist (or by a server without FTS5). Search is left unavailable, not failed, without FTS5.
+func createSearchIndex() error {
+	if _, err := db.Exec(searchSchema); err != nil {
+		if noFTS5(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	// Rows are indexed in ID order, so everything above the highest indexed ID is missing.
+	// Index entries of deleted rows are dropped here too; until then the join hides them.
+	catchUp := []string{
+		`INSERT INTO event_search (rowid, text, headline)
+		SELECT id, COALESCE(text, ''), task_headline FROM notification_events
+		WHERE id > (SELECT COALESCE(MAX(rowid), 0) FROM event_search) AND (COALESCE(text, '') != '' OR task_headline != '')`,
+		`INSERT INTO interaction_search (rowid, transcription, response)
+		SELECT id, transcription, response_text FROM voice_interactions
+		WHERE id > (SELECT COALESCE(MAX(rowid), 0) FROM interaction_search)`,
+		`DELETE FROM event_search WHERE rowid NOT IN (SELECT id FROM notification_events)`,
+		`DELETE FROM interaction_search WHERE rowid NOT IN (SELECT id FROM voice_interactions)`,
+	}
+	for _, query := range catchUp {
+		if _, err := db.Exec(query); err != nil {
+			if noFTS5(err) { // The indexes exist, but this build cannot use them
+				return nil
+			}
+			return fmt.Errorf("failed to update search index: %w", err)
+		}
+	}
+
+	searchAvailable = true
+	return nil
+}
+
+// noFTS5 reports whether err is SQLite lacking FTS5, logging that search is unavailable
+func noFTS5(err error) bool {
+	if !strings.Contains(err.Error(), "no such module: fts5") {
+		return false
+	}
+	log.Printf("WARNING: Full-text search is unavailable: SQLite was built without FTS5 (build the server with -tags sqlite_fts5)")
+	return true
+}
+
+// checkSearchIndex makes search available on a read-only database that has the indexes
+func checkSearchIndex() {
+	var n int
+	searchAvailable = db.QueryRow(`SELECT COUNT(*) FROM event_search WHERE rowid = 0`).Scan(&n) == nil &&
+		db.QueryRow(`SELECT COUNT(*) FROM interaction_search WHERE rowid = 0`).Scan(&n) == nil
+}
+
+// indexEvent adds a stored event to the search index
+func indexEvent(event *NotificationEvent) {
+	if !searchAvailable || (event.Text == "" && event.TaskHeadline == "") {
+		return
+	}
+	if _, err := execRetry(`INSERT INTO event_search (rowid, text, headline) VALUES (?, ?, ?)`, event.ID, event.Text, event.TaskHeadline); err != nil {
+		log.Printf("WARNING: Failed to index event %d: %v", event.ID, err)
+	}
+}
+
+// indexInteraction adds a stored voice interaction to the search index
+func indexInteraction(v *VoiceInteraction) {
+	if !searchAvailable {
+		return
+	}
+	if _, err := execRetry(`INSERT INTO interaction_search (rowid, transcription, response) VALUES (?, ?, ?)`, v.ID, v.Transcription, v.ResponseText); err != nil {
+		log.Printf("WARNING: Failed to index voice interaction %d: %v", v.ID, err)
+	}
+}
+
+// SearchQuery selects the results of Search
+type SearchQuery struct {
+	Text      string    // Words to look for; a result matches any of them
+	Since     time.Time // Only rows stored since then (zero = any time)
+	DeviceEUI string    // Only this device (empty = all)
+	VisibleTo int       // Only the devices assigned to this user (0 = all)
+	Limit     int
+}
+
+// SearchResult is an event or voice interaction matching a search
+type SearchResult struct {
+	Kind      string    `json:"kind"` // SearchEvent or SearchInteraction
+	ID        int       `json:"id"`   // ID of the event or interaction
+	DeviceEUI string    `json:"device_eui"`
+	EventType string    `json:"event_type,omitempty"` // Events: the event type
+	Text      string    `json:"text"`                 // Events: the event text; interactions: the transcription
+	Headline  string    `json:"headline,omitempty"`   // Events: headline of the task the event belongs to
+	Response  string    `json:"response,omitempty"`   // Interactions: what the device answered
+	HasImage  bool      `json:"-"`
+	Rank      float64   `json:"rank"` // BM25 relevance, lower is more relevant
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Search finds the events and voice interactions matching the words of q.Text, most relevant
+// first. Words are matched by stem ("deliveries" finds "delivery"); the more of them a row
+// has, and the rarer they are, the higher it ranks.
+func Search(q SearchQuery) ([]*SearchResult, error) {
+	if !searchAvailable {
+		return nil, fmt.Errorf("full-text search is unavailable")
+	}
+	match := searchMatch(q.Text)
+	if match == "" {
+		return []*SearchResult{}, nil
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	visible, visibleArgs := visibleDevicesClause(q.VisibleTo)
+
+	eventQuery := `
+	SELECT e.id, e.device_eui, e.event_type, COALESCE(e.text, ''), e.task_headline, '', e.img IS NOT NULL AND e.img != '', bm25(event_search), e.created_at
+	FROM event_search JOIN notification_events e ON e.id = event_search.rowid
+	WHERE event_search MATCH ? AND e.created_at >= ?
+		AND (? = '' OR device_eui = ?)` + visible + `
+	ORDER BY bm25(event_search)
+	LIMIT ?
+	`
+	interactionQuery := `
+	SELECT v.id, v.device_eui, '', v.transcription, '', v.response_text, 0, bm25(interaction_search), v.created_at
+	FROM interaction_search JOIN voice_interactions v ON v.id = interaction_search.rowid
+	WHERE interaction_search MATCH ? AND v.created_at >= ?
+		AND (? = '' OR device_eui = ?)` + visible + `
+	ORDER BY bm25(interaction_search)
+	LIMIT ?
+	`
+
+	results := []*SearchResult{}
+	for _, source := range []struct{ kind, query string }{{SearchEvent, eventQuery}, {SearchInteraction, interactionQuery}} {
+		args := append([]interface{}{match, q.Since, q.DeviceEUI, q.DeviceEUI}, visibleArgs...)
+		rows, err := db.Query(source.query, append(args, limit)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %ss: %w", source.kind, err)
+		}
+		for rows.Next() {
+			r := &SearchResult{Kind: source.kind}
+			if err := rows.Scan(&r.ID, &r.DeviceEUI, &r.EventType, &r.Text, &r.Headline, &r.Response, &r.HasImage, &r.Rank, &r.CreatedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan search result: %w", err)
+			}
+			results = append(results, r)
+		}
+		rows.Close()
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank < results[j].Rank })
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// searchMatch turns free text into an FTS5 query matching any of its words. Every word is
+// quoted, so the query syntax (AND, NEAR, column filters, ...) never applies to user input.
+func searchMatch(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " OR ")
+}
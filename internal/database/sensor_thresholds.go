@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SensorThreshold is a limit on one sensor metric of a device. A reading outside the limits
+// breaches it, and the threshold stays breached until a reading is back inside them; each
+// change is stored as an EventThreshold notification event.
+type SensorThreshold struct {
+	ID        int        `json:"id"`
+	DeviceEUI string     `json:"device_eui"`
+	Metric    string     `json:"metric"` // One of SensorMetrics
+	Above     *float64   `json:"above"`  // Breached by readings above this (nil = no upper limit)
+	Below     *float64   `json:"below"`  // Breached by readings below this (nil = no lower limit)
+	Enabled   bool       `json:"enabled"`
+	Breached  bool       `json:"breached"`   // The last reading was outside the limits
+	ChangedAt *time.Time `json:"changed_at"` // When it was last breached or cleared
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const sensorThresholdColumns = `id, device_eui, metric, above, below, enabled, breached, changed_at, created_at`
+
+// CreateSensorThreshold stores a new threshold
+func CreateSensorThreshold(t *SensorThreshold) error {
+	query := `
+	INSERT INTO sensor_thresholds (device_eui, metric, above, below, enabled, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query, t.DeviceEUI, t.Metric, t.Above, t.Below, t.Enabled, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert sensor threshold: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	t.ID = int(id)
+	t.CreatedAt = now
+	return nil
+}
+
+// UpdateSensorThreshold replaces a device's threshold, reporting whether it exists. The
+// threshold starts out cleared again, since the old state was judged against the old limits.
+func UpdateSensorThreshold(t *SensorThreshold) (bool, error) {
+	query := `
+	UPDATE sensor_thresholds
+	SET metric = ?, above = ?, below = ?, enabled = ?, breached = 0, changed_at = NULL
+	WHERE id = ? AND device_eui = ?
+	`
+
+	result, err := db.Exec(query, t.Metric, t.Above, t.Below, t.Enabled, t.ID, t.DeviceEUI)
+	if err != nil {
+		return false, fmt.Errorf("failed to update sensor threshold: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update sensor threshold: %w", err)
+	}
+	t.Breached, t.ChangedAt = false, nil
+	return n > 0, nil
+}
+
+// DeleteSensorThreshold removes a device's threshold, reporting whether it existed
+func DeleteSensorThreshold(deviceEUI string, id int) (bool, error) {
+	result, err := db.Exec(`DELETE FROM sensor_thresholds WHERE id = ? AND device_eui = ?`, id, deviceEUI)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete sensor threshold: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete sensor threshold: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetSensorThresholds retrieves a device's thresholds (only enabled ones if enabledOnly), oldest first
+func GetSensorThresholds(deviceEUI string, enabledOnly bool) ([]*SensorThreshold, error) {
+	query := `SELECT ` + sensorThresholdColumns + ` FROM sensor_thresholds WHERE device_eui = ? AND (? = 0 OR enabled = 1) ORDER BY id`
+
+	rows, err := db.Query(query, deviceEUI, enabledOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sensor thresholds: %w", err)
+	}
+	defer rows.Close()
+
+	thresholds := []*SensorThreshold{}
+	for rows.Next() {
+		t, err := scanSensorThreshold(rows)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// GetSensorThreshold retrieves a device's threshold (nil if it does not exist)
+func GetSensorThreshold(deviceEUI string, id int) (*SensorThreshold, error) {
+	t, err := scanSensorThreshold(db.QueryRow(`SELECT `+sensorThresholdColumns+` FROM sensor_thresholds WHERE id = ? AND device_eui = ?`, id, deviceEUI))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// MarkSensorThreshold records that a threshold was breached or cleared
+func MarkSensorThreshold(id int, breached bool, at time.Time) error {
+	if _, err := db.Exec(`UPDATE sensor_thresholds SET breached = ?, changed_at = ? WHERE id = ?`, breached, at, id); err != nil {
+		return fmt.Errorf("failed to mark sensor threshold %d: %w", id, err)
+	}
+	return nil
+}
+
+func scanSensorThreshold(row interface{ Scan(...interface{}) error }) (*SensorThreshold, error) {
+	var t SensorThreshold
+	var above, below sql.NullFloat64
+	var changed sql.NullTime
+	err := row.Scan(&t.ID, &t.DeviceEUI, &t.Metric, &above, &below, &t.Enabled, &t.Breached, &changed, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sensor threshold: %w", err)
+	}
+	if above.Valid {
+		t.Above = &above.Float64
+	}
+	if below.Valid {
+		t.Below = &below.Float64
+	}
+	if changed.Valid {
+		t.ChangedAt = &changed.Time
+	}
+	return &t, nil
+}
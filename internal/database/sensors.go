@@ -0,0 +1,249 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Sensor metrics reported in notification events
+const (
+	SensorTemperature = "temperature" // Celsius
+	SensorHumidity    = "humidity"    // Percentage (0-100)
+	SensorCO2         = "co2"         // PPM
+)
+
+// SensorMetrics lists the valid sensor metrics
+var SensorMetrics = []string{SensorTemperature, SensorHumidity, SensorCO2}
+
+// SensorPoint is one downsampled bucket of a sensor time series
+type SensorPoint struct {
+	Timestamp int64   `json:"ts"` // Bucket start, Unix milliseconds
+	Avg       float64 `json:"avg"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Count     int     `json:"count"` // Readings in the bucket
+}
+
+// SaveSensorReadings stores the readings of one notification event, keyed by metric
+func SaveSensorReadings(deviceEUI string, ts time.Time, values map[string]float64) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return retryBusy(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for metric, value := range values {
+			_, err := tx.Exec(`INSERT INTO sensor_readings (device_eui, metric, ts, value) VALUES (?, ?, ?, ?)`,
+				deviceEUI, metric, ts.UnixMilli(), value)
+			if err != nil {
+				return fmt.Errorf("failed to insert sensor reading: %w", err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit sensor readings: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetSensorSeries returns a device's readings of one metric in [from, to), averaged
+// into buckets of the given width (oldest first). Empty buckets are omitted.
+func GetSensorSeries(deviceEUI, metric string, from, to time.Time, bucket time.Duration) ([]SensorPoint, error) {
+	query := `
+	SELECT (ts / ?) * ? AS bucket, AVG(value), MIN(value), MAX(value), COUNT(*)
+	FROM sensor_readings
+	WHERE device_eui = ? AND metric = ? AND ts >= ? AND ts < ?
+	GROUP BY bucket
+	ORDER BY bucket
+	`
+
+	width := bucket.Milliseconds()
+	if width <= 0 {
+		width = 1
+	}
+
+	rows, err := db.Query(query, width, width, deviceEUI, metric, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sensor readings: %w", err)
+	}
+	defer rows.Close()
+
+	points := []SensorPoint{}
+	for rows.Next() {
+		var p SensorPoint
+		if err := rows.Scan(&p.Timestamp, &p.Avg, &p.Min, &p.Max, &p.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan sensor reading: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+// backfillSensorReadings copies the readings of existing notification events
+// (stored as JSON in sensor_data) into sensor_readings
+func backfillSensorReadings() error {
+	rows, err := db.Query(`SELECT device_eui, timestamp, sensor_data, created_at FROM notification_events WHERE sensor_data != ''`)
+	if err != nil {
+		return fmt.Errorf("failed to query notification events: %w", err)
+	}
+
+	type eventReadings struct {
+		deviceEUI string
+		ts        time.Time
+		values    map[string]float64
+	}
+	var events []eventReadings
+	for rows.Next() {
+		var deviceEUI, sensorJSON string
+		var timestamp int64
+		var createdAt time.Time
+		if err := rows.Scan(&deviceEUI, &timestamp, &sensorJSON, &createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan notification event: %w", err)
+		}
+
+		var sensor struct {
+			Temperature *float64 `json:"temperature"`
+			Humidity    *float64 `json:"humidity"`
+			CO2         *float64 `json:"CO2"`
+		}
+		if err := json.Unmarshal([]byte(sensorJSON), &sensor); err != nil {
+			continue
+		}
+
+		values := make(map[string]float64)
+		if sensor.Temperature != nil {
+			values[SensorTemperature] = *sensor.Temperature
+		}
+		if sensor.Humidity != nil {
+			values[SensorHumidity] = *sensor.Humidity
+		}
+		if sensor.CO2 != nil {
+			values[SensorCO2] = *sensor.CO2
+		}
+
+		ts := createdAt
+		if timestamp > 0 {
+			ts = time.UnixMilli(timestamp)
+		}
+		events = append(events, eventReadings{deviceEUI, ts, values})
+	}
+	rows.Close()
+
+	for _, e := range events {
+		if err := SaveSensorReadings(e.deviceEUI, e.ts, e.values); err != nil {
+			return err
+		}
+	}
+
+	if len(events) > 0 {
+		log.Printf("Backfilled sensor readings from %d notification events", len(events))
+	}
+	return nil
+}
+
+// SensorReading is one stored sensor value
+type SensorReading struct {
+	ID        int64 // Row ID, increasing in insertion order
+	DeviceEUI string
+	Metric    string
+	Timestamp int64 // Unix milliseconds
+	Value     float64
+}
+
+// GetSensorReadingsAfter returns up to limit readings stored after the given row ID, oldest first
+func GetSensorReadingsAfter(afterID int64, limit int) ([]*SensorReading, error) {
+	query := `
+	SELECT rowid, device_eui, metric, ts, value
+	FROM sensor_readings
+	WHERE rowid > ?
+	ORDER BY rowid
+	LIMIT ?
+	`
+
+	rows, err := db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sensor readings: %w", err)
+	}
+	defer rows.Close()
+
+	readings := []*SensorReading{}
+	for rows.Next() {
+		var r SensorReading
+		if err := rows.Scan(&r.ID, &r.DeviceEUI, &r.Metric, &r.Timestamp, &r.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan sensor reading: %w", err)
+		}
+		readings = append(readings, &r)
+	}
+
+	return readings, nil
+}
+
+// SensorReadingQuery selects a page of stored sensor readings
+type SensorReadingQuery struct {
+	Devices  []string       // Only these devices (nil = all devices)
+	Metric   string         // Only this metric ("" = all)
+	From, To time.Time      // Only readings taken in [From, To)
+	After    *SensorReading // Only readings after this one in (Timestamp, ID) order (nil = from the start)
+	Limit    int
+}
+
+// GetSensorReadings retrieves the readings selected by q, ordered by time (and row ID for
+// readings taken at the same time). Pass the last reading as q.After to get the next page.
+func GetSensorReadings(q SensorReadingQuery) ([]*SensorReading, error) {
+	query := `
+	SELECT rowid, device_eui, metric, ts, value
+	FROM sensor_readings
+	WHERE ts >= ? AND ts < ? AND (? = '' OR metric = ?)`
+	args := []interface{}{q.From.UnixMilli(), q.To.UnixMilli(), q.Metric, q.Metric}
+	if q.Devices != nil {
+		if len(q.Devices) == 0 {
+			return []*SensorReading{}, nil
+		}
+		query += ` AND device_eui IN (?` + strings.Repeat(", ?", len(q.Devices)-1) + `)`
+		for _, eui := range q.Devices {
+			args = append(args, eui)
+		}
+	}
+	if q.After != nil {
+		query += ` AND (ts > ? OR (ts = ? AND rowid > ?))`
+		args = append(args, q.After.Timestamp, q.After.Timestamp, q.After.ID)
+	}
+	query += ` ORDER BY ts, rowid LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sensor readings: %w", err)
+	}
+	defer rows.Close()
+
+	readings := []*SensorReading{}
+	for rows.Next() {
+		var r SensorReading
+		if err := rows.Scan(&r.ID, &r.DeviceEUI, &r.Metric, &r.Timestamp, &r.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan sensor reading: %w", err)
+		}
+		readings = append(readings, &r)
+	}
+	return readings, nil
+}
+
+// LastSensorReadingID returns the row ID of the newest stored reading (0 if there are none)
+func LastSensorReadingID() (int64, error) {
+	var id int64
+	if err := db.QueryRow(`SELECT COALESCE(MAX(rowid), 0) FROM sensor_readings`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get last sensor reading: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import "sync"
+
+// signal wakes up the waiters of a change: wait returns a channel that is closed at the next
+// notify. Waiters recheck what they are interested in.
+type signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func (s *signal) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+func (s *signal) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
+
+var (
+	taskChanges  signal // Changes to the task flows devices are served (view_task_detail long polls)
+	eventsStored signal // New notification events (event streams)
+)
+
+// TaskFlowsChanged returns a channel that is closed at the next change to any device's served
+// task: a task created, activated, deleted, paused or resumed. Waiters recheck their device.
+func TaskFlowsChanged() <-chan struct{} {
+	return taskChanges.wait()
+}
+
+// notifyTaskFlowsChanged wakes up the waiters of TaskFlowsChanged
+func notifyTaskFlowsChanged() {
+	taskChanges.notify()
+}
+
+// EventsStored returns a channel that is closed when the next notification event is stored.
+// Waiters load the events after the last one they have seen.
+func EventsStored() <-chan struct{} {
+	return eventsStored.wait()
+}
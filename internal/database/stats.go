@@ -0,0 +1,51 @@
+package database
+
+import "fmt"
+
+// Stats describes the size of the database
+type Stats struct {
+	SizeBytes     int64            `json:"size_bytes"`     // Pages in use and free, as on disk (without the WAL)
+	FreeBytes     int64            `json:"free_bytes"`     // Free pages, reclaimed by VACUUM
+	JournalMode   string           `json:"journal_mode"`   // e.g. "delete" or "wal"
+	SQLiteVersion string           `json:"sqlite_version"` // Version of the linked SQLite library
+	ReadOnly      bool             `json:"read_only"`
+	Rows          map[string]int64 `json:"rows"` // Row count of each table
+}
+
+// GetStats returns the size of the database and the row count of every table
+func GetStats() (*Stats, error) {
+	stats := &Stats{ReadOnly: readOnly, Rows: make(map[string]int64)}
+
+	var pageSize, pageCount, freePages int64
+	if err := db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return nil, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := db.QueryRow(`PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return nil, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := db.QueryRow(`PRAGMA freelist_count`).Scan(&freePages); err != nil {
+		return nil, fmt.Errorf("failed to read free pages: %w", err)
+	}
+	stats.SizeBytes, stats.FreeBytes = pageSize*pageCount, pageSize*freePages
+
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&stats.JournalMode); err != nil {
+		return nil, fmt.Errorf("failed to read journal mode: %w", err)
+	}
+	if err := db.QueryRow(`SELECT sqlite_version()`).Scan(&stats.SQLiteVersion); err != nil {
+		return nil, fmt.Errorf("failed to read SQLite version: %w", err)
+	}
+
+	tables, err := schemaColumns(db)
+	if err != nil {
+		return nil, err
+	}
+	for table := range tables {
+		var count int64
+		// Table names come from sqlite_master, not from the request
+		if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, table)).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", table, err)
+		}
+		stats.Rows[table] = count
+	}
+	return stats, nil
+}
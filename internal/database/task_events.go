@@ -0,0 +1,346 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// EventBucket counts a task's alarms in one hour or day
+type EventBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// TaskEventStats summarizes how often a task fires
+type TaskEventStats struct {
+	TLID          int           `json:"tlid"`
+	Since         time.Time     `json:"since"`           // Start of the window (not before the task was created)
+	Alarms        int           `json:"alarms"`          // Alarms in the window
+	Suppressed    int           `json:"suppressed"`      // Alarms in the window that arrived during the task's cooldown
+	Total         int           `json:"total"`           // Alarms since the task was created
+	PerHour       float64       `json:"per_hour"`        // Average alarms per hour over the window
+	PerDay        float64       `json:"per_day"`         // Average alarms per day over the window
+	LastTriggerAt *time.Time    `json:"last_trigger_at"` // nil if the task never fired
+	Hourly        []EventBucket `json:"hourly"`          // Last 24 hours, oldest first
+	Daily         []EventBucket `json:"daily"`           // Days of the window, oldest first
+}
+
+// GetNotificationEventsByTask retrieves a task's events created since the given time, newest first
+func GetNotificationEventsByTask(tlid int, since time.Time, limit int) ([]*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE tlid = ? AND created_at >= ?
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	rows, err := db.Query(query, tlid, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*NotificationEvent{}
+	for rows.Next() {
+		var event NotificationEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.RequestID,
+			&event.DeviceEUI,
+			&event.Timestamp,
+			&event.Text,
+			&event.Img,
+			&event.InferenceData,
+			&event.SensorData,
+			&event.EventType,
+			&event.SchemaVersion,
+			&event.TLID,
+			&event.TaskHeadline,
+			&event.TaskPrompt,
+			&event.Suppressed,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+
+	// Upgrade after the query is done (SQLite cannot write while the result set holds its read lock)
+	for _, event := range events {
+		if err := upgradeEvent(event); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// GetTaskEventStats counts a task's alarms over the last days, bucketed by hour and day.
+// Only alarm events count as triggers; telemetry about the task (pauses, watchdog alerts) does not.
+func GetTaskEventStats(task *TaskFlow, days int) (*TaskEventStats, error) {
+	now := time.Now()
+	year, month, day := now.Date()
+	since := time.Date(year, month, day-days+1, 0, 0, 0, 0, now.Location())
+
+	stats := &TaskEventStats{
+		TLID:   task.ID,
+		Since:  since,
+		Hourly: []EventBucket{},
+		Daily:  []EventBucket{},
+	}
+	if task.CreatedAt.After(since) {
+		stats.Since = task.CreatedAt
+	}
+
+	err := db.QueryRow(`SELECT COUNT(*) FROM notification_events WHERE tlid = ? AND event_type = ?`, task.ID, EventAlarm).Scan(&stats.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count task alarms: %w", err)
+	}
+
+	rows, err := db.Query(`
+	SELECT created_at, suppressed FROM notification_events
+	WHERE tlid = ? AND event_type = ? AND created_at >= ?
+	ORDER BY created_at
+	`, task.ID, EventAlarm, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task alarms: %w", err)
+	}
+	defer rows.Close()
+
+	var alarms []time.Time
+	for rows.Next() {
+		var at time.Time
+		var suppressed bool
+		if err := rows.Scan(&at, &suppressed); err != nil {
+			return nil, fmt.Errorf("failed to scan task alarm: %w", err)
+		}
+		alarms = append(alarms, at)
+		if suppressed {
+			stats.Suppressed++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task alarms: %w", err)
+	}
+
+	for d := 0; d < days; d++ {
+		stats.Daily = append(stats.Daily, EventBucket{Start: since.AddDate(0, 0, d)})
+	}
+	firstHour := now.Truncate(time.Hour).Add(-23 * time.Hour)
+	for h := 0; h < 24; h++ {
+		stats.Hourly = append(stats.Hourly, EventBucket{Start: firstHour.Add(time.Duration(h) * time.Hour)})
+	}
+
+	for _, at := range alarms {
+		at = at.In(now.Location())
+		stats.Alarms++
+		if d := daysBetween(since, at); d >= 0 && d < days {
+			stats.Daily[d].Count++
+		}
+		if h := int(at.Sub(firstHour) / time.Hour); !at.Before(firstHour) && h < 24 {
+			stats.Hourly[h].Count++
+		}
+	}
+	if len(alarms) > 0 {
+		last := alarms[len(alarms)-1]
+		stats.LastTriggerAt = &last
+	} else if stats.Total > 0 {
+		// Last alarm is older than the window
+		var last time.Time
+		err := db.QueryRow(`
+		SELECT created_at FROM notification_events
+		WHERE tlid = ? AND event_type = ?
+		ORDER BY created_at DESC LIMIT 1
+		`, task.ID, EventAlarm).Scan(&last)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query last task alarm: %w", err)
+		}
+		stats.LastTriggerAt = &last
+	}
+
+	if hours := now.Sub(stats.Since).Hours(); hours > 0 {
+		// Windows shorter than an hour would inflate the rate
+		stats.PerHour = float64(stats.Alarms) / max(hours, 1)
+		stats.PerDay = float64(stats.Alarms) / max(hours/24, 1)
+	}
+	return stats, nil
+}
+
+// LastActionedAlarmAt returns when a task's last alarm outside its cooldown was stored, or nil if there is none
+func LastActionedAlarmAt(tlid int) (*time.Time, error) {
+	query := `
+	SELECT created_at FROM notification_events
+	WHERE tlid = ? AND event_type = ? AND suppressed = 0
+	ORDER BY created_at DESC LIMIT 1
+	`
+
+	var at time.Time
+	err := db.QueryRow(query, tlid, EventAlarm).Scan(&at)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query last actioned alarm: %w", err)
+	}
+	return &at, nil
+}
+
+// SetTaskCooldown sets a task's server-side cooldown. Returns false if the task does not exist.
+func SetTaskCooldown(id int, seconds int) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET cooldown_seconds = ?, updated_at = ? WHERE id = ?`, seconds, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetTaskDedup sets a task's server-side de-duplication window. Returns false if the task does not exist.
+func SetTaskDedup(id int, seconds int) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET dedup_seconds = ?, updated_at = ? WHERE id = ?`, seconds, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetTaskAlarm sets where a task's device sends its alarms (an empty url = the notification
+// proxy it is bound to) and how long it waits between them (0 = the default). Returns false
+// if the task does not exist.
+func SetTaskAlarm(id int, url, token string, silenceSeconds int) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET alarm_url = ?, alarm_token = ?, alarm_silence_seconds = ?, updated_at = ? WHERE id = ?`,
+		url, token, silenceSeconds, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetTaskVisionProvider sets the vision provider analyzing a task's images (empty = the
+// device's). Returns false if the task does not exist.
+func SetTaskVisionProvider(id int, provider string) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET vision_provider = ?, updated_at = ? WHERE id = ?`, provider, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetTaskSensitivity sets how sure the vision model must be that a task's trigger is met
+// (empty = a plain yes/no). Returns false if the task does not exist.
+func SetTaskSensitivity(id int, sensitivity string) (bool, error) {
+	result, err := db.Exec(`UPDATE task_flows SET sensitivity = ?, updated_at = ? WHERE id = ?`, sensitivity, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task flow: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// RecentAlarms returns the alarms a device sent since a time, newest first
+func RecentAlarms(deviceEUI string, since time.Time) ([]*NotificationEvent, error) {
+	query := `
+	SELECT id, request_id, device_eui, timestamp, text, img, inference_data, sensor_data, event_type, schema_version, tlid, task_headline, task_prompt, suppressed, created_at
+	FROM notification_events
+	WHERE device_eui = ? AND event_type = ? AND created_at >= ?
+	ORDER BY created_at DESC
+	`
+
+	rows, err := db.Query(query, deviceEUI, EventAlarm, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent alarms: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*NotificationEvent
+	for rows.Next() {
+		var event NotificationEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.RequestID,
+			&event.DeviceEUI,
+			&event.Timestamp,
+			&event.Text,
+			&event.Img,
+			&event.InferenceData,
+			&event.SensorData,
+			&event.EventType,
+			&event.SchemaVersion,
+			&event.TLID,
+			&event.TaskHeadline,
+			&event.TaskPrompt,
+			&event.Suppressed,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+
+	// Upgrade after the query is done (SQLite cannot write while the result set holds its read lock)
+	for _, event := range events {
+		if err := upgradeEvent(event); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// LatestAlarmImage returns a device's newest alarm with an image, or nil if it has none
+func LatestAlarmImage(deviceEUI string) (*NotificationEvent, error) {
+	query := `
+	SELECT id FROM notification_events
+	WHERE device_eui = ? AND event_type = ? AND img != ''
+	ORDER BY id DESC
+	LIMIT 1
+	`
+
+	var id int
+	err := db.QueryRow(query, deviceEUI, EventAlarm).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest alarm image: %w", err)
+	}
+	return GetNotificationEventByID(id)
+}
+
+// daysBetween returns the number of calendar days from start (a midnight) to t
+func daysBetween(start, t time.Time) int {
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, start.Location())
+	return int(midnight.Sub(start).Hours()+12) / 24 // +12h absorbs DST shifts
+}
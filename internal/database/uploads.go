@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kinds of files devices upload
+const (
+	UploadImage = "image"
+	UploadAudio = "audio"
+	UploadLog   = "log"
+)
+
+// DeviceUpload is a file a device posted to the upload endpoint, stored in the blob store
+type DeviceUpload struct {
+	ID          int       `json:"id"`
+	DeviceEUI   string    `json:"device_eui"`
+	Kind        string    `json:"kind"` // UploadImage, UploadAudio or UploadLog
+	ContentType string    `json:"content_type"`
+	Filename    string    `json:"filename"` // As sent by the device (may be empty)
+	Size        int       `json:"size"`
+	BlobKey     string    `json:"-"`
+	EventID     int       `json:"event_id"` // Linked notification event (0 = none)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SaveDeviceUpload records an uploaded file
+func SaveDeviceUpload(u *DeviceUpload) error {
+	query := `
+	INSERT INTO device_uploads (device_eui, kind, content_type, filename, size, blob_key, event_id, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := execRetry(query, u.DeviceEUI, u.Kind, u.ContentType, u.Filename, u.Size, u.BlobKey, u.EventID, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert device upload: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	u.ID = int(id)
+	u.CreatedAt = now
+	return nil
+}
+
+// UploadFilter selects device uploads; zero fields do not filter
+type UploadFilter struct {
+	DeviceEUI string
+	Kind      string
+	EventID   int
+	VisibleTo int // Only devices assigned to this user
+}
+
+// GetDeviceUploads retrieves uploads received since the given time, newest first.
+// limit <= 0 means no limit.
+func GetDeviceUploads(since time.Time, filter UploadFilter, limit int) ([]*DeviceUpload, error) {
+	visible, visibleArgs := visibleDevicesClause(filter.VisibleTo)
+	query := `
+	SELECT id, device_eui, kind, content_type, filename, size, blob_key, event_id, created_at
+	FROM device_uploads
+	WHERE created_at >= ?
+		AND (? = '' OR device_eui = ?)
+		AND (? = '' OR kind = ?)
+		AND (? = 0 OR event_id = ?)` + visible + `
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	args := []interface{}{since, filter.DeviceEUI, filter.DeviceEUI, filter.Kind, filter.Kind, filter.EventID, filter.EventID}
+	args = append(args, visibleArgs...)
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device uploads: %w", err)
+	}
+	defer rows.Close()
+
+	uploads := []*DeviceUpload{}
+	for rows.Next() {
+		u, err := scanDeviceUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+
+	return uploads, nil
+}
+
+// GetDeviceUploadByID retrieves an upload by ID, or nil if it does not exist
+func GetDeviceUploadByID(id int) (*DeviceUpload, error) {
+	query := `
+	SELECT id, device_eui, kind, content_type, filename, size, blob_key, event_id, created_at
+	FROM device_uploads
+	WHERE id = ?
+	`
+
+	u, err := scanDeviceUpload(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// GetEventIDByRequestID returns the ID of the device's newest event with the given request_id,
+// or 0 if there is none
+func GetEventIDByRequestID(deviceEUI, requestID string) (int, error) {
+	query := `
+	SELECT id FROM notification_events
+	WHERE device_eui = ? AND request_id = ?
+	ORDER BY id DESC
+	LIMIT 1
+	`
+
+	var id int
+	err := db.QueryRow(query, deviceEUI, requestID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query notification event: %w", err)
+	}
+	return id, nil
+}
+
+// scanDeviceUpload scans one device_uploads row
+func scanDeviceUpload(row interface{ Scan(...interface{}) error }) (*DeviceUpload, error) {
+	var u DeviceUpload
+	err := row.Scan(
+		&u.ID,
+		&u.DeviceEUI,
+		&u.Kind,
+		&u.ContentType,
+		&u.Filename,
+		&u.Size,
+		&u.BlobKey,
+		&u.EventID,
+		&u.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan device upload: %w", err)
+	}
+	return &u, nil
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Management API roles
+const (
+	RoleAdmin  = "admin"  // Full access to all devices and settings
+	RoleViewer = "viewer" // Read-only access to the devices assigned to the user
+)
+
+// User is a management API account
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	Devices      []string  `json:"devices"`  // Devices a viewer may see (admins see all devices)
+	Language     string    `json:"language"` // Language of API messages and the dashboard ("" = from the browser's Accept-Language)
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateUser stores a new user and its device assignments
+func CreateUser(u *User) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`INSERT INTO users (username, password_hash, role, language, created_at) VALUES (?, ?, ?, ?, ?)`,
+		u.Username, u.PasswordHash, u.Role, u.Language, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	if err := replaceUserDevices(tx, int(id), u.Devices); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	u.ID = int(id)
+	u.CreatedAt = now
+	return nil
+}
+
+// UpdateUser saves a user's password hash, role, and device assignments. Returns false if the user does not exist.
+func UpdateUser(u *User) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET password_hash = ?, role = ?, language = ? WHERE id = ?`, u.PasswordHash, u.Role, u.Language, u.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	if err := replaceUserDevices(tx, u.ID, u.Devices); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit user: %w", err)
+	}
+	return true, nil
+}
+
+// SetUserLanguage sets a user's language ("" = from the browser). Returns false if the user does not exist.
+func SetUserLanguage(id int, language string) (bool, error) {
+	result, err := db.Exec(`UPDATE users SET language = ? WHERE id = ?`, language, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user language: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// replaceUserDevices sets the devices assigned to a user
+func replaceUserDevices(tx *sql.Tx, userID int, devices []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_devices WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear user devices: %w", err)
+	}
+	for _, eui := range devices {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO user_devices (user_id, device_eui) VALUES (?, ?)`, userID, eui); err != nil {
+			return fmt.Errorf("failed to assign device: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteUser removes a user, its device assignments, and its sessions, and revokes its API keys.
+// Returns false if the user does not exist.
+func DeleteUser(id int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_devices WHERE user_id = ?`, id); err != nil {
+		return false, fmt.Errorf("failed to delete user devices: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+		return false, fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), id); err != nil {
+		return false, fmt.Errorf("failed to revoke user API keys: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+	return true, nil
+}
+
+// GetUsers returns all users, ordered by username
+func GetUsers() ([]*User, error) {
+	rows, err := db.Query(`SELECT id, username, password_hash, role, language, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+
+	users := []*User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Language, &u.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, &u)
+	}
+	rows.Close()
+
+	for _, u := range users {
+		if u.Devices, err = getUserDevices(u.ID); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// GetUserByID returns a user, or nil if it does not exist
+func GetUserByID(id int) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, role, language, created_at FROM users WHERE id = ?`, id)
+}
+
+// GetUserByUsername returns a user, or nil if it does not exist
+func GetUserByUsername(username string) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, role, language, created_at FROM users WHERE username = ?`, username)
+}
+
+// getUser loads one user and its device assignments
+func getUser(query string, arg interface{}) (*User, error) {
+	var u User
+	err := db.QueryRow(query, arg).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Language, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	if u.Devices, err = getUserDevices(u.ID); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// getUserDevices returns the devices assigned to a user
+func getUserDevices(userID int) ([]string, error) {
+	rows, err := db.Query(`SELECT device_eui FROM user_devices WHERE user_id = ? ORDER BY device_eui`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []string{}
+	for rows.Next() {
+		var eui string
+		if err := rows.Scan(&eui); err != nil {
+			return nil, fmt.Errorf("failed to scan user device: %w", err)
+		}
+		devices = append(devices, eui)
+	}
+	return devices, nil
+}
+
+// CountUsers returns the number of users
+func CountUsers() (int, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return n, nil
+}
+
+// CountAdmins returns the number of admin users
+func CountAdmins() (int, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, RoleAdmin).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return n, nil
+}
+
+// CreateSession stores a login session (by token hash) and prunes expired sessions
+func CreateSession(tokenHash string, userID int, expiresAt time.Time) error {
+	now := time.Now()
+	if _, err := db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now); err != nil {
+		return fmt.Errorf("failed to prune sessions: %w", err)
+	}
+	_, err := db.Exec(`INSERT INTO sessions (token_hash, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		tokenHash, userID, expiresAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionUser returns the user of an unexpired session, or nil if there is none
+func GetSessionUser(tokenHash string) (*User, error) {
+	var userID int
+	err := db.QueryRow(`SELECT user_id FROM sessions WHERE token_hash = ? AND expires_at > ?`, tokenHash, time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+	return GetUserByID(userID)
+}
+
+// DeleteSession ends a login session
+func DeleteSession(tokenHash string) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions ends all login sessions of a user
+func DeleteUserSessions(userID int) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+// visibleDevicesClause restricts a device_eui column to the devices assigned to a user.
+// visibleTo is a user ID, or 0 for no restriction.
+func visibleDevicesClause(visibleTo int) (string, []interface{}) {
+	if visibleTo == 0 {
+		return "", nil
+	}
+	return " AND device_eui IN (SELECT device_eui FROM user_devices WHERE user_id = ?)", []interface{}{visibleTo}
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleViewer
+}
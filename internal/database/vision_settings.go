@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DeviceVisionSettings overrides the global vision settings for one device.
+// Nil fields inherit the global value.
+type DeviceVisionSettings struct {
+	DeviceEUI         string    `json:"device_eui"`
+	DefaultPrompt     *string   `json:"default_prompt"`
+	RecognizeMaxChars *int      `json:"recognize_max_chars"`
+	StoreRecognize    *bool     `json:"store_recognize"`
+	Privacy           *string   `json:"privacy"`
+	Provider          *string   `json:"provider"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// SaveDeviceVisionSettings creates or replaces a device's vision settings
+func SaveDeviceVisionSettings(s *DeviceVisionSettings) error {
+	query := `
+	INSERT INTO device_vision_settings (device_eui, default_prompt, recognize_max_chars, store_recognize, privacy, provider, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(device_eui) DO UPDATE SET
+		default_prompt = excluded.default_prompt,
+		recognize_max_chars = excluded.recognize_max_chars,
+		store_recognize = excluded.store_recognize,
+		privacy = excluded.privacy,
+		provider = excluded.provider,
+		updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	if _, err := db.Exec(query, s.DeviceEUI, s.DefaultPrompt, s.RecognizeMaxChars, s.StoreRecognize, s.Privacy, s.Provider, now); err != nil {
+		return fmt.Errorf("failed to save device vision settings: %w", err)
+	}
+	s.UpdatedAt = now
+	return nil
+}
+
+// GetDeviceVisionSettings returns a device's vision settings, or nil if it has none
+func GetDeviceVisionSettings(deviceEUI string) (*DeviceVisionSettings, error) {
+	query := `
+	SELECT device_eui, default_prompt, recognize_max_chars, store_recognize, privacy, provider, updated_at
+	FROM device_vision_settings
+	WHERE device_eui = ?
+	`
+
+	var s DeviceVisionSettings
+	var prompt sql.NullString
+	var maxChars sql.NullInt64
+	var store sql.NullBool
+	var privacy, provider sql.NullString
+	err := db.QueryRow(query, deviceEUI).Scan(&s.DeviceEUI, &prompt, &maxChars, &store, &privacy, &provider, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device vision settings: %w", err)
+	}
+
+	if prompt.Valid {
+		s.DefaultPrompt = &prompt.String
+	}
+	if maxChars.Valid {
+		n := int(maxChars.Int64)
+		s.RecognizeMaxChars = &n
+	}
+	if store.Valid {
+		s.StoreRecognize = &store.Bool
+	}
+	if privacy.Valid {
+		s.Privacy = &privacy.String
+	}
+	if provider.Valid {
+		s.Provider = &provider.String
+	}
+	return &s, nil
+}
+
+// DeleteDeviceVisionSettings removes a device's vision settings so it uses the global ones.
+// It reports whether the device had settings.
+func DeleteDeviceVisionSettings(deviceEUI string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM device_vision_settings WHERE device_eui = ?`, deviceEUI)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete device vision settings: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
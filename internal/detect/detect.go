@@ -0,0 +1,232 @@
+// Package detect runs a YOLOv8 object detection model (ONNX) inside the server, so MONITORING
+// frames can be checked for a task's target without an LLM backend. Inference needs the
+// onnxruntime shared library and a server built with -tags onnx; other builds report the
+// detector as unavailable.
+package detect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+)
+
+const (
+	minConfidence = 0.4  // Lowest class score of a detection (as the audio service's default)
+	iouThreshold  = 0.45 // Boxes of a class overlapping a better one by more than this are dropped
+	padGray       = 114  // Letterbox padding, the value YOLOv8 is trained with
+)
+
+// Detection is an object found in an image
+type Detection struct {
+	Class      string     `json:"class"`
+	Confidence float64    `json:"confidence"`
+	Box        [4]float64 `json:"box"` // x, y, width, height in pixels of the image
+}
+
+// session runs a loaded model. Implemented by the onnx build (onnx.go).
+type session interface {
+	size() int         // Width and height of the model's square input
+	classes() []string // Class names from the model's metadata (nil = the COCO classes)
+	run(input []float32) (output []float32, shape []int64, err error)
+}
+
+// errNotBuilt is returned by openSession in servers built without ONNX support
+var errNotBuilt = errors.New("the server was built without ONNX support (build with -tags onnx)")
+
+var (
+	mu      sync.Mutex // One inference at a time: each already uses every core
+	current session
+	model   string
+	names   []string
+)
+
+// Load loads the model at modelPath (empty = no detector), using the onnxruntime shared
+// library at libPath (empty = the system's)
+func Load(modelPath, libPath string) error {
+	if modelPath == "" {
+		return nil
+	}
+	s, err := openSession(modelPath, libPath)
+	if err != nil {
+		return fmt.Errorf("failed to load object detection model %s: %w", modelPath, err)
+	}
+
+	current, model, names = s, filepath.Base(modelPath), s.classes()
+	if names == nil {
+		names = config.COCOClasses
+	}
+	log.Printf("Object detection model loaded: %s (%dx%d input, %d classes)", model, s.size(), s.size(), len(names))
+	return nil
+}
+
+// Available reports whether a model is loaded
+func Available() bool {
+	return current != nil
+}
+
+// Model returns the file name of the loaded model
+func Model() string {
+	return model
+}
+
+// Detect finds the objects in a JPEG
+func Detect(jpegData []byte) ([]Detection, error) {
+	if current == nil {
+		return nil, errors.New("no object detection model is loaded")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(jpegData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JPEG: %w", err)
+	}
+
+	size := current.size()
+	input, scale, left, top := letterbox(img, size)
+
+	mu.Lock()
+	output, shape, err := current.run(input)
+	mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("object detection failed: %w", err)
+	}
+
+	detections, err := decode(output, shape, names)
+	if err != nil {
+		return nil, err
+	}
+	// Back from the letterboxed input to the pixels of the image
+	for i := range detections {
+		b := &detections[i].Box
+		b[0], b[1] = (b[0]-float64(left))/scale, (b[1]-float64(top))/scale
+		b[2], b[3] = b[2]/scale, b[3]/scale
+	}
+	return detections, nil
+}
+
+// letterbox scales img to fit a size x size square, centered on gray padding, and returns
+// it as the model's input (RGB planes of values from 0 to 1) with the scale and offsets used
+func letterbox(img image.Image, size int) ([]float32, float64, int, int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := min(float64(size)/float64(w), float64(size)/float64(h))
+
+	scaled := imaging.Resize(img, max(int(float64(w)*scale+0.5), 1))
+	sw, sh := scaled.Bounds().Dx(), min(scaled.Bounds().Dy(), size)
+	left, top := (size-sw)/2, (size-sh)/2
+
+	plane := size * size
+	input := make([]float32, 3*plane)
+	for i := range input {
+		input[i] = padGray / 255.0
+	}
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			p := scaled.Pix[y*scaled.Stride+x*4:]
+			i := (y+top)*size + x + left
+			input[i] = float32(p[0]) / 255
+			input[plane+i] = float32(p[1]) / 255
+			input[2*plane+i] = float32(p[2]) / 255
+		}
+	}
+	return input, scale, left, top
+}
+
+// decode reads YOLOv8 output: for each candidate box its center, width and height, then a
+// score per class. Exports put candidates in columns ([1, 4+classes, candidates], the
+// default) or in rows; the longer dimension is the candidates.
+func decode(output []float32, shape []int64, names []string) ([]Detection, error) {
+	if len(shape) != 3 || shape[0] != 1 || int64(len(output)) != shape[1]*shape[2] {
+		return nil, fmt.Errorf("unexpected model output shape %v", shape)
+	}
+	values, candidates := int(shape[1]), int(shape[2])
+	at := func(candidate, value int) float64 { return float64(output[value*candidates+candidate]) }
+	if values > candidates {
+		values, candidates = candidates, values
+		at = func(candidate, value int) float64 { return float64(output[candidate*values+value]) }
+	}
+	if values < 5 {
+		return nil, fmt.Errorf("unexpected model output shape %v", shape)
+	}
+
+	var found []Detection
+	for c := 0; c < candidates; c++ {
+		best, score := -1, minConfidence
+		for k := 4; k < values; k++ {
+			if s := at(c, k); s >= score {
+				best, score = k-4, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		class := strconv.Itoa(best)
+		if best < len(names) {
+			class = names[best]
+		}
+		cx, cy, w, h := at(c, 0), at(c, 1), at(c, 2), at(c, 3)
+		found = append(found, Detection{Class: class, Confidence: score, Box: [4]float64{cx - w/2, cy - h/2, w, h}})
+	}
+	return suppress(found), nil
+}
+
+// suppress keeps the best of the boxes of a class that overlap (non-maximum suppression)
+func suppress(detections []Detection) []Detection {
+	sort.Slice(detections, func(i, j int) bool { return detections[i].Confidence > detections[j].Confidence })
+
+	kept := []Detection{}
+	for _, d := range detections {
+		overlaps := false
+		for _, k := range kept {
+			if k.Class == d.Class && iou(k.Box, d.Box) > iouThreshold {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// iou is the intersection over union of two boxes
+func iou(a, b [4]float64) float64 {
+	w := min(a[0]+a[2], b[0]+b[2]) - max(a[0], b[0])
+	h := min(a[1]+a[3], b[1]+b[3]) - max(a[1], b[1])
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	inter := w * h
+	return inter / (a[2]*a[3] + b[2]*b[3] - inter)
+}
+
+// classNamesPattern matches the entries of the "names" metadata of Ultralytics exports,
+// a Python dict such as {0: 'person', 1: 'bicycle'}
+var classNamesPattern = regexp.MustCompile(`(\d+):\s*['"]([^'"]*)['"]`)
+
+// parseClassNames reads the class names of an Ultralytics export (nil if there are none)
+func parseClassNames(metadata string) []string {
+	matches := classNamesPattern.FindAllStringSubmatch(metadata, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	classes := make([]string, len(matches))
+	for _, m := range matches {
+		i, err := strconv.Atoi(m[1])
+		if err != nil || i >= len(classes) {
+			return nil
+		}
+		classes[i] = m[2]
+	}
+	return classes
+}
@@ -0,0 +1,8 @@
+//go:build !onnx
+
+package detect
+
+// openSession fails: inference needs the onnxruntime bindings of the onnx build
+func openSession(modelPath, libPath string) (session, error) {
+	return nil, errNotBuilt
+}
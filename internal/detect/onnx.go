@@ -0,0 +1,79 @@
+//go:build onnx
+
+package detect
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxSession runs the model with onnxruntime, loaded from its shared library at startup
+type onnxSession struct {
+	session *ort.DynamicAdvancedSession
+	input   int
+	names   []string
+}
+
+func openSession(modelPath, libPath string) (session, error) {
+	if libPath != "" {
+		ort.SetSharedLibraryPath(libPath)
+	}
+	if !ort.IsInitialized() {
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("failed to load onnxruntime: %w", err)
+		}
+	}
+
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) != 1 || len(outputs) != 1 {
+		return nil, fmt.Errorf("expected a model with one input and one output, it has %d and %d", len(inputs), len(outputs))
+	}
+	// NCHW; exports with dynamic axes report -1 and take YOLOv8's default size
+	size := 640
+	if dims := inputs[0].Dimensions; len(dims) == 4 && dims[3] > 0 {
+		size = int(dims[3])
+	}
+
+	s := &onnxSession{input: size}
+	if metadata, err := ort.GetModelMetadata(modelPath); err == nil {
+		if value, ok, _ := metadata.LookupCustomMetadataMap("names"); ok {
+			s.names = parseClassNames(value)
+		}
+		metadata.Destroy()
+	}
+
+	s.session, err = ort.NewDynamicAdvancedSession(modelPath, []string{inputs[0].Name}, []string{outputs[0].Name}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *onnxSession) size() int { return s.input }
+
+func (s *onnxSession) classes() []string { return s.names }
+
+func (s *onnxSession) run(input []float32) ([]float32, []int64, error) {
+	in, err := ort.NewTensor(ort.NewShape(1, 3, int64(s.input), int64(s.input)), input)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Destroy()
+
+	outputs := []ort.Value{nil} // Allocated by onnxruntime
+	if err := s.session.Run([]ort.Value{in}, outputs); err != nil {
+		return nil, nil, err
+	}
+	defer outputs[0].Destroy()
+
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a float32 output, got %T", outputs[0])
+	}
+	// The tensor's data is freed with it
+	return append([]float32(nil), out.GetData()...), out.GetShape(), nil
+}
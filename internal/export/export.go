@@ -0,0 +1,165 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// batchSize caps the sensor readings sent in one request
+const batchSize = 5000
+
+// payload is an encoded export request body
+type payload struct {
+	body    []byte
+	headers map[string]string
+}
+
+// encoder turns sensor readings, AI call totals, background worker status, and AI backend queue
+// depths into a request body for one metrics store
+type encoder func(readings []*database.SensorReading, totals []*database.InferenceTotals, workers map[string]supervisor.WorkerStatus, queues map[string]queue.Stats, now time.Time) (*payload, error)
+
+// exporter periodically pushes new sensor readings and the current detection counts
+type exporter struct {
+	cfg    config.ExportConfig
+	url    string
+	encode encoder
+	client *http.Client
+	lastID int64 // Newest sensor reading already exported
+}
+
+// Start exports sensor readings, detection counts, and worker restarts every cfg.Interval to
+// InfluxDB or a Prometheus remote-write endpoint. Only readings stored after startup are
+// exported; detection counts and restarts are totals, so they are sent on every export.
+func Start(cfg config.ExportConfig) error {
+	if cfg.Driver == "" {
+		return nil
+	}
+
+	e := &exporter{cfg: cfg, url: cfg.URL, client: &http.Client{Timeout: 30 * time.Second}}
+	switch cfg.Driver {
+	case "influxdb":
+		url, err := influxWriteURL(cfg.URL)
+		if err != nil {
+			return err
+		}
+		e.url = url
+		e.encode = encodeInflux
+	case "prometheus":
+		e.encode = encodeRemoteWrite
+	default:
+		return fmt.Errorf("unknown export driver: %s", cfg.Driver)
+	}
+
+	lastID, err := database.LastSensorReadingID()
+	if err != nil {
+		return err
+	}
+	e.lastID = lastID
+
+	log.Printf("Metrics export enabled: %s every %s", cfg.Driver, cfg.Interval)
+
+	supervisor.Go("metrics-export", func() error {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			e.export()
+		}
+		return nil
+	})
+	return nil
+}
+
+// export sends the current totals and all readings stored since the last export.
+// Failed requests are retried on the next tick, except for requests the store rejects
+// as invalid (4xx), which would fail again and are skipped.
+func (e *exporter) export() {
+	totals, err := database.GetInferenceTotals()
+	if err != nil {
+		log.Printf("ERROR: Metrics export failed to load detection counts: %v", err)
+		return
+	}
+	workers := supervisor.Status()
+	queues := queue.Status()
+
+	for {
+		readings, err := database.GetSensorReadingsAfter(e.lastID, batchSize)
+		if err != nil {
+			log.Printf("ERROR: Metrics export failed to load sensor readings: %v", err)
+			return
+		}
+		if len(readings) == 0 && len(totals) == 0 && len(workers) == 0 && len(queues) == 0 {
+			return
+		}
+
+		p, err := e.encode(readings, totals, workers, queues, time.Now())
+		if err != nil {
+			log.Printf("ERROR: Metrics export failed to encode: %v", err)
+			return
+		}
+
+		status, err := e.send(p)
+		if err != nil {
+			log.Printf("WARNING: Metrics export to %s failed, retrying next interval: %v", e.cfg.Driver, err)
+			return
+		}
+		if status >= 400 {
+			log.Printf("WARNING: Metrics export to %s rejected %d readings (status %d), skipping them", e.cfg.Driver, len(readings), status)
+		}
+
+		if len(readings) > 0 {
+			e.lastID = readings[len(readings)-1].ID
+		}
+		if len(readings) < batchSize {
+			return
+		}
+		totals, workers, queues = nil, nil, nil // Already sent with the first batch
+	}
+}
+
+// send posts a payload, returning an error for failures worth retrying (connection errors, 5xx)
+func (e *exporter) send(p *payload) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(p.body))
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+	if e.cfg.Token != "" {
+		scheme := "Bearer"
+		if e.cfg.Driver == "influxdb" {
+			scheme = "Token"
+		}
+		req.Header.Set("Authorization", scheme+" "+e.cfg.Token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("returned %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("WARNING: Metrics export response: %s", bytes.TrimSpace(body))
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// influxWriteURL checks an InfluxDB write URL (v1 /write?db= or v2 /api/v2/write?org=&bucket=)
+// and sets millisecond precision, which is what the line protocol timestamps use
+func influxWriteURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("precision", "ms")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// encodeInflux encodes readings, totals, worker status, and backend queues as InfluxDB line protocol:
+//
+//	watcher_sensor,device_eui=2CF7F1C0... temperature=21.5 1700000000000
+//	watcher_inferences,channel=stable,device_eui=2CF7F1C0...,kind=monitoring requests=42i,detections=3i,false_positives=1i 1700000000000
+//	watcher_worker,worker=task-watchdog up=1i,restarts=0i 1700000000000
+//	watcher_backend,backend=ollama active=1i,queued=3i,admitted=120i,rejected=0i,wait_ms=5400i,new_conns=4i,reused_conns=116i 1700000000000
+func encodeInflux(readings []*database.SensorReading, totals []*database.InferenceTotals, workers map[string]supervisor.WorkerStatus, queues map[string]queue.Stats, now time.Time) (*payload, error) {
+	var b strings.Builder
+
+	for _, r := range readings {
+		fmt.Fprintf(&b, "watcher_sensor,device_eui=%s %s=%s %d\n",
+			escapeInfluxTag(r.DeviceEUI), escapeInfluxTag(r.Metric), strconv.FormatFloat(r.Value, 'f', -1, 64), r.Timestamp)
+	}
+
+	for _, t := range totals {
+		fmt.Fprintf(&b, "watcher_inferences,channel=%s,device_eui=%s,kind=%s requests=%di,detections=%di,false_positives=%di %d\n",
+			escapeInfluxTag(t.Channel), escapeInfluxTag(t.DeviceEUI), escapeInfluxTag(t.Kind),
+			t.Requests, t.Detections, t.FalsePositives, now.UnixMilli())
+	}
+
+	for name, w := range workers {
+		fmt.Fprintf(&b, "watcher_worker,worker=%s up=%di,restarts=%di %d\n",
+			escapeInfluxTag(name), workerUp(w), w.Restarts, now.UnixMilli())
+	}
+
+	for name, q := range queues {
+		fmt.Fprintf(&b, "watcher_backend,backend=%s active=%di,queued=%di,admitted=%di,rejected=%di,wait_ms=%di,new_conns=%di,reused_conns=%di %d\n",
+			escapeInfluxTag(name), q.Active, q.Queued, q.Admitted, q.Rejected, q.WaitMs, q.NewConns, q.ReusedConns, now.UnixMilli())
+	}
+
+	return &payload{
+		body:    []byte(b.String()),
+		headers: map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+	}, nil
+}
+
+// workerUp is 1 for a healthy worker and 0 for one in backoff or a crash loop
+func workerUp(w supervisor.WorkerStatus) int {
+	if w.Healthy() {
+		return 1
+	}
+	return 0
+}
+
+// escapeInfluxTag escapes a tag key, tag value, or field key for line protocol
+func escapeInfluxTag(s string) string {
+	if s == "" {
+		return "unknown" // Empty tag values are not allowed
+	}
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
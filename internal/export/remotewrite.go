@@ -0,0 +1,165 @@
+package export
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// Prometheus remote write (https://prometheus.io/docs/specs/remote_write_spec/) is a
+// snappy-compressed protobuf WriteRequest. The few messages involved are encoded by hand:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+
+// label is a Prometheus label
+type label struct{ name, value string }
+
+// sample is a Prometheus sample (timestamp in Unix milliseconds)
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// timeSeries is one labeled series and its samples
+type timeSeries struct {
+	labels  []label
+	samples []sample
+}
+
+// encodeRemoteWrite encodes readings, totals, worker status, and backend queues as a remote-write request. Sensor
+// readings become watcher_sensor_<metric>{device_eui} gauges; totals become watcher_inference_requests_total,
+// watcher_detections_total, and watcher_false_positives_total{device_eui,channel,kind} counters;
+// workers become watcher_worker_up{worker} gauges and watcher_worker_restarts_total{worker} counters; backend
+// queues become watcher_backend_active and watcher_backend_queued{backend} gauges and watcher_backend_admitted_total,
+// watcher_backend_rejected_total, watcher_backend_wait_seconds_total, watcher_backend_new_conns_total, and
+// watcher_backend_reused_conns_total{backend} counters.
+func encodeRemoteWrite(readings []*database.SensorReading, totals []*database.InferenceTotals, workers map[string]supervisor.WorkerStatus, queues map[string]queue.Stats, now time.Time) (*payload, error) {
+	series := make(map[string]*timeSeries)
+	var order []string
+
+	add := func(name string, labels []label, s sample) {
+		labels = append([]label{{"__name__", name}}, labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		key := ""
+		for _, l := range labels {
+			key += l.name + "=" + l.value + "\x00"
+		}
+		ts, ok := series[key]
+		if !ok {
+			ts = &timeSeries{labels: labels}
+			series[key] = ts
+			order = append(order, key)
+		}
+		ts.samples = append(ts.samples, s)
+	}
+
+	for _, r := range readings {
+		add("watcher_sensor_"+r.Metric, []label{{"device_eui", r.DeviceEUI}}, sample{r.Value, r.Timestamp})
+	}
+
+	for _, t := range totals {
+		labels := []label{{"device_eui", t.DeviceEUI}, {"channel", t.Channel}, {"kind", t.Kind}}
+		add("watcher_inference_requests_total", labels, sample{float64(t.Requests), now.UnixMilli()})
+		add("watcher_detections_total", labels, sample{float64(t.Detections), now.UnixMilli()})
+		add("watcher_false_positives_total", labels, sample{float64(t.FalsePositives), now.UnixMilli()})
+	}
+
+	for name, w := range workers {
+		labels := []label{{"worker", name}}
+		add("watcher_worker_up", labels, sample{float64(workerUp(w)), now.UnixMilli()})
+		add("watcher_worker_restarts_total", labels, sample{float64(w.Restarts), now.UnixMilli()})
+	}
+
+	for name, q := range queues {
+		labels := []label{{"backend", name}}
+		add("watcher_backend_active", labels, sample{float64(q.Active), now.UnixMilli()})
+		add("watcher_backend_queued", labels, sample{float64(q.Queued), now.UnixMilli()})
+		add("watcher_backend_admitted_total", labels, sample{float64(q.Admitted), now.UnixMilli()})
+		add("watcher_backend_rejected_total", labels, sample{float64(q.Rejected), now.UnixMilli()})
+		add("watcher_backend_wait_seconds_total", labels, sample{float64(q.WaitMs) / 1000, now.UnixMilli()})
+		add("watcher_backend_new_conns_total", labels, sample{float64(q.NewConns), now.UnixMilli()})
+		add("watcher_backend_reused_conns_total", labels, sample{float64(q.ReusedConns), now.UnixMilli()})
+	}
+
+	var request []byte
+	for _, key := range order {
+		ts := series[key]
+		// Receivers expect each series' samples in time order and reject duplicate timestamps
+		sort.SliceStable(ts.samples, func(i, j int) bool { return ts.samples[i].timestamp < ts.samples[j].timestamp })
+		samples := ts.samples[:0]
+		for _, s := range ts.samples {
+			if len(samples) > 0 && samples[len(samples)-1].timestamp == s.timestamp {
+				samples[len(samples)-1] = s // Keep the newest reading
+				continue
+			}
+			samples = append(samples, s)
+		}
+		ts.samples = samples
+		request = appendBytesField(request, 1, encodeTimeSeries(ts))
+	}
+
+	return &payload{
+		body: snappyEncode(request),
+		headers: map[string]string{
+			"Content-Type":                      "application/x-protobuf",
+			"Content-Encoding":                  "snappy",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+		},
+	}, nil
+}
+
+// encodeTimeSeries encodes a TimeSeries message
+func encodeTimeSeries(ts *timeSeries) []byte {
+	var msg []byte
+	for _, l := range ts.labels {
+		var lb []byte
+		lb = appendBytesField(lb, 1, []byte(l.name))
+		lb = appendBytesField(lb, 2, []byte(l.value))
+		msg = appendBytesField(msg, 1, lb)
+	}
+	for _, s := range ts.samples {
+		var sb []byte
+		sb = binary.AppendUvarint(sb, 1<<3|1) // Field 1, 64-bit
+		sb = binary.LittleEndian.AppendUint64(sb, math.Float64bits(s.value))
+		sb = binary.AppendUvarint(sb, 2<<3|0) // Field 2, varint
+		sb = binary.AppendUvarint(sb, uint64(s.timestamp))
+		msg = appendBytesField(msg, 2, sb)
+	}
+	return msg
+}
+
+// appendBytesField appends a length-delimited protobuf field
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// snappyEncode produces a valid snappy block made only of literals. Metrics payloads are
+// small, so skipping compression keeps this dependency-free at little cost.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := min(len(src), 65536)
+		switch {
+		case n <= 60:
+			dst = append(dst, byte(n-1)<<2)
+		case n <= 256:
+			dst = append(dst, 60<<2, byte(n-1))
+		default:
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,333 @@
+// Package frigate publishes Watcher alarms to an MQTT broker on Frigate's event topics, so
+// automations written for Frigate (Home Assistant, Node-RED) handle Watcher detections the
+// same way as those of the NVR's cameras. Each Watcher appears as a camera named after its
+// registered name, and detected classes are mapped to Frigate's COCO labels.
+package frigate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Frame size of event images
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/mqtt"
+	"github.com/brianhealey/sensecap-server/internal/rules"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+const (
+	pollInterval  = 2 * time.Second  // How often new alarms are published
+	batchSize     = 500              // Caps the events loaded in one pass
+	maxEventAge   = 5 * time.Minute  // Older alarms (e.g. while the broker was down) are skipped
+	occupancyHold = 30 * time.Second // How long a camera's object count stays up after an alarm
+)
+
+// cocoLabels maps class names of the Watcher's models to Frigate's COCO labels where they differ
+var cocoLabels = map[string]string{
+	"people":      "person",
+	"persons":     "person",
+	"human":       "person",
+	"motorbike":   "motorcycle",
+	"aeroplane":   "airplane",
+	"sofa":        "couch",
+	"tvmonitor":   "tv",
+	"pottedplant": "potted plant",
+	"diningtable": "dining table",
+	"cellphone":   "cell phone",
+}
+
+// cameraChars are the characters Frigate allows in camera names
+var cameraChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// publisher forwards new alarm events to the broker
+type publisher struct {
+	cfg    config.FrigateConfig
+	client *mqtt.Client         // nil while disconnected
+	lastID int                  // Newest event already published
+	counts map[string]time.Time // Object count topics set above 0, until when
+}
+
+// Start publishes alarms stored from now on as Frigate events (if a broker is configured)
+func Start(cfg config.FrigateConfig) error {
+	if cfg.MQTTURL == "" {
+		return nil
+	}
+
+	lastID, err := database.LastNotificationEventID()
+	if err != nil {
+		return err
+	}
+	p := &publisher{cfg: cfg, lastID: lastID, counts: make(map[string]time.Time)}
+
+	log.Printf("Frigate integration enabled: alarms are published under %s/", cfg.TopicPrefix)
+
+	supervisor.Go("frigate", func() error {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := p.run(); err != nil {
+				log.Printf("WARNING: Frigate integration: %v", err)
+				if p.client != nil {
+					p.client.Close()
+					p.client = nil
+				}
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+// run connects if needed, publishes the alarms stored since the last pass and resets expired
+// object counts. An error drops the connection; unpublished alarms are retried on the next pass.
+func (p *publisher) run() error {
+	if p.client == nil {
+		client, err := mqtt.Dial(p.cfg.MQTTURL, fmt.Sprintf("watcher-server-%d", time.Now().UnixNano()%1000000))
+		if err != nil {
+			return err
+		}
+		log.Printf("Frigate integration connected to the MQTT broker")
+		p.client = client
+	}
+
+	for {
+		events, err := database.GetNotificationEventsAfter(p.lastID, batchSize)
+		if err != nil {
+			log.Printf("ERROR: Frigate integration failed to load events: %v", err)
+			return nil
+		}
+		for _, event := range events {
+			if event.EventType == database.EventAlarm && !event.Suppressed {
+				if age := time.Since(rules.EventTime(event)); age > maxEventAge {
+					log.Printf("Frigate integration: skipped alarm %d from %s ago", event.ID, age.Round(time.Second))
+				} else if err := p.publishEvent(event); err != nil {
+					return err
+				}
+			}
+			p.lastID = event.ID
+		}
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	now := time.Now()
+	for topic, until := range p.counts {
+		if now.After(until) {
+			if err := p.client.Publish(topic, []byte("0"), false); err != nil {
+				return err
+			}
+			delete(p.counts, topic)
+		}
+	}
+	return p.client.Ping()
+}
+
+// detection is one object label found in an alarm: its best box and how many were found
+type detection struct {
+	label string
+	score float64 // 0-1
+	box   [4]int  // x1, y1, x2, y2 in pixels
+	count int
+}
+
+// publishEvent publishes an alarm as a Frigate event per detected label ("new", then "end",
+// since the device reports a single frame), the snapshot and the camera's object counts
+func (p *publisher) publishEvent(event *database.NotificationEvent) error {
+	var jpeg []byte
+	if event.Img != "" {
+		data, err := imaging.DecodeBase64JPEG(event.Img)
+		if err != nil {
+			log.Printf("WARNING: Frigate integration: image of event %d is invalid: %v", event.ID, err)
+		} else {
+			jpeg = data
+		}
+	}
+	width, height := 0, 0
+	if jpeg != nil {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(jpeg)); err == nil {
+			width, height = cfg.Width, cfg.Height
+		}
+	}
+
+	detections := detect(event.InferenceData, width, height)
+	if len(detections) == 0 {
+		log.Printf("Frigate integration: alarm %d has no detected objects, not published", event.ID)
+		return nil
+	}
+
+	camera := cameraName(event.DeviceEUI)
+	at := rules.EventTime(event)
+	ts := float64(at.UnixMicro()) / 1e6
+	for _, d := range detections {
+		object := eventObject{
+			ID:                fmt.Sprintf("%d.%06d-watcher%d", at.Unix(), at.Nanosecond()/1000, event.ID),
+			Camera:            camera,
+			FrameTime:         ts,
+			SnapshotTime:      ts,
+			Label:             d.label,
+			TopScore:          d.score,
+			Score:             d.score,
+			StartTime:         ts,
+			Box:               d.box,
+			Region:            d.box,
+			Area:              (d.box[2] - d.box[0]) * (d.box[3] - d.box[1]),
+			CurrentZones:      []string{},
+			EnteredZones:      []string{},
+			HasSnapshot:       jpeg != nil,
+			Attributes:        map[string]float64{},
+			CurrentAttributes: []interface{}{},
+		}
+		if h := d.box[3] - d.box[1]; h > 0 {
+			object.Ratio = float64(d.box[2]-d.box[0]) / float64(h)
+		}
+		if len(detections) > 1 {
+			// One alarm, several labels: Frigate ids are unique per object
+			object.ID += "-" + strings.ReplaceAll(d.label, " ", "_")
+		}
+
+		if err := p.publishJSON("events", frigateEvent{Type: "new", Before: object, After: object}); err != nil {
+			return err
+		}
+		if jpeg != nil {
+			if err := p.client.Publish(p.topic(camera, d.label, "snapshot"), jpeg, true); err != nil {
+				return err
+			}
+		}
+		countTopic := p.topic(camera, d.label)
+		if err := p.client.Publish(countTopic, []byte(fmt.Sprint(d.count)), false); err != nil {
+			return err
+		}
+		p.counts[countTopic] = time.Now().Add(occupancyHold)
+
+		ended := object
+		ended.EndTime = &ts
+		if err := p.publishJSON("events", frigateEvent{Type: "end", Before: object, After: ended}); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Frigate integration: published alarm %d as %d event(s) of camera %s", event.ID, len(detections), camera)
+	return nil
+}
+
+// frigateEvent is a message of Frigate's events topic
+type frigateEvent struct {
+	Type   string      `json:"type"` // new, update or end
+	Before eventObject `json:"before"`
+	After  eventObject `json:"after"`
+}
+
+// eventObject is a tracked object in a Frigate event. Watchers report single frames, so
+// there is no motion tracking, zones or clip.
+type eventObject struct {
+	ID                string             `json:"id"`
+	Camera            string             `json:"camera"`
+	FrameTime         float64            `json:"frame_time"`
+	SnapshotTime      float64            `json:"snapshot_time"`
+	Label             string             `json:"label"`
+	SubLabel          interface{}        `json:"sub_label"`
+	TopScore          float64            `json:"top_score"`
+	FalsePositive     bool               `json:"false_positive"`
+	StartTime         float64            `json:"start_time"`
+	EndTime           *float64           `json:"end_time"`
+	Score             float64            `json:"score"`
+	Box               [4]int             `json:"box"`
+	Area              int                `json:"area"`
+	Ratio             float64            `json:"ratio"`
+	Region            [4]int             `json:"region"`
+	Stationary        bool               `json:"stationary"`
+	MotionlessCount   int                `json:"motionless_count"`
+	PositionChanges   int                `json:"position_changes"`
+	CurrentZones      []string           `json:"current_zones"`
+	EnteredZones      []string           `json:"entered_zones"`
+	HasClip           bool               `json:"has_clip"`
+	HasSnapshot       bool               `json:"has_snapshot"`
+	Attributes        map[string]float64 `json:"attributes"`
+	CurrentAttributes []interface{}      `json:"current_attributes"`
+}
+
+func (p *publisher) publishJSON(topic string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(p.topic(topic), data, false)
+}
+
+// topic joins topic levels under the configured prefix
+func (p *publisher) topic(levels ...string) string {
+	return p.cfg.TopicPrefix + "/" + strings.Join(levels, "/")
+}
+
+// detect groups an event's detections (inference data JSON) by label, keeping each label's
+// best box. Classifications, which have no box, cover the whole frame.
+func detect(inferenceData string, width, height int) []*detection {
+	var inference models.InferenceData
+	if inferenceData == "" || json.Unmarshal([]byte(inferenceData), &inference) != nil {
+		return nil
+	}
+
+	var detections []*detection
+	byLabel := make(map[string]*detection)
+	add := func(target, score int, box [4]int) {
+		if target < 0 || target >= len(inference.ClassesName) {
+			return
+		}
+		label := cocoLabel(inference.ClassesName[target])
+		d := byLabel[label]
+		if d == nil {
+			d = &detection{label: label, score: -1}
+			byLabel[label] = d
+			detections = append(detections, d)
+		}
+		d.count++
+		if s := float64(score) / 100; s > d.score {
+			d.score, d.box = s, box
+		}
+	}
+
+	for _, b := range inference.Boxes {
+		// Boxes are given by their center
+		x, y, w, h := b[0], b[1], b[2], b[3]
+		add(b[5], b[4], [4]int{x - w/2, y - h/2, x + w/2, y + h/2})
+	}
+	for _, c := range inference.Classes {
+		add(c[1], c[0], [4]int{0, 0, width, height})
+	}
+	return detections
+}
+
+// cocoLabel maps a Watcher class name to Frigate's label for it
+func cocoLabel(class string) string {
+	label := strings.ToLower(strings.TrimSpace(class))
+	if coco, ok := cocoLabels[label]; ok {
+		return coco
+	}
+	return label
+}
+
+// cameraName names a device's camera in Frigate: its registered name made topic-safe, or
+// watcher_<eui> for unregistered devices
+func cameraName(deviceEUI string) string {
+	device, err := database.GetDevice(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if device != nil {
+		if name := strings.Trim(cameraChars.ReplaceAllString(strings.ToLower(device.Name), "_"), "_"); name != "" {
+			return name
+		}
+	}
+	return "watcher_" + strings.ToLower(deviceEUI)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/lan"
+	"github.com/brianhealey/sensecap-server/internal/qr"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// deviceSetupView is a lan.Setup with its QR code as a PNG data URL
+type deviceSetupView struct {
+	lan.Setup
+	QRPNG string `json:"qr_png,omitempty"`
+}
+
+// AdminInfoHandler handles GET /api/admin/info
+// Shows the LAN addresses devices can reach the server at and, for each resulting server URL,
+// the AT+localservice commands and a QR code (server URL and device token) that set up a Watcher.
+func AdminInfoHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := getConfig()
+	addresses := lan.Addresses()
+	urls := lan.ServerURLs(cfg.API.BaseURL, cfg.API.Schema, cfg.Server.Port, cfg.Server.BasePath, addresses)
+
+	setups := []deviceSetupView{}
+	for _, url := range urls {
+		view := deviceSetupView{Setup: lan.NewSetup(url, cfg.Auth.Token)}
+		if code, err := qr.Encode(view.QRText); err != nil {
+			log.Printf("WARNING: Failed to encode setup QR code: %v", err)
+		} else if png, err := code.PNG(4); err != nil {
+			log.Printf("WARNING: Failed to render setup QR code: %v", err)
+		} else {
+			view.QRPNG = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		}
+		setups = append(setups, view)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"version":   version.String(),
+			"port":      cfg.Server.Port,
+			"base_path": cfg.Server.BasePath,
+			"addresses": addresses,
+			"setups":    setups,
+		},
+	})
+}
+
+// UnknownEndpointsHandler handles GET /api/admin/unknown-endpoints (list) and DELETE (reset)
+// Lists catch-all 404s aggregated by path/method/device, showing which firmware
+// features the server does not implement yet.
+func UnknownEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if err := database.ClearUnknownEndpoints(); err != nil {
+			log.Printf("ERROR: Failed to clear unknown endpoints: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to clear unknown endpoints")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	endpoints, err := database.GetUnknownEndpoints()
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve unknown endpoints: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve unknown endpoints")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":     len(endpoints),
+			"endpoints": endpoints,
+		},
+	})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/gorilla/mux"
+)
+
+// Limits of the ?interval= parameter of GET /api/devices/{eui}/mjpeg
+const (
+	defaultStreamInterval = time.Second
+	minStreamInterval     = 100 * time.Millisecond
+	maxStreamInterval     = time.Minute
+)
+
+// streamBoundary separates the JPEG parts of an MJPEG stream
+const streamBoundary = "watcherframe"
+
+// alarmImage is the image of a device's latest alarm
+type alarmImage struct {
+	eventID   int
+	img       string // Base64 JPEG, as stored (with the privacy mode applied)
+	inference string // Inference data (JSON), for annotation
+}
+
+// deviceAlarms holds a device's latest alarm image and wakes up streams when it changes
+type deviceAlarms struct {
+	last *alarmImage
+	next chan struct{} // Closed when the next alarm image arrives
+}
+
+var (
+	alarmImagesMu sync.Mutex
+	alarmImages   = make(map[string]*deviceAlarms)
+)
+
+// publishAlarmImage makes a stored alarm the image of its device's MJPEG stream
+func publishAlarmImage(event *database.NotificationEvent) {
+	if event.Img == "" {
+		return
+	}
+
+	alarmImagesMu.Lock()
+	defer alarmImagesMu.Unlock()
+
+	alarms := alarmImages[event.DeviceEUI]
+	if alarms == nil {
+		alarms = &deviceAlarms{}
+		alarmImages[event.DeviceEUI] = alarms
+	}
+	alarms.last = &alarmImage{eventID: event.ID, img: event.Img, inference: event.InferenceData}
+	if alarms.next != nil {
+		close(alarms.next)
+		alarms.next = nil
+	}
+}
+
+// latestAlarmImage returns a device's latest alarm image (loading it from the database the
+// first time) and a channel that is closed when the next one arrives
+func latestAlarmImage(deviceEUI string) (*alarmImage, <-chan struct{}, error) {
+	alarmImagesMu.Lock()
+	alarms := alarmImages[deviceEUI]
+	alarmImagesMu.Unlock()
+
+	if alarms == nil {
+		event, err := database.LatestAlarmImage(deviceEUI)
+		if err != nil {
+			return nil, nil, err
+		}
+		alarmImagesMu.Lock()
+		// An alarm published while the database was read is newer
+		if alarmImages[deviceEUI] == nil {
+			alarmImages[deviceEUI] = &deviceAlarms{}
+			if event != nil {
+				alarmImages[deviceEUI].last = &alarmImage{eventID: event.ID, img: event.Img, inference: event.InferenceData}
+			}
+		}
+		alarmImagesMu.Unlock()
+	}
+
+	alarmImagesMu.Lock()
+	defer alarmImagesMu.Unlock()
+	alarms = alarmImages[deviceEUI]
+	if alarms.next == nil {
+		alarms.next = make(chan struct{})
+	}
+	return alarms.last, alarms.next, nil
+}
+
+// DeviceAlarmStreamHandler handles GET /api/devices/{eui}/mjpeg?interval=1s&w=640&annotate=true
+// Republishes the device's alarm images as an MJPEG stream (multipart/x-mixed-replace), so NVR
+// software can add the Watcher as a camera and record its alarms. The latest alarm image is
+// sent again every interval (NVRs drop sources that stop sending frames) and a new alarm
+// replaces it as soon as it is stored. Until the device's first alarm, a placeholder is sent.
+// annotate draws the detection boxes; w resizes.
+func DeviceAlarmStreamHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+	query := r.URL.Query()
+
+	interval := defaultStreamInterval
+	if is := query.Get("interval"); is != "" {
+		d, err := time.ParseDuration(is)
+		if err != nil || d < minStreamInterval || d > maxStreamInterval {
+			writeError(w, r, http.StatusBadRequest, "interval must be a duration between %s and %s", minStreamInterval, maxStreamInterval)
+			return
+		}
+		interval = d
+	}
+
+	width := 0
+	if ws := query.Get("w"); ws != "" {
+		n, err := strconv.Atoi(ws)
+		if err != nil || n <= 0 || n > maxThumbnailWidth {
+			writeError(w, r, http.StatusBadRequest, "w must be between 1 and %d", maxThumbnailWidth)
+			return
+		}
+		width = n
+	}
+	annotate := query.Get("annotate") == "true" || query.Get("annotate") == "1"
+
+	current, next, err := latestAlarmImage(deviceEUI)
+	if err != nil {
+		log.Printf("ERROR: Failed to load alarm image of %s: %v", deviceEUI, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+streamBoundary)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	log.Printf("MJPEG stream of %s opened by %s", deviceEUI, r.RemoteAddr)
+
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var frame []byte
+	for {
+		if frame == nil {
+			frame = streamFrame(deviceEUI, current, width, annotate)
+		}
+		if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", streamBoundary, len(frame)); err != nil {
+			break
+		}
+		if _, err := w.Write(frame); err != nil {
+			break
+		}
+		if _, err := io.WriteString(w, "\r\n"); err != nil {
+			break
+		}
+		if err := rc.Flush(); err != nil {
+			break
+		}
+
+		select {
+		case <-next:
+			current, next, err = latestAlarmImage(deviceEUI)
+			if err != nil {
+				log.Printf("WARNING: Failed to load alarm image of %s: %v", deviceEUI, err)
+			}
+			frame = nil
+		case <-ticker.C:
+		case <-r.Context().Done():
+			log.Printf("MJPEG stream of %s closed by %s", deviceEUI, r.RemoteAddr)
+			return
+		}
+	}
+	log.Printf("MJPEG stream of %s to %s ended", deviceEUI, r.RemoteAddr)
+}
+
+// streamFrame renders an alarm image for the MJPEG stream. An image that cannot be decoded,
+// or no image yet, gives a placeholder: the stream must keep sending JPEG frames.
+func streamFrame(deviceEUI string, current *alarmImage, width int, annotate bool) []byte {
+	var data []byte
+	var err error
+	if current != nil {
+		data, err = imaging.DecodeBase64JPEG(current.img)
+		if err == nil && annotate {
+			if boxes := imaging.InferenceBoxes(current.inference); len(boxes) > 0 {
+				data, err = imaging.AnnotateJPEG(data, boxes)
+			}
+		}
+		if err != nil {
+			log.Printf("WARNING: Failed to render alarm image of event %d for the MJPEG stream: %v", current.eventID, err)
+			data = nil
+		}
+	}
+	if data == nil {
+		text := "No alarm yet"
+		if current != nil {
+			text = "Invalid image"
+		}
+		if data, err = imaging.PlaceholderJPEG(640, 480, text); err != nil {
+			log.Printf("ERROR: Failed to render MJPEG placeholder for %s: %v", deviceEUI, err)
+			return nil
+		}
+	}
+
+	if width > 0 {
+		if resized, err := imaging.ResizeJPEG(data, width); err == nil {
+			data = resized
+		} else {
+			log.Printf("WARNING: Failed to resize MJPEG frame for %s: %v", deviceEUI, err)
+		}
+	}
+	return data
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sync"
+)
+
+// RouteAlias maps an alternate endpoint path used by some firmware builds to a canonical handler
+type RouteAlias struct {
+	Path      string   // Alternate path sent by the device (relative to the base path)
+	Canonical string   // Canonical path this alias resolves to
+	Methods   []string // Accepted HTTP methods
+	Handler   http.HandlerFunc
+}
+
+// RouteAliases returns the alias table of legacy/alternate device endpoint paths.
+// Older firmware builds use different version prefixes, and some HTTP clients
+// append a trailing slash; these are routed to the canonical handlers instead of 404ing.
+func RouteAliases() []RouteAlias {
+	return []RouteAlias{
+		// Notification proxy
+		{Path: "/v1/notification/event/", Canonical: "/v1/notification/event", Methods: []string{"POST"}, Handler: NotificationHandler},
+		{Path: "/v2/notification/event", Canonical: "/v1/notification/event", Methods: []string{"POST"}, Handler: NotificationHandler},
+
+		// Image analyzer
+		{Path: "/v1/watcher/vision/", Canonical: "/v1/watcher/vision", Methods: []string{"POST"}, Handler: VisionHandler},
+		{Path: "/v2/watcher/vision", Canonical: "/v1/watcher/vision", Methods: []string{"POST"}, Handler: VisionHandler},
+
+		// Audio task composer
+		{Path: "/v2/watcher/talk/audio_stream/", Canonical: "/v2/watcher/talk/audio_stream", Methods: []string{"POST"}, Handler: AudioStreamHandler},
+		{Path: "/v1/watcher/talk/audio_stream", Canonical: "/v2/watcher/talk/audio_stream", Methods: []string{"POST"}, Handler: AudioStreamHandler},
+
+		// Task detail
+		{Path: "/v2/watcher/talk/view_task_detail/", Canonical: "/v2/watcher/talk/view_task_detail", Methods: []string{"GET", "POST"}, Handler: TaskDetailHandler},
+		{Path: "/v1/watcher/talk/view_task_detail", Canonical: "/v2/watcher/talk/view_task_detail", Methods: []string{"GET", "POST"}, Handler: TaskDetailHandler},
+	}
+}
+
+// aliasUsage tracks which alias paths each device has used, so the variant is logged once per device
+var (
+	aliasUsage   = make(map[string]bool)
+	aliasUsageMu sync.Mutex
+)
+
+// AliasHandler wraps the alias's handler to log which endpoint variant each device uses
+func AliasHandler(alias RouteAlias) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+		key := deviceEUI + " " + alias.Path
+
+		aliasUsageMu.Lock()
+		firstUse := !aliasUsage[key]
+		aliasUsage[key] = true
+		aliasUsageMu.Unlock()
+
+		if firstUse {
+			log.Printf("COMPAT: Device %s uses alternate endpoint %s %s (routed to %s)",
+				deviceEUI, r.Method, alias.Path, alias.Canonical)
+		}
+
+		alias.Handler(w, r)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAnnouncementTTL = 10 * time.Minute
+	maxAnnouncementTTL     = 24 * time.Hour
+	maxAnnouncementChars   = 500
+
+	// announcementHistory is how long expired announcements are listed before they are deleted
+	announcementHistory = 7 * 24 * time.Hour
+)
+
+// speakRequest is the body of POST /api/devices/{eui}/speak
+type speakRequest struct {
+	Text string `json:"text"`
+	TTL  string `json:"ttl"` // How long the announcement waits for the device, e.g. 10m (default 10m, max 24h)
+}
+
+// SpeakHandler handles GET and POST /api/devices/{eui}/speak
+// POST synthesizes {"text": "...", "ttl": "10m"} and queues it for the device, which plays it
+// with the reply to its next image analysis request (/v1/watcher/vision): the stock firmware
+// accepts no connections and has no BLE command to play audio, so the server can only answer.
+// GET lists the device's recent announcements and whether they were delivered.
+func SpeakHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	if r.Method == http.MethodGet {
+		list, err := database.GetAnnouncements(deviceEUI, 50)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve announcements for %s: %v", deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve announcements")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": list})
+		return
+	}
+
+	var req speakRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		writeError(w, r, http.StatusBadRequest, "text is required")
+		return
+	}
+	if len([]rune(text)) > maxAnnouncementChars {
+		writeError(w, r, http.StatusBadRequest, "text must be at most %d characters", maxAnnouncementChars)
+		return
+	}
+
+	ttl := defaultAnnouncementTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > maxAnnouncementTTL {
+			writeError(w, r, http.StatusBadRequest, "ttl must be a positive duration of at most 24h, e.g. 10m")
+			return
+		}
+		ttl = d
+	}
+
+	audioData, err := synthesizeSpeech(text)
+	if err != nil {
+		log.Printf("ERROR: Failed to synthesize announcement for %s: %v", deviceEUI, err)
+		status := http.StatusBadGateway
+		if errors.Is(err, errBackendUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, r, status, "speech synthesis failed")
+		return
+	}
+
+	announcement := &database.Announcement{
+		DeviceEUI: deviceEUI,
+		Text:      text,
+		Audio:     audioData,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := database.CreateAnnouncement(announcement); err != nil {
+		log.Printf("ERROR: Failed to queue announcement for %s: %v", deviceEUI, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to queue announcement")
+		return
+	}
+	if _, err := database.DeleteAnnouncementsBefore(time.Now().Add(-announcementHistory)); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+
+	log.Printf("Queued announcement %d for %s (%d bytes of audio, expires in %s): %s", announcement.ID, deviceEUI, len(audioData), ttl, text)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"code": 202, "data": announcement})
+}
+
+// nextAnnouncementAudio claims a device's next queued announcement and returns its audio
+// (base64 WAV) for a reply to the device, or nil if there is none
+func nextAnnouncementAudio(deviceEUI string) *string {
+	now := time.Now()
+	announcement, err := database.NextAnnouncement(deviceEUI, now)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+		return nil
+	}
+	if announcement == nil {
+		return nil
+	}
+
+	claimed, err := database.MarkAnnouncementDelivered(announcement.ID, now)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+		return nil
+	}
+	if !claimed {
+		return nil
+	}
+
+	log.Printf("Delivering announcement %d to %s: %s", announcement.ID, deviceEUI, announcement.Text)
+	audioB64 := base64.StdEncoding.EncodeToString(announcement.Audio)
+	return &audioB64
+}
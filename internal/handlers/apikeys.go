@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// defaultRotationGrace is how long a rotated key keeps working so clients can switch over
+const defaultRotationGrace = 24 * time.Hour
+
+// APIKeysHandler handles GET /api/apikeys (list, never including the keys themselves) and
+// POST /api/apikeys (create):
+// {"name": "grafana", "scope": "management", "user_id": 1, "expires_in": "720h"}
+// {"name": "kitchen", "scope": "device", "device_eui": "2CF7F1C0...", "expires_in": "8760h"}
+// Management keys act as user_id (default: the calling account). The key is only returned here.
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		keys, err := database.GetAPIKeys()
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve API keys: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve API keys")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": keys})
+		return
+	}
+
+	var req struct {
+		Name      string `json:"name"`
+		Scope     string `json:"scope"`
+		UserID    int    `json:"user_id"`
+		DeviceEUI string `json:"device_eui"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	apiKey := &database.APIKey{Name: strings.TrimSpace(req.Name), Scope: req.Scope}
+	if apiKey.Name == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	switch req.Scope {
+	case database.KeyScopeManagement:
+		apiKey.UserID = req.UserID
+		if apiKey.UserID == 0 {
+			apiKey.UserID = auth.UserFrom(r).ID
+		}
+		user, err := database.GetUserByID(apiKey.UserID)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve user %d: %v", apiKey.UserID, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to create API key")
+			return
+		}
+		if user == nil {
+			writeError(w, r, http.StatusBadRequest, "management keys need the user_id of an existing account")
+			return
+		}
+	case database.KeyScopeDevice:
+		apiKey.DeviceEUI = strings.TrimSpace(req.DeviceEUI)
+	default:
+		writeError(w, r, http.StatusBadRequest, "scope must be management or device")
+		return
+	}
+
+	if req.ExpiresIn != "" {
+		lifetime, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || lifetime <= 0 {
+			writeError(w, r, http.StatusBadRequest, "expires_in must be a positive duration, e.g. 720h")
+			return
+		}
+		expires := time.Now().Add(lifetime)
+		apiKey.ExpiresAt = &expires
+	}
+
+	key, ok := createAPIKey(w, r, apiKey)
+	if !ok {
+		return
+	}
+
+	log.Printf("Created %s API key %s (%s)", apiKey.Scope, apiKey.Prefix, apiKey.Name)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"code": 201,
+		"data": map[string]interface{}{"key": key, "api_key": apiKey},
+	})
+}
+
+// APIKeyHandler handles DELETE /api/apikeys/{id}, revoking the key immediately
+func APIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid API key ID")
+		return
+	}
+
+	found, err := database.RevokeAPIKey(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke API key %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to revoke API key")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "API key not found or already revoked")
+		return
+	}
+
+	log.Printf("Revoked API key %d", id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+// APIKeyRotateHandler handles POST /api/apikeys/{id}/rotate?grace=24h
+// Issues a replacement key with the same name, scope, binding, and lifetime, and lets the
+// old key expire after the grace period (0 revokes it right away).
+func APIKeyRotateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid API key ID")
+		return
+	}
+
+	grace := defaultRotationGrace
+	if gs := r.URL.Query().Get("grace"); gs != "" {
+		grace, err = time.ParseDuration(gs)
+		if err != nil || grace < 0 {
+			writeError(w, r, http.StatusBadRequest, "grace must be a duration, e.g. 24h")
+			return
+		}
+	}
+
+	old, err := database.GetAPIKeyByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve API key %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to rotate API key")
+		return
+	}
+	if old == nil || !old.Active() {
+		writeError(w, r, http.StatusNotFound, "API key not found, revoked, or expired")
+		return
+	}
+
+	apiKey := &database.APIKey{Name: old.Name, Scope: old.Scope, UserID: old.UserID, DeviceEUI: old.DeviceEUI}
+	if old.ExpiresAt != nil {
+		expires := time.Now().Add(old.ExpiresAt.Sub(old.CreatedAt))
+		apiKey.ExpiresAt = &expires
+	}
+
+	key, ok := createAPIKey(w, r, apiKey)
+	if !ok {
+		return
+	}
+
+	// Never extend the old key's life
+	retire := time.Now().Add(grace)
+	if grace == 0 {
+		_, err = database.RevokeAPIKey(old.ID)
+	} else if old.ExpiresAt == nil || retire.Before(*old.ExpiresAt) {
+		err = database.SetAPIKeyExpiry(old.ID, retire)
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to retire rotated API key %d: %v", old.ID, err)
+	}
+
+	log.Printf("Rotated API key %s -> %s (old key valid for %s)", old.Prefix, apiKey.Prefix, grace)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"code": 201,
+		"data": map[string]interface{}{"key": key, "api_key": apiKey, "replaces": old.ID},
+	})
+}
+
+// createAPIKey generates and stores a key, writing a 500 response on failure
+func createAPIKey(w http.ResponseWriter, r *http.Request, apiKey *database.APIKey) (string, bool) {
+	key, hash, prefix, err := auth.NewAPIKey()
+	if err == nil {
+		apiKey.Prefix = prefix
+		err = database.CreateAPIKey(apiKey, hash)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to create API key: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to create API key")
+		return "", false
+	}
+	return key, true
+}
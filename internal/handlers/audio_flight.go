@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+)
+
+// audioResultTTL is how long a finished response is replayed to late duplicate requests
+const audioResultTTL = 30 * time.Second
+
+// audioResult is a finished audio pipeline response
+type audioResult struct {
+	status   int
+	response *talk.Response // Sent when status is 200
+	message  string         // Error message otherwise
+
+	// What was heard and answered, for the interaction history (successful runs only)
+	mode          int
+	transcription string
+	text          string
+	reply         []byte // WAV audio (nil if TTS was unavailable)
+	stages        pipelineStages
+}
+
+// pipelineStages records when each stage of a voice request ran, for the interaction
+// history and traces
+type pipelineStages struct {
+	received time.Time // When the request came in
+	stt      stage     // Whisper transcription
+	mode     stage     // Mode detection (chat or task)
+	llm      stage     // The chat answer, task planning, or reply to a read-back
+	tts      stage     // Piper synthesis
+	write    stage     // Sending the response to the device
+}
+
+// stage is when a pipeline stage ran (zero if it did not)
+type stage struct {
+	start time.Time
+	end   time.Time
+}
+
+// timeStage starts timing s; the returned function ends it
+func timeStage(s *stage) func() {
+	s.start = time.Now()
+	return func() { s.end = time.Now() }
+}
+
+func (s stage) duration() time.Duration {
+	if s.start.IsZero() {
+		return 0
+	}
+	return s.end.Sub(s.start)
+}
+
+// total is the time from receiving the request to the end of the response
+func (p pipelineStages) total() time.Duration {
+	if p.write.end.IsZero() {
+		return 0
+	}
+	return p.write.end.Sub(p.received)
+}
+
+// audioCall is a pipeline run shared by all requests with the same key
+type audioCall struct {
+	done   chan struct{}
+	result *audioResult
+}
+
+var (
+	audioCallsMu sync.Mutex
+	audioCalls   = make(map[string]*audioCall)
+)
+
+// audioCallKey identifies duplicate audio requests: same device, session, and audio.
+// Requests without a session ID are never treated as duplicates.
+func audioCallKey(deviceEUI, sessionID string, audio []byte) string {
+	if sessionID == "" {
+		return ""
+	}
+	return deviceEUI + "/" + sessionID + "/" + audioSum(audio)
+}
+
+// audioSum is the hex SHA-256 of a request body, telling a retried recording from a new one
+func audioSum(audio []byte) string {
+	sum := sha256.Sum256(audio)
+	return hex.EncodeToString(sum[:])
+}
+
+// runAudioOnce runs fn once per key. Requests with the same key that arrive while fn is
+// running, or within audioResultTTL after it finished, get the same result (shared = true).
+func runAudioOnce(key string, fn func() *audioResult) (result *audioResult, shared bool) {
+	if key == "" {
+		return fn(), false
+	}
+
+	audioCallsMu.Lock()
+	if call, ok := audioCalls[key]; ok {
+		audioCallsMu.Unlock()
+		<-call.done
+		return call.result, true
+	}
+	call := &audioCall{done: make(chan struct{})}
+	audioCalls[key] = call
+	audioCallsMu.Unlock()
+
+	defer func() {
+		if call.result == nil {
+			// fn panicked; waiting duplicates get an error instead of a nil result
+			call.result = &audioResult{status: http.StatusInternalServerError, message: "Audio processing failed"}
+		}
+		close(call.done)
+		time.AfterFunc(audioResultTTL, func() {
+			audioCallsMu.Lock()
+			delete(audioCalls, key)
+			audioCallsMu.Unlock()
+		})
+	}()
+
+	call.result = fn()
+	return call.result, false
+}
+
+// cachedAudioResponse returns the stored response for a device session within the
+// response cache TTL, or nil. Only the same recording gets it: a new one posted with a
+// reused session ID is a new question.
+func cachedAudioResponse(deviceEUI, sessionID string, audio []byte) *talk.Response {
+	ttl := getConfig().Cache.ResponseTTL
+	if sessionID == "" || ttl <= 0 {
+		return nil
+	}
+
+	response, err := database.GetAudioResponse(deviceEUI, sessionID, audioSum(audio), time.Now().Add(-ttl))
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+		return nil
+	}
+	if response == nil {
+		return nil
+	}
+
+	parsed, err := talk.Parse(response)
+	if err != nil {
+		log.Printf("WARNING: Ignoring stored response of session %s from %s: %v", sessionID, deviceEUI, err)
+		return nil
+	}
+	return parsed
+}
+
+// storeAudioResponse keeps a successful response to a recording for device retries and
+// drops expired ones
+func storeAudioResponse(deviceEUI, sessionID string, audio []byte, response *talk.Response) {
+	ttl := getConfig().Cache.ResponseTTL
+	if sessionID == "" || ttl <= 0 {
+		return
+	}
+
+	if err := database.SaveAudioResponse(deviceEUI, sessionID, audioSum(audio), response.Bytes()); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if _, err := database.DeleteAudioResponsesBefore(time.Now().Add(-ttl)); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+)
+
+func TestCachedAudioResponseNeedsSameRecording(t *testing.T) {
+	if err := database.Initialize(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	SetConfig(&config.Config{Cache: config.CacheConfig{ResponseTTL: 5 * time.Minute}})
+	defer SetConfig(nil)
+
+	const device, session = "2CF7F1C04430000C", "sess-1"
+	first, second := []byte("first recording"), []byte("second recording")
+	response, err := talk.NewResponse(map[string]string{"stt_result": "first"}, []byte("RIFF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeAudioResponse(device, session, first, response)
+
+	cached := cachedAudioResponse(device, session, first)
+	if cached == nil {
+		t.Fatal("retry of the same recording: no stored response")
+	}
+	if !bytes.Equal(cached.Bytes(), response.Bytes()) {
+		t.Errorf("retry of the same recording: got %q, want %q", cached.Bytes(), response.Bytes())
+	}
+	if cached := cachedAudioResponse(device, session, second); cached != nil {
+		t.Errorf("new recording with the same session ID: got the stored response %q", cached.Bytes())
+	}
+}
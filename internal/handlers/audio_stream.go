@@ -1,139 +1,333 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/brianhealey/sensecap-server/internal/audio"
+	"github.com/brianhealey/sensecap-server/internal/audit"
+	"github.com/brianhealey/sensecap-server/internal/config"
 	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+	"github.com/brianhealey/sensecap-server/internal/tracing"
 )
 
 // AudioStreamHandler handles /v2/watcher/talk/audio_stream POST requests
 func AudioStreamHandler(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+
 	// Read device EUI and session from headers
 	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
 	sessionID := r.Header.Get("Session-Id")
 	authToken := r.Header.Get("Authorization")
 
-	// Read audio stream body
-	body, err := io.ReadAll(r.Body)
+	// Read audio stream body into a pooled buffer, returned once the interaction is recorded
+	buf, err := readBody(r)
 	if err != nil {
 		log.Printf("ERROR: Failed to read audio stream body: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		http.Error(w, "Failed to read request body", readBodyStatus(err))
 		return
 	}
 	defer r.Body.Close()
+	defer putBodyBuffer(buf)
+	body := buf.Bytes()
 
 	// Log the request
 	logAudioStreamRequest(r, deviceEUI, sessionID, authToken, body)
 
+	// A device retrying a request (the same recording, e.g. after a network hiccup) gets the
+	// stored response, unless the post answers a task read-back made earlier in the same session
+	if cached := cachedAudioResponse(deviceEUI, sessionID, body); cached != nil && !awaitingConfirmation(deviceEUI) {
+		log.Printf("Retried session %s from %s: replaying stored response (%d bytes)", sessionID, deviceEUI, cached.Len())
+		writeAudioResult(w, &audioResult{status: http.StatusOK, response: cached})
+		return
+	}
+
+	// Devices occasionally post the same audio twice; run the pipeline once and
+	// send the duplicate the same response
+	var input []byte
+	result, shared := runAudioOnce(audioCallKey(deviceEUI, sessionID, body), func() *audioResult {
+		input = normalizeUpload(body)
+		result := processAudioStream(deviceEUI, sessionID, input)
+		if result.status == http.StatusOK {
+			storeAudioResponse(deviceEUI, sessionID, body, result.response)
+		}
+		return result
+	})
+	if shared {
+		log.Printf("Duplicate audio request from %s (session %s): sent the shared response", deviceEUI, sessionID)
+		writeAudioResult(w, result)
+		return
+	}
+
+	// The interaction is recorded once the response is sent, so its timing covers the write
+	result.stages.received = received
+	done := timeStage(&result.stages.write)
+	writeAudioResult(w, result)
+	done()
+	if result.status == http.StatusOK {
+		recordVoiceInteraction(deviceEUI, sessionID, input, result)
+	}
+	traceAudioRequest(deviceEUI, sessionID, result)
+}
+
+// traceAudioRequest exports the stages of a voice request as a trace (if tracing is enabled)
+func traceAudioRequest(deviceEUI, sessionID string, result *audioResult) {
+	if !tracing.Enabled() {
+		return
+	}
+
+	s := result.stages
+	root := tracing.Span{
+		Name:  "voice request",
+		Start: s.received,
+		End:   s.write.end,
+		Attributes: map[string]string{
+			"device.eui":                deviceEUI,
+			"session.id":                sessionID,
+			"http.response.status_code": strconv.Itoa(result.status),
+		},
+	}
+	if result.status == http.StatusOK {
+		root.Attributes["voice.mode"] = strconv.Itoa(result.mode)
+	} else {
+		root.Error = result.message
+	}
+
+	var children []tracing.Span
+	for _, stage := range []struct {
+		name string
+		stage
+	}{
+		{"stt", s.stt},
+		{"mode detection", s.mode},
+		{"llm", s.llm},
+		{"tts", s.tts},
+		{"response write", s.write},
+	} {
+		if !stage.start.IsZero() && !stage.end.IsZero() {
+			children = append(children, tracing.Span{Name: stage.name, Start: stage.start, End: stage.end})
+		}
+	}
+	tracing.Record(root, children...)
+}
+
+// writeAudioResult sends a pipeline result to the device
+func writeAudioResult(w http.ResponseWriter, result *audioResult) {
+	if result.status != http.StatusOK {
+		http.Error(w, result.message, result.status)
+		return
+	}
+	result.response.Serve(w)
+}
+
+// normalizeUpload converts uploaded audio to 16kHz mono WAV for Whisper and logs its real
+// length. Audio that cannot be decoded here is returned as is for the audio service to try.
+func normalizeUpload(body []byte) []byte {
+	wav, format, err := audio.Normalize(body, getConfig().AI.FFmpegPath)
+	if err != nil {
+		log.Printf("WARNING: Failed to decode %s audio, forwarding it as is: %v", format, err)
+		return body
+	}
+
+	duration, _ := audio.Duration(wav)
+	log.Printf("Audio input: %s, %.2f seconds (%d bytes as 16kHz mono WAV)", format, duration.Seconds(), len(wav))
+	return wav
+}
+
+// processAudioStream runs the voice pipeline (STT, chat or task, TTS) and builds the multipart response
+func processAudioStream(deviceEUI, sessionID string, body []byte) (result *audioResult) {
+	// speakResponse and fallbackAudioResponse time TTS; the other stages are timed here
+	var stages pipelineStages
+	defer func() {
+		if result != nil {
+			stages.tts = result.stages.tts
+			result.stages = stages
+		}
+	}()
+
 	// Step 1: Transcribe audio using Whisper
 	log.Println("Step 1: Transcribing audio with Whisper...")
+	done := timeStage(&stages.stt)
 	transcription, err := transcribeAudio(body)
+	done()
+	if errors.Is(err, errBackendUnavailable) {
+		log.Printf("WARNING: Transcription skipped: %v", err)
+		return fallbackAudioResponse("", "Sorry, I can't hear you right now because speech recognition is unavailable. Please try again in a minute.")
+	}
 	if err != nil {
 		log.Printf("ERROR: Transcription failed: %v", err)
-		http.Error(w, "Transcription failed", http.StatusInternalServerError)
-		return
+		return &audioResult{status: http.StatusInternalServerError, message: "Transcription failed"}
 	}
 	log.Printf("Transcription: '%s'", transcription)
 
-	// Step 2: Determine mode (chat vs task)
+	// Use the device's release channel (canary devices get canary prompt/model overrides)
+	devCfg := getConfig().ForDevice(deviceEUI)
+	llmStart := time.Now()
+
+	// A reply to a task read-back is answered in the context of the conversation
+	done = timeStage(&stages.llm)
+	mode, ollamaResponse, task, handled := continueVoiceSession(deviceEUI, sessionID, transcription)
+	done()
+	if handled {
+		log.Printf("Response: '%s'", ollamaResponse)
+		return speakResponse(mode, transcription, ollamaResponse, task)
+	}
+
+	// Step 2: Determine mode (chat vs task), generating the chat answer meanwhile
 	log.Println("Step 2: Determining interaction mode...")
-	mode := determineMode(transcription)
+	chat := startSpeculativeChat(devCfg, transcription)
+	done = timeStage(&stages.mode)
+	mode = determineMode(devCfg, transcription)
+	done()
 	log.Printf("Mode determined: %d", mode)
 
-	var ollamaResponse string
+	done = timeStage(&stages.llm)
 	if mode == 0 {
 		// Chat mode - conversational response
 		log.Println("Step 3: Processing chat with Ollama...")
-		response, err := processChatMode(transcription)
+		var response string
+		if chat != nil {
+			stages.llm.start = chat.started
+			response, err = chat.wait()
+		} else {
+			response, err = processChatMode(context.Background(), devCfg, transcription)
+		}
+		done()
+		if errors.Is(err, errBackendUnavailable) {
+			log.Printf("WARNING: Chat skipped: %v", err)
+			return fallbackAudioResponse(transcription, assistantUnavailableText)
+		}
 		if err != nil {
 			log.Printf("ERROR: Chat processing failed: %v", err)
-			http.Error(w, "Chat processing failed", http.StatusInternalServerError)
-			return
+			return &audioResult{status: http.StatusInternalServerError, message: "Chat processing failed"}
 		}
 		ollamaResponse = response
 	} else {
-		// Task mode - extract trigger and create task
+		// Task mode - extract trigger and create task (or store a draft and read it back for confirmation)
 		log.Println("Step 3: Processing task mode...")
-		response, err := processTaskMode(transcription, mode, deviceEUI)
+		if chat != nil {
+			chat.cancel()
+		}
+		response, talkTask, err := processTaskRequest(devCfg, transcription, mode, deviceEUI, sessionID)
+		done()
+		if errors.Is(err, errBackendUnavailable) {
+			log.Printf("WARNING: Task creation skipped: %v", err)
+			return fallbackAudioResponse(transcription, assistantUnavailableText)
+		}
 		if err != nil {
 			log.Printf("ERROR: Task processing failed: %v", err)
-			http.Error(w, "Task processing failed", http.StatusInternalServerError)
-			return
+			return &audioResult{status: http.StatusInternalServerError, message: "Task processing failed"}
+		}
+		if talkTask == nil || talkTask.Status != models.TaskActive {
+			// Task was rejected or waits for confirmation; answer as chat so the device keeps its current task
+			mode = 0
 		}
 		ollamaResponse = response
+		task = talkTask
 	}
 	log.Printf("Response: '%s'", ollamaResponse)
 
+	kind := "chat"
+	if mode != 0 {
+		kind = "task"
+	}
+	recordInferenceMetric(devCfg, deviceEUI, kind, devCfg.AI.OllamaModel, time.Since(llmStart), false)
+
+	return speakResponse(mode, transcription, ollamaResponse, task)
+}
+
+// speakResponse synthesizes the response text and builds the multipart response
+func speakResponse(mode int, transcription, ollamaResponse string, task *models.TalkTask) *audioResult {
 	// Step 4: Synthesize speech with Piper TTS
 	log.Println("Step 4: Synthesizing speech with Piper TTS...")
+	var tts stage
+	done := timeStage(&tts)
 	audioData, err := synthesizeSpeech(ollamaResponse)
-	if err != nil {
+	done()
+	if errors.Is(err, errBackendUnavailable) {
+		// Send the text without audio; the device still shows it on screen
+		log.Printf("WARNING: Speech synthesis skipped: %v", err)
+		audioData = nil
+	} else if err != nil {
 		log.Printf("ERROR: Speech synthesis failed: %v", err)
-		http.Error(w, "Speech synthesis failed", http.StatusInternalServerError)
-		return
+		return &audioResult{status: http.StatusInternalServerError, message: "Speech synthesis failed", stages: pipelineStages{tts: tts}}
 	}
 	log.Printf("Generated %d bytes of audio", len(audioData))
 
-	// Calculate audio duration from WAV file
-	// WAV header is 44 bytes, then raw PCM data
-	// Format: 16kHz, mono, 16-bit = 32000 bytes/sec
-	audioDataSize := len(audioData) - 44 // Subtract WAV header
-	if audioDataSize < 0 {
-		audioDataSize = 0
+	result := buildAudioResponse(mode, transcription, ollamaResponse, task, audioData)
+	result.stages.tts = tts
+	return result
+}
+
+// assistantUnavailableText is spoken when the LLM backend is down
+const assistantUnavailableText = "Sorry, my assistant is unavailable right now. Please try again in a minute."
+
+// fallbackAudioResponse answers in chat mode with a fixed message when an AI backend is down,
+// spoken if TTS is available
+func fallbackAudioResponse(transcription, text string) *audioResult {
+	var tts stage
+	done := timeStage(&tts)
+	audioData, err := synthesizeSpeech(text)
+	done()
+	if err != nil {
+		log.Printf("WARNING: Speech synthesis for fallback response failed: %v", err)
+		audioData = nil
 	}
-	audioDurationMs := int((float64(audioDataSize) / 32000.0) * 1000)
-	log.Printf("Audio duration: %dms (%d bytes WAV, %d bytes PCM)", audioDurationMs, len(audioData), audioDataSize)
+	result := buildAudioResponse(0, transcription, text, nil, audioData)
+	result.stages.tts = tts
+	return result
+}
+
+// buildAudioResponse builds the multipart voice response: JSON metadata, boundary, WAV audio
+func buildAudioResponse(mode int, transcription, text string, task *models.TalkTask, audioData []byte) *audioResult {
+	// Calculate audio duration from the WAV header (Piper voices differ in sample rate)
+	audioDurationMs := 0
+	if len(audioData) > 0 {
+		duration, err := audio.Duration(audioData)
+		if err != nil {
+			log.Printf("WARNING: Failed to read reply audio duration: %v", err)
+		}
+		audioDurationMs = int(duration.Milliseconds())
+	}
+	log.Printf("Audio duration: %dms (%d bytes WAV)", audioDurationMs, len(audioData))
 
 	// Prepare JSON response metadata
-	// Based on app_voice_interaction.c lines 1189-1310
-	jsonResponse := map[string]interface{}{
-		"code": 200,
-		"data": map[string]interface{}{
-			"mode":        mode,            // 0=chat, 1=task, 2=task_auto
-			"duration":    audioDurationMs, // Audio duration in ms
-			"stt_result":  transcription,
-			"screen_text": ollamaResponse,
+	jsonResponse := models.TalkResponse{
+		Code: 200,
+		Data: models.TalkResponseData{
+			Mode:       mode,
+			Duration:   audioDurationMs,
+			STTResult:  transcription,
+			ScreenText: text,
+			Task:       task,
 		},
 	}
 
-	// Marshal JSON
-	jsonBytes, err := json.Marshal(jsonResponse)
+	response, err := talk.NewResponse(jsonResponse, audioData)
 	if err != nil {
-		log.Printf("ERROR: Failed to marshal JSON response: %v", err)
-		http.Error(w, "Failed to create response", http.StatusInternalServerError)
-		return
+		log.Printf("ERROR: %v", err)
+		return &audioResult{status: http.StatusInternalServerError, message: "Failed to create response"}
 	}
 
-	// Build multipart response: JSON + boundary + binary audio
-	// Based on app_voice_interaction.c lines 313-348
-	boundary := "---sensecraftboundary---"
-
-	// Calculate total response size
-	totalSize := len(jsonBytes) + len(boundary) + 1 + len(audioData) // +1 for newline after boundary
-
-	// Set headers - Content-Length is critical for device to download all audio
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", totalSize))
-	w.WriteHeader(http.StatusOK)
-
-	// Write JSON metadata
-	w.Write(jsonBytes)
-
-	// Write boundary
-	w.Write([]byte(boundary + "\n"))
-
-	// Write audio data
-	w.Write(audioData)
-
-	log.Printf("Sent multipart response: %d bytes total (%d JSON + boundary + %d audio)",
-		totalSize, len(jsonBytes), len(audioData))
+	log.Printf("Built multipart response: %d bytes total (%d JSON + boundary + %d audio)",
+		response.Len(), len(response.Meta), len(audioData))
+	return &audioResult{
+		status:        http.StatusOK,
+		response:      response,
+		mode:          mode,
+		transcription: transcription,
+		text:          text,
+		reply:         audioData,
+	}
 }
 
 func logAudioStreamRequest(r *http.Request, deviceEUI, sessionID, authToken string, audioData []byte) {
@@ -169,23 +363,7 @@ func logAudioStreamRequest(r *http.Request, deviceEUI, sessionID, authToken stri
 	// Analyze audio data format
 	if len(audioData) > 0 {
 		// Check for common audio format headers
-		if len(audioData) >= 4 {
-			header := audioData[0:4]
-
-			// Check for WAV (RIFF)
-			if string(header[0:4]) == "RIFF" {
-				log.Println("Audio Format:  WAV (detected RIFF header)")
-			} else if header[0] == 0xFF && (header[1]&0xE0) == 0xE0 {
-				log.Println("Audio Format:  MP3 (detected sync word)")
-			} else if header[0] == 0x4F && header[1] == 0x67 && header[2] == 0x67 && header[3] == 0x53 {
-				log.Println("Audio Format:  OGG (detected magic number)")
-			} else if len(audioData) >= 12 && string(audioData[4:12]) == "ftypM4A " {
-				log.Println("Audio Format:  M4A/AAC")
-			} else {
-				log.Printf("Audio Format:  Unknown/Raw (first 4 bytes: %02X %02X %02X %02X)",
-					header[0], header[1], header[2], header[3])
-			}
-		}
+		log.Printf("Audio Format:  %s", audio.Detect(audioData))
 
 		// Show first few bytes for debugging
 		previewSize := 16
@@ -195,30 +373,24 @@ func logAudioStreamRequest(r *http.Request, deviceEUI, sessionID, authToken stri
 		log.Printf("First %d bytes: % X", previewSize, audioData[0:previewSize])
 	}
 
-	// Estimate duration (rough estimate for common formats)
-	// This is a very rough estimate - actual duration depends on sample rate and encoding
-	if len(audioData) > 0 {
-		// Rough estimate: 16kHz, 16-bit mono PCM = 32KB/sec
-		estimatedSeconds := float64(len(audioData)) / 32000.0
-		log.Printf("Estimated:     ~%.2f seconds (assuming 16kHz 16-bit mono PCM)", estimatedSeconds)
-	}
-
 	log.Println("================================================================================")
 	log.Println()
 }
 
 // transcribeAudio sends audio to the Python audio service for transcription
 func transcribeAudio(audioData []byte) (string, error) {
-	whisperURL := cfg.AI.WhisperURL + "/transcribe"
-	resp, err := http.Post(whisperURL, "application/octet-stream", bytes.NewReader(audioData))
+	whisperURL := getConfig().AI.WhisperURL + "/transcribe"
+	contentType := "application/octet-stream"
+	if audio.Detect(audioData) == audio.FormatWAV {
+		contentType = "audio/wav"
+	}
+	resp, err := whisperBackend.post(whisperURL, contentType, audioData)
 	if err != nil {
 		return "", fmt.Errorf("failed to call transcription service: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("transcription service returned %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("transcription service returned %d: %s", resp.StatusCode, string(resp.Body))
 	}
 
 	var result struct {
@@ -226,7 +398,7 @@ func transcribeAudio(audioData []byte) (string, error) {
 		Language string `json:"language"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
 		return "", fmt.Errorf("failed to decode transcription response: %w", err)
 	}
 
@@ -235,38 +407,28 @@ func transcribeAudio(audioData []byte) (string, error) {
 
 // determineMode analyzes the transcription to determine the interaction mode
 // Returns: 0 = VI_MODE_CHAT, 1 = VI_MODE_TASK, 2 = VI_MODE_TASK_AUTO
-func determineMode(transcription string) int {
+func determineMode(c *config.Config, transcription string) int {
 	// Use Function Selection Assistant prompt to determine mode
-	prompt := fmt.Sprintf(`Your name is "watcher" and you are a function selection assistant. You analyze the user's input in relation to the definition of the "Mode List" and then select the most appropriate function from the list.
-
-Mode List:
-- Mode 0 (CHAT): General conversation, questions, casual interaction
-- Mode 1 (TASK): User wants to set up a monitoring task or automation (e.g., "notify me when...", "alert me if...", "watch for...")
-- Mode 2 (TASK_AUTO): Automatic task execution (rarely used)
-
-User input: "%s"
-
-Respond with ONLY the mode number (0, 1, or 2). No explanation.`, transcription)
+	prompt := fmt.Sprintf(c.Prompts.ModeDetection, transcription)
 
 	requestBody := map[string]interface{}{
-		"model":  cfg.AI.OllamaModel,
+		"model":  c.AI.OllamaModel,
 		"prompt": prompt,
 		"stream": false,
 	}
 
 	jsonData, _ := json.Marshal(requestBody)
-	ollamaURL := cfg.AI.OllamaURL + "/api/generate"
-	resp, err := http.Post(ollamaURL, "application/json", bytes.NewReader(jsonData))
+	ollamaURL := c.AI.OllamaURL + "/api/generate"
+	resp, err := ollamaBackend.post(ollamaURL, "application/json", jsonData)
 	if err != nil {
 		log.Printf("WARNING: Mode detection failed, defaulting to chat mode: %v", err)
 		return 0 // Default to chat mode
 	}
-	defer resp.Body.Close()
 
 	var result struct {
 		Response string `json:"response"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
 		log.Printf("WARNING: Failed to decode mode detection response, defaulting to chat mode: %v", err)
 		return 0
 	}
@@ -282,16 +444,12 @@ Respond with ONLY the mode number (0, 1, or 2). No explanation.`, transcription)
 }
 
 // processChatMode handles conversational chat requests
-func processChatMode(transcription string) (string, error) {
+func processChatMode(ctx context.Context, c *config.Config, transcription string) (string, error) {
 	// Use official Chat Assistant prompt
-	prompt := fmt.Sprintf(`Your name is watcher, and you're a chatbot that can have a nice chat with users based on their input. At the same time, you'll reject all answers to questions about terrorism, racism, yellow violence, political sensitivity, LGBT issues, etc.
-
-User said: "%s"
-
-Provide a brief, conversational response (1-2 sentences max).`, transcription)
+	prompt := fmt.Sprintf(c.Prompts.Chat, transcription)
 
 	requestBody := map[string]interface{}{
-		"model":  cfg.AI.OllamaModel,
+		"model":  c.AI.OllamaModel,
 		"prompt": prompt,
 		"stream": false,
 	}
@@ -301,114 +459,241 @@ Provide a brief, conversational response (1-2 sentences max).`, transcription)
 		return "", fmt.Errorf("failed to marshal chat request: %w", err)
 	}
 
-	resp, err := http.Post(cfg.AI.OllamaURL + "/api/generate", "application/json", bytes.NewReader(jsonData))
+	resp, err := ollamaBackend.postContext(ctx, c.AI.OllamaURL+"/api/generate", "application/json", jsonData)
 	if err != nil {
 		return "", fmt.Errorf("failed to call Ollama for chat: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(resp.Body))
 	}
 
 	var result struct {
 		Response string `json:"response"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
 		return "", fmt.Errorf("failed to decode chat response: %w", err)
 	}
 
 	return result.Response, nil
 }
 
-// processTaskMode handles task automation requests
-func processTaskMode(transcription string, mode int, deviceEUI string) (string, error) {
-	// Step 1: Extract trigger condition
-	triggerPrompt := fmt.Sprintf(`Extract the trigger condition from this request. Remove time, place, intervals, and actions. Focus on what to detect.
+// speculativeChat is a chat answer generated while the mode of the request is detected.
+// Most voice requests are chat, so their answer is ready sooner; for task requests it is
+// cancelled, which frees the Ollama call slot.
+type speculativeChat struct {
+	started  time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+	response string
+	err      error
+}
 
-User input: "%s"
+// startSpeculativeChat starts generating the chat answer, unless speculative chat is off or
+// Ollama serves one call at a time (the answer would only hold up mode detection)
+func startSpeculativeChat(c *config.Config, transcription string) *speculativeChat {
+	if !c.AI.SpeculativeChat || c.Backends.ConcurrencyFor("ollama") == 1 {
+		return nil
+	}
 
-CRITICAL: Respond with a simple phrase describing what to detect. No quotes. No punctuation at the end. Maximum 5 words.
-Example: "person enters room" or "cat on counter"`, transcription)
+	ctx, cancel := context.WithCancel(context.Background())
+	chat := &speculativeChat{started: time.Now(), cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(chat.done)
+		chat.response, chat.err = processChatMode(ctx, c, transcription)
+		if errors.Is(chat.err, context.Canceled) {
+			log.Println("Speculative chat answer cancelled: the request is a task")
+		}
+	}()
+	return chat
+}
 
-	trigger, err := callOllamaSimple(triggerPrompt)
-	if err != nil {
-		return "", fmt.Errorf("failed to extract trigger: %w", err)
-	}
-	trigger = cleanLLMResponse(trigger)
-	log.Printf("Extracted trigger condition: '%s'", trigger)
+// wait returns the chat answer once it is generated
+func (chat *speculativeChat) wait() (string, error) {
+	<-chat.done
+	chat.cancel()
+	return chat.response, chat.err
+}
+
+// taskPlan is a voice task worked out from a request but not yet stored
+type taskPlan struct {
+	transcription string
+	trigger       string
+	targetObject  string
+	modelType     int
+	headline      string
+	conditions    *database.TaskConditions // Count, disappearance and schedule (nil = none)
+}
 
-	// Step 2: Match to COCO object classes
-	cocoClasses := []string{
-		"person", "bicycle", "car", "motorcycle", "airplane", "bus", "train", "truck", "boat",
-		"traffic light", "fire hydrant", "stop sign", "parking meter", "bench",
-		"bird", "cat", "dog", "horse", "sheep", "cow", "elephant", "bear", "zebra", "giraffe",
-		"backpack", "umbrella", "handbag", "tie", "suitcase",
+// processTaskRequest handles a task request in a voice session. With confirmation enabled,
+// TASK requests, and TASK_AUTO requests that would replace the device's current task, are
+// stored as a draft and read back, and the session waits for a yes; other requests are
+// created right away. task is nil when the request was rejected and is only active once
+// created (the device then fetches it).
+func processTaskRequest(c *config.Config, transcription string, mode int, deviceEUI, sessionID string) (response string, task *models.TalkTask, err error) {
+	current := currentTask(deviceEUI)
+	if !c.Tasks.Confirm || (mode != 1 && current == nil) {
+		return processTaskMode(c, transcription, mode, deviceEUI)
 	}
 
-	matchPrompt := fmt.Sprintf(`You are the word matching assistant. Match the scenario to ONE keyword from the list.
+	plan, rejection, err := planTask(c, transcription)
+	if err != nil {
+		return "", nil, err
+	}
+	if plan == nil {
+		return rejection, nil, nil
+	}
 
-Scenario: "%s"
+	draft, err := saveDraftTask(plan, deviceEUI)
+	if err != nil {
+		return "", nil, err
+	}
+	setVoiceState(deviceEUI, sessionID, voiceConfirming, draft)
+	return taskReadBack(draft, current), talkTask(draft, current), nil
+}
 
-Target Keywords: %s
+// continueVoiceSession answers a reply to a task read-back: yes activates the draft, no
+// deletes it, and "test it" runs the draft once on the latest camera frame and asks again.
+// handled is false when the device is not waiting for a confirmation or the
+// reply is a new request, which then goes through the normal pipeline.
+func continueVoiceSession(deviceEUI, sessionID, transcription string) (mode int, response string, task *models.TalkTask, handled bool) {
+	session := voiceSessionFor(deviceEUI, sessionID)
+	if session.state != voiceConfirming {
+		return 0, "", nil, false
+	}
+	draft := session.pending
+
+	switch confirmationAnswer(transcription) {
+	case 1:
+		log.Printf("Task '%s' confirmed by %s", draft.Headline, deviceEUI)
+		setVoiceState(deviceEUI, sessionID, voiceExecuting, draft)
+		err := activateTask(draft)
+		setVoiceState(deviceEUI, sessionID, voiceListening, nil)
+		if err != nil {
+			log.Printf("ERROR: Failed to activate task %d: %v", draft.ID, err)
+			return 0, taskFailedText, nil, true
+		}
+		auditVoiceTask(deviceEUI, draft)
+		return 1, taskCreatedText(draft), talkTask(draft, nil), true
+	case -1:
+		log.Printf("Task '%s' declined by %s", draft.Headline, deviceEUI)
+		discardDraftTask(draft)
+		setVoiceState(deviceEUI, sessionID, voiceListening, nil)
+		return 0, taskCancelledText, nil, true
+	case 2:
+		log.Printf("Task '%s' verification requested by %s", draft.Headline, deviceEUI)
+		// Answering keeps the confirmation window open
+		setVoiceState(deviceEUI, sessionID, voiceConfirming, draft)
+		frame, _ := latestFrame(deviceEUI)
+		v, err := verifyDraftTask(deviceEUI, draft, frame)
+		if err != nil {
+			log.Printf("WARNING: Failed to verify task %d: %v", draft.ID, err)
+			reason := "image analysis is unavailable"
+			if errors.Is(err, errNoFrame) {
+				reason = "I haven't received a picture from the camera yet"
+			}
+			return 0, fmt.Sprintf(taskUntestedText, reason), talkTask(draft, currentTask(deviceEUI)), true
+		}
+		return 0, verificationText(v), talkTask(draft, currentTask(deviceEUI)), true
+	}
 
-CRITICAL: Respond with ONLY ONE WORD from the list above. No explanation. No quotes. No punctuation.
-If the scenario mentions a human/man/woman/person, respond with: person
-Otherwise pick the most relevant keyword from the list.`, trigger, strings.Join(cocoClasses, ", "))
+	log.Printf("No answer to the task read-back from %s, treating '%s' as a new request", deviceEUI, transcription)
+	discardDraftTask(draft)
+	setVoiceState(deviceEUI, sessionID, voiceListening, nil)
+	return 0, "", nil, false
+}
 
-	targetObject, err := callOllamaSimple(matchPrompt)
+// processTaskMode handles task automation requests.
+// task is nil when the task was rejected and the response explains why.
+func processTaskMode(c *config.Config, transcription string, mode int, deviceEUI string) (response string, task *models.TalkTask, err error) {
+	plan, rejection, err := planTask(c, transcription)
 	if err != nil {
-		log.Printf("WARNING: Object matching failed: %v", err)
-		targetObject = "person" // Default
+		return "", nil, err
+	}
+	if plan == nil {
+		return rejection, nil, nil
 	}
-	targetObject = cleanLLMResponse(targetObject)
-	targetObject = strings.TrimSpace(strings.ToLower(targetObject))
-	log.Printf("Matched target object: '%s'", targetObject)
+	response, task = createTask(plan, deviceEUI)
+	return response, task, nil
+}
 
-	// Step 3: Determine which local model to use
-	modelSelectionPrompt := fmt.Sprintf(`Target object: "%s"
+// planTask works out the trigger, target object, model, and headline of a task request.
+// A nil plan means the task was rejected and rejection explains why.
+func planTask(c *config.Config, transcription string) (plan *taskPlan, rejection string, err error) {
+	// Step 1: Extract trigger condition
+	triggerPrompt := fmt.Sprintf(c.Prompts.Trigger, transcription)
 
-The device has 3 built-in TinyML models:
-- Model 1: Person detection (person, human, people, man, woman)
-- Model 2: Pet detection (dog, cat, puppy, kitten, pet)
-- Model 3: Gesture detection (rock, paper, scissors, hand gesture)
+	trigger, err := callOllamaSimple(c, triggerPrompt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to extract trigger: %w", err)
+	}
+	trigger = cleanLLMResponse(trigger)
+	log.Printf("Extracted trigger condition: '%s'", trigger)
 
-CRITICAL: Which model should be used? Respond with ONLY ONE NUMBER: 1, 2, 3, or 0
-- 1 if person/human related
-- 2 if dog/cat/pet related
-- 3 if rock/paper/scissors gesture
-- 0 if none match (will require cloud model download)
+	// Step 2: Match to the known object classes (configured and custom)
+	// The synonym dictionary handles unambiguous triggers ("a delivery driver" -> person);
+	// otherwise the LLM picks a class and its answer is normalized with fuzzy matching
+	targetObject, ok := findClassInText(trigger)
+	if ok {
+		log.Printf("Matched target object from dictionary: '%s'", targetObject)
+	} else {
+		matchPrompt := fmt.Sprintf(c.Prompts.WordMatch, trigger, strings.Join(currentClasses().names, ", "))
 
-Respond with ONLY the number. No explanation.`, targetObject)
+		answer, err := callOllamaSimple(c, matchPrompt)
+		if err != nil {
+			log.Printf("WARNING: Object matching failed: %v", err)
+			answer = "person" // Default
+		}
+		answer = cleanLLMResponse(answer)
+		answer = strings.TrimSpace(strings.ToLower(answer))
+
+		targetObject = answer
+		if class, ok := matchClass(answer); ok {
+			targetObject = class
+		} else {
+			log.Printf("WARNING: LLM object '%s' does not match a known class", answer)
+		}
+		log.Printf("Matched target object: '%s' (LLM answer: '%s')", targetObject, answer)
+	}
 
-	modelTypeStr, err := callOllamaSimple(modelSelectionPrompt)
-	if err != nil {
-		log.Printf("WARNING: Model selection failed, defaulting to person model: %v", err)
-		modelTypeStr = "1" // Default to person model
+	// Objects outside the built-in models need a cloud model; without one, say so
+	// and suggest something the device can detect rather than create a task that never fires
+	if !c.AI.CloudModels && selectModelType(targetObject) == ModelTypeCloud && customModel(targetObject) == nil {
+		alternative := nearestLocalObject(targetObject)
+		log.Printf("Rejecting task: '%s' needs a cloud model and cloud models are disabled (suggested '%s')", targetObject, alternative)
+		return nil, fmt.Sprintf("Sorry, I can't watch for %s. This device can only recognize people, cats, dogs and hand gestures, and no cloud model is set up. "+
+			"I could watch for a %s instead. Just ask again with that.", targetObject, alternative), nil
 	}
-	modelTypeStr = cleanLLMResponse(modelTypeStr)
 
-	// Parse model type
+	// Step 3: Determine which local model to use (custom classes name their own)
 	modelType := 1 // Default to person model
-	if strings.Contains(modelTypeStr, "2") {
-		modelType = 2 // Pet model
-	} else if strings.Contains(modelTypeStr, "3") {
-		modelType = 3 // Gesture model
-	} else if strings.Contains(modelTypeStr, "0") {
-		modelType = 0 // Cloud model
+	if custom, ok := currentClasses().custom[targetObject]; ok {
+		modelType = custom.ModelType
+	} else {
+		modelSelectionPrompt := fmt.Sprintf(c.Prompts.ModelSelection, targetObject)
+
+		modelTypeStr, err := callOllamaSimple(c, modelSelectionPrompt)
+		if err != nil {
+			log.Printf("WARNING: Model selection failed, defaulting to person model: %v", err)
+			modelTypeStr = "1" // Default to person model
+		}
+		modelTypeStr = cleanLLMResponse(modelTypeStr)
+
+		// Parse model type
+		if strings.Contains(modelTypeStr, "2") {
+			modelType = 2 // Pet model
+		} else if strings.Contains(modelTypeStr, "3") {
+			modelType = 3 // Gesture model
+		} else if strings.Contains(modelTypeStr, "0") {
+			modelType = 0 // Cloud model
+		}
 	}
 	log.Printf("Selected model type: %d", modelType)
 
 	// Step 4: Generate headline
-	headlinePrompt := fmt.Sprintf(`Create a short headline summarizing this task.
-
-User input: "%s"
+	headlinePrompt := fmt.Sprintf(c.Prompts.Headline, transcription)
 
-CRITICAL: Respond with a short headline. Maximum 6 words. No quotes. No punctuation at the end.
-Example: "Watch for delivery person" or "Monitor front door activity"`, transcription)
-
-	headline, err := callOllamaSimple(headlinePrompt)
+	headline, err := callOllamaSimple(c, headlinePrompt)
 	if err != nil {
 		headline = "Task created" // Fallback
 	}
@@ -416,38 +701,141 @@ Example: "Watch for delivery person" or "Monitor front door activity"`, transcri
 	headline = strings.TrimSpace(headline)
 	log.Printf("Generated headline: '%s'", headline)
 
-	// Step 4: Delete old tasks and store new task in database
-	// Device only supports one task at a time
-	oldTasks, err := database.GetTaskFlowsByDevice(deviceEUI)
-	if err == nil && len(oldTasks) > 0 {
-		for _, oldTask := range oldTasks {
-			if err := database.DeleteTaskFlow(oldTask.ID); err != nil {
-				log.Printf("WARNING: Failed to delete old task %d: %v", oldTask.ID, err)
-			} else {
-				log.Printf("Deleted old task: ID=%d, Headline='%s'", oldTask.ID, oldTask.Headline)
-			}
-		}
+	// Step 5: Counts, disappearance, active hours and interval, which the trigger leaves out
+	conditions := parseTaskConditions(transcription)
+	if conditions != nil {
+		log.Printf("Parsed task conditions: %s", describeConditions(conditions))
+	}
+
+	return &taskPlan{
+		transcription: transcription,
+		trigger:       trigger,
+		targetObject:  targetObject,
+		modelType:     modelType,
+		headline:      headline,
+		conditions:    conditions,
+	}, "", nil
+}
+
+// createTask stores a planned task as the device's only task and returns the confirmation message
+func createTask(plan *taskPlan, deviceEUI string) (string, *models.TalkTask) {
+	// Stored as a draft first so activation replaces the old tasks in one transaction
+	taskFlow, err := saveDraftTask(plan, deviceEUI)
+	if taskFlow == nil {
+		log.Printf("WARNING: Not creating the task: %v", err)
+		return "Sorry, I couldn't set up a task the device can run for that. Please try asking in a different way.", nil
+	}
+	if err == nil {
+		err = activateTask(taskFlow)
+	}
+	if err == nil {
+		auditVoiceTask(deviceEUI, taskFlow)
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to save task flow to database: %v", err)
+		// Continue anyway - return success to user
+		taskFlow.Draft = false
+	}
+
+	// Return confirmation message
+	return taskCreatedText(taskFlow), talkTask(taskFlow, nil)
+}
+
+// saveDraftTask stores a planned task as a draft, which the device does not see until it is
+// activated. Earlier drafts of the device are dropped; only the latest can be confirmed. The
+// task is nil if its task flow does not validate.
+func saveDraftTask(plan *taskPlan, deviceEUI string) (*database.TaskFlow, error) {
+	if err := database.DeleteDraftTaskFlows(deviceEUI); err != nil {
+		log.Printf("WARNING: %v", err)
 	}
 
 	taskFlow := &database.TaskFlow{
 		DeviceEUI:        deviceEUI,
-		Name:             transcription, // Full original request
-		Headline:         headline,
-		TriggerCondition: trigger,
-		TargetObjects:    []string{targetObject},
+		Name:             plan.transcription, // Full original request
+		Headline:         plan.headline,
+		TriggerCondition: plan.trigger,
+		TargetObjects:    []string{plan.targetObject},
 		Actions:          []string{"notify"}, // Default action
-		ModelType:        modelType,          // LLM-selected model type
+		ModelType:        plan.modelType,     // LLM-selected model type
+		ContextFrames:    getConfig().Tasks.ContextFrames,
+		CooldownSeconds:  int(getConfig().Tasks.Cooldown.Seconds()),
+		DedupSeconds:     int(getConfig().Tasks.Dedup.Seconds()),
+		Conditions:       plan.conditions,
+		Draft:            true,
+	}
+	// The new task replaces the current one, and keeps its alarm target, vision provider and
+	// sensitivity
+	if current := currentTask(deviceEUI); current != nil {
+		taskFlow.AlarmURL = current.AlarmURL
+		taskFlow.AlarmToken = current.AlarmToken
+		taskFlow.AlarmSilenceSeconds = current.AlarmSilenceSeconds
+		taskFlow.VisionProvider = current.VisionProvider
+		taskFlow.Sensitivity = current.Sensitivity
+	}
+	// Never store a task the device's task engine would choke on
+	if _, err := convertToNodeREDFormat(taskFlow); err != nil {
+		return nil, err
 	}
-
 	if err := database.SaveTaskFlow(taskFlow); err != nil {
-		log.Printf("WARNING: Failed to save task flow to database: %v", err)
-		// Continue anyway - return success to user
-	} else {
-		log.Printf("Task flow saved to database: ID=%d", taskFlow.ID)
+		return taskFlow, err
 	}
+	return taskFlow, nil
+}
 
-	// Return confirmation message
-	return fmt.Sprintf("I've created a monitoring task: %s. I'll watch for %s.", headline, trigger), nil
+// activateTask makes a draft the device's only task (the device only supports one task at a time)
+func activateTask(draft *database.TaskFlow) error {
+	if err := database.ActivateTaskFlow(draft.ID); err != nil {
+		return err
+	}
+	draft.Draft = false
+	log.Printf("Task flow saved to database: ID=%d", draft.ID)
+	return nil
+}
+
+// auditVoiceTask records a task set up by voice in the audit log, as the device spoken to
+func auditVoiceTask(deviceEUI string, task *database.TaskFlow) {
+	audit.Record(&database.AuditEntry{
+		Source: database.AuditSourceVoice,
+		Actor:  deviceEUI,
+		Action: "task activate",
+		Target: fmt.Sprintf("task %d", task.ID),
+		Detail: task.Headline,
+	})
+}
+
+// discardDraftTask deletes a draft the user declined or moved on from
+func discardDraftTask(draft *database.TaskFlow) {
+	if err := database.DeleteTaskFlow(draft.ID); err != nil {
+		log.Printf("WARNING: Failed to delete draft task %d: %v", draft.ID, err)
+	}
+}
+
+// currentTask returns the device's newest confirmed task (paused or not), which a new task replaces
+func currentTask(deviceEUI string) *database.TaskFlow {
+	taskFlows, err := database.GetTaskFlowsByDevice(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: Failed to load task flows of %s: %v", deviceEUI, err)
+		return nil
+	}
+	for _, tf := range taskFlows {
+		if !tf.Draft {
+			return tf
+		}
+	}
+	return nil
+}
+
+// taskCreatedText tells the user a task was created
+func taskCreatedText(tf *database.TaskFlow) string {
+	return fmt.Sprintf("I've created a monitoring task: %s. I'll watch for %s.", tf.Headline, taskWatchText(tf))
+}
+
+// taskWatchText is what a task watches for: its trigger condition and its conditions in words
+func taskWatchText(tf *database.TaskFlow) string {
+	if conditions := describeConditions(tf.Conditions); conditions != "" {
+		return tf.TriggerCondition + " (" + conditions + ")"
+	}
+	return tf.TriggerCondition
 }
 
 // cleanLLMResponse removes quotes, extra whitespace, and trailing punctuation
@@ -468,9 +856,9 @@ func cleanLLMResponse(response string) string {
 }
 
 // callOllamaSimple is a helper to call Ollama with a simple prompt
-func callOllamaSimple(prompt string) (string, error) {
+func callOllamaSimple(c *config.Config, prompt string) (string, error) {
 	requestBody := map[string]interface{}{
-		"model":  cfg.AI.OllamaModel,
+		"model":  c.AI.OllamaModel,
 		"prompt": prompt,
 		"stream": false,
 	}
@@ -480,21 +868,19 @@ func callOllamaSimple(prompt string) (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := http.Post(cfg.AI.OllamaURL + "/api/generate", "application/json", bytes.NewReader(jsonData))
+	resp, err := ollamaBackend.post(c.AI.OllamaURL + "/api/generate", "application/json", jsonData)
 	if err != nil {
 		return "", fmt.Errorf("failed to call Ollama: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(resp.Body))
 	}
 
 	var result struct {
 		Response string `json:"response"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
@@ -505,7 +891,7 @@ func callOllamaSimple(prompt string) (string, error) {
 // DEPRECATED: Use processChatMode or processTaskMode instead
 func processWithOllama(text string) (string, error) {
 	requestBody := map[string]interface{}{
-		"model":  cfg.AI.OllamaModel,
+		"model":  getConfig().AI.OllamaModel,
 		"prompt": fmt.Sprintf("You are a helpful AI assistant. The user said: \"%s\"\n\nProvide a brief, conversational response (1-2 sentences max).", text),
 		"stream": false,
 	}
@@ -515,22 +901,20 @@ func processWithOllama(text string) (string, error) {
 		return "", fmt.Errorf("failed to marshal Ollama request: %w", err)
 	}
 
-	resp, err := http.Post(cfg.AI.OllamaURL + "/api/generate", "application/json", bytes.NewReader(jsonData))
+	resp, err := ollamaBackend.post(getConfig().AI.OllamaURL + "/api/generate", "application/json", jsonData)
 	if err != nil {
 		return "", fmt.Errorf("failed to call Ollama: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(resp.Body))
 	}
 
 	var result struct {
 		Response string `json:"response"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
 		return "", fmt.Errorf("failed to decode Ollama response: %w", err)
 	}
 
@@ -549,22 +933,36 @@ func synthesizeSpeech(text string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to marshal TTS request: %w", err)
 	}
 
-	piperURL := cfg.AI.PiperURL + "/synthesize"
-	resp, err := http.Post(piperURL, "application/json", bytes.NewReader(jsonData))
+	piperURL := getConfig().AI.PiperURL + "/synthesize"
+	resp, err := piperBackend.post(piperURL, "application/json", jsonData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call TTS service: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("TTS service returned %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("TTS service returned %d: %s", resp.StatusCode, string(resp.Body))
 	}
 
-	audioData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read TTS audio: %w", err)
+	if !getConfig().AI.ResampleReplies {
+		return resp.Body, nil
 	}
+	return deviceReplyAudio(resp.Body), nil
+}
 
-	return audioData, nil
+// deviceReplyAudio converts synthesized speech to the 16kHz mono 16-bit WAV the device
+// plays. Audio that cannot be converted is sent as is.
+func deviceReplyAudio(wav []byte) []byte {
+	if audio.Detect(wav) != audio.FormatWAV {
+		log.Printf("WARNING: TTS reply is not WAV (%s), sending it unconverted", audio.Detect(wav))
+		return wav
+	}
+	converted, _, err := audio.Normalize(wav, getConfig().AI.FFmpegPath)
+	if err != nil {
+		log.Printf("WARNING: Failed to convert TTS reply to 16kHz mono: %v", err)
+		return wav
+	}
+	if len(converted) != len(wav) {
+		log.Printf("Converted TTS reply to 16kHz mono WAV (%d -> %d bytes)", len(wav), len(converted))
+	}
+	return converted
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// AuditLogHandler handles GET /api/audit?since=24h&source=api&actor=alice&limit=100
+// Lists who changed the server's configuration and tasks, newest first: management API
+// requests, server subcommands and tasks set up by voice.
+func AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	source := query.Get("source")
+	if source != "" && source != database.AuditSourceAPI && source != database.AuditSourceCLI && source != database.AuditSourceVoice {
+		writeError(w, r, http.StatusBadRequest, "source must be api, cli or voice")
+		return
+	}
+
+	limit := 100
+	if ls := query.Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := database.GetAuditLog(database.AuditFilter{
+		Since:  time.Now().Add(-window),
+		Source: source,
+		Actor:  query.Get("actor"),
+		Limit:  limit,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve audit log: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve audit log")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":   len(entries),
+			"entries": entries,
+		},
+	})
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+)
+
+// errBackendUnavailable is returned for a backend that is down: without calling it while its
+// circuit is open or its queue is full, and for a call that still failed after its retries
+// (connection error, timeout, 502/503/504), so callers fall back from the first failed call
+// instead of only once enough failures have opened the circuit
+var errBackendUnavailable = errors.New("backend unavailable")
+
+// backendClient is shared by all AI backend calls; timeouts are applied per attempt
+var backendClient = &http.Client{Transport: newBackendTransport()}
+
+// newBackendTransport keeps connections to the AI backends alive between calls. The default
+// transport keeps 2 idle connections per host, so bursts of calls (e.g. frames from several
+// devices to Ollama) opened a new connection for every call beyond the second.
+func newBackendTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 32
+	t.IdleConnTimeout = 90 * time.Second
+	t.ForceAttemptHTTP2 = true // Backends served over TLS (e.g. behind a reverse proxy) get HTTP/2
+	return t
+}
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"    // Calls go through
+	circuitOpen     = "open"      // Calls fail fast until the cooldown ends
+	circuitHalfOpen = "half-open" // One trial call is in flight
+)
+
+// aiBackend calls one AI service with per-attempt timeouts, retries with backoff,
+// and a circuit breaker that fails fast after repeated failures
+type aiBackend struct {
+	name string
+
+	mu        sync.Mutex
+	state     string
+	failures  int       // Consecutive failed calls
+	openUntil time.Time // End of the current cooldown
+
+	pool *queue.Pool // Bounds simultaneous calls and queued calls
+
+	authorize func(*http.Request) // Adds the backend's credentials to each request (nil = none)
+}
+
+var (
+	whisperBackend = &aiBackend{name: "whisper", state: circuitClosed, pool: queue.New("whisper")}
+	ollamaBackend  = &aiBackend{name: "ollama", state: circuitClosed, pool: queue.New("ollama")}
+	piperBackend   = &aiBackend{name: "piper", state: circuitClosed, pool: queue.New("piper")}
+
+	openaiBackend   = &aiBackend{name: "openai", state: circuitClosed, pool: queue.New("openai"), authorize: authorizeOpenAI}
+	detectorBackend = &aiBackend{name: "detector", state: circuitClosed, pool: queue.New("detector")}
+)
+
+// backendResponse is a fully read backend response
+type backendResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// post sends body to url and returns the response once it has been fully read.
+// Connection errors and 502/503/504 responses are retried; a call that still fails
+// counts towards opening the circuit and returns errBackendUnavailable. Other non-2xx
+// responses are returned as is.
+func (b *aiBackend) post(url, contentType string, body []byte) (*backendResponse, error) {
+	return b.postContext(context.Background(), url, contentType, body)
+}
+
+// postContext is post, given up when ctx is cancelled. A cancelled call returns ctx's error
+// and does not count as a failure of the backend.
+func (b *aiBackend) postContext(ctx context.Context, url, contentType string, body []byte) (*backendResponse, error) {
+	settings := getConfig().Backends
+
+	if !b.allow(settings.BreakerThreshold) {
+		return nil, fmt.Errorf("%s: %w", b.name, errBackendUnavailable)
+	}
+	release, err := b.acquire(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	backoff := settings.RetryBackoff
+	var resp *backendResponse
+	for attempt := 0; attempt <= settings.Retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("WARNING: %s call failed (%v), retrying in %s (%d/%d)", b.name, err, backoff, attempt, settings.Retries)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+			}
+			backoff *= 2
+		}
+		if ctx.Err() != nil {
+			b.cancelled()
+			return nil, ctx.Err()
+		}
+
+		resp, err = b.attempt(ctx, url, contentType, body, settings.Timeout)
+		if ctx.Err() != nil {
+			b.cancelled()
+			return nil, ctx.Err()
+		}
+		if err == nil && resp.StatusCode != http.StatusBadGateway &&
+			resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusGatewayTimeout {
+			b.record(true, settings)
+			return resp, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("returned %d", resp.StatusCode)
+		}
+		// A backend that timed out is busy or hung; retrying only adds to the device's wait
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+	}
+
+	b.record(false, settings)
+	return nil, fmt.Errorf("%s call failed: %w: %w", b.name, err, errBackendUnavailable)
+}
+
+// acquire waits in the backend's queue for a free call slot and returns the function that
+// frees it. A full queue or a wait longer than the queue timeout fails like an open circuit,
+// so devices get the same "busy" reply instead of piling up. A call that gets no slot never
+// reaches the backend, so it ends a half-open circuit's trial without counting as a failure.
+func (b *aiBackend) acquire(parent context.Context, settings config.BackendsConfig) (func(), error) {
+	ctx := parent
+	if settings.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.QueueTimeout)
+		defer cancel()
+	}
+
+	release, err := b.pool.Acquire(ctx, settings.ConcurrencyFor(b.name), settings.QueueSize)
+	if err != nil {
+		b.cancelled()
+	}
+	switch {
+	case errors.Is(err, queue.ErrFull):
+		log.Printf("WARNING: %s queue is full (%d waiting), rejecting call", b.name, settings.QueueSize)
+		return nil, fmt.Errorf("%s: %w: %w", b.name, err, errBackendUnavailable)
+	case parent.Err() != nil:
+		return nil, parent.Err()
+	case err != nil:
+		log.Printf("WARNING: %s call waited %s for a free slot, giving up", b.name, settings.QueueTimeout)
+		return nil, fmt.Errorf("%s: no free slot: %w", b.name, errBackendUnavailable)
+	}
+	return release, nil
+}
+
+// attempt makes a single request with the given timeout
+func (b *aiBackend) attempt(parent context.Context, url, contentType string, body []byte, timeout time.Duration) (*backendResponse, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { b.pool.GotConn(info.Reused) },
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if b.authorize != nil {
+		b.authorize(req)
+	}
+
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &backendResponse{StatusCode: resp.StatusCode, Body: data}, nil
+}
+
+// allow reports whether a call may go through. After the cooldown, one trial call is
+// let through (half-open); its outcome closes or reopens the circuit.
+func (b *aiBackend) allow(threshold int) bool {
+	if threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	}
+	return true
+}
+
+// cancelled ends a call given up by its caller or turned away by the queue. It tells the
+// circuit nothing about the backend, but a half-open circuit's trial call must not stay in
+// flight forever: the circuit reopens, and the next call after the cooldown is a new trial.
+func (b *aiBackend) cancelled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// record updates the circuit with the outcome of a call
+func (b *aiBackend) record(success bool, settings config.BackendsConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		if b.state != circuitClosed {
+			log.Printf("%s backend recovered, circuit closed", b.name)
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if settings.BreakerThreshold > 0 && (b.state == circuitHalfOpen || b.failures >= settings.BreakerThreshold) {
+		b.state = circuitOpen
+		b.openUntil = time.Now().Add(settings.BreakerCooldown)
+		log.Printf("ERROR: %s backend failed %d times in a row, failing fast for %s", b.name, b.failures, settings.BreakerCooldown)
+	}
+}
+
+// circuitState returns the breaker state for health reporting
+func (b *aiBackend) circuitState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
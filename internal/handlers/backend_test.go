@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+)
+
+func TestBreakerRecoversAfterTrialCallFindsQueueFull(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	settings := config.BackendsConfig{
+		Timeout:          time.Second,
+		BreakerThreshold: 1,
+		BreakerCooldown:  50 * time.Millisecond,
+		Concurrency:      1,
+		QueueSize:        1,
+	}
+	SetConfig(&config.Config{Backends: settings})
+	defer SetConfig(nil)
+	b := &aiBackend{name: "test", state: circuitClosed, pool: queue.New("test")}
+
+	// Fill the queue: one call holds the only slot and one waits for it
+	release, err := b.pool.Acquire(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, stopWaiting := context.WithCancel(context.Background())
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		if release, err := b.pool.Acquire(waitCtx, 1, 1); err == nil {
+			release()
+		}
+	}()
+	for b.pool.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Open the circuit; the trial call after the cooldown finds the queue full
+	b.record(false, settings)
+	time.Sleep(settings.BreakerCooldown)
+	if _, err := b.post(server.URL, "text/plain", nil); !errors.Is(err, errBackendUnavailable) {
+		t.Fatalf("trial call with a full queue: got %v, want errBackendUnavailable", err)
+	}
+	if state := b.circuitState(); state != circuitOpen {
+		t.Fatalf("after the rejected trial call: circuit %s, want %s", state, circuitOpen)
+	}
+
+	stopWaiting()
+	<-waited
+	release()
+
+	time.Sleep(settings.BreakerCooldown)
+	resp, err := b.post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("call after the queue drained: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("call after the queue drained: status %d", resp.StatusCode)
+	}
+	if state := b.circuitState(); state != circuitClosed {
+		t.Errorf("after a successful trial call: circuit %s, want %s", state, circuitClosed)
+	}
+}
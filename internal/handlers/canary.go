@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// channelStats summarizes the AI calls of one release channel for one kind of call
+type channelStats struct {
+	Requests          int     `json:"requests"`
+	AvgLatencyMs      int64   `json:"avg_latency_ms"`
+	P95LatencyMs      int64   `json:"p95_latency_ms"`
+	Detections        int     `json:"detections"`
+	FalsePositives    int     `json:"false_positives"`
+	FalsePositiveRate float64 `json:"false_positive_rate"` // False positives / detections
+}
+
+// recordInferenceMetric stores the latency (and detection outcome) of an AI call for canary comparison
+func recordInferenceMetric(c *config.Config, deviceEUI, kind, model string, latency time.Duration, detected bool) {
+	metric := &database.InferenceMetric{
+		DeviceEUI: deviceEUI,
+		Channel:   c.Channel(deviceEUI),
+		Kind:      kind,
+		Model:     model,
+		LatencyMs: latency.Milliseconds(),
+		Detected:  detected,
+	}
+	if err := database.SaveInferenceMetric(metric); err != nil {
+		log.Printf("WARNING: Failed to record inference metric: %v", err)
+	}
+}
+
+// CanaryHandler handles GET /api/canary?since=24h
+// Shows the canary devices and overrides, and compares latency and false-positive
+// metrics of the canary and stable channels over the given window.
+func CanaryHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	metrics, err := database.GetInferenceMetrics(time.Now().Add(-window), "", "", 0, 0)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve inference metrics: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve metrics")
+		return
+	}
+
+	canary := getConfig().Canary
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"devices": canary.Devices,
+			"overrides": map[string]interface{}{
+				"ollama_model": canary.OllamaModel,
+				"llava_model":  canary.LLaVAModel,
+				"prompts":      canary.Prompts,
+			},
+			"window":             window.String(),
+			config.ChannelStable: summarizeChannel(metrics, config.ChannelStable),
+			config.ChannelCanary: summarizeChannel(metrics, config.ChannelCanary),
+		},
+	})
+}
+
+// summarizeChannel computes per-kind statistics for one channel
+func summarizeChannel(metrics []*database.InferenceMetric, channel string) map[string]*channelStats {
+	latencies := make(map[string][]int64)
+	stats := make(map[string]*channelStats)
+
+	for _, m := range metrics {
+		if m.Channel != channel {
+			continue
+		}
+		s, ok := stats[m.Kind]
+		if !ok {
+			s = &channelStats{}
+			stats[m.Kind] = s
+		}
+		s.Requests++
+		if m.Detected {
+			s.Detections++
+		}
+		if m.FalsePositive {
+			s.FalsePositives++
+		}
+		latencies[m.Kind] = append(latencies[m.Kind], m.LatencyMs)
+	}
+
+	for kind, s := range stats {
+		values := latencies[kind]
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+		var total int64
+		for _, v := range values {
+			total += v
+		}
+		s.AvgLatencyMs = total / int64(len(values))
+		s.P95LatencyMs = values[(len(values)*95-1)/100]
+
+		if s.Detections > 0 {
+			s.FalsePositiveRate = float64(s.FalsePositives) / float64(s.Detections)
+		}
+	}
+	return stats
+}
+
+// InferencesHandler handles GET /api/inferences?device_eui=&channel=&since=24h&limit=100
+// Lists recorded AI calls so detections can be reviewed and marked as false positives.
+func InferencesHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	query := r.URL.Query()
+	metrics, err := database.GetInferenceMetrics(time.Now().Add(-window), query.Get("device_eui"), query.Get("channel"), auth.VisibleTo(r), limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve inference metrics: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve inferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":      len(metrics),
+			"inferences": metrics,
+		},
+	})
+}
+
+// InferenceFalsePositiveHandler handles POST /api/inferences/{id}/false-positive (mark)
+// and DELETE (unmark). Only detections can be marked.
+func InferenceFalsePositiveHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid inference id")
+		return
+	}
+
+	if err := database.SetInferenceFalsePositive(id, r.Method == http.MethodPost); err != nil {
+		writeError(w, r, http.StatusNotFound, "%v", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+// parseSince parses the ?since= duration (default 24h), writing a 400 response if invalid
+func parseSince(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		return 24 * time.Hour, true
+	}
+
+	window, err := time.ParseDuration(since)
+	if err != nil || window <= 0 {
+		writeError(w, r, http.StatusBadRequest, "since must be a positive duration, e.g. 24h")
+		return 0, false
+	}
+	return window, true
+}
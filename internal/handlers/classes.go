@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// classRegistry holds the classes voice tasks can target: the configured classes (AI.Classes)
+// followed by the custom classes stored in the database
+type classRegistry struct {
+	base   []string                         // The configured classes it was built from
+	names  []string                         // All classes, for the word matching prompt
+	lookup map[string]string                // Every class and synonym to its class
+	custom map[string]*database.CustomClass // Custom classes by name
+}
+
+// classes caches the registry; it is rebuilt when the custom classes change or a config
+// reload changes the configured classes
+var classes struct {
+	sync.Mutex
+	custom   []*database.CustomClass
+	registry *classRegistry
+}
+
+// LoadCustomClasses reads the custom classes from the database
+func LoadCustomClasses() error {
+	custom, err := database.GetCustomClasses()
+	if err != nil {
+		return err
+	}
+
+	classes.Lock()
+	defer classes.Unlock()
+	classes.custom = custom
+	classes.registry = nil
+	return nil
+}
+
+// currentClasses returns the registry for the current configuration
+func currentClasses() *classRegistry {
+	base := config.COCOClasses
+	if c := getConfig(); c != nil {
+		base = c.AI.Classes
+	}
+
+	classes.Lock()
+	defer classes.Unlock()
+	if classes.registry == nil || !slices.Equal(classes.registry.base, base) {
+		classes.registry = buildClassRegistry(base, classes.custom)
+	}
+	return classes.registry
+}
+
+func buildClassRegistry(base []string, custom []*database.CustomClass) *classRegistry {
+	r := &classRegistry{
+		base:   base,
+		names:  slices.Clone(base),
+		lookup: make(map[string]string),
+		custom: make(map[string]*database.CustomClass),
+	}
+
+	for _, class := range base {
+		r.lookup[class] = class
+	}
+	for class, words := range cocoSynonyms {
+		if !slices.Contains(base, class) {
+			continue
+		}
+		for _, word := range words {
+			r.lookup[word] = class
+		}
+	}
+
+	// Custom classes come last, so their synonyms win over the built-in ones
+	for _, c := range custom {
+		if !slices.Contains(r.names, c.Name) {
+			r.names = append(r.names, c.Name)
+		}
+		r.custom[c.Name] = c
+		r.lookup[c.Name] = c.Name
+		for _, word := range c.Synonyms {
+			r.lookup[word] = c.Name
+		}
+	}
+	return r
+}
+
+// customModel returns the custom class of a target object if the device detects it with a
+// custom model (nil for classes of the built-in and SenseCraft cloud models)
+func customModel(class string) *database.CustomClass {
+	c := currentClasses().custom[strings.ToLower(class)]
+	if c == nil || c.ModelType != ModelTypeCloud || c.ModelURL == "" {
+		return nil
+	}
+	return c
+}
+
+// customClassRequest is the body of PUT /api/classes/{name}
+type customClassRequest struct {
+	Synonyms      []string `json:"synonyms"`
+	ModelType     int      `json:"model_type"` // 1-3 = a built-in model, 0 = the custom model given by model_url
+	ModelID       string   `json:"model_id"`
+	ModelVersion  string   `json:"model_version"`
+	ModelURL      string   `json:"model_url"`
+	ModelSize     float64  `json:"model_size"` // In KB
+	ModelChecksum string   `json:"model_checksum"`
+}
+
+// ClassesHandler handles GET /api/classes: the configured classes and the custom classes
+func ClassesHandler(w http.ResponseWriter, r *http.Request) {
+	custom, err := database.GetCustomClasses()
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve custom classes: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve classes")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"configured": currentClasses().base,
+			"custom":     custom,
+		},
+	})
+}
+
+// ClassHandler handles PUT /api/classes/{name} (create or replace a custom class) and DELETE
+// A custom class, e.g. {"synonyms": ["hen", "rooster"], "model_url": "https://.../chicken.tflite"},
+// lets voice tasks target an object outside the configured classes, or detect a configured
+// class with another model.
+func ClassHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(strings.TrimSpace(mux.Vars(r)["name"]))
+
+	if r.Method == http.MethodDelete {
+		found, err := database.DeleteCustomClass(name)
+		if err != nil {
+			log.Printf("ERROR: Failed to delete custom class %s: %v", name, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to delete class")
+			return
+		}
+		if !found {
+			writeError(w, r, http.StatusNotFound, "class not found")
+			return
+		}
+		reloadCustomClasses()
+		log.Printf("Deleted custom class %s", name)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	if !validClassName(name) {
+		writeError(w, r, http.StatusBadRequest, "class names must be one to three words of letters and digits")
+		return
+	}
+
+	var req customClassRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	c := &database.CustomClass{
+		Name:          name,
+		Synonyms:      []string{},
+		ModelType:     req.ModelType,
+		ModelID:       req.ModelID,
+		ModelVersion:  req.ModelVersion,
+		ModelURL:      req.ModelURL,
+		ModelSize:     req.ModelSize,
+		ModelChecksum: req.ModelChecksum,
+	}
+	for _, word := range req.Synonyms {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" || word == name || slices.Contains(c.Synonyms, word) {
+			continue
+		}
+		if !validClassName(word) {
+			writeError(w, r, http.StatusBadRequest, "class names must be one to three words of letters and digits")
+			return
+		}
+		c.Synonyms = append(c.Synonyms, word)
+	}
+
+	switch c.ModelType {
+	case ModelTypePerson, ModelTypePet, ModelTypeGesture:
+		if c.ModelURL != "" {
+			writeError(w, r, http.StatusBadRequest, "model_url is only used with model_type 0")
+			return
+		}
+	case ModelTypeCloud:
+		if u, err := url.Parse(c.ModelURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, r, http.StatusBadRequest, "model_type 0 needs an http(s) model_url")
+			return
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, "model_type must be 0, 1, 2 or 3")
+		return
+	}
+
+	if err := database.SaveCustomClass(c); err != nil {
+		log.Printf("ERROR: Failed to save custom class %s: %v", name, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save class")
+		return
+	}
+	reloadCustomClasses()
+
+	log.Printf("Saved custom class %s (model type %d)", name, c.ModelType)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": c})
+}
+
+// reloadCustomClasses picks up a change of the custom classes
+func reloadCustomClasses() {
+	if err := LoadCustomClasses(); err != nil {
+		log.Printf("ERROR: Failed to reload custom classes: %v", err)
+	}
+}
+
+// validClassName reports whether a class name or synonym can be matched in transcriptions:
+// one to three lowercase words (findClassInText looks at phrases of up to three words)
+func validClassName(name string) bool {
+	words := tokenize(name)
+	return len(words) >= 1 && len(words) <= 3 && strings.Join(words, " ") == name
+}
@@ -1,11 +1,41 @@
 package handlers
 
-import "github.com/brianhealey/sensecap-server/internal/config"
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
 
-// Global configuration (will be set by main.go)
-var cfg *config.Config
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/storage"
+)
+
+// Global configuration (will be set by main.go, and swapped when the config file is reloaded)
+var cfg atomic.Pointer[config.Config]
 
 // SetConfig sets the global configuration for handlers
 func SetConfig(c *config.Config) {
-	cfg = c
+	cfg.Store(c)
+}
+
+// getConfig returns the current configuration
+func getConfig() *config.Config {
+	return cfg.Load()
+}
+
+// Global blob store for uploaded files (will be set by main.go)
+var blobStore storage.BlobStore
+
+// SetBlobStore sets the blob store used by handlers
+func SetBlobStore(s storage.BlobStore) {
+	blobStore = s
+}
+
+// readBodyStatus returns the HTTP status for a request body read error
+// (413 when the body limit middleware cut the body off, 400 otherwise)
+func readBodyStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
 }
@@ -1,14 +1,19 @@
 package handlers
 
-import "time"
+import (
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+)
 
 // Task Flow Module Types
 const (
-	TFModuleTypeAICamera        = "ai camera"
-	TFModuleTypeImageAnalyzer   = "image analyzer"
-	TFModuleTypeLocalAlarm      = "local alarm"
-	TFModuleTypeSenseCraftAlarm = "sensecraft alarm"
-	TFModuleTypeAlarmTrigger    = "alarm trigger"
+	TFModuleTypeAICamera        = models.ModuleAICamera
+	TFModuleTypeImageAnalyzer   = models.ModuleImageAnalyzer
+	TFModuleTypeLocalAlarm      = models.ModuleLocalAlarm
+	TFModuleTypeSenseCraftAlarm = models.ModuleSenseCraftAlarm
+	TFModuleTypeAlarmTrigger    = models.ModuleAlarmTrigger
 )
 
 // AI Camera Modes
@@ -18,12 +23,15 @@ const (
 
 // AI Camera Detection Modes
 const (
-	TFModuleAICameraModeAppear = 1 // Appear/disappear detection
+	TFModuleAICameraModeAppear    = 1 // Appear/disappear detection: the class count compared with num (by type)
+	TFModuleAICameraModeNumChange = 2 // The class count changes
 )
 
-// AI Camera Detection Types
+// AI Camera Detection Types (how the class count compares with num)
 const (
-	TFModuleAICameraTypePreset = 2 // Preset condition type
+	TFModuleAICameraTypeLess   = 0 // Fewer than num
+	TFModuleAICameraTypeEqual  = 1 // Exactly num (num 0: the class disappeared)
+	TFModuleAICameraTypePreset = 2 // More than num (num 0: the class appeared)
 )
 
 // AI Camera Output Types
@@ -35,6 +43,7 @@ const (
 // AI Camera Shutter Types
 const (
 	TFModuleAICameraShutterTriggerConstantly = 0 // Continuous triggering
+	TFModuleAICameraShutterTriggerUpEdge     = 1 // Trigger once when the condition becomes true
 )
 
 // AI Camera Conditions Combo
@@ -51,10 +60,10 @@ const (
 
 // Model Types for AI Camera
 const (
-	ModelTypeCloud   = 0 // Cloud model (requires download)
-	ModelTypePerson  = 1 // Built-in person detection model
-	ModelTypePet     = 2 // Built-in pet detection model (dog, cat)
-	ModelTypeGesture = 3 // Built-in gesture detection model (rock, paper, scissors)
+	ModelTypeCloud   = models.ModelCloud   // Cloud model (requires download)
+	ModelTypePerson  = models.ModelPerson  // Built-in person detection model
+	ModelTypePet     = models.ModelPet     // Built-in pet detection model (dog, cat)
+	ModelTypeGesture = models.ModelGesture // Built-in gesture detection model (rock, paper, scissors)
 )
 
 // Voice Interaction Modes
@@ -81,25 +90,10 @@ const (
 
 // Multipart Boundary
 const (
-	MultipartBoundary = "---sensecraftboundary---"
+	MultipartBoundary = talk.Boundary
 )
 
 // Audio Format
 const (
 	AudioFormatWAV = "wav"
 )
-
-// COCO Dataset Classes (80 classes supported by default models)
-var COCOClasses = []string{
-	"person", "bicycle", "car", "motorcycle", "airplane", "bus", "train", "truck", "boat",
-	"traffic light", "fire hydrant", "stop sign", "parking meter", "bench",
-	"bird", "cat", "dog", "horse", "sheep", "cow", "elephant", "bear", "zebra", "giraffe",
-	"backpack", "umbrella", "handbag", "tie", "suitcase", "frisbee", "skis", "snowboard",
-	"sports ball", "kite", "baseball bat", "baseball glove", "skateboard", "surfboard",
-	"tennis racket", "bottle", "wine glass", "cup", "fork", "knife", "spoon", "bowl",
-	"banana", "apple", "sandwich", "orange", "broccoli", "carrot", "hot dog", "pizza",
-	"donut", "cake", "chair", "couch", "potted plant", "bed", "dining table", "toilet",
-	"tv", "laptop", "mouse", "remote", "keyboard", "cell phone", "microwave", "oven",
-	"toaster", "sink", "refrigerator", "book", "clock", "vase", "scissors", "teddy bear",
-	"hair drier", "toothbrush",
-}
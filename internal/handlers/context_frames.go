@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// contextFrameWindow is how far from an alarm a frame may be and still count as its context
+const contextFrameWindow = 2 * time.Minute
+
+// bufferedFrame is a frame the device uploaded for image analysis
+type bufferedFrame struct {
+	jpeg []byte // With the device's privacy mode applied
+	at   time.Time
+}
+
+// deviceFrames holds a device's two most recent frames and the alarm event still waiting for
+// its "after" frame. The firmware cannot be asked to upload extra frames, so context frames
+// come from the frames the image analyzer module already sends to /v1/watcher/vision.
+type deviceFrames struct {
+	previous, last *bufferedFrame
+	pendingEvent   int // Event waiting for the next frame (0 = none)
+	pendingSince   time.Time
+	next           chan struct{} // Closed when the next frame arrives (nil = nobody waiting)
+}
+
+var (
+	contextFramesMu sync.Mutex
+	contextFrames   = make(map[string]*deviceFrames)
+)
+
+// recordContextFrame buffers a frame uploaded by a device and, if an alarm event is waiting
+// for the frame after its triggering frame, stores it with that event. The frame must not be
+// modified afterwards.
+func recordContextFrame(deviceEUI string, jpegData []byte) {
+	now := time.Now()
+
+	contextFramesMu.Lock()
+	frames := contextFrames[deviceEUI]
+	if frames == nil {
+		frames = &deviceFrames{}
+		contextFrames[deviceEUI] = frames
+	}
+	frames.previous, frames.last = frames.last, &bufferedFrame{jpeg: jpegData, at: now}
+	if frames.next != nil {
+		close(frames.next)
+		frames.next = nil
+	}
+
+	eventID := frames.pendingEvent
+	if eventID != 0 && now.Sub(frames.pendingSince) > contextFrameWindow {
+		eventID = 0 // The scene has moved on; a late frame would mislead the reviewer
+	}
+	frames.pendingEvent = 0
+	contextFramesMu.Unlock()
+
+	if eventID != 0 {
+		saveContextFrame(eventID, database.FrameAfter, jpegData, now)
+	}
+}
+
+// attachContextFrames stores the frame before the triggering frame with an alarm event and
+// marks the event to receive the next frame, if the device's active task asked for context frames
+func attachContextFrames(deviceEUI string, active *database.TaskFlow, event *database.NotificationEvent) {
+	if event.Img == "" || active == nil || !active.ContextFrames {
+		return
+	}
+
+	now := time.Now()
+	var before *bufferedFrame
+
+	contextFramesMu.Lock()
+	frames := contextFrames[deviceEUI]
+	if frames == nil {
+		frames = &deviceFrames{}
+		contextFrames[deviceEUI] = frames
+	}
+	// The last frame is the one that triggered the alarm; the one before it is context
+	if frames.previous != nil && now.Sub(frames.previous.at) <= contextFrameWindow {
+		before = frames.previous
+	}
+	frames.pendingEvent = event.ID
+	frames.pendingSince = now
+	contextFramesMu.Unlock()
+
+	if before != nil {
+		saveContextFrame(event.ID, database.FrameBefore, before.jpeg, before.at)
+	}
+}
+
+// saveContextFrame stores one context frame of an event
+func saveContextFrame(eventID int, position string, jpegData []byte, at time.Time) {
+	img := base64.StdEncoding.EncodeToString(jpegData)
+	frame := &database.EventFrame{EventID: eventID, Position: position, Timestamp: at.UnixMilli(), Img: img}
+	if err := database.SaveEventFrame(frame); err != nil {
+		log.Printf("WARNING: Failed to save %s frame for event %d: %v", position, eventID, err)
+		return
+	}
+	log.Printf("Saved %s frame for event %d", position, eventID)
+}
+
+// TaskContextFramesHandler handles POST /api/tasks/{id}/context-frames (enable)
+// and DELETE (disable). Takes effect for the task's next alarm event.
+func TaskContextFramesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+
+	enabled := r.Method == http.MethodPost
+	found, err := database.SetTaskContextFrames(id, enabled)
+	if err != nil {
+		log.Printf("ERROR: Failed to update context frames of task %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{"id": id, "context_frames": enabled},
+	})
+}
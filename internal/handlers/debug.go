@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/capture"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+	"github.com/gorilla/mux"
+)
+
+// DebugCapturesHandler handles GET /api/debug/captures (list) and DELETE /api/debug/captures (clear)
+func DebugCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		capture.Clear()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	captures := capture.List()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"enabled":  capture.Enabled(),
+			"count":    len(captures),
+			"captures": captures,
+		},
+	})
+}
+
+// DebugCaptureDetailHandler handles GET /api/debug/captures/{id}[/request|/response]
+// The base route returns the full capture as JSON; the /request and /response
+// variants return the raw body bytes (e.g., the multipart audio reply) as sent on the wire.
+func DebugCaptureDetailHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid capture id")
+		return
+	}
+
+	c := capture.Get(id)
+	if c == nil {
+		writeError(w, r, http.StatusNotFound, "capture not found")
+		return
+	}
+
+	switch vars["part"] {
+	case "request":
+		w.Header().Set("Content-Type", c.RequestHeaders.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(c.RequestBody)
+	case "response":
+		w.Header().Set("Content-Type", c.ResponseHeaders.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(c.ResponseBody)
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": c})
+	}
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response in the request's language. message is the English
+// text, which is looked up in the locale bundle and then formatted with args.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string, args ...interface{}) {
+	writeJSON(w, status, map[string]interface{}{"code": status, "error": i18n.Sprintf(auth.Language(r), message, args...)})
+}
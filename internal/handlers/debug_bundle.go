@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/logbuf"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// DebugBundleHandler handles POST /api/admin/debug-bundle
+// Returns a zip to attach to bug reports: recent log lines, the configuration with secrets
+// redacted, database statistics, the unknown endpoint report and AI backend health. A part
+// that cannot be collected is listed in errors.txt instead of failing the whole bundle.
+func DebugBundleHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var failures []string
+
+	add := func(name string, collect func() (interface{}, error)) {
+		v, err := collect()
+		if err == nil {
+			err = writeZipJSON(zw, now, name, v)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	add("info.json", func() (interface{}, error) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		return map[string]interface{}{
+			"version":      version.String(),
+			"generated_at": now.UTC(),
+			"go_version":   runtime.Version(),
+			"os":           runtime.GOOS,
+			"arch":         runtime.GOARCH,
+			"goroutines":   runtime.NumGoroutine(),
+			"heap_bytes":   mem.HeapAlloc,
+			"sys_bytes":    mem.Sys,
+			"log_lines":    logbuf.Size(),
+		}, nil
+	})
+	add("config.json", func() (interface{}, error) {
+		return getConfig().Redacted(), nil
+	})
+	add("database.json", func() (interface{}, error) {
+		return database.GetStats()
+	})
+	add("unknown-endpoints.json", func() (interface{}, error) {
+		return database.GetUnknownEndpoints()
+	})
+	add("health.json", func() (interface{}, error) {
+		deps, healthy := checkDependencies(r.Context())
+		return map[string]interface{}{
+			"healthy":      healthy,
+			"dependencies": deps,
+			"workers":      supervisor.Status(),
+		}, nil
+	})
+
+	logs := strings.Join(logbuf.Lines(), "\n")
+	if logbuf.Size() == 0 {
+		logs = "Log buffer disabled (LOG_LINES=0)"
+	}
+	if err := writeZipFile(zw, now, "logs.txt", []byte(logs+"\n")); err != nil {
+		failures = append(failures, fmt.Sprintf("logs.txt: %v", err))
+	}
+
+	if len(failures) > 0 {
+		if err := writeZipFile(zw, now, "errors.txt", []byte(strings.Join(failures, "\n")+"\n")); err != nil {
+			log.Printf("ERROR: Failed to write debug bundle: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("ERROR: Failed to write debug bundle: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to build debug bundle")
+		return
+	}
+
+	log.Printf("Debug bundle generated (%d bytes, %d parts failed)", buf.Len(), len(failures))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="watcher-debug-%s.zip"`, now.UTC().Format("20060102-150405")))
+	w.Write(buf.Bytes())
+}
+
+func writeZipJSON(zw *zip.Writer, modified time.Time, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeZipFile(zw, modified, name, append(data, '\n'))
+}
+
+func writeZipFile(zw *zip.Writer, modified time.Time, name string, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
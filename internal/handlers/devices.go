@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// DevicesHandler handles GET /api/devices (list the registry) and POST /api/devices
+// (register a device): {"eui": "2CF7F1C0...", "name": "kitchen"}. In strict mode only
+// registered devices may call the device endpoints.
+func DevicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		devices, err := database.GetDevices(auth.VisibleTo(r))
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve devices: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve devices")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": devices})
+		return
+	}
+
+	var device database.Device
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	device.EUI = strings.TrimSpace(device.EUI)
+	if _, err := hex.DecodeString(device.EUI); err != nil || len(device.EUI) != 16 {
+		writeError(w, r, http.StatusBadRequest, "eui must be 16 hex characters")
+		return
+	}
+
+	if err := database.RegisterDevice(&device); err != nil {
+		log.Printf("ERROR: Failed to register device %s: %v", device.EUI, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to register device")
+		return
+	}
+
+	log.Printf("Registered device: %s", device.EUI)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": device})
+}
+
+// DeviceHandler handles DELETE /api/devices/{eui}, removing a device from the registry
+func DeviceHandler(w http.ResponseWriter, r *http.Request) {
+	eui := mux.Vars(r)["eui"]
+
+	removed, err := database.UnregisterDevice(eui)
+	if err != nil {
+		log.Printf("ERROR: Failed to unregister device %s: %v", eui, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to unregister device")
+		return
+	}
+	if !removed {
+		writeError(w, r, http.StatusNotFound, "device not registered")
+		return
+	}
+
+	log.Printf("Unregistered device: %s", eui)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
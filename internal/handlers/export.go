@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/nodered"
+)
+
+// exportBatch is the number of rows loaded from the database per page of an export
+const exportBatch = 1000
+
+// exportTime is the time format of CSV exports: RFC 3339 in UTC with milliseconds
+const exportTime = "2006-01-02T15:04:05.000Z07:00"
+
+// Export formats
+const (
+	exportCSV    = "csv"    // Header row, then one row per record
+	exportNDJSON = "ndjson" // One JSON object per line
+)
+
+// exportWriter streams the rows of an export in the requested format
+type exportWriter struct {
+	rc     *http.ResponseController
+	csv    *csv.Writer   // nil for NDJSON
+	json   *json.Encoder // nil for CSV
+	rows   int
+	failed bool
+}
+
+// exportFormat parses ?format= (csv by default), writing a 400 response and returning false if
+// it is invalid
+func exportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		return exportCSV, true
+	}
+	if format != exportCSV && format != exportNDJSON {
+		writeError(w, r, http.StatusBadRequest, "format must be csv or ndjson")
+		return "", false
+	}
+	return format, true
+}
+
+// startExport starts a download named after the export and its time range. In CSV, the
+// columns are written as the header row.
+func startExport(w http.ResponseWriter, format, name string, from, to time.Time, columns []string) *exportWriter {
+	filename := fmt.Sprintf("watcher-%s-%s-%s.%s", name, from.UTC().Format("20060102T1504"), to.UTC().Format("20060102T1504"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	e := &exportWriter{rc: http.NewResponseController(w)}
+	if format == exportCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		e.csv = csv.NewWriter(w)
+		e.csv.Write(columns)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		e.json = json.NewEncoder(w)
+		e.json.SetEscapeHTML(false)
+	}
+	return e
+}
+
+// write adds a row: record as a CSV row, or v as a JSON line. It returns false once writing
+// to the client has failed.
+func (e *exportWriter) write(record []string, v interface{}) bool {
+	if e.failed {
+		return false
+	}
+	var err error
+	if e.csv != nil {
+		err = e.csv.Write(record)
+	} else {
+		err = e.json.Encode(v)
+	}
+	if err != nil {
+		e.failed = true
+		return false
+	}
+	e.rows++
+	return true
+}
+
+// flush sends the rows written so far to the client, returning false if that failed
+func (e *exportWriter) flush() bool {
+	if e.csv != nil {
+		e.csv.Flush()
+		e.failed = e.failed || e.csv.Error() != nil
+	}
+	if !e.failed && e.rc.Flush() != nil {
+		e.failed = true
+	}
+	return !e.failed
+}
+
+// eventColumns are the CSV columns of an event export, the fields of the flat Node-RED event
+var eventColumns = []string{"id", "time", "event_type", "device_eui", "device_name", "text", "class", "score",
+	"classes", "objects", "tlid", "task_headline", "suppressed", "temperature", "humidity", "co2",
+	"image_url", "annotated_image_url"}
+
+// ExportEventsHandler handles GET /api/export/events?from=&to=&format=csv&event_type=&device_eui=
+// Streams the events stored between from and to (RFC 3339 times or Unix milliseconds, default:
+// the last 24 hours), oldest first, as CSV or NDJSON for offline analysis. Each event is the flat
+// object of the Node-RED feed; in CSV, classes are separated by semicolons and missing sensor
+// readings are empty.
+func ExportEventsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	q := database.EventFeedQuery{EventType: r.URL.Query().Get("event_type"), From: from, To: to, Limit: exportBatch}
+	if q.EventType != "" && !database.ValidEventType(q.EventType) {
+		writeError(w, r, http.StatusBadRequest, "event_type must be one of: %s", strings.Join(database.EventTypes, ", "))
+		return
+	}
+	if q.Devices, ok = deviceFilter(w, r); !ok {
+		return
+	}
+
+	// The first page is loaded before the download starts, so a failing query still gets an error response
+	events, err := database.GetEventFeed(q)
+	if err != nil {
+		log.Printf("ERROR: Failed to export events: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+	out := startExport(w, format, "events", from, to, eventColumns)
+	baseURL := getConfig().API.BaseURL
+	for {
+		for _, e := range nodered.Flatten(events, baseURL) {
+			out.write([]string{
+				strconv.Itoa(e.ID), e.Time.UTC().Format(exportTime), e.EventType, e.DeviceEUI, e.DeviceName, e.Text,
+				e.Class, strconv.FormatFloat(e.Score, 'f', -1, 64), strings.Join(e.Classes, ";"), strconv.Itoa(e.Objects),
+				strconv.Itoa(e.TLID), e.TaskHeadline, strconv.FormatBool(e.Suppressed),
+				optionalFloat(e.Temperature), optionalInt(e.Humidity), optionalInt(e.CO2),
+				e.ImageURL, e.AnnotatedImageURL,
+			}, e)
+		}
+		if !out.flush() || len(events) < exportBatch {
+			break
+		}
+
+		q.AfterID = events[len(events)-1].ID
+		if events, err = database.GetEventFeed(q); err != nil {
+			log.Printf("ERROR: Failed to export events: %v", err)
+			break
+		}
+	}
+	logExport(r, "events", out)
+}
+
+// sensorExportRow is a sensor reading as exported
+type sensorExportRow struct {
+	Time       time.Time `json:"time"`
+	Timestamp  int64     `json:"timestamp"` // Unix milliseconds
+	DeviceEUI  string    `json:"device_eui"`
+	DeviceName string    `json:"device_name"` // Registered name ("" if unregistered)
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+}
+
+// ExportSensorsHandler handles GET /api/export/sensors?from=&to=&format=csv&metric=&device_eui=
+// Streams the sensor readings taken between from and to (default: the last 24 hours) in time
+// order, one row per reading of one metric (time, timestamp, device_eui, device_name, metric,
+// value), as CSV or NDJSON.
+func ExportSensorsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	q := database.SensorReadingQuery{Metric: strings.ToLower(r.URL.Query().Get("metric")), From: from, To: to, Limit: exportBatch}
+	if q.Metric != "" && !slices.Contains(database.SensorMetrics, q.Metric) {
+		writeError(w, r, http.StatusBadRequest, "metric must be one of: %s", strings.Join(database.SensorMetrics, ", "))
+		return
+	}
+	if q.Devices, ok = deviceFilter(w, r); !ok {
+		return
+	}
+
+	readings, err := database.GetSensorReadings(q)
+	if err != nil {
+		log.Printf("ERROR: Failed to export sensor readings: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve sensor readings")
+		return
+	}
+	devices, err := database.GetDevices(0)
+	if err != nil {
+		log.Printf("WARNING: Failed to load device names for the export: %v", err)
+	}
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.EUI] = d.Name
+	}
+
+	out := startExport(w, format, "sensors", from, to, []string{"time", "timestamp", "device_eui", "device_name", "metric", "value"})
+	for {
+		for _, reading := range readings {
+			row := sensorExportRow{
+				Time:       time.UnixMilli(reading.Timestamp).UTC(),
+				Timestamp:  reading.Timestamp,
+				DeviceEUI:  reading.DeviceEUI,
+				DeviceName: names[reading.DeviceEUI],
+				Metric:     reading.Metric,
+				Value:      reading.Value,
+			}
+			out.write([]string{
+				row.Time.Format(exportTime), strconv.FormatInt(row.Timestamp, 10), row.DeviceEUI, row.DeviceName,
+				row.Metric, strconv.FormatFloat(row.Value, 'f', -1, 64),
+			}, row)
+		}
+		if !out.flush() || len(readings) < exportBatch {
+			break
+		}
+
+		q.After = readings[len(readings)-1]
+		if readings, err = database.GetSensorReadings(q); err != nil {
+			log.Printf("ERROR: Failed to export sensor readings: %v", err)
+			break
+		}
+	}
+	logExport(r, "sensor readings", out)
+}
+
+// logExport logs how an export ended
+func logExport(r *http.Request, what string, out *exportWriter) {
+	if out.failed {
+		log.Printf("Export of %s to %s ended after %d rows: client went away", what, r.RemoteAddr, out.rows)
+		return
+	}
+	log.Printf("Exported %d %s to %s", out.rows, what, r.RemoteAddr)
+}
+
+// optionalFloat formats a nullable number for CSV ("" for null)
+func optionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// optionalInt formats a nullable integer for CSV ("" for null)
+func optionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// Firmware components that can be updated over the air
+const (
+	FirmwareComponentESP32 = "esp32" // Main ESP32-S3 application firmware
+	FirmwareComponentHimax = "himax" // Himax WE2 AI camera firmware
+)
+
+// FirmwareComponents lists the valid firmware components
+var FirmwareComponents = []string{FirmwareComponentESP32, FirmwareComponentHimax}
+
+// FirmwareUpdate describes one component update offered to a device
+type FirmwareUpdate struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	MD5       string `json:"md5"`
+}
+
+// OTACheckHandler handles GET /v2/watcher/ota/check?esp32=<version>&himax=<version>
+// Compares the versions the device reports (the esp32softwareversion / himaxsoftwareversion
+// values from its device info) against its manifest and returns the updates to install.
+// The OTA endpoints are a protocol of this server, for custom firmware and gateways: the stock
+// firmware only updates from SenseCraft's cloud and never calls them.
+func OTACheckHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+
+	updates := []FirmwareUpdate{}
+	for _, component := range FirmwareComponents {
+		current := r.URL.Query().Get(component)
+
+		target, err := database.GetFirmwareTarget(deviceEUI, component)
+		if err != nil {
+			log.Printf("ERROR: Failed to look up firmware target: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to look up firmware")
+			return
+		}
+		if target == "" || target == current {
+			continue
+		}
+
+		image, err := database.GetFirmwareImage(component, target)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve firmware image: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to look up firmware")
+			return
+		}
+		if image == nil {
+			log.Printf("WARNING: Manifest pins %s %s but no such firmware image is uploaded", component, target)
+			continue
+		}
+
+		updates = append(updates, FirmwareUpdate{
+			Component: component,
+			Version:   image.Version,
+			URL:       fmt.Sprintf("%s/v2/watcher/ota/firmware/%s/%s", getConfig().API.BaseURL, component, image.Version),
+			Size:      image.Size,
+			SHA256:    image.SHA256,
+			MD5:       image.MD5,
+		})
+	}
+
+	log.Printf("OTA check from device %s (esp32=%q himax=%q): %d update(s) available",
+		deviceEUI, r.URL.Query().Get(FirmwareComponentESP32), r.URL.Query().Get(FirmwareComponentHimax), len(updates))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"updates": updates,
+		},
+	})
+}
+
+// OTADownloadHandler handles GET /v2/watcher/ota/firmware/{component}/{version}
+// Serves the firmware binary with Range support so interrupted downloads can resume.
+func OTADownloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	image, data, ok := loadFirmwareImage(w, r, vars["component"], vars["version"])
+	if !ok {
+		return
+	}
+
+	log.Printf("Serving firmware %s %s (%d bytes) to device %s",
+		image.Component, image.Version, image.Size, r.Header.Get("API-OBITER-DEVICE-EUI"))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+image.SHA256+`"`)
+	http.ServeContent(w, r, "", image.CreatedAt, bytes.NewReader(data))
+}
+
+// loadFirmwareImage fetches a firmware record and its binary, writing an error response on failure
+func loadFirmwareImage(w http.ResponseWriter, r *http.Request, component, version string) (*database.FirmwareImage, []byte, bool) {
+	image, err := database.GetFirmwareImage(component, version)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve firmware")
+		return nil, nil, false
+	}
+	if image == nil {
+		writeError(w, r, http.StatusNotFound, "firmware not found")
+		return nil, nil, false
+	}
+
+	data, err := blobStore.Get(r.Context(), image.BlobKey)
+	if err != nil {
+		log.Printf("ERROR: Failed to read firmware binary %s: %v", image.BlobKey, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, r, status, "firmware binary unavailable")
+		return nil, nil, false
+	}
+	return image, data, true
+}
+
+// FirmwareListHandler handles GET /api/firmware
+func FirmwareListHandler(w http.ResponseWriter, r *http.Request) {
+	images, err := database.GetFirmwareImages()
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware images: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve firmware images")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":  len(images),
+			"images": images,
+		},
+	})
+}
+
+// FirmwareUploadHandler handles POST /api/firmware/{component}/{version}?notes=...
+// The request body is the raw firmware binary.
+func FirmwareUploadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	component, version := vars["component"], vars["version"]
+
+	existing, err := database.GetFirmwareImage(component, version)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to check existing firmware")
+		return
+	}
+	if existing != nil {
+		writeError(w, r, http.StatusConflict, "firmware version already uploaded")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("ERROR: Failed to read firmware upload: %v", err)
+		status := readBodyStatus(err)
+		writeError(w, r, status, "failed to read firmware binary")
+		return
+	}
+	defer r.Body.Close()
+
+	if len(data) == 0 {
+		writeError(w, r, http.StatusBadRequest, "firmware binary is empty")
+		return
+	}
+
+	sha := sha256.Sum256(data)
+	sum := md5.Sum(data)
+	image := &database.FirmwareImage{
+		Component: component,
+		Version:   version,
+		BlobKey:   fmt.Sprintf("firmware/%s/%s.bin", component, version),
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sha[:]),
+		MD5:       hex.EncodeToString(sum[:]),
+		Notes:     r.URL.Query().Get("notes"),
+	}
+
+	if err := blobStore.Put(r.Context(), image.BlobKey, data, "application/octet-stream"); err != nil {
+		log.Printf("ERROR: Failed to store firmware binary: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to store firmware binary")
+		return
+	}
+
+	if err := database.SaveFirmwareImage(image); err != nil {
+		log.Printf("ERROR: Failed to save firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save firmware image")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"code": 201, "data": image})
+}
+
+// FirmwareDeleteHandler handles DELETE /api/firmware/{component}/{version}
+// Versions still pinned by a manifest entry cannot be deleted.
+func FirmwareDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	component, version := vars["component"], vars["version"]
+
+	image, err := database.GetFirmwareImage(component, version)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve firmware")
+		return
+	}
+	if image == nil {
+		writeError(w, r, http.StatusNotFound, "firmware not found")
+		return
+	}
+
+	inUse, err := database.CountFirmwareManifestsForVersion(component, version)
+	if err != nil {
+		log.Printf("ERROR: Failed to check firmware manifests: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to check firmware manifests")
+		return
+	}
+	if inUse > 0 {
+		writeError(w, r, http.StatusConflict, "firmware is pinned by %d manifest entries", inUse)
+		return
+	}
+
+	if err := database.DeleteFirmwareImage(image.ID); err != nil {
+		log.Printf("ERROR: Failed to delete firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to delete firmware")
+		return
+	}
+	if err := blobStore.Delete(r.Context(), image.BlobKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("WARNING: Failed to delete firmware binary %s: %v", image.BlobKey, err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+// firmwareManifestRequest is the body of PUT /api/firmware/manifest
+type firmwareManifestRequest struct {
+	DeviceEUI string `json:"device_eui"` // Empty for the fleet-wide default
+	Component string `json:"component"`
+	Version   string `json:"version"`
+}
+
+// FirmwareManifestHandler handles GET (list), PUT (set) and DELETE (?device_eui=&component=)
+// on /api/firmware/manifest. Device entries override the fleet default for that device.
+func FirmwareManifestHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		setFirmwareManifest(w, r)
+		return
+	case http.MethodDelete:
+		component := r.URL.Query().Get("component")
+		if !isFirmwareComponent(component) {
+			writeError(w, r, http.StatusBadRequest, "unknown firmware component")
+			return
+		}
+		if err := database.DeleteFirmwareManifest(r.URL.Query().Get("device_eui"), component); err != nil {
+			writeError(w, r, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	manifests, err := database.GetFirmwareManifests()
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware manifests: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve firmware manifests")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":     len(manifests),
+			"manifests": manifests,
+		},
+	})
+}
+
+func setFirmwareManifest(w http.ResponseWriter, r *http.Request) {
+	var req firmwareManifestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if !isFirmwareComponent(req.Component) {
+		writeError(w, r, http.StatusBadRequest, "unknown firmware component")
+		return
+	}
+
+	image, err := database.GetFirmwareImage(req.Component, req.Version)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve firmware image: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve firmware")
+		return
+	}
+	if image == nil {
+		writeError(w, r, http.StatusBadRequest, "firmware version has not been uploaded")
+		return
+	}
+
+	if err := database.SetFirmwareManifest(req.DeviceEUI, req.Component, req.Version); err != nil {
+		log.Printf("ERROR: Failed to set firmware manifest: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to set firmware manifest")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+func isFirmwareComponent(component string) bool {
+	for _, c := range FirmwareComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// healthCheckTimeout bounds each dependency probe
+const healthCheckTimeout = 3 * time.Second
+
+// healthBackends maps dependency names to the AI backends whose circuit state is reported
+var healthBackends = map[string]*aiBackend{
+	"whisper":  whisperBackend,
+	"piper":    piperBackend,
+	"ollama":   ollamaBackend,
+	"openai":   openaiBackend,
+	"detector": detectorBackend,
+}
+
+// DependencyStatus is the result of probing one dependency
+type DependencyStatus struct {
+	Status    string       `json:"status"` // "ok" or "down"
+	LatencyMs int64        `json:"latency_ms"`
+	Error     string       `json:"error,omitempty"`
+	Circuit   string       `json:"circuit,omitempty"` // AI backends: "closed", "open" (failing fast) or "half-open"
+	Queue     *queue.Stats `json:"queue,omitempty"`   // AI backends: calls running and waiting for a slot, and connection reuse
+}
+
+// HealthHandler handles GET /health
+// Always returns 200 while the server is running (liveness), with per-dependency and
+// background worker status so operators can see when AI backends are unreachable or a
+// worker keeps failing.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	deps, healthy := checkDependencies(r.Context())
+
+	workers := supervisor.Status()
+	for _, worker := range workers {
+		if !worker.Healthy() {
+			healthy = false
+		}
+	}
+
+	status := "ok"
+	if !healthy {
+		status = "degraded"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       status,
+		"service":      "sensecap-local-server",
+		"version":      version.Version,
+		"commit":       version.Commit,
+		"build_date":   version.BuildDate,
+		"read_only":    database.ReadOnly(),
+		"dependencies": deps,
+		"workers":      workers,
+	})
+}
+
+// ReadyHandler handles GET /ready
+// Returns 503 unless every dependency is reachable, for orchestrator readiness probes.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	deps, healthy := checkDependencies(r.Context())
+
+	code := http.StatusOK
+	status := "ready"
+	if !healthy {
+		code = http.StatusServiceUnavailable
+		status = "not ready"
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status":       status,
+		"dependencies": deps,
+	})
+}
+
+// checkDependencies probes all dependencies concurrently
+func checkDependencies(ctx context.Context) (map[string]DependencyStatus, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	probes := map[string]func(context.Context) error{
+		"database": func(context.Context) error { return database.Ping() },
+		"whisper":  func(ctx context.Context) error { return probeHTTP(ctx, getConfig().AI.WhisperURL+"/health") },
+		"piper":    func(ctx context.Context) error { return probeHTTP(ctx, getConfig().AI.PiperURL+"/health") },
+		"ollama":   func(ctx context.Context) error { return probeHTTP(ctx, getConfig().AI.OllamaURL+"/api/tags") },
+	}
+	// The optional vision providers are probed once they are configured
+	if ai := getConfig().AI; ai.OpenAIKey != "" {
+		probes["openai"] = func(ctx context.Context) error {
+			return probeHTTP(ctx, strings.TrimSuffix(ai.OpenAIURL, "/")+"/models", authorizeOpenAI)
+		}
+	}
+	if ai := getConfig().AI; ai.DetectorURL != "" {
+		probes["detector"] = func(ctx context.Context) error {
+			return probeHTTP(ctx, strings.TrimSuffix(ai.DetectorURL, "/")+"/health")
+		}
+	}
+
+	results := make(map[string]DependencyStatus, len(probes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(context.Context) error) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := probe(ctx)
+			result := DependencyStatus{
+				Status:    "ok",
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+			if backend, ok := healthBackends[name]; ok {
+				result.Circuit = backend.circuitState()
+				// Report the configured limits even before the first call
+				settings := getConfig().Backends
+				stats := backend.pool.Stats()
+				stats.Limit, stats.MaxQueue = settings.ConcurrencyFor(name), settings.QueueSize
+				result.Queue = &stats
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, result := range results {
+		if result.Status != "ok" {
+			healthy = false
+		}
+	}
+	return results, healthy
+}
+
+// probeHTTP issues a GET and treats any 2xx response as healthy. It uses the AI backends'
+// client, so the probes keep their connections warm, and authorize adds credentials if any.
+func probeHTTP(ctx context.Context, url string, authorize ...func(*http.Request)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for _, auth := range authorize {
+		auth(req)
+	}
+
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/gorilla/mux"
+)
+
+// maxThumbnailWidth caps the ?w= resize parameter
+const maxThumbnailWidth = 1920
+
+// EventImageHandler handles GET /api/events/{id}/image, /api/events/{id}/image/{before|after}
+// and /api/events/{id}/image/annotated
+// Serves the stored JPEG (or the context frame before/after it, or a copy with the inference
+// boxes drawn on) with ETag/Last-Modified caching headers and honors conditional requests.
+// An optional ?w=320 query parameter resizes on the fly.
+func EventImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid event id")
+		return
+	}
+
+	width := 0
+	if ws := r.URL.Query().Get("w"); ws != "" {
+		width, err = strconv.Atoi(ws)
+		if err != nil || width <= 0 || width > maxThumbnailWidth {
+			writeError(w, r, http.StatusBadRequest, "w must be between 1 and %d", maxThumbnailWidth)
+			return
+		}
+	}
+
+	event, err := database.GetNotificationEventByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve event %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve event")
+		return
+	}
+	if event == nil || event.Img == "" || !auth.CanSeeDevice(r, event.DeviceEUI) {
+		writeError(w, r, http.StatusNotFound, "image not found")
+		return
+	}
+
+	img, modified := event.Img, event.CreatedAt
+	if position := mux.Vars(r)["frame"]; position != "" {
+		frame, err := database.GetEventFrame(id, position)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve %s frame of event %d: %v", position, id, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve frame")
+			return
+		}
+		if frame == nil {
+			writeError(w, r, http.StatusNotFound, "frame not found")
+			return
+		}
+		img, modified = frame.Img, time.UnixMilli(frame.Timestamp)
+	}
+
+	data, err := imaging.DecodeBase64JPEG(img)
+	if err != nil {
+		log.Printf("ERROR: Failed to decode image for event %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "stored image is invalid")
+		return
+	}
+
+	var boxes []imaging.Box
+	annotated := mux.Vars(r)["variant"] == "annotated"
+	if annotated {
+		boxes = imaging.InferenceBoxes(event.InferenceData)
+	}
+
+	// ETag covers the stored bytes and the requested variant
+	etag := fmt.Sprintf(`"%x-w%d"`, sha1.Sum(data), width)
+	if annotated {
+		etag = fmt.Sprintf(`"%x-w%d-a%d"`, sha1.Sum(data), width, len(boxes))
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	// Answer conditional requests before doing any resize work
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Boxes are drawn at full size, so they shrink with the image
+	if len(boxes) > 0 {
+		data, err = imaging.AnnotateJPEG(data, boxes)
+		if err != nil {
+			log.Printf("ERROR: Failed to annotate image for event %d: %v", id, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to annotate image")
+			return
+		}
+	}
+
+	if width > 0 {
+		data, err = imaging.ResizeJPEG(data, width)
+		if err != nil {
+			log.Printf("ERROR: Failed to resize image for event %d: %v", id, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to resize image")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(data))
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/brianhealey/sensecap-server/internal/incidents"
+	"github.com/gorilla/mux"
+)
+
+// incidentTimelineEntry is an alarm of an incident as listed by the API, with its image URLs
+// relative to the API root (empty when the alarm has no image)
+type incidentTimelineEntry struct {
+	incidents.TimelineEntry
+	ImageURL          string `json:"image_url"`
+	AnnotatedImageURL string `json:"annotated_image_url,omitempty"`
+}
+
+// incidentView is an incident as the API returns it, with the URL of its representative image
+// relative to the API root (empty when none of its alarms has an image)
+type incidentView struct {
+	*database.Incident
+	ImageURL string `json:"image_url"`
+}
+
+func viewIncident(inc *database.Incident) incidentView {
+	view := incidentView{Incident: inc}
+	if inc.ImageEventID != 0 {
+		view.ImageURL = fmt.Sprintf("events/%d/image", inc.ImageEventID)
+	}
+	return view
+}
+
+// NarrateIncident has the LLM write up an incident from its timeline with the incident prompt.
+// It is the narrator the server passes to the incidents package.
+func NarrateIncident(timeline string) (string, error) {
+	c := getConfig()
+	return callOllamaSimple(c, fmt.Sprintf(c.Prompts.Incident, timeline))
+}
+
+// canSeeIncident reports whether the user can see every device of an incident: its narrative
+// covers them all
+func canSeeIncident(r *http.Request, inc *database.Incident) bool {
+	for _, eui := range inc.Devices {
+		if !auth.CanSeeDevice(r, eui) {
+			return false
+		}
+	}
+	return true
+}
+
+// visibleIncident loads the incident of a /api/incidents/{id} request, writing the error
+// response and returning nil if it does not exist or the user cannot see it
+func visibleIncident(w http.ResponseWriter, r *http.Request) *database.Incident {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid incident ID")
+		return nil
+	}
+
+	inc, err := database.GetIncidentByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve incident %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve incidents")
+		return nil
+	}
+	if inc == nil || !canSeeIncident(r, inc) {
+		writeError(w, r, http.StatusNotFound, "incident not found")
+		return nil
+	}
+	return inc
+}
+
+// IncidentsHandler handles GET /api/incidents?since=24h&limit=50&kind=burst
+// Lists incidents (alarms from several devices close together in time, or bursts of alarms
+// from one device), newest first.
+func IncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != database.IncidentDevices && kind != database.IncidentBurst {
+		writeError(w, r, http.StatusBadRequest, "kind must be devices or burst")
+		return
+	}
+
+	limit := 50
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	all, err := database.GetIncidents(kind, time.Now().Add(-window), limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve incidents: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve incidents")
+		return
+	}
+
+	list := make([]incidentView, 0, len(all))
+	for _, inc := range all {
+		if canSeeIncident(r, inc) {
+			list = append(list, viewIncident(inc))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":     len(list),
+			"incidents": list,
+		},
+	})
+}
+
+// IncidentHandler handles GET /api/incidents/{id}
+// Returns an incident with the timeline of its alarms from all devices.
+func IncidentHandler(w http.ResponseWriter, r *http.Request) {
+	inc := visibleIncident(w, r)
+	if inc == nil {
+		return
+	}
+
+	events, err := database.GetIncidentEvents(inc.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve events of incident %d: %v", inc.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+
+	images := make(map[int]*database.NotificationEvent, len(events))
+	for _, e := range events {
+		images[e.ID] = e
+	}
+	timeline := []incidentTimelineEntry{}
+	for _, entry := range incidents.Timeline(events) {
+		view := incidentTimelineEntry{TimelineEntry: entry}
+		if e := images[entry.EventID]; e.Img != "" {
+			view.ImageURL = fmt.Sprintf("events/%d/image", e.ID)
+			if len(imaging.InferenceBoxes(e.InferenceData)) > 0 {
+				view.AnnotatedImageURL = view.ImageURL + "/annotated"
+			}
+		}
+		timeline = append(timeline, view)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"incident": viewIncident(inc),
+			"timeline": timeline,
+		},
+	})
+}
+
+// IncidentSummarizeHandler handles POST /api/incidents/{id}/summarize
+// Has the LLM write the incident up again, e.g. after the incident prompt was changed or when
+// the LLM was unavailable as the incident ended.
+func IncidentSummarizeHandler(w http.ResponseWriter, r *http.Request) {
+	inc := visibleIncident(w, r)
+	if inc == nil {
+		return
+	}
+	if inc.Status == database.IncidentOpen {
+		writeError(w, r, http.StatusConflict, "incident is still open")
+		return
+	}
+
+	summarized, err := incidents.Summarize(inc.ID, NarrateIncident)
+	if err != nil {
+		log.Printf("ERROR: Failed to summarize incident %d: %v", inc.ID, err)
+		status := http.StatusBadGateway
+		if errors.Is(err, errBackendUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, r, status, "failed to summarize incident")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": viewIncident(summarized)})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audio"
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/capture"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// voiceInteractionView is a voice interaction as listed by the API, with audio URLs
+// relative to the API root (empty when the audio was not stored)
+type voiceInteractionView struct {
+	*database.VoiceInteraction
+	InputAudioURL string `json:"input_audio_url"`
+	ReplyAudioURL string `json:"reply_audio_url"`
+}
+
+// recordVoiceInteraction stores the transcript, response, and audio of a voice exchange.
+// The synthesized reply is always kept; the uploaded audio only while debug capture is on.
+func recordVoiceInteraction(deviceEUI, sessionID string, input []byte, result *audioResult) {
+	interaction := &database.VoiceInteraction{
+		DeviceEUI:     deviceEUI,
+		SessionID:     sessionID,
+		Transcription: result.transcription,
+		Mode:          result.mode,
+		ResponseText:  result.text,
+		STTMs:         result.stages.stt.duration().Milliseconds(),
+		ModeMs:        result.stages.mode.duration().Milliseconds(),
+		LLMMs:         result.stages.llm.duration().Milliseconds(),
+		TTSMs:         result.stages.tts.duration().Milliseconds(),
+		WriteMs:       result.stages.write.duration().Milliseconds(),
+		TotalMs:       result.stages.total().Milliseconds(),
+	}
+	log.Printf("Voice interaction latency: STT %dms, mode detection %dms, LLM %dms, TTS %dms, response write %dms, total %dms",
+		interaction.STTMs, interaction.ModeMs, interaction.LLMMs, interaction.TTSMs, interaction.WriteMs, interaction.TotalMs)
+
+	prefix := fmt.Sprintf("interactions/%s/%s", deviceEUI, time.Now().Format("20060102-150405.000000"))
+	if capture.Enabled() && len(input) > 0 {
+		if audio.Detect(input) == audio.FormatWAV {
+			interaction.InputAudioKey = storeInteractionAudio(prefix+"-input.wav", input, "audio/wav")
+		} else {
+			interaction.InputAudioKey = storeInteractionAudio(prefix+"-input.pcm", input, "application/octet-stream")
+		}
+	}
+	if len(result.reply) > 0 {
+		interaction.ReplyAudioKey = storeInteractionAudio(prefix+"-reply.wav", result.reply, "audio/wav")
+	}
+
+	if err := database.SaveVoiceInteraction(interaction); err != nil {
+		log.Printf("WARNING: Failed to record voice interaction: %v", err)
+	}
+}
+
+// storeInteractionAudio writes audio to the blob store, returning its key (empty on failure)
+func storeInteractionAudio(key string, data []byte, contentType string) string {
+	if blobStore == nil {
+		return ""
+	}
+	if err := blobStore.Put(context.Background(), key, data, contentType); err != nil {
+		log.Printf("WARNING: Failed to store interaction audio %s: %v", key, err)
+		return ""
+	}
+	return key
+}
+
+// InteractionsHandler handles GET /api/interactions?device_eui=&session_id=&since=24h&limit=50
+// Lists recent voice interactions, newest first. Each has the transcription, the mode, the
+// response, and how long each pipeline stage took.
+func InteractionsHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	interactions, err := database.GetVoiceInteractions(time.Now().Add(-window), r.URL.Query().Get("device_eui"), r.URL.Query().Get("session_id"), auth.VisibleTo(r), limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve voice interactions: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve interactions")
+		return
+	}
+
+	views := make([]voiceInteractionView, 0, len(interactions))
+	for _, v := range interactions {
+		views = append(views, newVoiceInteractionView(v))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":        len(views),
+			"interactions": views,
+		},
+	})
+}
+
+// InteractionHandler handles GET /api/interactions/{id}
+func InteractionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid interaction id")
+		return
+	}
+
+	interaction, err := database.GetVoiceInteractionByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve voice interaction %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve interaction")
+		return
+	}
+	if interaction == nil || !auth.CanSeeDevice(r, interaction.DeviceEUI) {
+		writeError(w, r, http.StatusNotFound, "interaction not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": newVoiceInteractionView(interaction),
+	})
+}
+
+func newVoiceInteractionView(v *database.VoiceInteraction) voiceInteractionView {
+	view := voiceInteractionView{VoiceInteraction: v}
+	if v.InputAudioKey != "" {
+		view.InputAudioURL = fmt.Sprintf("interactions/%d/audio/input", v.ID)
+	}
+	if v.ReplyAudioKey != "" {
+		view.ReplyAudioURL = fmt.Sprintf("interactions/%d/audio/reply", v.ID)
+	}
+	return view
+}
+
+// InteractionAudioHandler handles GET /api/interactions/{id}/audio/{input|reply}
+// Serves the stored audio as WAV so browsers can play it.
+func InteractionAudioHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid interaction id")
+		return
+	}
+
+	interaction, err := database.GetVoiceInteractionByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve voice interaction %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve interaction")
+		return
+	}
+
+	key := ""
+	if interaction != nil && auth.CanSeeDevice(r, interaction.DeviceEUI) {
+		key = interaction.ReplyAudioKey
+		if vars["part"] == "input" {
+			key = interaction.InputAudioKey
+		}
+	}
+	if key == "" {
+		writeError(w, r, http.StatusNotFound, "audio not found")
+		return
+	}
+
+	data, err := blobStore.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("ERROR: Failed to read interaction audio %s: %v", key, err)
+		writeError(w, r, http.StatusNotFound, "audio not found")
+		return
+	}
+	// Uploads stored before they were normalized are kept as sent
+	if strings.HasSuffix(key, ".pcm") {
+		if wav, _, err := audio.Normalize(data, getConfig().AI.FFmpegPath); err == nil {
+			data = wav
+		} else {
+			log.Printf("WARNING: Failed to decode interaction audio %s: %v", key, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", interaction.CreatedAt, bytes.NewReader(data))
+}
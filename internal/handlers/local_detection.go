@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/detect"
+)
+
+// localDetectionState checks a MONITORING frame with the server's object detection model,
+// used when vision analysis is off. It returns 1 when the frame has a target object of the
+// device's active task (without one, an object the prompt names) with the confidence its
+// sensitivity asks for, and 0 otherwise, including when detection fails: the device's own
+// model already saw the target, so a missed check only costs that alarm.
+func localDetectionState(c *config.Config, deviceEUI, prompt string, jpegData []byte) int {
+	task, err := database.GetActiveTaskFlow(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: Failed to load the active task of %s, using the prompt's objects: %v", deviceEUI, err)
+	}
+	targets := detectionTargets(task, prompt)
+
+	start := time.Now()
+	detections, err := detect.Detect(jpegData)
+	if err != nil {
+		log.Printf("WARNING: Object detection failed, answering no event: %v", err)
+		return 0
+	}
+	duration := time.Since(start)
+
+	analysis := describeDetections(detections, targets)
+	state := 0
+	if taskMatch(detectorVision{}, task, analysis) {
+		state = 1
+	}
+	log.Printf("Object detection (%s, %s): %s", detect.Model(), duration.Round(time.Millisecond), analysis)
+	recordInferenceMetric(c, deviceEUI, "monitoring", detect.Model(), duration, state == 1)
+	return state
+}
+
+// detectionTargets returns the classes a device's frames are checked for: the target
+// objects of its active task (nil = none), or the classes named in the prompt
+func detectionTargets(task *database.TaskFlow, prompt string) []string {
+	var targets []string
+	if task != nil {
+		for _, object := range task.TargetObjects {
+			if class, ok := lookupClass(object); ok {
+				targets = append(targets, class)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		targets = classesInText(prompt)
+	}
+	return targets
+}
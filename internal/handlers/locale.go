@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+)
+
+// LocaleHandler handles GET /api/locale?lang=zh
+// Returns a language's message bundle (English text -> translation) and the supported
+// languages, so the dashboard can translate itself. Without a supported ?lang= the
+// language is picked from the Accept-Language header.
+func LocaleHandler(w http.ResponseWriter, r *http.Request) {
+	lang := r.URL.Query().Get("lang")
+	if !i18n.Supported(lang) {
+		lang = auth.Language(r)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"language":  lang,
+			"languages": i18n.Languages,
+			"messages":  i18n.Messages(lang),
+		},
+	})
+}
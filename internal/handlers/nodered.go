@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/nodered"
+)
+
+const (
+	maxNodeREDEvents   = 500              // Caps ?limit= of the event feed
+	nodeREDStreamBatch = 100              // Events loaded per pass of the event stream
+	nodeREDKeepAlive   = 15 * time.Second // Comment line sent on an idle stream so proxies keep it open
+)
+
+// nodeREDFeedQuery parses the filters shared by the Node-RED event feed and stream (the event
+// ID to start after, ?event_type= and ?device_eui=), writing the error response if one is
+// invalid. hasAfter reports whether after was given.
+func nodeREDFeedQuery(w http.ResponseWriter, r *http.Request, after string) (q database.EventFeedQuery, hasAfter, ok bool) {
+	query := r.URL.Query()
+
+	if after != "" {
+		n, err := strconv.Atoi(after)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "after must be an event ID")
+			return q, false, false
+		}
+		q.AfterID, hasAfter = n, true
+	}
+
+	q.EventType = query.Get("event_type")
+	if q.EventType != "" && !database.ValidEventType(q.EventType) {
+		writeError(w, r, http.StatusBadRequest, "event_type must be one of: %s", strings.Join(database.EventTypes, ", "))
+		return q, false, false
+	}
+
+	q.Devices, ok = deviceFilter(w, r)
+	return q, hasAfter, ok
+}
+
+// deviceFilter returns the devices a feed or export request selects: the one of ?device_eui=,
+// or for viewers the devices assigned to them (nil = all devices). It writes a 403 response and
+// returns false if the user cannot see ?device_eui=.
+func deviceFilter(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if eui := r.URL.Query().Get("device_eui"); eui != "" {
+		if !auth.CanSeeDevice(r, eui) {
+			writeError(w, r, http.StatusForbidden, "device not assigned to this account")
+			return nil, false
+		}
+		return []string{eui}, true
+	}
+	if auth.VisibleTo(r) != 0 {
+		if devices := auth.UserFrom(r).Devices; devices != nil {
+			return devices, true
+		}
+		return []string{}, true
+	}
+	return nil, true
+}
+
+// NodeREDEventsHandler handles GET /api/nodered/v1/events?after=123&limit=50&event_type=alarm&device_eui=...
+// Returns events flattened for Node-RED as a bare JSON array, oldest first: the first limit
+// events after the given ID, or the latest limit events without ?after=. A flow passes the
+// id of the last event it got as ?after= on its next poll.
+func NodeREDEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q, hasAfter, ok := nodeREDFeedQuery(w, r, r.URL.Query().Get("after"))
+	if !ok {
+		return
+	}
+
+	q.Limit = 50
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		q.Limit = min(n, maxNodeREDEvents)
+	}
+	q.Latest = !hasAfter
+
+	events, err := database.GetEventFeed(q)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve events for Node-RED: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, nodered.Flatten(events, getConfig().API.BaseURL))
+}
+
+// NodeREDStreamHandler handles GET /api/nodered/v1/events/stream?event_type=alarm&device_eui=...
+// Streams events flattened for Node-RED as server-sent events as soon as they are stored:
+// the SSE id is the event ID, the SSE event name its event_type and the data the flat event.
+// A client reconnecting with Last-Event-ID (or ?after=) first gets the events it missed;
+// otherwise the stream starts with the next event.
+func NodeREDStreamHandler(w http.ResponseWriter, r *http.Request) {
+	after := r.URL.Query().Get("after")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		after = last
+	}
+	q, hasAfter, ok := nodeREDFeedQuery(w, r, after)
+	if !ok {
+		return
+	}
+	if !hasAfter {
+		lastID, err := database.LastNotificationEventID()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+			return
+		}
+		q.AfterID = lastID
+	}
+	q.Limit = nodeREDStreamBatch
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // Unbuffered behind nginx
+	w.WriteHeader(http.StatusOK)
+	log.Printf("Node-RED event stream opened by %s after event %d", r.RemoteAddr, q.AfterID)
+
+	rc := http.NewResponseController(w)
+	baseURL := getConfig().API.BaseURL
+	keepAlive := time.NewTicker(nodeREDKeepAlive)
+	defer keepAlive.Stop()
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds()); err != nil {
+		return
+	}
+	for {
+		stored := database.EventsStored()
+		events, err := database.GetEventFeed(q)
+		if err != nil {
+			log.Printf("WARNING: Node-RED event stream failed to load events: %v", err)
+		}
+		for _, e := range nodered.Flatten(events, baseURL) {
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.EventType, data); err != nil {
+				log.Printf("Node-RED event stream to %s ended", r.RemoteAddr)
+				return
+			}
+			q.AfterID = e.ID
+		}
+		if err := rc.Flush(); err != nil {
+			log.Printf("Node-RED event stream to %s ended", r.RemoteAddr)
+			return
+		}
+		if len(events) == nodeREDStreamBatch {
+			continue
+		}
+
+		select {
+		case <-stored:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			log.Printf("Node-RED event stream closed by %s", r.RemoteAddr)
+			return
+		}
+	}
+}
+
+// NodeREDFlowHandler handles GET /api/nodered/v1/flow
+// Returns a sample Node-RED flow for this server (import it with Node-RED's Import dialog):
+// it polls the event feed, routes events by type and fetches alarm images.
+func NodeREDFlowHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="watcher-nodered-flow.json"`)
+	if err := nodered.EncodeSampleFlow(w, getConfig().API.BaseURL); err != nil {
+		log.Printf("ERROR: Failed to write the Node-RED sample flow: %v", err)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
 )
 
 // NotFoundHandler handles all unmatched routes (404)
@@ -17,6 +20,15 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the 404 in detail
 	log404Request(r, bodyBytes)
 
+	// Aggregate by path/method/device so unimplemented endpoints can be reviewed later.
+	// Only devices are recorded: anyone can send a request here, and scanners would fill the table.
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+	if fromDevice(r, deviceEUI) {
+		if err := database.RecordUnknownEndpoint(r.Method, r.URL.Path, deviceEUI, r.URL.RawQuery, string(bodyBytes)); err != nil {
+			log.Printf("WARNING: Failed to record unknown endpoint: %v", err)
+		}
+	}
+
 	// Return 404 response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNotFound)
@@ -27,6 +39,24 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// fromDevice reports whether an unmatched request came from a device: it carries device
+// credentials (the AUTH_TOKEN or a device API key) or the EUI of a registered device
+func fromDevice(r *http.Request, deviceEUI string) bool {
+	if ok, err := auth.DeviceAuthenticated(r); err != nil {
+		log.Printf("WARNING: Failed to check device credentials: %v", err)
+	} else if ok {
+		return true
+	}
+	if deviceEUI == "" {
+		return false
+	}
+	registered, err := database.IsDeviceRegistered(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: Failed to look up device %s: %v", deviceEUI, err)
+	}
+	return registered
+}
+
 func log404Request(r *http.Request, body []byte) {
 	log.Println("================================================================================")
 	log.Println("404 NOT FOUND - Unmatched Route")
@@ -6,10 +6,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/brianhealey/sensecap-server/internal/database"
 	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/rules"
 )
 
 // NotificationHandler handles /v1/notification/event POST requests
@@ -22,7 +26,7 @@ func NotificationHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("ERROR: Failed to read request body: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		http.Error(w, "Failed to read request body", readBodyStatus(err))
 		return
 	}
 	defer r.Body.Close()
@@ -68,23 +72,116 @@ func saveNotificationToDatabase(deviceEUI string, req *models.NotificationEventR
 		}
 	}
 
+	// The device runs the task view_task_detail serves, so the event belongs to it
+	active, err := database.GetActiveTaskFlow(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: Failed to load active task for event: %v", err)
+	}
+
 	// Create notification event
 	event := &database.NotificationEvent{
 		RequestID:     req.RequestID,
 		DeviceEUI:     deviceEUI,
 		Timestamp:     getTimestamp(req.Events.Timestamp),
 		Text:          getString(req.Events.Text),
-		Img:           getString(req.Events.Img),
+		Img:           maskBase64Image(visionSettingsFor(getConfig(), deviceEUI).Privacy, deviceEUI, getString(req.Events.Img), inferenceJSON),
 		InferenceData: inferenceJSON,
 		SensorData:    sensorJSON,
 	}
+	if active != nil {
+		// Copied so the event still says which task fired after the task is edited or deleted
+		event.TLID = active.ID
+		event.TaskHeadline = active.Headline
+		event.TaskPrompt = active.TriggerCondition
+	}
+	event.EventType = database.ClassifyEvent(event)
+	alarm := event.EventType == database.EventAlarm && active != nil
+	if alarm {
+		// Held until the alarm is stored, so simultaneous duplicates see each other
+		dedupMu.Lock()
+		event.Suppressed = inTaskCooldown(active)
+	}
 
 	// Save to database
-	if err := database.SaveNotificationEvent(event); err != nil {
+	if alarm && duplicateAlarm(active, event) {
+		log.Printf("Dropped duplicate alarm from %s (task %d): same classes %v as an alarm in the last %ds",
+			deviceEUI, active.ID, rules.Classes(event), active.DedupSeconds)
+	} else if err := database.SaveNotificationEvent(event); err != nil {
 		log.Printf("WARNING: Failed to save notification event to database: %v", err)
+	} else if event.Suppressed {
+		log.Printf("Notification event saved to database: ID=%d (task %d cooling down, not actioned)", event.ID, active.ID)
 	} else {
 		log.Printf("Notification event saved to database: ID=%d", event.ID)
+		attachContextFrames(deviceEUI, active, event)
+	}
+	if alarm {
+		dedupMu.Unlock()
+	}
+
+	// Stored alarms are republished to the device's MJPEG stream
+	if event.EventType == database.EventAlarm && event.ID != 0 {
+		publishAlarmImage(event)
 	}
+
+	// Store sensor readings as a time series for charting
+	if req.Events.Data != nil && req.Events.Data.Sensor != nil {
+		ts := time.Now()
+		if event.Timestamp > 0 {
+			ts = time.UnixMilli(event.Timestamp)
+		}
+		if err := database.SaveSensorReadings(deviceEUI, ts, sensorValues(req.Events.Data.Sensor)); err != nil {
+			log.Printf("WARNING: Failed to save sensor readings: %v", err)
+		}
+		rules.CheckThresholds(event)
+	}
+}
+
+// inTaskCooldown reports whether an alarm for a task arrives within the task's server-side
+// cooldown of its last actioned alarm. The device applies its own silence_duration too, but
+// that is lost on reboot and not applied to alarms relayed by other clients.
+func inTaskCooldown(task *database.TaskFlow) bool {
+	if task.CooldownSeconds <= 0 {
+		return false
+	}
+	last, err := database.LastActionedAlarmAt(task.ID)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+		return false
+	}
+	return last != nil && time.Since(*last) < time.Duration(task.CooldownSeconds)*time.Second
+}
+
+// dedupMu serializes task alarms between the duplicate check and the insert
+var dedupMu sync.Mutex
+
+// duplicateAlarm reports whether an alarm detects the same classes as an alarm the device sent
+// within the task's de-duplication window. Devices send the same detection again when a task
+// restarts (reboot, re-sent task), which silence_duration does not cover; such duplicates are
+// not stored, so they neither fire actions nor count in the task's statistics.
+func duplicateAlarm(task *database.TaskFlow, event *database.NotificationEvent) bool {
+	if task.DedupSeconds <= 0 {
+		return false
+	}
+	recent, err := database.RecentAlarms(event.DeviceEUI, time.Now().Add(-time.Duration(task.DedupSeconds)*time.Second))
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+		return false
+	}
+
+	classes := classSet(event)
+	for _, previous := range recent {
+		if classSet(previous) == classes {
+			return true
+		}
+	}
+	return false
+}
+
+// classSet returns an event's detected classes as a comparable key (empty without detections)
+func classSet(event *database.NotificationEvent) string {
+	classes := rules.Classes(event)
+	sort.Strings(classes)
+	return strings.Join(classes, ",")
 }
 
 func getTimestamp(ts *int64) int64 {
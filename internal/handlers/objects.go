@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// cocoSynonyms maps each COCO class to everyday words for it, so that target objects
+// like "delivery driver" or "kitten" resolve to a class the detection models know
+// (custom classes bring their own synonyms)
+var cocoSynonyms = map[string][]string{
+	"person": {
+		"people", "human", "man", "men", "woman", "women", "child", "children", "kid", "baby",
+		"boy", "girl", "adult", "guy", "someone", "somebody", "anyone", "anybody", "stranger",
+		"intruder", "visitor", "guest", "burglar", "thief", "pedestrian", "worker", "customer",
+		"delivery driver", "delivery person", "delivery man", "courier", "mailman", "postman",
+		"mail carrier",
+	},
+	"bicycle":       {"bike", "cycle"},
+	"car":           {"vehicle", "automobile", "sedan", "suv", "taxi", "cab"},
+	"motorcycle":    {"motorbike", "scooter", "moped"},
+	"airplane":      {"plane", "aeroplane", "aircraft", "jet"},
+	"truck":         {"lorry", "pickup", "pickup truck", "van", "delivery truck"},
+	"boat":          {"ship", "yacht", "canoe", "kayak"},
+	"bird":          {"pigeon", "crow", "sparrow", "seagull", "parrot", "duck", "goose", "geese", "chicken"},
+	"cat":           {"kitten", "kitty", "feline"},
+	"dog":           {"puppy", "pup", "doggy", "hound", "canine", "pooch"},
+	"horse":         {"pony"},
+	"sheep":         {"lamb"},
+	"cow":           {"cattle", "bull", "calf"},
+	"backpack":      {"rucksack", "school bag"},
+	"handbag":       {"purse", "bag"},
+	"suitcase":      {"luggage"},
+	"sports ball":   {"ball", "football", "soccer ball", "basketball"},
+	"cup":           {"mug"},
+	"knife":         {"knives"},
+	"donut":         {"doughnut"},
+	"couch":         {"sofa", "settee"},
+	"potted plant":  {"plant", "houseplant", "flower pot"},
+	"dining table":  {"table", "desk"},
+	"tv":            {"television", "tv screen"},
+	"laptop":        {"computer", "notebook"},
+	"mouse":         {"mice", "computer mouse"},
+	"remote":        {"remote control", "tv remote"},
+	"cell phone":    {"phone", "mobile", "mobile phone", "smartphone", "cellphone"},
+	"refrigerator":  {"fridge"},
+	"teddy bear":    {"teddy", "stuffed animal", "plush toy"},
+	"hair drier":    {"hair dryer", "blow dryer"},
+	"traffic light": {"traffic signal", "stoplight"},
+}
+
+// lookupClass resolves a word or phrase to a class by exact match, ignoring plurals
+func lookupClass(phrase string) (string, bool) {
+	lookup := currentClasses().lookup
+	if class, ok := lookup[phrase]; ok {
+		return class, true
+	}
+	for _, suffix := range []string{"es", "s"} {
+		if strings.HasSuffix(phrase, suffix) {
+			if class, ok := lookup[strings.TrimSuffix(phrase, suffix)]; ok {
+				return class, true
+			}
+		}
+	}
+	return "", false
+}
+
+// findClassInText returns the class mentioned in free text (e.g. a trigger condition). ok is false when no class or more than one distinct class is mentioned,
+// in which case the choice is left to the LLM.
+func findClassInText(text string) (string, bool) {
+	classes := classesInText(text)
+	if len(classes) != 1 {
+		return "", false
+	}
+	return classes[0], true
+}
+
+// classesInText returns the distinct classes mentioned in free text, in the order they appear
+func classesInText(text string) []string {
+	words := tokenize(text)
+	var found []string
+
+	for i := 0; i < len(words); {
+		matched := 0
+		// Prefer the longest phrase starting at this word ("delivery driver" over "delivery")
+		for n := 3; n >= 1; n-- {
+			if i+n > len(words) {
+				continue
+			}
+			if class, ok := lookupClass(strings.Join(words[i:i+n], " ")); ok {
+				if !slices.Contains(found, class) {
+					found = append(found, class)
+				}
+				matched = n
+				break
+			}
+		}
+		if matched == 0 {
+			matched = 1
+		}
+		i += matched
+	}
+
+	return found
+}
+
+// matchClass normalizes an LLM answer to a class: exact or synonym match first,
+// then the closest class or synonym within a small edit distance (near-miss spellings)
+func matchClass(answer string) (string, bool) {
+	phrase := strings.Join(tokenize(answer), " ")
+	phrase = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(phrase, "a "), "an "), "the ")
+	if phrase == "" {
+		return "", false
+	}
+
+	if class, ok := lookupClass(phrase); ok {
+		return class, true
+	}
+
+	// Allow one typo in short words, two in longer ones
+	maxDistance := 1
+	if len(phrase) > 5 {
+		maxDistance = 2
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for word, class := range currentClasses().lookup {
+		if d := levenshtein(phrase, word); d < bestDistance || (d == bestDistance && class < best) {
+			best, bestDistance = class, d
+		}
+	}
+	return best, best != ""
+}
+
+// nearestLocalObject suggests the closest object the built-in models can detect
+// for a class that would need a cloud model: a pet for other animals, otherwise a person
+func nearestLocalObject(class string) string {
+	switch class {
+	case "bird", "teddy bear":
+		return "cat"
+	case "horse", "sheep", "cow", "elephant", "bear", "zebra", "giraffe":
+		return "dog"
+	}
+	return "person"
+}
+
+// tokenize lowercases text and splits it into words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
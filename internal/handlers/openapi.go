@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/schema"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// apiDocsPage renders openapi.json with Swagger UI. The page and Swagger UI's script and
+// stylesheet (web/swagger-ui, under /api/docs/swagger-ui/) are served by the binary.
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API - SenseCAP Watcher Server</title>
+<link rel="stylesheet" href="docs/swagger-ui/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"><p>Loading Swagger UI... The raw document is at <a href="openapi.json">openapi.json</a>.</p></div>
+<script src="docs/swagger-ui/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui", persistAuthorization: true});
+</script>
+</body>
+</html>
+`
+
+// OpenAPIHandler handles GET /api/openapi.json
+// Serves the OpenAPI document of the device-facing and management APIs, generated from
+// the Go types the handlers use.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, schema.OpenAPI(version.Version, getConfig().Server.BasePath))
+}
+
+// APIDocsHandler handles GET /api/docs
+// Serves Swagger UI for the OpenAPI document.
+func APIDocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(apiDocsPage))
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"image"
+	"log"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+)
+
+// maskImage applies a privacy mode to a JPEG from a device before it is stored or served.
+// inferenceJSON holds the device's detections, if any, to find people in. The result may be
+// data itself. An image that cannot be blurred is dropped (nil) rather than kept as sent.
+func maskImage(mode, deviceEUI string, data []byte, inferenceJSON string) []byte {
+	masked, err := maskJPEG(mode, data, inferenceJSON)
+	if err != nil {
+		log.Printf("WARNING: Dropped image from %s that could not be blurred: %v", deviceEUI, err)
+		return nil
+	}
+	return masked
+}
+
+// maskBase64Image is maskImage for a base64 JPEG, as notification events carry them
+func maskBase64Image(mode, deviceEUI, img, inferenceJSON string) string {
+	if img == "" || mode == config.PrivacyOff || mode == "" {
+		return img
+	}
+	data, err := imaging.DecodeBase64JPEG(img)
+	if err != nil {
+		log.Printf("WARNING: Dropped image from %s that could not be blurred: %v", deviceEUI, err)
+		return ""
+	}
+	if data = maskImage(mode, deviceEUI, data, inferenceJSON); data == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// maskJPEG blurs the people found in a JPEG's detections, or the whole image in the full mode
+// or when there are no detection boxes to go by
+func maskJPEG(mode string, data []byte, inferenceJSON string) ([]byte, error) {
+	if mode == config.PrivacyOff || mode == "" {
+		return data, nil
+	}
+
+	var regions []image.Rectangle // nil = whole image
+	if mode == config.PrivacyPeople {
+		if people, detected := imaging.PersonRegions(inferenceJSON); detected {
+			if len(people) == 0 {
+				return data, nil
+			}
+			regions = people
+		}
+	}
+	return imaging.BlurJPEG(data, regions)
+}
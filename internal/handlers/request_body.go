@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+const (
+	maxPresizeBytes = 8 << 20  // Largest Content-Length a body buffer is grown to before reading
+	maxPooledBytes  = 4 << 20  // Larger buffers are left to the garbage collector, not pooled
+	maxFieldBytes   = 64 << 10 // Largest value of a vision request field other than the image
+)
+
+// bodyBuffers are reused for device uploads (audio bodies, decoded images), so a steady
+// stream of posts does not allocate a new buffer of several hundred KB each time
+var bodyBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBodyBuffer() *bytes.Buffer {
+	return bodyBuffers.Get().(*bytes.Buffer)
+}
+
+// putBodyBuffer returns a buffer to the pool. Its bytes must no longer be used.
+func putBodyBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBytes {
+		return
+	}
+	b.Reset()
+	bodyBuffers.Put(b)
+}
+
+// readBody reads a request body into a pooled buffer, grown once to the declared
+// Content-Length instead of doubling as it fills. The caller returns the buffer with
+// putBodyBuffer once done with the bytes.
+func readBody(r *http.Request) (*bytes.Buffer, error) {
+	buf := getBodyBuffer()
+	if n := r.ContentLength; n > 0 && n <= maxPresizeBytes {
+		buf.Grow(int(n) + bytes.MinRead) // ReadFrom wants MinRead spare bytes before it sees EOF
+	}
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		putBodyBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// errInvalidVisionRequest marks vision requests that are not valid JSON or carry an image that
+// is not base64
+var errInvalidVisionRequest = errors.New("invalid image analyzer request")
+
+// decodeImageAnalyzerRequest reads the JSON body of a vision request, decoding the base64
+// image into img as it streams in. Neither the body nor the image string is held in memory;
+// the small fields are decoded with encoding/json. req.Img is left empty. A "data:" URL
+// prefix on the image is tolerated, like imaging.DecodeBase64JPEG does.
+func decodeImageAnalyzerRequest(body io.Reader, img *bytes.Buffer) (*models.ImageAnalyzerRequest, error) {
+	br := bufio.NewReaderSize(body, 32<<10)
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", errInvalidVisionRequest, fmt.Sprintf(format, args...))
+	}
+
+	if c, err := nextToken(br); err != nil {
+		return nil, unexpectedEOF(err)
+	} else if c != '{' {
+		return nil, invalid("not a JSON object")
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for first := true; ; first = false {
+		c, err := nextToken(br)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if c == '}' && first {
+			break
+		}
+		if c != '"' {
+			return nil, invalid("expected a field name")
+		}
+		br.UnreadByte()
+		rawKey, err := readJSONValue(br)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		var key string
+		if err := json.Unmarshal(rawKey, &key); err != nil {
+			return nil, invalid("field name: %v", err)
+		}
+		if c, err := nextToken(br); err != nil {
+			return nil, unexpectedEOF(err)
+		} else if c != ':' {
+			return nil, invalid("expected ':' after %q", key)
+		}
+
+		// Field names match case-insensitively, as with json.Unmarshal
+		if strings.EqualFold(key, "img") {
+			if err := decodeImageValue(br, img); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		} else {
+			if _, err := nextToken(br); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			br.UnreadByte()
+			if fields[key], err = readJSONValue(br); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+
+		c, err = nextToken(br)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if c == '}' {
+			break
+		}
+		if c != ',' {
+			return nil, invalid("expected ',' or '}' after %q", key)
+		}
+	}
+	if _, err := nextToken(br); err != io.EOF {
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, invalid("data after the JSON object")
+	}
+
+	var req models.ImageAnalyzerRequest
+	rest, err := json.Marshal(fields)
+	if err == nil {
+		err = json.Unmarshal(rest, &req)
+	}
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	return &req, nil
+}
+
+// decodeImageValue decodes the base64 string value of the img field into img. null is an
+// empty image.
+func decodeImageValue(br *bufio.Reader, img *bytes.Buffer) error {
+	c, err := nextToken(br)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if c == 'n' {
+		br.UnreadByte()
+		if v, err := readJSONValue(br); err != nil {
+			return err
+		} else if string(v) != "null" {
+			return fmt.Errorf("%w: img must be a string", errInvalidVisionRequest)
+		}
+		return nil
+	}
+	if c != '"' {
+		return fmt.Errorf("%w: img must be a string", errInvalidVisionRequest)
+	}
+
+	img.Reset()
+	s := &jsonStringReader{br: br}
+
+	// Skip a "data:image/jpeg;base64," prefix
+	var prefix [64]byte
+	n, err := io.ReadFull(s, prefix[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head := prefix[:n]
+	if i := bytes.IndexByte(head, ','); i >= 0 && bytes.HasPrefix(head, []byte("data:")) {
+		head = head[i+1:]
+	}
+	data := io.MultiReader(bytes.NewReader(head), s)
+	if _, err := img.ReadFrom(base64.NewDecoder(base64.StdEncoding, data)); err != nil {
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) || err == io.ErrUnexpectedEOF { // ErrUnexpectedEOF: a truncated last quantum
+			return fmt.Errorf("%w: img is not valid base64: %v", errInvalidVisionRequest, err)
+		}
+		return err
+	}
+	// The decoder stops at padding; anything after it is not base64
+	if rest, err := io.Copy(io.Discard, s); err != nil {
+		return err
+	} else if rest > 0 {
+		return fmt.Errorf("%w: img has data after the base64 padding", errInvalidVisionRequest)
+	}
+	return nil
+}
+
+// jsonStringReader reads the unescaped bytes of a JSON string whose opening quote has been
+// read, up to its closing quote. \u escapes must be ASCII (the string is base64).
+type jsonStringReader struct {
+	br   *bufio.Reader
+	done bool
+}
+
+func (s *jsonStringReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && !s.done {
+		c, err := s.br.ReadByte()
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		switch c {
+		case '"':
+			s.done = true
+			continue
+		case '\\':
+			if c, err = s.unescape(); err != nil {
+				return n, err
+			}
+		}
+		p[n] = c
+		n++
+	}
+	if s.done && n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *jsonStringReader) unescape() (byte, error) {
+	c, err := s.br.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	switch c {
+	case '"', '\\', '/':
+		return c, nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		var hex [4]byte
+		if _, err := io.ReadFull(s.br, hex[:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		r, err := strconv.ParseUint(string(hex[:]), 16, 16)
+		if err != nil || r >= 0x80 {
+			return 0, fmt.Errorf("%w: img is not valid base64", errInvalidVisionRequest)
+		}
+		return byte(r), nil
+	}
+	return 0, fmt.Errorf("%w: invalid escape \\%c", errInvalidVisionRequest, c)
+}
+
+// readJSONValue reads one JSON value as is (validated later by encoding/json), up to
+// maxFieldBytes
+func readJSONValue(br *bufio.Reader) ([]byte, error) {
+	var v []byte
+	depth := 0
+	inString, escaped := false, false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if !inString && depth == 0 && len(v) > 0 && (c == ',' || c == '}' || c == ']' || isJSONSpace(c)) {
+			br.UnreadByte() // End of a number, true, false or null
+			return v, nil
+		}
+		if v = append(v, c); len(v) > maxFieldBytes {
+			return nil, fmt.Errorf("%w: a field is larger than %d KB", errInvalidVisionRequest, maxFieldBytes>>10)
+		}
+
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if depth == 0 {
+					return v, nil
+				}
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth--; depth <= 0 {
+				return v, nil
+			}
+		}
+	}
+}
+
+// nextToken returns the next byte that is not whitespace
+func nextToken(br *bufio.Reader) (byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !isJSONSpace(c) {
+			return c, nil
+		}
+	}
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// unexpectedEOF turns the end of the body in the middle of a value into an invalid request.
+// Read errors (e.g. *http.MaxBytesError) are returned as they are.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("%w: unexpected end of JSON input", errInvalidVisionRequest)
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+func TestDecodeImageAnalyzerRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    models.ImageAnalyzerRequest
+		wantImg string
+	}{
+		{
+			name:    "all fields",
+			body:    `{"img":"QUJD","prompt":"Is the door open?","audio_txt":"hello","type":1}`,
+			want:    models.ImageAnalyzerRequest{Prompt: "Is the door open?", AudioTxt: "hello", Type: 1},
+			wantImg: "ABC",
+		},
+		{
+			name:    "whitespace around tokens",
+			body:    " \r\n{ \"type\" :\t0 ,\n\"img\" : \"QUJD\" }\n",
+			wantImg: "ABC",
+		},
+		{
+			name:    "image after the small fields",
+			body:    `{"prompt":"a","type":1,"img":"QUJD"}`,
+			want:    models.ImageAnalyzerRequest{Prompt: "a", Type: 1},
+			wantImg: "ABC",
+		},
+		{name: "empty object", body: `{}`},
+		{name: "null image", body: `{"img":null,"type":1}`, want: models.ImageAnalyzerRequest{Type: 1}},
+		{name: "empty image", body: `{"img":""}`},
+		{name: "field names match case-insensitively", body: `{"IMG":"QUJD","Prompt":"a"}`, want: models.ImageAnalyzerRequest{Prompt: "a"}, wantImg: "ABC"},
+		{name: "unknown fields are ignored", body: `{"img":"QUJD","extra":{"a":[1,"}"]},"n":-1.5e3,"b":true}`, wantImg: "ABC"},
+		{name: "data URL prefix", body: `{"img":"data:image/jpeg;base64,QUJD"}`, wantImg: "ABC"},
+		{name: "escaped slash in the image", body: `{"img":"\/\/\/\/"}`, wantImg: "\xff\xff\xff"},
+		{name: "unicode escape in the image", body: `{"img":"Q\u0055JD"}`, wantImg: "ABC"},
+		{name: "escaped data URL", body: `{"img":"data:image\/jpeg;base64,QUJD"}`, wantImg: "ABC"},
+		{name: "escapes in small fields", body: `{"prompt":"say \"hi\"\n\u00e9","img":"QUJD"}`, want: models.ImageAnalyzerRequest{Prompt: "say \"hi\"\né"}, wantImg: "ABC"},
+		{name: "escaped field name", body: `{"\u0069mg":"QUJD"}`, wantImg: "ABC"},
+		{name: "padded image", body: `{"img":"QUI="}`, wantImg: "AB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var img bytes.Buffer
+			req, err := decodeImageAnalyzerRequest(strings.NewReader(tt.body), &img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *req != tt.want {
+				t.Errorf("request %+v, want %+v", *req, tt.want)
+			}
+			if img.String() != tt.wantImg {
+				t.Errorf("image %q, want %q", img.String(), tt.wantImg)
+			}
+		})
+	}
+}
+
+func TestDecodeImageAnalyzerRequestMatchesEncodingJSON(t *testing.T) {
+	body := `{"img":"data:image/jpeg;base64,/9j/4AAQ","prompt":"Is \"it\" <here>? ☺","audio_txt":"","type":1}`
+	var want models.ImageAnalyzerRequest
+	if err := json.Unmarshal([]byte(body), &want); err != nil {
+		t.Fatal(err)
+	}
+	want.Img = ""
+
+	var img bytes.Buffer
+	req, err := decodeImageAnalyzerRequest(strings.NewReader(body), &img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *req != want {
+		t.Errorf("request %+v, encoding/json decodes %+v", *req, want)
+	}
+	if !bytes.Equal(img.Bytes(), []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}) {
+		t.Errorf("image % x", img.Bytes())
+	}
+}
+
+func TestDecodeImageAnalyzerRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty body", ""},
+		{"whitespace only", " \n"},
+		{"not an object", `["QUJD"]`},
+		{"field name not a string", `{img:"QUJD"}`},
+		{"missing colon", `{"img" "QUJD"}`},
+		{"missing comma", `{"img":"QUJD" "type":1}`},
+		{"trailing comma", `{"img":"QUJD",}`},
+		{"trailing data", `{"img":"QUJD"} {}`},
+		{"trailing garbage", `{"img":"QUJD"}x`},
+		{"image not a string", `{"img":42}`},
+		{"image true", `{"img":true}`},
+		{"image nul", `{"img":nul}`},
+		{"image not base64", `{"img":"Q!JD"}`},
+		{"image quantum truncated", `{"img":"QUJDR"}`},
+		{"data after the padding", `{"img":"QQ==QUJD"}`},
+		{"invalid escape in the image", `{"img":"QU\xJD"}`},
+		{"non-ASCII escape in the image", `{"img":"QU\u00e9JD"}`},
+		{"bad unicode escape in the image", `{"img":"QU\uzzzzJD"}`},
+		{"small field of the wrong type", `{"img":"QUJD","type":"one"}`},
+		{"small field not JSON", `{"img":"QUJD","type":1x}`},
+		{"small field too large", `{"prompt":"` + strings.Repeat("a", maxFieldBytes) + `"}`},
+		{"truncated before a field", `{"img":"QUJD",`},
+		{"truncated in a field name", `{"im`},
+		{"truncated after a field name", `{"img"`},
+		{"truncated in the image", `{"type":1,"img":"QUJD`},
+		{"truncated in an image escape", `{"img":"QU\u00`},
+		{"truncated in a small field", `{"prompt":"Is the`},
+		{"truncated in a nested value", `{"extra":{"a":[1,`},
+		{"truncated before the closing brace", `{"img":"QUJD"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var img bytes.Buffer
+			req, err := decodeImageAnalyzerRequest(strings.NewReader(tt.body), &img)
+			if !errors.Is(err, errInvalidVisionRequest) {
+				t.Errorf("got request %+v, error %v; want errInvalidVisionRequest", req, err)
+			}
+			if readBodyStatus(err) != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", readBodyStatus(err), http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestDecodeImageAnalyzerRequestPassesReadErrors(t *testing.T) {
+	bodies := map[string]string{
+		"in the image":       `{"type":1,"img":"` + strings.Repeat("QUJD", 1000) + `"}`,
+		"in a small field":   `{"prompt":"` + strings.Repeat("a", 4000) + `","img":"QUJD"}`,
+		"between the fields": `{"type":1,` + strings.Repeat(" ", 4000) + `"img":"QUJD"}`,
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			limited := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(body)), 1000)
+			var img bytes.Buffer
+			_, err := decodeImageAnalyzerRequest(limited, &img)
+
+			var maxBytesErr *http.MaxBytesError
+			if !errors.As(err, &maxBytesErr) {
+				t.Fatalf("got %v, want *http.MaxBytesError", err)
+			}
+			if errors.Is(err, errInvalidVisionRequest) {
+				t.Error("an oversized body is reported as invalid JSON")
+			}
+			if readBodyStatus(err) != http.StatusRequestEntityTooLarge {
+				t.Errorf("status %d, want %d", readBodyStatus(err), http.StatusRequestEntityTooLarge)
+			}
+		})
+	}
+
+	readErr := errors.New("connection reset")
+	body := io.MultiReader(strings.NewReader(`{"img":"QUJD`), iotest.ErrReader(readErr))
+	var img bytes.Buffer
+	if _, err := decodeImageAnalyzerRequest(body, &img); !errors.Is(err, readErr) || errors.Is(err, errInvalidVisionRequest) {
+		t.Errorf("got %v, want the read error", err)
+	}
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/rules"
+	"github.com/gorilla/mux"
+)
+
+// phoneNumber matches an E.164 phone number
+var phoneNumber = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// eventRuleRequest is the body of POST /api/rules and PUT /api/rules/{id}
+type eventRuleRequest struct {
+	Name            string   `json:"name"`
+	Device          string   `json:"device"` // Device EUI or registered name (empty = all devices)
+	Class           string   `json:"class"`
+	EventType       string   `json:"event_type"`
+	Hours           string   `json:"hours"`
+	MinConfidence   int      `json:"min_confidence"` // 0-100
+	Sensor          string   `json:"sensor"`         // temperature, humidity or co2
+	SensorAbove     *float64 `json:"sensor_above"`
+	SensorBelow     *float64 `json:"sensor_below"`
+	Action          string   `json:"action"`
+	Target          string   `json:"target"`
+	Image           string   `json:"image"` // Image mode of a webhook (default link)
+	CooldownSeconds int      `json:"cooldown_seconds"`
+	Enabled         *bool    `json:"enabled"` // Default true; omitted on PUT keeps the current state
+}
+
+// RulesHandler handles GET /api/rules (list) and POST /api/rules (create)
+// An event rule is a saved event search (device, class and its confidence, event type, sensor
+// thresholds, hours of the day) with an action (webhook, SMS, ntfy, MQTT or shell command)
+// fired for every new matching event.
+func RulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		list, err := database.GetEventRules(false)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve event rules: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve rules")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": list})
+		return
+	}
+
+	rule := &database.EventRule{Enabled: true}
+	if !decodeEventRule(w, r, rule) {
+		return
+	}
+	if err := database.CreateEventRule(rule); err != nil {
+		log.Printf("ERROR: Failed to create event rule: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save rule")
+		return
+	}
+
+	log.Printf("Created event rule %d (%s): %s to %s", rule.ID, rule.Name, rule.Action, rule.Target)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"code": 201, "data": rule})
+}
+
+// RuleHandler handles PUT /api/rules/{id} (replace) and DELETE /api/rules/{id}
+func RuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule := requestedRule(w, r)
+	if rule == nil {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := database.DeleteEventRule(rule.ID); err != nil {
+			log.Printf("ERROR: Failed to delete event rule %d: %v", rule.ID, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to delete rule")
+			return
+		}
+		log.Printf("Deleted event rule %d (%s)", rule.ID, rule.Name)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	if !decodeEventRule(w, r, rule) {
+		return
+	}
+	found, err := database.UpdateEventRule(rule)
+	if err != nil {
+		log.Printf("ERROR: Failed to update event rule %d: %v", rule.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save rule")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "rule not found")
+		return
+	}
+
+	log.Printf("Updated event rule %d (%s)", rule.ID, rule.Name)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": rule})
+}
+
+// RuleEventsHandler handles GET /api/rules/{id}/events?since=24h&limit=50
+// Runs a rule's saved search: the stored events its filter matches, newest first,
+// whether or not the rule is enabled or was cooling down.
+func RuleEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rule := requestedRule(w, r)
+	if rule == nil {
+		return
+	}
+
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	events, err := database.SearchNotificationEvents(time.Now().Add(-window), rule.DeviceEUI, rule.EventType)
+	if err != nil {
+		log.Printf("ERROR: Failed to search events for rule %d: %v", rule.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+
+	views := []taskEventView{}
+	for _, e := range events {
+		if len(views) == limit {
+			break
+		}
+		if !rules.Matches(rule, e) {
+			continue
+		}
+		views = append(views, newTaskEventView(e))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"rule":   rule,
+			"count":  len(views),
+			"events": views,
+		},
+	})
+}
+
+// requestedRule loads the rule of a /api/rules/{id} request, writing the error response and
+// returning nil if it does not exist
+func requestedRule(w http.ResponseWriter, r *http.Request) *database.EventRule {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid rule ID")
+		return nil
+	}
+
+	rule, err := database.GetEventRuleByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve event rule %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve rule")
+		return nil
+	}
+	if rule == nil {
+		writeError(w, r, http.StatusNotFound, "rule not found")
+		return nil
+	}
+	return rule
+}
+
+// decodeEventRule validates an eventRuleRequest body into rule, writing a 400 response and
+// returning false if it is invalid
+func decodeEventRule(w http.ResponseWriter, r *http.Request, rule *database.EventRule) bool {
+	var req eventRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return false
+	}
+
+	rule.Name = strings.TrimSpace(req.Name)
+	if rule.Name == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return false
+	}
+
+	eui, ok := resolveRuleDevice(w, r, strings.TrimSpace(req.Device))
+	if !ok {
+		return false
+	}
+	rule.DeviceEUI = eui
+
+	rule.Class = strings.ToLower(strings.TrimSpace(req.Class))
+	rule.EventType = req.EventType
+	if rule.EventType != "" && !database.ValidEventType(rule.EventType) {
+		writeError(w, r, http.StatusBadRequest, "event_type must be one of: %s", strings.Join(database.EventTypes, ", "))
+		return false
+	}
+
+	rule.Hours = strings.ReplaceAll(req.Hours, " ", "")
+	if rule.Hours != "" {
+		if _, _, err := rules.ParseHours(rule.Hours); err != nil {
+			writeError(w, r, http.StatusBadRequest, "hours must be HH:MM-HH:MM, e.g. 00:00-05:00")
+			return false
+		}
+	}
+
+	if req.MinConfidence < 0 || req.MinConfidence > 100 {
+		writeError(w, r, http.StatusBadRequest, "min_confidence must be between 0 and 100")
+		return false
+	}
+	rule.MinConfidence = req.MinConfidence
+
+	rule.Sensor = strings.ToLower(strings.TrimSpace(req.Sensor))
+	rule.SensorAbove, rule.SensorBelow = req.SensorAbove, req.SensorBelow
+	if rule.Sensor == "" {
+		if rule.SensorAbove != nil || rule.SensorBelow != nil {
+			writeError(w, r, http.StatusBadRequest, "sensor_above and sensor_below need a sensor")
+			return false
+		}
+	} else {
+		if !slices.Contains(database.SensorMetrics, rule.Sensor) {
+			writeError(w, r, http.StatusBadRequest, "sensor must be one of: %s", strings.Join(database.SensorMetrics, ", "))
+			return false
+		}
+		if rule.SensorAbove == nil && rule.SensorBelow == nil {
+			writeError(w, r, http.StatusBadRequest, "a sensor condition needs sensor_above or sensor_below")
+			return false
+		}
+		if rule.SensorAbove != nil && rule.SensorBelow != nil && *rule.SensorAbove >= *rule.SensorBelow {
+			writeError(w, r, http.StatusBadRequest, "sensor_above must be less than sensor_below")
+			return false
+		}
+	}
+
+	rule.Action, rule.Target = req.Action, strings.TrimSpace(req.Target)
+	switch rule.Action {
+	case database.RuleActionWebhook:
+		if u, err := url.Parse(rule.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, r, http.StatusBadRequest, "webhook target must be an http or https URL")
+			return false
+		}
+	case database.RuleActionSMS:
+		if getConfig().Rules.TwilioAccountSID == "" {
+			writeError(w, r, http.StatusBadRequest, "SMS actions need TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM")
+			return false
+		}
+		if !phoneNumber.MatchString(rule.Target) {
+			writeError(w, r, http.StatusBadRequest, "SMS target must be a phone number in E.164 format, e.g. +15551234567")
+			return false
+		}
+	case database.RuleActionNtfy:
+		if u, err := url.Parse(rule.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			writeError(w, r, http.StatusBadRequest, "ntfy target must be a topic URL, e.g. https://ntfy.sh/my-topic")
+			return false
+		}
+	case database.RuleActionMQTT:
+		if getConfig().Rules.MQTTURL == "" {
+			writeError(w, r, http.StatusBadRequest, "MQTT actions need RULES_MQTT_URL")
+			return false
+		}
+		if rule.Target == "" || strings.ContainsAny(rule.Target, "+#") {
+			writeError(w, r, http.StatusBadRequest, "MQTT target must be a topic without wildcards")
+			return false
+		}
+	case database.RuleActionCommand:
+		if !getConfig().Rules.AllowCommands {
+			writeError(w, r, http.StatusBadRequest, "command actions need RULES_ALLOW_COMMANDS=true")
+			return false
+		}
+		if rule.Target == "" {
+			writeError(w, r, http.StatusBadRequest, "command target must be a shell command")
+			return false
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, "action must be one of: %s", strings.Join(database.RuleActions, ", "))
+		return false
+	}
+
+	rule.Image = req.Image
+	if rule.Image == "" {
+		rule.Image = database.RuleImageLink
+	}
+	if !rules.ValidImageMode(rule.Image) {
+		writeError(w, r, http.StatusBadRequest, "image must be one of: %s", strings.Join(rules.ImageModes(), ", "))
+		return false
+	}
+
+	if req.CooldownSeconds < 0 {
+		writeError(w, r, http.StatusBadRequest, "cooldown_seconds must be a non-negative integer")
+		return false
+	}
+	rule.CooldownSeconds = req.CooldownSeconds
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return true
+}
+
+// resolveRuleDevice returns the EUI of a device given by EUI or registered name ("" for all devices)
+func resolveRuleDevice(w http.ResponseWriter, r *http.Request, device string) (string, bool) {
+	if device == "" {
+		return "", true
+	}
+	if _, err := hex.DecodeString(device); err == nil && len(device) == 16 {
+		return strings.ToUpper(device), true
+	}
+
+	devices, err := database.GetDevices(0)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve devices: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve devices")
+		return "", false
+	}
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, device) {
+			return d.EUI, true
+		}
+	}
+	writeError(w, r, http.StatusBadRequest, "unknown device: %s", device)
+	return "", false
+}
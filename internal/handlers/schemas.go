@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/schema"
+	"github.com/gorilla/mux"
+)
+
+// SchemasHandler handles GET /api/schemas
+// Lists the device-facing payloads this server implements, with links to their JSON Schema and sample.
+func SchemasHandler(w http.ResponseWriter, r *http.Request) {
+	base := getConfig().Server.BasePath + "/api/schemas/"
+
+	schemas := make([]map[string]interface{}, 0, len(schema.Payloads))
+	for _, p := range schema.Payloads {
+		schemas = append(schemas, map[string]interface{}{
+			"name":        p.Name,
+			"endpoint":    p.Endpoint,
+			"direction":   p.Direction,
+			"description": p.Description,
+			"schema_url":  base + p.Name,
+			"sample_url":  base + p.Name + "/sample",
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":   len(schemas),
+			"schemas": schemas,
+		},
+	})
+}
+
+// SchemaHandler handles GET /api/schemas/{name} (JSON Schema) and /api/schemas/{name}/sample (sample payload)
+func SchemaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := schema.Find(vars["name"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "%v", err)
+		return
+	}
+
+	if vars["part"] == "sample" {
+		writeJSON(w, http.StatusOK, p.Sample)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schema.Generate(p))
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// searchResultView is a search result as listed by the API, with the URL of the event image
+// relative to the API root (empty when there is none)
+type searchResultView struct {
+	*database.SearchResult
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// SearchHandler handles GET /api/search?q=delivery+person&since=720h&device_eui=&limit=20
+// Finds the events (alarm text, RECOGNIZE answers of the vision model, task headlines) and
+// voice interactions (transcriptions and responses) matching any word of q, most relevant
+// first. Without since, everything stored is searched.
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	var since time.Time
+	if r.URL.Query().Get("since") != "" {
+		window, ok := parseSince(w, r)
+		if !ok {
+			return
+		}
+		since = time.Now().Add(-window)
+	}
+
+	limit := 20
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	if !database.SearchAvailable() {
+		writeError(w, r, http.StatusServiceUnavailable, "full-text search is not available in this build")
+		return
+	}
+
+	results, err := database.Search(database.SearchQuery{
+		Text:      q,
+		Since:     since,
+		DeviceEUI: r.URL.Query().Get("device_eui"),
+		VisibleTo: auth.VisibleTo(r),
+		Limit:     limit,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to search for %q: %v", q, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to search")
+		return
+	}
+
+	views := make([]searchResultView, 0, len(results))
+	for _, result := range results {
+		view := searchResultView{SearchResult: result}
+		if result.HasImage {
+			view.ImageURL = fmt.Sprintf("events/%d/image", result.ID)
+		}
+		views = append(views, view)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":   len(views),
+			"results": views,
+		},
+	})
+}
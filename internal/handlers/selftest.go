@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audio"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+// selfTestTone is the beep played back by the self-test (880 Hz, 200 ms)
+var selfTestTone = audio.Tone(880, 200*time.Millisecond)
+
+// SelfTestHandler handles /v2/watcher/selftest GET and POST requests
+// It answers in the same multipart format as audio_stream (JSON + boundary + WAV) without
+// touching the AI pipeline, echoing what the server received so device connectivity and
+// auth can be checked on their own. Device auth and EUI validation apply as usual.
+func SelfTestHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("ERROR: Failed to read request body: %v", err)
+		http.Error(w, "Failed to read request body", readBodyStatus(err))
+		return
+	}
+	defer r.Body.Close()
+
+	log.Printf("Self-test from device %s (%s %s, %d bytes, remote %s)",
+		deviceEUI, r.Method, r.URL.Path, len(body), r.RemoteAddr)
+
+	duration, err := audio.Duration(selfTestTone)
+	if err != nil {
+		log.Printf("WARNING: Failed to read self-test audio duration: %v", err)
+	}
+
+	response, err := talk.NewResponse(map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"mode":        0,
+			"duration":    int(duration.Milliseconds()),
+			"stt_result":  "",
+			"screen_text": "Self-test OK",
+			"echo": map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"query":       r.URL.RawQuery,
+				"headers":     echoHeaders(r.Header),
+				"device_eui":  deviceEUI,
+				"remote_addr": r.RemoteAddr,
+				"body_bytes":  len(body),
+				"server":      version.String(),
+				"time":        time.Now().Format(time.RFC3339),
+			},
+		},
+	}, selfTestTone)
+	if err != nil {
+		log.Printf("ERROR: Failed to create self-test response: %v", err)
+		http.Error(w, "Failed to create response", http.StatusInternalServerError)
+		return
+	}
+
+	writeAudioResult(w, &audioResult{status: http.StatusOK, response: response})
+}
+
+// echoHeaders returns the request headers with credentials replaced by whether they were sent
+func echoHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if name == "Authorization" || name == "Cookie" || strings.Contains(strings.ToLower(name), "key") {
+			value = "(present, redacted)"
+		}
+		headers[name] = value
+	}
+	return headers
+}
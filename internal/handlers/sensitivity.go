@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// Sensitivities of a task (TaskFlow.Sensitivity): how sure the vision model must be that the
+// trigger is met, trading missed alarms for false positives. Tasks without one take the
+// model's plain yes or no.
+const (
+	SensitivityStrict  = "strict"
+	SensitivityNormal  = "normal"
+	SensitivityRelaxed = "relaxed"
+)
+
+// sensitivities lists the valid sensitivities, strictest first
+var sensitivities = []string{SensitivityStrict, SensitivityNormal, SensitivityRelaxed}
+
+// sensitivityThresholds is the lowest confidence (0-100) of a YES verdict that meets a
+// task's trigger
+var sensitivityThresholds = map[string]int{
+	SensitivityStrict:  80,
+	SensitivityNormal:  60,
+	SensitivityRelaxed: 40,
+}
+
+// verdictPattern matches a verdict at the start of an answer, such as "YES 85" or "No, 30%"
+var verdictPattern = regexp.MustCompile(`(?i)^\W*(yes|no)\b\W*(\d{1,3})\b`)
+
+// parseVerdict reads the verdict of an answer to a verdict prompt; ok is false when the
+// answer has none (the model ignored the format)
+func parseVerdict(analysis string) (yes bool, confidence int, ok bool) {
+	m := verdictPattern.FindStringSubmatch(analysis)
+	if m == nil {
+		return false, 0, false
+	}
+	confidence, err := strconv.Atoi(m[2])
+	if err != nil || confidence > 100 {
+		return false, 0, false
+	}
+	return strings.EqualFold(m[1], "yes"), confidence, true
+}
+
+// sensitivityPrompt turns a task's verification prompt into the verdict prompt of its
+// sensitivity (the prompt as is without one)
+func sensitivityPrompt(c *config.Config, sensitivity, prompt string) string {
+	guidance := ""
+	switch sensitivity {
+	case "":
+		return prompt
+	case SensitivityStrict:
+		guidance = c.Prompts.StrictGuidance
+	case SensitivityRelaxed:
+		guidance = c.Prompts.RelaxedGuidance
+	}
+	if guidance != "" {
+		guidance += " "
+	}
+	return fmt.Sprintf(c.Prompts.Verdict, prompt, guidance)
+}
+
+// taskMatch reports whether an answer to a task's monitoring prompt says the trigger is met.
+// For tasks with a sensitivity, the verdict must be YES with at least the sensitivity's
+// confidence; answers without a verdict, and other tasks, are judged by the provider.
+func taskMatch(provider VisionProvider, task *database.TaskFlow, analysis string) bool {
+	if task == nil || task.Sensitivity == "" {
+		return provider.Match(analysis)
+	}
+	yes, confidence, ok := parseVerdict(analysis)
+	if !ok {
+		return provider.Match(analysis)
+	}
+	threshold, known := sensitivityThresholds[task.Sensitivity]
+	if !known {
+		threshold = sensitivityThresholds[SensitivityNormal]
+	}
+	return yes && confidence >= threshold
+}
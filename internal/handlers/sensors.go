@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// Sensor series downsampling: points per series by default and at most
+const (
+	defaultSensorPoints = 300
+	maxSensorPoints     = 5000
+)
+
+// sensorValues converts reported sensor data to readings keyed by metric
+func sensorValues(sensor *models.SensorData) map[string]float64 {
+	values := make(map[string]float64)
+	if sensor.Temperature != nil {
+		values[database.SensorTemperature] = *sensor.Temperature
+	}
+	if sensor.Humidity != nil {
+		values[database.SensorHumidity] = float64(*sensor.Humidity)
+	}
+	if sensor.CO2 != nil {
+		values[database.SensorCO2] = float64(*sensor.CO2)
+	}
+	return values
+}
+
+// DeviceSensorsHandler handles GET /api/devices/{eui}/sensors?metric=&from=&to=&points=&bucket=
+// Returns a device's sensor time series, averaged into buckets for charting. from/to accept
+// RFC 3339 times or Unix milliseconds (default: the last 24 hours). The bucket width is
+// ?bucket= (e.g. 5m) if given, otherwise chosen so each series has at most ?points= points.
+func DeviceSensorsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+	query := r.URL.Query()
+
+	metrics := database.SensorMetrics
+	if metric := strings.ToLower(query.Get("metric")); metric != "" {
+		valid := false
+		for _, m := range database.SensorMetrics {
+			valid = valid || m == metric
+		}
+		if !valid {
+			writeError(w, r, http.StatusBadRequest, "metric must be one of: %s", strings.Join(database.SensorMetrics, ", "))
+			return
+		}
+		metrics = []string{metric}
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	points := defaultSensorPoints
+	if v := query.Get("points"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxSensorPoints {
+			writeError(w, r, http.StatusBadRequest, "points must be between 1 and %d", maxSensorPoints)
+			return
+		}
+		points = n
+	}
+
+	// Round the automatic bucket up to a whole second so bucket starts are readable
+	bucket := (to.Sub(from) + time.Duration(points) - 1) / time.Duration(points)
+	bucket = (bucket + time.Second - 1).Truncate(time.Second)
+	if v := query.Get("bucket"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			writeError(w, r, http.StatusBadRequest, "bucket must be a duration of at least 1s, e.g. 5m")
+			return
+		}
+		if to.Sub(from)/d > maxSensorPoints {
+			writeError(w, r, http.StatusBadRequest, "bucket too small: more than %d points", maxSensorPoints)
+			return
+		}
+		bucket = d
+	}
+
+	series := make(map[string][]database.SensorPoint)
+	for _, metric := range metrics {
+		data, err := database.GetSensorSeries(deviceEUI, metric, from, to, bucket)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve %s readings for %s: %v", metric, deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve sensor readings")
+			return
+		}
+		series[metric] = data
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"device_eui": deviceEUI,
+			"from":       from.UnixMilli(),
+			"to":         to.UnixMilli(),
+			"bucket_ms":  bucket.Milliseconds(),
+			"series":     series,
+		},
+	})
+}
+
+// parseTimeRange parses the ?from= and ?to= of a request (RFC 3339 times or Unix milliseconds,
+// default: the last 24 hours), writing a 400 response and returning false if they are invalid
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	query := r.URL.Query()
+
+	to = time.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid to: %v", err)
+			return from, to, false
+		}
+		to = t
+	}
+	from = to.Add(-24 * time.Hour)
+	if v := query.Get("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid from: %v", err)
+			return from, to, false
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, "from must be before to")
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// parseTimeParam parses an RFC 3339 time or Unix milliseconds
+func parseTimeParam(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 time or Unix milliseconds")
+	}
+	return t, nil
+}
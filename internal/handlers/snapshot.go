@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/gorilla/mux"
+)
+
+// maxSnapshotWait caps the ?wait= parameter of GET /api/devices/{eui}/snapshot
+const maxSnapshotWait = time.Minute
+
+// latestFrame returns a device's most recent frame and a channel that is closed when the
+// next one arrives
+func latestFrame(deviceEUI string) (*bufferedFrame, <-chan struct{}) {
+	contextFramesMu.Lock()
+	defer contextFramesMu.Unlock()
+
+	frames := contextFrames[deviceEUI]
+	if frames == nil {
+		frames = &deviceFrames{}
+		contextFrames[deviceEUI] = frames
+	}
+	if frames.next == nil {
+		frames.next = make(chan struct{})
+	}
+	return frames.last, frames.next
+}
+
+// DeviceSnapshotHandler handles GET /api/devices/{eui}/snapshot?wait=10s&w=320
+// Serves the most recent camera frame the device uploaded as a JPEG. The firmware has no
+// command (over BLE or HTTP) to capture a frame on request, so frames come from the image
+// analyzer's uploads to /v1/watcher/vision while a task runs. With ?wait= the request waits
+// up to that long (max 1m) for the next upload, falling back to the last frame on timeout.
+// X-Frame-Age reports the frame's age in seconds.
+func DeviceSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+	query := r.URL.Query()
+
+	var wait time.Duration
+	if ws := query.Get("wait"); ws != "" {
+		d, err := time.ParseDuration(ws)
+		if err != nil || d < 0 || d > maxSnapshotWait {
+			writeError(w, r, http.StatusBadRequest, "wait must be a duration between 0s and %s", maxSnapshotWait)
+			return
+		}
+		wait = d
+	}
+
+	width := 0
+	if ws := query.Get("w"); ws != "" {
+		n, err := strconv.Atoi(ws)
+		if err != nil || n <= 0 || n > maxThumbnailWidth {
+			writeError(w, r, http.StatusBadRequest, "w must be between 1 and %d", maxThumbnailWidth)
+			return
+		}
+		width = n
+	}
+
+	frame, next := latestFrame(deviceEUI)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-next:
+			frame, _ = latestFrame(deviceEUI)
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+	if frame == nil {
+		writeError(w, r, http.StatusNotFound, "no frame received from device")
+		return
+	}
+
+	data := frame.jpeg
+	if width > 0 {
+		var err error
+		data, err = imaging.ResizeJPEG(data, width)
+		if err != nil {
+			log.Printf("ERROR: Failed to resize snapshot of device %s: %v", deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to resize image")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Age", strconv.Itoa(int(time.Since(frame.at).Seconds())))
+	http.ServeContent(w, r, "", frame.at, bytes.NewReader(data))
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+// numberWords are the spelled-out numbers speech recognition produces for counts
+var numberWords = map[string]int{
+	"zero": 0, "one": 1, "single": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "fifteen": 15,
+	"twenty": 20, "thirty": 30, "forty": 40, "forty five": 45, "fifty": 50, "sixty": 60,
+}
+
+// number matches a count in digits or words
+const number = `(\d+|a couple of|a dozen|forty five|[a-z]+)`
+
+// Count conditions, most specific first ("no more than 3" before "more than 3")
+var countPatterns = []struct {
+	re      *regexp.Regexp
+	compare string
+	offset  int // Added to the number: "at least 3" is "more than 2"
+}{
+	{regexp.MustCompile(`\b(?:no more than|not more than|at most|up to) ` + number + `\b`), database.CompareLess, 1},
+	{regexp.MustCompile(`\b(?:no fewer than|no less than|not less than|at least|minimum of) ` + number + `\b`), database.CompareGreater, -1},
+	{regexp.MustCompile(`\b` + number + ` (?:or|and) more\b`), database.CompareGreater, -1},
+	{regexp.MustCompile(`\b` + number + ` (?:or|and) (?:fewer|less)\b`), database.CompareLess, 1},
+	{regexp.MustCompile(`\b(?:more than|over|above|greater than|upwards of) ` + number + `\b`), database.CompareGreater, 0},
+	{regexp.MustCompile(`\b(?:fewer than|less than|under|below) ` + number + `\b`), database.CompareLess, 0},
+	{regexp.MustCompile(`\b(?:exactly|only|just) ` + number + `\b`), database.CompareEqual, 0},
+}
+
+var (
+	countChangePattern = regexp.MustCompile(`\b(?:number|count|amount)\b.*\b(?:changes?|changing|goes up or down|goes up|goes down|increases?|decreases?)\b`)
+	disappearPattern   = regexp.MustCompile(`\b(?:nobody|no one|noone|nothing|there (?:is|are) no|no \w+ (?:is|are)|leaves?|leaving|disappears?|disappeared|goes away|gone|missing|no longer|absent|empty|not (?:there|present|around|home|in)|isn't (?:there|around|home)|aren't (?:there|around|home))\b`)
+
+	// A time of day: "10", "10pm", "10:30 pm", "22:00", "noon", "midnight"
+	timeOfDay     = `(\d{1,2}(?:[:.]\d{2})?\s?(?:am|pm)?|noon|midnight)`
+	windowPattern = regexp.MustCompile(`\b(?:between|from) ` + timeOfDay + ` (?:and|to|until|till|through) ` + timeOfDay)
+	afterPattern  = regexp.MustCompile(`\bafter ` + timeOfDay)
+	beforePattern = regexp.MustCompile(`\bbefore ` + timeOfDay)
+
+	spokenTimePattern = regexp.MustCompile(`(\d)\s+(am|pm)\b`)
+
+	intervalPattern = regexp.MustCompile(`\b(?:every|once (?:every|an?|per|each)|each) (?:` + number + ` )?(second|minute|hour|min)s?\b`)
+	halfHourPattern = regexp.MustCompile(`\b(?:every|once (?:every|per|each)?) half (?:an )?hour\b|\bonce every thirty minutes\b`)
+)
+
+// dayParts are named parts of the day and their windows
+var dayParts = []struct {
+	re          *regexp.Regexp
+	from, until string
+}{
+	{regexp.MustCompile(`\b(?:at night|overnight|during the night|nighttime|night time|tonight|at nighttime)\b`), "22:00", "06:00"},
+	{regexp.MustCompile(`\b(?:business hours|office hours|working hours|work hours)\b`), "09:00", "17:00"},
+	{regexp.MustCompile(`\b(?:in the morning|mornings)\b`), "06:00", "12:00"},
+	{regexp.MustCompile(`\b(?:in the afternoon|afternoons)\b`), "12:00", "18:00"},
+	{regexp.MustCompile(`\b(?:in the evening|evenings)\b`), "18:00", "22:00"},
+	{regexp.MustCompile(`\b(?:during the day|daytime|day time|in the daytime)\b`), "07:00", "19:00"},
+}
+
+var (
+	weekdaysPattern = regexp.MustCompile(`\b(?:weekdays?|workdays?|work days|business days|business hours|office hours|monday to friday|monday through friday)\b`)
+	weekendsPattern = regexp.MustCompile(`\bweekends?\b`)
+	dayNames        = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+)
+
+// parseTaskConditions reads the detection conditions of a task request: how many objects
+// ("more than 3 people"), whether they appear or disappear ("when the dog leaves"), when the
+// task runs ("between 10pm and 6am", "on weekdays") and how often it may trigger ("at most
+// once every 10 minutes"). It returns nil for requests without any, which keep the plain
+// "object appears" trigger. Like findCOCOClassInText, it only understands common phrasings.
+func parseTaskConditions(transcription string) *database.TaskConditions {
+	text := normalizeConditionText(transcription)
+	c := &database.TaskConditions{Mode: database.TaskAppear}
+
+	for _, p := range countPatterns {
+		m := p.re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		n, ok := parseCount(m[1])
+		if !ok {
+			continue
+		}
+		n += p.offset
+		if n < 0 || (n == 0 && p.compare == database.CompareLess) {
+			continue
+		}
+		if n == 0 && p.compare == database.CompareGreater {
+			break // "at least one" is the plain trigger
+		}
+		c.Mode, c.Compare, c.Num = database.TaskCount, p.compare, n
+		break
+	}
+	if c.Mode == database.TaskAppear {
+		switch {
+		case countChangePattern.MatchString(text):
+			c.Mode = database.TaskCountChange
+		case disappearPattern.MatchString(text):
+			c.Mode = database.TaskDisappear
+		}
+	}
+
+	if m := windowPattern.FindStringSubmatch(text); m != nil {
+		from, ok1 := parseTimeOfDay(m[1])
+		until, ok2 := parseTimeOfDay(m[2])
+		if ok1 && ok2 && from != until {
+			c.From, c.Until = from, until
+		}
+	} else if m := afterPattern.FindStringSubmatch(text); m != nil {
+		if from, ok := parseTimeOfDay(m[1]); ok && from != "00:00" {
+			c.From, c.Until = from, "00:00"
+		}
+	} else if m := beforePattern.FindStringSubmatch(text); m != nil {
+		if until, ok := parseTimeOfDay(m[1]); ok && until != "00:00" {
+			c.From, c.Until = "00:00", until
+		}
+	}
+	if c.From == "" {
+		for _, part := range dayParts {
+			if part.re.MatchString(text) {
+				c.From, c.Until = part.from, part.until
+				break
+			}
+		}
+	}
+
+	switch {
+	case weekdaysPattern.MatchString(text):
+		c.Days = []int{1, 2, 3, 4, 5}
+	case weekendsPattern.MatchString(text):
+		c.Days = []int{0, 6}
+	default:
+		for i, day := range dayNames {
+			if strings.Contains(text, day) {
+				c.Days = append(c.Days, i)
+			}
+		}
+	}
+
+	if halfHourPattern.MatchString(text) {
+		c.IntervalSeconds = 1800
+	} else if m := intervalPattern.FindStringSubmatch(text); m != nil {
+		n := 1
+		if m[1] != "" {
+			var ok bool
+			if n, ok = parseCount(m[1]); !ok || n == 0 {
+				n = 1
+			}
+		}
+		unit := time.Minute
+		switch m[2] {
+		case "second":
+			unit = time.Second
+		case "hour":
+			unit = time.Hour
+		}
+		c.IntervalSeconds = int((time.Duration(n) * unit).Seconds())
+	}
+
+	if c.Mode == database.TaskAppear && len(c.Days) == 0 && c.From == "" && c.IntervalSeconds == 0 {
+		return nil
+	}
+	return c
+}
+
+// normalizeConditionText lowercases a transcription and writes times the way the patterns
+// expect ("10 p.m." is "10pm")
+func normalizeConditionText(text string) string {
+	text = strings.ToLower(text)
+	text = strings.NewReplacer("a.m.", "am", "p.m.", "pm", "a.m", "am", "p.m", "pm", "’", "'", ",", " ", "?", " ", "!", " ").Replace(text)
+	text = spokenTimePattern.ReplaceAllString(text, "${1}${2}")
+	text = strings.TrimRight(text, ". ")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// parseCount reads a count in digits or words
+func parseCount(s string) (int, bool) {
+	switch s {
+	case "a couple of":
+		return 2, true
+	case "a dozen":
+		return 12, true
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+	n, ok := numberWords[s]
+	return n, ok
+}
+
+// parseTimeOfDay reads a time of day as "HH:MM". Hours from 1 to 6 without am or pm are taken
+// as pm ("from 9 to 5", "after 6").
+func parseTimeOfDay(s string) (string, bool) {
+	switch s {
+	case "noon":
+		return "12:00", true
+	case "midnight":
+		return "00:00", true
+	}
+	s = strings.ReplaceAll(s, " ", "")
+	suffix := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		suffix, s = s[len(s)-2:], s[:len(s)-2]
+	}
+	hour, minute := s, "0"
+	if i := strings.IndexAny(s, ":."); i >= 0 {
+		hour, minute = s[:i], s[i+1:]
+	}
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if err1 != nil || err2 != nil || h > 23 || m > 59 {
+		return "", false
+	}
+
+	if suffix == "" && h >= 1 && h <= 6 {
+		suffix = "pm"
+	}
+	switch {
+	case suffix == "pm" && h < 12:
+		h += 12
+	case suffix == "am" && h == 12:
+		h = 0
+	}
+	return fmt.Sprintf("%02d:%02d", h, m), true
+}
+
+// describeConditions says a task's conditions in words, for the voice confirmation ("" = none)
+func describeConditions(c *database.TaskConditions) string {
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	switch c.Mode {
+	case database.TaskDisappear:
+		parts = append(parts, "when it is gone")
+	case database.TaskCountChange:
+		parts = append(parts, "when the number changes")
+	case database.TaskCount:
+		switch c.Compare {
+		case database.CompareGreater:
+			parts = append(parts, fmt.Sprintf("more than %d", c.Num))
+		case database.CompareLess:
+			parts = append(parts, fmt.Sprintf("fewer than %d", c.Num))
+		case database.CompareEqual:
+			parts = append(parts, fmt.Sprintf("exactly %d", c.Num))
+		}
+	}
+
+	switch {
+	case isDays(c.Days, 1, 2, 3, 4, 5):
+		parts = append(parts, "on weekdays")
+	case isDays(c.Days, 0, 6):
+		parts = append(parts, "on weekends")
+	case len(c.Days) > 0:
+		names := make([]string, len(c.Days))
+		for i, d := range c.Days {
+			names[i] = strings.ToUpper(dayNames[d][:1]) + dayNames[d][1:]
+		}
+		parts = append(parts, "on "+strings.Join(names, ", "))
+	}
+	if c.From != "" {
+		parts = append(parts, fmt.Sprintf("from %s to %s", c.From, c.Until))
+	}
+	if c.IntervalSeconds > 0 {
+		parts = append(parts, "at most once every "+formatInterval(c.IntervalSeconds))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func isDays(days []int, want ...int) bool {
+	if len(days) != len(want) {
+		return false
+	}
+	for i := range days {
+		if days[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatInterval says a number of seconds as "10 minutes", "hour" or "30 seconds"
+func formatInterval(seconds int) string {
+	for _, unit := range []struct {
+		seconds int
+		name    string
+	}{{3600, "hour"}, {60, "minute"}, {1, "second"}} {
+		if seconds%unit.seconds == 0 {
+			n := seconds / unit.seconds
+			if n == 1 {
+				return unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+// aiCameraCondition maps a task's conditions to the AI camera's detection condition (class,
+// mode, type and num) and shutter. Without conditions, the object appearing triggers.
+func aiCameraCondition(class string, c *database.TaskConditions) (condition models.AICameraCondition, shutter int) {
+	condition = models.AICameraCondition{
+		Class: class,
+		Mode:  TFModuleAICameraModeAppear,
+		Type:  TFModuleAICameraTypePreset,
+		Num:   0,
+	}
+	shutter = TFModuleAICameraShutterTriggerConstantly
+	if c == nil {
+		return condition, shutter
+	}
+
+	switch c.Mode {
+	case database.TaskDisappear:
+		// No object left: trigger once on the change, not for as long as the scene is empty
+		condition.Type = TFModuleAICameraTypeEqual
+		shutter = TFModuleAICameraShutterTriggerUpEdge
+	case database.TaskCountChange:
+		condition.Mode = TFModuleAICameraModeNumChange
+	case database.TaskCount:
+		condition.Num = c.Num
+		switch c.Compare {
+		case database.CompareLess:
+			condition.Type = TFModuleAICameraTypeLess
+		case database.CompareEqual:
+			condition.Type = TFModuleAICameraTypeEqual
+		}
+	}
+	return condition, shutter
+}
+
+// aiCameraSilentPeriod is the AI camera's silent period: the silence between triggers and, for
+// tasks limited to days or hours, the time period it runs in
+func aiCameraSilentPeriod(c *database.TaskConditions) models.SilentPeriod {
+	silence := int(DefaultSilenceDuration.Seconds())
+	if c != nil && c.IntervalSeconds > 0 {
+		silence = c.IntervalSeconds
+	}
+	period := models.SilentPeriod{SilenceDuration: silence}
+	if c == nil || (len(c.Days) == 0 && c.From == "") {
+		return period
+	}
+
+	repeat := []int{1, 1, 1, 1, 1, 1, 1}
+	if len(c.Days) > 0 {
+		repeat = make([]int, 7)
+		for _, d := range c.Days {
+			repeat[d] = 1
+		}
+	}
+	start, end := "00:00:00", "23:59:59"
+	if c.From != "" {
+		start, end = c.From+":00", c.Until+":00"
+	}
+	period.TimePeriod = &models.TimePeriod{
+		Repeat:    repeat,
+		TimeStart: start,
+		TimeEnd:   end,
+	}
+	return period
+}
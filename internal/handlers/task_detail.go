@@ -2,35 +2,76 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/brianhealey/sensecap-server/internal/config"
 	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
 )
 
+// maxTaskWait caps the ?wait= long poll of view_task_detail
+const maxTaskWait = time.Minute
+
 // TaskDetailHandler handles /v2/watcher/talk/view_task_detail POST requests
+// With ?wait=30s&tlid=N (the task the client runs, 0 = none) the request is a long poll: it
+// is answered as soon as the device's task differs from tlid, or after wait with the
+// unchanged task. Without wait it answers right away, as the firmware expects.
 func TaskDetailHandler(w http.ResponseWriter, r *http.Request) {
 	// Read device EUI from header
 	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
 
 	log.Printf("Task detail request from device: %s", deviceEUI)
 
-	// Get all task flows for this device
-	taskFlows, err := database.GetTaskFlowsByDevice(deviceEUI)
+	// Advertised so long-poll clients can tell this server from one that answers right away
+	w.Header().Set("X-Task-Long-Poll", maxTaskWait.String())
+	if ws := r.URL.Query().Get("wait"); ws != "" {
+		wait, err := time.ParseDuration(ws)
+		if err != nil || wait < 0 || wait > maxTaskWait {
+			http.Error(w, "Invalid wait", http.StatusBadRequest)
+			return
+		}
+		known, err := strconv.Atoi(r.URL.Query().Get("tlid"))
+		if err != nil && r.URL.Query().Get("tlid") != "" {
+			http.Error(w, "Invalid tlid", http.StatusBadRequest)
+			return
+		}
+		if !waitForTaskChange(r, deviceEUI, known, wait) {
+			return
+		}
+	}
+
+	// Serve the device's committed task with the highest version that has not been paused due
+	// to repeated device errors; drafts and half-done replacements are never served
+	active, err := database.GetActiveTaskFlow(deviceEUI)
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve task flows: %v", err)
 		http.Error(w, "Failed to retrieve task flows", http.StatusInternalServerError)
 		return
 	}
-
-	log.Printf("Found %d task flows for device %s", len(taskFlows), deviceEUI)
+	if active != nil {
+		log.Printf("Serving task %d (version %d) to device %s", active.ID, active.Version, deviceEUI)
+	}
 
 	// Build response with data.tl.task_flow format that firmware expects
 	var response map[string]interface{}
-	if len(taskFlows) > 0 {
+	if active != nil {
 		// Convert to Node-RED style task flow
-		taskFlowData := convertToNodeREDFormat(taskFlows[0])
+		taskFlowData, err := convertToNodeREDFormat(active)
+		if err != nil {
+			log.Printf("ERROR: Task %d cannot be sent to the device: %v", active.ID, err)
+			http.Error(w, "Invalid task flow", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.MarkTaskDelivered(active.ID); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
 
 		response = map[string]interface{}{
 			"code": 200,
@@ -58,19 +99,16 @@ func selectModelType(targetObject string) int {
 	// Normalize to lowercase for comparison
 	obj := strings.ToLower(targetObject)
 
-	// Model type 1: Person detection
-	if obj == "person" {
-		return 1
-	}
-
-	// Model type 2: Pet/Animal detection (dog, cat)
-	if obj == "dog" || obj == "cat" {
-		return 2
+	// Custom classes name their model
+	if c := currentClasses().custom[obj]; c != nil {
+		return c.ModelType
 	}
 
-	// Model type 3: Gesture detection (rock, paper, scissors)
-	if obj == "rock" || obj == "paper" || obj == "scissors" {
-		return 3
+	// Model types 1-3: the built-in person, pet and gesture models
+	for _, modelType := range []int{ModelTypePerson, ModelTypePet, ModelTypeGesture} {
+		if slices.Contains(models.BuiltinModelClasses[modelType], obj) {
+			return modelType
+		}
 	}
 
 	// Model type 0: Cloud model (download required) for everything else
@@ -78,96 +116,158 @@ func selectModelType(targetObject string) int {
 	return 0
 }
 
-// convertToNodeREDFormat converts our simple TaskFlow to the firmware's Node-RED style format
-func convertToNodeREDFormat(task *database.TaskFlow) map[string]interface{} {
-	// Use task ID as tlid and created timestamp as ctd
-	tlid := task.ID
-	ctd := task.CreatedAt.UnixMilli()
+// BackfillModelTypes picks the model of each task flow migrated from the old root package,
+// which stored none, from its first target object (as selectModelType does for new tasks)
+func BackfillModelTypes() error {
+	tasks, err := database.GetLegacyTaskFlows()
+	if err != nil {
+		return err
+	}
 
+	for _, tf := range tasks {
+		target := ""
+		if len(tf.TargetObjects) > 0 {
+			target = tf.TargetObjects[0]
+		}
+		modelType := selectModelType(target)
+		if err := database.SetTaskFlowModelType(tf.ID, modelType); err != nil {
+			return err
+		}
+		log.Printf("Migrated task %d ('%s'): model type %d for target '%s'", tf.ID, tf.Headline, modelType, target)
+	}
+	return nil
+}
+
+// waitForTaskChange holds a long poll until the task served to the device is no longer known
+// (a task ID, 0 = none) or wait has passed. It returns false if the client went away.
+func waitForTaskChange(r *http.Request, deviceEUI string, known int, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		// Taken before the check, so a change in between is not missed
+		changed := database.TaskFlowsChanged()
+		active, err := database.GetActiveTaskFlow(deviceEUI)
+		if err != nil {
+			log.Printf("WARNING: Failed to check task of %s: %v", deviceEUI, err)
+			return true
+		}
+		current := 0
+		if active != nil {
+			current = active.ID
+		}
+		if current != known {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return true
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// verificationPrompt is the image analyzer prompt of a task: LLaVA answers it for each frame
+// the AI camera sends. Pet and gesture tasks wrap their trigger condition in a prompt that
+// describes what to check for their model's classes; other tasks use it as is. Tasks with a
+// sensitivity ask for a verdict with a confidence on top.
+func verificationPrompt(c *config.Config, task *database.TaskFlow) string {
+	target := ""
+	if len(task.TargetObjects) > 0 {
+		target = task.TargetObjects[0]
+	}
+	prompt := task.TriggerCondition
+	switch task.ModelType {
+	case ModelTypePet:
+		prompt = fmt.Sprintf(c.Prompts.PetVerification, task.TriggerCondition, target)
+	case ModelTypeGesture:
+		prompt = fmt.Sprintf(c.Prompts.GestureVerification, task.TriggerCondition, target)
+	}
+	return sensitivityPrompt(c, task.Sensitivity, prompt)
+}
+
+// convertToNodeREDFormat converts our simple TaskFlow to the firmware's Node-RED style task
+// flow, and validates it: an error means the device could not run it
+func convertToNodeREDFormat(task *database.TaskFlow) (*models.TaskList, error) {
 	// Use the LLM-selected model type stored in database
-	modelType := task.ModelType
-	log.Printf("Using stored model type: %d for task '%s'", modelType, task.Headline)
-
-	// Node 1: AI camera with detection conditions
-	aiCameraNode := map[string]interface{}{
-		"id":    1,
-		"type":  TFModuleTypeAICamera,
-		"index": 0,
-		"params": map[string]interface{}{
-			"modes":      TFModuleAICameraModesInference,
-			"model_type": modelType,
-			"conditions": []map[string]interface{}{
-				{
-					"class": task.TargetObjects[0],
-					"mode":  TFModuleAICameraModeAppear,
-					"type":  TFModuleAICameraTypePreset,
-					"num":   0,
-				},
-			},
-			"conditions_combo": TFModuleAICameraConditionsComboAND,
-			"silent_period": map[string]interface{}{
-				"silence_duration": int(DefaultSilenceDuration.Seconds()),
-			},
-			"output_type": TFModuleAICameraOutputBoth,
-			"shutter":     TFModuleAICameraShutterTriggerConstantly,
-		},
-		"wires": [][]int{{2}}, // Connect to node 2 (image analyzer)
-	}
-
-	// Node 2: Image analyzer - sends large image to LLaVA for verification
-	imageAnalyzerNode := map[string]interface{}{
-		"id":    2,
-		"type":  TFModuleTypeImageAnalyzer,
-		"index": 1,
-		"params": map[string]interface{}{
-			"body": map[string]interface{}{
-				"prompt":    task.TriggerCondition,
-				"type":      TFModuleImgAnalyzerTypeMonitoring,
-				"audio_txt": "",
+	log.Printf("Using stored model type: %d for task '%s'", task.ModelType, task.Headline)
+
+	target := ""
+	if len(task.TargetObjects) > 0 {
+		target = task.TargetObjects[0]
+	}
+
+	// Node 1: AI camera with detection conditions (count, disappearance and schedule parsed
+	// from the voice request), wired to the image analyzer
+	condition, shutter := aiCameraCondition(target, task.Conditions)
+	aiCamera := models.AICameraParams{
+		Modes:           TFModuleAICameraModesInference,
+		ModelType:       task.ModelType,
+		Conditions:      []models.AICameraCondition{condition},
+		ConditionsCombo: TFModuleAICameraConditionsComboAND,
+		SilentPeriod:    aiCameraSilentPeriod(task.Conditions),
+		OutputType:      TFModuleAICameraOutputBoth,
+		Shutter:         shutter,
+	}
+
+	// Custom classes tell the device where to download their model
+	if c := customModel(target); c != nil {
+		aiCamera.Model = &models.AICameraModel{
+			ModelID:   c.ModelID,
+			Version:   c.ModelVersion,
+			ModelName: c.Name,
+			Classes:   []string{c.Name},
+			Checksum:  c.ModelChecksum,
+			Arguments: models.ModelArguments{URL: c.ModelURL, Size: c.ModelSize, Task: "detect"},
+		}
+	}
+
+	// Node 4: where the alarm notification goes - the notification proxy the device is bound
+	// to (our server), or the task's own alarm server
+	silence := int(DefaultNotificationSilence.Seconds())
+	if task.AlarmSilenceSeconds > 0 {
+		silence = task.AlarmSilenceSeconds
+	}
+	var alarm models.Node = models.NewSenseCraftAlarmNode(4, models.SenseCraftAlarmParams{SilenceDuration: silence})
+	if task.AlarmURL != "" {
+		alarm = models.NewHTTPAlarmNode(4, models.HTTPAlarmParams{
+			SilenceDuration: silence,
+			TimeEn:          1,
+			TextEn:          1,
+			ImageEn:         1,
+			SensorEn:        1,
+			Text:            task.Headline,
+			URL:             task.AlarmURL,
+			Token:           task.AlarmToken,
+		})
+	}
+
+	taskList := models.NewTaskList(task.ID, task.CreatedAt, task.Headline,
+		models.NewAICameraNode(1, aiCamera, 2),
+
+		// Node 2: Image analyzer - sends the large image to LLaVA for verification, wired to
+		// both alarms
+		models.NewImageAnalyzerNode(2, models.ImageAnalyzerParams{
+			Body: models.ImageAnalyzerBody{
+				Prompt: verificationPrompt(getConfig().ForDevice(task.DeviceEUI), task),
+				Type:   TFModuleImgAnalyzerTypeMonitoring,
 			},
-		},
-		"wires": [][]int{{3, 4}}, // Connect to both local alarm (3) and sensecraft alarm (4)
-	}
-
-	// Node 3: Local alarm - beep/LED/display on device
-	localAlarmNode := map[string]interface{}{
-		"id":    3,
-		"type":  TFModuleTypeLocalAlarm,
-		"index": 2,
-		"params": map[string]interface{}{
-			"sound":    1,
-			"rgb":      1,
-			"img":      0,
-			"text":     0,
-			"duration": int(DefaultAlarmDuration.Seconds()),
-		},
-		"wires": [][]int{}, // Terminal node
-	}
-
-	// Node 4: SenseCraft alarm - sends HTTP notification to our server
-	sensecraftAlarmNode := map[string]interface{}{
-		"id":    4,
-		"type":  TFModuleTypeSenseCraftAlarm,
-		"index": 3,
-		"params": map[string]interface{}{
-			"silence_duration": int(DefaultNotificationSilence.Seconds()),
-		},
-		"wires": [][]int{}, // Terminal node
-	}
-
-	// Build complete task flow structure
-	taskFlowData := map[string]interface{}{
-		"type":      0,          // Task flow type
-		"tlid":      tlid,       // Task list ID
-		"ctd":       ctd,        // Created date timestamp
-		"tn":        task.Headline, // Task name
-		"task_flow": []map[string]interface{}{
-			aiCameraNode,
-			imageAnalyzerNode,
-			localAlarmNode,
-			sensecraftAlarmNode,
-		},
-	}
-
-	return taskFlowData
+		}, 3, 4),
+
+		// Node 3: Local alarm - beep/LED on device
+		models.NewLocalAlarmNode(3, models.LocalAlarmParams{
+			Sound:    1,
+			RGB:      1,
+			Duration: int(DefaultAlarmDuration.Seconds()),
+		}),
+
+		alarm,
+	)
+
+	if err := taskList.Validate(); err != nil {
+		return nil, err
+	}
+	return taskList, nil
 }
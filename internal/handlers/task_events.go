@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/gorilla/mux"
+)
+
+// maxTaskStatsDays bounds the window of GET /api/tasks/{id}/stats
+const maxTaskStatsDays = 90
+
+// taskEventView is a task's event as listed by the API, with the image replaced by its URL
+// relative to the API root (empty when the event has no image)
+type taskEventView struct {
+	database.NotificationEvent
+	Img               string `json:"img,omitempty"` // Shadows the event's image; always empty
+	ImageURL          string `json:"image_url"`
+	AnnotatedImageURL string `json:"annotated_image_url,omitempty"` // Image with the inference boxes drawn on, when there are any
+}
+
+func newTaskEventView(e *database.NotificationEvent) taskEventView {
+	view := taskEventView{NotificationEvent: *e}
+	if e.Img != "" {
+		view.ImageURL = fmt.Sprintf("events/%d/image", e.ID)
+		if len(imaging.InferenceBoxes(e.InferenceData)) > 0 {
+			view.AnnotatedImageURL = view.ImageURL + "/annotated"
+		}
+	}
+	return view
+}
+
+// visibleTask loads the task of a /api/tasks/{id} request, writing the error response and
+// returning nil if it does not exist or belongs to a device the user cannot see
+func visibleTask(w http.ResponseWriter, r *http.Request) *database.TaskFlow {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid task ID")
+		return nil
+	}
+
+	task, err := database.GetTaskFlowByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve task flow %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve task")
+		return nil
+	}
+	if task == nil || !auth.CanSeeDevice(r, task.DeviceEUI) {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return nil
+	}
+	return task
+}
+
+// TaskEventsHandler handles GET /api/tasks/{id}/events?since=24h&limit=50
+// Lists the events a task generated (alarms and telemetry about the task), newest first.
+func TaskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	events, err := database.GetNotificationEventsByTask(task.ID, time.Now().Add(-window), limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve events of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve events")
+		return
+	}
+
+	views := make([]taskEventView, 0, len(events))
+	for _, e := range events {
+		views = append(views, newTaskEventView(e))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"task":   task,
+			"count":  len(views),
+			"events": views,
+		},
+	})
+}
+
+// TaskStatsHandler handles GET /api/tasks/{id}/stats?days=7
+// Reports how often a task fires: alarms per hour and day, hourly and daily counts, and the last trigger.
+func TaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	days := 7
+	if ds := r.URL.Query().Get("days"); ds != "" {
+		n, err := strconv.Atoi(ds)
+		if err != nil || n <= 0 || n > maxTaskStatsDays {
+			writeError(w, r, http.StatusBadRequest, "days must be between 1 and %d", maxTaskStatsDays)
+			return
+		}
+		days = n
+	}
+
+	stats, err := database.GetTaskEventStats(task, days)
+	if err != nil {
+		log.Printf("ERROR: Failed to compute stats of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to compute task stats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": stats})
+}
+
+// TaskCooldownHandler handles PUT /api/tasks/{id}/cooldown with {"cooldown_seconds": 300}
+// Sets the server-side cooldown: alarms sooner than this after the task's last actioned alarm
+// are stored with "suppressed": true but not actioned. 0 turns the cooldown off.
+func TaskCooldownHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	var req struct {
+		CooldownSeconds *int `json:"cooldown_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CooldownSeconds == nil || *req.CooldownSeconds < 0 {
+		writeError(w, r, http.StatusBadRequest, "cooldown_seconds must be a non-negative integer")
+		return
+	}
+
+	found, err := database.SetTaskCooldown(task.ID, *req.CooldownSeconds)
+	if err != nil {
+		log.Printf("ERROR: Failed to update cooldown of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	log.Printf("Task %d cooldown set to %ds", task.ID, *req.CooldownSeconds)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{"id": task.ID, "cooldown_seconds": *req.CooldownSeconds},
+	})
+}
+
+// TaskDedupHandler handles PUT /api/tasks/{id}/dedup with {"dedup_seconds": 60}
+// Sets the server-side de-duplication window: alarms from the task's device detecting the same
+// classes as one of its alarms within the window are dropped without being stored. 0 turns it off.
+func TaskDedupHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	var req struct {
+		DedupSeconds *int `json:"dedup_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DedupSeconds == nil || *req.DedupSeconds < 0 {
+		writeError(w, r, http.StatusBadRequest, "dedup_seconds must be a non-negative integer")
+		return
+	}
+
+	found, err := database.SetTaskDedup(task.ID, *req.DedupSeconds)
+	if err != nil {
+		log.Printf("ERROR: Failed to update dedup window of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	log.Printf("Task %d dedup window set to %ds", task.ID, *req.DedupSeconds)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{"id": task.ID, "dedup_seconds": *req.DedupSeconds},
+	})
+}
+
+// TaskAlarmHandler handles PUT and DELETE /api/tasks/{id}/alarm
+// PUT {"url": "https://alarms.example.com/watcher", "token": "...", "silence_seconds": 60} makes
+// the device post the task's alarms to that server instead of the notification proxy it is bound
+// to (url may be empty to only change the silence; 0 = the default). DELETE restores the defaults.
+// The device picks the change up the next time it fetches the task; tasks that replace this one
+// keep its alarm target.
+func TaskAlarmHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	var req struct {
+		URL            string `json:"url"`
+		Token          string `json:"token"`
+		SilenceSeconds int    `json:"silence_seconds"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if req.SilenceSeconds < 0 {
+			writeError(w, r, http.StatusBadRequest, "silence_seconds must be a non-negative integer")
+			return
+		}
+		if req.URL != "" {
+			if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				writeError(w, r, http.StatusBadRequest, "url must be an http or https URL")
+				return
+			}
+		} else if req.Token != "" {
+			writeError(w, r, http.StatusBadRequest, "a token needs a url")
+			return
+		}
+	}
+
+	found, err := database.SetTaskAlarm(task.ID, req.URL, req.Token, req.SilenceSeconds)
+	if err != nil {
+		log.Printf("ERROR: Failed to update alarm target of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	target := req.URL
+	if target == "" {
+		target = "notification proxy"
+	}
+	log.Printf("Task %d alarms go to %s (silence %ds)", task.ID, target, req.SilenceSeconds)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"id":                    task.ID,
+			"alarm_url":             req.URL,
+			"alarm_token":           req.Token != "",
+			"alarm_silence_seconds": req.SilenceSeconds,
+		},
+	})
+}
+
+// TaskVisionHandler handles PUT and DELETE /api/tasks/{id}/vision
+// PUT {"provider": "detector"} has the task's images analyzed by that vision provider instead
+// of the device's (ollama, openai or detector). DELETE goes back to the device's provider.
+// Tasks that replace this one keep the provider.
+func TaskVisionHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	var req struct {
+		Provider string `json:"provider"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if !checkVisionProvider(w, r, req.Provider) {
+			return
+		}
+	}
+
+	found, err := database.SetTaskVisionProvider(task.ID, req.Provider)
+	if err != nil {
+		log.Printf("ERROR: Failed to update vision provider of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	task.VisionProvider = req.Provider
+	effective, _ := visionProviderFor(visionSettingsFor(getConfig(), task.DeviceEUI), task)
+	log.Printf("Task %d images are analyzed by %s", task.ID, effective)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"id":              task.ID,
+			"vision_provider": req.Provider,
+			"effective":       effective,
+		},
+	})
+}
+
+// TaskSensitivityHandler handles PUT and DELETE /api/tasks/{id}/sensitivity
+// PUT {"sensitivity": "strict"} has the vision model answer the task's verification prompt with
+// a verdict and a confidence, and only meets the trigger on a YES with the confidence of the
+// sensitivity (strict, normal or relaxed). DELETE goes back to a plain yes or no. The device
+// picks the new prompt up the next time it fetches the task; tasks that replace this one keep
+// the sensitivity.
+func TaskSensitivityHandler(w http.ResponseWriter, r *http.Request) {
+	task := visibleTask(w, r)
+	if task == nil {
+		return
+	}
+
+	var req struct {
+		Sensitivity string `json:"sensitivity"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if !slices.Contains(sensitivities, req.Sensitivity) {
+			writeError(w, r, http.StatusBadRequest, "sensitivity must be one of: %s", strings.Join(sensitivities, ", "))
+			return
+		}
+	}
+
+	found, err := database.SetTaskSensitivity(task.ID, req.Sensitivity)
+	if err != nil {
+		log.Printf("ERROR: Failed to update sensitivity of task %d: %v", task.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update task")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	task.Sensitivity = req.Sensitivity
+	log.Printf("Task %d sensitivity set to %q", task.ID, req.Sensitivity)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"id":          task.ID,
+			"sensitivity": req.Sensitivity,
+			"threshold":   sensitivityThresholds[req.Sensitivity],
+			"prompt":      verificationPrompt(getConfig().ForDevice(task.DeviceEUI), task),
+		},
+	})
+}
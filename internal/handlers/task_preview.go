@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// Errors of a draft task's verification capture
+var (
+	errNoFrame        = errors.New("no frame received from device")
+	errVisionDisabled = errors.New("image analysis is disabled")
+)
+
+// taskVerification is the result of running a draft task's trigger once on a camera frame
+type taskVerification struct {
+	Triggered  bool      `json:"triggered"` // The task would have raised an alarm on the frame
+	Analysis   string    `json:"analysis"`  // The vision model's answer to the trigger condition
+	FrameAt    time.Time `json:"frame_at"`
+	Img        string    `json:"img"` // The frame (base64 JPEG, with the privacy mode applied)
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// verifyDraftTask runs a draft task's image analyzer step (its verification prompt) once on
+// a frame from the device and keeps the result in the device's conversation. The firmware
+// cannot be asked to capture a frame, so the verification uses the latest frame the image
+// analyzer uploaded to /v1/watcher/vision.
+func verifyDraftTask(deviceEUI string, draft *database.TaskFlow, frame *bufferedFrame) (*taskVerification, error) {
+	if frame == nil {
+		return nil, errNoFrame
+	}
+	devCfg := getConfig().ForDevice(deviceEUI)
+	if !devCfg.AI.VisionAnalysis {
+		return nil, errVisionDisabled
+	}
+
+	start := time.Now()
+	_, provider := visionProviderFor(visionSettingsFor(devCfg, deviceEUI), draft)
+	analysis, err := provider.Analyze(devCfg, frame.jpeg, verificationPrompt(devCfg, draft))
+	if err != nil {
+		return nil, err
+	}
+	v := &taskVerification{
+		Triggered:  taskMatch(provider, draft, analysis),
+		Analysis:   analysis,
+		FrameAt:    frame.at,
+		Img:        base64.StdEncoding.EncodeToString(frame.jpeg),
+		VerifiedAt: time.Now(),
+	}
+	log.Printf("Verified draft task %d of %s on a %s old frame in %s (triggered: %v): '%s'",
+		draft.ID, deviceEUI, v.VerifiedAt.Sub(frame.at).Round(time.Second), time.Since(start).Round(time.Millisecond), v.Triggered, analysis)
+
+	recordVerification(deviceEUI, draft.ID, v)
+	return v, nil
+}
+
+// PendingTaskHandler handles GET and DELETE /api/devices/{eui}/pending-task
+// GET previews the draft task a voice request created and the device's conversation waits to
+// have confirmed: the task, the task flow the device would be sent, the task it replaces,
+// when the confirmation window closes and the verification result, if any. DELETE declines
+// the draft, like a "no" to the read-back.
+func PendingTaskHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	draft, verified, expiresAt := pendingTask(deviceEUI)
+	if draft == nil {
+		writeError(w, r, http.StatusNotFound, "no task waiting for confirmation")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		log.Printf("Task '%s' of %s declined via the API", draft.Headline, deviceEUI)
+		discardDraftTask(draft)
+		setVoiceState(deviceEUI, "", voiceListening, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	taskFlow, err := convertToNodeREDFormat(draft)
+	if err != nil {
+		log.Printf("ERROR: Draft task %d of %s cannot be sent to the device: %v", draft.ID, deviceEUI, err)
+		writeError(w, r, http.StatusInternalServerError, "the task cannot be run by the device")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"task":         draft,
+			"task_flow":    taskFlow,
+			"replaces":     currentTask(deviceEUI),
+			"expires_at":   expiresAt,
+			"verification": verified,
+		},
+	})
+}
+
+// PendingTaskConfirmHandler handles POST /api/devices/{eui}/pending-task/confirm
+// Activates the draft task, like a "yes" to the read-back: it replaces the device's tasks and
+// the device picks it up the next time it polls view_task_detail.
+func PendingTaskConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	draft, _, _ := pendingTask(deviceEUI)
+	if draft == nil {
+		writeError(w, r, http.StatusNotFound, "no task waiting for confirmation")
+		return
+	}
+
+	log.Printf("Task '%s' of %s confirmed via the API", draft.Headline, deviceEUI)
+	setVoiceState(deviceEUI, "", voiceExecuting, draft)
+	err := activateTask(draft)
+	setVoiceState(deviceEUI, "", voiceListening, nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to activate task %d: %v", draft.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to activate task")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": draft})
+}
+
+// PendingTaskVerifyHandler handles POST /api/devices/{eui}/pending-task/verify?wait=10s
+// Runs the draft task once on a camera frame and reports whether it would raise an alarm.
+// With ?wait= the request waits up to that long (max 1m) for the device's next frame, falling
+// back to its last frame on timeout. The result is also shown by GET .../pending-task.
+func PendingTaskVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	var wait time.Duration
+	if ws := r.URL.Query().Get("wait"); ws != "" {
+		d, err := time.ParseDuration(ws)
+		if err != nil || d < 0 || d > maxSnapshotWait {
+			writeError(w, r, http.StatusBadRequest, "wait must be a duration between 0s and %s", maxSnapshotWait)
+			return
+		}
+		wait = d
+	}
+
+	draft, _, _ := pendingTask(deviceEUI)
+	if draft == nil {
+		writeError(w, r, http.StatusNotFound, "no task waiting for confirmation")
+		return
+	}
+
+	frame, next := latestFrame(deviceEUI)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-next:
+			frame, _ = latestFrame(deviceEUI)
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+
+	v, err := verifyDraftTask(deviceEUI, draft, frame)
+	switch {
+	case errors.Is(err, errNoFrame):
+		writeError(w, r, http.StatusNotFound, "no frame received from device")
+		return
+	case errors.Is(err, errVisionDisabled):
+		writeError(w, r, http.StatusConflict, "image analysis is disabled")
+		return
+	case err != nil:
+		log.Printf("ERROR: Failed to verify task %d: %v", draft.ID, err)
+		status := http.StatusBadGateway
+		if errors.Is(err, errBackendUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, r, status, "image analysis failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": v})
+}
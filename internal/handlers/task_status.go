@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// TaskStatusHandler handles /v2/watcher/task/status POST requests
+// Devices (or the BLE CLI relaying AT+taskflow? output) report the task flow engine status.
+// Reporting a tlid acknowledges that task. A task whose module keeps reporting errors is
+// paused and no longer served by view_task_detail.
+func TaskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("ERROR: Failed to read request body: %v", err)
+		http.Error(w, "Failed to read request body", readBodyStatus(err))
+		return
+	}
+	defer r.Body.Close()
+
+	var req models.TaskFlowStatusRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		log.Printf("ERROR: Failed to parse JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Task status from device %s: tlid=%d status=%d module=%q err=%d",
+		deviceEUI, req.TLID, req.Status, req.Module, req.ModuleErrCode)
+
+	// Remember what the device is running (used by the task pickup watchdog)
+	status := &database.DeviceTaskStatus{
+		DeviceEUI:     deviceEUI,
+		TLID:          req.TLID,
+		Status:        req.Status,
+		Module:        req.Module,
+		ModuleErrCode: req.ModuleErrCode,
+	}
+	if err := database.SaveDeviceTaskStatus(status); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+
+	task, err := database.GetTaskFlowByID(int(req.TLID))
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve task flow %d: %v", req.TLID, err)
+		http.Error(w, "Failed to retrieve task flow", http.StatusInternalServerError)
+		return
+	}
+	if task == nil || task.DeviceEUI != deviceEUI {
+		// Status for a task we did not deploy (or already deleted) - nothing to track
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	if err := database.MarkTaskAcknowledged(task.ID); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+
+	if err := trackTaskModuleError(task, &req); err != nil {
+		log.Printf("ERROR: Failed to track task status for task %d: %v", task.ID, err)
+		http.Error(w, "Failed to update task status", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+// trackTaskModuleError counts consecutive module errors for a task and pauses it at the threshold
+func trackTaskModuleError(task *database.TaskFlow, req *models.TaskFlowStatusRequest) error {
+	if req.ModuleErrCode == 0 {
+		return database.ResetTaskModuleErrors(task.ID)
+	}
+	if task.Paused {
+		return nil
+	}
+
+	count, err := database.RecordTaskModuleError(task.ID)
+	if err != nil {
+		return err
+	}
+
+	threshold := getConfig().Tasks.ErrorThreshold
+	log.Printf("WARNING: Task %d module %q reported error %d (%d consecutive, pause threshold %d)",
+		task.ID, req.Module, req.ModuleErrCode, count, threshold)
+	if threshold == 0 || count < threshold {
+		return nil
+	}
+
+	reason := fmt.Sprintf("module %q reported error %d %d times in a row", req.Module, req.ModuleErrCode, count)
+	if err := database.PauseTaskFlow(task.ID, reason); err != nil {
+		return err
+	}
+	notifyTaskPaused(task, reason)
+	return nil
+}
+
+// notifyTaskPaused records a notification event so the pause shows up alongside device alarms
+func notifyTaskPaused(task *database.TaskFlow, reason string) {
+	event := &database.NotificationEvent{
+		RequestID:    fmt.Sprintf("task-paused-%d", task.ID),
+		DeviceEUI:    task.DeviceEUI,
+		Timestamp:    time.Now().UnixMilli(),
+		Text:         fmt.Sprintf("Task '%s' paused: %s", task.Headline, reason),
+		EventType:    database.EventTelemetry,
+		TLID:         task.ID,
+		TaskHeadline: task.Headline,
+		TaskPrompt:   task.TriggerCondition,
+	}
+	if err := database.SaveNotificationEvent(event); err != nil {
+		log.Printf("ERROR: Failed to save task pause notification: %v", err)
+	}
+}
+
+// TaskResumeHandler handles POST /api/tasks/{id}/resume
+// Un-pauses a task after the underlying device problem has been fixed.
+func TaskResumeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+
+	task, err := database.GetTaskFlowByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve task flow %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve task")
+		return
+	}
+	if task == nil {
+		writeError(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+
+	if err := database.ResumeTaskFlow(id); err != nil {
+		log.Printf("ERROR: Failed to resume task flow %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to resume task")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+// TaskFlowValidateHandler handles POST /api/taskflows/validate
+// The body is a task flow in the firmware's format (data.tl of view_task_detail, e.g. one
+// written by hand or exported from the SenseCraft app). The response lists its issues; valid
+// is false if any is an error, which the server checks for before it sends a flow to a device.
+func TaskFlowValidateHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, readBodyStatus(err), "failed to read task flow")
+		return
+	}
+
+	taskList, issues := models.ParseTaskList(body)
+	if taskList != nil {
+		issues = append(issues, taskList.Lint()...)
+	}
+
+	valid := true
+	for _, issue := range issues {
+		if issue.Severity == models.IssueError {
+			valid = false
+		}
+	}
+	if issues == nil {
+		issues = []models.Issue{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"valid":  valid,
+			"issues": issues,
+		},
+	})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// sensorThresholdRequest is the body of POST /api/devices/{eui}/thresholds and
+// PUT /api/devices/{eui}/thresholds/{id}
+type sensorThresholdRequest struct {
+	Metric  string   `json:"metric"` // temperature, humidity or co2
+	Above   *float64 `json:"above"`
+	Below   *float64 `json:"below"`
+	Enabled *bool    `json:"enabled"` // Default true; omitted on PUT keeps the current state
+}
+
+// DeviceThresholdsHandler handles GET /api/devices/{eui}/thresholds (list) and POST (create)
+// A sensor threshold, e.g. {"metric": "co2", "above": 1200}, stores a "threshold" event when
+// the device's readings cross it (and another when they are back inside it), which event
+// rules can then send on.
+func DeviceThresholdsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	if r.Method == http.MethodGet {
+		list, err := database.GetSensorThresholds(deviceEUI, false)
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve sensor thresholds for %s: %v", deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve thresholds")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": list})
+		return
+	}
+
+	t := &database.SensorThreshold{DeviceEUI: deviceEUI, Enabled: true}
+	if !decodeSensorThreshold(w, r, t) {
+		return
+	}
+	if err := database.CreateSensorThreshold(t); err != nil {
+		log.Printf("ERROR: Failed to create sensor threshold for %s: %v", deviceEUI, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save threshold")
+		return
+	}
+
+	log.Printf("Created sensor threshold %d for %s on %s", t.ID, deviceEUI, t.Metric)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"code": 201, "data": t})
+}
+
+// DeviceThresholdHandler handles PUT /api/devices/{eui}/thresholds/{id} (replace) and DELETE
+func DeviceThresholdHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid threshold ID")
+		return
+	}
+
+	t, err := database.GetSensorThreshold(deviceEUI, id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve sensor threshold %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve thresholds")
+		return
+	}
+	if t == nil {
+		writeError(w, r, http.StatusNotFound, "threshold not found")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := database.DeleteSensorThreshold(deviceEUI, id); err != nil {
+			log.Printf("ERROR: Failed to delete sensor threshold %d: %v", id, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to delete threshold")
+			return
+		}
+		log.Printf("Deleted sensor threshold %d of %s", id, deviceEUI)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	if !decodeSensorThreshold(w, r, t) {
+		return
+	}
+	found, err := database.UpdateSensorThreshold(t)
+	if err != nil {
+		log.Printf("ERROR: Failed to update sensor threshold %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to save threshold")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "threshold not found")
+		return
+	}
+
+	log.Printf("Updated sensor threshold %d of %s", id, deviceEUI)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": t})
+}
+
+// decodeSensorThreshold validates a sensorThresholdRequest body into t, writing a 400
+// response and returning false if it is invalid
+func decodeSensorThreshold(w http.ResponseWriter, r *http.Request, t *database.SensorThreshold) bool {
+	var req sensorThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return false
+	}
+
+	t.Metric = strings.ToLower(strings.TrimSpace(req.Metric))
+	if !slices.Contains(database.SensorMetrics, t.Metric) {
+		writeError(w, r, http.StatusBadRequest, "metric must be one of: %s", strings.Join(database.SensorMetrics, ", "))
+		return false
+	}
+
+	t.Above, t.Below = req.Above, req.Below
+	if t.Above == nil && t.Below == nil {
+		writeError(w, r, http.StatusBadRequest, "a threshold needs above or below")
+		return false
+	}
+	if t.Above != nil && t.Below != nil && *t.Below >= *t.Above {
+		writeError(w, r, http.StatusBadRequest, "below must be less than above")
+		return false
+	}
+
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+	return true
+}
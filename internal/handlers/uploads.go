@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// uploadTypes maps the content types accepted by the upload endpoint to their kind and file extension
+var uploadTypes = map[string]struct{ kind, ext string }{
+	"image/jpeg":               {database.UploadImage, ".jpg"},
+	"image/png":                {database.UploadImage, ".png"},
+	"audio/wav":                {database.UploadAudio, ".wav"},
+	"audio/x-wav":              {database.UploadAudio, ".wav"},
+	"audio/wave":               {database.UploadAudio, ".wav"},
+	"audio/mpeg":               {database.UploadAudio, ".mp3"},
+	"audio/ogg":                {database.UploadAudio, ".ogg"},
+	"text/plain":               {database.UploadLog, ".txt"},
+	"application/json":         {database.UploadLog, ".json"},
+	"application/gzip":         {database.UploadLog, ".gz"},
+	"application/octet-stream": {"", ".bin"}, // Raw PCM or binary logs; the kind must be given
+}
+
+// errUploadTooLarge reports an upload over the configured maximum
+var errUploadTooLarge = errors.New("upload too large")
+
+// uploadView is an upload as listed by the API, with its download URL relative to the API root
+type uploadView struct {
+	*database.DeviceUpload
+	URL string `json:"url"`
+}
+
+// UploadHandler handles /v2/watcher/upload POST requests
+// Devices post auxiliary files (camera images, short audio clips, logs) either as the raw
+// body with its Content-Type or as multipart/form-data with a "file" part. Query or form
+// fields: kind (image, audio or log; inferred from the content type if omitted),
+// event_id or request_id to link the file to a stored event, and filename.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+	maxBytes := getConfig().Limits.MaxUploadBytes
+
+	data, contentType, filename, err := readUpload(r, maxBytes)
+	if err != nil {
+		log.Printf("ERROR: Failed to read upload from device %s: %v", deviceEUI, err)
+		if errors.Is(err, errUploadTooLarge) {
+			http.Error(w, fmt.Sprintf("Upload exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read upload", readBodyStatus(err))
+		return
+	}
+	defer r.Body.Close()
+
+	if len(data) == 0 {
+		http.Error(w, "Upload is empty", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = strings.Split(http.DetectContentType(data), ";")[0]
+	}
+	uploadType, ok := uploadTypes[mediaType]
+	if !ok {
+		log.Printf("WARNING: Rejected upload from device %s with content type %q", deviceEUI, mediaType)
+		http.Error(w, fmt.Sprintf("Unsupported content type %q", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = uploadType.kind
+	}
+	if kind != database.UploadImage && kind != database.UploadAudio && kind != database.UploadLog {
+		http.Error(w, "kind must be image, audio or log", http.StatusBadRequest)
+		return
+	}
+	if uploadType.kind != "" && uploadType.kind != kind {
+		http.Error(w, fmt.Sprintf("Content type %q is not valid for kind %s", mediaType, kind), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if kind == database.UploadImage {
+		privacy := visionSettingsFor(getConfig(), deviceEUI).Privacy
+		if privacy != config.PrivacyOff && mediaType != "image/jpeg" {
+			http.Error(w, "Only JPEG images can be uploaded while privacy mode is on", http.StatusUnsupportedMediaType)
+			return
+		}
+		if data, err = maskJPEG(privacy, data, ""); err != nil {
+			log.Printf("ERROR: Failed to blur image upload from device %s: %v", deviceEUI, err)
+			http.Error(w, "Image could not be blurred for privacy mode", http.StatusBadRequest)
+			return
+		}
+	}
+
+	upload := &database.DeviceUpload{
+		DeviceEUI:   deviceEUI,
+		Kind:        kind,
+		ContentType: mediaType,
+		Filename:    filename[strings.LastIndexAny(filename, `/\`)+1:],
+		Size:        len(data),
+		EventID:     uploadEventID(r, deviceEUI),
+	}
+
+	upload.BlobKey = fmt.Sprintf("uploads/%s/%s-%s%s", deviceEUI, time.Now().Format("20060102-150405.000000"), kind, uploadType.ext)
+	if err := blobStore.Put(r.Context(), upload.BlobKey, data, mediaType); err != nil {
+		log.Printf("ERROR: Failed to store upload %s: %v", upload.BlobKey, err)
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.SaveDeviceUpload(upload); err != nil {
+		log.Printf("ERROR: Failed to save upload from device %s: %v", deviceEUI, err)
+		http.Error(w, "Failed to save upload", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Stored %s upload from device %s: %d bytes (%s), event=%d", kind, deviceEUI, upload.Size, mediaType, upload.EventID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"id":       upload.ID,
+			"kind":     upload.Kind,
+			"size":     upload.Size,
+			"event_id": upload.EventID,
+		},
+	})
+}
+
+// readUpload returns the uploaded file, its content type, and its filename from a raw or
+// multipart/form-data body, failing with errUploadTooLarge past maxBytes
+func readUpload(r *http.Request, maxBytes int64) ([]byte, string, string, error) {
+	contentType := r.Header.Get("Content-Type")
+	filename := r.URL.Query().Get("filename")
+
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", "", err
+		}
+		// The file part is read as it streams; form fields before it are kept for FormValue
+		r.Form = r.URL.Query()
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, "", "", errors.New("multipart body has no file part")
+			}
+			if err != nil {
+				return nil, "", "", err
+			}
+			if part.FormName() == "file" {
+				body = part
+				contentType = part.Header.Get("Content-Type")
+				if part.FileName() != "" {
+					filename = part.FileName()
+				}
+				break
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				return nil, "", "", err
+			}
+			r.Form.Set(part.FormName(), string(value))
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", "", errUploadTooLarge
+	}
+	return data, contentType, filename, nil
+}
+
+// uploadEventID resolves the event an upload belongs to from its event_id or request_id field.
+// Files for events that do not exist (or belong to another device) are stored unlinked.
+func uploadEventID(r *http.Request, deviceEUI string) int {
+	if idStr := r.FormValue("event_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err == nil {
+			event, err := database.GetNotificationEventByID(id)
+			if err != nil {
+				log.Printf("WARNING: Failed to look up event %d for upload: %v", id, err)
+				return 0
+			}
+			if event != nil && event.DeviceEUI == deviceEUI {
+				return id
+			}
+		}
+		log.Printf("WARNING: Upload from device %s names unknown event %q", deviceEUI, idStr)
+		return 0
+	}
+
+	if requestID := r.FormValue("request_id"); requestID != "" {
+		id, err := database.GetEventIDByRequestID(deviceEUI, requestID)
+		if err != nil {
+			log.Printf("WARNING: Failed to look up event for request %s: %v", requestID, err)
+		} else if id == 0 {
+			log.Printf("WARNING: Upload from device %s names unknown request %s", deviceEUI, requestID)
+		}
+		return id
+	}
+	return 0
+}
+
+// UploadsHandler handles GET /api/uploads?device_eui=&kind=&event_id=&since=24h&limit=50
+// Lists files uploaded by devices, newest first.
+func UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := database.UploadFilter{
+		DeviceEUI: q.Get("device_eui"),
+		Kind:      q.Get("kind"),
+		VisibleTo: auth.VisibleTo(r),
+	}
+	if es := q.Get("event_id"); es != "" {
+		id, err := strconv.Atoi(es)
+		if err != nil || id <= 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid event id")
+			return
+		}
+		filter.EventID = id
+	}
+
+	limit := 50
+	if ls := q.Get("limit"); ls != "" {
+		n, err := strconv.Atoi(ls)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	uploads, err := database.GetDeviceUploads(time.Now().Add(-window), filter, limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve device uploads: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve uploads")
+		return
+	}
+
+	views := make([]uploadView, 0, len(uploads))
+	for _, u := range uploads {
+		views = append(views, uploadView{DeviceUpload: u, URL: fmt.Sprintf("uploads/%d", u.ID)})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"count":   len(views),
+			"uploads": views,
+		},
+	})
+}
+
+// UploadFileHandler handles GET /api/uploads/{id}
+// Serves an uploaded file with the content type it was stored with.
+func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid upload id")
+		return
+	}
+
+	upload, err := database.GetDeviceUploadByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve device upload %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve upload")
+		return
+	}
+	if upload == nil || !auth.CanSeeDevice(r, upload.DeviceEUI) {
+		writeError(w, r, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	data, err := blobStore.Get(r.Context(), upload.BlobKey)
+	if err != nil {
+		log.Printf("ERROR: Failed to read upload %s: %v", upload.BlobKey, err)
+		writeError(w, r, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", upload.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if upload.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": upload.Filename}))
+	}
+	http.ServeContent(w, r, "", upload.CreatedAt, bytes.NewReader(data))
+}
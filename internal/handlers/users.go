@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/auth"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+	"github.com/gorilla/mux"
+)
+
+// userRequest is the body of user create/update requests. Omitted fields keep their
+// current value on update.
+type userRequest struct {
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Role     string    `json:"role"`
+	Devices  *[]string `json:"devices"`
+	Language *string   `json:"language"`
+}
+
+// validLanguage reports whether a requested language is empty (from the browser) or supported,
+// writing the error response if not
+func validLanguage(w http.ResponseWriter, r *http.Request, language *string) bool {
+	if language == nil || *language == "" || i18n.Supported(*language) {
+		return true
+	}
+	writeError(w, r, http.StatusBadRequest, "language must be one of: %s", languageCodes())
+	return false
+}
+
+// languageCodes lists the supported language codes for error messages
+func languageCodes() string {
+	codes := make([]string, 0, len(i18n.Languages))
+	for _, l := range i18n.Languages {
+		codes = append(codes, l.Code)
+	}
+	return strings.Join(codes, ", ")
+}
+
+// LoginHandler handles POST /api/login {"username": "...", "password": "..."}
+// Returns a session token to send as "Authorization: Bearer <token>".
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	// Sessions are stored in the database
+	if database.ReadOnly() {
+		writeError(w, r, http.StatusServiceUnavailable, "server is in read-only mode: use AUTH_TOKEN or an API key")
+		return
+	}
+
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	token, user, expires, err := auth.Login(req.Username, req.Password)
+	if err != nil {
+		log.Printf("ERROR: Login failed for %s: %v", req.Username, err)
+		writeError(w, r, http.StatusInternalServerError, "login failed")
+		return
+	}
+	if user == nil {
+		log.Printf("WARNING: Invalid login for %q from %s", req.Username, r.RemoteAddr)
+		writeError(w, r, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	log.Printf("User %s logged in", user.Username)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"token":      token,
+			"expires_at": expires,
+			"user":       user,
+		},
+	})
+}
+
+// LogoutHandler handles POST /api/logout, ending the session the request was made with
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := auth.Logout(r); err != nil {
+		log.Printf("ERROR: Logout failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "logout failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+}
+
+// MeHandler handles GET /api/me, showing the account the request is authenticated as, and
+// PUT /api/me {"language": "zh"}, which any account (viewers included) may use to set its own
+// language ("" = follow the browser)
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFrom(r)
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": user})
+		return
+	}
+
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Language == nil {
+		writeError(w, r, http.StatusBadRequest, "language is required")
+		return
+	}
+	if !validLanguage(w, r, req.Language) {
+		return
+	}
+	if user == nil || user.ID == 0 {
+		// AUTH_TOKEN and the open API have no account to store settings in
+		writeError(w, r, http.StatusBadRequest, "settings can only be stored for login accounts")
+		return
+	}
+
+	found, err := database.SetUserLanguage(user.ID, *req.Language)
+	if err != nil {
+		log.Printf("ERROR: Failed to update language of user %d: %v", user.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+
+	updated := *user
+	updated.Language = *req.Language
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": &updated})
+}
+
+// UsersHandler handles GET /api/users (list) and POST /api/users (create):
+// {"username": "alice", "password": "...", "role": "viewer", "devices": ["2CF7F1C0..."], "language": "zh"}
+func UsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		users, err := database.GetUsers()
+		if err != nil {
+			log.Printf("ERROR: Failed to retrieve users: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to retrieve users")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": users})
+		return
+	}
+
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		writeError(w, r, http.StatusBadRequest, "username and password are required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = database.RoleViewer
+	}
+	if !database.ValidRole(req.Role) {
+		writeError(w, r, http.StatusBadRequest, "role must be admin or viewer")
+		return
+	}
+	if !validLanguage(w, r, req.Language) {
+		return
+	}
+
+	existing, err := database.GetUserByUsername(req.Username)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up user %s: %v", req.Username, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to create user")
+		return
+	}
+	if existing != nil {
+		writeError(w, r, http.StatusConflict, "username already exists")
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("ERROR: Failed to hash password: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "failed to create user")
+		return
+	}
+
+	user := &database.User{Username: req.Username, PasswordHash: hash, Role: req.Role, Devices: []string{}}
+	if req.Devices != nil {
+		user.Devices = *req.Devices
+	}
+	if req.Language != nil {
+		user.Language = *req.Language
+	}
+	if err := database.CreateUser(user); err != nil {
+		log.Printf("ERROR: Failed to create user %s: %v", req.Username, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to create user")
+		return
+	}
+
+	log.Printf("Created %s user: %s", user.Role, user.Username)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"code": 201, "data": user})
+}
+
+// UserHandler handles PUT /api/users/{id} (change password, role, devices, or language) and
+// DELETE /api/users/{id}. Password and role changes end the user's sessions; the
+// last admin cannot be demoted or deleted.
+func UserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	user, err := database.GetUserByID(id)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve user %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to retrieve user")
+		return
+	}
+	if user == nil {
+		writeError(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+
+	var req userRequest
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if req.Role != "" && !database.ValidRole(req.Role) {
+			writeError(w, r, http.StatusBadRequest, "role must be admin or viewer")
+			return
+		}
+		if !validLanguage(w, r, req.Language) {
+			return
+		}
+	}
+
+	// Removing the last admin would lock everyone out of user management
+	if user.Role == database.RoleAdmin && (r.Method == http.MethodDelete || (req.Role != "" && req.Role != database.RoleAdmin)) {
+		admins, err := database.CountAdmins()
+		if err != nil {
+			log.Printf("ERROR: Failed to count admins: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to update user")
+			return
+		}
+		if admins <= 1 {
+			writeError(w, r, http.StatusConflict, "cannot remove the last admin")
+			return
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := database.DeleteUser(id); err != nil {
+			log.Printf("ERROR: Failed to delete user %d: %v", id, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to delete user")
+			return
+		}
+		log.Printf("Deleted user: %s", user.Username)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200})
+		return
+	}
+
+	endSessions := false
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Printf("ERROR: Failed to hash password: %v", err)
+			writeError(w, r, http.StatusInternalServerError, "failed to update user")
+			return
+		}
+		user.PasswordHash = hash
+		endSessions = true
+	}
+	if req.Role != "" && req.Role != user.Role {
+		user.Role = req.Role
+		endSessions = true
+	}
+	if req.Devices != nil {
+		user.Devices = *req.Devices
+	}
+	if req.Language != nil {
+		user.Language = *req.Language
+	}
+
+	if _, err := database.UpdateUser(user); err != nil {
+		log.Printf("ERROR: Failed to update user %d: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+	if endSessions {
+		if err := database.DeleteUserSessions(id); err != nil {
+			log.Printf("WARNING: Failed to end sessions of user %d: %v", id, err)
+		}
+	}
+
+	log.Printf("Updated user: %s", user.Username)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "data": user})
+}
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/detect"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
 	"github.com/brianhealey/sensecap-server/internal/models"
 )
 
@@ -20,48 +23,122 @@ func VisionHandler(w http.ResponseWriter, r *http.Request) {
 	deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
 	authToken := r.Header.Get("Authorization")
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("ERROR: Failed to read request body: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
+	// Decode the request, streaming the image out of its base64 string
+	jpegBuf := getBodyBuffer()
+	defer putBodyBuffer(jpegBuf)
+	req, err := decodeImageAnalyzerRequest(r.Body, jpegBuf)
 	defer r.Body.Close()
-
-	// Parse JSON request
-	var req models.ImageAnalyzerRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	if errors.Is(err, errInvalidVisionRequest) {
 		log.Printf("ERROR: Failed to parse JSON: %v", err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		log.Printf("ERROR: Failed to read request body: %v", err)
+		http.Error(w, "Failed to read request body", readBodyStatus(err))
+		return
+	}
+	jpegData := jpegBuf.Bytes()
 
 	// Log the request
-	logVisionRequest(r, deviceEUI, authToken, &req, body)
+	logVisionRequest(r, deviceEUI, authToken, req, len(jpegData))
 
 	// Validate request has image
-	if req.Img == "" {
+	if len(jpegData) == 0 {
 		log.Printf("ERROR: No image provided in request")
 		http.Error(w, "No image provided", http.StatusBadRequest)
 		return
 	}
 
+	// Use the device's release channel (canary devices get canary model overrides)
+	devCfg := getConfig().ForDevice(deviceEUI)
+	settings := visionSettingsFor(devCfg, deviceEUI)
+
+	// The frame is analyzed as sent, but only kept (as a snapshot, context frame or
+	// RECOGNIZE event) with the device's privacy mode applied
+	kept := maskImage(settings.Privacy, deviceEUI, jpegData, "")
+
+	// Keep the frame as context for alarm events of tasks that ask for it. It is copied, as
+	// the decoded image is in a pooled buffer.
+	if kept != nil {
+		recordContextFrame(deviceEUI, bytes.Clone(kept))
+	}
+
+	// Without image analysis (e.g. the lite profile), tasks rely on the device's own detection
+	// models, checked by the server's object detection model if one is loaded
+	if !devCfg.AI.VisionAnalysis {
+		state := 0
+		if req.Type == 1 && detect.Available() {
+			state = localDetectionState(devCfg, deviceEUI, req.Prompt, jpegData)
+		} else {
+			log.Println("Image analysis disabled, answering no event")
+		}
+		writeJSON(w, http.StatusOK, models.ImageAnalyzerResponse{
+			Code: 200,
+			Data: models.ImageAnalyzerResponseData{State: state, Type: req.Type, Audio: nextAnnouncementAudio(deviceEUI)},
+		})
+		return
+	}
+
 	// Use default prompt if none provided
 	prompt := req.Prompt
 	if prompt == "" {
-		prompt = "what's in the picture?"
+		prompt = settings.DefaultPrompt
+	}
+
+	// The device's active task can choose its own provider, and sets how sure it must be
+	task, taskErr := database.GetActiveTaskFlow(deviceEUI)
+	if taskErr != nil {
+		log.Printf("WARNING: Failed to load the active task of %s, using the device's vision provider: %v", deviceEUI, taskErr)
+	}
+	providerName, provider := visionProviderFor(settings, task)
+	model := provider.Model(devCfg)
+
+	analysisStart := time.Now()
+
+	// Reuse the analysis of a near-identical recent frame instead of calling the model again
+	cacheKey := visionCacheKey(deviceEUI, req.Type, model, prompt)
+	var fingerprint *imaging.Fingerprint
+	if devCfg.Cache.VisionTTL > 0 {
+		var err error
+		if fingerprint, err = imaging.FingerprintJPEG(jpegData); err != nil {
+			log.Printf("WARNING: Failed to fingerprint image, skipping vision cache: %v", err)
+		}
 	}
 
-	// Step 1: Analyze image with LLaVA
-	log.Println("Step 1: Analyzing image with LLaVA...")
-	analysis, err := analyzeImageWithLLaVA(req.Img, prompt)
+	// Step 1: Analyze image with the vision provider
+	var analysis string
+	cached := false
+	if fingerprint != nil {
+		var reason string
+		analysis, reason, cached = cachedVisionAnalysis(devCfg.Cache, cacheKey, fingerprint)
+		if cached {
+			log.Printf("Step 1: Reusing cached analysis (%s)", reason)
+		}
+	}
+	if !cached {
+		log.Printf("Step 1: Analyzing image with %s (%s)...", providerName, model)
+		analysis, err = provider.Analyze(devCfg, jpegData, prompt)
+	}
+	if errors.Is(err, errBackendUnavailable) {
+		// Answer "no event" right away so the device's task flow keeps running
+		log.Printf("WARNING: Image analysis skipped: %v", err)
+		writeJSON(w, http.StatusOK, models.ImageAnalyzerResponse{
+			Code: 200,
+			Data: models.ImageAnalyzerResponseData{State: 0, Type: req.Type, Audio: nextAnnouncementAudio(deviceEUI)},
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: Image analysis failed: %v", err)
 		http.Error(w, "Image analysis failed", http.StatusInternalServerError)
 		return
 	}
+	analysisDuration := time.Since(analysisStart)
 	log.Printf("Analysis result: '%s'", analysis)
+	if !cached && fingerprint != nil {
+		storeVisionAnalysis(devCfg.Cache, cacheKey, fingerprint, analysis)
+	}
 
 	// Step 2: Determine if event should be triggered
 	// For monitoring mode (type=1), we need to determine if the condition is met
@@ -69,25 +146,7 @@ func VisionHandler(w http.ResponseWriter, r *http.Request) {
 
 	if req.Type == 1 {
 		// MONITORING mode - analyze if the prompt condition is met
-		// Look for positive indicators in the analysis response
-		analysisLower := strings.ToLower(analysis)
-
-		// Check if LLaVA gave a positive response
-		isPositive := strings.Contains(analysisLower, "yes") ||
-			strings.Contains(analysisLower, "there is") ||
-			strings.Contains(analysisLower, "i can see") ||
-			strings.Contains(analysisLower, "visible") ||
-			strings.Contains(analysisLower, "present") ||
-			strings.Contains(analysisLower, "wearing") ||
-			strings.Contains(analysisLower, "detected")
-
-		isNegative := strings.Contains(analysisLower, "no") ||
-			strings.Contains(analysisLower, "not") ||
-			strings.Contains(analysisLower, "cannot") ||
-			strings.Contains(analysisLower, "can't") ||
-			strings.Contains(analysisLower, "unable")
-
-		if isPositive && !isNegative {
+		if taskMatch(provider, task, analysis) {
 			state = 1 // Event detected!
 			log.Printf("MONITORING MODE: Event detected! Analysis indicates positive match.")
 		} else {
@@ -96,6 +155,19 @@ func VisionHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// RECOGNIZE mode - just analysis, no event triggering
 		log.Printf("RECOGNIZE MODE: Analysis complete, no event triggering.")
+		analysis = truncateAnswer(analysis, settings.RecognizeMaxChars)
+		if settings.StoreRecognize {
+			saveRecognizeResult(deviceEUI, analysis, kept)
+		}
+	}
+
+	kind := "recognize"
+	if req.Type == 1 {
+		kind = "monitoring"
+	}
+	// Cache hits are not model inferences and would skew the channel latency stats
+	if !cached {
+		recordInferenceMetric(devCfg, deviceEUI, kind, model, analysisDuration, state == 1)
 	}
 
 	// Step 3: Optionally synthesize speech with Piper TTS
@@ -112,6 +184,11 @@ func VisionHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Otherwise the reply carries the next announcement queued for the device, if any
+	if audioBase64 == nil {
+		audioBase64 = nextAnnouncementAudio(deviceEUI)
+	}
+
 	// Prepare response
 	response := models.ImageAnalyzerResponse{
 		Code: 200,
@@ -130,7 +207,7 @@ func VisionHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Vision analysis complete. State=%d, Analysis: %s", state, analysis)
 }
 
-func logVisionRequest(r *http.Request, deviceEUI, authToken string, req *models.ImageAnalyzerRequest, rawBody []byte) {
+func logVisionRequest(r *http.Request, deviceEUI, authToken string, req *models.ImageAnalyzerRequest, jpegBytes int) {
 	log.Println("================================================================================")
 	log.Println("IMAGE ANALYZER REQUEST RECEIVED")
 	log.Println("================================================================================")
@@ -174,75 +251,64 @@ func logVisionRequest(r *http.Request, deviceEUI, authToken string, req *models.
 		log.Println("Audio Text:  (empty)")
 	}
 
-	imgLen := len(req.Img)
-	if imgLen > 0 {
-		log.Printf("Image:       %d bytes (base64-encoded JPEG)", imgLen)
-
-		// Estimate decoded size (base64 is ~33% larger than binary)
-		estimatedBytes := (imgLen * 3) / 4
-		log.Printf("             ~%d KB decoded", estimatedBytes/1024)
+	if jpegBytes > 0 {
+		log.Printf("Image:       %d bytes JPEG (decoded from base64)", jpegBytes)
 	} else {
 		log.Println("Image:       (empty)")
 	}
 
-	// Log raw JSON for debugging
+	// Log the JSON for debugging, rebuilt from the decoded fields (the body and the image
+	// string are not kept)
 	log.Println("--------------------------------------------------------------------------------")
-	log.Println("RAW JSON REQUEST")
+	log.Println("JSON REQUEST")
 	log.Println("--------------------------------------------------------------------------------")
 
-	// Pretty print JSON (but truncate the image field for readability)
-	var prettyJSON map[string]interface{}
-	if err := json.Unmarshal(rawBody, &prettyJSON); err == nil {
-		// Truncate image for display
-		if img, ok := prettyJSON["img"].(string); ok && len(img) > 100 {
-			prettyJSON["img"] = fmt.Sprintf("%s... (%d bytes total)", img[:100], len(img))
-		}
-
-		if formatted, err := json.MarshalIndent(prettyJSON, "", "  "); err == nil {
-			fmt.Println(string(formatted))
-		}
+	// Pretty print JSON
+	if formatted, err := json.MarshalIndent(req, "", "  "); err == nil {
+		fmt.Println(string(formatted))
 	}
 
 	log.Println("================================================================================")
 	log.Println()
 }
 
-// analyzeImageWithLLaVA sends base64-encoded image to Ollama's LLaVA model for analysis
-func analyzeImageWithLLaVA(imageBase64, prompt string) (string, error) {
-	// Prepare request for Ollama LLaVA API
-	requestBody := map[string]interface{}{
-		"model":  cfg.AI.LLaVAModel,
-		"prompt": prompt,
-		"images": []string{imageBase64},
-		"stream": false,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal LLaVA request: %w", err)
-	}
-
-	// Send request to Ollama
-	ollamaURL := cfg.AI.OllamaURL + "/api/generate"
-	resp, err := http.Post(ollamaURL, "application/json", bytes.NewReader(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to call LLaVA: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LLaVA returned %d: %s", resp.StatusCode, string(body))
+// saveRecognizeResult stores a RECOGNIZE mode answer and its image (nil = none) as an event
+func saveRecognizeResult(deviceEUI, analysis string, jpegData []byte) {
+	var img string
+	if jpegData != nil {
+		img = base64.StdEncoding.EncodeToString(jpegData)
 	}
-
-	// Parse response
-	var result struct {
-		Response string `json:"response"`
+	event := &database.NotificationEvent{
+		DeviceEUI: deviceEUI,
+		Timestamp: time.Now().UnixMilli(),
+		Text:      analysis,
+		Img:       img,
+		EventType: database.EventInteraction,
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode LLaVA response: %w", err)
+	if err := database.SaveNotificationEvent(event); err != nil {
+		log.Printf("WARNING: Failed to save RECOGNIZE result: %v", err)
 	}
+}
 
-	return result.Response, nil
+// monitoringMatch reports whether a vision model's answer to a monitoring prompt says the condition
+// is met: it must contain a positive indicator and no negative one
+func monitoringMatch(analysis string) bool {
+	analysisLower := strings.ToLower(analysis)
+
+	// Check if the model gave a positive response
+	isPositive := strings.Contains(analysisLower, "yes") ||
+		strings.Contains(analysisLower, "there is") ||
+		strings.Contains(analysisLower, "i can see") ||
+		strings.Contains(analysisLower, "visible") ||
+		strings.Contains(analysisLower, "present") ||
+		strings.Contains(analysisLower, "wearing") ||
+		strings.Contains(analysisLower, "detected")
+
+	isNegative := strings.Contains(analysisLower, "no") ||
+		strings.Contains(analysisLower, "not") ||
+		strings.Contains(analysisLower, "cannot") ||
+		strings.Contains(analysisLower, "can't") ||
+		strings.Contains(analysisLower, "unable")
+
+	return isPositive && !isNegative
 }
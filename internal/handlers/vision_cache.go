@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+)
+
+// visionCacheEntries caps the analyzed frames remembered per device and prompt
+const visionCacheEntries = 16
+
+// visionCacheEntry is a LLaVA analysis of one frame
+type visionCacheEntry struct {
+	fp       *imaging.Fingerprint
+	analysis string
+	at       time.Time
+}
+
+var (
+	visionCacheMu sync.Mutex
+	visionCache   = make(map[string][]*visionCacheEntry) // Newest entry last
+)
+
+// visionCacheKey scopes cached analyses to one device, task type, model, and prompt
+func visionCacheKey(deviceEUI string, taskType int, model, prompt string) string {
+	return fmt.Sprintf("%s|%d|%s|%s", deviceEUI, taskType, model, prompt)
+}
+
+// cachedVisionAnalysis returns a cached analysis for a frame that barely differs from the
+// last analyzed frame (frame-difference pre-filter) or whose perceptual hash is close to
+// any analyzed frame within the TTL. Entries are not refreshed on a hit, so a static scene
+// is still re-analyzed once per TTL.
+func cachedVisionAnalysis(settings config.CacheConfig, key string, fp *imaging.Fingerprint) (analysis, reason string, ok bool) {
+	if settings.VisionTTL <= 0 {
+		return "", "", false
+	}
+
+	visionCacheMu.Lock()
+	defer visionCacheMu.Unlock()
+
+	entries := pruneVisionEntries(visionCache[key], time.Now().Add(-settings.VisionTTL))
+	visionCache[key] = entries
+	if len(entries) == 0 {
+		return "", "", false
+	}
+
+	last := entries[len(entries)-1]
+	if diff := fp.Difference(last.fp); diff < settings.VisionMinChange {
+		return last.analysis, fmt.Sprintf("frame changed %.1f%%", diff), true
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if d := fp.HashDistance(entries[i].fp); d <= settings.VisionHashDistance {
+			return entries[i].analysis, fmt.Sprintf("hash distance %d", d), true
+		}
+	}
+	return "", "", false
+}
+
+// storeVisionAnalysis remembers the analysis of a frame
+func storeVisionAnalysis(settings config.CacheConfig, key string, fp *imaging.Fingerprint, analysis string) {
+	if settings.VisionTTL <= 0 {
+		return
+	}
+
+	visionCacheMu.Lock()
+	defer visionCacheMu.Unlock()
+
+	now := time.Now()
+	entries := pruneVisionEntries(visionCache[key], now.Add(-settings.VisionTTL))
+	entries = append(entries, &visionCacheEntry{fp: fp, analysis: analysis, at: now})
+	if len(entries) > visionCacheEntries {
+		entries = entries[len(entries)-visionCacheEntries:]
+	}
+	visionCache[key] = entries
+
+	// Drop keys of devices and prompts that are no longer in use
+	for k, e := range visionCache {
+		if len(e) == 0 || e[len(e)-1].at.Before(now.Add(-settings.VisionTTL)) {
+			delete(visionCache, k)
+		}
+	}
+}
+
+// pruneVisionEntries drops entries analyzed before cutoff
+func pruneVisionEntries(entries []*visionCacheEntry, cutoff time.Time) []*visionCacheEntry {
+	for len(entries) > 0 && entries[0].at.Before(cutoff) {
+		entries = entries[1:]
+	}
+	return entries
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/detect"
+)
+
+// VisionProvider analyzes the images of the image analyzer. Providers trade accuracy, cost and
+// latency: LLaVA on Ollama answers any prompt locally, GPT-4o answers better at a price per
+// image, and the YOLO detector only finds objects, but does so in milliseconds on a CPU.
+type VisionProvider interface {
+	// Model names what answers, for the vision cache and the inference metrics
+	Model(c *config.Config) string
+	// Analyze answers prompt about a JPEG
+	Analyze(c *config.Config, jpegData []byte, prompt string) (string, error)
+	// Match reports whether an answer to a monitoring prompt says the condition is met
+	Match(analysis string) bool
+}
+
+// visionProviders maps the names of config.VisionProviders to their implementation
+var visionProviders = map[string]VisionProvider{
+	config.VisionOllama:   ollamaVision{},
+	config.VisionOpenAI:   openAIVision{},
+	config.VisionDetector: detectorVision{},
+}
+
+// visionProviderFor returns the provider analyzing a device's images: the one chosen by its
+// active task, if any, otherwise the device's (settings are the device's vision settings)
+func visionProviderFor(settings config.VisionConfig, task *database.TaskFlow) (string, VisionProvider) {
+	name := settings.Provider
+	if task != nil && task.VisionProvider != "" {
+		name = task.VisionProvider
+	}
+	if provider, ok := visionProviders[name]; ok {
+		return name, provider
+	}
+	return config.VisionOllama, visionProviders[config.VisionOllama]
+}
+
+// checkVisionProvider validates a provider chosen through the API, writing the error
+func checkVisionProvider(w http.ResponseWriter, r *http.Request, name string) bool {
+	if !config.ValidVisionProvider(name) {
+		writeError(w, r, http.StatusBadRequest, "provider must be one of: %s", strings.Join(config.VisionProviders, ", "))
+		return false
+	}
+	if name == config.VisionDetector && getConfig().AI.DetectorURL == "" {
+		writeError(w, r, http.StatusBadRequest, "the detector provider needs the server's detector URL (-detector-url)")
+		return false
+	}
+	return true
+}
+
+// ollamaVision asks LLaVA on Ollama
+type ollamaVision struct{}
+
+func (ollamaVision) Model(c *config.Config) string { return c.AI.LLaVAModel }
+
+func (ollamaVision) Match(analysis string) bool { return monitoringMatch(analysis) }
+
+func (ollamaVision) Analyze(c *config.Config, jpegData []byte, prompt string) (string, error) {
+	// Prepare request for Ollama LLaVA API
+	requestBody := map[string]interface{}{
+		"model":  c.AI.LLaVAModel,
+		"prompt": prompt,
+		"images": [][]byte{jpegData}, // Marshaled base64-encoded, as Ollama takes images
+		"stream": false,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal LLaVA request: %w", err)
+	}
+
+	// Send request to Ollama
+	ollamaURL := c.AI.OllamaURL + "/api/generate"
+	resp, err := ollamaBackend.post(ollamaURL, "application/json", jsonData)
+	if err != nil {
+		return "", fmt.Errorf("failed to call LLaVA: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("LLaVA returned %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	// Parse response
+	var result struct {
+		Response string `json:"response"`
+	}
+
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode LLaVA response: %w", err)
+	}
+
+	return result.Response, nil
+}
+
+// openAIVision asks a vision model (GPT-4o by default) on an OpenAI-compatible chat
+// completions API
+type openAIVision struct{}
+
+// openAIMaxTokens bounds the answer: monitoring answers are a sentence, and tokens are billed
+const openAIMaxTokens = 300
+
+func (openAIVision) Model(c *config.Config) string { return c.AI.OpenAIVisionModel }
+
+func (openAIVision) Match(analysis string) bool { return monitoringMatch(analysis) }
+
+func (openAIVision) Analyze(c *config.Config, jpegData []byte, prompt string) (string, error) {
+	requestBody := map[string]interface{}{
+		"model":      c.AI.OpenAIVisionModel,
+		"max_tokens": openAIMaxTokens,
+		"messages": []map[string]interface{}{{
+			"role": "user",
+			"content": []map[string]interface{}{
+				{"type": "text", "text": prompt},
+				{"type": "image_url", "image_url": map[string]string{"url": "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpegData)}},
+			},
+		}},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal OpenAI request: %w", err)
+	}
+
+	resp, err := openaiBackend.post(strings.TrimSuffix(c.AI.OpenAIURL, "/")+"/chat/completions", "application/json", jsonData)
+	if err != nil {
+		return "", fmt.Errorf("failed to call OpenAI: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OpenAI returned %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode OpenAI response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("OpenAI returned no answer")
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// authorizeOpenAI sends the configured API key with calls to the OpenAI API
+func authorizeOpenAI(req *http.Request) {
+	if key := getConfig().AI.OpenAIKey; key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// detectorVision runs the YOLO object detector of the audio service. It cannot read a
+// prompt: the objects it looks for are the classes the prompt names ("Is there a delivery
+// driver at the door?" looks for a person), and its answer says which were detected.
+type detectorVision struct{}
+
+func (detectorVision) Model(c *config.Config) string { return config.VisionDetector }
+
+// Match reports whether the detector found an object the prompt asked about
+func (detectorVision) Match(analysis string) bool { return strings.HasPrefix(analysis, "Yes") }
+
+func (detectorVision) Analyze(c *config.Config, jpegData []byte, prompt string) (string, error) {
+	if c.AI.DetectorURL == "" {
+		return "", fmt.Errorf("detector: no detector URL is configured: %w", errBackendUnavailable)
+	}
+
+	resp, err := detectorBackend.post(strings.TrimSuffix(c.AI.DetectorURL, "/")+"/detect", "image/jpeg", jpegData)
+	if err != nil {
+		return "", fmt.Errorf("failed to call the detector: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("detector returned %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var result struct {
+		Detections []detect.Detection `json:"detections"`
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode detector response: %w", err)
+	}
+	return describeDetections(result.Detections, classesInText(prompt)), nil
+}
+
+// describeDetections phrases detections as an answer. With targets (a monitoring prompt),
+// the answer is a verdict: "Yes" with the best confidence of the targets detected ("Yes 87:
+// detected 1 dog.") or "No" when none was; without, it lists everything detected.
+func describeDetections(detections []detect.Detection, targets []string) string {
+	counts := make(map[string]int)
+	var classes []string
+	best := 0.0
+	for _, d := range detections {
+		if len(targets) > 0 && !slices.Contains(targets, d.Class) {
+			continue
+		}
+		if counts[d.Class] == 0 {
+			classes = append(classes, d.Class)
+		}
+		counts[d.Class]++
+		best = max(best, d.Confidence)
+	}
+
+	found := make([]string, len(classes))
+	for i, class := range classes {
+		found[i] = fmt.Sprintf("%d %s", counts[class], class)
+	}
+
+	switch {
+	case len(targets) == 0 && len(found) == 0:
+		return "No objects detected."
+	case len(targets) == 0:
+		return "Detected " + strings.Join(found, ", ") + "."
+	case len(found) == 0:
+		return "No: no " + strings.Join(targets, " or ") + " detected."
+	}
+	return fmt.Sprintf("Yes %.0f: detected %s.", best*100, strings.Join(found, ", "))
+}
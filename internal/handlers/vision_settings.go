@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// visionSettingsFor returns the vision settings of a device: the global settings
+// with the device's own overrides applied
+func visionSettingsFor(c *config.Config, deviceEUI string) config.VisionConfig {
+	settings := c.Vision
+
+	overrides, err := database.GetDeviceVisionSettings(deviceEUI)
+	if err != nil {
+		log.Printf("WARNING: Failed to load vision settings for %s, using global settings: %v", deviceEUI, err)
+		return settings
+	}
+	if overrides == nil {
+		return settings
+	}
+
+	if overrides.DefaultPrompt != nil {
+		settings.DefaultPrompt = *overrides.DefaultPrompt
+	}
+	if overrides.RecognizeMaxChars != nil {
+		settings.RecognizeMaxChars = *overrides.RecognizeMaxChars
+	}
+	if overrides.StoreRecognize != nil {
+		settings.StoreRecognize = *overrides.StoreRecognize
+	}
+	if overrides.Privacy != nil {
+		settings.Privacy = *overrides.Privacy
+	}
+	if overrides.Provider != nil {
+		settings.Provider = *overrides.Provider
+	}
+	return settings
+}
+
+// truncateAnswer shortens text to at most maxChars characters (0 = unlimited), ending at
+// the last full sentence if one fits in the second half of the limit, otherwise at a word
+func truncateAnswer(text string, maxChars int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return string(runes)
+	}
+
+	cut := string(runes[:maxChars])
+	if i := strings.LastIndexAny(cut, ".!?"); i >= len(cut)/2 {
+		return cut[:i+1]
+	}
+
+	// Leave room for the ellipsis
+	cut = string(runes[:max(maxChars-3, 0)])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:") + "..."
+}
+
+// DeviceVisionSettingsHandler handles GET/PUT/DELETE /api/devices/{eui}/vision
+// GET shows the global settings, the device's overrides, and the effective result.
+// PUT replaces the overrides: {"default_prompt": "...", "recognize_max_chars": 120, "store_recognize": true, "privacy": "people", "provider": "openai"}
+// (omitted or null fields inherit the global setting). DELETE removes them.
+func DeviceVisionSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceEUI := mux.Vars(r)["eui"]
+
+	switch r.Method {
+	case http.MethodPut:
+		var overrides database.DeviceVisionSettings
+		if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if overrides.DefaultPrompt != nil && strings.TrimSpace(*overrides.DefaultPrompt) == "" {
+			writeError(w, r, http.StatusBadRequest, "default_prompt cannot be empty (use null to inherit)")
+			return
+		}
+		if overrides.RecognizeMaxChars != nil && *overrides.RecognizeMaxChars < 0 {
+			writeError(w, r, http.StatusBadRequest, "recognize_max_chars cannot be negative")
+			return
+		}
+		if overrides.Privacy != nil && !config.ValidPrivacy(*overrides.Privacy) {
+			writeError(w, r, http.StatusBadRequest, "privacy must be one of: %s", strings.Join([]string{config.PrivacyOff, config.PrivacyPeople, config.PrivacyFull}, ", "))
+			return
+		}
+		if overrides.Provider != nil && !checkVisionProvider(w, r, *overrides.Provider) {
+			return
+		}
+
+		overrides.DeviceEUI = deviceEUI
+		if err := database.SaveDeviceVisionSettings(&overrides); err != nil {
+			log.Printf("ERROR: Failed to save vision settings for %s: %v", deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to save vision settings")
+			return
+		}
+		log.Printf("Updated vision settings for %s", deviceEUI)
+
+	case http.MethodDelete:
+		found, err := database.DeleteDeviceVisionSettings(deviceEUI)
+		if err != nil {
+			log.Printf("ERROR: Failed to delete vision settings for %s: %v", deviceEUI, err)
+			writeError(w, r, http.StatusInternalServerError, "failed to delete vision settings")
+			return
+		}
+		if !found {
+			writeError(w, r, http.StatusNotFound, "device has no vision settings")
+			return
+		}
+		log.Printf("Removed vision settings for %s", deviceEUI)
+	}
+
+	overrides, err := database.GetDeviceVisionSettings(deviceEUI)
+	if err != nil {
+		log.Printf("ERROR: Failed to load vision settings for %s: %v", deviceEUI, err)
+		writeError(w, r, http.StatusInternalServerError, "failed to load vision settings")
+		return
+	}
+
+	c := getConfig()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"data": map[string]interface{}{
+			"global":    visionSettingsJSON(c.Vision),
+			"device":    overrides,
+			"effective": visionSettingsJSON(visionSettingsFor(c, deviceEUI)),
+		},
+	})
+}
+
+// visionSettingsJSON renders vision settings with the API's field names
+func visionSettingsJSON(s config.VisionConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"default_prompt":      s.DefaultPrompt,
+		"recognize_max_chars": s.RecognizeMaxChars,
+		"store_recognize":     s.StoreRecognize,
+		"privacy":             s.Privacy,
+		"provider":            s.Provider,
+	}
+}
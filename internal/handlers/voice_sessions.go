@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+// voiceState is where a device's voice conversation is
+type voiceState int
+
+const (
+	voiceListening  voiceState = iota // Waiting for a new request
+	voiceConfirming                   // A draft task was read back and waits for yes or no
+	voiceExecuting                    // The confirmed draft is being activated
+)
+
+func (s voiceState) String() string {
+	switch s {
+	case voiceConfirming:
+		return "confirming"
+	case voiceExecuting:
+		return "executing"
+	}
+	return "listening"
+}
+
+// voiceSession is the server-side state of a device's multi-turn voice interaction
+type voiceSession struct {
+	state     voiceState
+	sessionID string             // Session-Id of the request that last changed the state
+	pending   *database.TaskFlow // Draft task waiting for confirmation
+	verified  *taskVerification  // Result of the draft's verification capture, if any
+	updatedAt time.Time
+}
+
+var (
+	voiceSessionsMu sync.Mutex
+	voiceSessions   = make(map[string]*voiceSession) // By device EUI
+)
+
+// Confirmation answers. Follow-ups are matched to the device's conversation rather
+// than its Session-Id header, which can change between button presses.
+var (
+	confirmYes = regexp.MustCompile(`\b(yes|yeah|yep|yup|sure|ok|okay|confirm|correct|please do|do it|go ahead|create it|sounds good)\b`)
+	confirmNo  = regexp.MustCompile(`\b(no|nope|cancel|stop|don't|do not|not now|never mind|nevermind|forget it)\b`)
+	// The whole reply must ask for a test, so "check if the door is open" stays a new request
+	confirmTest = regexp.MustCompile(`^(test|try|check|verify|preview)( it| that| this)?( first| now)?$`)
+)
+
+// voiceSessionFor returns the device's conversation, starting over (and dropping the draft)
+// when a pending confirmation has waited longer than the configured window
+func voiceSessionFor(deviceEUI, sessionID string) *voiceSession {
+	voiceSessionsMu.Lock()
+	defer voiceSessionsMu.Unlock()
+
+	s, ok := voiceSessions[deviceEUI]
+	if !ok {
+		s = &voiceSession{}
+		voiceSessions[deviceEUI] = s
+	}
+	if s.state != voiceListening && time.Since(s.updatedAt) > getConfig().Tasks.ConfirmWindow {
+		log.Printf("Voice session of %s: confirmation of '%s' timed out", deviceEUI, s.pending.Headline)
+		if err := database.DeleteTaskFlow(s.pending.ID); err != nil {
+			log.Printf("WARNING: Failed to delete expired draft task %d: %v", s.pending.ID, err)
+		}
+		s.state = voiceListening
+		s.pending = nil
+		s.verified = nil
+	}
+
+	// Hand out a copy; changes go through setVoiceState
+	snapshot := *s
+	snapshot.sessionID = sessionID
+	return &snapshot
+}
+
+// setVoiceState moves the device's conversation to a new state
+func setVoiceState(deviceEUI, sessionID string, state voiceState, pending *database.TaskFlow) {
+	voiceSessionsMu.Lock()
+	defer voiceSessionsMu.Unlock()
+
+	s, ok := voiceSessions[deviceEUI]
+	if !ok {
+		s = &voiceSession{}
+		voiceSessions[deviceEUI] = s
+	}
+	if s.state != state {
+		log.Printf("Voice session of %s (session %s): %s -> %s", deviceEUI, sessionID, s.state, state)
+	}
+	if pending == nil || s.pending == nil || pending.ID != s.pending.ID {
+		s.verified = nil
+	}
+	s.state = state
+	s.sessionID = sessionID
+	s.pending = pending
+	s.updatedAt = time.Now()
+}
+
+// pendingTask returns the draft the device's conversation waits to have confirmed (nil if
+// none), its verification result and when the confirmation window closes
+func pendingTask(deviceEUI string) (*database.TaskFlow, *taskVerification, time.Time) {
+	session := voiceSessionFor(deviceEUI, "")
+	if session.state != voiceConfirming {
+		return nil, nil, time.Time{}
+	}
+	return session.pending, session.verified, session.updatedAt.Add(getConfig().Tasks.ConfirmWindow)
+}
+
+// recordVerification keeps a draft's verification result in the device's conversation, unless
+// the draft was confirmed or replaced in the meantime
+func recordVerification(deviceEUI string, draftID int, v *taskVerification) {
+	voiceSessionsMu.Lock()
+	defer voiceSessionsMu.Unlock()
+
+	if s, ok := voiceSessions[deviceEUI]; ok && s.state == voiceConfirming && s.pending.ID == draftID {
+		s.verified = v
+	}
+}
+
+// awaitingConfirmation reports whether the device's conversation waits for a yes or no
+func awaitingConfirmation(deviceEUI string) bool {
+	return voiceSessionFor(deviceEUI, "").state == voiceConfirming
+}
+
+// confirmationAnswer classifies a reply to a task read-back: 1 = yes, -1 = no,
+// 2 = test the task first, 0 = neither (a new request)
+func confirmationAnswer(transcription string) int {
+	text := strings.ToLower(strings.TrimSpace(transcription))
+	text = strings.Trim(text, ".,!?;: ")
+	switch {
+	case confirmTest.MatchString(text):
+		return 2
+	case confirmNo.MatchString(text):
+		return -1
+	case confirmYes.MatchString(text):
+		return 1
+	}
+	return 0
+}
+
+// taskReadBack asks the user to confirm a draft task, mentioning the task it would replace
+func taskReadBack(draft *database.TaskFlow, current *database.TaskFlow) string {
+	if current != nil {
+		return fmt.Sprintf("I'll create a monitoring task: %s. I'll watch for %s. This replaces your current task: %s. Should I create it?",
+			draft.Headline, taskWatchText(draft), current.Headline)
+	}
+	return fmt.Sprintf("I'll create a monitoring task: %s. I'll watch for %s. Should I create it?", draft.Headline, taskWatchText(draft))
+}
+
+// verificationText tells the user how a draft task judged the current camera view
+func verificationText(v *taskVerification) string {
+	analysis := strings.TrimRight(strings.TrimSpace(v.Analysis), ".!? ")
+	if v.Triggered {
+		return fmt.Sprintf("I tested it on the camera's latest picture and it would alert right now: %s. Should I create it?", analysis)
+	}
+	return fmt.Sprintf("I tested it on the camera's latest picture and it would not alert right now: %s. Should I create it?", analysis)
+}
+
+// talkTask describes a task for the voice reply metadata
+func talkTask(tf *database.TaskFlow, current *database.TaskFlow) *models.TalkTask {
+	task := &models.TalkTask{
+		TLID:     tf.ID,
+		Headline: tf.Headline,
+		Trigger:  tf.TriggerCondition,
+		Status:   models.TaskActive,
+	}
+	if tf.Draft {
+		task.Status = models.TaskDraft
+	}
+	if current != nil {
+		task.Replaces = current.Headline
+	}
+	return task
+}
+
+// Replies to a task confirmation
+const (
+	taskCancelledText = "Okay, I won't create that task."                                  // The user declined
+	taskFailedText    = "Sorry, I couldn't create that task. Please ask again."            // The draft could not be activated
+	taskUntestedText  = "Sorry, I couldn't test that task: %s. Should I create it anyway?" // The verification capture failed
+)
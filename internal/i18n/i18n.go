@@ -0,0 +1,126 @@
+// Package i18n translates the management API's and dashboard's user-visible messages.
+// English is the source language: messages are written in English in the code and the
+// English text is the key into each locale's bundle (locales/<code>.json). Messages missing
+// from a bundle stay in English, so a new message never breaks a translation.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the source language, used when no supported language is requested
+const Default = "en"
+
+// Language is a supported language
+type Language struct {
+	Code string `json:"code"` // ISO 639-1 code, e.g. "zh"
+	Name string `json:"name"` // Name in the language itself
+}
+
+// Languages lists the supported languages, the default first
+var Languages = []Language{
+	{Code: "en", Name: "English"},
+	{Code: "zh", Name: "中文"},
+}
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// bundles maps a language code to its translations, keyed by the English text
+var bundles = loadBundles()
+
+// loadBundles reads the embedded locale bundles. A broken bundle is a build mistake, so it
+// is logged and its language falls back to English rather than stopping the server.
+func loadBundles() map[string]map[string]string {
+	bundles := make(map[string]map[string]string)
+	for _, lang := range Languages {
+		if lang.Code == Default {
+			continue
+		}
+		data, err := localeFiles.ReadFile("locales/" + lang.Code + ".json")
+		if err != nil {
+			log.Printf("WARNING: Missing locale bundle for %s: %v", lang.Code, err)
+			continue
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			log.Printf("WARNING: Invalid locale bundle for %s: %v", lang.Code, err)
+			continue
+		}
+		bundles[lang.Code] = messages
+	}
+	return bundles
+}
+
+// Supported reports whether lang is a supported language code
+func Supported(lang string) bool {
+	for _, l := range Languages {
+		if l.Code == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate returns message in lang, or unchanged if the bundle has no translation for it
+func Translate(lang, message string) string {
+	if translated, ok := bundles[lang][message]; ok && translated != "" {
+		return translated
+	}
+	return message
+}
+
+// Sprintf translates format and then formats it with args like fmt.Sprintf.
+// Without args, format is returned translated but not formatted.
+func Sprintf(lang, format string, args ...interface{}) string {
+	format = Translate(lang, format)
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Messages returns the bundle of lang (empty for English), for clients that translate themselves
+func Messages(lang string) map[string]string {
+	if messages := bundles[lang]; messages != nil {
+		return messages
+	}
+	return map[string]string{}
+}
+
+// Negotiate picks the supported language an Accept-Language header prefers most,
+// matching on the primary subtag ("zh-CN" selects "zh"). Returns Default if none match.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		code string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		code, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if !Supported(code) {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{code, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return Default
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].code
+}
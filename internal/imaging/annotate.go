@@ -0,0 +1,228 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+// Box is a detection to draw on an image
+type Box struct {
+	Rect  image.Rectangle // In image pixels; clipped to the image
+	Label string          // e.g. "person 87%"; drawn in capitals
+	Class int             // Picks the color, so all boxes of one class match
+}
+
+// boxColors are distinct colors that stay readable on camera frames, picked by class
+var boxColors = []color.RGBA{
+	{255, 59, 48, 255},  // Red
+	{52, 199, 89, 255},  // Green
+	{0, 122, 255, 255},  // Blue
+	{255, 204, 0, 255},  // Yellow
+	{175, 82, 222, 255}, // Purple
+	{255, 149, 0, 255},  // Orange
+	{90, 200, 250, 255}, // Cyan
+	{255, 45, 85, 255},  // Pink
+}
+
+// InferenceBoxes returns the bounding boxes in an event's inference data (JSON), labeled with
+// the class name and confidence. The device reports each box by its center, in pixels of the
+// event image.
+func InferenceBoxes(inferenceData string) []Box {
+	if inferenceData == "" {
+		return nil
+	}
+	var inference models.InferenceData
+	if err := json.Unmarshal([]byte(inferenceData), &inference); err != nil {
+		return nil
+	}
+
+	boxes := make([]Box, 0, len(inference.Boxes))
+	for _, b := range inference.Boxes {
+		x, y, w, h, score, target := b[0], b[1], b[2], b[3], b[4], b[5]
+		name := "unknown"
+		if target >= 0 && target < len(inference.ClassesName) {
+			name = inference.ClassesName[target]
+		}
+		boxes = append(boxes, Box{
+			Rect:  image.Rect(x-w/2, y-h/2, x+w-w/2, y+h-h/2),
+			Label: fmt.Sprintf("%s %d%%", name, score),
+			Class: target,
+		})
+	}
+	return boxes
+}
+
+// AnnotateJPEG draws boxes and their labels onto a copy of a JPEG. Lines and text scale
+// with the image, so labels stay legible on both the 416x416 event image and full frames.
+func AnnotateJPEG(data []byte, boxes []Box) ([]byte, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JPEG: %w", err)
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+
+	short := bounds.Dx()
+	if bounds.Dy() < short {
+		short = bounds.Dy()
+	}
+	scale := short / 240
+	if scale < 1 {
+		scale = 1
+	}
+	for _, box := range boxes {
+		drawBox(dst, box, scale)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PlaceholderJPEG returns a dark gray JPEG of the given size with a line of text centered on
+// it, e.g. for a video stream that has nothing to show yet
+func PlaceholderJPEG(width, height int, text string) ([]byte, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.RGBA{48, 48, 48, 255}), image.Point{}, draw.Src)
+
+	label := []rune(strings.ToUpper(text))
+	scale := max(min(width, height)/240, 1)
+	w := len(label)*(glyphWidth+1)*scale - scale
+	drawText(dst, image.Pt((width-w)/2, (height-glyphHeight*scale)/2), label, scale, color.RGBA{200, 200, 200, 255})
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawBox outlines a box and writes its label on a filled tab above it (inside it when the
+// box touches the top edge)
+func drawBox(dst *image.RGBA, box Box, scale int) {
+	r := box.Rect.Canon().Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+	c := boxColors[((box.Class%len(boxColors))+len(boxColors))%len(boxColors)]
+	fill := image.NewUniform(c)
+
+	t := 2 * scale
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+t),
+		image.Rect(r.Min.X, r.Max.Y-t, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+t, r.Max.Y),
+		image.Rect(r.Max.X-t, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(dst, edge.Intersect(r), fill, image.Point{}, draw.Src)
+	}
+
+	if box.Label == "" {
+		return
+	}
+	label := []rune(strings.ToUpper(box.Label))
+	pad := 2 * scale
+	w := len(label)*(glyphWidth+1)*scale - scale + 2*pad
+	h := glyphHeight*scale + 2*pad
+	tab := image.Rect(r.Min.X, r.Min.Y-h, r.Min.X+w, r.Min.Y)
+	if tab.Min.Y < dst.Bounds().Min.Y {
+		tab = tab.Add(image.Pt(0, h))
+	}
+	if over := tab.Max.X - dst.Bounds().Max.X; over > 0 {
+		tab = tab.Sub(image.Pt(over, 0))
+	}
+	draw.Draw(dst, tab.Intersect(dst.Bounds()), fill, image.Point{}, draw.Src)
+
+	// Dark text on light colors, white on dark ones
+	ink := color.RGBA{255, 255, 255, 255}
+	if 299*int(c.R)+587*int(c.G)+114*int(c.B) > 150000 {
+		ink = color.RGBA{0, 0, 0, 255}
+	}
+	drawText(dst, tab.Min.Add(image.Pt(pad, pad)), label, scale, ink)
+}
+
+// drawText writes text with the built-in font, each font pixel drawn as a scale x scale square
+func drawText(dst *image.RGBA, at image.Point, text []rune, scale int, ink color.RGBA) {
+	src := image.NewUniform(ink)
+	for i, ch := range text {
+		rows, ok := glyphs[ch]
+		if !ok {
+			rows = glyphs['?']
+		}
+		x0 := at.X + i*(glyphWidth+1)*scale
+		for y, row := range rows {
+			for x := 0; x < glyphWidth; x++ {
+				if row&(1<<(glyphWidth-1-x)) == 0 {
+					continue
+				}
+				px := image.Rect(x0+x*scale, at.Y+y*scale, x0+(x+1)*scale, at.Y+(y+1)*scale)
+				draw.Draw(dst, px.Intersect(dst.Bounds()), src, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// Glyph size of the built-in font
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs is a 5x7 font covering what labels need (class names in capitals and confidences);
+// each row is 5 bits, leftmost pixel first. Other characters are drawn as '?'.
+var glyphs = map[rune][glyphHeight]uint8{
+	' ': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x0A, 0x04, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'?': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+
+	"github.com/brianhealey/sensecap-server/internal/models"
+)
+
+// personClasses are the detection classes treated as people
+var personClasses = map[string]bool{"person": true, "people": true, "human": true, "face": true}
+
+// PersonRegions returns the areas of the people in an event's inference data (JSON), and
+// whether it has detection boxes at all (without them, nothing says where people are). Boxes
+// are grown by a margin, since they are often tight around the body and cut through the head.
+func PersonRegions(inferenceData string) ([]image.Rectangle, bool) {
+	var inference models.InferenceData
+	if inferenceData == "" || json.Unmarshal([]byte(inferenceData), &inference) != nil || len(inference.Boxes) == 0 {
+		return nil, false
+	}
+
+	regions := []image.Rectangle{}
+	for _, b := range inference.Boxes {
+		x, y, w, h, target := b[0], b[1], b[2], b[3], b[5]
+		if target < 0 || target >= len(inference.ClassesName) || !personClasses[strings.ToLower(inference.ClassesName[target])] {
+			continue
+		}
+		// Boxes are given by their center
+		mw, mh := w*6/10, h*6/10
+		regions = append(regions, image.Rect(x-mw, y-mh, x+mw, y+mh))
+	}
+	return regions, true
+}
+
+// BlurJPEG blurs regions of a JPEG beyond recognition (nil regions = the whole image) and
+// returns it re-encoded. The blur radius grows with the region, so faces stay unreadable
+// whether they fill the frame or are a few pixels wide.
+func BlurJPEG(data []byte, regions []image.Rectangle) ([]byte, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JPEG: %w", err)
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+
+	if regions == nil {
+		regions = []image.Rectangle{bounds}
+	}
+	for _, region := range regions {
+		r := region.Canon().Intersect(bounds)
+		if r.Empty() {
+			continue
+		}
+		radius := max(r.Dx(), r.Dy()) / 8
+		if radius < 4 {
+			radius = 4
+		}
+		// Three box blur passes approximate a Gaussian blur
+		for pass := 0; pass < 3; pass++ {
+			boxBlur(dst, r, radius, true)
+			boxBlur(dst, r, radius, false)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// boxBlur averages each pixel of r with its neighbors within radius along one axis, using only
+// pixels inside r (edges are extended) so nothing outside the region is smeared into it
+func boxBlur(img *image.RGBA, r image.Rectangle, radius int, horizontal bool) {
+	lines, length := r.Dy(), r.Dx()
+	if !horizontal {
+		lines, length = r.Dx(), r.Dy()
+	}
+	offset := func(line, i int) int {
+		if horizontal {
+			return img.PixOffset(r.Min.X+i, r.Min.Y+line)
+		}
+		return img.PixOffset(r.Min.X+line, r.Min.Y+i)
+	}
+	clamp := func(i int) int {
+		return min(max(i, 0), length-1)
+	}
+
+	window := 2*radius + 1
+	out := make([]uint8, length*4)
+	for line := 0; line < lines; line++ {
+		var sum [4]int
+		for i := -radius; i <= radius; i++ {
+			p := offset(line, clamp(i))
+			for c := 0; c < 4; c++ {
+				sum[c] += int(img.Pix[p+c])
+			}
+		}
+		for i := 0; i < length; i++ {
+			for c := 0; c < 4; c++ {
+				out[i*4+c] = uint8(sum[c] / window)
+			}
+			leaving, entering := offset(line, clamp(i-radius)), offset(line, clamp(i+radius+1))
+			for c := 0; c < 4; c++ {
+				sum[c] += int(img.Pix[entering+c]) - int(img.Pix[leaving+c])
+			}
+		}
+		for i := 0; i < length; i++ {
+			copy(img.Pix[offset(line, i):offset(line, i)+4], out[i*4:i*4+4])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math/bits"
+)
+
+// thumbSize is the width and height of the grayscale thumbnail used for frame differencing
+const thumbSize = 16
+
+// Fingerprint summarizes a camera frame for similarity checks
+type Fingerprint struct {
+	Hash  uint64  // Difference hash (dHash): robust to small shifts, noise, and JPEG artifacts
+	Thumb []uint8 // 16x16 grayscale thumbnail for pixel-level frame differencing
+}
+
+// FingerprintJPEG computes the fingerprint of a JPEG frame
+func FingerprintJPEG(data []byte) (*Fingerprint, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JPEG: %w", err)
+	}
+
+	// dHash: compare horizontally adjacent pixels of a 9x8 grayscale thumbnail
+	gray := grayThumbnail(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y*9+x] > gray[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return &Fingerprint{Hash: hash, Thumb: grayThumbnail(img, thumbSize, thumbSize)}, nil
+}
+
+// HashDistance returns the number of differing bits between two fingerprints' hashes
+func (f *Fingerprint) HashDistance(other *Fingerprint) int {
+	return bits.OnesCount64(f.Hash ^ other.Hash)
+}
+
+// Difference returns the mean absolute brightness difference between two frames,
+// as a percentage (0 = identical, 100 = inverted)
+func (f *Fingerprint) Difference(other *Fingerprint) float64 {
+	var total int
+	for i := range f.Thumb {
+		d := int(f.Thumb[i]) - int(other.Thumb[i])
+		if d < 0 {
+			d = -d
+		}
+		total += d
+	}
+	return float64(total) * 100 / float64(len(f.Thumb)*255)
+}
+
+// grayThumbnail scales an image to width x height grayscale pixels using area averaging
+func grayThumbnail(src image.Image, width, height int) []uint8 {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	out := make([]uint8, width*height)
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcH/height
+		y1 := bounds.Min.Y + (y+1)*srcH/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcW/width
+			x1 := bounds.Min.X + (x+1)*srcW/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// Average the luminance of all source pixels covered by this thumbnail pixel
+			var sum, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := src.At(sx, sy).RGBA()
+					sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+					n++
+				}
+			}
+			out[y*width+x] = uint8(sum / n >> 8)
+		}
+	}
+	return out
+}
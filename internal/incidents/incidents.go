@@ -0,0 +1,402 @@
+// Package incidents groups alarms raised by several devices close together in time into
+// incidents, the unit alarms are reviewed in: a person walking from the driveway to the back
+// door is one incident with a story and a timeline, not four separate events. A burst of
+// alarms from one device detecting the same objects (a cat asleep in view for an hour) is an
+// incident too, so it does not drown the event list. Once an incident is over, the LLM writes
+// up what happened from the alarms of all its devices.
+package incidents
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/rules"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+const (
+	pollInterval = 5 * time.Second // How often new alarms are grouped
+	batchSize    = 500             // Caps the events loaded in one pass
+	maxTitleLen  = 120
+)
+
+// Narrator writes an incident up from its timeline (one alarm per line). It is the LLM
+// call of the voice pipeline, passed in by the server so this package stays free of it.
+type Narrator func(timeline string) (string, error)
+
+// group is the alarms of an incident in progress
+type group struct {
+	kind     string // database.IncidentDevices or database.IncidentBurst
+	events   []*database.NotificationEvent
+	last     time.Time          // Time of the latest alarm
+	seen     time.Time          // When the latest alarm was stored (the group ends a window after it)
+	linked   int                // Events already linked to the stored incident
+	incident *database.Incident // nil until enough devices (or alarms, for a burst) are in it
+}
+
+// grouper puts new alarms into incidents
+type grouper struct {
+	cfg     config.IncidentsConfig
+	narrate Narrator
+	lastID  int               // Newest event already grouped
+	current *group            // Alarms of all devices
+	bursts  map[string]*group // Alarms of one device, by burstKey
+}
+
+// Start groups the alarms stored from now on into incidents (unless cfg.Window is 0) and
+// writes up incidents a previous run left open
+func Start(cfg config.IncidentsConfig, narrate Narrator) error {
+	if cfg.Window <= 0 {
+		return nil
+	}
+
+	lastID, err := database.LastNotificationEventID()
+	if err != nil {
+		return err
+	}
+	unfinished, err := database.CloseOpenIncidents()
+	if err != nil {
+		return err
+	}
+	g := &grouper{cfg: cfg, narrate: narrate, lastID: lastID, bursts: make(map[string]*group)}
+
+	log.Printf("Incidents enabled: alarms from %d or more devices within %s are grouped", cfg.MinDevices, cfg.Window)
+	if cfg.BurstEvents > 0 {
+		log.Printf("Incidents enabled: bursts of %d or more alarms from one device detecting the same objects are grouped", cfg.BurstEvents)
+	}
+
+	supervisor.Go("incidents", func() error {
+		for _, id := range unfinished {
+			if _, err := Summarize(id, narrate); err != nil {
+				log.Printf("WARNING: Failed to summarize incident %d: %v", id, err)
+			}
+		}
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			g.run()
+		}
+		return nil
+	})
+	return nil
+}
+
+// run groups the alarms stored since the last pass and finishes the incidents in progress
+// that no alarm joined for the window
+func (g *grouper) run() {
+	for {
+		events, err := database.GetNotificationEventsAfter(g.lastID, batchSize)
+		if err != nil {
+			log.Printf("ERROR: Incidents failed to load events: %v", err)
+			return
+		}
+		for _, event := range events {
+			if event.EventType == database.EventAlarm && !event.Suppressed {
+				g.add(event)
+			}
+			g.lastID = event.ID
+		}
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	if g.current != nil && time.Since(g.current.seen) > g.cfg.Window {
+		g.finish(g.current)
+		g.current = nil
+	}
+	for key, burst := range g.bursts {
+		if time.Since(burst.seen) > g.cfg.Window {
+			g.finish(burst)
+			delete(g.bursts, key)
+		}
+	}
+}
+
+// add puts an alarm into the groups in progress (of all devices, and the burst of its device
+// and objects), or starts a new group if it came more than the window after the group's last
+// alarm. A group is stored as an incident as soon as enough devices, or for a burst enough
+// alarms, are in it.
+func (g *grouper) add(event *database.NotificationEvent) {
+	at := rules.EventTime(event)
+	if g.current != nil && at.Sub(g.current.last) > g.cfg.Window {
+		g.finish(g.current)
+		g.current = nil
+	}
+	if g.current == nil {
+		g.current = &group{kind: database.IncidentDevices}
+	}
+	g.current.add(event, at)
+	if g.current.incident != nil || len(devicesOf(g.current.events)) >= g.cfg.MinDevices {
+		g.store(g.current)
+	}
+
+	if g.cfg.BurstEvents == 0 {
+		return
+	}
+	key := burstKey(event)
+	burst := g.bursts[key]
+	if burst != nil && at.Sub(burst.last) > g.cfg.Window {
+		g.finish(burst)
+		burst = nil
+	}
+	if burst == nil {
+		burst = &group{kind: database.IncidentBurst}
+		g.bursts[key] = burst
+	}
+	burst.add(event, at)
+	if burst.incident != nil || len(burst.events) >= g.cfg.BurstEvents {
+		g.store(burst)
+	}
+}
+
+// add puts an alarm raised at a time into the group
+func (cur *group) add(event *database.NotificationEvent, at time.Time) {
+	cur.events = append(cur.events, event)
+	if at.After(cur.last) {
+		cur.last = at
+	}
+	cur.seen = time.Now()
+}
+
+// store creates or updates the incident of a group
+func (g *grouper) store(cur *group) {
+	if cur.incident == nil {
+		cur.incident = &database.Incident{Kind: cur.kind}
+	}
+	inc := cur.incident
+	inc.StartedAt, inc.EndedAt = timeSpan(cur.events)
+	inc.Devices = devicesOf(cur.events)
+	inc.EventCount = len(cur.events)
+	inc.Title = Title(cur.events)
+	inc.ImageEventID = representative(cur.events)
+
+	ids := make([]int, 0, len(cur.events)-cur.linked)
+	for _, e := range cur.events[cur.linked:] {
+		ids = append(ids, e.ID)
+	}
+	created := inc.ID == 0
+	if err := database.SaveIncident(inc, ids); err != nil {
+		log.Printf("ERROR: Failed to store incident: %v", err)
+		return
+	}
+	cur.linked = len(cur.events)
+	if created {
+		log.Printf("Incident %d (%s) started: %s", inc.ID, inc.Kind, inc.Title)
+	}
+}
+
+// finish closes the incident of a group, if it became one, and has it written up
+func (g *grouper) finish(cur *group) {
+	if cur.incident == nil || cur.incident.ID == 0 {
+		return
+	}
+
+	if err := database.CloseIncident(cur.incident.ID); err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	log.Printf("Incident %d ended: %d alarm(s) from %d device(s) over %s", cur.incident.ID, cur.incident.EventCount,
+		len(cur.incident.Devices), cur.incident.EndedAt.Sub(cur.incident.StartedAt).Round(time.Second))
+
+	if _, err := Summarize(cur.incident.ID, g.narrate); err != nil {
+		log.Printf("WARNING: Failed to summarize incident %d: %v", cur.incident.ID, err)
+	}
+}
+
+// Summarize has the LLM write up an incident from the timeline of its alarms and stores the
+// narrative. A failed LLM call is stored as the incident's narrative error and returned.
+func Summarize(id int, narrate Narrator) (*database.Incident, error) {
+	inc, err := database.GetIncidentByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if inc == nil {
+		return nil, fmt.Errorf("incident %d not found", id)
+	}
+	events, err := database.GetIncidentEvents(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	narrative, narrateErr := narrate(TimelineText(Timeline(events)))
+	narrative = strings.TrimSpace(narrative)
+	errText := ""
+	if narrateErr != nil {
+		errText = narrateErr.Error()
+		narrative = ""
+	}
+	if err := database.SetIncidentNarrative(id, narrative, errText); err != nil {
+		return nil, err
+	}
+	if narrateErr != nil {
+		return nil, narrateErr
+	}
+
+	log.Printf("Summarized incident %d in %s", id, time.Since(start).Round(time.Millisecond))
+	return database.GetIncidentByID(id)
+}
+
+// TimelineEntry is one alarm of an incident
+type TimelineEntry struct {
+	Time         time.Time `json:"time"`
+	EventID      int       `json:"event_id"`
+	DeviceEUI    string    `json:"device_eui"`
+	DeviceName   string    `json:"device_name"`   // Registered name ("" if unregistered)
+	Classes      []string  `json:"classes"`       // Detected objects
+	Text         string    `json:"text"`          // The alarm's text (the vision model's answer, for image analysis tasks)
+	TaskHeadline string    `json:"task_headline"` // Task that raised the alarm
+}
+
+// Timeline lists an incident's alarms in time order
+func Timeline(events []*database.NotificationEvent) []TimelineEntry {
+	names := make(map[string]string)
+	entries := make([]TimelineEntry, 0, len(events))
+	for _, event := range events {
+		name, ok := names[event.DeviceEUI]
+		if !ok {
+			name = deviceName(event.DeviceEUI)
+			names[event.DeviceEUI] = name
+		}
+		entries = append(entries, TimelineEntry{
+			Time:         rules.EventTime(event),
+			EventID:      event.ID,
+			DeviceEUI:    event.DeviceEUI,
+			DeviceName:   name,
+			Classes:      rules.Classes(event),
+			Text:         event.Text,
+			TaskHeadline: event.TaskHeadline,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries
+}
+
+// TimelineText renders a timeline for the narrative prompt, one alarm per line in server local time
+func TimelineText(entries []TimelineEntry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		camera := e.DeviceName
+		if camera == "" {
+			camera = "camera " + e.DeviceEUI
+		}
+		fmt.Fprintf(&b, "%s %s:", e.Time.In(time.Local).Format("15:04:05"), camera)
+		if len(e.Classes) > 0 {
+			fmt.Fprintf(&b, " detected %s", strings.Join(e.Classes, ", "))
+		}
+		if e.TaskHeadline != "" {
+			fmt.Fprintf(&b, " (task: %s)", e.TaskHeadline)
+		}
+		if text := strings.TrimSpace(e.Text); text != "" {
+			fmt.Fprintf(&b, " - %q", text)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Title names an incident after the objects detected and the devices involved, e.g.
+// "person, car on Porch, Driveway"
+func Title(events []*database.NotificationEvent) string {
+	var classes []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		for _, c := range rules.Classes(event) {
+			if !seen[c] {
+				seen[c] = true
+				classes = append(classes, c)
+			}
+		}
+	}
+
+	var cameras []string
+	for _, eui := range devicesOf(events) {
+		if name := deviceName(eui); name != "" {
+			cameras = append(cameras, name)
+		} else {
+			cameras = append(cameras, eui)
+		}
+	}
+
+	title := "Alarms on " + strings.Join(cameras, ", ")
+	if len(classes) > 0 {
+		title = strings.Join(classes, ", ") + " on " + strings.Join(cameras, ", ")
+	}
+	if len(title) > maxTitleLen {
+		title = title[:maxTitleLen-3] + "..."
+	}
+	return title
+}
+
+// burstKey identifies the bursts an alarm can belong to: its device and detected objects (or,
+// for alarms without detections such as image analysis ones, its task)
+func burstKey(event *database.NotificationEvent) string {
+	classes := rules.Classes(event)
+	if len(classes) == 0 {
+		return event.DeviceEUI + "|task:" + event.TaskHeadline
+	}
+	sort.Strings(classes)
+	return event.DeviceEUI + "|" + strings.Join(classes, ",")
+}
+
+// representative picks the alarm whose image stands for events: the one with the most
+// confident detection, the earliest on a tie (0 if none has an image)
+func representative(events []*database.NotificationEvent) int {
+	id, best := 0, -1
+	for _, event := range events {
+		if event.Img == "" {
+			continue
+		}
+		if confidence := rules.Confidence(event, ""); confidence > best {
+			id, best = event.ID, confidence
+		}
+	}
+	return id
+}
+
+// devicesOf lists the devices of events in order of their first event
+func devicesOf(events []*database.NotificationEvent) []string {
+	var devices []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if !seen[event.DeviceEUI] {
+			seen[event.DeviceEUI] = true
+			devices = append(devices, event.DeviceEUI)
+		}
+	}
+	return devices
+}
+
+// timeSpan returns the time of the first and last of events
+func timeSpan(events []*database.NotificationEvent) (first, last time.Time) {
+	for i, event := range events {
+		at := rules.EventTime(event)
+		if i == 0 || at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return first, last
+}
+
+// deviceName returns a device's registered name ("" if it is not registered)
+func deviceName(eui string) string {
+	device, err := database.GetDevice(eui)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if device == nil {
+		return ""
+	}
+	return device.Name
+}
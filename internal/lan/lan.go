@@ -0,0 +1,151 @@
+// Package lan finds the addresses devices on the local network can reach the server at, and
+// builds the AT commands that point a Watcher at it (shown in the startup banner and by
+// GET /api/admin/info).
+package lan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// virtualInterfaces are name prefixes of container and VM bridges, which devices cannot reach
+var virtualInterfaces = []string{"docker", "br-", "veth", "virbr", "vmnet", "cni", "flannel", "podman"}
+
+// Interface is a network interface devices may reach the server on, with its IPv4 addresses
+type Interface struct {
+	net.Interface
+	Addrs []net.IP
+}
+
+// Interfaces returns the host's up, non-loopback interfaces that have IPv4 addresses, skipping
+// container and VM bridges and link-local addresses
+func Interfaces() []Interface {
+	var result []Interface
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return result
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || virtual(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var ips []net.IP
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipNet.IP.To4(); ip != nil && !ip.IsLinkLocalUnicast() {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) > 0 {
+			result = append(result, Interface{Interface: iface, Addrs: ips})
+		}
+	}
+	return result
+}
+
+// Addresses returns the IPv4 addresses of Interfaces, private (RFC 1918) addresses first.
+// The Watcher only speaks IPv4 on Wi-Fi.
+func Addresses() []string {
+	private, public := []string{}, []string{}
+	for _, iface := range Interfaces() {
+		for _, ip := range iface.Addrs {
+			if ip.IsPrivate() {
+				private = append(private, ip.String())
+			} else {
+				public = append(public, ip.String())
+			}
+		}
+	}
+	sort.Strings(private)
+	sort.Strings(public)
+	return append(private, public...)
+}
+
+func virtual(name string) bool {
+	for _, prefix := range virtualInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerURLs returns the URLs devices can use: the configured API base URL first unless it
+// points at this host's loopback (the default), then one per LAN address
+func ServerURLs(apiBaseURL, scheme, port, basePath string, addresses []string) []string {
+	var urls []string
+	if u, err := url.Parse(apiBaseURL); err == nil && u.Host != "" && !loopback(u.Hostname()) {
+		urls = append(urls, strings.TrimRight(apiBaseURL, "/"))
+	}
+	for _, addr := range addresses {
+		candidate := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(addr, port), basePath)
+		if len(urls) == 0 || urls[0] != candidate {
+			urls = append(urls, candidate)
+		}
+	}
+	return urls
+}
+
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// Setup is what a Watcher needs to use the server at one URL
+type Setup struct {
+	URL        string   `json:"url"`
+	ATCommands []string `json:"at_commands"` // One AT+localservice command per service, sent over BLE
+	QRText     string   `json:"qr_text"`     // {"url": ..., "token": ...}, as encoded in the QR code
+}
+
+// localService is one service entry of AT+localservice
+type localService struct {
+	Switch int    `json:"switch"`
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+}
+
+// services are the local services this server implements, in the order they are configured
+var services = []string{"notification_proxy", "image_analyzer", "audio_task_composer"}
+
+// NewSetup builds the AT commands and QR text for a server URL and device token
+func NewSetup(serverURL, token string) Setup {
+	setup := Setup{URL: serverURL}
+	for _, service := range services {
+		data := marshal(map[string]interface{}{
+			"data": map[string]localService{service: {Switch: 1, URL: serverURL, Token: token}},
+		})
+		setup.ATCommands = append(setup.ATCommands, "AT+localservice="+data)
+	}
+
+	setup.QRText = marshal(struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	}{serverURL, token})
+	return setup
+}
+
+// marshal encodes v as compact JSON without escaping &, < and > (URLs and tokens are typed
+// or scanned as is)
+func marshal(v interface{}) string {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
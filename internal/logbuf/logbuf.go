@@ -0,0 +1,84 @@
+// Package logbuf keeps the most recent lines of the server log in memory, so a debug bundle
+// can include them without access to wherever stderr ends up (journald, docker logs, a file).
+package logbuf
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+var (
+	mu      sync.Mutex
+	ring    []string
+	next    int    // Index the next line is written at
+	full    bool   // The ring has wrapped
+	partial []byte // Text after the last newline, waiting for the rest of its line
+)
+
+// Initialize starts keeping the last size log lines and returns the writer to add to the log
+// output, e.g. log.SetOutput(io.MultiWriter(os.Stderr, logbuf.Initialize(2000))).
+// A size of 0 keeps nothing and returns io.Discard.
+func Initialize(size int) io.Writer {
+	mu.Lock()
+	defer mu.Unlock()
+	ring, next, full, partial = nil, 0, false, nil
+	if size <= 0 {
+		return io.Discard
+	}
+	ring = make([]string, size)
+	return writer{}
+}
+
+// writer records complete lines into the ring
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if ring == nil {
+		return len(p), nil
+	}
+
+	data := append(partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		ring[next] = string(data[:i])
+		next = (next + 1) % len(ring)
+		if next == 0 {
+			full = true
+		}
+		data = data[i+1:]
+	}
+	partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first
+func Lines() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if ring == nil {
+		return nil
+	}
+
+	var lines []string
+	if full {
+		lines = append(lines, ring[next:]...)
+	}
+	lines = append(lines, ring[:next]...)
+	if len(partial) > 0 {
+		lines = append(lines, string(partial))
+	}
+	return lines
+}
+
+// Size returns the number of lines kept (0 = disabled)
+func Size() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(ring)
+}
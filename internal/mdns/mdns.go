@@ -0,0 +1,377 @@
+// Package mdns advertises the server on the LAN with multicast DNS service discovery
+// (RFC 6762/6763), so the BLE CLI can find its URL instead of users typing IP addresses, and
+// browses for advertised servers. It is a minimal responder for one service over IPv4 (the
+// Watcher only speaks IPv4 on Wi-Fi); name conflicts are not probed for, since the instance
+// name includes the host name.
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/lan"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// ServiceType is the DNS-SD service type the server is advertised as
+const ServiceType = "_sensecap._tcp"
+
+// Record TTLs (RFC 6762 section 10): host-related records short, the others long
+const (
+	hostTTL  = 120
+	otherTTL = 4500
+	// legacyTTL caps the TTLs of unicast replies to one-shot queries (section 6.7)
+	legacyTTL = 10
+)
+
+var (
+	groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+	serviceName  = name{"_sensecap", "_tcp", "local"}
+	servicesName = name{"_services", "_dns-sd", "_udp", "local"} // Service type enumeration
+)
+
+// Service is the advertised server
+type Service struct {
+	Instance string   // Instance name, e.g. "SenseCAP Watcher Server on pi"
+	Host     string   // Host name, without .local
+	Port     int      // HTTP port
+	Text     []string // TXT record entries (key=value)
+}
+
+// Start advertises the service on every LAN interface (if enabled) until the process exits.
+// The TXT record carries text (key=value entries), e.g. the base path and whether a device
+// token is required.
+func Start(cfg config.MDNSConfig, port string, text []string) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+
+	host := hostLabel()
+	svc := &Service{Instance: cfg.Name, Host: host, Port: p, Text: text}
+	if svc.Instance == "" {
+		svc.Instance = "SenseCAP Watcher Server on " + host
+	}
+	if len(svc.Instance) > 63 {
+		svc.Instance = svc.Instance[:63]
+	}
+
+	log.Printf("mDNS: advertising %q as %s.local", svc.Instance, ServiceType)
+	supervisor.Go("mdns", func() error {
+		return svc.serve()
+	})
+	return nil
+}
+
+// hostLabel returns the host name as a DNS label (letters, digits and hyphens)
+func hostLabel() string {
+	hostname, _ := os.Hostname()
+	hostname, _, _ = strings.Cut(strings.ToLower(hostname), ".")
+	label := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, hostname)
+	label = strings.Trim(label, "-")
+	if label == "" {
+		return "sensecap-server"
+	}
+	return label
+}
+
+func (s *Service) instanceName() name {
+	return append(name{s.Instance}, serviceName...)
+}
+
+func (s *Service) hostName() name {
+	return name{s.Host, "local"}
+}
+
+// serve answers queries on every LAN interface, returning when all listeners have failed.
+// Interfaces are listed once; the supervisor's restart picks up new ones.
+func (s *Service) serve() error {
+	ifaces := lan.Interfaces()
+	if len(ifaces) == 0 {
+		return errors.New("no LAN interface to advertise on")
+	}
+
+	errs := make(chan error, len(ifaces))
+	listening := 0
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		conn, err := net.ListenMulticastUDP("udp4", &iface.Interface, groupAddr)
+		if err != nil {
+			log.Printf("WARNING: mDNS: cannot listen on %s: %v", iface.Name, err)
+			continue
+		}
+		listening++
+		go func(iface lan.Interface) {
+			defer conn.Close()
+			errs <- s.answer(conn, iface)
+		}(iface)
+		go s.announce(conn, iface)
+	}
+	if listening == 0 {
+		return errors.New("no interface accepted the mDNS multicast group")
+	}
+
+	var err error
+	for i := 0; i < listening; i++ {
+		err = <-errs
+	}
+	return err
+}
+
+// announce sends the records unsolicited twice, a second apart (RFC 6762 section 8.3)
+func (s *Service) announce(conn *net.UDPConn, iface lan.Interface) {
+	for i := 0; i < 2; i++ {
+		resp := &message{flags: flagResponse}
+		resp.answers = append(s.records(typePTR, iface, hostTTL, otherTTL), s.records(typeSRV, iface, hostTTL, otherTTL)...)
+		resp.answers = append(resp.answers, s.records(typeTXT, iface, hostTTL, otherTTL)...)
+		resp.answers = append(resp.answers, s.records(typeA, iface, hostTTL, otherTTL)...)
+		if err := s.send(conn, resp, groupAddr); err != nil {
+			log.Printf("WARNING: mDNS: announcement on %s failed: %v", iface.Name, err)
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// answer reads queries from conn and answers those for the service
+func (s *Service) answer(conn *net.UDPConn, iface lan.Interface) error {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("mDNS on %s: %w", iface.Name, err)
+		}
+		query, err := parseMessage(buf[:n])
+		if err != nil || query.isResponse() {
+			continue
+		}
+
+		// One-shot queries from other ports get a unicast reply with the query's ID and
+		// questions and short TTLs; otherwise the reply is multicast, or unicast if asked (QU)
+		legacy := src.Port != groupAddr.Port
+		hostTTL, otherTTL := uint32(hostTTL), uint32(otherTTL)
+		if legacy {
+			hostTTL, otherTTL = legacyTTL, legacyTTL
+		}
+		resp := &message{flags: flagResponse}
+		unicast := legacy
+		for _, q := range query.questions {
+			answers, additional := s.lookup(q, iface, hostTTL, otherTTL)
+			if len(answers) == 0 {
+				continue
+			}
+			resp.answers = append(resp.answers, answers...)
+			resp.additional = append(resp.additional, additional...)
+			if q.class&unicastQU != 0 {
+				unicast = true
+			}
+			if legacy {
+				resp.questions = append(resp.questions, q)
+			}
+		}
+		if len(resp.answers) == 0 {
+			continue
+		}
+
+		dest := groupAddr
+		if unicast {
+			dest = src
+		}
+		if legacy {
+			resp.id = query.id
+			for i := range resp.answers {
+				resp.answers[i].class &^= cacheFlush
+			}
+		}
+		if err := s.send(conn, resp, dest); err != nil {
+			log.Printf("WARNING: mDNS: reply to %s failed: %v", src, err)
+		}
+	}
+}
+
+// lookup returns the answers to a question and the additional records that go with them
+func (s *Service) lookup(q question, iface lan.Interface, hostTTL, otherTTL uint32) (answers, additional []record) {
+	if q.class&classMask != classIN && q.class&classMask != typeANY {
+		return nil, nil
+	}
+	matches := func(t uint16) bool { return q.qtype == t || q.qtype == typeANY }
+
+	switch {
+	case q.name.equal(servicesName) && matches(typePTR):
+		answers = []record{{name: servicesName, rtype: typePTR, class: classIN, ttl: otherTTL, target: serviceName}}
+	case q.name.equal(serviceName) && matches(typePTR):
+		answers = s.records(typePTR, iface, hostTTL, otherTTL)
+		additional = append(s.records(typeSRV, iface, hostTTL, otherTTL), s.records(typeTXT, iface, hostTTL, otherTTL)...)
+		additional = append(additional, s.records(typeA, iface, hostTTL, otherTTL)...)
+	case q.name.equal(s.instanceName()):
+		for _, t := range []uint16{typeSRV, typeTXT} {
+			if matches(t) {
+				answers = append(answers, s.records(t, iface, hostTTL, otherTTL)...)
+			}
+		}
+		if len(answers) > 0 {
+			additional = s.records(typeA, iface, hostTTL, otherTTL)
+		}
+	case q.name.equal(s.hostName()) && matches(typeA):
+		answers = s.records(typeA, iface, hostTTL, otherTTL)
+	}
+	return answers, additional
+}
+
+// records returns the service's records of one type, with the addresses of iface
+func (s *Service) records(rtype uint16, iface lan.Interface, hostTTL, otherTTL uint32) []record {
+	switch rtype {
+	case typePTR:
+		return []record{{name: serviceName, rtype: typePTR, class: classIN, ttl: otherTTL, target: s.instanceName()}}
+	case typeSRV:
+		return []record{{name: s.instanceName(), rtype: typeSRV, class: classIN | cacheFlush, ttl: hostTTL, port: uint16(s.Port), target: s.hostName()}}
+	case typeTXT:
+		return []record{{name: s.instanceName(), rtype: typeTXT, class: classIN | cacheFlush, ttl: otherTTL, text: s.Text}}
+	case typeA:
+		var rrs []record
+		for _, ip := range iface.Addrs {
+			rrs = append(rrs, record{name: s.hostName(), rtype: typeA, class: classIN | cacheFlush, ttl: hostTTL, ip: ip.To4()})
+		}
+		return rrs
+	}
+	return nil
+}
+
+func (s *Service) send(conn *net.UDPConn, m *message, dest *net.UDPAddr) error {
+	b, err := m.pack()
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToUDP(b, dest)
+	return err
+}
+
+// Found is a server found by Browse
+type Found struct {
+	Instance string
+	Host     string // Host name, e.g. "pi.local"
+	Port     int
+	Addrs    []net.IP
+	Text     map[string]string // TXT record entries
+}
+
+// URL returns the server's base URL at its first address (host name if it has none)
+func (f *Found) URL() string {
+	host := strings.TrimSuffix(f.Host, ".")
+	if len(f.Addrs) > 0 {
+		host = f.Addrs[0].String()
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(f.Port)) + strings.TrimRight(f.Text["path"], "/")
+}
+
+// Browse sends a one-shot query for servers on the LAN and collects the replies for timeout.
+// The query comes from an ephemeral port, so responders reply by unicast (RFC 6762 section
+// 5.1), which also reaches a server on the same host.
+func Browse(timeout time.Duration) ([]*Found, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	query := &message{id: uint16(time.Now().UnixNano()), questions: []question{{name: serviceName, qtype: typePTR, class: classIN}}}
+	b, err := query.pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(b, groupAddr); err != nil {
+		return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	instances := map[string]*Found{}
+	var order []string
+	hosts := map[string][]net.IP{}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		resp, err := parseMessage(buf[:n])
+		if err != nil || !resp.isResponse() {
+			continue
+		}
+
+		for _, rr := range append(resp.answers, resp.additional...) {
+			switch rr.rtype {
+			case typePTR:
+				if rr.name.equal(serviceName) && len(rr.target) > len(serviceName) {
+					key := strings.ToLower(rr.target.String())
+					if instances[key] == nil {
+						instances[key] = &Found{Instance: rr.target[0], Text: map[string]string{}}
+						order = append(order, key)
+					}
+				}
+			case typeA:
+				key := strings.ToLower(rr.name.String())
+				ip := net.IP(rr.ip)
+				if !containsIP(hosts[key], ip) {
+					hosts[key] = append(hosts[key], ip)
+				}
+			}
+		}
+		for _, rr := range append(resp.answers, resp.additional...) {
+			f := instances[strings.ToLower(rr.name.String())]
+			if f == nil {
+				continue
+			}
+			switch rr.rtype {
+			case typeSRV:
+				f.Host, f.Port = rr.target.String(), int(rr.port)
+			case typeTXT:
+				for _, entry := range rr.text {
+					key, value, _ := strings.Cut(entry, "=")
+					f.Text[strings.ToLower(key)] = value
+				}
+			}
+		}
+	}
+
+	found := []*Found{}
+	for _, key := range order {
+		f := instances[key]
+		if f.Port == 0 {
+			continue // No SRV record received
+		}
+		f.Addrs = hosts[strings.ToLower(f.Host)]
+		found = append(found, f)
+	}
+	return found, nil
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, known := range ips {
+		if known.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
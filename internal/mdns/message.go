@@ -0,0 +1,277 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// DNS record types and classes used by the service
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+
+	classIN    = 1
+	classMask  = 0x7fff // The top bit is the QU bit in questions and cache-flush in records
+	cacheFlush = 0x8000 // Set on records only this host answers (SRV, TXT, A)
+	unicastQU  = 0x8000 // Set on questions that ask for a unicast response
+
+	flagResponse = 0x8400 // QR and AA
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+// name is a domain name as its labels, without the root label. Labels are kept raw (instance
+// names may contain spaces and dots).
+type name []string
+
+// equal compares names case-insensitively, as DNS does
+func (n name) equal(o name) bool {
+	if len(n) != len(o) {
+		return false
+	}
+	for i := range n {
+		if !strings.EqualFold(n[i], o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n name) String() string {
+	return strings.Join(n, ".") + "."
+}
+
+// question is an entry of the question section
+type question struct {
+	name  name
+	qtype uint16
+	class uint16 // Including the QU bit
+}
+
+// record is a resource record. Only the rdata of the types the service uses is decoded.
+type record struct {
+	name  name
+	rtype uint16
+	class uint16 // Including the cache-flush bit
+	ttl   uint32
+
+	target name     // PTR, SRV
+	port   uint16   // SRV
+	text   []string // TXT
+	ip     []byte   // A (4 bytes)
+}
+
+// message is a DNS message
+type message struct {
+	id         uint16
+	flags      uint16
+	questions  []question
+	answers    []record
+	additional []record
+}
+
+func (m *message) isResponse() bool {
+	return m.flags&0x8000 != 0
+}
+
+// pack encodes the message without name compression
+func (m *message) pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.id)
+	binary.BigEndian.PutUint16(b[2:], m.flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.additional)))
+
+	var err error
+	for _, q := range m.questions {
+		if b, err = appendName(b, q.name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.qtype)
+		b = binary.BigEndian.AppendUint16(b, q.class)
+	}
+	for _, rrs := range [][]record{m.answers, m.additional} {
+		for _, rr := range rrs {
+			if b, err = appendRecord(b, rr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+func appendName(b []byte, n name) ([]byte, error) {
+	for _, label := range n {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errors.New("invalid DNS label length")
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+func appendRecord(b []byte, rr record) ([]byte, error) {
+	var err error
+	if b, err = appendName(b, rr.name); err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, rr.rtype)
+	b = binary.BigEndian.AppendUint16(b, rr.class)
+	b = binary.BigEndian.AppendUint32(b, rr.ttl)
+
+	lengthAt := len(b)
+	b = append(b, 0, 0)
+	switch rr.rtype {
+	case typePTR:
+		b, err = appendName(b, rr.target)
+	case typeSRV:
+		b = binary.BigEndian.AppendUint16(b, 0) // Priority
+		b = binary.BigEndian.AppendUint16(b, 0) // Weight
+		b = binary.BigEndian.AppendUint16(b, rr.port)
+		b, err = appendName(b, rr.target)
+	case typeTXT:
+		for _, s := range rr.text {
+			if len(s) > 255 {
+				return nil, errors.New("TXT string too long")
+			}
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+	case typeA:
+		b = append(b, rr.ip...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[lengthAt:], uint16(len(b)-lengthAt-2))
+	return b, nil
+}
+
+// parseMessage decodes a DNS message. Authority records are skipped.
+func parseMessage(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+	m := &message{id: binary.BigEndian.Uint16(b[0:]), flags: binary.BigEndian.Uint16(b[2:])}
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(b[4+2*i:]))
+	}
+
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		n, next, err := parseName(b, off)
+		if err != nil || next+4 > len(b) {
+			return nil, errMalformed
+		}
+		m.questions = append(m.questions, question{
+			name:  n,
+			qtype: binary.BigEndian.Uint16(b[next:]),
+			class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+	for section := 1; section < 4; section++ {
+		for i := 0; i < counts[section]; i++ {
+			rr, next, err := parseRecord(b, off)
+			if err != nil {
+				return nil, err
+			}
+			off = next
+			switch section {
+			case 1:
+				m.answers = append(m.answers, rr)
+			case 3:
+				m.additional = append(m.additional, rr)
+			}
+		}
+	}
+	return m, nil
+}
+
+func parseRecord(b []byte, off int) (record, int, error) {
+	n, off, err := parseName(b, off)
+	if err != nil || off+10 > len(b) {
+		return record{}, 0, errMalformed
+	}
+	rr := record{
+		name:  n,
+		rtype: binary.BigEndian.Uint16(b[off:]),
+		class: binary.BigEndian.Uint16(b[off+2:]),
+		ttl:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	start, end := off+10, off+10+length
+	if end > len(b) {
+		return record{}, 0, errMalformed
+	}
+
+	switch rr.rtype {
+	case typePTR:
+		if rr.target, _, err = parseName(b, start); err != nil {
+			return record{}, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return record{}, 0, errMalformed
+		}
+		rr.port = binary.BigEndian.Uint16(b[start+4:])
+		if rr.target, _, err = parseName(b, start+6); err != nil {
+			return record{}, 0, err
+		}
+	case typeTXT:
+		for i := start; i < end; {
+			l := int(b[i])
+			if i+1+l > end {
+				return record{}, 0, errMalformed
+			}
+			rr.text = append(rr.text, string(b[i+1:i+1+l]))
+			i += 1 + l
+		}
+	case typeA:
+		if length != 4 {
+			return record{}, 0, errMalformed
+		}
+		rr.ip = append([]byte(nil), b[start:end]...)
+	}
+	return rr, end, nil
+}
+
+// parseName decodes a possibly compressed name at off, returning it and the offset after it
+func parseName(b []byte, off int) (name, int, error) {
+	var n name
+	end := -1 // Offset after the name where it started, once a pointer was followed
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return nil, 0, errMalformed
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return n, end, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(b) || jumps > 10 {
+				return nil, 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			jumps++
+		case l > 63 || off+1+l > len(b):
+			return nil, 0, errMalformed
+		default:
+			n = append(n, string(b[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BodyLimit middleware rejects request bodies larger than maxBytes
+// Most handlers read bodies fully into memory (device uploads stream or reuse buffers), so
+// this bounds per-request memory use.
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Reject early when the declared size is already too large
+			if r.ContentLength > maxBytes {
+				log.Printf("ERROR: Request body too large (%d bytes, limit %d) from %s",
+					r.ContentLength, maxBytes, r.RemoteAddr)
+				http.Error(w, `{"code": 413}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// Enforce the limit on chunked or mis-declared bodies as they are read
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit middleware enforces per-device and global request rate limits on the device routes,
+// after device authentication and the EUI check so unauthenticated clients cannot make up EUIs
+// to get fresh buckets. Devices are identified by the API-OBITER-DEVICE-EUI header, falling
+// back to the client IP. A limit of 0 disables that check.
+func RateLimit(devicePerMinute, globalPerMinute int) func(http.Handler) http.Handler {
+	global := newTokenBucket(globalPerMinute)
+	devices := &bucketSet{
+		perMinute: devicePerMinute,
+		buckets:   make(map[string]*tokenBucket),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("API-OBITER-DEVICE-EUI")
+			if key == "" {
+				key = clientIP(r)
+			}
+
+			if devicePerMinute > 0 && !devices.allow(key) {
+				log.Printf("WARN: Rate limit exceeded for device %s (%d req/min)", key, devicePerMinute)
+				rejectRateLimited(w)
+				return
+			}
+
+			if globalPerMinute > 0 && !global.allow() {
+				log.Printf("WARN: Global rate limit exceeded (%d req/min)", globalPerMinute)
+				rejectRateLimited(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rejectRateLimited(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "60")
+	http.Error(w, `{"code": 429}`, http.StatusTooManyRequests)
+}
+
+// clientIP returns the host part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tokenBucket is a simple token bucket refilled continuously at perMinute tokens per minute,
+// with a burst capacity equal to perMinute
+type tokenBucket struct {
+	mu        sync.Mutex
+	perMinute int
+	tokens    float64
+	last      time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		perMinute: perMinute,
+		tokens:    float64(perMinute),
+		last:      time.Now(),
+	}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Minutes() * float64(b.perMinute)
+	if b.tokens > float64(b.perMinute) {
+		b.tokens = float64(b.perMinute)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// bucketSet holds one token bucket per device
+type bucketSet struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func (s *bucketSet) allow(key string) bool {
+	s.mu.Lock()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(s.perMinute)
+		s.buckets[key] = bucket
+	}
+	s.pruneLocked()
+	s.mu.Unlock()
+
+	return bucket.allow()
+}
+
+// maxBuckets is the number of buckets that triggers a prune before the next scheduled one
+const maxBuckets = 10000
+
+// pruneLocked drops buckets idle long enough to have fully refilled (a minute): dropping
+// them changes no limit, and keeps the map from growing with one-off keys
+func (s *bucketSet) pruneLocked() {
+	now := time.Now()
+	if now.Sub(s.lastPrune) < time.Minute && len(s.buckets) < maxBuckets {
+		return
+	}
+	s.lastPrune = now
+
+	for key, bucket := range s.buckets {
+		bucket.mu.Lock()
+		idle := now.Sub(bucket.last)
+		bucket.mu.Unlock()
+		if idle >= time.Minute {
+			delete(s.buckets, key)
+		}
+	}
+}
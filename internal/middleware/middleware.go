@@ -39,21 +39,46 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// AuthValidator middleware validates the Authorization header
-// For now, it just logs the token but doesn't enforce validation
-func AuthValidator(requiredToken string) func(http.Handler) http.Handler {
+// Unwrap gives http.ResponseController access to the wrapped writer (e.g. to flush streams)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// DeviceEUIValidator middleware validates the API-OBITER-DEVICE-EUI header
+// By default it only logs missing or invalid EUIs. In strict mode it rejects them with 401,
+// and EUIs that registered does not report as registered with 403.
+func DeviceEUIValidator(strict bool, registered func(eui string) (bool, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
+			deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
+
+			valid := true
+			if deviceEUI == "" {
+				log.Println("WARN: Missing API-OBITER-DEVICE-EUI header")
+				valid = false
+			} else if len(deviceEUI) != 16 {
+				log.Printf("WARN: Invalid API-OBITER-DEVICE-EUI header (expected 16 chars, got %d): %s",
+					len(deviceEUI), deviceEUI)
+				valid = false
+			}
 
-			if requiredToken != "" {
-				// If a required token is configured, validate it
-				if authHeader != requiredToken {
-					log.Printf("ERROR: Invalid or missing Authorization header (expected: %s, got: %s)",
-						requiredToken, authHeader)
+			if strict {
+				if !valid {
 					http.Error(w, `{"code": 401}`, http.StatusUnauthorized)
 					return
 				}
+
+				ok, err := registered(deviceEUI)
+				if err != nil {
+					log.Printf("ERROR: Failed to check device registry: %v", err)
+					http.Error(w, `{"code": 500}`, http.StatusInternalServerError)
+					return
+				}
+				if !ok {
+					log.Printf("WARN: Rejected request from unregistered device %s (%s)", deviceEUI, r.RemoteAddr)
+					http.Error(w, `{"code": 403}`, http.StatusForbidden)
+					return
+				}
 			}
 
 			// Call next handler
@@ -62,21 +87,15 @@ func AuthValidator(requiredToken string) func(http.Handler) http.Handler {
 	}
 }
 
-// DeviceEUIValidator middleware validates the API-OBITER-DEVICE-EUI header
-func DeviceEUIValidator(next http.Handler) http.Handler {
+// ReadOnly rejects device requests other than GET and HEAD, which would store data, while
+// the server runs on a read-only database
+func ReadOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		deviceEUI := r.Header.Get("API-OBITER-DEVICE-EUI")
-
-		if deviceEUI == "" {
-			log.Println("WARN: Missing API-OBITER-DEVICE-EUI header")
-			// For now, just log the warning but allow the request through
-		} else if len(deviceEUI) != 16 {
-			log.Printf("WARN: Invalid API-OBITER-DEVICE-EUI header (expected 16 chars, got %d): %s",
-				len(deviceEUI), deviceEUI)
-			// For now, just log the warning but allow the request through
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.Printf("WARNING: Read-only mode, rejected %s %s from %s", r.Method, r.URL.Path, r.Header.Get("API-OBITER-DEVICE-EUI"))
+			http.Error(w, `{"code": 503}`, http.StatusServiceUnavailable)
+			return
 		}
-
-		// Call next handler
 		next.ServeHTTP(w, r)
 	})
 }
@@ -85,7 +104,7 @@ func DeviceEUIValidator(next http.Handler) http.Handler {
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, API-OBITER-DEVICE-EUI")
 
 		// Handle preflight requests
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Proxy middleware makes requests forwarded by a trusted reverse proxy (nginx, Traefik, ...)
+// look like the client's own: the client address from X-Forwarded-For or X-Real-IP replaces
+// the proxy's in RemoteAddr, so logs, rate limits and the audit log see the client, and a path
+// prefix the proxy stripped (announced in X-Forwarded-Prefix) is put back so the base path
+// routes match. It wraps the router rather than being router middleware because it changes the
+// path routes are matched on. trusted lists IP addresses and CIDR ranges; requests from other
+// addresses are passed on unchanged, since anyone can send these headers.
+func Proxy(trusted []string, basePath string) func(http.Handler) http.Handler {
+	var nets []*net.IPNet
+	for _, cidr := range trusted {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		} else {
+			log.Printf("WARNING: Ignoring invalid trusted proxy %q: %v", cidr, err)
+		}
+	}
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(nets) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isTrusted(clientIP(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if client := forwardedClient(r, isTrusted); client != "" {
+				r.RemoteAddr = client
+			}
+			if basePath != "" && r.Header.Get("X-Forwarded-Prefix") == basePath &&
+				r.URL.Path != basePath && !strings.HasPrefix(r.URL.Path, basePath+"/") {
+				r.URL.Path = basePath + r.URL.Path
+				r.URL.RawPath = ""
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the client address a trusted proxy forwarded a request for: the
+// last address of X-Forwarded-For that is not itself a trusted proxy (the addresses before it
+// were sent by the client and can be forged), or X-Real-IP without X-Forwarded-For
+func forwardedClient(r *http.Request, isTrusted func(string) bool) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); net.ParseIP(hop) != nil {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrusted(hops[i]) || i == 0 {
+			return hops[i]
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ""
+}
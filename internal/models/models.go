@@ -70,3 +70,45 @@ type ImageAnalyzerResponseData struct {
 	Audio *string `json:"audio,omitempty"` // Base64-encoded audio response (optional)
 	Img   *string `json:"img,omitempty"`   // Base64-encoded image (optional)
 }
+
+// TalkResponse is the JSON part of the voice response; the WAV reply follows the
+// "---sensecraftboundary---" line (based on app_voice_interaction.c lines 1189-1310)
+type TalkResponse struct {
+	Code int              `json:"code"`
+	Data TalkResponseData `json:"data"`
+}
+
+// TalkResponseData describes what was heard and answered
+type TalkResponseData struct {
+	Mode       int       `json:"mode"`           // 0=chat, 1=task, 2=task_auto
+	Duration   int       `json:"duration"`       // Reply audio duration in ms
+	STTResult  string    `json:"stt_result"`     // Transcription of the upload
+	ScreenText string    `json:"screen_text"`    // Text shown on the device screen
+	Task       *TalkTask `json:"task,omitempty"` // Task the reply is about, if any
+}
+
+// Task states reported in TalkTask
+const (
+	TaskDraft  = "draft"  // Read back to the user and waiting for a yes; not served to the device yet
+	TaskActive = "active" // Created; the device fetches it with view_task_detail
+)
+
+// TalkTask describes a task created or waiting for confirmation in a voice reply
+type TalkTask struct {
+	TLID     int    `json:"tlid"`               // Task flow ID
+	Headline string `json:"tn"`                 // Task name shown on the device
+	Trigger  string `json:"trigger"`            // What the task watches for
+	Status   string `json:"status"`             // TaskDraft or TaskActive
+	Replaces string `json:"replaces,omitempty"` // Headline of the task it replaces once confirmed
+}
+
+// TaskFlowStatusRequest is a task flow engine status report, matching the data of the
+// AT+taskflow? BLE response (forwarded by the device, a gateway, or the BLE CLI)
+type TaskFlowStatusRequest struct {
+	Status        int    `json:"status"`          // Engine status (0=idle, 1=starting, 2=running, ...)
+	TLID          int64  `json:"tlid"`            // Task flow ID (our task ID)
+	CTD           int64  `json:"ctd"`             // Task flow creation timestamp
+	Module        string `json:"module"`          // Active module name
+	ModuleErrCode int    `json:"module_err_code"` // Module error code (0 = no error)
+	Percent       int    `json:"percent"`         // AI model download progress (0-100)
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Task flow module types (the "type" of a node, tf_module names in the firmware)
+const (
+	ModuleAICamera        = "ai camera"
+	ModuleImageAnalyzer   = "image analyzer"
+	ModuleLocalAlarm      = "local alarm"
+	ModuleSenseCraftAlarm = "sensecraft alarm"
+	ModuleHTTPAlarm       = "http alarm"
+	ModuleAlarmTrigger    = "alarm trigger"
+)
+
+// Model types of the AI camera
+const (
+	ModelCloud   = 0 // SenseCraft cloud model or custom model (downloaded by the device)
+	ModelPerson  = 1 // Built-in person detection
+	ModelPet     = 2 // Built-in pet detection
+	ModelGesture = 3 // Built-in gesture detection
+)
+
+// BuiltinModelClasses are the classes the built-in models of the AI camera report
+var BuiltinModelClasses = map[int][]string{
+	ModelPerson:  {"person"},
+	ModelPet:     {"cat", "dog"},
+	ModelGesture: {"rock", "paper", "scissors"},
+}
+
+// TaskList is a task flow as the firmware runs it: data.tl of the view_task_detail response
+type TaskList struct {
+	Type     int    `json:"type"`      // Task flow type (always 0)
+	TLID     int    `json:"tlid"`      // Task flow ID (our task ID)
+	CTD      int64  `json:"ctd"`       // Creation timestamp in milliseconds
+	Name     string `json:"tn"`        // Task name shown on the device
+	TaskFlow []Node `json:"task_flow"` // Modules, wired together by node ID
+}
+
+// Node is a module of a task flow
+type Node interface {
+	header() *NodeHeader
+	lint(l *linter)
+}
+
+// NodeHeader holds the fields every task flow node has
+type NodeHeader struct {
+	ID    int     `json:"id"`
+	Type  string  `json:"type"`  // One of the Module types
+	Index int     `json:"index"` // Position in the task flow
+	Wires [][]int `json:"wires"` // IDs of the nodes the output goes to (empty for terminal nodes)
+}
+
+func (h *NodeHeader) header() *NodeHeader { return h }
+
+// AICameraNode runs a detection model and triggers when its conditions hold
+type AICameraNode struct {
+	NodeHeader
+	Params AICameraParams `json:"params"`
+}
+
+// AICameraParams configures the AI camera module
+type AICameraParams struct {
+	Modes           int                 `json:"modes"`      // 0 = inference
+	ModelType       int                 `json:"model_type"` // 0 = cloud or custom model, 1 = person, 2 = pet, 3 = gesture
+	Model           *AICameraModel      `json:"model,omitempty"`
+	Conditions      []AICameraCondition `json:"conditions"`
+	ConditionsCombo int                 `json:"conditions_combo"` // 0 = AND, 1 = OR
+	SilentPeriod    SilentPeriod        `json:"silent_period"`
+	OutputType      int                 `json:"output_type"` // 0 = small image, 1 = small and large image
+	Shutter         int                 `json:"shutter"`     // 0 = constantly, 1 = up edge, 2 = down edge, 3 = both edges
+}
+
+// AICameraModel tells the device which model to download for model_type 0, in the shape of
+// the SenseCraft model repository's entries
+type AICameraModel struct {
+	ModelID   string         `json:"model_id"`
+	Version   string         `json:"version"`
+	ModelName string         `json:"model_name"`
+	Classes   []string       `json:"classes"`
+	Checksum  string         `json:"checksum"`
+	Arguments ModelArguments `json:"arguments"`
+}
+
+// ModelArguments locate the model file
+type ModelArguments struct {
+	URL  string  `json:"url"`
+	Size float64 `json:"size"` // In KB
+	Task string  `json:"task"` // detect
+}
+
+// AICameraCondition is a detection condition of the AI camera
+type AICameraCondition struct {
+	Class string `json:"class"`
+	Mode  int    `json:"mode"` // 1 = compare the class count with num (by type), 2 = the count changes
+	Type  int    `json:"type"` // 0 = fewer than num, 1 = exactly num, 2 = more than num
+	Num   int    `json:"num"`
+}
+
+// SilentPeriod limits when and how often the AI camera triggers
+type SilentPeriod struct {
+	SilenceDuration int         `json:"silence_duration"`      // Seconds between triggers
+	TimePeriod      *TimePeriod `json:"time_period,omitempty"` // nil = any time
+}
+
+// TimePeriod is the days and hours the AI camera runs in
+type TimePeriod struct {
+	Repeat    []int  `json:"repeat"`     // 7 flags, Sunday first
+	TimeStart string `json:"time_start"` // HH:MM:SS
+	TimeEnd   string `json:"time_end"`   // HH:MM:SS
+}
+
+// ImageAnalyzerNode sends the large image to the image analyzer service for verification
+type ImageAnalyzerNode struct {
+	NodeHeader
+	Params ImageAnalyzerParams `json:"params"`
+}
+
+// ImageAnalyzerParams configures the image analyzer module
+type ImageAnalyzerParams struct {
+	Body ImageAnalyzerBody `json:"body"`
+}
+
+// ImageAnalyzerBody is what the device sends with each image (see ImageAnalyzerRequest)
+type ImageAnalyzerBody struct {
+	Prompt   string `json:"prompt"`
+	Type     int    `json:"type"` // 0 = recognize, 1 = monitoring
+	AudioTxt string `json:"audio_txt"`
+}
+
+// LocalAlarmNode beeps, lights the LED and shows the alarm on the device
+type LocalAlarmNode struct {
+	NodeHeader
+	Params LocalAlarmParams `json:"params"`
+}
+
+// LocalAlarmParams configures the local alarm module (the flags are 0 or 1)
+type LocalAlarmParams struct {
+	Sound    int `json:"sound"`
+	RGB      int `json:"rgb"`
+	Img      int `json:"img"`
+	Text     int `json:"text"`
+	Duration int `json:"duration"` // Seconds
+}
+
+// SenseCraftAlarmNode sends the alarm to the notification proxy (our server)
+type SenseCraftAlarmNode struct {
+	NodeHeader
+	Params SenseCraftAlarmParams `json:"params"`
+}
+
+// SenseCraftAlarmParams configures the SenseCraft alarm module
+type SenseCraftAlarmParams struct {
+	SilenceDuration int `json:"silence_duration"` // Seconds between notifications
+}
+
+// HTTPAlarmNode sends the alarm to an HTTP server of the task's choosing instead of the
+// notification proxy the device was bound to
+type HTTPAlarmNode struct {
+	NodeHeader
+	Params HTTPAlarmParams `json:"params"`
+}
+
+// HTTPAlarmParams configures the HTTP alarm module (the flags are 0 or 1)
+type HTTPAlarmParams struct {
+	SilenceDuration int    `json:"silence_duration"` // Seconds between notifications
+	TimeEn          int    `json:"time_en"`          // Send the time of the alarm
+	TextEn          int    `json:"text_en"`          // Send Text
+	ImageEn         int    `json:"image_en"`         // Send the image
+	SensorEn        int    `json:"sensor_en"`        // Send the sensor readings
+	Text            string `json:"text"`
+	URL             string `json:"url"`   // Server the alarm is posted to (http or https)
+	Token           string `json:"token"` // Sent as the Authorization header (empty = none)
+}
+
+// OtherNode is a node of a module this server does not build (e.g. an alarm trigger),
+// kept with its params as they are
+type OtherNode struct {
+	NodeHeader
+	Params json.RawMessage `json:"params"`
+}
+
+// NewTaskList builds a task flow of nodes, numbering their index by position
+func NewTaskList(tlid int, created time.Time, name string, nodes ...Node) *TaskList {
+	for i, n := range nodes {
+		n.header().Index = i
+	}
+	return &TaskList{TLID: tlid, CTD: created.UnixMilli(), Name: name, TaskFlow: nodes}
+}
+
+// NewAICameraNode builds an AI camera node wired to the nodes with the IDs in wires
+func NewAICameraNode(id int, params AICameraParams, wires ...int) *AICameraNode {
+	return &AICameraNode{NodeHeader: newHeader(id, ModuleAICamera, wires), Params: params}
+}
+
+// NewImageAnalyzerNode builds an image analyzer node wired to the nodes with the IDs in wires
+func NewImageAnalyzerNode(id int, params ImageAnalyzerParams, wires ...int) *ImageAnalyzerNode {
+	return &ImageAnalyzerNode{NodeHeader: newHeader(id, ModuleImageAnalyzer, wires), Params: params}
+}
+
+// NewLocalAlarmNode builds a local alarm node (a terminal node)
+func NewLocalAlarmNode(id int, params LocalAlarmParams) *LocalAlarmNode {
+	return &LocalAlarmNode{NodeHeader: newHeader(id, ModuleLocalAlarm, nil), Params: params}
+}
+
+// NewSenseCraftAlarmNode builds a SenseCraft alarm node (a terminal node)
+func NewSenseCraftAlarmNode(id int, params SenseCraftAlarmParams) *SenseCraftAlarmNode {
+	return &SenseCraftAlarmNode{NodeHeader: newHeader(id, ModuleSenseCraftAlarm, nil), Params: params}
+}
+
+// NewHTTPAlarmNode builds an HTTP alarm node (a terminal node)
+func NewHTTPAlarmNode(id int, params HTTPAlarmParams) *HTTPAlarmNode {
+	return &HTTPAlarmNode{NodeHeader: newHeader(id, ModuleHTTPAlarm, nil), Params: params}
+}
+
+func newHeader(id int, module string, wires []int) NodeHeader {
+	h := NodeHeader{ID: id, Type: module, Wires: [][]int{}}
+	if len(wires) > 0 {
+		h.Wires = [][]int{wires}
+	}
+	return h
+}
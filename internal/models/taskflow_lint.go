@@ -0,0 +1,371 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Severities of task flow issues
+const (
+	IssueError   = "error"   // The firmware cannot run the flow, or runs it wrongly
+	IssueWarning = "warning" // The flow runs, but probably not as intended
+)
+
+// Issue is a problem found in a task flow
+type Issue struct {
+	Severity string `json:"severity"`       // IssueError or IssueWarning
+	Node     int    `json:"node,omitempty"` // ID of the node it concerns (0 = the whole flow)
+	Message  string `json:"message"`
+}
+
+func (i Issue) Error() string {
+	if i.Node != 0 {
+		return fmt.Sprintf("node %d: %s", i.Node, i.Message)
+	}
+	return i.Message
+}
+
+// linter collects the issues of a task flow
+type linter struct {
+	issues []Issue
+	node   int // Node being checked
+}
+
+func (l *linter) errorf(format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{Severity: IssueError, Node: l.node, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{Severity: IssueWarning, Node: l.node, Message: fmt.Sprintf(format, args...)})
+}
+
+// Required keys of a task flow, its nodes, and the params of each module
+var (
+	taskListKeys = []string{"type", "tlid", "ctd", "tn", "task_flow"}
+	nodeKeys     = []string{"id", "type", "index", "params", "wires"}
+	paramKeys    = map[string][]string{
+		ModuleAICamera:        {"modes", "model_type", "conditions", "conditions_combo", "silent_period", "output_type", "shutter"},
+		ModuleImageAnalyzer:   {"body"},
+		ModuleLocalAlarm:      {"sound", "rgb", "img", "text", "duration"},
+		ModuleSenseCraftAlarm: {"silence_duration"},
+		ModuleHTTPAlarm:       {"silence_duration", "url"},
+	}
+)
+
+// ParseTaskList decodes a task flow in the firmware's format (data.tl of view_task_detail),
+// reporting missing keys and values of the wrong type as issues. The flow is nil when it
+// cannot be decoded at all; otherwise Lint finds the remaining issues.
+func ParseTaskList(data []byte) (*TaskList, []Issue) {
+	l := &linter{}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		l.errorf("not a JSON object: %v", err)
+		return nil, l.issues
+	}
+	requireKeys(l, fields, taskListKeys, "")
+
+	var raw struct {
+		Type     int               `json:"type"`
+		TLID     int               `json:"tlid"`
+		CTD      int64             `json:"ctd"`
+		Name     string            `json:"tn"`
+		TaskFlow []json.RawMessage `json:"task_flow"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		l.errorf("invalid task flow: %v", err)
+		return nil, l.issues
+	}
+
+	t := &TaskList{Type: raw.Type, TLID: raw.TLID, CTD: raw.CTD, Name: raw.Name, TaskFlow: []Node{}}
+	for i, data := range raw.TaskFlow {
+		l.node = 0
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			l.errorf("task_flow[%d] is not a JSON object", i)
+			continue
+		}
+
+		var h NodeHeader
+		if err := json.Unmarshal(data, &h); err != nil {
+			l.errorf("task_flow[%d]: %v", i, err)
+			continue
+		}
+		l.node = h.ID
+		requireKeys(l, fields, nodeKeys, "")
+
+		var n Node
+		switch h.Type {
+		case ModuleAICamera:
+			n = &AICameraNode{}
+		case ModuleImageAnalyzer:
+			n = &ImageAnalyzerNode{}
+		case ModuleLocalAlarm:
+			n = &LocalAlarmNode{}
+		case ModuleSenseCraftAlarm:
+			n = &SenseCraftAlarmNode{}
+		case ModuleHTTPAlarm:
+			n = &HTTPAlarmNode{}
+		case ModuleAlarmTrigger:
+			n = &OtherNode{}
+		default:
+			l.errorf("unknown module type %q", h.Type)
+			continue
+		}
+		if err := json.Unmarshal(data, n); err != nil {
+			l.errorf("invalid params: %v", err)
+			continue
+		}
+
+		if keys := paramKeys[h.Type]; keys != nil {
+			var params map[string]json.RawMessage
+			if json.Unmarshal(fields["params"], &params) == nil {
+				requireKeys(l, params, keys, "params.")
+			}
+			if h.Type == ModuleImageAnalyzer {
+				var body map[string]json.RawMessage
+				if json.Unmarshal(params["body"], &body) == nil {
+					requireKeys(l, body, []string{"prompt", "type"}, "params.body.")
+				}
+			}
+		}
+		t.TaskFlow = append(t.TaskFlow, n)
+	}
+	return t, l.issues
+}
+
+func requireKeys(l *linter, fields map[string]json.RawMessage, keys []string, prefix string) {
+	for _, key := range keys {
+		if _, ok := fields[key]; !ok {
+			l.errorf("missing %s%s", prefix, key)
+		}
+	}
+}
+
+// Lint checks a task flow for what would keep the firmware from running it as intended:
+// node wiring (unique IDs, wires to existing nodes, no cycles, every node reachable from
+// the AI camera), parameter ranges, and whether the AI camera's model detects the classes
+// of its conditions
+func (t *TaskList) Lint() []Issue {
+	l := &linter{}
+	if len(t.TaskFlow) == 0 {
+		l.errorf("the task flow has no nodes")
+		return l.issues
+	}
+
+	nodes := make(map[int]Node)
+	var cameras []int
+	for i, n := range t.TaskFlow {
+		h := n.header()
+		l.node = h.ID
+		if _, ok := nodes[h.ID]; ok {
+			l.errorf("duplicate node ID")
+			continue
+		}
+		nodes[h.ID] = n
+		if h.Index != i {
+			l.warnf("index %d does not match its position %d in task_flow", h.Index, i)
+		}
+		if h.Type == ModuleAICamera {
+			cameras = append(cameras, h.ID)
+		}
+	}
+
+	for _, n := range t.TaskFlow {
+		h := n.header()
+		l.node = h.ID
+		for _, output := range h.Wires {
+			for _, id := range output {
+				switch {
+				case id == h.ID:
+					l.errorf("wired to itself")
+				case nodes[id] == nil:
+					l.errorf("wired to unknown node %d", id)
+				}
+			}
+		}
+		if (h.Type == ModuleLocalAlarm || h.Type == ModuleSenseCraftAlarm || h.Type == ModuleHTTPAlarm) && len(slices.Concat(h.Wires...)) > 0 {
+			l.warnf("%s nodes have no output, their wires are ignored", h.Type)
+		}
+		n.lint(l)
+	}
+
+	l.node = 0
+	switch len(cameras) {
+	case 0:
+		l.errorf("no %s node: nothing triggers the flow", ModuleAICamera)
+	case 1:
+		lintReachability(l, t.TaskFlow, nodes, cameras[0])
+	default:
+		l.errorf("%d %s nodes: the firmware runs one", len(cameras), ModuleAICamera)
+	}
+	return l.issues
+}
+
+// lintReachability reports cycles and nodes the AI camera's output never reaches
+func lintReachability(l *linter, flow []Node, nodes map[int]Node, start int) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[int]int)
+	var visit func(id int)
+	visit = func(id int) {
+		state[id] = visiting
+		for _, output := range nodes[id].header().Wires {
+			for _, next := range output {
+				if nodes[next] == nil || next == id {
+					continue // Reported with the wiring
+				}
+				switch state[next] {
+				case visiting:
+					l.node = next
+					l.errorf("part of a wiring cycle")
+				case 0:
+					visit(next)
+				}
+			}
+		}
+		state[id] = done
+	}
+	visit(start)
+
+	for _, n := range flow {
+		if h := n.header(); state[h.ID] == 0 {
+			l.node = h.ID
+			l.warnf("not reachable from the %s node, the %s never runs", ModuleAICamera, h.Type)
+		}
+	}
+	l.node = 0
+}
+
+// Validate returns the first error Lint finds (warnings are not errors)
+func (t *TaskList) Validate() error {
+	for _, issue := range t.Lint() {
+		if issue.Severity == IssueError {
+			return fmt.Errorf("task flow %d: %w", t.TLID, issue)
+		}
+	}
+	return nil
+}
+
+func (n *AICameraNode) lint(l *linter) {
+	p := n.Params
+	if p.ModelType < ModelCloud || p.ModelType > ModelGesture {
+		l.errorf("invalid model_type %d", p.ModelType)
+	}
+	if p.Model != nil && (p.ModelType != ModelCloud || p.Model.Arguments.URL == "") {
+		l.errorf("a model needs model_type 0 and a url")
+	}
+	if p.ModelType == ModelCloud && p.Model == nil {
+		l.warnf("model_type 0 without a model: the device needs a SenseCraft cloud model")
+	}
+
+	if len(p.Conditions) == 0 {
+		l.errorf("no conditions")
+	}
+	for _, c := range p.Conditions {
+		switch {
+		case c.Class == "":
+			l.errorf("condition without a class")
+		case c.Mode < 0 || c.Mode > 2:
+			l.errorf("invalid condition mode %d", c.Mode)
+		case c.Type < 0 || c.Type > 2:
+			l.errorf("invalid condition type %d", c.Type)
+		case c.Num < 0:
+			l.errorf("negative condition num %d", c.Num)
+		}
+
+		classes := BuiltinModelClasses[p.ModelType]
+		if p.Model != nil {
+			classes = p.Model.Classes
+		}
+		if c.Class != "" && classes != nil && !slices.Contains(classes, c.Class) {
+			l.warnf("the model does not detect %q (it detects %v), the condition never holds", c.Class, classes)
+		}
+	}
+
+	if p.ConditionsCombo != 0 && p.ConditionsCombo != 1 {
+		l.errorf("invalid conditions_combo %d", p.ConditionsCombo)
+	}
+	if p.OutputType != 0 && p.OutputType != 1 {
+		l.errorf("invalid output_type %d", p.OutputType)
+	}
+	if p.Shutter < 0 || p.Shutter > 3 {
+		l.errorf("invalid shutter %d", p.Shutter)
+	}
+	if p.SilentPeriod.SilenceDuration < 0 {
+		l.errorf("negative silence_duration")
+	}
+	if tp := p.SilentPeriod.TimePeriod; tp != nil {
+		if len(tp.Repeat) != 7 {
+			l.errorf("time_period repeat needs 7 days, got %d", len(tp.Repeat))
+		}
+		for _, v := range tp.Repeat {
+			if v != 0 && v != 1 {
+				l.errorf("invalid time_period repeat flag %d", v)
+				break
+			}
+		}
+		if !slices.Contains(tp.Repeat, 1) {
+			l.warnf("time_period repeat has no day, the flow never runs")
+		}
+		for _, s := range []string{tp.TimeStart, tp.TimeEnd} {
+			if _, err := time.Parse("15:04:05", s); err != nil {
+				l.errorf("invalid time_period time %q", s)
+			}
+		}
+	}
+	if p.OutputType == 0 && len(n.Wires) > 0 {
+		l.warnf("output_type 0 sends no large image to the nodes it is wired to")
+	}
+}
+
+func (n *ImageAnalyzerNode) lint(l *linter) {
+	if n.Params.Body.Prompt == "" {
+		l.errorf("empty prompt")
+	}
+	if n.Params.Body.Type != 0 && n.Params.Body.Type != 1 {
+		l.errorf("invalid type %d", n.Params.Body.Type)
+	}
+}
+
+func (n *LocalAlarmNode) lint(l *linter) {
+	p := n.Params
+	for _, flag := range []int{p.Sound, p.RGB, p.Img, p.Text} {
+		if flag != 0 && flag != 1 {
+			l.errorf("invalid output flag %d", flag)
+			break
+		}
+	}
+	if p.Duration <= 0 {
+		l.errorf("duration must be positive")
+	}
+}
+
+func (n *SenseCraftAlarmNode) lint(l *linter) {
+	if n.Params.SilenceDuration < 0 {
+		l.errorf("negative silence_duration")
+	}
+}
+
+func (n *HTTPAlarmNode) lint(l *linter) {
+	p := n.Params
+	if p.SilenceDuration < 0 {
+		l.errorf("negative silence_duration")
+	}
+	for _, flag := range []int{p.TimeEn, p.TextEn, p.ImageEn, p.SensorEn} {
+		if flag != 0 && flag != 1 {
+			l.errorf("invalid output flag %d", flag)
+			break
+		}
+	}
+	if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.errorf("url must be an http or https URL, got %q", p.URL)
+	}
+}
+
+func (n *OtherNode) lint(l *linter) {}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(t *TaskList)
+		severity string // Expected severity of the issue ("" = no issues)
+		node     int
+		message  string // Substring of the expected issue's message
+	}{
+		{name: "valid", change: func(t *TaskList) {}},
+
+		// Wiring
+		{name: "no nodes", change: func(t *TaskList) { t.TaskFlow = nil },
+			severity: IssueError, message: "no nodes"},
+		{name: "duplicate ID", change: func(t *TaskList) { t.TaskFlow[3].header().ID = 3 },
+			severity: IssueError, node: 3, message: "duplicate node ID"},
+		{name: "wired to unknown node", change: func(t *TaskList) { t.TaskFlow[1].header().Wires = [][]int{{3, 9}} },
+			severity: IssueError, node: 2, message: "unknown node 9"},
+		{name: "wired to itself", change: func(t *TaskList) { t.TaskFlow[1].header().Wires = [][]int{{2, 3, 4}} },
+			severity: IssueError, node: 2, message: "wired to itself"},
+		{name: "cycle", change: func(t *TaskList) { t.TaskFlow[1].header().Wires = [][]int{{1, 3, 4}} },
+			severity: IssueError, node: 1, message: "cycle"},
+		{name: "unreachable node", change: func(t *TaskList) { t.TaskFlow[1].header().Wires = [][]int{{3}} },
+			severity: IssueWarning, node: 4, message: "not reachable"},
+		{name: "wires from an alarm", change: func(t *TaskList) { t.TaskFlow[2].header().Wires = [][]int{{4}} },
+			severity: IssueWarning, node: 3, message: "have no output"},
+		{name: "no AI camera", change: func(t *TaskList) { t.TaskFlow = t.TaskFlow[1:] },
+			severity: IssueError, message: "nothing triggers"},
+		{name: "index out of place", change: func(t *TaskList) { t.TaskFlow[2].header().Index = 7 },
+			severity: IssueWarning, node: 3, message: "does not match its position"},
+
+		// Parameters
+		{name: "no conditions", change: func(t *TaskList) { camera(t).Params.Conditions = nil },
+			severity: IssueError, node: 1, message: "no conditions"},
+		{name: "invalid shutter", change: func(t *TaskList) { camera(t).Params.Shutter = 4 },
+			severity: IssueError, node: 1, message: "invalid shutter"},
+		{name: "bad time period", change: func(t *TaskList) { camera(t).Params.SilentPeriod.TimePeriod.TimeEnd = "25:00" },
+			severity: IssueError, node: 1, message: "invalid time_period time"},
+		{name: "empty prompt", change: func(t *TaskList) { t.TaskFlow[1].(*ImageAnalyzerNode).Params.Body.Prompt = "" },
+			severity: IssueError, node: 2, message: "empty prompt"},
+		{name: "zero alarm duration", change: func(t *TaskList) { t.TaskFlow[2].(*LocalAlarmNode).Params.Duration = 0 },
+			severity: IssueError, node: 3, message: "duration must be positive"},
+		{name: "http alarm without URL", change: func(t *TaskList) { t.TaskFlow[3] = NewHTTPAlarmNode(4, HTTPAlarmParams{URL: "hooks.example.com"}) },
+			severity: IssueError, node: 4, message: "http or https URL"},
+
+		// Model and classes
+		{name: "invalid model type", change: func(t *TaskList) { camera(t).Params.ModelType = 7; camera(t).Params.Model = nil },
+			severity: IssueError, node: 1, message: "invalid model_type 7"},
+		{name: "model with a built-in model type", change: func(t *TaskList) { camera(t).Params.ModelType = ModelPerson },
+			severity: IssueError, node: 1, message: "needs model_type 0"},
+		{name: "class the model does not detect", change: func(t *TaskList) { camera(t).Params.Conditions[0].Class = "truck" },
+			severity: IssueWarning, node: 1, message: `does not detect "truck"`},
+		{name: "class the built-in model does not detect", change: func(t *TaskList) {
+			camera(t).Params.ModelType = ModelPet
+			camera(t).Params.Model = nil
+		}, severity: IssueWarning, node: 1, message: `does not detect "forklift"`},
+		{name: "cloud model without a model", change: func(t *TaskList) { camera(t).Params.Model = nil },
+			severity: IssueWarning, node: 1, message: "needs a SenseCraft cloud model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := sampleTaskList()
+			tt.change(flow)
+			issues := flow.Lint()
+
+			if tt.severity == "" {
+				if len(issues) > 0 {
+					t.Errorf("issues in a valid flow: %v", issues)
+				}
+				return
+			}
+			for _, issue := range issues {
+				if issue.Severity == tt.severity && issue.Node == tt.node && strings.Contains(issue.Message, tt.message) {
+					return
+				}
+			}
+			t.Errorf("no %s on node %d containing %q, got %v", tt.severity, tt.node, tt.message, issues)
+		})
+	}
+}
+
+// camera returns the AI camera node of sampleTaskList
+func camera(t *TaskList) *AICameraNode {
+	return t.TaskFlow[0].(*AICameraNode)
+}
+
+func TestParseTaskListIssues(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		node    int
+		message string
+	}{
+		{name: "not an object", json: `[]`, message: "not a JSON object"},
+		{name: "missing key", json: `{"type":0,"tlid":1,"ctd":0,"task_flow":[]}`, message: "missing tn"},
+		{name: "unknown module", json: `{"type":0,"tlid":1,"ctd":0,"tn":"x","task_flow":[{"id":1,"type":"laser","index":0,"params":{},"wires":[]}]}`,
+			node: 1, message: `unknown module type "laser"`},
+		{name: "missing param", json: `{"type":0,"tlid":1,"ctd":0,"tn":"x","task_flow":[{"id":3,"type":"local alarm","index":0,"params":{"sound":1,"rgb":1,"img":0,"text":0},"wires":[]}]}`,
+			node: 3, message: "missing params.duration"},
+		{name: "missing prompt", json: `{"type":0,"tlid":1,"ctd":0,"tn":"x","task_flow":[{"id":2,"type":"image analyzer","index":0,"params":{"body":{"type":1}},"wires":[]}]}`,
+			node: 2, message: "missing params.body.prompt"},
+		{name: "wrong type", json: `{"type":0,"tlid":1,"ctd":0,"tn":"x","task_flow":[{"id":4,"type":"sensecraft alarm","index":0,"params":{"silence_duration":"30"},"wires":[]}]}`,
+			node: 4, message: "invalid params"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, issues := ParseTaskList([]byte(tt.json))
+			for _, issue := range issues {
+				if issue.Severity == IssueError && issue.Node == tt.node && strings.Contains(issue.Message, tt.message) {
+					return
+				}
+			}
+			t.Errorf("no error on node %d containing %q, got %v", tt.node, tt.message, issues)
+		})
+	}
+}
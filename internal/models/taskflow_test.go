@@ -0,0 +1,203 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sampleTaskList is the task flow the server builds for a task counting forklifts (a custom
+// model) on weekdays during working hours: an AI camera wired to an image analyzer, wired to
+// a local and a SenseCraft alarm
+func sampleTaskList() *TaskList {
+	return NewTaskList(12, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "Forklifts in the yard",
+		NewAICameraNode(1, AICameraParams{
+			Modes:     0,
+			ModelType: ModelCloud,
+			Model: &AICameraModel{
+				ModelID:   "60086",
+				Version:   "1.0.0",
+				ModelName: "forklift",
+				Classes:   []string{"forklift"},
+				Checksum:  "abc123",
+				Arguments: ModelArguments{URL: "http://server/models/forklift.tflite", Size: 2048.5, Task: "detect"},
+			},
+			Conditions:      []AICameraCondition{{Class: "forklift", Mode: 1, Type: 2, Num: 2}},
+			ConditionsCombo: 0,
+			SilentPeriod: SilentPeriod{
+				SilenceDuration: 5,
+				TimePeriod:      &TimePeriod{Repeat: []int{0, 1, 1, 1, 1, 1, 0}, TimeStart: "08:00:00", TimeEnd: "18:00:00"},
+			},
+			OutputType: 1,
+			Shutter:    0,
+		}, 2),
+		NewImageAnalyzerNode(2, ImageAnalyzerParams{
+			Body: ImageAnalyzerBody{Prompt: "Are there more than two forklifts in the yard?", Type: 1},
+		}, 3, 4),
+		NewLocalAlarmNode(3, LocalAlarmParams{Sound: 1, RGB: 1, Duration: 5}),
+		NewSenseCraftAlarmNode(4, SenseCraftAlarmParams{SilenceDuration: 30}),
+	)
+}
+
+// sampleTaskListMaps is sampleTaskList as the map-building convertToNodeREDFormat the node
+// types replaced produced it
+func sampleTaskListMaps() map[string]interface{} {
+	return map[string]interface{}{
+		"type": 0,
+		"tlid": 12,
+		"ctd":  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli(),
+		"tn":   "Forklifts in the yard",
+		"task_flow": []map[string]interface{}{
+			{
+				"id":    1,
+				"type":  "ai camera",
+				"index": 0,
+				"params": map[string]interface{}{
+					"modes":      0,
+					"model_type": 0,
+					"conditions": []map[string]interface{}{
+						{"class": "forklift", "mode": 1, "type": 2, "num": 2},
+					},
+					"conditions_combo": 0,
+					"silent_period": map[string]interface{}{
+						"silence_duration": 5,
+						"time_period": map[string]interface{}{
+							"repeat":     []int{0, 1, 1, 1, 1, 1, 0},
+							"time_start": "08:00:00",
+							"time_end":   "18:00:00",
+						},
+					},
+					"output_type": 1,
+					"shutter":     0,
+					"model": map[string]interface{}{
+						"model_id":   "60086",
+						"version":    "1.0.0",
+						"model_name": "forklift",
+						"classes":    []string{"forklift"},
+						"checksum":   "abc123",
+						"arguments": map[string]interface{}{
+							"url":  "http://server/models/forklift.tflite",
+							"size": 2048.5,
+							"task": "detect",
+						},
+					},
+				},
+				"wires": [][]int{{2}},
+			},
+			{
+				"id":    2,
+				"type":  "image analyzer",
+				"index": 1,
+				"params": map[string]interface{}{
+					"body": map[string]interface{}{
+						"prompt":    "Are there more than two forklifts in the yard?",
+						"type":      1,
+						"audio_txt": "",
+					},
+				},
+				"wires": [][]int{{3, 4}},
+			},
+			{
+				"id":    3,
+				"type":  "local alarm",
+				"index": 2,
+				"params": map[string]interface{}{
+					"sound":    1,
+					"rgb":      1,
+					"img":      0,
+					"text":     0,
+					"duration": 5,
+				},
+				"wires": [][]int{},
+			},
+			{
+				"id":    4,
+				"type":  "sensecraft alarm",
+				"index": 3,
+				"params": map[string]interface{}{
+					"silence_duration": 30,
+				},
+				"wires": [][]int{},
+			},
+		},
+	}
+}
+
+// decodeJSON marshals v and decodes it into generic values, so JSON documents can be compared
+// regardless of key order and Go types
+func decodeJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestTaskListMatchesMapFormat(t *testing.T) {
+	got := decodeJSON(t, sampleTaskList())
+	want := decodeJSON(t, sampleTaskListMaps())
+	if reflect.DeepEqual(got, want) {
+		return
+	}
+
+	// Report the differing nodes one by one
+	gotFlow := got.(map[string]interface{})["task_flow"].([]interface{})
+	wantFlow := want.(map[string]interface{})["task_flow"].([]interface{})
+	if len(gotFlow) != len(wantFlow) {
+		t.Fatalf("%d nodes, want %d", len(gotFlow), len(wantFlow))
+	}
+	for i := range gotFlow {
+		if !reflect.DeepEqual(gotFlow[i], wantFlow[i]) {
+			gotJSON, _ := json.Marshal(gotFlow[i])
+			wantJSON, _ := json.Marshal(wantFlow[i])
+			t.Errorf("node %d:\n got  %s\n want %s", i, gotJSON, wantJSON)
+		}
+	}
+	delete(got.(map[string]interface{}), "task_flow")
+	delete(want.(map[string]interface{}), "task_flow")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("task list fields: got %v, want %v", got, want)
+	}
+}
+
+func TestNodeTypesRoundTrip(t *testing.T) {
+	flow := sampleTaskList()
+	flow.TaskFlow = append(flow.TaskFlow,
+		NewHTTPAlarmNode(5, HTTPAlarmParams{SilenceDuration: 60, TimeEn: 1, TextEn: 1, Text: "Forklift", URL: "https://hooks.example.com/alarm", Token: "secret"}),
+		&OtherNode{NodeHeader: newHeader(6, ModuleAlarmTrigger, nil), Params: json.RawMessage(`{"text":"x"}`)},
+	)
+	flow.TaskFlow[1].header().Wires = [][]int{{3, 4, 5, 6}}
+	flow = NewTaskList(flow.TLID, time.UnixMilli(flow.CTD), flow.Name, flow.TaskFlow...)
+
+	data, err := json.Marshal(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, issues := ParseTaskList(data)
+	if len(issues) > 0 {
+		t.Fatalf("issues parsing a built flow: %v", issues)
+	}
+	if !reflect.DeepEqual(decodeJSON(t, parsed), decodeJSON(t, flow)) {
+		t.Errorf("round trip changed the flow:\n got  %s\n want %s", mustJSON(t, parsed), data)
+	}
+	for i, n := range parsed.TaskFlow {
+		if reflect.TypeOf(n) != reflect.TypeOf(flow.TaskFlow[i]) {
+			t.Errorf("node %d parsed as %T, want %T", i, n, flow.TaskFlow[i])
+		}
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,220 @@
+// Package mqtt is a minimal MQTT 3.1.1 publisher (QoS 0 publishes and keep-alive pings),
+// shared by the integrations that publish to a broker, so the server needs no MQTT dependency.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types (first byte, without flags)
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPingreq    = 0xC0
+	packetPingresp   = 0xD0
+	packetDisconnect = 0xE0
+)
+
+// keepAlive is the MQTT keep-alive announced to the broker; a ping is sent after half of it
+// without other packets
+const keepAlive = 60 * time.Second
+
+// Client is a connection to a broker that only publishes. It never subscribes, so the only
+// packets the broker sends after CONNACK are ping responses. Not safe for concurrent use.
+type Client struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	lastSent time.Time
+}
+
+// Dial connects to a broker (mqtt:// or mqtts:// URL, credentials in the user info)
+func Dial(rawURL, clientID string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT URL: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "mqtts" {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if u.Scheme == "mqtts" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %s: %w", host, err)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.connect(u.User, clientID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect sends CONNECT (clean session) and waits for the broker's CONNACK
+func (c *Client) connect(user *url.Userinfo, clientID string) error {
+	flags := byte(0x02) // Clean session
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4) // Protocol level 3.1.1
+	var password string
+	var hasPassword bool
+	if user != nil {
+		flags |= 0x80
+		password, hasPassword = user.Password()
+		if hasPassword {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive.Seconds()))
+	body = appendString(body, clientID)
+	if user != nil {
+		body = appendString(body, user.Username())
+		if hasPassword {
+			body = appendString(body, password)
+		}
+	}
+	if err := c.send(packetConnect, body); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+	packetType, ack, err := c.receive()
+	if err != nil {
+		return fmt.Errorf("no CONNACK from MQTT broker: %w", err)
+	}
+	if packetType != packetConnack || len(ack) != 2 {
+		return fmt.Errorf("unexpected packet 0x%02x from MQTT broker instead of CONNACK", packetType)
+	}
+	switch ack[1] {
+	case 0:
+		return nil
+	case 4, 5:
+		return fmt.Errorf("MQTT broker refused the connection: not authorized (code %d)", ack[1])
+	}
+	return fmt.Errorf("MQTT broker refused the connection (code %d)", ack[1])
+}
+
+// Publish sends a QoS 0 message
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	header := byte(packetPublish)
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(make([]byte, 0, len(topic)+2+len(payload)), topic)
+	return c.send(header, append(body, payload...))
+}
+
+// Ping pings the broker when nothing was sent for half the keep-alive, and checks that it
+// still answers
+func (c *Client) Ping() error {
+	if time.Since(c.lastSent) < keepAlive/2 {
+		return nil
+	}
+	if err := c.send(packetPingreq, nil); err != nil {
+		return err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+	packetType, _, err := c.receive()
+	if err != nil {
+		return fmt.Errorf("no ping response from MQTT broker: %w", err)
+	}
+	if packetType != packetPingresp {
+		return fmt.Errorf("unexpected packet 0x%02x from MQTT broker instead of a ping response", packetType)
+	}
+	return nil
+}
+
+// Close disconnects cleanly
+func (c *Client) Close() {
+	c.send(packetDisconnect, nil)
+	c.conn.Close()
+}
+
+// send writes a packet: header byte, remaining length, body
+func (c *Client) send(header byte, body []byte) error {
+	packet := append([]byte{header}, remainingLength(len(body))...)
+	packet = append(packet, body...)
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(packet); err != nil {
+		return fmt.Errorf("failed to write to MQTT broker: %w", err)
+	}
+	c.lastSent = time.Now()
+	return nil
+}
+
+// receive reads a packet and returns its type and body
+func (c *Client) receive() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
+
+// remainingLength encodes a packet's body length (7 bits per byte, continuation bit)
+func remainingLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+// appendBytes appends length-prefixed binary data
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,132 @@
+// Package nodered shapes the server's events for Node-RED: a flat event object that HTTP-in,
+// http request and SSE client nodes can route on without parsing nested JSON blobs, and a
+// sample flow wiring the event feed into an automation.
+package nodered
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/rules"
+)
+
+// APIPath is the path of the Node-RED endpoints below the base path. The version is part of
+// it so flows keep working when the rest of the API changes.
+const APIPath = "/api/nodered/v1"
+
+// Event is a notification event flattened for Node-RED. All fields are always present, so
+// switch nodes can test them without checking for undefined.
+type Event struct {
+	ID                int       `json:"id"` // Increasing in storage order, the cursor of the feed
+	EventType         string    `json:"event_type"`
+	DeviceEUI         string    `json:"device_eui"`
+	DeviceName        string    `json:"device_name"` // Registered name ("" if unregistered)
+	Time              time.Time `json:"time"`        // When the device raised the event
+	Timestamp         int64     `json:"timestamp"`   // Same, Unix milliseconds
+	Text              string    `json:"text"`
+	Class             string    `json:"class"`   // Object detected with the best score ("" if none)
+	Score             float64   `json:"score"`   // Its score, 0-1
+	Classes           []string  `json:"classes"` // All detected object classes
+	Objects           int       `json:"objects"` // Number of detections (boxes and classifications)
+	TLID              int       `json:"tlid"`    // Task flow that raised the event (0 = none)
+	TaskHeadline      string    `json:"task_headline"`
+	Suppressed        bool      `json:"suppressed"`  // Alarm during its task's cooldown
+	Temperature       *float64  `json:"temperature"` // Celsius, null without a reading
+	Humidity          *int      `json:"humidity"`    // Percent, null without a reading
+	CO2               *int      `json:"co2"`         // PPM, null without a reading
+	ImageURL          string    `json:"image_url"`   // Absolute, "" without an image; needs the same credentials as the feed
+	AnnotatedImageURL string    `json:"annotated_image_url"`
+}
+
+// Flatten converts events for Node-RED. apiBaseURL is the server's external URL, used for
+// the image links.
+func Flatten(events []*database.NotificationEvent, apiBaseURL string) []Event {
+	imageBase := strings.TrimRight(apiBaseURL, "/") + APIPath + "/events/"
+	names := make(map[string]string)
+	flat := make([]Event, 0, len(events))
+	for _, event := range events {
+		name, ok := names[event.DeviceEUI]
+		if !ok {
+			name = deviceName(event.DeviceEUI)
+			names[event.DeviceEUI] = name
+		}
+
+		at := rules.EventTime(event)
+		e := Event{
+			ID:           event.ID,
+			EventType:    event.EventType,
+			DeviceEUI:    event.DeviceEUI,
+			DeviceName:   name,
+			Time:         at,
+			Timestamp:    at.UnixMilli(),
+			Text:         event.Text,
+			Classes:      rules.Classes(event),
+			TLID:         event.TLID,
+			TaskHeadline: event.TaskHeadline,
+			Suppressed:   event.Suppressed,
+		}
+		if e.Classes == nil {
+			e.Classes = []string{}
+		}
+		e.Class, e.Score, e.Objects = bestDetection(event.InferenceData)
+
+		var sensor models.SensorData
+		if event.SensorData != "" && json.Unmarshal([]byte(event.SensorData), &sensor) == nil {
+			e.Temperature, e.Humidity, e.CO2 = sensor.Temperature, sensor.Humidity, sensor.CO2
+		}
+
+		if event.Img != "" {
+			e.ImageURL = fmt.Sprintf("%s%d/image", imageBase, event.ID)
+			if len(imaging.InferenceBoxes(event.InferenceData)) > 0 {
+				e.AnnotatedImageURL = e.ImageURL + "/annotated"
+			}
+		}
+		flat = append(flat, e)
+	}
+	return flat
+}
+
+// bestDetection returns the class detected with the best score in an event's inference data
+// (JSON), its score (0-1) and the number of detections
+func bestDetection(inferenceData string) (class string, score float64, objects int) {
+	var inference models.InferenceData
+	if inferenceData == "" || json.Unmarshal([]byte(inferenceData), &inference) != nil {
+		return "", 0, 0
+	}
+
+	best := -1
+	consider := func(target, s int) {
+		objects++
+		if target >= 0 && target < len(inference.ClassesName) && s > best {
+			best, class = s, inference.ClassesName[target]
+		}
+	}
+	for _, b := range inference.Boxes {
+		consider(b[5], b[4])
+	}
+	for _, c := range inference.Classes {
+		consider(c[1], c[0])
+	}
+	if best > 0 {
+		score = float64(best) / 100
+	}
+	return class, score, objects
+}
+
+// deviceName returns a device's registered name ("" if it is not registered)
+func deviceName(eui string) string {
+	device, err := database.GetDevice(eui)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if device == nil {
+		return ""
+	}
+	return device.Name
+}
@@ -0,0 +1,131 @@
+package nodered
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+// node is a node of a Node-RED flow export
+type node = map[string]interface{}
+
+// pollRequest is the function node that builds the feed request: the events after the last
+// one seen, or the latest few on the first poll
+const pollRequest = `// Events after the newest one already seen (the latest 20 on the first poll)
+const after = flow.get('watcherAfter');
+msg.url = '%EVENTS%' + (after === undefined ? '?limit=20' : '?after=' + after);
+const token = env.get('WATCHER_TOKEN');
+msg.headers = token ? {Authorization: 'Bearer ' + token} : {};
+return msg;`
+
+// splitEvents is the function node that remembers the cursor and sends each event on its own
+const splitEvents = `// Remember the newest event and send each one as its own message,
+// with the topic <event_type>/<device name or EUI>
+const events = msg.payload;
+if (!Array.isArray(events) || events.length === 0) {
+    return null;
+}
+flow.set('watcherAfter', events[events.length - 1].id);
+return [events.map(e => ({payload: e, topic: e.event_type + '/' + (e.device_name || e.device_eui)}))];`
+
+// imageRequest is the function node that fetches an alarm's image
+const imageRequest = `// Fetch the alarm image (annotated with the detection boxes when there are any)
+if (!msg.payload.image_url) {
+    return null;
+}
+msg.event = msg.payload;
+msg.url = msg.payload.annotated_image_url || msg.payload.image_url;
+const token = env.get('WATCHER_TOKEN');
+msg.headers = token ? {Authorization: 'Bearer ' + token} : {};
+return msg;`
+
+// streamInfo documents the SSE alternative to polling in the flow's comment node
+const streamInfo = `The flow polls %EVENTS% every 10 seconds with core nodes only.
+
+Set the WATCHER_TOKEN environment variable of Node-RED to an API key or the server's AUTH_TOKEN (leave it unset when the API is open).
+
+To get events as they are stored instead, point an SSE client node (e.g. node-red-contrib-sse-client) at
+%EVENTS%/stream?token=<token>
+Each message's data is the same flat event; the event name is its event_type.`
+
+// SampleFlow returns a Node-RED flow (an importable JSON array) that polls the server's
+// event feed, routes events by type and fetches alarm images. serverURL is the server's
+// external URL including the base path.
+func SampleFlow(serverURL string) []node {
+	events := strings.TrimRight(serverURL, "/") + APIPath + "/events"
+	tab := "watcher-flow"
+
+	return []node{
+		{"id": tab, "type": "tab", "label": "SenseCAP Watcher", "disabled": false,
+			"info": "Events of the SenseCAP Watcher server at " + serverURL},
+		{"id": "watcher-info", "type": "comment", "z": tab, "name": "Read me: polling, token and SSE",
+			"info": strings.ReplaceAll(streamInfo, "%EVENTS%", events), "x": 190, "y": 40, "wires": []interface{}{}},
+		{"id": "watcher-poll", "type": "inject", "z": tab, "name": "Every 10 s",
+			"props": []node{{"p": "payload"}}, "repeat": "10", "crontab": "", "once": true, "onceDelay": "1",
+			"topic": "", "payload": "", "payloadType": "date",
+			"x": 130, "y": 100, "wires": [][]string{{"watcher-request"}}},
+		{"id": "watcher-request", "type": "function", "z": tab, "name": "Events since last poll",
+			"func": strings.ReplaceAll(pollRequest, "%EVENTS%", events), "outputs": 1,
+			"x": 330, "y": 100, "wires": [][]string{{"watcher-get"}}},
+		httpRequest(tab, "watcher-get", "GET events", "obj", 540, 100, "watcher-split"),
+		{"id": "watcher-split", "type": "function", "z": tab, "name": "One message per event",
+			"func": splitEvents, "outputs": 1,
+			"x": 750, "y": 100, "wires": [][]string{{"watcher-route"}}},
+		{"id": "watcher-route", "type": "switch", "z": tab, "name": "By event type",
+			"property": "payload.event_type", "propertyType": "msg",
+			"rules": []node{
+				{"t": "eq", "v": "alarm", "vt": "str"},
+				{"t": "eq", "v": "sensor", "vt": "str"},
+				{"t": "else"},
+			},
+			"checkall": "true", "repair": false, "outputs": 3,
+			"x": 960, "y": 100, "wires": [][]string{{"watcher-alarms", "watcher-image"}, {"watcher-sensors"}, {"watcher-other"}}},
+		debug(tab, "watcher-alarms", "Alarms", 1170, 60),
+		debug(tab, "watcher-sensors", "Sensor readings", 1190, 180),
+		debug(tab, "watcher-other", "Other events", 1180, 220),
+		{"id": "watcher-image", "type": "function", "z": tab, "name": "Alarm image request",
+			"func": imageRequest, "outputs": 1,
+			"x": 1200, "y": 120, "wires": [][]string{{"watcher-get-image"}}},
+		httpRequest(tab, "watcher-get-image", "GET image", "bin", 1400, 120, "watcher-image-out"),
+		debug(tab, "watcher-image-out", "Alarm image (JPEG buffer)", 1630, 120),
+	}
+}
+
+// httpRequest returns an http request node taking its URL and headers from the message
+func httpRequest(tab, id, name, ret string, x, y int, next string) node {
+	return node{"id": id, "type": "http request", "z": tab, "name": name,
+		"method": "GET", "ret": ret, "paytoqs": "ignore", "url": "", "tls": "", "persist": false,
+		"proxy": "", "insecureHTTPParser": false, "authType": "", "senderr": false, "headers": []interface{}{},
+		"x": x, "y": y, "wires": [][]string{{next}}}
+}
+
+// debug returns a debug node showing msg.payload in the sidebar
+func debug(tab, id, name string, x, y int) node {
+	return node{"id": id, "type": "debug", "z": tab, "name": name,
+		"active": true, "tosidebar": true, "console": false, "tostatus": false,
+		"complete": "payload", "targetType": "msg", "statusVal": "", "statusType": "auto",
+		"x": x, "y": y, "wires": []interface{}{}}
+}
+
+// EncodeSampleFlow writes the sample flow for a server at serverURL as indented JSON, as
+// Node-RED's export dialog does (without HTML escaping, so the function code stays readable)
+func EncodeSampleFlow(w io.Writer, serverURL string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(SampleFlow(serverURL))
+}
+
+// WriteSampleFlow writes the sample flow for a server at serverURL to a file
+func WriteSampleFlow(path, serverURL string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := EncodeSampleFlow(f, serverURL); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,153 @@
+// Package queue bounds the work sent to each AI backend: a pool admits a limited number of
+// calls at once and queues the rest in arrival order, up to a maximum queue length, so a burst
+// of devices waits its turn instead of overloading a single GPU. Pools keep queue-depth,
+// wait-time and connection reuse statistics for /health and the metrics export.
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned when a call arrives while the queue is at its maximum length
+var ErrFull = errors.New("queue full")
+
+// Stats is a snapshot of one pool
+type Stats struct {
+	Limit       int   `json:"limit"`        // Calls allowed at once (0 = unlimited)
+	MaxQueue    int   `json:"max_queue"`    // Calls allowed to wait (0 = unlimited)
+	Active      int   `json:"active"`       // Calls running now
+	Queued      int   `json:"queued"`       // Calls waiting now
+	PeakQueued  int   `json:"peak_queued"`  // Most calls waiting at once since the server started
+	Admitted    int64 `json:"admitted"`     // Calls started since the server started
+	Rejected    int64 `json:"rejected"`     // Calls turned away with a full queue
+	WaitMs      int64 `json:"wait_ms"`      // Total time admitted calls spent queued
+	NewConns    int64 `json:"new_conns"`    // Requests that opened a connection to the backend
+	ReusedConns int64 `json:"reused_conns"` // Requests sent on an idle keep-alive connection
+}
+
+// Pool admits calls to one backend
+type Pool struct {
+	mu       sync.Mutex
+	stats    Stats
+	waiters  []chan struct{} // Closed when the waiter is handed a slot, first in first out
+	waitTime time.Duration
+}
+
+var (
+	mu    sync.Mutex
+	pools = make(map[string]*Pool)
+)
+
+// New registers a pool under name (reported by Status)
+func New(name string) *Pool {
+	mu.Lock()
+	defer mu.Unlock()
+	p := &Pool{}
+	pools[name] = p
+	return p
+}
+
+// Acquire waits for a call slot and returns the function that frees it. limit and maxQueue
+// are read on every call (0 = unlimited), so changes from a config reload apply to the next
+// call. It returns ErrFull without waiting when maxQueue calls are already queued, and the
+// context's error if it is done first.
+func (p *Pool) Acquire(ctx context.Context, limit, maxQueue int) (func(), error) {
+	p.mu.Lock()
+	p.stats.Limit, p.stats.MaxQueue = limit, maxQueue
+	p.admit()
+	if len(p.waiters) == 0 && (limit <= 0 || p.stats.Active < limit) {
+		p.stats.Active++
+		p.stats.Admitted++
+		p.mu.Unlock()
+		return p.release, nil
+	}
+	if maxQueue > 0 && len(p.waiters) >= maxQueue {
+		p.stats.Rejected++
+		p.mu.Unlock()
+		return nil, ErrFull
+	}
+
+	ready := make(chan struct{})
+	p.waiters = append(p.waiters, ready)
+	if len(p.waiters) > p.stats.PeakQueued {
+		p.stats.PeakQueued = len(p.waiters)
+	}
+	p.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ready:
+		p.mu.Lock()
+		p.waitTime += time.Since(start)
+		p.mu.Unlock()
+		return p.release, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		for i, w := range p.waiters {
+			if w == ready {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				p.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		p.mu.Unlock()
+		// Handed a slot as the context ended: pass it on
+		p.release()
+		return nil, ctx.Err()
+	}
+}
+
+// release frees a slot and lets the longest waiting calls in
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Active--
+	p.admit()
+}
+
+// admit hands free slots to waiting calls in arrival order. A lowered limit takes effect as
+// running calls finish; a raised one lets waiting calls in at once.
+func (p *Pool) admit() {
+	for len(p.waiters) > 0 && (p.stats.Limit <= 0 || p.stats.Active < p.stats.Limit) {
+		close(p.waiters[0])
+		p.waiters = p.waiters[1:]
+		p.stats.Active++
+		p.stats.Admitted++
+	}
+}
+
+// GotConn counts the connection a request to the backend was sent on
+func (p *Pool) GotConn(reused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reused {
+		p.stats.ReusedConns++
+	} else {
+		p.stats.NewConns++
+	}
+}
+
+// Stats returns a snapshot of the pool
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Queued = len(p.waiters)
+	s.WaitMs = p.waitTime.Milliseconds()
+	return s
+}
+
+// Status returns a snapshot of every pool by name
+func Status() map[string]Stats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := make(map[string]Stats, len(pools))
+	for name, p := range pools {
+		snapshot[name] = p.Stats()
+	}
+	return snapshot
+}
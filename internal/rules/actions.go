@@ -0,0 +1,278 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+	"github.com/brianhealey/sensecap-server/internal/mqtt"
+)
+
+// twilioAPI is the Twilio REST API base URL
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// commandTimeout is how long a command action may run before it is killed
+const commandTimeout = 30 * time.Second
+
+// webhookPayload is the JSON body a webhook action posts, also published by MQTT actions and
+// given to commands on stdin
+type webhookPayload struct {
+	Rule    ruleRef      `json:"rule"`
+	Message string       `json:"message"` // Same text an SMS action would send
+	Event   eventSummary `json:"event"`
+}
+
+type ruleRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// eventSummary is an event with its image linked, embedded or left out, by the rule's image mode
+type eventSummary struct {
+	ID           int                `json:"id"`
+	DeviceEUI    string             `json:"device_eui"`
+	EventType    string             `json:"event_type"`
+	Text         string             `json:"text"`
+	Classes      []string           `json:"classes"`
+	TLID         int                `json:"tlid"`
+	TaskHeadline string             `json:"task_headline,omitempty"` // Headline of the task that fired, as it was then
+	Time         time.Time          `json:"time"`
+	Sensors      map[string]float64 `json:"sensors,omitempty"`   // Sensor readings by metric
+	ImageURL     string             `json:"image_url,omitempty"` // Needs management credentials
+	Image        string             `json:"image,omitempty"`     // Base64 JPEG, as redacted by the rule's image mode
+}
+
+// Message is the text sent for a rule firing on an event, e.g.
+// "Driveway at night: car on Driveway at 03:12 - Car in driveway"
+func Message(rule *database.EventRule, event *database.NotificationEvent) string {
+	device := event.DeviceEUI
+	if d, err := database.GetDevice(event.DeviceEUI); err == nil && d != nil && d.Name != "" {
+		device = d.Name
+	}
+
+	what := strings.Join(Classes(event), ", ")
+	if value, ok := SensorValues(event)[rule.Sensor]; ok {
+		what = fmt.Sprintf("%s %g", rule.Sensor, value)
+	}
+	if what == "" {
+		what = event.EventType
+	}
+
+	msg := fmt.Sprintf("%s: %s on %s at %s", rule.Name, what, device, EventTime(event).In(time.Local).Format("15:04"))
+	if event.Text != "" {
+		msg += " - " + event.Text
+	}
+	return msg
+}
+
+// payload returns the JSON body of a rule firing on an event
+func (e *engine) payload(rule *database.EventRule, event *database.NotificationEvent) ([]byte, error) {
+	payload := webhookPayload{
+		Rule:    ruleRef{ID: rule.ID, Name: rule.Name},
+		Message: Message(rule, event),
+		Event: eventSummary{
+			ID:           event.ID,
+			DeviceEUI:    event.DeviceEUI,
+			EventType:    event.EventType,
+			Text:         event.Text,
+			Classes:      Classes(event),
+			TLID:         event.TLID,
+			TaskHeadline: event.TaskHeadline,
+			Time:         EventTime(event),
+		},
+	}
+	if sensors := SensorValues(event); len(sensors) > 0 {
+		payload.Event.Sensors = sensors
+	}
+	if err := e.attachImage(&payload.Event, rule, event); err != nil {
+		return nil, err
+	}
+	return json.Marshal(payload)
+}
+
+// sendWebhook posts the event to the rule's URL
+func (e *engine) sendWebhook(rule *database.EventRule, event *database.NotificationEvent) error {
+	body, err := e.payload(rule, event)
+	if err != nil {
+		return err
+	}
+	return e.post(rule.Target, "application/json", bytes.NewReader(body), nil)
+}
+
+// attachImage links or embeds the event's image by the rule's image mode. An image that
+// cannot be redacted fails the action rather than being sent as stored.
+func (e *engine) attachImage(summary *eventSummary, rule *database.EventRule, event *database.NotificationEvent) error {
+	if event.Img == "" || rule.Image == database.RuleImageNone {
+		return nil
+	}
+	redact, ok := redactions[rule.Image]
+	if !ok {
+		summary.ImageURL = fmt.Sprintf("%s%d/image", e.imageBase, event.ID)
+		return nil
+	}
+
+	data, err := imaging.DecodeBase64JPEG(event.Img)
+	if err == nil {
+		data, err = redact(data, event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redact image (%s): %w", rule.Image, err)
+	}
+	summary.Image = base64.StdEncoding.EncodeToString(data)
+	return nil
+}
+
+// sendSMS texts the rule's phone number through Twilio
+func (e *engine) sendSMS(rule *database.EventRule, event *database.NotificationEvent) error {
+	if e.cfg.TwilioAccountSID == "" {
+		return fmt.Errorf("SMS is not configured (TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, TWILIO_FROM)")
+	}
+
+	form := url.Values{
+		"To":   {rule.Target},
+		"From": {e.cfg.TwilioFrom},
+		"Body": {Message(rule, event)},
+	}
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", twilioAPI, url.PathEscape(e.cfg.TwilioAccountSID))
+	return e.post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), func(req *http.Request) {
+		req.SetBasicAuth(e.cfg.TwilioAccountSID, e.cfg.TwilioAuthToken)
+	})
+}
+
+// sendNtfy pushes the message to the rule's ntfy topic URL (ntfy.sh or a self-hosted server),
+// titled with the rule name and tagged with the detected classes
+func (e *engine) sendNtfy(rule *database.EventRule, event *database.NotificationEvent) error {
+	return e.post(rule.Target, "text/plain", strings.NewReader(Message(rule, event)), func(req *http.Request) {
+		req.Header.Set("Title", rule.Name)
+		if classes := Classes(event); len(classes) > 0 {
+			req.Header.Set("Tags", strings.Join(classes, ","))
+		}
+	})
+}
+
+// publishMQTT publishes the event to the rule's topic on the rules broker, connecting first
+// if needed. An error drops the connection; the next MQTT action reconnects.
+func (e *engine) publishMQTT(rule *database.EventRule, event *database.NotificationEvent) error {
+	if e.cfg.MQTTURL == "" {
+		return fmt.Errorf("MQTT is not configured (RULES_MQTT_URL)")
+	}
+	body, err := e.payload(rule, event)
+	if err != nil {
+		return err
+	}
+
+	if e.mqtt == nil {
+		client, err := mqtt.Dial(e.cfg.MQTTURL, fmt.Sprintf("watcher-rules-%d", time.Now().UnixNano()%1000000))
+		if err != nil {
+			return err
+		}
+		e.mqtt = client
+	}
+	if err := e.mqtt.Publish(rule.Target, body, false); err != nil {
+		e.mqtt.Close()
+		e.mqtt = nil
+		return err
+	}
+	return nil
+}
+
+// pingMQTT keeps the connection of MQTT actions alive between firings
+func (e *engine) pingMQTT() {
+	if e.mqtt == nil {
+		return
+	}
+	if err := e.mqtt.Ping(); err != nil {
+		log.Printf("WARNING: Event rules MQTT connection lost: %v", err)
+		e.mqtt.Close()
+		e.mqtt = nil
+	}
+}
+
+// runCommand runs the rule's shell command with the event in WATCHER_* environment variables
+// and the webhook payload on stdin. It fails on a non-zero exit or after commandTimeout.
+func (e *engine) runCommand(rule *database.EventRule, event *database.NotificationEvent) error {
+	if !e.cfg.AllowCommands {
+		return fmt.Errorf("command actions are disabled (RULES_ALLOW_COMMANDS)")
+	}
+	body, err := e.payload(rule, event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", rule.Target)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", rule.Target)
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("WATCHER_RULE_ID=%d", rule.ID),
+		"WATCHER_RULE_NAME="+rule.Name,
+		"WATCHER_MESSAGE="+Message(rule, event),
+		fmt.Sprintf("WATCHER_EVENT_ID=%d", event.ID),
+		"WATCHER_EVENT_TYPE="+event.EventType,
+		"WATCHER_DEVICE_EUI="+event.DeviceEUI,
+		"WATCHER_CLASSES="+strings.Join(Classes(event), ","),
+		"WATCHER_TEXT="+event.Text,
+		fmt.Sprintf("WATCHER_TLID=%d", event.TLID),
+	)
+	if event.Img != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("WATCHER_IMAGE_URL=%s%d/image", e.imageBase, event.ID))
+	}
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command timed out after %s", commandTimeout)
+	}
+	if err != nil {
+		if len(output) > 512 {
+			output = output[len(output)-512:]
+		}
+		return fmt.Errorf("command failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// post sends a request, failing on connection errors and non-2xx responses
+func (e *engine) post(target, contentType string, body io.Reader, prepare func(*http.Request)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
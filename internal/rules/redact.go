@@ -0,0 +1,59 @@
+package rules
+
+import (
+	"sort"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/imaging"
+)
+
+// thumbnailWidth is the width of the image a thumbnail rule sends
+const thumbnailWidth = 320
+
+// Redaction turns an event's stored JPEG into the one a webhook embeds, e.g. to share less
+// with an outside service than is kept locally
+type Redaction func(data []byte, event *database.NotificationEvent) ([]byte, error)
+
+// redactions are the image modes that embed the image, by name
+var redactions = map[string]Redaction{
+	"full": func(data []byte, event *database.NotificationEvent) ([]byte, error) {
+		return data, nil
+	},
+	"thumbnail": func(data []byte, event *database.NotificationEvent) ([]byte, error) {
+		return imaging.ResizeJPEG(data, thumbnailWidth)
+	},
+	// Blurs the whole image when the event has no detection boxes to find people by
+	"blur_people": func(data []byte, event *database.NotificationEvent) ([]byte, error) {
+		people, detected := imaging.PersonRegions(event.InferenceData)
+		if !detected {
+			return imaging.BlurJPEG(data, nil)
+		}
+		if len(people) == 0 {
+			return data, nil
+		}
+		return imaging.BlurJPEG(data, people)
+	},
+}
+
+// RegisterRedaction adds an image mode that embeds the image as redact returns it.
+// It must be called before Start.
+func RegisterRedaction(mode string, redact Redaction) {
+	redactions[mode] = redact
+}
+
+// ImageModes returns the valid image modes of a rule
+func ImageModes() []string {
+	modes := []string{database.RuleImageLink, database.RuleImageNone}
+	var embedded []string
+	for mode := range redactions {
+		embedded = append(embedded, mode)
+	}
+	sort.Strings(embedded)
+	return append(modes, embedded...)
+}
+
+// ValidImageMode reports whether mode is one of ImageModes
+func ValidImageMode(mode string) bool {
+	_, ok := redactions[mode]
+	return ok || mode == database.RuleImageLink || mode == database.RuleImageNone
+}
@@ -0,0 +1,293 @@
+// Package rules fires the actions of saved event searches: every new event is checked
+// against the enabled event rules, and each match sends a webhook, SMS or ntfy notification,
+// publishes to MQTT or runs a shell command. This works on all stored events, independently
+// of the actions of the task that generated them, so simple reactions need no separate
+// automation server. Sensor readings crossing a device's sensor thresholds are stored as
+// threshold events first, so they reach the rules like any other event.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/mqtt"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// batchSize caps the events checked in one pass
+const batchSize = 500
+
+// engine checks new events against the rules every interval
+type engine struct {
+	cfg       config.RulesConfig
+	imageBase string // URL events' images are linked under in webhook payloads
+	client    *http.Client
+	mqtt      *mqtt.Client // Connection of MQTT actions, nil until the first one (or after an error)
+	lastID    int          // Newest event already checked
+}
+
+// Start checks events stored from now on against the event rules every cfg.Interval.
+// apiBaseURL is the server's external URL, used to link event images in webhooks.
+func Start(cfg config.RulesConfig, apiBaseURL string) error {
+	lastID, err := database.LastNotificationEventID()
+	if err != nil {
+		return err
+	}
+
+	e := &engine{
+		cfg:       cfg,
+		imageBase: strings.TrimRight(apiBaseURL, "/") + "/api/events/",
+		client:    &http.Client{Timeout: 15 * time.Second},
+		lastID:    lastID,
+	}
+
+	supervisor.Go("event-rules", func() error {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			e.check()
+			e.pingMQTT()
+		}
+		return nil
+	})
+	return nil
+}
+
+// check fires the rules matching the events stored since the last pass. Failed actions
+// are logged and not retried, so a broken webhook does not hold up the other rules.
+func (e *engine) check() {
+	for {
+		events, err := database.GetNotificationEventsAfter(e.lastID, batchSize)
+		if err != nil {
+			log.Printf("ERROR: Event rules failed to load events: %v", err)
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+
+		rules, err := database.GetEventRules(true)
+		if err != nil {
+			log.Printf("ERROR: Event rules failed to load rules: %v", err)
+			return
+		}
+
+		for _, event := range events {
+			for _, rule := range rules {
+				if Matches(rule, event) && !coolingDown(rule, event) {
+					e.fire(rule, event)
+				}
+			}
+			e.lastID = event.ID
+		}
+		if len(events) < batchSize {
+			return
+		}
+	}
+}
+
+// coolingDown reports whether a rule fired within its cooldown of the event
+func coolingDown(rule *database.EventRule, event *database.NotificationEvent) bool {
+	return rule.CooldownSeconds > 0 && rule.LastFiredAt != nil &&
+		EventTime(event).Sub(*rule.LastFiredAt) < time.Duration(rule.CooldownSeconds)*time.Second
+}
+
+// fire runs a rule's action for an event and records the firing
+func (e *engine) fire(rule *database.EventRule, event *database.NotificationEvent) {
+	var err error
+	switch rule.Action {
+	case database.RuleActionWebhook:
+		err = e.sendWebhook(rule, event)
+	case database.RuleActionSMS:
+		err = e.sendSMS(rule, event)
+	case database.RuleActionNtfy:
+		err = e.sendNtfy(rule, event)
+	case database.RuleActionMQTT:
+		err = e.publishMQTT(rule, event)
+	case database.RuleActionCommand:
+		err = e.runCommand(rule, event)
+	default:
+		err = fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if err != nil {
+		log.Printf("WARNING: Event rule %d (%s) failed for event %d: %v", rule.ID, rule.Name, event.ID, err)
+		return
+	}
+
+	log.Printf("Event rule %d (%s) fired for event %d: %s", rule.ID, rule.Name, event.ID, rule.Action)
+	firedAt := EventTime(event)
+	rule.LastFiredAt = &firedAt
+	if err := database.MarkEventRuleFired(rule.ID, firedAt); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
+
+// Matches reports whether an event passes a rule's filter
+func Matches(rule *database.EventRule, event *database.NotificationEvent) bool {
+	if rule.DeviceEUI != "" && !strings.EqualFold(rule.DeviceEUI, event.DeviceEUI) {
+		return false
+	}
+	if rule.EventType != "" && rule.EventType != event.EventType {
+		return false
+	}
+	if rule.Class != "" && !hasClass(event, rule.Class) {
+		return false
+	}
+	if rule.MinConfidence > 0 && Confidence(event, rule.Class) < rule.MinConfidence {
+		return false
+	}
+	if rule.Sensor != "" {
+		value, ok := SensorValues(event)[rule.Sensor]
+		if !ok || (rule.SensorAbove != nil && value <= *rule.SensorAbove) || (rule.SensorBelow != nil && value >= *rule.SensorBelow) {
+			return false
+		}
+	}
+	if rule.Hours != "" {
+		from, to, err := ParseHours(rule.Hours)
+		if err != nil {
+			return false
+		}
+		t := EventTime(event).In(time.Local)
+		minute := t.Hour()*60 + t.Minute()
+		if from <= to {
+			return minute >= from && minute < to
+		}
+		return minute >= from || minute < to // Wraps midnight, e.g. 22:00-06:00
+	}
+	return true
+}
+
+// ParseHours parses an "HH:MM-HH:MM" time of day window into minutes after midnight
+func ParseHours(hours string) (from, to int, err error) {
+	start, end, found := strings.Cut(hours, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("hours must be HH:MM-HH:MM")
+	}
+	if from, err = parseClock(start); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseClock(end); err != nil {
+		return 0, 0, err
+	}
+	if from == to {
+		return 0, 0, fmt.Errorf("hours window is empty")
+	}
+	return from, to, nil
+}
+
+// parseClock parses "HH:MM" (24:00 allowed as the end of the day) into minutes after midnight
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// EventTime is when an event happened: the device timestamp if it sent one, else when it was stored
+func EventTime(event *database.NotificationEvent) time.Time {
+	if event.Timestamp > 0 {
+		return time.UnixMilli(event.Timestamp)
+	}
+	return event.CreatedAt
+}
+
+// Classes returns the object classes detected in an event (boxes and classifications), without duplicates
+func Classes(event *database.NotificationEvent) []string {
+	if event.InferenceData == "" {
+		return nil
+	}
+	var inference models.InferenceData
+	if err := json.Unmarshal([]byte(event.InferenceData), &inference); err != nil {
+		return nil
+	}
+
+	targets := make([]int, 0, len(inference.Boxes)+len(inference.Classes))
+	for _, box := range inference.Boxes {
+		targets = append(targets, box[5])
+	}
+	for _, class := range inference.Classes {
+		targets = append(targets, class[1])
+	}
+
+	classes := []string{}
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if target < 0 || target >= len(inference.ClassesName) {
+			continue
+		}
+		name := strings.ToLower(inference.ClassesName[target])
+		if !seen[name] {
+			seen[name] = true
+			classes = append(classes, name)
+		}
+	}
+	return classes
+}
+
+// Confidence returns the best score (0-100) among an event's detections of a class, or of
+// any class if class is empty (0 without detections)
+func Confidence(event *database.NotificationEvent, class string) int {
+	var inference models.InferenceData
+	if event.InferenceData == "" || json.Unmarshal([]byte(event.InferenceData), &inference) != nil {
+		return 0
+	}
+
+	best := 0
+	consider := func(target, score int) {
+		if target < 0 || target >= len(inference.ClassesName) {
+			return
+		}
+		if (class == "" || strings.EqualFold(inference.ClassesName[target], class)) && score > best {
+			best = score
+		}
+	}
+	for _, box := range inference.Boxes {
+		consider(box[5], box[4])
+	}
+	for _, c := range inference.Classes {
+		consider(c[1], c[0])
+	}
+	return best
+}
+
+// SensorValues returns the sensor readings an event carries, keyed by metric
+// (database.SensorTemperature and so on)
+func SensorValues(event *database.NotificationEvent) map[string]float64 {
+	values := make(map[string]float64)
+	var sensor models.SensorData
+	if event.SensorData == "" || json.Unmarshal([]byte(event.SensorData), &sensor) != nil {
+		return values
+	}
+	if sensor.Temperature != nil {
+		values[database.SensorTemperature] = *sensor.Temperature
+	}
+	if sensor.Humidity != nil {
+		values[database.SensorHumidity] = float64(*sensor.Humidity)
+	}
+	if sensor.CO2 != nil {
+		values[database.SensorCO2] = float64(*sensor.CO2)
+	}
+	return values
+}
+
+func hasClass(event *database.NotificationEvent, class string) bool {
+	for _, c := range Classes(event) {
+		if c == strings.ToLower(class) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package rules
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+)
+
+// metricLabels name the sensor metrics in threshold event texts, with their unit
+var metricLabels = map[string]struct{ name, unit string }{
+	database.SensorTemperature: {"Temperature", "°C"},
+	database.SensorHumidity:    {"Humidity", "%"},
+	database.SensorCO2:         {"CO2", " ppm"},
+}
+
+// thresholdMu serializes threshold checks, so events arriving together cross a threshold once
+var thresholdMu sync.Mutex
+
+// CheckThresholds compares the sensor readings of a device event with the device's sensor
+// thresholds. A threshold the readings cross (out of its limits or back inside them) is
+// recorded as an EventThreshold notification event, which the event rules then route like
+// any other event. Readings that stay on the same side of a threshold store nothing, so a
+// device reporting every minute does not repeat the alert.
+func CheckThresholds(event *database.NotificationEvent) {
+	values := SensorValues(event)
+	if len(values) == 0 {
+		return
+	}
+
+	thresholdMu.Lock()
+	defer thresholdMu.Unlock()
+
+	thresholds, err := database.GetSensorThresholds(event.DeviceEUI, true)
+	if err != nil {
+		log.Printf("WARNING: Failed to load sensor thresholds for %s: %v", event.DeviceEUI, err)
+		return
+	}
+
+	at := EventTime(event)
+	for _, t := range thresholds {
+		value, ok := values[t.Metric]
+		if !ok {
+			continue
+		}
+		breached := breaches(t, value)
+		if breached == t.Breached {
+			continue
+		}
+
+		alert := &database.NotificationEvent{
+			RequestID:  fmt.Sprintf("threshold-%d", t.ID),
+			DeviceEUI:  event.DeviceEUI,
+			Timestamp:  at.UnixMilli(),
+			Text:       thresholdText(t, value, breached),
+			EventType:  database.EventThreshold,
+			SensorData: event.SensorData,
+		}
+		if err := database.SaveNotificationEvent(alert); err != nil {
+			log.Printf("WARNING: Failed to save sensor threshold event: %v", err)
+			continue
+		}
+		if err := database.MarkSensorThreshold(t.ID, breached, at); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+		log.Printf("Sensor threshold %d of %s crossed: %s (event %d)", t.ID, event.DeviceEUI, alert.Text, alert.ID)
+	}
+}
+
+// breaches reports whether a reading is outside a threshold's limits
+func breaches(t *database.SensorThreshold, value float64) bool {
+	return (t.Above != nil && value > *t.Above) || (t.Below != nil && value < *t.Below)
+}
+
+// thresholdText describes a reading crossing a threshold, e.g.
+// "CO2 1350 ppm is above 1200 ppm" or "CO2 back to 900 ppm (limit: above 1200 ppm)"
+func thresholdText(t *database.SensorThreshold, value float64, breached bool) string {
+	label, ok := metricLabels[t.Metric]
+	if !ok {
+		label.name = t.Metric
+	}
+	reading := func(v float64) string { return fmt.Sprintf("%g%s", v, label.unit) }
+
+	if breached {
+		if t.Above != nil && value > *t.Above {
+			return fmt.Sprintf("%s %s is above %s", label.name, reading(value), reading(*t.Above))
+		}
+		return fmt.Sprintf("%s %s is below %s", label.name, reading(value), reading(*t.Below))
+	}
+
+	var limits []string
+	if t.Above != nil {
+		limits = append(limits, "above "+reading(*t.Above))
+	}
+	if t.Below != nil {
+		limits = append(limits, "below "+reading(*t.Below))
+	}
+	return fmt.Sprintf("%s back to %s (limit: %s)", label.name, reading(value), strings.Join(limits, " or "))
+}
@@ -0,0 +1,101 @@
+// Command gen writes the device-facing JSON Schemas and sample payloads, the OpenAPI
+// document of the HTTP API, the sample Node-RED flow and the golden talk responses to a
+// directory (go generate ./internal/schema, or make schemas). With -check it writes nothing
+// and fails if the directory differs from what it would write (make check-schemas).
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/brianhealey/sensecap-server/internal/nodered"
+	"github.com/brianhealey/sensecap-server/internal/schema"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+func main() {
+	check := flag.Bool("check", false, "Compare the directory with the generated files instead of writing them")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gen [-check] <output directory>")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+
+	if !*check {
+		if err := generate(dir); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote %d schemas and samples, openapi.json, nodered-flow.json and %d golden talk responses to %s",
+			len(schema.Payloads), len(schema.TalkGoldens), dir)
+		return
+	}
+
+	tmp, err := os.MkdirTemp("", "schemas")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := generate(tmp); err != nil {
+		log.Fatal(err)
+	}
+
+	stale, err := compare(tmp, dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(stale) > 0 {
+		for _, name := range stale {
+			fmt.Fprintf(os.Stderr, "%s is out of date\n", filepath.Join(dir, name))
+		}
+		fmt.Fprintln(os.Stderr, "run make schemas and review the diff")
+		os.Exit(1)
+	}
+	log.Printf("%s is up to date", dir)
+}
+
+// generate writes all generated files to dir
+func generate(dir string) error {
+	if err := schema.WriteFiles(dir); err != nil {
+		return err
+	}
+	if err := schema.WriteOpenAPI(filepath.Join(dir, "openapi.json"), version.Version); err != nil {
+		return err
+	}
+	if err := nodered.WriteSampleFlow(filepath.Join(dir, "nodered-flow.json"), "http://localhost:8834"); err != nil {
+		return err
+	}
+	return schema.WriteGoldens(filepath.Join(dir, "golden"))
+}
+
+// compare returns the files under want that are missing from dir or differ byte for byte
+func compare(want, dir string) ([]string, error) {
+	var stale []string
+	err := filepath.WalkDir(want, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(want, path)
+		if err != nil {
+			return err
+		}
+		expected, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		actual, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(actual, expected) {
+			stale = append(stale, name)
+		}
+		return nil
+	})
+	return stale, err
+}
@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/audio"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/talk"
+)
+
+// TalkGolden is a talk response whose framed bytes are kept as a golden file, so any
+// change to the framing shows up in review and fails make check-schemas
+type TalkGolden struct {
+	Name  string      // File name without the .golden extension
+	Meta  interface{} // JSON metadata
+	Audio []byte      // WAV reply
+}
+
+// TalkGoldens are the framings the server sends: a chat reply, a task read-back, and a
+// reply without audio (speech synthesis unavailable)
+var TalkGoldens = []TalkGolden{
+	{
+		// Chat reply with a 20 ms WAV
+		Name: "talk-response-chat",
+		Meta: models.TalkResponse{
+			Code: 200,
+			Data: models.TalkResponseData{
+				Mode:       0,
+				Duration:   20,
+				STTResult:  "What is the weather today?",
+				ScreenText: "I don't have access to real-time weather data.",
+			},
+		},
+		Audio: audio.Tone(440, 20*time.Millisecond),
+	},
+	{
+		// Task read-back waiting for confirmation
+		Name: "talk-response-task",
+		Meta: models.TalkResponse{
+			Code: 200,
+			Data: models.TalkResponseData{
+				Mode:       1,
+				Duration:   20,
+				STTResult:  "Tell me when a car is in the driveway",
+				ScreenText: "I'll watch for a car in the driveway. Shall I start?",
+				Task: &models.TalkTask{
+					Headline: "Car in driveway",
+					Trigger:  "a car is in the driveway",
+					Status:   models.TaskDraft,
+				},
+			},
+		},
+		Audio: audio.Tone(660, 20*time.Millisecond),
+	},
+	{
+		// Reply without audio: the boundary line ends the body
+		Name: "talk-response-silent",
+		Meta: models.TalkResponse{
+			Code: 200,
+			Data: models.TalkResponseData{
+				Mode:       0,
+				STTResult:  "Hello",
+				ScreenText: "Speech is unavailable right now.",
+			},
+		},
+	},
+}
+
+// Frame builds a golden's framed response and checks it against what the device relies on:
+// Content-Length equals the body size, the boundary appears once, directly after the JSON,
+// and is followed by a newline and exactly the audio
+func (g TalkGolden) Frame() ([]byte, error) {
+	resp, err := talk.NewResponse(g.Meta, g.Audio)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Bytes()
+
+	if resp.Len() != len(body) {
+		return nil, fmt.Errorf("%s: Content-Length %d for a %d byte body", g.Name, resp.Len(), len(body))
+	}
+	if n := bytes.Count(body, []byte(talk.Boundary)); n != 1 {
+		return nil, fmt.Errorf("%s: boundary appears %d times", g.Name, n)
+	}
+	if at := bytes.Index(body, []byte(talk.Boundary)); at != len(resp.Meta) {
+		return nil, fmt.Errorf("%s: boundary at byte %d, want %d", g.Name, at, len(resp.Meta))
+	}
+	parsed, err := talk.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", g.Name, err)
+	}
+	if !bytes.Equal(parsed.Meta, resp.Meta) || !bytes.Equal(parsed.Audio, g.Audio) {
+		return nil, fmt.Errorf("%s: parsing the framed response does not return its parts", g.Name)
+	}
+	return body, nil
+}
+
+// WriteGoldens writes the framed talk responses to dir as <name>.golden
+func WriteGoldens(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create golden directory: %w", err)
+	}
+	for _, g := range TalkGoldens {
+		body, err := g.Frame()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, g.Name+".golden")
+		if err := os.WriteFile(path, body, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
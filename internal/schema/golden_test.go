@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// goldenDir holds the checked-in golden talk responses, relative to this package
+const goldenDir = "../../docs/schemas/golden"
+
+func TestTalkGoldensMatchCheckedIn(t *testing.T) {
+	for _, g := range TalkGoldens {
+		t.Run(g.Name, func(t *testing.T) {
+			body, err := g.Frame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join(goldenDir, g.Name+".golden"))
+			if err != nil {
+				t.Fatalf("%v (run make schemas to write it)", err)
+			}
+			if len(body) != len(want) {
+				t.Errorf("framed response is %d bytes, golden file %d", len(body), len(want))
+			}
+			for i := 0; i < len(body) && i < len(want); i++ {
+				if body[i] != want[i] {
+					t.Fatalf("framed response differs from the golden file at byte %d: got %q, want %q",
+						i, body[i:min(i+32, len(body))], want[i:min(i+32, len(want))])
+				}
+			}
+		})
+	}
+}
+
+func TestNoStaleTalkGoldens(t *testing.T) {
+	names := make(map[string]bool)
+	for _, g := range TalkGoldens {
+		names[g.Name+".golden"] = true
+	}
+	files, err := filepath.Glob(filepath.Join(goldenDir, "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if !names[filepath.Base(file)] {
+			t.Errorf("%s has no entry in TalkGoldens", file)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package schema
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// openAPIVersion is the OpenAPI version of the generated document (its schemas are JSON Schema 2020-12)
+const openAPIVersion = "3.1.0"
+
+// Who may call an operation
+const (
+	AuthNone       = ""           // No credentials
+	AuthDevice     = "device"     // AUTH_TOKEN or a device API key, as configured on the Watcher
+	AuthManagement = "management" // Login session, management API key, or AUTH_TOKEN; viewers see their devices only
+	AuthAdmin      = "admin"      // As AuthManagement, admin accounts only
+	AuthQueryToken = "query"      // As AuthManagement, or the token as the ?token= query parameter
+)
+
+// Param is a query, header, or path parameter of an operation
+type Param struct {
+	Name        string
+	In          string // "query", "header" or "path"
+	Type        string // JSON Schema type; "string" if empty
+	Enum        []string
+	Required    bool
+	Description string
+}
+
+// Operation is one endpoint of the OpenAPI document. JSON bodies are described by the zero
+// value of the Go type the handler encodes or decodes, so the document stays in step with
+// the code.
+type Operation struct {
+	ID          string // operationId, the method name in generated clients
+	Method      string
+	Path        string // Relative to the base path, with {name} path parameters
+	Tag         string
+	Summary     string
+	Description string
+	Auth        string
+	Params      []Param // Path parameters not listed here are strings
+
+	Request      interface{} // JSON request body (nil = none)
+	RequestTypes []string    // Content types of a non-JSON request body
+
+	Status        int         // Success status (default 200)
+	Envelope      bool        // JSON response is {"code": <status>, "data": Response}; just {"code"} if Response is nil
+	Response      interface{} // JSON response body, or its data with Envelope
+	ResponseTypes []string    // Content types of a non-JSON response body
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// OpenAPI returns the OpenAPI document of the device-facing and management HTTP APIs.
+// basePath is the server's base path; version is reported as the document version.
+func OpenAPI(version, basePath string) map[string]interface{} {
+	g := &generator{components: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+	g.components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":  map[string]interface{}{"type": "integer"},
+			"error": map[string]interface{}{"type": "string", "description": "Message in the caller's language"},
+		},
+		"required": []string{"code", "error"},
+	}
+
+	paths := make(map[string]interface{})
+	tags := []map[string]interface{}{}
+	seenTags := make(map[string]bool)
+	for _, op := range Operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+
+		if !seenTags[op.Tag] {
+			seenTags[op.Tag] = true
+			tags = append(tags, map[string]interface{}{"name": op.Tag, "description": TagDescriptions[op.Tag]})
+		}
+	}
+
+	server := basePath
+	if server == "" {
+		server = "/"
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "SenseCAP Watcher Server",
+			"version":     version,
+			"description": "Device-facing API used by the SenseCAP Watcher firmware, and the management API. Device bodies follow the firmware's formats; management responses are {\"code\": ..., \"data\": ...}.",
+		},
+		"servers": []map[string]interface{}{{"url": server}},
+		"tags":    tags,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"deviceToken": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "Authorization",
+					"description": "AUTH_TOKEN or a device API key, sent as the bare token (as the Watcher does) or with the Bearer scheme",
+				},
+				"bearerAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Session token from /api/login, a management API key, or AUTH_TOKEN",
+				},
+				"basicAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "basic",
+					"description": "Any username, with a bearerAuth token as the password (for clients that only take credentials in a URL)",
+				},
+				"queryToken": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "query",
+					"name":        "token",
+					"description": "A bearerAuth token as a query parameter (Node-RED endpoints only, for SSE clients that cannot set headers)",
+				},
+			},
+		},
+	}
+}
+
+// operation builds the OpenAPI operation object of op
+func (g *generator) operation(op Operation) map[string]interface{} {
+	o := map[string]interface{}{
+		"operationId": op.ID,
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+	}
+	description := op.Description
+	if op.Auth == AuthAdmin {
+		description = strings.TrimSpace("Admin accounts only. " + description)
+	}
+	if description != "" {
+		o["description"] = description
+	}
+
+	params := []map[string]interface{}{}
+	declared := make(map[string]bool)
+	for _, p := range op.Params {
+		declared[p.In+" "+p.Name] = true
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		if !declared["path "+m[1]] {
+			params = append(params, parameter(Param{Name: m[1], In: "path"}))
+		}
+	}
+	if op.Auth == AuthDevice {
+		params = append(params, parameter(Param{
+			Name:        "API-OBITER-DEVICE-EUI",
+			In:          "header",
+			Required:    true,
+			Description: "EUI of the calling device (16 hex characters)",
+		}))
+	}
+	for _, p := range op.Params {
+		params = append(params, parameter(p))
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	switch op.Auth {
+	case AuthDevice:
+		o["security"] = []map[string]interface{}{{"deviceToken": []string{}}}
+	case AuthManagement, AuthAdmin:
+		o["security"] = []map[string]interface{}{{"bearerAuth": []string{}}, {"basicAuth": []string{}}}
+	case AuthQueryToken:
+		o["security"] = []map[string]interface{}{{"bearerAuth": []string{}}, {"basicAuth": []string{}}, {"queryToken": []string{}}}
+	}
+
+	if content := g.content(op.Request, op.RequestTypes); content != nil {
+		o["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := map[string]interface{}{"description": http.StatusText(status)}
+	if op.Envelope {
+		content := g.content(nil, op.ResponseTypes)
+		if content == nil {
+			content = make(map[string]interface{})
+		}
+		content["application/json"] = map[string]interface{}{"schema": g.envelope(op.Response)}
+		response["content"] = content
+	} else if content := g.content(op.Response, op.ResponseTypes); content != nil {
+		response["content"] = content
+	}
+
+	errorResponse := map[string]interface{}{"description": "Error (plain text)"}
+	if op.Auth != AuthDevice {
+		errorResponse = map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+			},
+		}
+	}
+	o["responses"] = map[string]interface{}{
+		strconv.Itoa(status): response,
+		"default":            errorResponse,
+	}
+	return o
+}
+
+// envelope returns the schema of a {"code": ..., "data": data} response
+func (g *generator) envelope(data interface{}) map[string]interface{} {
+	properties := map[string]interface{}{"code": map[string]interface{}{"type": "integer"}}
+	required := []string{"code"}
+	if data != nil {
+		properties["data"] = g.schema(reflect.TypeOf(data))
+		required = append(required, "data")
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// content returns the content map of a JSON body and/or other content types (nil if neither)
+func (g *generator) content(body interface{}, types []string) map[string]interface{} {
+	if body == nil && len(types) == 0 {
+		return nil
+	}
+	content := make(map[string]interface{})
+	if body != nil {
+		content["application/json"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(body))}
+	}
+	for _, t := range types {
+		schema := map[string]interface{}{"type": "string", "format": "binary"}
+		if t == "multipart/form-data" {
+			schema = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"file": schema},
+				"required":   []string{"file"},
+			}
+		}
+		content[t] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+// parameter builds an OpenAPI parameter object
+func parameter(p Param) map[string]interface{} {
+	typ := p.Type
+	if typ == "" {
+		typ = "string"
+	}
+	schema := map[string]interface{}{"type": typ}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+
+	param := map[string]interface{}{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required || p.In == "path",
+		"schema":   schema,
+	}
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+	return param
+}
+
+// WriteOpenAPI writes the OpenAPI document (for the root base path) to a file
+func WriteOpenAPI(path, version string) error {
+	return writeJSONFile(path, OpenAPI(version, ""))
+}
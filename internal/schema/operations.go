@@ -0,0 +1,1198 @@
+package schema
+
+import (
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/capture"
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/i18n"
+	"github.com/brianhealey/sensecap-server/internal/incidents"
+	"github.com/brianhealey/sensecap-server/internal/lan"
+	"github.com/brianhealey/sensecap-server/internal/models"
+	"github.com/brianhealey/sensecap-server/internal/nodered"
+	"github.com/brianhealey/sensecap-server/internal/queue"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// Bodies shared by several operations (anonymous, so they are inlined in the document)
+
+type visionSettings = struct {
+	DefaultPrompt     string `json:"default_prompt"`
+	RecognizeMaxChars int    `json:"recognize_max_chars"`
+	StoreRecognize    bool   `json:"store_recognize"`
+	Privacy           string `json:"privacy"`  // off, people or full
+	Provider          string `json:"provider"` // ollama, openai or detector
+}
+
+type visionSettingsView = struct {
+	Global    visionSettings                 `json:"global"`
+	Device    *database.DeviceVisionSettings `json:"device"` // null without overrides
+	Effective visionSettings                 `json:"effective"`
+}
+
+type userRequest = struct {
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Role     string    `json:"role"`     // admin or viewer
+	Devices  *[]string `json:"devices"`  // EUIs a viewer may see
+	Language *string   `json:"language"` // Language of API messages and the dashboard ("" = browser's)
+}
+
+type newAPIKey = struct {
+	Key    string          `json:"key"` // Shown only once
+	APIKey database.APIKey `json:"api_key"`
+}
+
+type eventRuleRequest = struct {
+	Name            string   `json:"name"`
+	Device          string   `json:"device"`         // Device EUI or registered name (empty = all devices)
+	Class           string   `json:"class"`          // Detected object class, e.g. car (empty = any)
+	EventType       string   `json:"event_type"`     // alarm, sensor, telemetry, interaction or threshold (empty = any)
+	Hours           string   `json:"hours"`          // HH:MM-HH:MM in server local time, may wrap midnight (empty = all day)
+	MinConfidence   int      `json:"min_confidence"` // Minimum detection score 0-100, of class if set (0 = any)
+	Sensor          string   `json:"sensor"`         // temperature, humidity or co2 (empty = no sensor condition)
+	SensorAbove     *float64 `json:"sensor_above"`   // The sensor reading must be above this
+	SensorBelow     *float64 `json:"sensor_below"`   // The sensor reading must be below this
+	Action          string   `json:"action"`         // webhook, sms, ntfy, mqtt or command
+	Target          string   `json:"target"`         // Webhook URL, E.164 phone number, ntfy topic URL, MQTT topic or shell command
+	Image           string   `json:"image"`          // What webhook, MQTT and command payloads carry of the event image: link (default), none, full, thumbnail or blur_people
+	CooldownSeconds int      `json:"cooldown_seconds"`
+	Enabled         *bool    `json:"enabled"` // Default true; omitted on update keeps the current state
+}
+
+type sensorThresholdRequest = struct {
+	Metric  string   `json:"metric"`  // temperature, humidity or co2
+	Above   *float64 `json:"above"`   // Breached by readings above this
+	Below   *float64 `json:"below"`   // Breached by readings below this (less than above if both are set)
+	Enabled *bool    `json:"enabled"` // Default true; omitted on update keeps the current state
+}
+
+type customClassRequest = struct {
+	Synonyms      []string `json:"synonyms"`       // Other words that mean the class
+	ModelType     int      `json:"model_type"`     // 1-3 = a built-in model, 0 = the custom model at model_url
+	ModelID       string   `json:"model_id"`       // Identifier of the custom model
+	ModelVersion  string   `json:"model_version"`  // Version of the custom model
+	ModelURL      string   `json:"model_url"`      // Where devices download the custom model (required with model_type 0)
+	ModelSize     float64  `json:"model_size"`     // Size of the model file in KB
+	ModelChecksum string   `json:"model_checksum"` // MD5 of the model file
+}
+
+type speakRequest = struct {
+	Text string `json:"text"` // At most 500 characters
+	TTL  string `json:"ttl"`  // How long the announcement waits for the device, e.g. 10m (default 10m, max 24h)
+}
+
+type taskVerification = struct {
+	Triggered  bool      `json:"triggered"` // The task would have raised an alarm on the frame
+	Analysis   string    `json:"analysis"`  // The vision model's answer to the trigger condition
+	FrameAt    time.Time `json:"frame_at"`
+	Img        string    `json:"img"` // The frame (base64 JPEG, with the privacy mode applied)
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+type voiceInteractionView = struct {
+	database.VoiceInteraction
+	InputAudioURL string `json:"input_audio_url"` // Relative to /api, empty if not stored
+	ReplyAudioURL string `json:"reply_audio_url"`
+}
+
+type taskAlarmResponse = struct {
+	ID                  int    `json:"id"`
+	AlarmURL            string `json:"alarm_url"`             // Empty = the notification proxy
+	AlarmToken          bool   `json:"alarm_token"`           // A token is set (it is never returned)
+	AlarmSilenceSeconds int    `json:"alarm_silence_seconds"` // 0 = the default
+}
+
+type taskVisionResponse = struct {
+	ID             int    `json:"id"`
+	VisionProvider string `json:"vision_provider"` // Empty = the device's
+	Effective      string `json:"effective"`       // The provider that analyzes the task's images
+}
+
+type incidentResponse = struct {
+	database.Incident
+	ImageURL string `json:"image_url"` // The representative image, relative to /api; empty when no alarm has an image
+}
+
+type taskSensitivityResponse = struct {
+	ID          int    `json:"id"`
+	Sensitivity string `json:"sensitivity"` // Empty = a plain yes or no
+	Threshold   int    `json:"threshold"`   // Lowest confidence of a YES verdict that meets the trigger (0 without a sensitivity)
+	Prompt      string `json:"prompt"`      // The task's verification prompt with the sensitivity applied
+}
+
+// since, limit and device_eui filter the list endpoints
+var (
+	sinceParam  = Param{Name: "since", In: "query", Description: "How far back to list, e.g. 24h (default 24h)"}
+	deviceParam = Param{Name: "device_eui", In: "query", Description: "Only this device"}
+)
+
+func limitParam(def string) Param {
+	return Param{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of entries (default " + def + ")"}
+}
+
+// TagDescriptions describes the operation groups of the OpenAPI document
+var TagDescriptions = map[string]string{
+	"device":       "Endpoints called by the Watcher firmware",
+	"accounts":     "Login, users, and API keys",
+	"devices":      "Device registry, sensors, live preview, and per-device vision settings",
+	"tasks":        "Task flows and their events",
+	"events":       "Stored event images",
+	"firmware":     "Firmware binaries and OTA manifests",
+	"canary":       "Canary channel metrics and inference review",
+	"incidents":    "Alarms from several devices grouped into incidents, with the LLM's write-up",
+	"nodered":      "Stable flat event feed, SSE stream and sample flow for Node-RED",
+	"export":       "CSV and NDJSON downloads of events and sensor readings for offline analysis",
+	"interactions": "Voice interaction history",
+	"search":       "Full-text search over event text, vision answers and voice transcriptions",
+	"uploads":      "Files uploaded by devices",
+	"rules":        "Event rules: saved event searches that fire a webhook, SMS, ntfy notification, MQTT message or shell command",
+	"schemas":      "JSON Schemas of the device-facing payloads",
+	"debug":        "Protocol debugging",
+	"audit":        "Who changed the server's configuration and tasks",
+	"health":       "Health and readiness probes",
+}
+
+// Operations lists the HTTP endpoints of the server, in the order of cmd/server/main.go.
+// The typed Connect API is described separately by proto/watcher/v1/management.proto.
+var Operations = []Operation{
+	// Device-facing API
+	{
+		ID: "sendNotificationEvent", Method: "POST", Path: "/v1/notification/event", Tag: "device", Auth: AuthDevice,
+		Summary:  "Alarm or notification event from the alarm module",
+		Request:  models.NotificationEventRequest{},
+		Response: models.NotificationResponse{},
+	},
+	{
+		ID: "analyzeImage", Method: "POST", Path: "/v1/watcher/vision", Tag: "device", Auth: AuthDevice,
+		Summary:  "Image from the image analyzer module",
+		Request:  models.ImageAnalyzerRequest{},
+		Response: models.ImageAnalyzerResponse{},
+	},
+	{
+		ID: "talk", Method: "POST", Path: "/v2/watcher/talk/audio_stream", Tag: "device", Auth: AuthDevice,
+		Summary:       "Voice request",
+		Description:   "The body is raw 16kHz 16-bit mono PCM as the Watcher records it (WAV, MP3, OGG and M4A are also accepted). The response is the talk-response JSON, a ---sensecraftboundary--- line, and the WAV reply.",
+		Params:        []Param{{Name: "Session-Id", In: "header", Description: "Voice session, kept across the turns of a conversation"}},
+		RequestTypes:  []string{"application/octet-stream", "audio/wav"},
+		ResponseTypes: []string{"application/octet-stream"},
+	},
+	{
+		ID: "viewTaskDetail", Method: "POST", Path: "/v2/watcher/talk/view_task_detail", Tag: "device", Auth: AuthDevice,
+		Summary:     "Task flow the device should run",
+		Description: "data.tl is the task flow in the firmware's format, or {} when the device has no active task. With wait, the request is a long poll answered once the device's task is no longer tlid; the X-Task-Long-Poll response header gives the longest wait the server supports.",
+		Params: []Param{
+			{Name: "wait", In: "query", Description: "Long poll: hold the request up to this long (e.g. 30s, max 1m) until the task changes"},
+			{Name: "tlid", In: "query", Type: "integer", Description: "With wait: the task the client runs (default 0, none)"},
+		},
+		Envelope: true,
+		Response: struct {
+			TL map[string]interface{} `json:"tl"`
+		}{},
+	},
+	{
+		ID: "reportTaskStatus", Method: "POST", Path: "/v2/watcher/task/status", Tag: "device", Auth: AuthDevice,
+		Summary:  "Task flow engine status",
+		Request:  models.TaskFlowStatusRequest{},
+		Envelope: true,
+	},
+	{
+		ID: "selfTest", Method: "POST", Path: "/v2/watcher/selftest", Tag: "device", Auth: AuthDevice,
+		Summary:       "Connectivity check",
+		Description:   "Answers in the audio_stream format with a short beep, echoing what the server received.",
+		ResponseTypes: []string{"application/octet-stream"},
+	},
+	{
+		ID: "uploadFile", Method: "POST", Path: "/v2/watcher/upload", Tag: "device", Auth: AuthDevice,
+		Summary:     "Auxiliary file (image, audio clip, or log)",
+		Description: "Send the file as the raw body with its content type, or as multipart/form-data with a file part (the query parameters may then also be form fields). Files over MAX_UPLOAD_MB get 413, other content types 415.",
+		Params: []Param{
+			{Name: "kind", In: "query", Enum: []string{database.UploadImage, database.UploadAudio, database.UploadLog}, Description: "Inferred from the content type; required for application/octet-stream"},
+			{Name: "request_id", In: "query", Description: "Links the file to the device's event with this requestId"},
+			{Name: "event_id", In: "query", Type: "integer", Description: "Links the file to this event"},
+			{Name: "filename", In: "query"},
+		},
+		RequestTypes: []string{"image/jpeg", "image/png", "audio/wav", "audio/mpeg", "audio/ogg", "text/plain", "application/json", "application/gzip", "application/octet-stream", "multipart/form-data"},
+		Envelope:     true,
+		Response: struct {
+			ID      int    `json:"id"`
+			Kind    string `json:"kind"`
+			Size    int    `json:"size"`
+			EventID int    `json:"event_id"` // 0 when the named event does not exist
+		}{},
+	},
+	{
+		ID: "checkFirmware", Method: "GET", Path: "/v2/watcher/ota/check", Tag: "device", Auth: AuthDevice,
+		Summary:     "Firmware updates for the device's current versions",
+		Description: "A server extension: the stock Watcher firmware does not call it (it only updates from SenseCraft's cloud). For custom firmware and gateways that flash the images themselves.",
+		Params: []Param{
+			{Name: "esp32", In: "query", Description: "Current ESP32 firmware version"},
+			{Name: "himax", In: "query", Description: "Current Himax firmware version"},
+		},
+		Envelope: true,
+		Response: struct {
+			Updates []struct {
+				Component string `json:"component"`
+				Version   string `json:"version"`
+				URL       string `json:"url"`
+				Size      int64  `json:"size"`
+				SHA256    string `json:"sha256"`
+				MD5       string `json:"md5"`
+			} `json:"updates"`
+		}{},
+	},
+	{
+		ID: "downloadFirmware", Method: "GET", Path: "/v2/watcher/ota/firmware/{component}/{version}", Tag: "device", Auth: AuthDevice,
+		Summary:       "Firmware binary (supports Range requests)",
+		Description:   "A server extension, like checkFirmware: the stock Watcher firmware does not call it.",
+		Params:        []Param{{Name: "component", In: "path", Enum: []string{"esp32", "himax"}}},
+		ResponseTypes: []string{"application/octet-stream"},
+	},
+
+	// Login and translations
+	{
+		ID: "login", Method: "POST", Path: "/api/login", Tag: "accounts",
+		Summary: "Sign in and get a session token",
+		Request: struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}{},
+		Envelope: true,
+		Response: struct {
+			Token     string        `json:"token"`
+			ExpiresAt time.Time     `json:"expires_at"`
+			User      database.User `json:"user"`
+		}{},
+	},
+	{
+		ID: "logout", Method: "POST", Path: "/api/logout", Tag: "accounts", Auth: AuthManagement,
+		Summary:  "End the session the request was made with",
+		Envelope: true,
+	},
+	{
+		ID: "getLocale", Method: "GET", Path: "/api/locale", Tag: "accounts",
+		Summary:  "Dashboard translations",
+		Params:   []Param{{Name: "lang", In: "query", Description: "Language code (default: negotiated from Accept-Language)"}},
+		Envelope: true,
+		Response: struct {
+			Language  string            `json:"language"`
+			Languages []i18n.Language   `json:"languages"`
+			Messages  map[string]string `json:"messages"` // English text to translation
+		}{},
+	},
+
+	// Accounts
+	{
+		ID: "getMe", Method: "GET", Path: "/api/me", Tag: "accounts", Auth: AuthManagement,
+		Summary:  "The signed-in account",
+		Envelope: true,
+		Response: database.User{},
+	},
+	{
+		ID: "updateMe", Method: "PUT", Path: "/api/me", Tag: "accounts", Auth: AuthManagement,
+		Summary: "Change the signed-in account's language",
+		Request: struct {
+			Language string `json:"language"`
+		}{},
+		Envelope: true,
+		Response: database.User{},
+	},
+	{
+		ID: "listUsers", Method: "GET", Path: "/api/users", Tag: "accounts", Auth: AuthAdmin,
+		Summary:  "List accounts",
+		Envelope: true,
+		Response: []database.User{},
+	},
+	{
+		ID: "createUser", Method: "POST", Path: "/api/users", Tag: "accounts", Auth: AuthAdmin,
+		Summary:  "Create an account",
+		Request:  userRequest{},
+		Status:   201,
+		Envelope: true,
+		Response: database.User{},
+	},
+	{
+		ID: "updateUser", Method: "PUT", Path: "/api/users/{id}", Tag: "accounts", Auth: AuthAdmin,
+		Summary:     "Change an account's password, role, devices, or language",
+		Description: "Omitted fields are unchanged. Password and role changes end the account's sessions.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request:     userRequest{},
+		Envelope:    true,
+		Response:    database.User{},
+	},
+	{
+		ID: "deleteUser", Method: "DELETE", Path: "/api/users/{id}", Tag: "accounts", Auth: AuthAdmin,
+		Summary:  "Delete an account",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "listAPIKeys", Method: "GET", Path: "/api/apikeys", Tag: "accounts", Auth: AuthAdmin,
+		Summary:  "List API keys",
+		Envelope: true,
+		Response: []database.APIKey{},
+	},
+	{
+		ID: "createAPIKey", Method: "POST", Path: "/api/apikeys", Tag: "accounts", Auth: AuthAdmin,
+		Summary: "Create an API key",
+		Request: struct {
+			Name      string `json:"name"`
+			Scope     string `json:"scope"`      // management or device
+			UserID    int    `json:"user_id"`    // Account of a management key
+			DeviceEUI string `json:"device_eui"` // Device a device key is bound to (empty = any)
+			ExpiresIn string `json:"expires_in"` // Duration, e.g. 720h (empty = never)
+		}{},
+		Status:   201,
+		Envelope: true,
+		Response: newAPIKey{},
+	},
+	{
+		ID: "revokeAPIKey", Method: "DELETE", Path: "/api/apikeys/{id}", Tag: "accounts", Auth: AuthAdmin,
+		Summary:  "Revoke an API key",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "rotateAPIKey", Method: "POST", Path: "/api/apikeys/{id}/rotate", Tag: "accounts", Auth: AuthAdmin,
+		Summary: "Replace an API key, keeping the old one valid for a grace period",
+		Params: []Param{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "grace", In: "query", Description: "How long the old key keeps working, e.g. 24h (0 revokes it now)"},
+		},
+		Status:   201,
+		Envelope: true,
+		Response: struct {
+			Key      string          `json:"key"`
+			APIKey   database.APIKey `json:"api_key"`
+			Replaces int             `json:"replaces"`
+		}{},
+	},
+
+	// Debug captures
+	{
+		ID: "listCaptures", Method: "GET", Path: "/api/debug/captures", Tag: "debug", Auth: AuthAdmin,
+		Summary:  "Recorded device requests and responses",
+		Envelope: true,
+		Response: struct {
+			Enabled  bool               `json:"enabled"`
+			Count    int                `json:"count"`
+			Captures []*capture.Capture `json:"captures"`
+		}{},
+	},
+	{
+		ID: "clearCaptures", Method: "DELETE", Path: "/api/debug/captures", Tag: "debug", Auth: AuthAdmin,
+		Summary:  "Clear the recorded captures",
+		Envelope: true,
+	},
+	{
+		ID: "getCapture", Method: "GET", Path: "/api/debug/captures/{id}", Tag: "debug", Auth: AuthAdmin,
+		Summary:  "One capture",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: capture.Capture{},
+	},
+	{
+		ID: "getCaptureBody", Method: "GET", Path: "/api/debug/captures/{id}/{part}", Tag: "debug", Auth: AuthAdmin,
+		Summary: "Raw request or response body of a capture, as sent on the wire",
+		Params: []Param{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "part", In: "path", Enum: []string{"request", "response"}},
+		},
+		ResponseTypes: []string{"application/octet-stream"},
+	},
+
+	// Event images
+	{
+		ID: "getEventImage", Method: "GET", Path: "/api/events/{id}/image", Tag: "events", Auth: AuthManagement,
+		Summary:       "An event's image",
+		Params:        []Param{{Name: "id", In: "path", Type: "integer"}, {Name: "w", In: "query", Type: "integer", Description: "Resize to this width"}},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+	{
+		ID: "getEventContextFrame", Method: "GET", Path: "/api/events/{id}/image/{frame}", Tag: "events", Auth: AuthManagement,
+		Summary: "A context frame stored with an alarm event",
+		Params: []Param{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "frame", In: "path", Enum: []string{database.FrameBefore, database.FrameAfter}},
+			{Name: "w", In: "query", Type: "integer", Description: "Resize to this width"},
+		},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+	{
+		ID: "getAnnotatedEventImage", Method: "GET", Path: "/api/events/{id}/image/annotated", Tag: "events", Auth: AuthManagement,
+		Summary:       "An event's image with its inference boxes, class labels and confidences drawn on",
+		Params:        []Param{{Name: "id", In: "path", Type: "integer"}, {Name: "w", In: "query", Type: "integer", Description: "Resize to this width"}},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+
+	// Devices
+	{
+		ID: "listDevices", Method: "GET", Path: "/api/devices", Tag: "devices", Auth: AuthManagement,
+		Summary:  "Registered devices",
+		Envelope: true,
+		Response: []database.Device{},
+	},
+	{
+		ID: "registerDevice", Method: "POST", Path: "/api/devices", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Register a device",
+		Request:  database.Device{},
+		Envelope: true,
+		Response: database.Device{},
+	},
+	{
+		ID: "unregisterDevice", Method: "DELETE", Path: "/api/devices/{eui}", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Remove a device from the registry",
+		Envelope: true,
+	},
+	{
+		ID: "getDeviceSensors", Method: "GET", Path: "/api/devices/{eui}/sensors", Tag: "devices", Auth: AuthManagement,
+		Summary: "Sensor time series, averaged into buckets",
+		Params: []Param{
+			{Name: "metric", In: "query", Enum: []string{"temperature", "humidity", "co2"}, Description: "Only this metric"},
+			{Name: "from", In: "query", Description: "RFC 3339 time or Unix milliseconds (default 24 hours ago)"},
+			{Name: "to", In: "query", Description: "RFC 3339 time or Unix milliseconds (default now)"},
+			{Name: "points", In: "query", Type: "integer", Description: "Maximum points per series"},
+			{Name: "bucket", In: "query", Description: "Bucket width, e.g. 5m (overrides points)"},
+		},
+		Envelope: true,
+		Response: struct {
+			DeviceEUI string                            `json:"device_eui"`
+			From      int64                             `json:"from"`
+			To        int64                             `json:"to"`
+			BucketMs  int64                             `json:"bucket_ms"`
+			Series    map[string][]database.SensorPoint `json:"series"`
+		}{},
+	},
+	{
+		ID: "getDeviceSnapshot", Method: "GET", Path: "/api/devices/{eui}/snapshot", Tag: "devices", Auth: AuthManagement,
+		Summary: "The last camera frame the device uploaded",
+		Params: []Param{
+			{Name: "wait", In: "query", Description: "Wait up to this long for the next frame, e.g. 10s"},
+			{Name: "w", In: "query", Type: "integer", Description: "Resize to this width"},
+		},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+	{
+		ID: "streamDeviceAlarms", Method: "GET", Path: "/api/devices/{eui}/mjpeg", Tag: "devices", Auth: AuthManagement,
+		Summary:     "The device's alarm images as an MJPEG stream, for NVR software",
+		Description: "The latest alarm image, sent again every interval and replaced as soon as a new alarm is stored (a placeholder before the first one). The stream does not end on its own.",
+		Params: []Param{
+			{Name: "interval", In: "query", Description: "How often the current image is sent again, between 100ms and 1m (default 1s)"},
+			{Name: "w", In: "query", Type: "integer", Description: "Resize to this width"},
+			{Name: "annotate", In: "query", Type: "boolean", Description: "Draw the detection boxes"},
+		},
+		ResponseTypes: []string{"multipart/x-mixed-replace"},
+	},
+	{
+		ID: "getDeviceVisionSettings", Method: "GET", Path: "/api/devices/{eui}/vision", Tag: "devices", Auth: AuthManagement,
+		Summary:  "Global, per-device, and effective vision settings",
+		Envelope: true,
+		Response: visionSettingsView{},
+	},
+	{
+		ID: "setDeviceVisionSettings", Method: "PUT", Path: "/api/devices/{eui}/vision", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Override vision settings for a device (null inherits the global value)",
+		Request:  database.DeviceVisionSettings{},
+		Envelope: true,
+		Response: visionSettingsView{},
+	},
+	{
+		ID: "deleteDeviceVisionSettings", Method: "DELETE", Path: "/api/devices/{eui}/vision", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Remove a device's vision overrides",
+		Envelope: true,
+		Response: visionSettingsView{},
+	},
+	{
+		ID: "listSensorThresholds", Method: "GET", Path: "/api/devices/{eui}/thresholds", Tag: "devices", Auth: AuthManagement,
+		Summary:  "A device's sensor thresholds and whether they are breached",
+		Envelope: true,
+		Response: []database.SensorThreshold{},
+	},
+	{
+		ID: "createSensorThreshold", Method: "POST", Path: "/api/devices/{eui}/thresholds", Tag: "devices", Auth: AuthAdmin,
+		Summary:     "Add a sensor threshold, e.g. co2 above 1200",
+		Description: "When a reading of the device crosses the threshold, a notification event of type threshold is stored (and another when the readings are back inside it). Event rules with event_type threshold send them on.",
+		Request:     sensorThresholdRequest{},
+		Status:      201,
+		Envelope:    true,
+		Response:    database.SensorThreshold{},
+	},
+	{
+		ID: "updateSensorThreshold", Method: "PUT", Path: "/api/devices/{eui}/thresholds/{id}", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Replace a sensor threshold (it starts out cleared again)",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request:  sensorThresholdRequest{},
+		Envelope: true,
+		Response: database.SensorThreshold{},
+	},
+	{
+		ID: "deleteSensorThreshold", Method: "DELETE", Path: "/api/devices/{eui}/thresholds/{id}", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Delete a sensor threshold",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "listAnnouncements", Method: "GET", Path: "/api/devices/{eui}/speak", Tag: "devices", Auth: AuthManagement,
+		Summary:  "A device's recent announcements and whether they were delivered",
+		Envelope: true,
+		Response: []database.Announcement{},
+	},
+	{
+		ID: "speak", Method: "POST", Path: "/api/devices/{eui}/speak", Tag: "devices", Auth: AuthAdmin,
+		Summary:     "Queue a spoken announcement for a device",
+		Description: "The text is synthesized now and played by the device with the reply to its next image analysis request (/v1/watcher/vision). Announcements not picked up within ttl expire.",
+		Request:     speakRequest{},
+		Status:      202,
+		Envelope:    true,
+		Response:    database.Announcement{},
+	},
+	{
+		ID: "getPendingTask", Method: "GET", Path: "/api/devices/{eui}/pending-task", Tag: "devices", Auth: AuthManagement,
+		Summary:     "Preview the task a voice request created and that waits for confirmation",
+		Description: "With TASK_CONFIRM on, a voice task request is stored as a draft until the user confirms it, by voice or here. 404 when the device's conversation is not waiting for a confirmation (or the window has closed).",
+		Envelope:    true,
+		Response: struct {
+			Task         database.TaskFlow  `json:"task"`
+			TaskFlow     models.TaskList    `json:"task_flow"`    // As view_task_detail would serve it to the device
+			Replaces     *database.TaskFlow `json:"replaces"`     // The task it replaces, null if none
+			ExpiresAt    time.Time          `json:"expires_at"`   // End of the confirmation window
+			Verification *taskVerification  `json:"verification"` // null until verified
+		}{},
+	},
+	{
+		ID: "confirmPendingTask", Method: "POST", Path: "/api/devices/{eui}/pending-task/confirm", Tag: "devices", Auth: AuthAdmin,
+		Summary:     "Activate the task waiting for confirmation",
+		Description: "Like answering yes to the read-back: the task replaces the device's tasks and the device picks it up on its next view_task_detail poll.",
+		Envelope:    true,
+		Response:    database.TaskFlow{},
+	},
+	{
+		ID: "declinePendingTask", Method: "DELETE", Path: "/api/devices/{eui}/pending-task", Tag: "devices", Auth: AuthAdmin,
+		Summary:  "Delete the task waiting for confirmation and keep the current one",
+		Envelope: true,
+	},
+	{
+		ID: "verifyPendingTask", Method: "POST", Path: "/api/devices/{eui}/pending-task/verify", Tag: "devices", Auth: AuthAdmin,
+		Summary:     "Run the task waiting for confirmation once on a camera frame",
+		Description: "Analyzes the device's latest frame with the task's trigger condition and reports whether it would raise an alarm. The device cannot be asked to capture a frame; frames arrive while a task runs. 409 when image analysis is disabled.",
+		Params: []Param{
+			{Name: "wait", In: "query", Description: "Wait up to this long for the next frame, e.g. 10s"},
+		},
+		Envelope: true,
+		Response: taskVerification{},
+	},
+
+	// Tasks
+	{
+		ID: "resumeTask", Method: "POST", Path: "/api/tasks/{id}/resume", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Resume a task paused after repeated device errors",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "enableTaskContextFrames", Method: "POST", Path: "/api/tasks/{id}/context-frames", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Store the frames before and after the triggering frame with alarms",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: struct {
+			ID            int  `json:"id"`
+			ContextFrames bool `json:"context_frames"`
+		}{},
+	},
+	{
+		ID: "disableTaskContextFrames", Method: "DELETE", Path: "/api/tasks/{id}/context-frames", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Stop storing context frames",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: struct {
+			ID            int  `json:"id"`
+			ContextFrames bool `json:"context_frames"`
+		}{},
+	},
+	{
+		ID: "listTaskEvents", Method: "GET", Path: "/api/tasks/{id}/events", Tag: "tasks", Auth: AuthManagement,
+		Summary:  "A task's events, newest first",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}, sinceParam, limitParam("50")},
+		Envelope: true,
+		Response: struct {
+			Task   database.TaskFlow `json:"task"`
+			Count  int               `json:"count"`
+			Events []struct {
+				database.NotificationEvent
+				Img               string `json:"img,omitempty"`                 // Always empty; fetch image_url instead
+				ImageURL          string `json:"image_url"`                     // Relative to /api, empty without an image
+				AnnotatedImageURL string `json:"annotated_image_url,omitempty"` // Image with the inference boxes drawn on, when there are any
+			} `json:"events"`
+		}{},
+	},
+	{
+		ID: "getTaskStats", Method: "GET", Path: "/api/tasks/{id}/stats", Tag: "tasks", Auth: AuthManagement,
+		Summary:  "How often a task fires",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}, {Name: "days", In: "query", Type: "integer", Description: "1 to 90 (default 7)"}},
+		Envelope: true,
+		Response: database.TaskEventStats{},
+	},
+	{
+		ID: "setTaskCooldown", Method: "PUT", Path: "/api/tasks/{id}/cooldown", Tag: "tasks", Auth: AuthAdmin,
+		Summary: "Set a task's server-side cooldown (0 turns it off)",
+		Params:  []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request: struct {
+			CooldownSeconds int `json:"cooldown_seconds"`
+		}{},
+		Envelope: true,
+		Response: struct {
+			ID              int `json:"id"`
+			CooldownSeconds int `json:"cooldown_seconds"`
+		}{},
+	},
+	{
+		ID: "setTaskDedup", Method: "PUT", Path: "/api/tasks/{id}/dedup", Tag: "tasks", Auth: AuthAdmin,
+		Summary:     "Set a task's de-duplication window (0 turns it off)",
+		Description: "Alarms from the task's device that detect the same classes as one of its alarms within the window are dropped without being stored.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request: struct {
+			DedupSeconds int `json:"dedup_seconds"`
+		}{},
+		Envelope: true,
+		Response: struct {
+			ID           int `json:"id"`
+			DedupSeconds int `json:"dedup_seconds"`
+		}{},
+	},
+	{
+		ID: "setTaskAlarm", Method: "PUT", Path: "/api/tasks/{id}/alarm", Tag: "tasks", Auth: AuthAdmin,
+		Summary:     "Set where the device sends the task's alarms",
+		Description: "With a url, the task flow's last node is an http alarm posting to that server (with the token as its Authorization header) instead of a sensecraft alarm to the notification proxy the device is bound to. An empty url keeps the notification proxy and only sets the silence between notifications (0 = the default). The device picks the change up the next time it fetches the task; tasks that replace this one keep the setting.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request: struct {
+			URL            string `json:"url"`
+			Token          string `json:"token"`
+			SilenceSeconds int    `json:"silence_seconds"`
+		}{},
+		Envelope: true,
+		Response: taskAlarmResponse{},
+	},
+	{
+		ID: "resetTaskAlarm", Method: "DELETE", Path: "/api/tasks/{id}/alarm", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Send the task's alarms to the notification proxy again, with the default silence",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: taskAlarmResponse{},
+	},
+
+	{
+		ID: "setTaskVision", Method: "PUT", Path: "/api/tasks/{id}/vision", Tag: "tasks", Auth: AuthAdmin,
+		Summary:     "Choose the vision provider that analyzes the task's images",
+		Description: "provider is ollama (LLaVA), openai (e.g. GPT-4o, billed per image) or detector (the YOLO object detector of the audio service: fast and free, but it only answers whether the objects named in the prompt are in the image). It overrides the device's provider while the task is active; tasks that replace this one keep the setting.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request: struct {
+			Provider string `json:"provider"` // ollama, openai or detector
+		}{},
+		Envelope: true,
+		Response: taskVisionResponse{},
+	},
+	{
+		ID: "resetTaskVision", Method: "DELETE", Path: "/api/tasks/{id}/vision", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Analyze the task's images with the device's vision provider again",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: taskVisionResponse{},
+	},
+
+	{
+		ID: "setTaskSensitivity", Method: "PUT", Path: "/api/tasks/{id}/sensitivity", Tag: "tasks", Auth: AuthAdmin,
+		Summary:     "Set how sure the vision model must be that the task's trigger is met",
+		Description: "sensitivity is strict, normal or relaxed. The task's verification prompt then asks for a verdict with a confidence (\"YES 85\"), with guidance for strict and relaxed tasks, and only a YES with at least 80 (strict), 60 (normal) or 40 (relaxed) meets the trigger; answers without a verdict are judged as before. Stricter tasks raise fewer false alarms and miss more events. The device picks the new prompt up the next time it fetches the task; tasks that replace this one keep the setting.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request: struct {
+			Sensitivity string `json:"sensitivity"` // strict, normal or relaxed
+		}{},
+		Envelope: true,
+		Response: taskSensitivityResponse{},
+	},
+	{
+		ID: "resetTaskSensitivity", Method: "DELETE", Path: "/api/tasks/{id}/sensitivity", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Go back to a plain yes or no for the task's trigger",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: taskSensitivityResponse{},
+	},
+
+	{
+		ID: "validateTaskFlow", Method: "POST", Path: "/api/taskflows/validate", Tag: "tasks", Auth: AuthManagement,
+		Summary:     "Check a task flow in the firmware's format before it reaches a device",
+		Description: "The body is a task flow as view_task_detail serves it in data.tl. The issues cover missing keys, unknown module types, parameter ranges, node wiring (wires to unknown nodes, cycles, nodes the AI camera never reaches) and whether the AI camera's model detects the classes of its conditions. valid is false if any issue is an error; the server runs the same checks on its own task flows and never sends one that fails them.",
+		Request:     models.TaskList{},
+		Envelope:    true,
+		Response: struct {
+			Valid  bool           `json:"valid"`
+			Issues []models.Issue `json:"issues"`
+		}{},
+	},
+	{
+		ID: "listClasses", Method: "GET", Path: "/api/classes", Tag: "tasks", Auth: AuthManagement,
+		Summary:     "Object classes voice tasks can target",
+		Description: "configured is the class list of the configuration (CLASSES, default the 80 COCO classes); custom are the classes added through this API.",
+		Envelope:    true,
+		Response: struct {
+			Configured []string               `json:"configured"`
+			Custom     []database.CustomClass `json:"custom"`
+		}{},
+	},
+	{
+		ID: "saveClass", Method: "PUT", Path: "/api/classes/{name}", Tag: "tasks", Auth: AuthAdmin,
+		Summary:     "Add or replace a custom class, e.g. chicken detected by a custom model",
+		Description: "Voice tasks can then target the class and its synonyms. Tasks for a class with model_type 0 tell the device to download the model from model_url; a configured class added here is detected with the given model instead. Existing tasks keep the model type they were created with.",
+		Params:      []Param{{Name: "name", In: "path", Description: "One to three lowercase words"}},
+		Request:     customClassRequest{},
+		Envelope:    true,
+		Response:    database.CustomClass{},
+	},
+	{
+		ID: "deleteClass", Method: "DELETE", Path: "/api/classes/{name}", Tag: "tasks", Auth: AuthAdmin,
+		Summary:  "Remove a custom class",
+		Params:   []Param{{Name: "name", In: "path"}},
+		Envelope: true,
+	},
+
+	// Firmware
+	{
+		ID: "listFirmware", Method: "GET", Path: "/api/firmware", Tag: "firmware", Auth: AuthAdmin,
+		Summary:  "Uploaded firmware images",
+		Envelope: true,
+		Response: struct {
+			Count  int                      `json:"count"`
+			Images []database.FirmwareImage `json:"images"`
+		}{},
+	},
+	{
+		ID: "listFirmwareManifests", Method: "GET", Path: "/api/firmware/manifest", Tag: "firmware", Auth: AuthAdmin,
+		Summary:  "Firmware versions pinned for the fleet and for devices",
+		Envelope: true,
+		Response: struct {
+			Count     int                         `json:"count"`
+			Manifests []database.FirmwareManifest `json:"manifests"`
+		}{},
+	},
+	{
+		ID: "setFirmwareManifest", Method: "PUT", Path: "/api/firmware/manifest", Tag: "firmware", Auth: AuthAdmin,
+		Summary: "Pin a firmware version for the fleet or a device",
+		Request: struct {
+			DeviceEUI string `json:"device_eui"` // Empty for the fleet-wide default
+			Component string `json:"component"`
+			Version   string `json:"version"`
+		}{},
+		Envelope: true,
+	},
+	{
+		ID: "deleteFirmwareManifest", Method: "DELETE", Path: "/api/firmware/manifest", Tag: "firmware", Auth: AuthAdmin,
+		Summary: "Remove a pinned firmware version",
+		Params: []Param{
+			{Name: "component", In: "query", Required: true, Enum: []string{"esp32", "himax"}},
+			{Name: "device_eui", In: "query", Description: "Empty for the fleet-wide default"},
+		},
+		Envelope: true,
+	},
+	{
+		ID: "uploadFirmware", Method: "POST", Path: "/api/firmware/{component}/{version}", Tag: "firmware", Auth: AuthAdmin,
+		Summary: "Upload a firmware binary",
+		Params: []Param{
+			{Name: "component", In: "path", Enum: []string{"esp32", "himax"}},
+			{Name: "notes", In: "query"},
+		},
+		RequestTypes: []string{"application/octet-stream"},
+		Status:       201,
+		Envelope:     true,
+		Response:     database.FirmwareImage{},
+	},
+	{
+		ID: "deleteFirmware", Method: "DELETE", Path: "/api/firmware/{component}/{version}", Tag: "firmware", Auth: AuthAdmin,
+		Summary:  "Delete a firmware binary that no manifest pins",
+		Params:   []Param{{Name: "component", In: "path", Enum: []string{"esp32", "himax"}}},
+		Envelope: true,
+	},
+
+	// Canary channel
+	{
+		ID: "getCanary", Method: "GET", Path: "/api/canary", Tag: "canary", Auth: AuthAdmin,
+		Summary:     "Canary devices and overrides, and per-channel metrics",
+		Description: "stable and canary map each kind of AI call to its latency and false-positive statistics.",
+		Params:      []Param{sinceParam},
+		Envelope:    true,
+		Response:    map[string]interface{}{},
+	},
+	{
+		ID: "listInferences", Method: "GET", Path: "/api/inferences", Tag: "canary", Auth: AuthManagement,
+		Summary:  "Recorded AI calls, newest first",
+		Params:   []Param{deviceParam, {Name: "channel", In: "query", Enum: []string{"stable", "canary"}}, sinceParam, limitParam("100")},
+		Envelope: true,
+		Response: struct {
+			Count      int                        `json:"count"`
+			Inferences []database.InferenceMetric `json:"inferences"`
+		}{},
+	},
+	{
+		ID: "markFalsePositive", Method: "POST", Path: "/api/inferences/{id}/false-positive", Tag: "canary", Auth: AuthAdmin,
+		Summary:  "Mark a detection as a false positive",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "unmarkFalsePositive", Method: "DELETE", Path: "/api/inferences/{id}/false-positive", Tag: "canary", Auth: AuthAdmin,
+		Summary:  "Unmark a false positive",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+
+	// Incidents
+	{
+		ID: "listIncidents", Method: "GET", Path: "/api/incidents", Tag: "incidents", Auth: AuthManagement,
+		Summary:     "Incidents, newest first",
+		Description: "Incidents are alarms of several devices close together in time (kind devices) or bursts of alarms from one device detecting the same objects (kind burst); the same alarm can be in one of each. Only incidents whose devices the user can all see are listed.",
+		Params:      []Param{sinceParam, limitParam("50"), {Name: "kind", In: "query", Description: "Only incidents of this kind: devices or burst"}},
+		Envelope:    true,
+		Response: struct {
+			Count     int                `json:"count"`
+			Incidents []incidentResponse `json:"incidents"`
+		}{},
+	},
+	{
+		ID: "getIncident", Method: "GET", Path: "/api/incidents/{id}", Tag: "incidents", Auth: AuthManagement,
+		Summary:  "An incident with the timeline of its alarms",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: struct {
+			Incident incidentResponse `json:"incident"`
+			Timeline []struct {
+				incidents.TimelineEntry
+				ImageURL          string `json:"image_url"`                     // Relative to /api, empty without an image
+				AnnotatedImageURL string `json:"annotated_image_url,omitempty"` // Image with the inference boxes drawn on, when there are any
+			} `json:"timeline"`
+		}{},
+	},
+	{
+		ID: "summarizeIncident", Method: "POST", Path: "/api/incidents/{id}/summarize", Tag: "incidents", Auth: AuthManagement,
+		Summary:     "Have the LLM write an incident up again",
+		Description: "Incidents are written up when they end; this redoes it, e.g. after changing the incident prompt. Open incidents give 409.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope:    true,
+		Response:    incidentResponse{},
+	},
+
+	// Node-RED
+	{
+		ID: "listNodeREDEvents", Method: "GET", Path: "/api/nodered/v1/events", Tag: "nodered", Auth: AuthQueryToken,
+		Summary:     "Events flattened for Node-RED, oldest first",
+		Description: "A bare JSON array: the first limit events after the given ID, or the latest limit events without after. Poll with the id of the last event received as after.",
+		Params: []Param{
+			{Name: "after", In: "query", Type: "integer", Description: "Only events after this event ID"},
+			{Name: "event_type", In: "query", Description: "Only this event type: alarm, sensor, telemetry, interaction or threshold"},
+			deviceParam,
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of events (default 50, max 500)"},
+		},
+		Response: []nodered.Event{},
+	},
+	{
+		ID: "streamNodeREDEvents", Method: "GET", Path: "/api/nodered/v1/events/stream", Tag: "nodered", Auth: AuthQueryToken,
+		Summary:     "Events flattened for Node-RED as server-sent events",
+		Description: "Each SSE message has the event ID as its id, the event_type as its event name and the flat event (as listNodeREDEvents) as its data. Reconnecting with Last-Event-ID first sends the events missed; otherwise the stream starts with the next event. A keepalive comment is sent every 15s.",
+		Params: []Param{
+			{Name: "after", In: "query", Type: "integer", Description: "Start after this event ID (Last-Event-ID takes precedence)"},
+			{Name: "event_type", In: "query", Description: "Only this event type: alarm, sensor, telemetry, interaction or threshold"},
+			deviceParam,
+		},
+		ResponseTypes: []string{"text/event-stream"},
+	},
+	{
+		ID: "getNodeREDEventImage", Method: "GET", Path: "/api/nodered/v1/events/{id}/image", Tag: "nodered", Auth: AuthQueryToken,
+		Summary:       "An event's image, as linked by image_url",
+		Params:        []Param{{Name: "id", In: "path", Type: "integer"}, {Name: "w", In: "query", Type: "integer", Description: "Resize to this width"}},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+	{
+		ID: "getNodeREDAnnotatedEventImage", Method: "GET", Path: "/api/nodered/v1/events/{id}/image/annotated", Tag: "nodered", Auth: AuthQueryToken,
+		Summary:       "An event's image with the inference boxes drawn on, as linked by annotated_image_url",
+		Params:        []Param{{Name: "id", In: "path", Type: "integer"}, {Name: "w", In: "query", Type: "integer", Description: "Resize to this width"}},
+		ResponseTypes: []string{"image/jpeg"},
+	},
+	{
+		ID: "getNodeREDFlow", Method: "GET", Path: "/api/nodered/v1/flow", Tag: "nodered", Auth: AuthManagement,
+		Summary:     "A sample Node-RED flow for this server",
+		Description: "Import it with Node-RED's Import dialog: it polls the event feed, routes events by type and fetches alarm images.",
+		Response:    []map[string]interface{}{},
+	},
+	{
+		ID: "exportEvents", Method: "GET", Path: "/api/export/events", Tag: "export", Auth: AuthManagement,
+		Summary:     "Events stored in a time range as CSV or NDJSON, oldest first",
+		Description: "Streamed in pages, so long ranges are fine. NDJSON lines are the flat events of the Node-RED feed (listNodeREDEvents); the CSV columns are their fields without timestamp, with classes separated by semicolons and missing sensor readings empty. Viewers get the events of their devices.",
+		Params: []Param{
+			{Name: "from", In: "query", Description: "RFC 3339 time or Unix milliseconds (default 24 hours ago)"},
+			{Name: "to", In: "query", Description: "RFC 3339 time or Unix milliseconds (default now)"},
+			{Name: "format", In: "query", Enum: []string{"csv", "ndjson"}, Description: "Download format (default csv)"},
+			{Name: "event_type", In: "query", Description: "Only this event type: alarm, sensor, telemetry, interaction or threshold"},
+			deviceParam,
+		},
+		ResponseTypes: []string{"text/csv", "application/x-ndjson"},
+	},
+	{
+		ID: "exportSensorReadings", Method: "GET", Path: "/api/export/sensors", Tag: "export", Auth: AuthManagement,
+		Summary:     "Sensor readings taken in a time range as CSV or NDJSON, in time order",
+		Description: "One row per reading of one metric: time, timestamp (Unix milliseconds), device_eui, device_name, metric and value. Viewers get the readings of their devices.",
+		Params: []Param{
+			{Name: "from", In: "query", Description: "RFC 3339 time or Unix milliseconds (default 24 hours ago)"},
+			{Name: "to", In: "query", Description: "RFC 3339 time or Unix milliseconds (default now)"},
+			{Name: "format", In: "query", Enum: []string{"csv", "ndjson"}, Description: "Download format (default csv)"},
+			{Name: "metric", In: "query", Enum: []string{"temperature", "humidity", "co2"}, Description: "Only this metric"},
+			deviceParam,
+		},
+		ResponseTypes: []string{"text/csv", "application/x-ndjson"},
+	},
+
+	// Voice interactions
+	{
+		ID: "listInteractions", Method: "GET", Path: "/api/interactions", Tag: "interactions", Auth: AuthManagement,
+		Summary: "Voice interactions, newest first",
+		Params: []Param{
+			deviceParam,
+			{Name: "session_id", In: "query", Description: "Only the exchanges of this voice session"},
+			sinceParam,
+			limitParam("50"),
+		},
+		Envelope: true,
+		Response: struct {
+			Count        int                    `json:"count"`
+			Interactions []voiceInteractionView `json:"interactions"`
+		}{},
+	},
+	{
+		ID: "getInteraction", Method: "GET", Path: "/api/interactions/{id}", Tag: "interactions", Auth: AuthManagement,
+		Summary:  "A voice interaction with the latency of each pipeline stage",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+		Response: voiceInteractionView{},
+	},
+	{
+		ID: "getInteractionAudio", Method: "GET", Path: "/api/interactions/{id}/audio/{part}", Tag: "interactions", Auth: AuthManagement,
+		Summary: "Uploaded audio or synthesized reply, as WAV",
+		Params: []Param{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "part", In: "path", Enum: []string{"input", "reply"}},
+		},
+		ResponseTypes: []string{"audio/wav"},
+	},
+
+	{
+		ID: "search", Method: "GET", Path: "/api/search", Tag: "search", Auth: AuthManagement,
+		Summary:     "Events and voice interactions matching any word of q, most relevant first",
+		Description: "Searches the text of events (alarm text, RECOGNIZE answers of the vision model, task headlines) and voice interactions (transcriptions and responses). Words match by stem, so \"deliveries\" finds \"delivery\"; rows with more of the words, and rarer ones, rank higher. 503 when the server was built without FTS5 (-tags sqlite_fts5).",
+		Params: []Param{
+			{Name: "q", In: "query", Required: true, Description: "Words to look for, e.g. delivery person"},
+			deviceParam,
+			{Name: "since", In: "query", Description: "How far back to search, e.g. 720h (default: everything)"},
+			limitParam("20"),
+		},
+		Envelope: true,
+		Response: struct {
+			Count   int `json:"count"`
+			Results []struct {
+				database.SearchResult
+				ImageURL string `json:"image_url,omitempty"` // Event image, relative to /api
+			} `json:"results"`
+		}{},
+	},
+
+	// Device uploads
+	{
+		ID: "listUploads", Method: "GET", Path: "/api/uploads", Tag: "uploads", Auth: AuthManagement,
+		Summary: "Files uploaded by devices, newest first",
+		Params: []Param{
+			deviceParam,
+			{Name: "kind", In: "query", Enum: []string{database.UploadImage, database.UploadAudio, database.UploadLog}},
+			{Name: "event_id", In: "query", Type: "integer"},
+			sinceParam,
+			limitParam("50"),
+		},
+		Envelope: true,
+		Response: struct {
+			Count   int `json:"count"`
+			Uploads []struct {
+				database.DeviceUpload
+				URL string `json:"url"` // Relative to /api
+			} `json:"uploads"`
+		}{},
+	},
+	{
+		ID: "getUpload", Method: "GET", Path: "/api/uploads/{id}", Tag: "uploads", Auth: AuthManagement,
+		Summary:       "An uploaded file, with the content type it was sent with",
+		Params:        []Param{{Name: "id", In: "path", Type: "integer"}},
+		ResponseTypes: []string{"application/octet-stream"},
+	},
+
+	// Event rules
+	{
+		ID: "listEventRules", Method: "GET", Path: "/api/rules", Tag: "rules", Auth: AuthAdmin,
+		Summary:  "List event rules",
+		Envelope: true,
+		Response: []database.EventRule{},
+	},
+	{
+		ID: "createEventRule", Method: "POST", Path: "/api/rules", Tag: "rules", Auth: AuthAdmin,
+		Summary:     "Save an event search with an action",
+		Description: "Every new event matching all of the rule's filters fires the action: a JSON POST to the webhook URL, an SMS through Twilio, an ntfy push notification, the webhook JSON published to an MQTT topic (RULES_MQTT_URL), or a shell command (only with RULES_ALLOW_COMMANDS=true).",
+		Request:     eventRuleRequest{},
+		Status:      201,
+		Envelope:    true,
+		Response:    database.EventRule{},
+	},
+	{
+		ID: "updateEventRule", Method: "PUT", Path: "/api/rules/{id}", Tag: "rules", Auth: AuthAdmin,
+		Summary:  "Replace an event rule's filter and action",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Request:  eventRuleRequest{},
+		Envelope: true,
+		Response: database.EventRule{},
+	},
+	{
+		ID: "deleteEventRule", Method: "DELETE", Path: "/api/rules/{id}", Tag: "rules", Auth: AuthAdmin,
+		Summary:  "Delete an event rule",
+		Params:   []Param{{Name: "id", In: "path", Type: "integer"}},
+		Envelope: true,
+	},
+	{
+		ID: "listEventRuleMatches", Method: "GET", Path: "/api/rules/{id}/events", Tag: "rules", Auth: AuthAdmin,
+		Summary:     "Run an event rule's saved search",
+		Description: "Stored events the rule's filter matches, newest first, whether or not the rule is enabled.",
+		Params:      []Param{{Name: "id", In: "path", Type: "integer"}, sinceParam, limitParam("50")},
+		Envelope:    true,
+		Response: struct {
+			Rule   database.EventRule `json:"rule"`
+			Count  int                `json:"count"`
+			Events []struct {
+				database.NotificationEvent
+				Img               string `json:"img,omitempty"`                 // Always empty; fetch image_url instead
+				ImageURL          string `json:"image_url"`                     // Relative to /api, empty without an image
+				AnnotatedImageURL string `json:"annotated_image_url,omitempty"` // Image with the inference boxes drawn on, when there are any
+			} `json:"events"`
+		}{},
+	},
+
+	// Payload schemas
+	{
+		ID: "listSchemas", Method: "GET", Path: "/api/schemas", Tag: "schemas", Auth: AuthManagement,
+		Summary:  "Device-facing payloads with links to their JSON Schema and sample",
+		Envelope: true,
+		Response: struct {
+			Count   int `json:"count"`
+			Schemas []struct {
+				Payload
+				SchemaURL string `json:"schema_url"`
+				SampleURL string `json:"sample_url"`
+			} `json:"schemas"`
+		}{},
+	},
+	{
+		ID: "getSchema", Method: "GET", Path: "/api/schemas/{name}", Tag: "schemas", Auth: AuthManagement,
+		Summary:       "JSON Schema of a device-facing payload",
+		ResponseTypes: []string{"application/schema+json"},
+	},
+	{
+		ID: "getSchemaSample", Method: "GET", Path: "/api/schemas/{name}/sample", Tag: "schemas", Auth: AuthManagement,
+		Summary:  "Sample of a device-facing payload",
+		Response: map[string]interface{}{},
+	},
+	{
+		ID: "getOpenAPI", Method: "GET", Path: "/api/openapi.json", Tag: "schemas",
+		Summary:  "This document",
+		Response: map[string]interface{}{},
+	},
+
+	// Unknown endpoints
+	{
+		ID: "listUnknownEndpoints", Method: "GET", Path: "/api/admin/unknown-endpoints", Tag: "debug", Auth: AuthAdmin,
+		Summary:  "Requests that hit no route, aggregated by method, path and device",
+		Envelope: true,
+		Response: struct {
+			Count     int                        `json:"count"`
+			Endpoints []database.UnknownEndpoint `json:"endpoints"`
+		}{},
+	},
+	{
+		ID: "clearUnknownEndpoints", Method: "DELETE", Path: "/api/admin/unknown-endpoints", Tag: "debug", Auth: AuthAdmin,
+		Summary:  "Clear the unknown endpoint counters",
+		Envelope: true,
+	},
+	{
+		ID: "createDebugBundle", Method: "POST", Path: "/api/admin/debug-bundle", Tag: "debug", Auth: AuthAdmin,
+		Summary:       "Zip of recent logs, redacted configuration, database statistics, unknown endpoints and backend health, for bug reports",
+		ResponseTypes: []string{"application/zip"},
+	},
+
+	// Audit log
+	{
+		ID: "listAuditLog", Method: "GET", Path: "/api/audit", Tag: "audit", Auth: AuthAdmin,
+		Summary:     "Who changed the server's configuration and tasks, newest first",
+		Description: "Successful management API requests other than GET (REST and admin Connect procedures, as the request's account, with the body's secrets redacted), server subcommands that change the database (as the OS user) and tasks set up by voice (as the device). The log is append-only.",
+		Params: []Param{
+			sinceParam,
+			{Name: "source", In: "query", Description: "Only entries of this source: api, cli or voice"},
+			{Name: "actor", In: "query", Description: "Only entries of this account, OS user or device EUI"},
+			limitParam("100"),
+		},
+		Envelope: true,
+		Response: struct {
+			Count   int                   `json:"count"`
+			Entries []database.AuditEntry `json:"entries"`
+		}{},
+	},
+
+	// Device setup
+	{
+		ID: "getAdminInfo", Method: "GET", Path: "/api/admin/info", Tag: "devices", Auth: AuthAdmin,
+		Summary:     "LAN addresses and Watcher setup commands",
+		Description: "For each URL devices can reach the server at (API_BASE_URL unless it is localhost, then one per LAN IPv4 address): the AT+localservice commands to send over BLE, and a QR code of the URL and device token.",
+		Envelope:    true,
+		Response: struct {
+			Version   string   `json:"version"`
+			Port      string   `json:"port"`
+			BasePath  string   `json:"base_path"`
+			Addresses []string `json:"addresses"`
+			Setups    []struct {
+				lan.Setup
+				QRPNG string `json:"qr_png,omitempty"` // data:image/png;base64 URL
+			} `json:"setups"`
+		}{},
+	},
+
+	// Health
+	{
+		ID: "health", Method: "GET", Path: "/health", Tag: "health",
+		Summary: "Version, dependency, and worker status",
+		Response: struct {
+			Status       string                             `json:"status"` // ok or degraded
+			Service      string                             `json:"service"`
+			Version      string                             `json:"version"`
+			Commit       string                             `json:"commit"`
+			BuildDate    string                             `json:"build_date"`
+			ReadOnly     bool                               `json:"read_only"` // Serving a database copy (READ_ONLY)
+			Dependencies map[string]dependencyStatus        `json:"dependencies"`
+			Workers      map[string]supervisor.WorkerStatus `json:"workers"`
+		}{},
+	},
+	{
+		ID: "ready", Method: "GET", Path: "/ready", Tag: "health",
+		Summary:     "Readiness probe",
+		Description: "Answers 503 unless every dependency is reachable.",
+		Response: struct {
+			Status       string                      `json:"status"` // ready or not ready
+			Dependencies map[string]dependencyStatus `json:"dependencies"`
+		}{},
+	},
+}
+
+type dependencyStatus = struct {
+	Status    string       `json:"status"` // ok or down
+	LatencyMs int64        `json:"latency_ms"`
+	Error     string       `json:"error,omitempty"`
+	Circuit   string       `json:"circuit,omitempty"` // AI backends: closed, open or half-open
+	Queue     *queue.Stats `json:"queue,omitempty"`   // AI backends: calls running and waiting for a slot
+}
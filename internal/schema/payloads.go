@@ -0,0 +1,101 @@
+package schema
+
+import "github.com/brianhealey/sensecap-server/internal/models"
+
+func ptr[T any](v T) *T { return &v }
+
+// sampleImage is a placeholder for the base64 JPEG the device sends
+const sampleImage = "/9j/4AAQSkZJRgABAQAAAQABAAD..."
+
+// Payloads lists the device-facing JSON bodies with their Go types and a sample of each
+var Payloads = []Payload{
+	{
+		Name:        "notification-event-request",
+		Endpoint:    "POST /v1/notification/event",
+		Direction:   "request",
+		Description: "Alarm/notification event sent by the SenseCraft alarm module",
+		Type:        models.NotificationEventRequest{},
+		Sample: models.NotificationEventRequest{
+			RequestID: "a1b2c3d4-0000-4000-8000-000000000001",
+			DeviceEUI: "2CF7F1C04430000C",
+			Events: models.Events{
+				Timestamp: ptr(int64(1735689600000)),
+				Text:      ptr("Person detected at the front door"),
+				Img:       ptr(sampleImage),
+				Data: &models.EventData{
+					Inference: &models.InferenceData{
+						Boxes:       []models.BoundingBox{{120, 80, 60, 140, 87, 0}},
+						ClassesName: []string{"person"},
+					},
+					Sensor: &models.SensorData{
+						Temperature: ptr(22.5),
+						Humidity:    ptr(45),
+						CO2:         ptr(600),
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "notification-event-response",
+		Endpoint:    "POST /v1/notification/event",
+		Direction:   "response",
+		Description: "Acknowledgement of a notification event (code must be 200)",
+		Type:        models.NotificationResponse{},
+		Sample:      models.NotificationResponse{Code: 200},
+	},
+	{
+		Name:        "image-analyzer-request",
+		Endpoint:    "POST /v1/watcher/vision",
+		Direction:   "request",
+		Description: "Image sent by the image analyzer module (type 0 = RECOGNIZE, 1 = MONITORING)",
+		Type:        models.ImageAnalyzerRequest{},
+		Sample: models.ImageAnalyzerRequest{
+			Img:    sampleImage,
+			Prompt: "person enters room",
+			Type:   1,
+		},
+	},
+	{
+		Name:        "image-analyzer-response",
+		Endpoint:    "POST /v1/watcher/vision",
+		Direction:   "response",
+		Description: "Analysis result (state 1 = event detected, which triggers the alarm modules)",
+		Type:        models.ImageAnalyzerResponse{},
+		Sample: models.ImageAnalyzerResponse{
+			Code: 200,
+			Data: models.ImageAnalyzerResponseData{State: 1, Type: 1},
+		},
+	},
+	{
+		Name:        "talk-response",
+		Endpoint:    "POST /v2/watcher/talk/audio_stream",
+		Direction:   "response",
+		Description: "JSON part of the voice response, followed by a ---sensecraftboundary--- line and the WAV reply",
+		Type:        models.TalkResponse{},
+		Sample: models.TalkResponse{
+			Code: 200,
+			Data: models.TalkResponseData{
+				Mode:       0,
+				Duration:   4800,
+				STTResult:  "What is the weather today?",
+				ScreenText: "I don't have access to real-time weather data.",
+			},
+		},
+	},
+	{
+		Name:        "task-status-request",
+		Endpoint:    "POST /v2/watcher/task/status",
+		Direction:   "request",
+		Description: "Task flow engine status, as in the AT+taskflow? BLE response",
+		Type:        models.TaskFlowStatusRequest{},
+		Sample: models.TaskFlowStatusRequest{
+			Status:        2,
+			TLID:          1,
+			CTD:           1735689600000,
+			Module:        "ai camera",
+			ModuleErrCode: 0,
+			Percent:       100,
+		},
+	},
+}
@@ -0,0 +1,223 @@
+// Package schema generates JSON Schemas and sample payloads for the device-facing API from
+// the Go types in the models package, so firmware developers and integrators can validate
+// payloads against exactly what this server parses and sends.
+package schema
+
+//go:generate go run ./gen ../../docs/schemas
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// draft is the JSON Schema dialect of the generated schemas
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Payload is one device-facing JSON body
+type Payload struct {
+	Name        string      `json:"name"`      // Schema name, used in /api/schemas/{name} and file names
+	Endpoint    string      `json:"endpoint"`  // Method and path
+	Direction   string      `json:"direction"` // "request" (device to server) or "response" (server to device)
+	Description string      `json:"description"`
+	Type        interface{} `json:"-"` // Zero value of the Go type the schema is generated from
+	Sample      interface{} `json:"-"` // Example payload
+}
+
+// Generate returns the JSON Schema of a Go value's type, following encoding/json rules:
+// json tag names, omitempty and pointer fields are optional, "-" fields are skipped,
+// embedded structs are flattened, and fixed-size arrays become arrays with an exact length
+func Generate(p Payload) map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(p.Type))
+	s["$schema"] = draft
+	s["$id"] = p.Name + ".schema.json"
+	s["title"] = p.Name
+	if p.Description != "" {
+		s["description"] = p.Description
+	}
+	return s
+}
+
+// typeSchema maps a Go type to a self-contained JSON Schema
+func typeSchema(t reflect.Type) map[string]interface{} {
+	return (&generator{}).schema(t)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator maps Go types to JSON Schemas. With components set, named struct types are
+// added to it once and referenced with $ref (as OpenAPI documents do); otherwise every
+// schema is inlined.
+type generator struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Array:
+		return map[string]interface{}{
+			"type":     "array",
+			"items":    g.schema(t.Elem()),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if g.components == nil || t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.ref(t)
+	}
+	// interface{} and anything else: any JSON value
+	return map[string]interface{}{}
+}
+
+// ref adds a named struct type to the components and returns a reference to it
+func (g *generator) ref(t reflect.Type) map[string]interface{} {
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.components[name]; taken {
+			// Same type name in another package: qualify it, e.g. "database.Device"
+			pkg := t.PkgPath()
+			name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+		}
+		g.names[t] = name
+		g.components[name] = nil // Reserve the name before recursing into self-references
+		g.components[name] = g.structSchema(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// structSchema maps a struct to an object schema with its JSON fields
+func (g *generator) structSchema(t reflect.Type) map[string]interface{} {
+	f := fields{properties: make(map[string]interface{}), optional: make(map[string]bool)}
+	g.addFields(t, &f)
+
+	required := []string{}
+	for _, name := range f.order {
+		if _, ok := f.properties[name]; ok && !f.optional[name] {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           f.properties,
+		"required":             required,
+		"additionalProperties": true, // Newer firmware may send fields this server ignores
+	}
+}
+
+// fields collects the JSON fields of a struct in declaration order
+type fields struct {
+	properties map[string]interface{}
+	optional   map[string]bool
+	order      []string
+}
+
+// addFields adds a struct's JSON fields. Fields of embedded structs are added first so
+// the outer struct's fields shadow them, as encoding/json does.
+func (g *generator) addFields(t reflect.Type, f *fields) {
+	var direct []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		embedded := field.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			g.addFields(embedded, f)
+			continue
+		}
+		if field.IsExported() {
+			direct = append(direct, field)
+		}
+	}
+
+	for _, field := range direct {
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if _, ok := f.properties[name]; !ok {
+			f.order = append(f.order, name)
+		}
+		f.properties[name] = g.schema(field.Type)
+		f.optional[name] = field.Type.Kind() == reflect.Ptr || strings.Contains(opts, "omitempty")
+	}
+}
+
+// Find returns the payload with the given name
+func Find(name string) (Payload, error) {
+	for _, p := range Payloads {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Payload{}, fmt.Errorf("unknown schema: %s", name)
+}
+
+// WriteFiles writes <name>.schema.json and <name>.sample.json for every payload to dir
+func WriteFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create schema directory: %w", err)
+	}
+	for _, p := range Payloads {
+		if err := writeJSONFile(filepath.Join(dir, p.Name+".schema.json"), Generate(p)); err != nil {
+			return err
+		}
+		if err := writeJSONFile(filepath.Join(dir, p.Name+".sample.json"), p.Sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
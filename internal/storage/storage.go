@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+)
+
+// ErrNotFound is returned by Get when the key does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque binary objects (images, audio, captures) by key
+// Keys are slash-separated relative paths, e.g. "captures/20240101-120000_000001.json".
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Lister is implemented by stores that can enumerate their blobs (the filesystem store), e.g.
+// for backups
+type Lister interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+// New creates the BlobStore selected by cfg.Driver
+func New(cfg config.StorageConfig) (BlobStore, error) {
+	switch cfg.Driver {
+	case "", "fs":
+		return NewFilesystemStore(cfg.Dir)
+	case "s3":
+		return NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,149 @@
+// Package supervisor runs the server's background workers (task watchdog, metrics export,
+// config watcher, ...) and restarts them with exponential backoff when they fail, so one
+// failing integration neither dies silently nor takes the process down with a panic.
+package supervisor
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	initialBackoff = time.Second
+	maxBackoff     = 5 * time.Minute
+	// stableRun is how long a worker must run before a failure no longer counts toward a crash loop
+	stableRun = time.Minute
+	// crashLoopFailures consecutive quick failures mark a worker as crash looping
+	crashLoopFailures = 5
+)
+
+// Worker states
+const (
+	StateRunning   = "running"
+	StateBackoff   = "backoff"   // Failed and waiting to be restarted
+	StateCrashLoop = "crashloop" // Failed crashLoopFailures times in a row without running stably
+	StateStopped   = "stopped"   // Returned without error; not restarted
+)
+
+// WorkerStatus is the health and restart history of one worker
+type WorkerStatus struct {
+	State        string     `json:"state"`
+	StartedAt    time.Time  `json:"started_at"`           // Start of the current (or last) run
+	Restarts     int        `json:"restarts"`             // Restarts since the server started
+	Failures     int        `json:"consecutive_failures"` // Failures since the last stable run
+	LastError    string     `json:"last_error,omitempty"` // Error or panic of the last failure
+	LastFailedAt *time.Time `json:"last_failed_at,omitempty"`
+	NextRestart  *time.Time `json:"next_restart,omitempty"` // Set while in backoff or crash loop
+}
+
+// Healthy reports whether the worker is running (or finished cleanly)
+func (s WorkerStatus) Healthy() bool {
+	return s.State == StateRunning || s.State == StateStopped
+}
+
+var (
+	mu      sync.Mutex
+	workers = make(map[string]*WorkerStatus)
+)
+
+// Go runs fn as a supervised worker named name. fn is expected to run for the life of the
+// server; if it returns an error or panics it is restarted after a backoff that doubles from
+// 1s up to 5m, starting over once a run has lasted a minute. A nil return stops the worker.
+func Go(name string, fn func() error) {
+	mu.Lock()
+	if _, exists := workers[name]; exists {
+		mu.Unlock()
+		panic(fmt.Sprintf("supervisor: worker %s started twice", name))
+	}
+	status := &WorkerStatus{State: StateRunning}
+	workers[name] = status
+	mu.Unlock()
+
+	go func() {
+		backoff := initialBackoff
+		for {
+			started := time.Now()
+			update(name, func(s *WorkerStatus) {
+				s.State = StateRunning
+				s.StartedAt = started
+				s.NextRestart = nil
+			})
+
+			err := run(fn)
+			if err == nil {
+				log.Printf("Worker %s stopped", name)
+				update(name, func(s *WorkerStatus) { s.State = StateStopped })
+				return
+			}
+
+			failedAt := time.Now()
+			stable := failedAt.Sub(started) >= stableRun
+			if stable {
+				backoff = initialBackoff
+			}
+			next := failedAt.Add(backoff)
+
+			var failures int
+			update(name, func(s *WorkerStatus) {
+				if stable {
+					s.Failures = 0
+				}
+				s.Failures++
+				s.Restarts++
+				s.LastError = err.Error()
+				s.LastFailedAt = &failedAt
+				s.NextRestart = &next
+				s.State = StateBackoff
+				if s.Failures >= crashLoopFailures {
+					s.State = StateCrashLoop
+				}
+				failures = s.Failures
+			})
+
+			if failures >= crashLoopFailures {
+				log.Printf("ERROR: Worker %s is crash looping (%d failures in a row), restarting in %s: %v", name, failures, backoff, err)
+			} else {
+				log.Printf("ERROR: Worker %s failed, restarting in %s: %v", name, backoff, err)
+			}
+
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}()
+}
+
+// run calls fn, turning a panic into an error so it cannot take the process down
+func run(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ERROR: Worker panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// update changes a worker's status under the lock
+func update(name string, change func(s *WorkerStatus)) {
+	mu.Lock()
+	defer mu.Unlock()
+	change(workers[name])
+}
+
+// Status returns a snapshot of every worker's status by name
+func Status() map[string]WorkerStatus {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := make(map[string]WorkerStatus, len(workers))
+	for name, s := range workers {
+		snapshot[name] = *s
+	}
+	return snapshot
+}
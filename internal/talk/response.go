@@ -0,0 +1,94 @@
+// Package talk builds and parses the response of /v2/watcher/talk/audio_stream: the JSON
+// metadata, the boundary line, then the WAV reply. The framing is fixed by the firmware
+// (app_voice_interaction.c lines 313-348), which searches the body for the boundary and
+// plays everything after the newline that follows it, so it must be byte-exact.
+package talk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Boundary separates the JSON metadata from the audio
+const Boundary = "---sensecraftboundary---"
+
+// ContentType is the Content-Type the device expects for talk responses
+const ContentType = "application/octet-stream"
+
+// Response is one talk response
+type Response struct {
+	Meta  []byte // JSON metadata (models.TalkResponse), without a trailing newline
+	Audio []byte // WAV reply (may be empty)
+}
+
+// NewResponse marshals the metadata and pairs it with the reply audio
+func NewResponse(meta interface{}, audio []byte) (*Response, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal talk response: %w", err)
+	}
+	// encoding/json escapes nothing in "---sensecraftboundary---", so screen text that quotes
+	// it would end the metadata early on the device
+	if bytes.Contains(data, []byte(Boundary)) {
+		return nil, fmt.Errorf("talk response metadata contains the boundary")
+	}
+	return &Response{Meta: data, Audio: audio}, nil
+}
+
+// Parse splits a framed response into its metadata and audio, checking the framing
+func Parse(body []byte) (*Response, error) {
+	i := bytes.Index(body, []byte(Boundary))
+	if i < 0 {
+		return nil, fmt.Errorf("talk response has no boundary")
+	}
+	meta, rest := body[:i], body[i+len(Boundary):]
+	if len(rest) == 0 || rest[0] != '\n' {
+		return nil, fmt.Errorf("talk response boundary is not followed by a newline")
+	}
+	if !json.Valid(meta) {
+		return nil, fmt.Errorf("talk response metadata is not valid JSON")
+	}
+	return &Response{Meta: meta, Audio: rest[1:]}, nil
+}
+
+// Len is the framed size, sent as Content-Length: the device sizes its audio buffer from it
+func (r *Response) Len() int {
+	return len(r.Meta) + len(Boundary) + 1 + len(r.Audio) // +1 for the newline after the boundary
+}
+
+// Bytes returns the framed response
+func (r *Response) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Grow(r.Len())
+	r.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo writes the framed response
+func (r *Response) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, part := range [][]byte{r.Meta, []byte(Boundary + "\n"), r.Audio} {
+		n, err := w.Write(part)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Serve sends the response with its headers. Content-Length is critical: the device
+// downloads exactly that many bytes of audio.
+func (r *Response) Serve(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(r.Len()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := r.WriteTo(w); err != nil {
+		log.Printf("WARNING: Failed to send talk response: %v", err)
+	}
+}
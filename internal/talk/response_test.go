@@ -0,0 +1,106 @@
+package talk
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestNewResponseFrames(t *testing.T) {
+	resp, err := NewResponse(map[string]int{"code": 200}, []byte("RIFF...."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"code":200}` + Boundary + "\nRIFF...."
+	if got := string(resp.Bytes()); got != want {
+		t.Errorf("framed response %q, want %q", got, want)
+	}
+	if resp.Len() != len(want) {
+		t.Errorf("Len %d, want %d", resp.Len(), len(want))
+	}
+}
+
+func TestNewResponseRejectsBoundaryInMetadata(t *testing.T) {
+	meta := map[string]string{"screen_text": "the separator is " + Boundary}
+	if _, err := NewResponse(meta, nil); err == nil {
+		t.Error("metadata quoting the boundary was accepted")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantMeta  string
+		wantAudio string
+		wantErr   bool
+	}{
+		{name: "with audio", body: `{"code":200}` + Boundary + "\nRIFF", wantMeta: `{"code":200}`, wantAudio: "RIFF"},
+		{name: "without audio", body: `{"code":200}` + Boundary + "\n", wantMeta: `{"code":200}`},
+		// The device plays everything after the first boundary line, even bytes that repeat it
+		{name: "boundary repeated in audio", body: `{}` + Boundary + "\nRI" + Boundary + "FF", wantMeta: `{}`, wantAudio: "RI" + Boundary + "FF"},
+		{name: "boundary inside metadata", body: `{"text":"` + Boundary + "\n" + `"}` + Boundary + "\nRIFF", wantErr: true},
+		{name: "no boundary", body: `{"code":200}RIFF`, wantErr: true},
+		{name: "empty body", body: "", wantErr: true},
+		{name: "no newline after boundary", body: `{"code":200}` + Boundary + "RIFF", wantErr: true},
+		{name: "body ends at boundary", body: `{"code":200}` + Boundary, wantErr: true},
+		{name: "metadata not JSON", body: `{"code":` + Boundary + "\nRIFF", wantErr: true},
+		{name: "truncated boundary", body: `{"code":200}` + Boundary[:10], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Parse([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsed %q without error", tt.body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Meta) != tt.wantMeta || string(resp.Audio) != tt.wantAudio {
+				t.Errorf("got meta %q audio %q, want %q and %q", resp.Meta, resp.Audio, tt.wantMeta, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	resp, err := NewResponse(map[string]string{"stt_result": "hello"}, []byte{0, 1, '\n', 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(resp.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Meta, resp.Meta) || !bytes.Equal(parsed.Audio, resp.Audio) {
+		t.Errorf("parsed meta %q audio %q, want %q and %q", parsed.Meta, parsed.Audio, resp.Meta, resp.Audio)
+	}
+}
+
+func TestServeHeaders(t *testing.T) {
+	resp, err := NewResponse(map[string]int{"code": 200}, bytes.Repeat([]byte{0x7f}, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	resp.Serve(rec)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type %q, want %q", got, ContentType)
+	}
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Errorf("Content-Length %s for a %s byte body", got, want)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), resp.Bytes()) {
+		t.Error("served body differs from Bytes")
+	}
+}
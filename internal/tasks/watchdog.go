@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/database"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+)
+
+// StartWatchdog periodically checks that devices picked up their newest task within window.
+// A task counts as picked up once the device has fetched it via view_task_detail and has not
+// since reported a different tlid. Otherwise the user is alerted with a notification event.
+func StartWatchdog(window time.Duration) {
+	if window <= 0 {
+		return
+	}
+
+	interval := window / 2
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	log.Printf("Task pickup watchdog enabled: devices have %s to pick up new tasks", window)
+
+	supervisor.Go("task-watchdog", func() error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			checkDeployments(window)
+		}
+		return nil
+	})
+}
+
+// checkDeployments acknowledges or alerts on every deployment whose window has expired
+func checkDeployments(window time.Duration) {
+	deployments, err := database.GetPendingTaskDeployments(time.Now().Add(-window))
+	if err != nil {
+		log.Printf("ERROR: Task watchdog failed to load deployments: %v", err)
+		return
+	}
+
+	for _, d := range deployments {
+		problem := deploymentProblem(d)
+		if problem == "" {
+			if err := database.MarkTaskAcknowledged(d.TaskID); err != nil {
+				log.Printf("ERROR: Task watchdog: %v", err)
+			}
+			continue
+		}
+
+		log.Printf("WARNING: Device %s did not pick up task %d ('%s') within %s: %s",
+			d.DeviceEUI, d.TaskID, d.Headline, window, problem)
+		alert(d, problem)
+
+		if err := database.MarkTaskDeploymentAlerted(d.TaskID); err != nil {
+			log.Printf("ERROR: Task watchdog: %v", err)
+		}
+	}
+}
+
+// deploymentProblem explains why a deployment was not picked up, or returns "" if it was
+func deploymentProblem(d *database.TaskDeployment) string {
+	if d.DeliveredAt == nil {
+		return "the device has not fetched it from view_task_detail"
+	}
+	if d.Status != nil && d.Status.ReportedAt.After(*d.DeliveredAt) && d.Status.TLID != int64(d.TaskID) {
+		return fmt.Sprintf("the device is still running task %d", d.Status.TLID)
+	}
+	return ""
+}
+
+// alert records a notification event so the user sees the device is on a stale task
+func alert(d *database.TaskDeployment, problem string) {
+	event := &database.NotificationEvent{
+		RequestID:    fmt.Sprintf("task-not-picked-up-%d", d.TaskID),
+		DeviceEUI:    d.DeviceEUI,
+		Timestamp:    time.Now().UnixMilli(),
+		Text:         fmt.Sprintf("Task '%s' was not picked up: %s", d.Headline, problem),
+		EventType:    database.EventTelemetry,
+		TLID:         d.TaskID,
+		TaskHeadline: d.Headline,
+	}
+	if err := database.SaveNotificationEvent(event); err != nil {
+		log.Printf("ERROR: Failed to save task watchdog notification: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package tracing exports traces of the voice pipeline to an OpenTelemetry collector over
+// OTLP/HTTP, so the time of each stage of a voice request shows up in Jaeger or Tempo
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianhealey/sensecap-server/internal/config"
+	"github.com/brianhealey/sensecap-server/internal/supervisor"
+	"github.com/brianhealey/sensecap-server/internal/version"
+)
+
+const (
+	queueSize     = 256             // Traces waiting for export; more are dropped
+	batchSize     = 64              // Traces sent in one request
+	flushInterval = 5 * time.Second // Longest a trace waits for its batch to fill
+)
+
+// Span is a timed operation of a trace. Spans are recorded after the fact, from the start
+// and end times the caller measured.
+type Span struct {
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      string // Status message of a failed operation (empty = ok)
+}
+
+// trace is a root span and the spans of its stages
+type trace struct {
+	root     Span
+	children []Span
+}
+
+var (
+	traces  chan trace
+	dropped atomic.Int64
+)
+
+// Enabled reports whether traces are exported
+func Enabled() bool {
+	return traces != nil
+}
+
+// Start exports the traces passed to Record to the OTLP/HTTP collector at
+// cfg.OTLPEndpoint (JSON encoding, accepted by Jaeger and the OpenTelemetry Collector on
+// port 4318). Export is best effort: traces are sent in batches, and dropped when the
+// collector is unreachable or cannot keep up.
+func Start(cfg config.TracingConfig) error {
+	if cfg.OTLPEndpoint == "" {
+		return nil
+	}
+
+	url := strings.TrimSuffix(cfg.OTLPEndpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	e := &exporter{url: url, service: cfg.ServiceName, client: &http.Client{Timeout: 10 * time.Second}}
+	traces = make(chan trace, queueSize)
+
+	log.Printf("Tracing enabled: voice pipeline traces are exported to %s", url)
+
+	supervisor.Go("trace-export", func() error {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		var batch []trace
+		for {
+			select {
+			case t := <-traces:
+				batch = append(batch, t)
+				if len(batch) < batchSize {
+					continue
+				}
+			case <-ticker.C:
+				if len(batch) == 0 {
+					continue
+				}
+			}
+			e.export(batch)
+			batch = nil
+		}
+	})
+	return nil
+}
+
+// Record queues a trace of root and the spans of its stages for export. It never blocks:
+// when the queue is full, the trace is dropped.
+func Record(root Span, children ...Span) {
+	if traces == nil {
+		return
+	}
+	select {
+	case traces <- trace{root: root, children: children}:
+	default:
+		if n := dropped.Add(1); n == 1 || n%100 == 0 {
+			log.Printf("WARNING: Trace export cannot keep up, %d traces dropped", n)
+		}
+	}
+}
+
+// exporter sends batches of traces to the collector
+type exporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// export sends a batch of traces. Failed batches are dropped, not retried: traces are
+// diagnostics, and a collector that is down would only make them pile up.
+func (e *exporter) export(batch []trace) {
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		log.Printf("ERROR: Failed to encode traces: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("ERROR: Failed to export traces: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Printf("WARNING: Trace export failed, dropped %d traces: %v", len(batch), err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("WARNING: Trace export rejected %d traces (status %d): %s", len(batch), resp.StatusCode, bytes.TrimSpace(msg))
+	}
+}
+
+// OTLP JSON encoding of ExportTraceServiceRequest (only the fields used here)
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 0 = unset, 2 = error
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// Span kinds and status codes of OTLP
+const (
+	kindInternal = 1
+	kindServer   = 2
+	statusError  = 2
+)
+
+// encode builds the OTLP request of a batch, giving each trace and span a random ID
+func (e *exporter) encode(batch []trace) *otlpRequest {
+	var spans []otlpSpan
+	for _, t := range batch {
+		traceID := randomID(16)
+		root := encodeSpan(t.root, traceID, randomID(8), "", kindServer)
+		spans = append(spans, root)
+		for _, child := range t.children {
+			spans = append(spans, encodeSpan(child, traceID, randomID(8), root.SpanID, kindInternal))
+		}
+	}
+
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.service}},
+			{Key: "service.version", Value: otlpValue{StringValue: version.Version}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/brianhealey/sensecap-server", Version: version.Version},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func encodeSpan(s Span, traceID, spanID, parentID string, kind int) otlpSpan {
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		ParentSpanID:      parentID,
+		Name:              s.Name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+	for key, value := range s.Attributes {
+		span.Attributes = append(span.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	}
+	if s.Error != "" {
+		span.Status = otlpStatus{Code: statusError, Message: s.Error}
+	}
+	return span
+}
+
+// randomID returns n random bytes as hex (16 for trace IDs, 8 for span IDs)
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("tracing: failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,39 @@
+// Package version holds the build's version information, stamped at link time:
+//
+//	go build -ldflags "-X github.com/brianhealey/sensecap-server/internal/version.Version=v1.2.0 ..."
+//
+// `make build` and `make release` set all three values.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"     // Release version (git describe)
+	Commit    = "unknown" // Git commit
+	BuildDate = "unknown" // UTC build time, RFC 3339
+)
+
+func init() {
+	// Plain `go build` records the commit in the build info; use it when not stamped
+	if Commit != "unknown" {
+		return
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			Commit = s.Value
+		}
+	}
+}
+
+// String describes the build for --version and the startup banner
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s %s/%s)", Version, Commit, BuildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -30,6 +30,7 @@ type BLEHandler struct {
 	responseBuf     strings.Builder
 	responseMutex   sync.Mutex
 	responseReady   chan struct{}
+	listener        func([]byte)
 	connected       bool
 	responseTimeout time.Duration
 }
@@ -183,11 +184,23 @@ func (h *BLEHandler) Disconnect() error {
 	return nil
 }
 
+// SetNotificationListener registers a function that receives every raw notification
+// from the device as it arrives (nil removes it). Used by the CLI's raw AT console.
+func (h *BLEHandler) SetNotificationListener(fn func([]byte)) {
+	h.responseMutex.Lock()
+	h.listener = fn
+	h.responseMutex.Unlock()
+}
+
 // handleNotification processes incoming notifications from the read characteristic
 func (h *BLEHandler) handleNotification(data []byte) {
 	h.responseMutex.Lock()
 	defer h.responseMutex.Unlock()
 
+	if h.listener != nil {
+		h.listener(append([]byte(nil), data...))
+	}
+
 	h.responseBuf.Write(data)
 
 	currentBuf := h.responseBuf.String()
@@ -262,6 +275,28 @@ func (h *BLEHandler) SendCommand(command string) (*ATResponse, error) {
 	}
 }
 
+// SendRaw writes a command to the device without waiting for or parsing a response.
+// Responses arrive through the notification listener.
+func (h *BLEHandler) SendRaw(command string) error {
+	if !h.connected {
+		return errors.New("not connected to device")
+	}
+
+	// Responses are not collected here, so keep the buffer from growing
+	h.responseMutex.Lock()
+	h.responseBuf.Reset()
+	h.responseMutex.Unlock()
+
+	if !strings.HasSuffix(command, "\r\n") {
+		command += "\r\n"
+	}
+
+	if _, err := h.writeChar.Write([]byte(command)); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return nil
+}
+
 // IsConnected returns whether currently connected to a device
 func (h *BLEHandler) IsConnected() bool {
 	return h.connected
@@ -1,8 +1,10 @@
 package watcher
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 )
 
 // AT Command Builders
@@ -152,3 +154,72 @@ func BuildBindCommand(code int) (string, error) {
 
 	return fmt.Sprintf("AT+bind=%s", string(jsonData)), nil
 }
+
+// BuildOTAQuery builds AT+ota? command
+func BuildOTAQuery() string {
+	return "AT+ota?"
+}
+
+// BuildOTABeginCommand builds the AT+ota= command that starts (or resumes) a firmware transfer
+func BuildOTABeginCommand(component string, size int, sha256Hex string) (string, error) {
+	payload := map[string]interface{}{
+		"action":    "begin",
+		"component": component,
+		"size":      size,
+		"sha256":    sha256Hex,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("AT+ota=%s", string(jsonData)), nil
+}
+
+// BuildOTADataCommand builds the AT+ota= command carrying one firmware chunk
+func BuildOTADataCommand(offset int, chunk []byte) (string, error) {
+	payload := map[string]interface{}{
+		"action": "data",
+		"offset": offset,
+		"data":   base64.StdEncoding.EncodeToString(chunk),
+		"crc32":  crc32.ChecksumIEEE(chunk),
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("AT+ota=%s", string(jsonData)), nil
+}
+
+// BuildOTAEndCommand builds the AT+ota= command that finishes a transfer (device verifies SHA-256)
+func BuildOTAEndCommand() (string, error) {
+	jsonData, err := json.Marshal(map[string]string{"action": "end"})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("AT+ota=%s", string(jsonData)), nil
+}
+
+// BuildSelfTestCommand builds the AT+selftest= command that makes the device call the
+// server's /v2/watcher/selftest endpoint. An empty url and token use the device's configured
+// audio_task_composer service.
+func BuildSelfTestCommand(url, token string) (string, error) {
+	payload := map[string]string{}
+	if url != "" {
+		payload["url"] = url
+	}
+	if token != "" {
+		payload["token"] = token
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("AT+selftest=%s", string(jsonData)), nil
+}
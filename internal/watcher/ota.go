@@ -0,0 +1,128 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultOTAChunkSize is the firmware bytes sent per AT+ota data command
+// (base64 expands it by a third; the device buffers up to 500KB per command)
+const DefaultOTAChunkSize = 4096
+
+// otaChunkRetries is how many times a failed chunk is retried before giving up
+const otaChunkRetries = 3
+
+// OTAProgress is called after every acknowledged chunk with the bytes transferred so far
+type OTAProgress func(sent, total int)
+
+// PushFirmware transfers a firmware image to the device over BLE.
+// Each chunk carries a CRC32 the device checks; the device verifies the SHA-256 of the
+// whole image before applying it. If the device already holds part of the same image
+// (an earlier transfer was interrupted), the transfer resumes from the device's offset.
+func (h *BLEHandler) PushFirmware(component string, image []byte, chunkSize int, progress OTAProgress) error {
+	if len(image) == 0 {
+		return fmt.Errorf("firmware image is empty")
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultOTAChunkSize
+	}
+
+	sum := sha256.Sum256(image)
+	digest := hex.EncodeToString(sum[:])
+
+	cmd, err := BuildOTABeginCommand(component, len(image), digest)
+	if err != nil {
+		return err
+	}
+	state, err := h.sendOTACommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start firmware transfer: %w", err)
+	}
+
+	offset := state.Offset
+	if offset < 0 || offset > len(image) {
+		return fmt.Errorf("device reported invalid resume offset %d", offset)
+	}
+	if offset > 0 {
+		fmt.Printf("Resuming transfer at %d of %d bytes\n", offset, len(image))
+	}
+
+	for offset < len(image) {
+		end := offset + chunkSize
+		if end > len(image) {
+			end = len(image)
+		}
+
+		next, err := h.sendOTAChunk(offset, image[offset:end])
+		if err != nil {
+			return fmt.Errorf("transfer failed at offset %d (re-run to resume): %w", offset, err)
+		}
+		offset = next
+
+		if progress != nil {
+			progress(offset, len(image))
+		}
+	}
+
+	cmd, err = BuildOTAEndCommand()
+	if err != nil {
+		return err
+	}
+	if _, err := h.sendOTACommand(cmd); err != nil {
+		return fmt.Errorf("device rejected firmware image (SHA-256 %s): %w", digest, err)
+	}
+
+	return nil
+}
+
+// sendOTAChunk sends one chunk, retrying on errors. After a failure the device's
+// offset is re-queried, since the chunk may have been accepted before the reply was lost.
+func (h *BLEHandler) sendOTAChunk(offset int, chunk []byte) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt < otaChunkRetries; attempt++ {
+		if attempt > 0 {
+			state, err := h.sendOTACommand(BuildOTAQuery())
+			if err == nil && state.Offset == offset+len(chunk) {
+				return state.Offset, nil
+			}
+		}
+
+		cmd, err := BuildOTADataCommand(offset, chunk)
+		if err != nil {
+			return 0, err
+		}
+
+		state, err := h.sendOTACommand(cmd)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if state.Offset != offset+len(chunk) {
+			lastErr = fmt.Errorf("device acknowledged offset %d, expected %d", state.Offset, offset+len(chunk))
+			continue
+		}
+		return state.Offset, nil
+	}
+	return 0, lastErr
+}
+
+// sendOTACommand sends an AT+ota command and parses the transfer state from the response
+func (h *BLEHandler) sendOTACommand(cmd string) (*OTAState, error) {
+	resp, err := h.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("command failed with code: %d", resp.Code)
+	}
+
+	var state OTAState
+	if len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse OTA state: %w", err)
+		}
+	}
+	return &state, nil
+}
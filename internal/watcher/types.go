@@ -51,3 +51,19 @@ type LocalServiceData struct {
 	Training          *LocalServiceConfig `json:"training,omitempty"`
 	NotificationProxy *LocalServiceConfig `json:"notification_proxy,omitempty"`
 }
+
+// OTAState is the device's firmware transfer state (AT+ota response data)
+type OTAState struct {
+	Component string `json:"component"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256"`
+	Offset    int    `json:"offset"` // Bytes received and CRC-checked so far
+}
+
+// SelfTestResult is the outcome of the device calling /v2/watcher/selftest (AT+selftest response data)
+type SelfTestResult struct {
+	Status     int    `json:"status"`      // HTTP status from the server (0 = no response)
+	LatencyMs  int    `json:"latency_ms"`  // Request round trip
+	AudioBytes int    `json:"audio_bytes"` // Size of the WAV the device parsed from the reply
+	Error      string `json:"error"`       // Connection or parse error, if any
+}
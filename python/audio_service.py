@@ -1,15 +1,23 @@
 #!/usr/bin/env python3
 """
 Audio Processing Service for SenseCAP Server
-Provides Speech-to-Text (Whisper) and Text-to-Speech (Piper) endpoints
+Provides Speech-to-Text (Whisper) and Text-to-Speech (Piper) endpoints, and optionally
+object detection (a YOLO ONNX model) for the server's "detector" vision provider
 """
 
+import ast
 import os
 import io
+import queue
 import tempfile
+import threading
+import time
 import wave
+from contextlib import contextmanager
 import numpy as np
+import onnxruntime
 import whisper
+from PIL import Image
 from piper import PiperVoice
 from flask import Flask, request, jsonify, send_file
 import logging
@@ -20,23 +28,114 @@ logger = logging.getLogger(__name__)
 
 app = Flask(__name__)
 
+
+class ModelPool:
+    """
+    A fixed set of loaded model instances. Each request borrows one, so at most `size`
+    requests use a model at once (Flask serves requests on threads, and one instance must
+    not run two requests concurrently); the rest wait in arrival order.
+    """
+
+    def __init__(self, name, load, size):
+        self.name = name
+        self.size = size
+        self.free = queue.Queue()
+        self.lock = threading.Lock()
+        self.busy = 0
+        self.waiting = 0
+        self.warmup_ms = None
+        for i in range(size):
+            logger.info(f"Loading {name} worker {i + 1}/{size}...")
+            self.free.put(load())
+
+    @contextmanager
+    def borrow(self):
+        with self.lock:
+            self.waiting += 1
+        instance = self.free.get()
+        with self.lock:
+            self.waiting -= 1
+            self.busy += 1
+        try:
+            yield instance
+        finally:
+            with self.lock:
+                self.busy -= 1
+            self.free.put(instance)
+
+    def warm_up(self, run):
+        """
+        Run every instance once: the first inference allocates buffers and compiles kernels,
+        which would otherwise make the first voice interaction after boot seconds slower
+        """
+        start = time.monotonic()
+        instances = [self.free.get() for _ in range(self.size)]
+        try:
+            for instance in instances:
+                run(instance)
+        finally:
+            for instance in instances:
+                self.free.put(instance)
+        self.warmup_ms = int((time.monotonic() - start) * 1000)
+        logger.info(f"{self.name} warmed up in {self.warmup_ms} ms")
+
+    def stats(self):
+        with self.lock:
+            return {"workers": self.size, "busy": self.busy, "waiting": self.waiting, "warmup_ms": self.warmup_ms}
+
+
 # Initialize models
-logger.info("Loading Whisper model (base)...")
-whisper_model = whisper.load_model("base")
-logger.info("Whisper model loaded")
+# Smaller models (tiny) keep transcription fast on CPU-only hosts such as a Raspberry Pi
+whisper_model_name = os.environ.get("WHISPER_MODEL", "base")
+whisper_pool = ModelPool("whisper", lambda: whisper.load_model(whisper_model_name),
+                         int(os.environ.get("WHISPER_WORKERS", "1")))
+logger.info(f"Whisper model loaded ({whisper_model_name})")
 
-logger.info("Loading Piper TTS model...")
 piper_voice_name = os.environ.get("PIPER_VOICE", "en_US-lessac-medium")
 piper_model_path = f"models/piper/{piper_voice_name}.onnx"
-logger.info(f"Loading Piper voice: {piper_voice_name}")
-piper_voice = PiperVoice.load(piper_model_path)
-logger.info("Piper TTS model loaded")
+piper_pool = ModelPool("piper", lambda: PiperVoice.load(piper_model_path),
+                       int(os.environ.get("PIPER_WORKERS", "1")))
+logger.info(f"Piper TTS model loaded ({piper_voice_name})")
+
+# Object detection is optional: it needs a YOLOv8-style ONNX model, e.g. exported with
+# `yolo export model=yolov8n.pt format=onnx`
+detector_model_path = os.environ.get("DETECTOR_MODEL", "models/yolo/yolov8n.onnx")
+detector_min_confidence = float(os.environ.get("DETECTOR_MIN_CONFIDENCE", "0.4"))
+detector_pool = None
+detector_classes = []
+if os.path.exists(detector_model_path):
+    detector_pool = ModelPool("detector", lambda: onnxruntime.InferenceSession(
+        detector_model_path, providers=["CPUExecutionProvider"]), int(os.environ.get("DETECTOR_WORKERS", "1")))
+    # Ultralytics exports carry the class names, e.g. "{0: 'person', 1: 'bicycle', ...}"
+    with detector_pool.borrow() as session:
+        names = session.get_modelmeta().custom_metadata_map.get("names", "{}")
+        detector_input = session.get_inputs()[0]
+    detector_classes = [name for _, name in sorted(ast.literal_eval(names).items())]
+    detector_size = detector_input.shape[2] if isinstance(detector_input.shape[2], int) else 640
+    logger.info(f"Object detector loaded ({detector_model_path}, {len(detector_classes)} classes)")
+else:
+    logger.info(f"Object detection disabled: no model at {detector_model_path}")
+
+# Warm up before serving, so the server's health probes only see the service once the
+# first request will be as fast as later ones
+if os.environ.get("WARMUP", "true").lower() in ("true", "1"):
+    whisper_pool.warm_up(lambda model: model.transcribe(np.zeros(16000, dtype=np.float32)))  # One second of silence
+    piper_pool.warm_up(lambda voice: list(voice.synthesize("Hello.")))
+    if detector_pool:
+        detector_pool.warm_up(lambda session: session.run(
+            None, {detector_input.name: np.zeros((1, 3, detector_size, detector_size), dtype=np.float32)}))
 
 
 @app.route('/health', methods=['GET'])
 def health():
     """Health check endpoint"""
-    return jsonify({"status": "ok", "models": {"whisper": "base", "piper": piper_voice_name}})
+    return jsonify({
+        "status": "ok",
+        "models": {"whisper": whisper_model_name, "piper": piper_voice_name,
+                   "detector": detector_model_path if detector_pool else None},
+        "workers": {"whisper": whisper_pool.stats(), "piper": piper_pool.stats(),
+                    "detector": detector_pool.stats() if detector_pool else None},
+    })
 
 
 @app.route('/transcribe', methods=['POST'])
@@ -102,7 +201,8 @@ def transcribe():
         try:
             # Transcribe with Whisper
             logger.info("Transcribing audio...")
-            result = whisper_model.transcribe(temp_path)
+            with whisper_pool.borrow() as whisper_model:
+                result = whisper_model.transcribe(temp_path)
 
             text = result["text"].strip()
             language = result["language"]
@@ -141,9 +241,8 @@ def synthesize():
         logger.info(f"Synthesizing speech for: '{text}' (format: {output_format})")
 
         # Generate speech with Piper (returns audio chunks)
-        audio_chunks = []
-        for audio_chunk in piper_voice.synthesize(text):
-            audio_chunks.append(audio_chunk)
+        with piper_pool.borrow() as piper_voice:
+            audio_chunks = list(piper_voice.synthesize(text))
 
         # Combine all audio chunks
         if not audio_chunks:
@@ -151,15 +250,19 @@ def synthesize():
 
         # Combine all raw PCM data
         pcm_data = b''.join(chunk.audio_int16_bytes for chunk in audio_chunks)
-        logger.info(f"Generated {len(pcm_data)} bytes of raw PCM from {len(audio_chunks)} chunks")
+        logger.info(f"Generated {len(pcm_data)} bytes of raw PCM from {len(audio_chunks)} chunks "
+                    f"({audio_chunks[0].sample_rate}Hz)")
 
         if output_format == 'wav':
             # Return as WAV file
             wav_io = io.BytesIO()
+            # Label the audio with the voice's real parameters (not every voice is 16kHz);
+            # the server converts it to what the device plays
+            first = audio_chunks[0]
             with wave.open(wav_io, 'wb') as wav_file:
-                wav_file.setnchannels(1)
-                wav_file.setsampwidth(2)
-                wav_file.setframerate(16000)
+                wav_file.setnchannels(first.sample_channels)
+                wav_file.setsampwidth(first.sample_width)
+                wav_file.setframerate(first.sample_rate)
                 wav_file.writeframes(pcm_data)
 
             wav_io.seek(0)
@@ -183,6 +286,85 @@ def synthesize():
         return jsonify({"error": str(e)}), 500
 
 
+
+def letterbox(image, size):
+    """Scale an image to fit a size x size square, padded with gray; returns the scale and padding"""
+    scale = min(size / image.width, size / image.height)
+    width, height = round(image.width * scale), round(image.height * scale)
+    padded = Image.new("RGB", (size, size), (114, 114, 114))
+    left, top = (size - width) // 2, (size - height) // 2
+    padded.paste(image.resize((width, height), Image.BILINEAR), (left, top))
+    return padded, scale, left, top
+
+
+def non_max_suppression(boxes, scores, iou_threshold=0.45):
+    """Indexes of the boxes (x1, y1, x2, y2) kept after suppressing overlaps, best first"""
+    order = scores.argsort()[::-1]
+    keep = []
+    while order.size > 0:
+        best = order[0]
+        keep.append(best)
+        x1 = np.maximum(boxes[best, 0], boxes[order[1:], 0])
+        y1 = np.maximum(boxes[best, 1], boxes[order[1:], 1])
+        x2 = np.minimum(boxes[best, 2], boxes[order[1:], 2])
+        y2 = np.minimum(boxes[best, 3], boxes[order[1:], 3])
+        overlap = np.maximum(0, x2 - x1) * np.maximum(0, y2 - y1)
+        area = (boxes[:, 2] - boxes[:, 0]) * (boxes[:, 3] - boxes[:, 1])
+        iou = overlap / (area[best] + area[order[1:]] - overlap)
+        order = order[1:][iou <= iou_threshold]
+    return keep
+
+
+@app.route('/detect', methods=['POST'])
+def detect():
+    """
+    Detect objects with the YOLO ONNX model
+    Expects: a JPEG image
+    Returns: {"detections": [{"class": "person", "confidence": 0.91, "box": [x, y, w, h]}]}
+             (box in pixels of the image)
+    """
+    if detector_pool is None:
+        return jsonify({"error": f"object detection is disabled (no model at {detector_model_path})"}), 503
+    try:
+        image = Image.open(io.BytesIO(request.data)).convert("RGB")
+        padded, scale, left, top = letterbox(image, detector_size)
+        blob = np.asarray(padded, dtype=np.float32).transpose(2, 0, 1)[np.newaxis] / 255.0
+
+        with detector_pool.borrow() as session:
+            output = session.run(None, {detector_input.name: blob})[0][0]
+
+        # YOLOv8 output: one column per candidate, rows cx, cy, w, h and a score per class
+        candidates = output.T
+        class_ids = candidates[:, 4:].argmax(axis=1)
+        scores = candidates[np.arange(len(candidates)), 4 + class_ids]
+        mask = scores >= detector_min_confidence
+        candidates, class_ids, scores = candidates[mask], class_ids[mask], scores[mask]
+
+        cx, cy, w, h = candidates[:, 0], candidates[:, 1], candidates[:, 2], candidates[:, 3]
+        boxes = np.stack([cx - w / 2, cy - h / 2, cx + w / 2, cy + h / 2], axis=1)
+        boxes = (boxes - [left, top, left, top]) / scale
+
+        detections = []
+        for class_id in np.unique(class_ids):
+            of_class = np.where(class_ids == class_id)[0]
+            for i in non_max_suppression(boxes[of_class], scores[of_class]):
+                x1, y1, x2, y2 = boxes[of_class][i]
+                name = detector_classes[class_id] if class_id < len(detector_classes) else str(class_id)
+                detections.append({
+                    "class": name,
+                    "confidence": round(float(scores[of_class][i]), 3),
+                    "box": [round(float(x1)), round(float(y1)), round(float(x2 - x1)), round(float(y2 - y1))],
+                })
+
+        detections.sort(key=lambda d: d["confidence"], reverse=True)
+        logger.info(f"Detected {len(detections)} objects in a {image.width}x{image.height} image")
+        return jsonify({"detections": detections})
+
+    except Exception as e:
+        logger.error(f"Detection error: {e}")
+        return jsonify({"error": str(e)}), 500
+
+
 if __name__ == '__main__':
     # Run on port 8835
     logger.info("Starting Audio Service on http://localhost:8835")
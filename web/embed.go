@@ -0,0 +1,15 @@
+// Package web embeds the dashboard's static files into the server binary.
+package web
+
+import "embed"
+
+// Files holds the dashboard pages, scripts and stylesheet
+//
+//go:embed *.html *.css *.js
+var Files embed.FS
+
+// SwaggerUI holds the Swagger UI script and stylesheet of the API docs page, under swagger-ui/
+// (swagger-ui-dist 5.32.8; see swagger-ui/README.md)
+//
+//go:embed swagger-ui
+var SwaggerUI embed.FS
@@ -0,0 +1,63 @@
+// Dashboard translations. Elements marked with data-i18n (text) or data-i18n-placeholder are
+// translated from their English text, which is the key into the server's locale bundle
+// (GET /api/locale); scripts translate the messages they build with t(). The language is the
+// one chosen in the header, remembered in the browser and, when signed in, on the account.
+
+const i18n = {language: 'en', messages: {}};
+
+// t translates an English message and fills its %s/%d placeholders in order
+function t(text, ...args) {
+  let message = i18n.messages[text] || text;
+  for (const arg of args) message = message.replace(/%[sd]/, arg);
+  return message;
+}
+
+// loadTranslations fetches the bundle of the chosen language (or the browser's) and
+// translates the page, filling the #language selector if there is one
+async function loadTranslations(apiRoot) {
+  const url = new URL('locale', apiRoot);
+  const chosen = localStorage.getItem('language');
+  if (chosen) url.searchParams.set('lang', chosen);
+
+  try {
+    const resp = await fetch(url);
+    if (!resp.ok) throw new Error('HTTP ' + resp.status);
+    const body = await resp.json();
+    i18n.language = body.data.language;
+    i18n.messages = body.data.messages;
+    languageSelector(apiRoot, body.data.languages);
+  } catch (err) {
+    console.warn('Failed to load translations, showing English:', err);
+  }
+
+  document.documentElement.lang = i18n.language;
+  for (const el of document.querySelectorAll('[data-i18n]')) el.textContent = t(el.textContent.trim());
+  for (const el of document.querySelectorAll('[data-i18n-placeholder]')) el.placeholder = t(el.placeholder);
+}
+
+// rememberLanguage keeps an account's language for the next page loads ('' = the browser's)
+function rememberLanguage(language) {
+  if (language) localStorage.setItem('language', language);
+  else localStorage.removeItem('language');
+}
+
+function languageSelector(apiRoot, languages) {
+  const select = document.getElementById('language');
+  if (!select) return;
+  select.replaceChildren();
+  for (const lang of languages) select.add(new Option(lang.name, lang.code, false, lang.code === i18n.language));
+
+  select.addEventListener('change', async () => {
+    rememberLanguage(select.value);
+    // Store it on the account too; fails harmlessly without a login session
+    const token = localStorage.getItem('apiToken');
+    if (token) {
+      await fetch(new URL('me', apiRoot), {
+        method: 'PUT',
+        headers: {'Content-Type': 'application/json', 'Authorization': token},
+        body: JSON.stringify({language: select.value}),
+      }).catch(() => {});
+    }
+    window.location.reload();
+  });
+}